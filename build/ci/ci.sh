@@ -46,7 +46,8 @@ case $ACTION in
     release)
         run go build -v ./cmd/mothd
         run go build -v ./cmd/transpile
-        run tar czf moth-$(git tag --contains).$(uname -s)-$(uname -m).tar.gz mothd transpile theme
+        run go build -v ./cmd/moth
+        run tar czf moth-$(git tag --contains).$(uname -s)-$(uname -m).tar.gz mothd transpile moth theme
         ;;
 *)
     echo "Unknown action: $1" 1>&2
@@ -0,0 +1,25 @@
+#! /bin/sh
+
+# Build a kiosk mothd: one program with a theme and mothballs built in
+
+set -e
+
+if [ $# -lt 3 ]; then
+    echo "Usage: $0 THEME MOTHBALLS OUTPUT" 1>&2
+    echo "Set GOOS and GOARCH to build for another system, like GOOS=windows." 1>&2
+    exit 1
+fi
+
+theme=$(cd "$1" && pwd)
+mothballs=$(cd "$2" && pwd)
+output=$(cd "$(dirname "$3")" && pwd)/$(basename "$3")
+
+cd $(dirname $0)/../../cmd/mothd
+rm -rf kiosk/theme kiosk/mothballs
+trap 'rm -rf kiosk/theme kiosk/mothballs' EXIT
+cp -a "$theme" kiosk/theme
+mkdir kiosk/mothballs
+cp "$mothballs"/*.mb kiosk/mothballs
+
+CGO_ENABLED=0 go build -tags kiosk -o "$output" .
+echo "=== Built $output"
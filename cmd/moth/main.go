@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dirtbags/moth/v4/pkg/client"
+	"github.com/spf13/afero"
+)
+
+// T represents the state of things
+type T struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Args   []string
+	Fs     afero.Fs
+
+	// Getenv looks up environment variables
+	Getenv func(string) string
+
+	// output is where "get" writes the file, or "-" for Stdout
+	output string
+
+	client *client.Client
+}
+
+// Command is a function invoked by the user
+type Command func(ctx context.Context) error
+
+func nothing(ctx context.Context) error {
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, " Usage: moth register [FLAGS] NAME [DIVISION]")
+	fmt.Fprintln(w, "        Register the team as NAME")
+	fmt.Fprintln(w, " Usage: moth list [FLAGS]")
+	fmt.Fprintln(w, "        List the puzzles the team can open, and which are solved")
+	fmt.Fprintln(w, " Usage: moth show [FLAGS] CATEGORY POINTS")
+	fmt.Fprintln(w, "        Show a puzzle as plain text")
+	fmt.Fprintln(w, " Usage: moth get [FLAGS] CATEGORY POINTS FILENAME")
+	fmt.Fprintln(w, "        Download one of a puzzle's attachments")
+	fmt.Fprintln(w, " Usage: moth answer [FLAGS] CATEGORY POINTS ANSWER")
+	fmt.Fprintln(w, "        Submit an answer for a puzzle")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "-url URL")
+	fmt.Fprintln(w, "        Server URL, default $MOTH_URL")
+	fmt.Fprintln(w, "-id TEAMID")
+	fmt.Fprintln(w, "        Team ID, default $MOTH_TEAM_ID")
+	fmt.Fprintln(w, "-o FILENAME")
+	fmt.Fprintln(w, "        With get, write the attachment to FILENAME, or - for standard output")
+}
+
+// ParseArgs parses arguments and returns the appropriate action.
+func (t *T) ParseArgs() (Command, error) {
+	var cmd Command
+	var nargs, maxArgs int
+
+	if len(t.Args) == 1 {
+		usage(t.Stderr)
+		return nothing, nil
+	}
+
+	flags := flag.NewFlagSet(t.Args[1], flag.ContinueOnError)
+	flags.SetOutput(t.Stderr)
+	serverURL := flags.String("url", t.Getenv("MOTH_URL"), "Server URL")
+	teamID := flags.String("id", t.Getenv("MOTH_TEAM_ID"), "Team ID")
+	flags.StringVar(&t.output, "o", "", "Where to write the attachment, for get")
+
+	switch t.Args[1] {
+	case "register":
+		cmd, nargs, maxArgs = t.Register, 1, 2
+	case "list":
+		cmd, nargs, maxArgs = t.List, 0, 0
+	case "show":
+		cmd, nargs, maxArgs = t.Show, 2, 2
+	case "get":
+		cmd, nargs, maxArgs = t.Get, 3, 3
+	case "answer":
+		cmd, nargs, maxArgs = t.Answer, 3, -1
+	case "help":
+		usage(t.Stderr)
+		return nothing, nil
+	default:
+		fmt.Fprintln(t.Stderr, "ERROR:", t.Args[1], "is not a valid command")
+		usage(t.Stderr)
+		return nothing, fmt.Errorf("invalid command")
+	}
+
+	if err := flags.Parse(t.Args[2:]); err != nil {
+		return nothing, err
+	}
+	t.Args = flags.Args()
+	if (len(t.Args) < nargs) || ((maxArgs >= 0) && (len(t.Args) > maxArgs)) {
+		usage(t.Stderr)
+		return nothing, fmt.Errorf("wrong number of arguments")
+	}
+	if *serverURL == "" {
+		return nothing, fmt.Errorf("no server URL: use -url or $MOTH_URL")
+	}
+	if *teamID == "" {
+		return nothing, fmt.Errorf("no team ID: use -id or $MOTH_TEAM_ID")
+	}
+
+	c, err := client.New(*serverURL, *teamID)
+	if err != nil {
+		return nothing, err
+	}
+	t.client = c
+	return cmd, nil
+}
+
+// puzzleArgs parses the category and points arguments.
+func (t *T) puzzleArgs() (string, int, error) {
+	points, err := strconv.Atoi(t.Args[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("points: %w", err)
+	}
+	return t.Args[0], points, nil
+}
+
+// Register registers the team
+func (t *T) Register(ctx context.Context) error {
+	name := t.Args[0]
+	division := ""
+	if len(t.Args) > 1 {
+		division = t.Args[1]
+	}
+	if err := t.client.Register(ctx, name, division); errors.Is(err, client.ErrConflict) {
+		fmt.Fprintln(t.Stdout, "Already registered")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintln(t.Stdout, "Registered as", name)
+	return nil
+}
+
+// List prints the puzzles the team may open
+func (t *T) List(ctx context.Context) error {
+	state, err := t.client.State(ctx)
+	if err != nil {
+		return err
+	}
+	if state.Paused {
+		fmt.Fprintln(t.Stdout, "The event is paused.")
+	}
+
+	cats := make([]string, 0, len(state.Puzzles))
+	for cat := range state.Puzzles {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+
+	tw := tabwriter.NewWriter(t.Stdout, 0, 8, 2, ' ', 0)
+	for _, cat := range cats {
+		for _, points := range state.Puzzles[cat] {
+			if points == 0 {
+				// Every puzzle in the category is open
+				continue
+			}
+			status := ""
+			if state.IsSolved(cat, points) {
+				status = "solved"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", cat, points, status)
+		}
+	}
+	return tw.Flush()
+}
+
+// Show prints a puzzle as text
+func (t *T) Show(ctx context.Context) error {
+	cat, points, err := t.puzzleArgs()
+	if err != nil {
+		return err
+	}
+	puzzle, err := t.client.Puzzle(ctx, cat, points)
+	if err != nil {
+		return err
+	}
+	body, err := HTMLText(puzzle.Body)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(t.Stdout, "# %s %d\n\n", cat, points)
+	fmt.Fprint(t.Stdout, body)
+	if len(puzzle.Attachments) > 0 {
+		fmt.Fprintln(t.Stdout)
+		fmt.Fprintln(t.Stdout, "Attachments:")
+		for _, a := range puzzle.Attachments {
+			fmt.Fprintln(t.Stdout, "-", a)
+		}
+	}
+	if len(puzzle.Authors) > 0 {
+		fmt.Fprintln(t.Stdout)
+		fmt.Fprintln(t.Stdout, "Authors:", strings.Join(puzzle.Authors, ", "))
+	}
+	if len(puzzle.Scripts) > 0 {
+		fmt.Fprintln(t.Stdout)
+		fmt.Fprintln(t.Stdout, "This puzzle has scripts: it may need a web browser.")
+	}
+	return nil
+}
+
+// Get downloads one of a puzzle's attachments
+func (t *T) Get(ctx context.Context) error {
+	cat, points, err := t.puzzleArgs()
+	if err != nil {
+		return err
+	}
+	filename := t.Args[2]
+	r, err := t.client.Open(ctx, cat, points, filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if t.output == "-" {
+		_, err := io.Copy(t.Stdout, r)
+		return err
+	}
+	output := t.output
+	if output == "" {
+		output = path.Base(filename)
+	}
+	f, err := t.Fs.Create(output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(t.Stderr, "Wrote", output)
+	return nil
+}
+
+// Answer submits an answer.
+// Anything after the point value is the answer,
+// so answers with spaces don't need quoting.
+func (t *T) Answer(ctx context.Context) error {
+	cat, points, err := t.puzzleArgs()
+	if err != nil {
+		return err
+	}
+	answer := strings.Join(t.Args[2:], " ")
+	description, err := t.client.Answer(ctx, cat, points, answer)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(t.Stdout, description)
+	return nil
+}
+
+func main() {
+	t := &T{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Args:   os.Args,
+		Fs:     afero.NewOsFs(),
+		Getenv: os.Getenv,
+	}
+	log.SetFlags(0)
+	log.SetPrefix("moth: ")
+	cmd, err := t.ParseArgs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
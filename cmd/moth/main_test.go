@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// fakeServer answers like a MOTH server with one puzzle, "sequence 1", whose answer is "6 7".
+func fakeServer() *httptest.Server {
+	send := func(w http.ResponseWriter, statusCode int, status string, data any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]any{"status": status, "data": data})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/state", func(w http.ResponseWriter, req *http.Request) {
+		send(w, http.StatusOK, "success", map[string]any{
+			"Puzzles": map[string][]int{"sequence": {1, 2, 0}, "crypto": {10}},
+			"Solved":  map[string][]int{"sequence": {1}},
+		})
+	})
+	mux.HandleFunc("/v2/content/sequence/1/", func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v2/content/sequence/1/puzzle.json":
+			json.NewEncoder(w).Encode(map[string]any{
+				"Body":        "<p>What comes next?</p><ol><li>1 2 3</li><li>4 5</li></ol>",
+				"Attachments": []string{"hint.txt"},
+				"Authors":     []string{"neale"},
+			})
+		case "/v2/content/sequence/1/hint.txt":
+			io.WriteString(w, "count")
+		default:
+			send(w, http.StatusNotFound, "fail", map[string]string{"description": "not found"})
+		}
+	})
+	mux.HandleFunc("/v2/answer", func(w http.ResponseWriter, req *http.Request) {
+		var args struct{ Answer string }
+		json.NewDecoder(req.Body).Decode(&args)
+		if args.Answer != "6 7" {
+			send(w, http.StatusUnprocessableEntity, "fail", map[string]string{"description": "incorrect answer"})
+			return
+		}
+		send(w, http.StatusOK, "success", map[string]string{"description": "1 points awarded in sequence"})
+	})
+	return httptest.NewServer(mux)
+}
+
+func (t *T) run(args ...string) error {
+	t.Args = append([]string{"moth"}, args...)
+	cmd, err := t.ParseArgs()
+	if err != nil {
+		return err
+	}
+	return cmd(context.Background())
+}
+
+func TestCommands(t *testing.T) {
+	server := fakeServer()
+	defer server.Close()
+
+	stdout := new(bytes.Buffer)
+	tp := T{
+		Stdout: stdout,
+		Stderr: new(bytes.Buffer),
+		Fs:     afero.NewMemMapFs(),
+		Getenv: func(key string) string {
+			return map[string]string{"MOTH_URL": server.URL, "MOTH_TEAM_ID": "team1"}[key]
+		},
+	}
+
+	if err := tp.run("list"); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); out != "crypto    10  \nsequence  1   solved\nsequence  2   \n" {
+		t.Errorf("Wrong list: %q", out)
+	}
+
+	stdout.Reset()
+	if err := tp.run("show", "sequence", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "What comes next?\n\n1. 1 2 3\n2. 4 5\n") || !strings.Contains(out, "- hint.txt") {
+		t.Errorf("Wrong puzzle: %q", out)
+	}
+
+	if err := tp.run("get", "sequence", "1", "hint.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := afero.ReadFile(tp.Fs, "hint.txt"); string(buf) != "count" {
+		t.Error("Wrong attachment:", string(buf))
+	}
+	if err := tp.run("get", "sequence", "1", "nope.txt"); err == nil {
+		t.Error("Missing attachment downloaded")
+	}
+
+	stdout.Reset()
+	if err := tp.run("answer", "sequence", "1", "6", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if out := stdout.String(); out != "1 points awarded in sequence\n" {
+		t.Errorf("Wrong answer output: %q", out)
+	}
+	if err := tp.run("answer", "sequence", "1", "8"); (err == nil) || (err.Error() != "incorrect answer") {
+		t.Error("Wrong answer accepted:", err)
+	}
+
+	if err := tp.run("answer", "-id", "", "sequence", "1", "6"); err == nil {
+		t.Error("Ran without a team ID")
+	}
+	if err := tp.run("show", "sequence"); err == nil {
+		t.Error("Ran with too few arguments")
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	for _, tc := range []struct {
+		html string
+		text string
+	}{
+		{"<p>One   two\nthree</p><p>Four</p>", "One two three\n\nFour\n"},
+		{"<h2>Hint</h2><ul><li>a</li><li>b<ul><li>c</li></ul></li></ul>", "## Hint\n\n- a\n- b\n  - c\n"},
+		{`<p>See <a href="https://example.com/">the site</a>, or <a href="#top">the top</a>.</p>`, "See the site <https://example.com/>, or the top.\n"},
+		{"<pre>  x = 1\n  y = 2</pre>", "  x = 1\n  y = 2\n"},
+		{`<p><img src="a.png" alt="A moth"> Line<br>break</p><script>alert(1)</script>`, "[image: A moth] Line\nbreak\n"},
+		{"<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>", "a | b\n1 | 2\n"},
+	} {
+		text, err := HTMLText(tc.html)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text != tc.text {
+			t.Errorf("HTMLText(%q) = %q, want %q", tc.html, text, tc.text)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// whitespace matches runs of whitespace, which HTML shows as one space
+var whitespace = regexp.MustCompile(`\s+`)
+
+// textRenderer turns HTML into plain text, for reading in a terminal or with a screen reader.
+type textRenderer struct {
+	out []byte
+
+	// newlines is how many line breaks to put before the next text
+	newlines int
+
+	// pre is how many <pre> elements we're in
+	pre int
+
+	// items counts the items of each list we're in, or is -1 for unordered lists
+	items []int
+}
+
+// HTMLText renders an HTML fragment, like a puzzle body, as plain text.
+//
+// Headings start with "#", list items with "-" or their number,
+// and links are followed by where they go.
+func HTMLText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	r := new(textRenderer)
+	r.render(doc)
+	return strings.TrimRight(strings.TrimLeft(string(r.out), "\n"), " \n") + "\n", nil
+}
+
+// block asks for at least n line breaks before the next text.
+func (r *textRenderer) block(n int) {
+	r.newlines = max(r.newlines, n)
+}
+
+// write adds text.
+// Outside of <pre>, whitespace is collapsed, as a browser would.
+func (r *textRenderer) write(s string) {
+	if r.pre == 0 {
+		s = whitespace.ReplaceAllString(s, " ")
+		if (len(r.out) == 0) || (r.newlines > 0) || strings.ContainsAny(string(r.out[len(r.out)-1:]), " \n") {
+			s = strings.TrimLeft(s, " ")
+		}
+	}
+	r.emit(s)
+}
+
+// emit adds s as it is, after any line breaks asked for.
+func (r *textRenderer) emit(s string) {
+	if s == "" {
+		return
+	}
+	if (len(r.out) > 0) && (r.newlines > 0) {
+		for (len(r.out) > 0) && (r.out[len(r.out)-1] == ' ') {
+			r.out = r.out[:len(r.out)-1]
+		}
+		for i := 0; i < r.newlines; i++ {
+			r.out = append(r.out, '\n')
+		}
+	}
+	r.newlines = 0
+	r.out = append(r.out, s...)
+}
+
+// textContent returns all the text inside n.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	buf := new(strings.Builder)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		buf.WriteString(textContent(c))
+	}
+	return buf.String()
+}
+
+// attr returns the value of one of n's attributes.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// render adds n, and everything in it.
+func (r *textRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.write(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.renderChildren(n)
+		return
+	}
+
+	space := 0
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Template:
+		return
+	case atom.Br:
+		r.newlines++
+		return
+	case atom.Hr:
+		r.block(2)
+		r.write("----")
+		r.block(2)
+		return
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			r.write("[image: " + alt + "] ")
+		} else {
+			r.write("[image] ")
+		}
+		return
+	case atom.P, atom.Div, atom.Aside, atom.Blockquote, atom.Section, atom.Figure,
+		atom.Table, atom.Ul, atom.Ol, atom.Dl, atom.Pre,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		space = 2
+	case atom.Li, atom.Tr, atom.Dt, atom.Dd, atom.Figcaption:
+		space = 1
+	}
+	if ((n.DataAtom == atom.Ul) || (n.DataAtom == atom.Ol)) && (len(r.items) > 0) {
+		// Lists in lists don't need a blank line around them
+		space = 1
+	}
+	r.block(space)
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		r.emit(strings.Repeat("#", level) + " ")
+	case atom.Ul:
+		r.items = append(r.items, -1)
+		defer func() { r.items = r.items[:len(r.items)-1] }()
+	case atom.Ol:
+		r.items = append(r.items, 0)
+		defer func() { r.items = r.items[:len(r.items)-1] }()
+	case atom.Li:
+		indent := strings.Repeat("  ", max(len(r.items)-1, 0))
+		if (len(r.items) > 0) && (r.items[len(r.items)-1] >= 0) {
+			r.items[len(r.items)-1]++
+			r.emit(indent + strconv.Itoa(r.items[len(r.items)-1]) + ". ")
+		} else {
+			r.emit(indent + "- ")
+		}
+	case atom.Td, atom.Th:
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode {
+				r.write(" | ")
+				break
+			}
+		}
+	case atom.Pre:
+		r.pre++
+		defer func() { r.pre-- }()
+	}
+
+	r.renderChildren(n)
+
+	if n.DataAtom == atom.A {
+		href := attr(n, "href")
+		if (href != "") && !strings.HasPrefix(href, "#") && (strings.TrimSpace(textContent(n)) != href) {
+			r.write(" <" + href + ">")
+		}
+	}
+	r.block(space)
+}
+
+// renderChildren adds everything in n.
+func (r *textRenderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
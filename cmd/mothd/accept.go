@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// ExtraAnswersFile lists answers accepted on top of the ones in mothballs,
+// one "category points answer" per line.
+const ExtraAnswersFile = "extra-answers.txt"
+
+// ExtraAnswers returns the answers accepted for a puzzle,
+// on top of the ones in its mothball.
+func (s *State) ExtraAnswers(cat string, points int) []string {
+	ret := make([]string, 0)
+	f, err := s.Open(ExtraAnswersFile)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if (len(fields) != 3) || (fields[0] != cat) {
+			continue
+		}
+		if p, err := strconv.Atoi(fields[1]); (err == nil) && (p == points) {
+			ret = append(ret, fields[2])
+		}
+	}
+	return ret
+}
+
+// AcceptAnswer adds answer to the answers accepted for a puzzle.
+func (s *State) AcceptAnswer(cat string, points int, answer string) error {
+	if (cat == "") || strings.ContainsAny(cat, " \t\n") {
+		return fmt.Errorf("invalid category: %q", cat)
+	}
+	if (answer == "") || strings.ContainsAny(answer, "\r\n") {
+		return fmt.Errorf("invalid answer: %q", answer)
+	}
+
+	s.lock.Lock()
+	err := s.appendExtraAnswer(cat, points, answer)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	s.LogEvent("accept", "", cat, points)
+	return nil
+}
+
+// appendExtraAnswer adds a line to ExtraAnswersFile, unless it's already there.
+// The caller must hold s.lock.
+func (s *State) appendExtraAnswer(cat string, points int, answer string) error {
+	for _, a := range s.ExtraAnswers(cat, points) {
+		if a == answer {
+			return nil
+		}
+	}
+	f, err := s.OpenFile(ExtraAnswersFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%s %d %s\n", cat, points, answer)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// extraAnswer returns true if answer was accepted for a puzzle by an administrator.
+// These must match exactly, whatever checker the puzzle uses.
+func (mh *MothRequestHandler) extraAnswer(cat string, points int, answer string) bool {
+	for _, a := range mh.State.ExtraAnswers(cat, points) {
+		if a == answer {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminAcceptHandler adds an answer accepted for a puzzle.
+func (h *HTTPServer) AdminAcceptHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not accepted", "cat and points are required")
+		return
+	}
+	answer := req.FormValue("answer")
+	if err := mh.State.AcceptAnswer(cat, points, answer); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not accepted", "%s", err.Error())
+		return
+	}
+	mh.log.Info("accepted answer", "category", cat, "points", points)
+	jsend.Sendf(w, jsend.Success, "accepted", "answer accepted for %s %d", cat, points)
+}
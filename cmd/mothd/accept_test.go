@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAcceptAnswer(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/admin/accept", strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if err := handler.CheckAnswer("pategory", 1, "answer 123"); err != ErrIncorrectAnswer {
+		t.Fatal("Unexpected answer accepted:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if r := post(url.Values{"cat": {"pategory"}, "points": {"1"}, "answer": {"answer 123"}}); r.Code != http.StatusOK {
+			t.Fatal(r.Code, r.Body.String())
+		}
+	}
+	if a := state.ExtraAnswers("pategory", 1); (len(a) != 1) || (a[0] != "answer 123") {
+		t.Error("Wrong extra answers:", a)
+	}
+	if a := state.ExtraAnswers("pategory", 2); len(a) != 0 {
+		t.Error("Extra answers for the wrong puzzle:", a)
+	}
+
+	if err := handler.CheckAnswer("pategory", 2, "answer 123"); err != ErrIncorrectAnswer {
+		t.Error("Answer accepted for the wrong puzzle:", err)
+	}
+	if err := handler.CheckAnswer("pategory", 1, "answer 123"); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+	if pl := state.PointsLog(); len(pl) != 1 {
+		t.Error("No award for accepted answer:", pl)
+	}
+
+	if r := post(url.Values{"cat": {"pategory"}, "points": {"1"}, "answer": {"two\nlines"}}); r.Code != http.StatusBadRequest {
+		t.Error("Answer with a newline accepted:", r.Code)
+	}
+}
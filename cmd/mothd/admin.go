@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// adminUsage describes the administrative commands.
+const adminUsage = `administrative commands:
+  backup FILE
+        Write a snapshot of the state directory to FILE (- for standard output)
+  restore FILE
+        Replace the state directory with a snapshot made by backup
+  compact
+        Rewrite the points log in time order, without duplicates, keeping the old one
+  merge FROM INTO
+        Move team FROM's points to team INTO, and unregister FROM
+  split TEAM NEWTEAM NAME [CATEGORY...]
+        Register NEWTEAM as NAME, and move TEAM's points in each CATEGORY to it
+  loadtest [FLAGS] URL
+        Simulate teams playing on the server at URL, and report how long it took (see loadtest -h)`
+
+// MaxReplayFrames is the most scoreboards /admin/standings will return for a replay.
+const MaxReplayFrames = 1000
+
+// RunAdminCommand performs a one-off administrative command on a state directory.
+//
+// Apart from backup, these commands rewrite the points log,
+// so scoring must be suspended while they run.
+func RunAdminCommand(s *State, args []string) error {
+	if (len(args) == 2) && (args[0] == "backup") {
+		return backupTo(s, args[1])
+	}
+
+	s.updateEnabled()
+	if s.enabled {
+		return fmt.Errorf("scoring is enabled: suspend it in hours.txt first")
+	}
+	s.updateCaches()
+
+	var err error
+	switch {
+	case (len(args) == 3) && (args[0] == "merge"):
+		err = s.MergeTeams(args[1], args[2])
+	case (len(args) >= 4) && (args[0] == "split"):
+		err = s.SplitTeam(args[1], args[2], args[3], args[4:])
+	case (len(args) == 2) && (args[0] == "restore"):
+		err = restoreFrom(s, args[1])
+	case (len(args) == 1) && (args[0] == "compact"):
+		err = s.CompactPointsLog(time.Now())
+	default:
+		return fmt.Errorf("unknown command: %s\n%s", strings.Join(args, " "), adminUsage)
+	}
+
+	// Nothing else is going to write out events
+	for len(s.eventStream) > 0 {
+		s.eventWriter.Write(<-s.eventStream)
+	}
+	s.eventWriter.Flush()
+	return err
+}
+
+// backupTo writes a backup of s to filename,
+// or to standard output if filename is "-".
+func backupTo(s *State, filename string) error {
+	if filename == "-" {
+		return s.Backup(os.Stdout)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = s.Backup(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+	}
+	return err
+}
+
+// restoreFrom restores s from the backup in filename,
+// or from standard input if filename is "-".
+func restoreFrom(s *State, filename string) error {
+	if filename == "-" {
+		return s.Restore(os.Stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
+
+// HandleAdminFunc binds a new handler function for an administrative endpoint.
+//
+// Administrative endpoints only exist if an admin token is configured,
+// and requests must present it as a bearer token.
+// The handler is not associated with any team.
+func (h *HTTPServer) HandleAdminFunc(
+	pattern string,
+	adminHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		token := h.server.config().AdminToken
+		if token == "" {
+			http.NotFound(w, req)
+			return
+		}
+		given, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || (subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mothd admin"`)
+			jsend.SendfStatus(w, http.StatusUnauthorized, jsend.Fail, "unauthorized", "admin token required")
+			return
+		}
+		mh := h.server.NewHandler("").WithContext(req.Context())
+		mh.log = mh.log.With("request", RequestID(req.Context()), "remote", h.clientIP(req).String(), "admin", true)
+		adminHandler(mh, w, req)
+	}
+	h.HandleFunc(h.base+"/admin"+pattern, handler)
+}
+
+// AdminPauseHandler pauses the event, so no answers are accepted.
+func (h *HTTPServer) AdminPauseHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	if err := mh.State.Pause(); err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not paused", "%s", err.Error())
+		return
+	}
+	mh.log.Info("paused event")
+	jsend.Sendf(w, jsend.Success, "paused", "event paused")
+}
+
+// AdminResumeHandler resumes a paused event, pushing the schedule back by however long it was paused.
+func (h *HTTPServer) AdminResumeHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	if err := mh.State.Resume(); err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not resumed", "%s", err.Error())
+		return
+	}
+	mh.log.Info("resumed event")
+	jsend.Sendf(w, jsend.Success, "resumed", "event resumed")
+}
+
+// AdminBackupHandler sends a backup of the state directory.
+func (h *HTTPServer) AdminBackupHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	filename := BackupPrefix + time.Now().UTC().Format(rotatedTimeFormat) + BackupSuffix
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := mh.State.Backup(w); err != nil {
+		// Too late to send an error: the client will get a truncated archive
+		mh.log.Error("sending backup", "error", err)
+		return
+	}
+	mh.log.Info("sent backup")
+}
+
+// requirePOST refuses requests that aren't POST, returning false if it did.
+func requirePOST(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		jsend.SendfStatus(w, http.StatusMethodNotAllowed, jsend.Fail, "method not allowed", "use POST for this endpoint")
+		return false
+	}
+	return true
+}
+
+// AdminStandingsHandler returns the scoreboard as it was at a given time.
+//
+// With an "every" parameter, it returns a list of scoreboards at that interval,
+// from the first award to the last, for replaying the event.
+func (h *HTTPServer) AdminStandingsHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	export := mh.ExportPublicState().ForDivision(req.FormValue("division"))
+
+	if every := req.FormValue("every"); every != "" {
+		interval, err := time.ParseDuration(every)
+		if (err != nil) || (interval <= 0) {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "every: invalid duration %q", every)
+			return
+		}
+		frames := replayTimes(export, interval)
+		if len(frames) > MaxReplayFrames {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "more than %d scoreboards: use a longer interval", MaxReplayFrames)
+			return
+		}
+		scoreboards := make([]*Scoreboard, 0, len(frames))
+		for _, when := range frames {
+			scoreboards = append(scoreboards, scoreboardAt(export, when))
+		}
+		jsend.Send(w, jsend.Success, scoreboards)
+		return
+	}
+
+	when := time.Now()
+	if at := req.FormValue("at"); strings.HasPrefix(at, "+") {
+		// Relative to the first award
+		offset, err := time.ParseDuration(at[1:])
+		if err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "at: %s", err.Error())
+			return
+		}
+		if first, _, ok := awardSpan(export); ok {
+			when = first.Add(offset)
+		}
+	} else if at != "" {
+		t, err := parseAdminTime(at)
+		if err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "at: %s", err.Error())
+			return
+		}
+		when = t
+	}
+	jsend.Send(w, jsend.Success, scoreboardAt(export, when))
+}
+
+// AdminSolveTimesHandler returns how long teams took to solve each puzzle,
+// from when they first loaded it.
+func (h *HTTPServer) AdminSolveTimesHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	jsend.Send(w, jsend.Success, solveTimes(mh.State))
+}
+
+// AdminSharingHandler returns a report on signs that teams are sharing answers.
+//
+// A "window" parameter sets how close together two solves of a puzzle must be to be listed.
+func (h *HTTPServer) AdminSharingHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	window := DefaultCloseSolveWindow
+	if s := req.FormValue("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if (err != nil) || (d < 0) {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "window: invalid duration %q", s)
+			return
+		}
+		window = d
+	}
+	jsend.Send(w, jsend.Success, NewSharingReport(mh.State, mh.Sharing, window))
+}
+
+// scoreboardAt returns the scoreboard as it was at time when.
+func scoreboardAt(export *StateExport, when time.Time) *Scoreboard {
+	sb := NewScoreboard(export.At(when))
+	sb.Generated = when
+	return sb
+}
+
+// replayTimes returns times from the first award in export to the last, every interval.
+// The time of the last award is always included.
+func replayTimes(export *StateExport, interval time.Duration) []time.Time {
+	first, last, ok := awardSpan(export)
+	if !ok {
+		return nil
+	}
+	times := make([]time.Time, 0)
+	for when := first; when.Before(last); when = when.Add(interval) {
+		times = append(times, when)
+		if len(times) > MaxReplayFrames {
+			break
+		}
+	}
+	return append(times, last)
+}
+
+// awardSpan returns the times of the first and last awards in export.
+// ok is false if there are no awards.
+func awardSpan(export *StateExport) (first, last time.Time, ok bool) {
+	if len(export.PointsLog) == 0 {
+		return first, last, false
+	}
+	firstWhen := export.PointsLog[0].When
+	lastWhen := firstWhen
+	for _, awd := range export.PointsLog {
+		if awd.When < firstWhen {
+			firstWhen = awd.When
+		}
+		if awd.When > lastWhen {
+			lastWhen = awd.When
+		}
+	}
+	return time.Unix(firstWhen, 0), time.Unix(lastWhen, 0), true
+}
+
+// parseAdminTime parses a time given to an administrative endpoint:
+// either RFC 3339, or seconds since the Unix epoch.
+func parseAdminTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(RFC3339Space, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("not an RFC 3339 time or Unix timestamp: %q", s)
+}
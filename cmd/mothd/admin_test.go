@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TestAdminRequest performs an administrative GET request, with token if it isn't empty.
+func (hs *HTTPServer) TestAdminRequest(path, token string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	hs.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminAuth(t *testing.T) {
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+	if r := hs.TestAdminRequest("/admin/standings", ""); r.Code != http.StatusNotFound {
+		t.Error("Admin endpoint exists without a token:", r.Code)
+	}
+
+	server.Config.AdminToken = "sekrit"
+	if r := hs.TestAdminRequest("/admin/standings", ""); r.Code != http.StatusUnauthorized {
+		t.Error("Admin endpoint allowed without a token:", r.Code)
+	}
+	if r := hs.TestAdminRequest("/admin/standings", "guess"); r.Code != http.StatusUnauthorized {
+		t.Error("Admin endpoint allowed with the wrong token:", r.Code)
+	}
+	if r := hs.TestAdminRequest("/admin/standings", "sekrit"); r.Code != http.StatusOK {
+		t.Error("Admin endpoint refused the right token:", r.Code)
+	}
+}
+
+func TestAdminStandings(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	state := server.State.(*State)
+	state.SetTeamName(TestTeamID, "GoTeam")
+	server.refresh()
+	state.awardPointsAtTime(1000, TestTeamID, "pategory", 1)
+	state.awardPointsAtTime(1000+3600, TestTeamID, "pategory", 2)
+	state.awardPointsAtTime(1000+7200, TestTeamID, "pategory", 3)
+	server.refresh()
+
+	standings := func(query string) []Scoreboard {
+		r := hs.TestAdminRequest("/admin/standings?"+query, "sekrit")
+		if r.Code != http.StatusOK {
+			t.Error(query, "failed:", r.Body.String())
+			return nil
+		}
+		var resp struct{ Data json.RawMessage }
+		json.Unmarshal(r.Body.Bytes(), &resp)
+		var sbs []Scoreboard
+		if resp.Data[0] == '[' {
+			json.Unmarshal(resp.Data, &sbs)
+		} else {
+			var sb Scoreboard
+			json.Unmarshal(resp.Data, &sb)
+			sbs = append(sbs, sb)
+		}
+		return sbs
+	}
+
+	for query, points := range map[string]int{
+		"":                        6,
+		"at=999":                  0,
+		"at=1000":                 1,
+		"at=%2B90m":               3,
+		"at=1970-01-01T02:00:00Z": 3,
+		"at=1970-01-01T03:00:00Z": 6,
+		"at=1970-01-01+00:30:00Z": 1,
+	} {
+		sbs := standings(query)
+		total := 0
+		for _, sb := range sbs {
+			for _, team := range sb.Teams {
+				total += team.Points["pategory"]
+			}
+		}
+		if total != points {
+			t.Errorf("%q: got %d points, wanted %d", query, total, points)
+		}
+	}
+
+	if sbs := standings("every=1h"); len(sbs) != 3 {
+		t.Error("Wrong number of replay scoreboards:", len(sbs))
+	}
+	if r := hs.TestAdminRequest("/admin/standings?every=1s&division=x", "sekrit"); r.Code != http.StatusOK {
+		t.Error("Replay of empty division failed:", r.Code)
+	}
+	for _, query := range []string{"at=yesterday", "every=0s", "every=1s"} {
+		if r := hs.TestAdminRequest("/admin/standings?"+query, "sekrit"); r.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status %d", query, r.Code)
+		}
+	}
+}
+
+func TestAdminPause(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+	hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	server.refresh()
+
+	if r := hs.TestAdminRequest("/admin/pause", "sekrit"); r.Code != http.StatusMethodNotAllowed {
+		t.Error("Paused with GET:", r.Code)
+	}
+	post := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		request.Header.Set("Authorization", "Bearer sekrit")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	if r := post("/admin/pause"); r.Code != http.StatusOK {
+		t.Fatal("Pause failed:", r.Body.String())
+	}
+
+	answer := map[string]interface{}{"id": TestTeamID, "cat": "pategory", "points": 1, "answer": "answer123"}
+	if r := hs.TestAPIv2Request(http.MethodPost, "/v2/answer", answer); r.Code != http.StatusServiceUnavailable {
+		t.Error("Answer accepted while paused:", r.Code, r.Body.String())
+	}
+	handler := server.NewHandler(TestTeamID)
+	if !handler.ExportState().Paused {
+		t.Error("Exported state isn't paused")
+	}
+
+	if r := post("/admin/resume"); r.Code != http.StatusOK {
+		t.Fatal("Resume failed:", r.Body.String())
+	}
+	if r := hs.TestAPIv2Request(http.MethodPost, "/v2/answer", answer); r.Code != http.StatusOK {
+		t.Error("Answer refused after resume:", r.Code, r.Body.String())
+	}
+}
+
+func TestAdminBackup(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	hs := NewHTTPServer("/", server.MothServer)
+
+	r := hs.TestAdminRequest("/admin/backup", "sekrit")
+	if r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if ct := r.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Error("Wrong content type:", ct)
+	}
+	files, _, err := readBackup(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["points.log"]; !ok {
+		t.Error("No points log in backup")
+	}
+}
+
+func TestAdminSolveTimes(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	state := server.State.(*State)
+	state.SetTeamName(TestTeamID, "GoTeam")
+	state.SetTeamName("otherteam", "OtherTeam")
+	state.Mkdir("opened", 0755)
+	afero.WriteFile(state, "opened/"+TestTeamID, []byte("1000 1 pategory\n1000 2 pategory\n"), 0644)
+	afero.WriteFile(state, "opened/otherteam", []byte("1100 1 pategory\n"), 0644)
+	state.awardPointsAtTime(1060, TestTeamID, "pategory", 1)
+	state.awardPointsAtTime(1400, "otherteam", "pategory", 1)
+	state.awardPointsAtTime(1500, "otherteam", "pategory", 3)
+	server.refresh()
+
+	r := hs.TestAdminRequest("/admin/solvetimes", "sekrit")
+	if r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	var resp struct{ Data []PuzzleSolveTimes }
+	if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatal("Wrong number of puzzles:", resp.Data)
+	}
+
+	p1 := resp.Data[0]
+	if (p1.Points != 1) || (p1.Opened != 2) || (p1.Solved != 2) {
+		t.Error("Wrong counts:", p1)
+	}
+	if (len(p1.Teams) != 2) || (p1.Teams[0].TeamName != "GoTeam") || (p1.Teams[0].Seconds != 60) {
+		t.Error("Wrong teams:", p1.Teams)
+	}
+	if (p1.Fastest != 60) || (p1.Median != 180) || (p1.Mean != 180) {
+		t.Error("Wrong statistics:", p1)
+	}
+
+	if p2 := resp.Data[1]; (p2.Points != 2) || (p2.Opened != 1) || (p2.Solved != 0) || (len(p2.Teams) != 0) {
+		t.Error("Unsolved puzzle is wrong:", p2)
+	}
+
+	// Solved without being loaded: counted, but there's no time for it
+	if p3 := resp.Data[2]; (p3.Points != 3) || (p3.Opened != 0) || (p3.Solved != 1) || (len(p3.Teams) != 0) {
+		t.Error("Puzzle solved without loading is wrong:", p3)
+	}
+}
+
+func TestAdminSharing(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	server.Sharing = NewSharingDetector()
+	server.Listeners = append(server.Listeners, server.Sharing)
+	state := server.State.(*State)
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\nteam2\nteam3\n"), 0644)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	state.SetTeamName(TestTeamID, "GoTeam")
+	state.SetTeamName("team2", "Team Two")
+	state.SetTeamName("team3", "Team Three")
+	state.awardPointsAtTime(1000, TestTeamID, "pategory", 1)
+	state.awardPointsAtTime(1004, "team2", "pategory", 1)
+	state.awardPointsAtTime(1100, "team3", "pategory", 1)
+	server.refresh()
+
+	// httptest requests all come from the same address
+	for _, teamID := range []string{TestTeamID, "team2"} {
+		answer := map[string]interface{}{"id": teamID, "cat": "pategory", "points": 2, "answer": "same wrong answer"}
+		if r := hs.TestAPIv2Request(http.MethodPost, "/v2/answer", answer); r.Code != http.StatusUnprocessableEntity {
+			t.Fatal(r.Code, r.Body.String())
+		}
+	}
+
+	report := func(query string) SharingReport {
+		r := hs.TestAdminRequest("/admin/sharing?"+query, "sekrit")
+		if r.Code != http.StatusOK {
+			t.Fatal(query, r.Code, r.Body.String())
+		}
+		var resp struct{ Data SharingReport }
+		if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	sr := report("")
+	if (len(sr.SharedWrongAnswers) != 1) || (sr.SharedWrongAnswers[0].Answer != "same wrong answer") || (len(sr.SharedWrongAnswers[0].Teams) != 2) {
+		t.Error("Wrong shared wrong answers:", sr.SharedWrongAnswers)
+	}
+	if (len(sr.SharedAddresses) != 1) || (sr.SharedAddresses[0].Teams[0] != "GoTeam") || (sr.SharedAddresses[0].Teams[1] != "Team Two") {
+		t.Error("Wrong shared addresses:", sr.SharedAddresses)
+	}
+	if (len(sr.CloseSolves) != 1) || (sr.CloseSolves[0].Teams != [2]string{"GoTeam", "Team Two"}) || (sr.CloseSolves[0].Seconds != 4) {
+		t.Error("Wrong close solves:", sr.CloseSolves)
+	}
+
+	if sr := report("window=5m"); len(sr.CloseSolves) != 3 {
+		t.Error("Wrong close solves with a longer window:", sr.CloseSolves)
+	}
+	if r := hs.TestAdminRequest("/admin/sharing?window=soon", "sekrit"); r.Code != http.StatusBadRequest {
+		t.Error("Bad window accepted:", r.Code)
+	}
+}
+
+func TestAdminConfig(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	server.Config.WrongAnswers = 5
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/admin/config", strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	type configResponse struct {
+		Data struct {
+			Settings map[string]string
+			Changes  []SettingChange
+		}
+	}
+	decode := func(r *httptest.ResponseRecorder) configResponse {
+		resp := configResponse{}
+		if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err, r.Body.String())
+		}
+		return resp
+	}
+
+	if r := hs.TestAdminRequest("/admin/config", "sekrit"); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	} else if settings := decode(r).Data.Settings; (settings["wrong-answers"] != "5") || (settings["paused"] != "false") {
+		t.Error("Wrong settings:", settings)
+	}
+
+	schedule := "# Set through the API\n-\n+ 1970-01-01T00:00:00Z\n"
+	r := post(url.Values{
+		"wrong-answers":   {"3"},
+		"answer-cooldown": {"5m"},
+		"schedule":        {schedule},
+	})
+	if r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	resp := decode(r)
+	if len(resp.Data.Changes) != 3 {
+		t.Error("Wrong changes:", resp.Data.Changes)
+	} else if c := resp.Data.Changes[2]; (c.Setting != "wrong-answers") || (c.Old != "5") || (c.New != "3") || (c.Remote == "") {
+		t.Error("Wrong change recorded:", c)
+	}
+	if handler := server.NewHandler(TestTeamID); (handler.Config.WrongAnswers != 3) || (handler.Config.AnswerCooldown != 5*time.Minute) {
+		t.Error("New handlers don't see the change:", handler.Config)
+	}
+	if s, _ := server.State.Schedule(); s != schedule {
+		t.Error("Schedule not written:", s)
+	}
+
+	// Nothing changes unless everything makes sense
+	for _, form := range []url.Values{
+		{"wrong-answers": {"-1"}},
+		{"wrong-answers": {"1"}, "answer-cooldown": {"soon"}},
+		{"wrong-answers": {"1"}, "admin-token": {"new"}},
+		{"wrong-answers": {"1"}, "schedule": {"tomorrow"}},
+	} {
+		if r := post(form); r.Code != http.StatusBadRequest {
+			t.Error("Accepted", form, r.Code)
+		}
+	}
+	if server.NewHandler("").Config.WrongAnswers != 3 {
+		t.Error("Setting changed by a refused request")
+	}
+
+	if r := post(url.Values{"paused": {"true"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if !server.State.Paused() {
+		t.Error("Not paused")
+	}
+	if changes := decode(hs.TestAdminRequest("/admin/config", "sekrit")).Data.Changes; len(changes) != 4 {
+		t.Error("Wrong change history:", changes)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// IdempotencyKeyHeader is the HTTP header a client can use to identify an answer submission,
+// so that retrying it doesn't submit it twice.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// MaxIdempotencyKeys is how many idempotency keys are remembered.
+// When there are more, the oldest are forgotten.
+const MaxIdempotencyKeys = 10000
+
+// answerQueue makes each team's answer submissions wait in line,
+// so each one sees the awards made by those before it.
+// It also remembers the outcome of submissions with an idempotency key.
+type answerQueue struct {
+	lock    sync.Mutex
+	teams   map[string]*teamQueue
+	results map[string]answerResult
+	keys    []string // Oldest first
+}
+
+// teamQueue is one team's place in an answerQueue.
+// It's forgotten once nobody's waiting in it.
+type teamQueue struct {
+	sync.Mutex
+	waiting int // Protected by the answerQueue's lock
+}
+
+// answerResult is the outcome of an answer submission.
+type answerResult struct {
+	part string
+	err  error
+}
+
+func newAnswerQueue() *answerQueue {
+	return &answerQueue{
+		teams:   make(map[string]*teamQueue),
+		results: make(map[string]answerResult),
+	}
+}
+
+// do runs submit once the team's earlier submissions are done.
+//
+// If key isn't empty, and the team submitted something with the same key before,
+// submit isn't run, and the earlier outcome is returned instead.
+func (q *answerQueue) do(teamID, key string, submit func() (string, error)) (string, error) {
+	q.lock.Lock()
+	team, ok := q.teams[teamID]
+	if !ok {
+		team = new(teamQueue)
+		q.teams[teamID] = team
+	}
+	team.waiting++
+	q.lock.Unlock()
+
+	team.Lock()
+	defer func() {
+		q.lock.Lock()
+		team.waiting--
+		if team.waiting == 0 {
+			delete(q.teams, teamID)
+		}
+		q.lock.Unlock()
+		team.Unlock()
+	}()
+
+	if key == "" {
+		return submit()
+	}
+
+	key = teamID + "\x00" + key
+	q.lock.Lock()
+	result, ok := q.results[key]
+	q.lock.Unlock()
+	if ok {
+		return result.part, result.err
+	}
+
+	part, err := submit()
+	if !final(err) {
+		// Let them try again
+		return part, err
+	}
+
+	q.lock.Lock()
+	q.results[key] = answerResult{part, err}
+	q.keys = append(q.keys, key)
+	for len(q.keys) > MaxIdempotencyKeys {
+		delete(q.results, q.keys[0])
+		q.keys = q.keys[1:]
+	}
+	q.lock.Unlock()
+	return part, err
+}
+
+// final returns true if a submission that returned err
+// would have the same outcome if it were submitted again.
+func final(err error) bool {
+	return (err == nil) || errors.Is(err, ErrIncorrectAnswer) || errors.Is(err, ErrAlreadyAwarded) || errors.Is(err, ErrPracticeAnswer)
+}
+
+// idempotencyKey returns the idempotency key sent with req,
+// from either the Idempotency-Key header or the "key" parameter.
+func idempotencyKey(req *http.Request) string {
+	if key := req.Header.Get(IdempotencyKeyHeader); key != "" {
+		return key
+	}
+	return req.FormValue("key")
+}
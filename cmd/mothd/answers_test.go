@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestIdempotentAnswers(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	if _, err := handler.SubmitAnswerOnce("k1", "pategory", 1, "wrong"); err != ErrIncorrectAnswer {
+		t.Error("Wrong answer accepted:", err)
+	}
+	if _, err := handler.SubmitAnswerOnce("k1", "pategory", 1, "wrong"); err != ErrIncorrectAnswer {
+		t.Error("Retry wasn't given the earlier outcome:", err)
+	}
+	if _, err := handler.SubmitAnswerOnce("k2", "pategory", 1, "answer123"); err != nil {
+		t.Error(err)
+	}
+	if _, err := handler.SubmitAnswerOnce("k2", "pategory", 1, "answer123"); err != nil {
+		t.Error("Retry of a correct answer:", err)
+	}
+	if _, err := handler.SubmitAnswerOnce("k3", "pategory", 1, "answer123"); err != ErrAlreadyAwarded {
+		t.Error("New submission of a solved puzzle:", err)
+	}
+	if _, err := handler.SubmitAnswerOnce("k3", "pategory", 1, "wrong"); err != ErrIncorrectAnswer {
+		t.Error("Reused key got another submission's outcome:", err)
+	}
+	server.refresh()
+	if pl := server.State.PointsLog(); len(pl) != 1 {
+		t.Error("Wrong points log:", pl)
+	}
+
+	hs := NewHTTPServer("/", server.MothServer)
+	body := map[string]interface{}{"id": TestTeamID, "cat": "pategory", "points": 2, "answer": "wat", "key": "k4"}
+	for i := 0; i < 2; i++ {
+		if r := hs.TestAPIv2Request(http.MethodPost, "/v2/answer", body); r.Code != http.StatusOK {
+			t.Error("Retry", i, "failed:", r.Code, r.Body.String())
+		}
+	}
+}
+
+func TestAnswerQueueForgets(t *testing.T) {
+	q := newAnswerQueue()
+	calls := 0
+	submit := func() (string, error) {
+		calls++
+		return "", nil
+	}
+	for i := 0; i <= MaxIdempotencyKeys; i++ {
+		q.do("team", string(rune(i)), submit)
+	}
+	q.do("team", string(rune(0)), submit)
+	if calls != MaxIdempotencyKeys+2 {
+		t.Error("Oldest key wasn't forgotten:", calls)
+	}
+	if len(q.results) != MaxIdempotencyKeys {
+		t.Error("Too many keys remembered:", len(q.results))
+	}
+
+	q.do("team", "paused", func() (string, error) { return "", ErrPaused })
+	if _, ok := q.results["team\x00paused"]; ok {
+		t.Error("Remembered an outcome that could change")
+	}
+	if len(q.teams) != 0 {
+		t.Error("Teams nobody's waiting for still queued:", len(q.teams))
+	}
+}
+
+func TestConcurrentAnswers(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"partegory",
+		[]testFileContents{
+			{"2/puzzle.json", `{"Parts": [{"Name": "x"}, {"Name": "y"}]}`},
+			{"parts.txt", "2 x xray\n2 y yankee\n"},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	// Nothing gets collected into the points log until the next refresh
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := handler.SubmitAnswer("pategory", 1, "answer123"); err == nil {
+				lock.Lock()
+				accepted++
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, answer := range []string{"xray", "yankee"} {
+		wg.Add(1)
+		go func(answer string) {
+			defer wg.Done()
+			handler.SubmitAnswer("partegory", 2, answer)
+		}(answer)
+	}
+	wg.Wait()
+	server.refresh()
+
+	if accepted != 1 {
+		t.Error("Correct answer accepted", accepted, "times")
+	}
+	total := 0
+	for _, awd := range server.State.PointsLog() {
+		total += awd.Score
+	}
+	if total != 3 {
+		t.Error("Wrong score:", server.State.PointsLog())
+	}
+	if pending := server.State.PendingAwards(); len(pending) != 0 {
+		t.Error("Awards still pending after refresh:", pending)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// APIv2Prefix is the path prefix for all v2 API endpoints.
+const APIv2Prefix = "/v2"
+
+// APIv2Request holds the parameters of a v2 API request.
+//
+// Clients may send this as a JSON object (Content-Type: application/json),
+// or as form-encoded parameters with the same names.
+type APIv2Request struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Cat    string `json:"cat"`
+	Points int    `json:"points"`
+	Answer string `json:"answer"`
+
+	// Division is the division to register in, or to show standings for
+	Division string `json:"division"`
+
+	// Email is where to send the team ID, when registering
+	Email string `json:"email"`
+
+	// Since asks for only what's changed in the state since an earlier Sequence
+	Since *uint64 `json:"since"`
+
+	// Key identifies an answer submission, so retrying it doesn't submit it twice.
+	// The Idempotency-Key header may be used instead.
+	Key string `json:"key"`
+
+	// Locale is the language the team would like things in.
+	// It is nil if no language was sent, and empty to forget the team's choice.
+	Locale *string `json:"locale"`
+
+	// Avatar is an image; in JSON, it's base64-encoded.
+	// It is nil if no avatar was sent.
+	Avatar []byte `json:"avatar"`
+}
+
+// ParseAPIv2Request reads an APIv2Request from req.
+func ParseAPIv2Request(req *http.Request) (APIv2Request, error) {
+	var r APIv2Request
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&r); err != nil {
+			return r, fmt.Errorf("decoding JSON request: %w", err)
+		}
+		return r, nil
+	}
+
+	r.ID = req.FormValue("id")
+	r.Name = req.FormValue("name")
+	r.Cat = req.FormValue("cat")
+	r.Answer = req.FormValue("answer")
+	r.Division = req.FormValue("division")
+	r.Key = req.FormValue("key")
+	avatar, err := readAvatarUpload(req)
+	if err != nil {
+		return r, fmt.Errorf("avatar: %w", err)
+	}
+	r.Avatar = avatar
+	since, err := parseSince(req.FormValue("since"))
+	if err != nil {
+		return r, err
+	}
+	r.Since = since
+	if pointstr := req.FormValue("points"); pointstr != "" {
+		points, err := strconv.Atoi(pointstr)
+		if err != nil {
+			return r, fmt.Errorf("points: %w", err)
+		}
+		r.Points = points
+	}
+	return r, nil
+}
+
+// acceptsJSON returns true if the client is willing to accept a JSON response.
+func acceptsJSON(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// APIv2ErrorStatus returns the HTTP status code appropriate for err.
+func APIv2ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrIncorrectAnswer):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrInvalidTeamID), errors.Is(err, ErrUnknownTeamID):
+		return http.StatusForbidden
+	case errors.Is(err, ErrAlreadyAwarded), errors.Is(err, ErrAlreadyRegistered):
+		return http.StatusConflict
+	case errors.Is(err, ErrPuzzleLocked):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidTeamName), errors.Is(err, ErrInvalidAvatar), errors.Is(err, ErrUnknownDivision), errors.Is(err, ErrInvalidLocale), errors.Is(err, ErrMalformedAnswer):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPaused):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrCoolingDown):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// apiv2ErrorJSend returns the HTTP status code and JSend status for err.
+func apiv2ErrorJSend(err error) (int, string) {
+	statusCode := APIv2ErrorStatus(err)
+	if statusCode >= 500 {
+		return statusCode, jsend.Error
+	}
+	return statusCode, jsend.Fail
+}
+
+// sendAPIv2Error sends err as a JSend response, with an appropriate HTTP status code.
+func sendAPIv2Error(w http.ResponseWriter, short string, err error) {
+	statusCode, status := apiv2ErrorJSend(err)
+	jsend.SendfStatus(w, statusCode, status, short, "%s", err.Error())
+}
+
+// HandleAPIv2Func binds a new v2 API handler function.
+//
+// Requests using any method other than method are refused,
+// as are cross-origin POST requests.
+// Unless pattern is a subtree (ending in "/"), which serves files,
+// requests which will not accept a JSON response are also refused.
+func (h *HTTPServer) HandleAPIv2Func(
+	pattern string,
+	method string,
+	apiHandler func(MothRequestHandler, APIv2Request, http.ResponseWriter, *http.Request),
+) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			jsend.SendfStatus(w, http.StatusMethodNotAllowed, jsend.Fail, "method not allowed", "use %s for this endpoint", method)
+			return
+		}
+		if (method == http.MethodPost) && !sameOrigin(req) && !h.server.config().originAllowed(req.Header.Get("Origin")) {
+			jsend.SendfStatus(w, http.StatusForbidden, jsend.Fail, "cross-origin", "cross-origin request refused")
+			return
+		}
+		if !strings.HasSuffix(pattern, "/") && !acceptsJSON(req) {
+			http.Error(w, "this endpoint only provides application/json", http.StatusNotAcceptable)
+			return
+		}
+		r, err := ParseAPIv2Request(req)
+		if err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "%s", err.Error())
+			return
+		}
+		var teamID, memberID string
+		if pattern == "/register" {
+			teamID, memberID = h.resolveID(r.ID)
+		} else {
+			teamID, memberID = h.requestIdentity(w, req, r.ID)
+		}
+		mh := h.server.NewHandler(teamID).WithContext(req.Context())
+		mh.setMember(memberID)
+		mh.remote = h.clientIP(req)
+		mh.log = mh.log.With("request", RequestID(req.Context()), "remote", mh.remote.String())
+		apiHandler(mh, r, w, req)
+	}
+	h.HandleFunc(h.base+APIv2Prefix+pattern, handler)
+}
+
+// APIv2StateHandler returns the state of the event, wrapped in a JSend envelope
+func (h *HTTPServer) APIv2StateHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	jsend.SendETag(w, req, mh.exportForRequest(false, r.Since, r.Division))
+}
+
+// APIv2PublicStateHandler returns the points log and team names, wrapped in a JSend envelope
+func (h *HTTPServer) APIv2PublicStateHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	allowAnyOrigin(w)
+	jsend.SendETag(w, req, mh.exportForRequest(true, r.Since, r.Division))
+}
+
+// APIv2RegisterHandler handles attempts to register a team
+func (h *HTTPServer) APIv2RegisterHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	teamName := strings.TrimSpace(r.Name)
+	if teamName == "" {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "empty name", "Team name may not be empty")
+		return
+	}
+
+	email, err := parseEmail(r.Email)
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not registered", "%s", err.Error())
+		return
+	}
+
+	if err := mh.RegisterInDivision(teamName, r.Division); err != nil {
+		sendAPIv2Error(w, "not registered", err)
+		return
+	}
+	if err := mh.registerEmail(teamName, email); err != nil {
+		mh.log.Error("setting email", "error", err)
+	}
+	h.StartSession(w, req, mh.teamID, mh.member)
+	jsend.SendStatus(w, http.StatusCreated, jsend.Success, registerResponse{
+		Short:         "registered",
+		Description:   "team ID registered",
+		RecoveryCodes: mh.recoveryCodes(),
+	})
+}
+
+// APIv2AnswerHandler checks answer correctness and awards points
+func (h *HTTPServer) APIv2AnswerHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	if r.Cat == "" {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "no category specified")
+		return
+	}
+	key := r.Key
+	if header := req.Header.Get(IdempotencyKeyHeader); header != "" {
+		key = header
+	}
+	part, err := mh.SubmitAnswerOnce(key, r.Cat, r.Points, r.Answer)
+	if errors.Is(err, ErrPracticeAnswer) {
+		sendPracticeResponse(mh, w, h.base, r.Cat, r.Points)
+		return
+	}
+	if err != nil {
+		statusCode, status := apiv2ErrorJSend(err)
+		sendAnswerResponse(mh, w, statusCode, status, "not accepted", err.Error(), r.Cat, r.Points)
+		return
+	}
+	if part != "" {
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Success, "accepted", fmt.Sprintf("part %s of %d points in %s solved", part, r.Points, r.Cat), r.Cat, r.Points)
+		return
+	}
+	sendAnswerResponse(mh, w, http.StatusOK, jsend.Success, "accepted", fmt.Sprintf("%d points awarded in %s", r.Points, r.Cat), r.Cat, r.Points)
+}
+
+// APIv2ProfileHandler handles changes to a team's name or avatar
+func (h *HTTPServer) APIv2ProfileHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	if err := mh.UpdateProfile(strings.TrimSpace(r.Name), r.Avatar, r.Locale); err != nil {
+		sendAPIv2Error(w, "not updated", err)
+		return
+	}
+	jsend.Sendf(w, jsend.Success, "updated", "team profile updated")
+}
+
+// APIv2AvatarHandler returns a team's avatar image
+func (h *HTTPServer) APIv2AvatarHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	serveAvatar(mh, w, req, strings.TrimPrefix(req.URL.Path, h.base+APIv2Prefix+"/avatar/"))
+}
+
+// APIv2ContentHandler returns static content from a given puzzle
+func (h *HTTPServer) APIv2ContentHandler(mh MothRequestHandler, r APIv2Request, w http.ResponseWriter, req *http.Request) {
+	prefix := h.base + APIv2Prefix + "/content/"
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, prefix), "/", 3)
+	if len(parts) < 3 {
+		jsend.SendfStatus(w, http.StatusNotFound, jsend.Fail, "not found", "use %s{category}/{points}/{filename}", prefix)
+		return
+	}
+
+	cat := parts[0]
+	filename := parts[2]
+	if filename == "" {
+		filename = "puzzle.json"
+	}
+	points, err := strconv.Atoi(parts[1])
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "points: %s", err.Error())
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	mf, mtime, err := mh.PuzzlesOpenLocalized(cat, points, filename, mh.requestLocales(req))
+	if (err != nil) && (filename == BundleFile) {
+		err = mh.serveBundle(w, req, cat, points)
+		if errors.Is(err, ErrTooManyDownloads) {
+			jsend.SendfStatus(w, http.StatusTooManyRequests, jsend.Fail, "too many downloads", "%s", err.Error())
+		} else if err != nil {
+			jsend.SendfStatus(w, http.StatusNotFound, jsend.Fail, "not found", "%s", err.Error())
+		}
+		return
+	}
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusNotFound, jsend.Fail, "not found", "%s", err.Error())
+		return
+	}
+	defer mf.Close()
+
+	if filename != "puzzle.json" {
+		dw, done, err := mh.startDownload(w, req)
+		if err != nil {
+			jsend.SendfStatus(w, http.StatusTooManyRequests, jsend.Fail, "too many downloads", "%s", err.Error())
+			return
+		}
+		defer done()
+		w = dw
+	}
+
+	http.ServeContent(w, req, filename, mtime, mf)
+}
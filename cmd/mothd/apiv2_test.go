@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func (hs *HTTPServer) TestAPIv2Request(method, path string, body interface{}) *httptest.ResponseRecorder {
+	buf := new(bytes.Buffer)
+	if body != nil {
+		json.NewEncoder(buf).Encode(body)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, buf)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	hs.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPIv2(t *testing.T) {
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestAPIv2Request("GET", "/v2/state", nil); r.Code != 200 {
+		t.Error(r.Result())
+	} else if r.Body.String() != `{"status":"success","data":{"Config":{"Devel":false},"Enabled":true,"Until":"2519-10-31T00:00:00Z","TeamNames":{},"PointsLog":[],"Puzzles":{}}}` {
+		t.Error("Unexpected state", r.Body.String())
+	}
+
+	if r := hs.TestAPIv2Request("GET", "/v2/register", nil); r.Code != 405 {
+		t.Error("GET to a mutation should be refused", r.Result())
+	} else if r.Header().Get("Allow") != "POST" {
+		t.Error("No Allow header")
+	}
+
+	{
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/v2/state", nil)
+		request.Header.Set("Accept", "text/html")
+		hs.ServeHTTP(recorder, request)
+		if recorder.Code != 406 {
+			t.Error("Should not be acceptable", recorder.Result())
+		}
+	}
+
+	if r := hs.TestAPIv2Request("POST", "/v2/register", map[string]string{"id": "bad team id", "name": "GoTeam"}); r.Code != 403 {
+		t.Error(r.Result(), r.Body.String())
+	}
+	if r := hs.TestAPIv2Request("POST", "/v2/register", map[string]string{"id": TestTeamID}); r.Code != 400 {
+		t.Error(r.Result(), r.Body.String())
+	}
+	if r := hs.TestAPIv2Request("POST", "/v2/register", map[string]string{"id": TestTeamID, "moo": "cow"}); r.Code != 400 {
+		t.Error("Unknown fields should be refused", r.Result())
+	}
+	if r := hs.TestAPIv2Request("POST", "/v2/register", map[string]string{"id": TestTeamID, "name": "GoTeam"}); r.Code != 201 {
+		t.Error(r.Result(), r.Body.String())
+	}
+	if r := hs.TestAPIv2Request("POST", "/v2/register", map[string]string{"id": TestTeamID, "name": "GoTeam"}); r.Code != 409 {
+		t.Error(r.Result(), r.Body.String())
+	}
+
+	server.refresh()
+
+	if r := hs.TestAPIv2Request("GET", "/v2/content/pategory/2/puzzle.json?id="+TestTeamID, nil); r.Code != 404 {
+		t.Error("Locked puzzle should be 404", r.Result())
+	}
+	if r := hs.TestAPIv2Request("GET", "/v2/content/pategory/1/moo.txt?id="+TestTeamID, nil); r.Code != 200 {
+		t.Error(r.Result())
+	} else if r.Body.String() != "moo" {
+		t.Error("Unexpected body", r.Body.String())
+	}
+
+	answer := map[string]interface{}{"id": TestTeamID, "cat": "pategory", "points": 1, "answer": "moo"}
+	if r := hs.TestAPIv2Request("POST", "/v2/answer", answer); r.Code != 422 {
+		t.Error(r.Result(), r.Body.String())
+	}
+	answer["answer"] = "answer123"
+	if r := hs.TestAPIv2Request("POST", "/v2/answer", answer); r.Code != 200 {
+		t.Error(r.Result(), r.Body.String())
+	} else if r.Body.String() != `{"status":"success","data":{"short":"accepted","description":"1 points awarded in pategory"}}` {
+		t.Error("Unexpected body", r.Body.String())
+	}
+
+	server.refresh()
+
+	if r := hs.TestAPIv2Request("POST", "/v2/answer", answer); r.Code != 409 {
+		t.Error(r.Result(), r.Body.String())
+	}
+}
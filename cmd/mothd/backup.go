@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// BackupChecksumFile is the last file in a backup.
+// It lists the SHA-256 checksum of every other file,
+// in the same format as sha256sum(1).
+const BackupChecksumFile = "SHA256SUMS"
+
+// BackupPrefix begins the name of every backup written by MaintainBackups.
+const BackupPrefix = "moth-state-"
+
+// BackupSuffix ends the name of every backup.
+const BackupSuffix = ".tar.gz"
+
+// Backup writes a gzipped tar archive of the state directory to w.
+//
+// The points log is locked while the backup is made,
+// so the points log and points.new agree with each other.
+func (s *State) Backup(w io.Writer) error {
+	unlock := s.lockPointsLog()
+	defer unlock()
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	sums := new(bytes.Buffer)
+	err := afero.Walk(s, ".", func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if (filename == ".") || (filename == PointsLockFile) || (filepath.Dir(filename) == "points.tmp") {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filename)
+		switch {
+		case info.IsDir():
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		case info.Mode().IsRegular():
+			buf, err := afero.ReadFile(s, filename)
+			if err != nil {
+				return err
+			}
+			hdr.Size = int64(len(buf)) // It might have grown since the walk found it
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(buf); err != nil {
+				return err
+			}
+			fmt.Fprintf(sums, "%x  %s\n", sha256.Sum256(buf), hdr.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    BackupChecksumFile,
+		Mode:    0644,
+		Size:    int64(sums.Len()),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(sums.Bytes()); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Restore replaces the state directory with a backup made by Backup.
+//
+// Every file in the backup is checked against its checksum before anything is changed.
+// Files that aren't in the backup are removed.
+// Scoring must be suspended while this runs.
+func (s *State) Restore(r io.Reader) error {
+	files, dirs, err := readBackup(r)
+	if err != nil {
+		return err
+	}
+	if _, ok := files["initialized"]; !ok {
+		return fmt.Errorf("not a state backup: no initialized file")
+	}
+
+	unlock := s.lockPointsLog()
+	defer unlock()
+
+	var remove []string
+	err = afero.Walk(s, ".", func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || (filename == PointsLockFile) {
+			return nil
+		}
+		if _, ok := files[filepath.ToSlash(filename)]; !ok {
+			remove = append(remove, filename)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, filename := range remove {
+		if err := s.Remove(filename); err != nil {
+			return err
+		}
+	}
+
+	s.MkdirAll("points.tmp", 0755)
+	for _, dir := range dirs {
+		if err := s.MkdirAll(filepath.FromSlash(dir), 0755); err != nil {
+			return err
+		}
+	}
+	for name, data := range files {
+		filename := filepath.FromSlash(name)
+		if err := s.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := s.writeFileAtomic(filename, data); err != nil {
+			return err
+		}
+	}
+	slog.Info("restored state", "files", len(files), "removed", len(remove))
+
+	if err := s.reopenEventLog(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.pending = nil
+	s.teamNamesLastChange = time.Time{}
+	s.avatarsLastChange = time.Time{}
+	s.divisionsLastChange = time.Time{}
+	s.lock.Unlock()
+	s.updateEnabled()
+	s.updateMultipliers()
+	s.updateCaches()
+	s.LogEvent("restore", "", "", 0)
+	return nil
+}
+
+// readBackup reads a backup made by Backup,
+// returning the contents of every file, and the name of every directory.
+// It fails if any file doesn't match its checksum.
+func readBackup(r io.Reader) (map[string][]byte, []string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	dirs := make([]string, 0)
+	var sums []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		name := path.Clean(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return nil, nil, fmt.Errorf("unsafe path in backup: %q", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			dirs = append(dirs, name)
+		case tar.TypeReg:
+			buf, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, nil, err
+			}
+			if name == BackupChecksumFile {
+				sums = buf
+			} else {
+				files[name] = buf
+			}
+		}
+	}
+	if sums == nil {
+		return nil, nil, fmt.Errorf("no %s in backup", BackupChecksumFile)
+	}
+
+	checked := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed line in %s: %q", BackupChecksumFile, scanner.Text())
+		}
+		data, ok := files[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing from backup: %s", name)
+		}
+		actual := sha256.Sum256(data)
+		if sum != hex.EncodeToString(actual[:]) {
+			return nil, nil, fmt.Errorf("checksum mismatch: %s", name)
+		}
+		checked[name] = true
+	}
+	for name := range files {
+		if !checked[name] {
+			return nil, nil, fmt.Errorf("no checksum for %s", name)
+		}
+	}
+	return files, dirs, nil
+}
+
+// MaintainBackups writes a backup to fs every interval,
+// keeping only the newest keep backups.
+// If keep is zero, every backup is kept.
+func (s *State) MaintainBackups(fs afero.Fs, interval time.Duration, keep int) {
+	for range time.Tick(interval) {
+		if err := s.writeBackup(fs, time.Now(), keep); err != nil {
+			slog.Error("writing backup", "error", err)
+		}
+	}
+}
+
+// writeBackup writes a backup to fs, named for when it was made,
+// and then removes all but the newest keep backups.
+func (s *State) writeBackup(fs afero.Fs, when time.Time, keep int) error {
+	filename := BackupPrefix + when.UTC().Format(rotatedTimeFormat) + BackupSuffix
+	tmpfn := filename + ".tmp"
+	f, err := fs.Create(tmpfn)
+	if err != nil {
+		return err
+	}
+	err = s.Backup(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(tmpfn, filename)
+	}
+	if err != nil {
+		fs.Remove(tmpfn)
+		return err
+	}
+	slog.Info("wrote backup", "file", filename)
+
+	return pruneFiles(fs, BackupPrefix, BackupSuffix, keep)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestBackupRestore(t *testing.T) {
+	s := NewTestState()
+	go slurp(s.refreshNow)
+	teamIDs, _ := afero.ReadFile(s, "teamids.txt")
+	teamID := strings.Split(string(teamIDs), "\n")[0]
+	if err := s.SetTeamName(teamID, "Backed Up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AwardPoints(teamID, "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if err := s.AwardPoints(teamID, "pategory", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := new(bytes.Buffer)
+	if err := s.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewTestState()
+	go slurp(r.refreshNow)
+	afero.WriteFile(r, "teams/stranger", []byte("Stranger\n"), 0644)
+	if err := r.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := r.TeamName(teamID); (err != nil) || (name != "Backed Up") {
+		t.Error("Team not restored:", name, err)
+	}
+	if _, err := r.TeamName("stranger"); err == nil {
+		t.Error("Team not in backup is still there")
+	}
+	if len(r.PointsLog()) != 1 {
+		t.Error("Wrong points log:", r.PointsLog())
+	}
+	r.refresh()
+	if len(r.PointsLog()) != 2 {
+		t.Error("Award waiting in points.new not restored:", r.PointsLog())
+	}
+
+	// Mess with the backup
+	tampered := new(bytes.Buffer)
+	gz := gzip.NewWriter(tampered)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct{ name, contents string }{
+		{"initialized", "initialized\n"},
+		{"points.log", "1 evil pategory 1\n"},
+		{BackupChecksumFile, "0000  initialized\n0000  points.log\n"},
+	} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents))})
+		tw.Write([]byte(f.contents))
+	}
+	tw.Close()
+	gz.Close()
+	if err := r.Restore(tampered); err == nil {
+		t.Error("Restored a backup with bad checksums")
+	}
+	if len(r.PointsLog()) != 2 {
+		t.Error("Failed restore changed the points log:", r.PointsLog())
+	}
+}
+
+func TestWriteBackup(t *testing.T) {
+	s := NewTestState()
+	fs := afero.NewMemMapFs()
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if err := s.writeBackup(fs, when.Add(time.Duration(i)*time.Hour), 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirents, _ := afero.ReadDir(fs, ".")
+	if len(dirents) != 3 {
+		t.Fatal("Wrong number of backups kept:", len(dirents))
+	}
+	if dirents[0].Name() != "moth-state-20240501T130000Z.tar.gz" {
+		t.Error("Wrong backup removed:", dirents[0].Name())
+	}
+	f, _ := fs.Open(dirents[0].Name())
+	defer f.Close()
+	if _, _, err := readBackup(f); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes sockets on.
+const systemdFirstFD = 3
+
+// BindAddress is an address to serve on, with options for just that address.
+//
+// It's written like ":8080", "[::1]:8080", "tcp6:[::]:8080", "unix:/run/moth/moth.sock",
+// or "systemd:name", followed by any options, separated by commas:
+//
+//	notls        serve plain HTTP here, even if HTTPS is on
+//	maxconns=N   accept no more than N connections at once here
+//	mode=0660    permissions of a Unix socket
+//
+// "tcp4:" and "tcp6:" listen on only IPv4 or IPv6.
+// Without either, an address like ":8080" or "[::]:8080" is dual-stack.
+//
+// "systemd" uses a socket passed by systemd socket activation:
+// the one with FileDescriptorName=name, or the first one, if there's no name.
+type BindAddress struct {
+	// Network is "tcp", "tcp4", "tcp6", "unix", or "systemd"
+	Network string
+
+	// Address is a [host]:port, the path of a Unix socket,
+	// or the name of a socket from systemd
+	Address string
+
+	// NoTLS serves plain HTTP, even if HTTPS is on
+	NoTLS bool
+
+	// MaxConns, if more than zero, overrides the server's connection limit
+	MaxConns int
+
+	// Mode, if set, is the permissions of a Unix socket
+	Mode os.FileMode
+}
+
+// ParseBindAddress parses an address to serve on.
+func ParseBindAddress(s string) (BindAddress, error) {
+	fields := strings.Split(s, ",")
+	b := BindAddress{Network: "tcp", Address: fields[0]}
+	if network, addr, ok := strings.Cut(fields[0], ":"); ok {
+		switch network {
+		case "tcp4", "tcp6", "unix", "systemd":
+			b.Network = network
+			b.Address = addr
+		}
+	} else if fields[0] == "systemd" {
+		b.Network = "systemd"
+		b.Address = ""
+	}
+
+	switch b.Network {
+	case "systemd":
+	case "unix":
+		if b.Address == "" {
+			return b, fmt.Errorf("bind %s: no socket path", s)
+		}
+	default:
+		if _, _, err := net.SplitHostPort(b.Address); err != nil {
+			return b, fmt.Errorf("bind %s: %w", s, err)
+		}
+	}
+
+	for _, opt := range fields[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "notls":
+			b.NoTLS = true
+		case "maxconns":
+			n, err := strconv.Atoi(val)
+			if (err != nil) || (n < 1) {
+				return b, fmt.Errorf("bind %s: maxconns must be a positive number", s)
+			}
+			b.MaxConns = n
+		case "mode":
+			mode, err := strconv.ParseUint(val, 8, 32)
+			if (err != nil) || (mode > 0777) {
+				return b, fmt.Errorf("bind %s: mode must be octal permissions, like 0660", s)
+			}
+			if b.Network != "unix" {
+				return b, fmt.Errorf("bind %s: mode is only for Unix sockets", s)
+			}
+			b.Mode = os.FileMode(mode)
+		default:
+			return b, fmt.Errorf("bind %s: unknown option %q", s, opt)
+		}
+	}
+	return b, nil
+}
+
+// String returns the address, without options.
+func (b BindAddress) String() string {
+	switch {
+	case b.Network == "tcp":
+		return b.Address
+	case (b.Network == "systemd") && (b.Address == ""):
+		return b.Network
+	}
+	return b.Network + ":" + b.Address
+}
+
+// Listen starts listening on the address.
+//
+// A Unix socket left behind by an earlier run is removed first.
+func (b BindAddress) Listen() (net.Listener, error) {
+	if b.Network == "systemd" {
+		return systemdSockets.listener(b.Address)
+	} else if b.Network != "unix" {
+		return net.Listen(b.Network, b.Address)
+	}
+
+	if fi, err := os.Lstat(b.Address); (err == nil) && (fi.Mode()&os.ModeSocket != 0) {
+		if err := os.Remove(b.Address); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", b.Address)
+	if err != nil {
+		return nil, err
+	}
+	if b.Mode != 0 {
+		if err := os.Chmod(b.Address, b.Mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// systemdSockets are the sockets systemd passed us.
+var systemdSockets = &socketActivation{}
+
+// socketActivation hands out sockets passed by systemd, each only once.
+//
+// systemd says how many there are in $LISTEN_FDS,
+// and what they're called in $LISTEN_FDNAMES.
+// $LISTEN_PID makes sure they're meant for this process,
+// and not for a parent that forgot to clear the environment.
+type socketActivation struct {
+	once  sync.Once
+	lock  sync.Mutex
+	files []*os.File
+	names []string
+}
+
+// load finds the sockets passed to this process,
+// and clears the environment, so that commands we run don't think they're for them.
+// Commands don't inherit the sockets, either.
+//
+// Only the first call does anything.
+func (sa *socketActivation) load() {
+	sa.once.Do(func() {
+		defer os.Unsetenv("LISTEN_PID")
+		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
+
+		if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); (err != nil) || (pid != os.Getpid()) {
+			return
+		}
+		n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil {
+			return
+		}
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < n; i++ {
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			}
+			fd := uintptr(systemdFirstFD + i)
+			closeOnExec(fd)
+			sa.files = append(sa.files, os.NewFile(fd, name))
+			sa.names = append(sa.names, name)
+		}
+	})
+}
+
+// listener returns the socket called name,
+// or the first one not yet handed out, if name is empty.
+func (sa *socketActivation) listener(name string) (net.Listener, error) {
+	sa.load()
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	for i, f := range sa.files {
+		if (f == nil) || ((name != "") && (sa.names[i] != name)) {
+			continue
+		}
+		sa.files[i] = nil
+		ln, err := net.FileListener(f)
+		f.Close()
+		return ln, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	return nil, fmt.Errorf("no socket named %s passed by systemd", name)
+}
+
+// bindList is a flag.Value of addresses to serve on, which may be given more than once.
+type bindList []BindAddress
+
+func (l *bindList) String() string {
+	addrs := make([]string, len(*l))
+	for i, b := range *l {
+		addrs[i] = b.String()
+	}
+	return strings.Join(addrs, ",")
+}
+
+func (l *bindList) Set(value string) error {
+	b, err := ParseBindAddress(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, b)
+	return nil
+}
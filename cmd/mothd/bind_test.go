@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBindAddress(t *testing.T) {
+	cases := []struct {
+		s    string
+		want BindAddress
+	}{
+		{":8080", BindAddress{Network: "tcp", Address: ":8080"}},
+		{"[::1]:8080", BindAddress{Network: "tcp", Address: "[::1]:8080"}},
+		{"localhost:8080,notls", BindAddress{Network: "tcp", Address: "localhost:8080", NoTLS: true}},
+		{"tcp6:[::]:443,maxconns=100", BindAddress{Network: "tcp6", Address: "[::]:443", MaxConns: 100}},
+		{"tcp4:0.0.0.0:443", BindAddress{Network: "tcp4", Address: "0.0.0.0:443"}},
+		{"unix:/run/moth/moth.sock,mode=0660", BindAddress{Network: "unix", Address: "/run/moth/moth.sock", Mode: 0660}},
+		{"systemd", BindAddress{Network: "systemd"}},
+		{"systemd:https,maxconns=50", BindAddress{Network: "systemd", Address: "https", MaxConns: 50}},
+	}
+	for _, c := range cases {
+		got, err := ParseBindAddress(c.s)
+		if err != nil {
+			t.Error(c.s, err)
+		} else if got != c.want {
+			t.Errorf("%s parsed as %#v", c.s, got)
+		}
+	}
+
+	for _, s := range []string{
+		"8080",
+		"unix:",
+		":8080,mode=0660",
+		"unix:/tmp/moth.sock,mode=999",
+		":8080,maxconns=0",
+		":8080,fast",
+	} {
+		if b, err := ParseBindAddress(s); err == nil {
+			t.Errorf("%s accepted as %#v", s, b)
+		}
+	}
+}
+
+func TestBindUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moth.sock")
+	bind, err := ParseBindAddress("unix:" + path + ",mode=0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A socket left behind shouldn't get in the way
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := bind.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if fi, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Error("Wrong socket permissions:", fi.Mode())
+	}
+
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Write([]byte("hi"))
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); (err != nil) || (string(buf) != "hi") {
+		t.Error("Wrong read:", string(buf), err)
+	}
+}
+
+func TestSocketActivation(t *testing.T) {
+	sa := &socketActivation{}
+	sa.once.Do(func() {}) // Don't look at the environment
+	for _, name := range []string{"http", "https"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := ln.(*net.TCPListener).File()
+		ln.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sa.files = append(sa.files, f)
+		sa.names = append(sa.names, name)
+	}
+
+	https, err := sa.listener("https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer https.Close()
+	if _, err := sa.listener("https"); err == nil {
+		t.Error("Socket handed out twice")
+	}
+	first, err := sa.listener("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if first.Addr().String() == https.Addr().String() {
+		t.Error("First socket is the one already handed out")
+	}
+	if _, err := sa.listener(""); err == nil {
+		t.Error("Handed out more sockets than there are")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// BundleFile is the name /content gives a zip of all a puzzle's attachments,
+// unless the puzzle has an attachment of its own by that name.
+const BundleFile = "bundle.zip"
+
+// ErrNoAttachments means a puzzle has no attachments to bundle up.
+var ErrNoAttachments = errors.New("this puzzle has no attachments")
+
+// serveBundle sends a zip of every attachment a puzzle lists,
+// built as it's sent,
+// so teams on a poor network can get them all with one request.
+// It counts as one download.
+//
+// If it returns an error, nothing has been sent.
+func (mh *MothRequestHandler) serveBundle(w http.ResponseWriter, req *http.Request, cat string, points int) error {
+	if !mh.unlocked(cat, points) {
+		return ErrPuzzleLocked
+	}
+	puzzle, err := mh.puzzle(cat, points)
+	if err != nil {
+		return err
+	}
+	if len(puzzle.Attachments) == 0 {
+		return ErrNoAttachments
+	}
+	w, done, err := mh.startDownload(w, req)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": fmt.Sprintf("%s-%d.zip", cat, points),
+	}))
+	if req.Method == http.MethodHead {
+		return nil
+	}
+
+	zw := zip.NewWriter(w)
+	locales := mh.requestLocales(req)
+	for _, filename := range puzzle.Attachments {
+		if !filepath.IsLocal(filename) {
+			mh.log.Warn("not bundling attachment", "category", cat, "points", points, "filename", filename)
+			continue
+		}
+		if err := mh.bundleAttachment(zw, cat, points, filename, locales); err != nil {
+			// Too late to say so: the zip is just missing what couldn't be sent
+			mh.log.Error("bundling attachment", "category", cat, "points", points, "filename", filename, "error", err)
+			if req.Context().Err() != nil {
+				return nil
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		mh.log.Error("bundling attachments", "category", cat, "points", points, "error", err)
+	}
+	return nil
+}
+
+// bundleAttachment adds one of a puzzle's attachments to zw.
+func (mh *MothRequestHandler) bundleAttachment(zw *zip.Writer, cat string, points int, filename string, locales []string) error {
+	f, mtime, err := mh.PuzzlesOpenLocalized(cat, points, filename, locales)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     filename,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, f)
+	return err
+}
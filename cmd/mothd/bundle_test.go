@@ -0,0 +1,80 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	server := NewTestServer()
+	mothballs := server.PuzzleProviders[0].(*Mothballs)
+	mothballs.createMothballWithFiles(
+		"bundlegory",
+		[]testFileContents{
+			{"1/puzzle.json", `{"Attachments": ["moo.txt", "data/baa.txt", "../passwd"]}`},
+			{"1/moo.txt", "moo"},
+			{"1/data/baa.txt", "baa"},
+		},
+	)
+	mothballs.createMothballWithFiles(
+		"zipgory",
+		[]testFileContents{
+			{"1/puzzle.json", `{"Attachments": ["bundle.zip"]}`},
+			{"1/bundle.zip", "not really a zip"},
+		},
+	)
+	server.refresh()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	r := hs.TestRequest("/content/bundlegory/1/bundle.zip", nil)
+	if r.Code != http.StatusOK {
+		t.Fatal("No bundle:", r.Code, r.Body.String())
+	}
+	if ct := r.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Error("Wrong content type:", ct)
+	}
+	if cd := r.Header().Get("Content-Disposition"); cd != `attachment; filename=bundlegory-1.zip` {
+		t.Error("Wrong content disposition:", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(r.Body.Bytes()), int64(r.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+	if (len(files) != 2) || (files["moo.txt"] != "moo") || (files["data/baa.txt"] != "baa") {
+		t.Error("Wrong files in bundle:", files)
+	}
+
+	if r := hs.TestAPIv2Request(http.MethodGet, "/v2/content/bundlegory/1/bundle.zip", nil); r.Header().Get("Content-Type") != "application/zip" {
+		t.Error("No bundle from the API:", r.Code, r.Body.String())
+	}
+	if r := hs.TestRequest("/content/zipgory/1/bundle.zip", nil); r.Body.String() != "not really a zip" {
+		t.Error("Puzzle's own bundle.zip not sent:", r.Body.String())
+	}
+	if r := hs.TestRequest("/content/pategory/1/bundle.zip", nil); !strings.Contains(r.Body.String(), ErrNoAttachments.Error()) {
+		t.Error("Bundle of no attachments:", r.Code, r.Body.String())
+	}
+	if r := hs.TestRequest("/content/bundlegory/2/bundle.zip", nil); r.Code != http.StatusNotFound {
+		t.Error("Bundle of a locked puzzle:", r.Code)
+	}
+
+	server.Config.MaxDownloads = 1
+	// The team isn't registered, so it counts by address
+	server.downloads.start("addr 192.0.2.1", 1)
+	if r := hs.TestRequest("/content/bundlegory/1/bundle.zip", nil); r.Code != http.StatusTooManyRequests {
+		t.Error("Bundle not counted as a download:", r.Code)
+	}
+}
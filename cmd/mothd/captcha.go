@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrCaptchaFailed means a CAPTCHA wasn't solved, or its response didn't check out.
+var ErrCaptchaFailed = errors.New("CAPTCHA not solved")
+
+// CaptchaResponseFields are the form fields a CAPTCHA response may be sent in:
+// mothd's own, then the ones the hCaptcha, reCAPTCHA, and Turnstile widgets fill in.
+var CaptchaResponseFields = []string{
+	"captcha",
+	"h-captcha-response",
+	"g-recaptcha-response",
+	"cf-turnstile-response",
+}
+
+// Captcha checks CAPTCHA responses with a verification service.
+//
+// hCaptcha, reCAPTCHA, and Cloudflare Turnstile all work the same way:
+// the secret and response are POSTed to URL,
+// which answers with a JSON object whose "success" is true if the response is good.
+type Captcha struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewCaptcha returns a new Captcha, checking responses at url with secret.
+func NewCaptcha(url string, secret string) *Captcha {
+	return &Captcha{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify returns nil if response is a good CAPTCHA response from remote.
+//
+// If the service can't be reached, that's an error too:
+// nobody gets past a CAPTCHA that can't be checked.
+func (c *Captcha) Verify(ctx context.Context, response string, remote net.IP) error {
+	if response == "" {
+		return ErrCaptchaFailed
+	}
+	form := url.Values{}
+	form.Set("secret", c.Secret)
+	form.Set("response", response)
+	if remote != nil {
+		form.Set("remoteip", remote.String())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("CAPTCHA service: %s", resp.Status)
+	}
+
+	var result struct {
+		Success    bool
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("CAPTCHA service: %w", err)
+	}
+	if !result.Success {
+		if len(result.ErrorCodes) > 0 {
+			return fmt.Errorf("%w: %s", ErrCaptchaFailed, strings.Join(result.ErrorCodes, ", "))
+		}
+		return ErrCaptchaFailed
+	}
+	return nil
+}
+
+// captchaResponse returns the CAPTCHA response sent with req, if any.
+func captchaResponse(req *http.Request) string {
+	for _, field := range CaptchaResponseFields {
+		if response := req.FormValue(field); response != "" {
+			return response
+		}
+	}
+	return ""
+}
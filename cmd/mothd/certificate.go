@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/afero"
+)
+
+// CertificateCodeLength is how many hex digits are in a certificate's verification code.
+const CertificateCodeLength = 16
+
+// CertificateKeyFile is the file in the state directory with the key certificates are signed with.
+// It's made the first time a certificate is issued.
+const CertificateKeyFile = "certificate.key"
+
+// ErrNothingCompleted means a certificate can't be issued because the team hasn't completed any categories.
+var ErrNothingCompleted = errors.New("no categories have been completed")
+
+// ErrInvalidParticipant means a participant name is too long or contains control characters.
+var ErrInvalidParticipant = errors.New("invalid participant name")
+
+// ErrInvalidCertificate means a certificate couldn't be found, or has been tampered with.
+var ErrInvalidCertificate = errors.New("no such certificate")
+
+// Certificate is proof that a team, or somebody on it, completed categories of an event.
+type Certificate struct {
+	// Code is how the certificate is looked up again, at /verify/{code}
+	Code string
+
+	Issued      time.Time
+	TeamName    string
+	Participant string `json:",omitempty"`
+
+	// Categories lists the categories the team had completed when this was issued
+	Categories []string
+
+	// KSAs lists the KSAs of every puzzle in Categories
+	KSAs []string `json:",omitempty"`
+
+	// Points is the team's score in Categories
+	Points int
+
+	// Signature is an HMAC-SHA256 of everything else, in hex
+	Signature string
+}
+
+// sign returns the signature of cert, using key.
+func (cert Certificate) sign(key []byte) string {
+	cert.Code = ""
+	cert.Signature = ""
+	buf, _ := json.Marshal(cert)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// code returns the verification code for cert, using key.
+// It doesn't depend on when cert was issued,
+// so issuing the same certificate again gets the same code.
+func (cert Certificate) code(key []byte) string {
+	cert.Issued = time.Time{}
+	return cert.sign(key)[:CertificateCodeLength]
+}
+
+// IssueCertificate issues a certificate for the categories this team has completed.
+// participant may be empty, for a certificate naming only the team.
+func (mh *MothRequestHandler) IssueCertificate(participant string) (Certificate, error) {
+	teamName, err := mh.State.TeamName(mh.teamID)
+	if err != nil {
+		return Certificate{}, ErrInvalidTeamID
+	}
+	participant = strings.TrimSpace(participant)
+	if utf8.RuneCountInString(participant) > MaxTeamNameLength {
+		return Certificate{}, fmt.Errorf("%w: longer than %d characters", ErrInvalidParticipant, MaxTeamNameLength)
+	}
+	for _, r := range participant {
+		if unicode.IsControl(r) {
+			return Certificate{}, fmt.Errorf("%w: contains control characters", ErrInvalidParticipant)
+		}
+	}
+
+	export := mh.exportState(true, teamName)
+	if len(export.Completed) == 0 {
+		return Certificate{}, ErrNothingCompleted
+	}
+	cert := Certificate{
+		Issued:      time.Now().UTC().Truncate(time.Second),
+		TeamName:    teamName,
+		Participant: participant,
+		Categories:  export.Completed,
+	}
+
+	completed := make(map[string]bool)
+	for _, cat := range export.Completed {
+		completed[cat] = true
+	}
+	for _, awd := range export.PointsLog {
+		if (awd.TeamID == "self") && completed[awd.Category] {
+			cert.Points += awd.Score
+		}
+	}
+
+	ksas := make(map[string]bool)
+	for _, cat := range export.Completed {
+		for _, points := range export.Solved[cat] {
+			puzzle, err := mh.puzzle(cat, points)
+			if err != nil {
+				mh.log.Warn("reading puzzle for certificate", "category", cat, "points", points, "error", err)
+				continue
+			}
+			for _, ksa := range puzzle.KSAs {
+				ksas[ksa] = true
+			}
+		}
+	}
+	for ksa := range ksas {
+		cert.KSAs = append(cert.KSAs, ksa)
+	}
+	sort.Strings(cert.KSAs)
+
+	cert, err = mh.State.IssueCertificate(cert)
+	if err != nil {
+		return cert, err
+	}
+	mh.State.LogEvent("certificate", mh.teamID, "", cert.Points, cert.Code)
+	return cert, nil
+}
+
+// certificateKey returns the key certificates are signed with,
+// making one if there isn't one yet.
+func (s *State) certificateKey() ([]byte, error) {
+	if buf, err := afero.ReadFile(s, CertificateKeyFile); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(buf)))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := s.OpenFile(CertificateKeyFile, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// Somebody else just made one
+		return s.certificateKey()
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, hex.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// IssueCertificate signs cert, gives it a verification code, and saves it,
+// so it can be verified later.
+//
+// If the same certificate was issued before,
+// apart from when,
+// the earlier one is returned instead.
+func (s *State) IssueCertificate(cert Certificate) (Certificate, error) {
+	key, err := s.certificateKey()
+	if err != nil {
+		return cert, err
+	}
+	if earlier, err := s.Certificate(cert.code(key)); err == nil {
+		return earlier, nil
+	}
+	cert.Code = cert.code(key)
+	cert.Signature = cert.sign(key)
+
+	buf, err := json.Marshal(cert)
+	if err != nil {
+		return cert, err
+	}
+	s.Mkdir("certificates", 0755)
+	return cert, s.writeFileAtomic(filepath.Join("certificates", cert.Code), buf)
+}
+
+// Certificate returns the certificate with the given verification code.
+// Certificates whose signature doesn't match are refused.
+func (s *State) Certificate(code string) (Certificate, error) {
+	cert := Certificate{}
+	code = strings.ToLower(strings.TrimSpace(code))
+	if len(code) != CertificateCodeLength {
+		return cert, ErrInvalidCertificate
+	}
+	if _, err := hex.DecodeString(code); err != nil {
+		return cert, ErrInvalidCertificate
+	}
+
+	buf, err := afero.ReadFile(s, filepath.Join("certificates", code))
+	if err != nil {
+		return cert, ErrInvalidCertificate
+	}
+	if err := json.Unmarshal(buf, &cert); err != nil {
+		return cert, err
+	}
+	key, err := s.certificateKey()
+	if err != nil {
+		return cert, err
+	}
+	if (cert.Code != code) || !hmac.Equal([]byte(cert.Signature), []byte(cert.sign(key))) {
+		return Certificate{}, ErrInvalidCertificate
+	}
+	return cert, nil
+}
+
+// WriteHTML renders the certificate as a printable HTML document.
+// verifyURL is where somebody can check the certificate is genuine.
+func (cert Certificate) WriteHTML(w io.Writer, verifyURL string) error {
+	return certificateTemplate.Execute(w, struct {
+		Certificate
+		VerifyURL string
+	}{cert, verifyURL})
+}
+
+var certificateTemplate = template.Must(template.New("certificate").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>Certificate of Completion</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width">
+    <style>
+      body { font-family: serif; max-width: 50em; margin: 2em auto; padding: 2em; border: 0.5em double #444; text-align: center; }
+      h1 { font-variant: small-caps; }
+      .name { font-size: 2em; margin: 0.5em 0; }
+      ul { list-style: none; padding: 0; }
+      footer { margin-top: 2em; font-family: monospace; }
+    </style>
+  </head>
+  <body>
+    <h1>Certificate of Completion</h1>
+    <p>This certifies that</p>
+    {{- if .Participant}}
+    <p class="name">{{.Participant}}</p>
+    <p>of team <strong>{{.TeamName}}</strong></p>
+    {{- else}}
+    <p class="name">{{.TeamName}}</p>
+    {{- end}}
+    <p>completed every puzzle in</p>
+    <ul class="categories">
+      {{- range .Categories}}
+      <li>{{.}}</li>
+      {{- end}}
+    </ul>
+    <p>earning {{.Points}} points.</p>
+    {{- if .KSAs}}
+
+    <h2>Knowledge, skills, and abilities</h2>
+    <ul class="ksas">
+      {{- range .KSAs}}
+      <li>{{.}}</li>
+      {{- end}}
+    </ul>
+    {{- end}}
+
+    <footer>
+      Issued {{.Issued.Format "2006-01-02"}}<br>
+      Verification code {{.Code}}<br>
+      <a href="{{.VerifyURL}}">{{.VerifyURL}}</a>
+    </footer>
+  </body>
+</html>
+`))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCertificate(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"certegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n"},
+			{"1/puzzle.json", `{"KSAs": ["K0001", "S0002"]}`},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/certificate", nil); r.Result().StatusCode != 400 {
+		t.Error("Unregistered team got a certificate:", r.Result().StatusCode)
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	if _, err := handler.IssueCertificate(""); err != ErrNothingCompleted {
+		t.Error("Certificate issued with nothing completed:", err)
+	}
+
+	if err := handler.CheckAnswer("certegory", 1, "answer123"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	if _, err := handler.IssueCertificate("a\x07b"); err == nil {
+		t.Error("Participant name with control characters accepted")
+	}
+
+	r := hs.TestRequest("/certificate", map[string]string{"name": "Ada"})
+	if r.Result().StatusCode != 200 {
+		t.Fatal(r.Result().StatusCode, r.Body.String())
+	}
+	for _, s := range []string{"Ada", "team", "certegory", "K0001", "S0002"} {
+		if !strings.Contains(r.Body.String(), s) {
+			t.Errorf("Certificate doesn't mention %q: %s", s, r.Body.String())
+		}
+	}
+
+	if r := hs.TestRequest("/certificate", map[string]string{"name": "Ada"}); r.Result().StatusCode != 200 {
+		t.Fatal(r.Result().StatusCode, r.Body.String())
+	}
+
+	state := server.State.(*State)
+	certs, err := afero.ReadDir(state, "certificates")
+	if (err != nil) || (len(certs) != 1) {
+		t.Fatal("Certificate not saved", certs, err)
+	}
+	code := certs[0].Name()
+
+	if r := hs.TestGetRequest("/verify/"+code, nil); r.Result().StatusCode != 200 {
+		t.Error("Verifying certificate:", r.Result().StatusCode)
+	} else if !strings.Contains(r.Body.String(), "Ada") {
+		t.Error("Verified certificate is wrong:", r.Body.String())
+	}
+	if r := hs.TestGetRequest("/verify/0123456789abcdef", nil); r.Result().StatusCode != 404 {
+		t.Error("Verified a certificate that doesn't exist:", r.Result().StatusCode)
+	}
+	if _, err := server.State.Certificate("../teams/teamID"); err != ErrInvalidCertificate {
+		t.Error("Verified a file outside certificates:", err)
+	}
+
+	// Tampering with a certificate invalidates it
+	filename := filepath.Join("certificates", code)
+	buf, _ := afero.ReadFile(state, filename)
+	afero.WriteFile(state, filename, []byte(strings.Replace(string(buf), "Ada", "Eve", 1)), 0644)
+	if _, err := state.Certificate(code); err != ErrInvalidCertificate {
+		t.Error("Tampered certificate verified:", err)
+	}
+}
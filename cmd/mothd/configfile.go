@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigEnvPrefix starts the name of the environment variable for every option:
+// -tls-cert is $MOTH_TLS_CERT.
+const ConfigEnvPrefix = "MOTH_"
+
+// configEnvName returns the name of the environment variable for an option.
+func configEnvName(name string) string {
+	return ConfigEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// repeatable returns true if a flag may be given more than once.
+func repeatable(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, *bindList:
+		return true
+	}
+	return false
+}
+
+// LoadConfig sets every option in fs not given on the command line,
+// from the environment, or from the config file at path.
+//
+// The config file is YAML, with option names as keys:
+//
+//	bind: [":443", "unix:/run/moth/moth.sock"]
+//	state: /var/lib/moth
+//	tls-cert: /etc/moth/cert.pem
+//
+// Options that may be given more than once take a list, or a single value.
+// In the environment, they're separated by spaces.
+//
+// The command line beats the environment, which beats the config file.
+// An empty path means there's no config file.
+func LoadConfig(fs *flag.FlagSet, path string, lookupEnv func(string) (string, bool)) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		val, ok := lookupEnv(configEnvName(f.Name))
+		if given[f.Name] || !ok || (err != nil) {
+			return
+		}
+		vals := []string{val}
+		if repeatable(f) {
+			vals = strings.Fields(val)
+		}
+		for _, v := range vals {
+			if serr := f.Value.Set(v); serr != nil {
+				err = fmt.Errorf("$%s: %w", configEnvName(f.Name), serr)
+				return
+			}
+		}
+		given[f.Name] = true
+	})
+	if (err != nil) || (path == "") {
+		return err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]interface{})
+	if err := yaml.UnmarshalStrict(b, &settings); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Sorted, so the same mistake is reported every time
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if given[name] {
+			continue
+		}
+		vals, err := configValues(settings[name], repeatable(f))
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		for _, v := range vals {
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues returns the values of an option in the config file, as they'd be on the command line.
+func configValues(setting interface{}, repeatable bool) ([]string, error) {
+	switch v := setting.(type) {
+	case []interface{}:
+		if !repeatable {
+			return nil, fmt.Errorf("only one value allowed")
+		}
+		vals := make([]string, 0, len(v))
+		for _, item := range v {
+			vs, err := configValues(item, false)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, vs...)
+		}
+		return vals, nil
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("expected a value, not a mapping")
+	case nil:
+		return []string{""}, nil
+	}
+	return []string{fmt.Sprint(setting)}, nil
+}
+
+// CheckConfig returns everything it can find wrong with the options in fs,
+// without starting anything.
+func CheckConfig(fs *flag.FlagSet) []error {
+	errs := make([]error, 0)
+	value := func(name string) string {
+		return fs.Lookup(name).Value.String()
+	}
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	checkDir := func(name string) {
+		p := value(name)
+		if strings.HasPrefix(p, S3Scheme) {
+			return
+		}
+		if fi, err := os.Stat(p); err != nil {
+			check(fmt.Errorf("-%s: %w", name, err))
+		} else if !fi.IsDir() {
+			check(fmt.Errorf("-%s: %s is not a directory", name, p))
+		}
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(value("loglevel"))))
+	_, err := NewLogger(os.Stderr, value("logformat"), level)
+	check(err)
+	if !transpile.ValidLocale(value("locale")) {
+		check(fmt.Errorf("invalid -locale: %q", value("locale")))
+	}
+	if err := ValidScoring(value("scoring")); err != nil {
+		check(fmt.Errorf("invalid -scoring: %w", err))
+	}
+	if err := ValidTieBreak(value("tie-break")); err != nil {
+		check(fmt.Errorf("invalid -tie-break: %w", err))
+	}
+	for _, name := range []string{"allow", "deny", "trusted-proxy"} {
+		_, err := ParseCIDRs(*fs.Lookup(name).Value.(*stringList))
+		check(err)
+	}
+	if origins, err := ParseOrigins(*fs.Lookup("cors-origin").Value.(*stringList)); err != nil {
+		check(fmt.Errorf("-cors-origin: %w", err))
+	} else if (value("cors-credentials") == "true") && slices.Contains(origins, "*") {
+		check(fmt.Errorf("-cors-credentials can't be used with -cors-origin '*'"))
+	}
+	if ports := value("listener-ports"); ports != "" {
+		_, _, err := ParsePortRange(ports)
+		check(err)
+	}
+	if redirect := value("redirect-bind"); redirect != "" {
+		_, err := ParseBindAddress(redirect)
+		check(err)
+	}
+	if cert, key := value("tls-cert"), value("tls-key"); (cert != "") || (key != "") {
+		_, err := tls.LoadX509KeyPair(cert, key)
+		check(err)
+	}
+	if (value("verify-email") == "true") && (value("smtp") == "") {
+		check(fmt.Errorf("-verify-email needs -smtp"))
+	}
+	if captcha := value("captcha"); captcha != "" {
+		if u, err := url.Parse(captcha); (err != nil) || (u.Scheme == "") || (u.Host == "") {
+			check(fmt.Errorf("-captcha: not a URL: %q", captcha))
+		}
+	}
+	if (value("xapi") != "") && (value("xapi-home") == "") {
+		check(fmt.Errorf("-xapi needs -xapi-home"))
+	}
+	if smtpAddr := value("smtp"); smtpAddr != "" {
+		if _, _, err := net.SplitHostPort(smtpAddr); err != nil {
+			check(fmt.Errorf("-smtp: %w", err))
+		}
+		if _, err := mail.ParseAddress(value("smtp-from")); err != nil {
+			check(fmt.Errorf("-smtp-from: %w", err))
+		}
+	}
+
+	checkDir("theme")
+	switch {
+	case value("manifest") != "":
+		_, err := os.Stat(value("manifest"))
+		check(err)
+	case value("puzzles") != "":
+		checkDir("puzzles")
+	default:
+		checkDir("mothballs")
+	}
+	if serve := value("serve-state"); serve != "" {
+		if b, err := ParseBindAddress(serve); err != nil {
+			check(err)
+		} else if (b.Network != "unix") && (value("state-token") == "") {
+			check(fmt.Errorf("-serve-state needs -state-token, unless it's a Unix socket"))
+		}
+	}
+	if (value("plugin-state") == "") && (value("state-service") == "") {
+		checkDir("state")
+	}
+	return errs
+}
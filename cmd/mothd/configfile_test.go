@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	fs := flag.NewFlagSet("mothd", flag.ContinueOnError)
+	state := fs.String("state", "state", "")
+	theme := fs.String("theme", "theme", "")
+	token := fs.String("admin-token", "", "")
+	refresh := fs.Duration("refresh", 2*time.Second, "")
+	devel := fs.Bool("devel", false, "")
+	var binds bindList
+	fs.Var(&binds, "bind", "")
+	var webhooks stringList
+	fs.Var(&webhooks, "webhook", "")
+
+	path := filepath.Join(t.TempDir(), "moth.yaml")
+	os.WriteFile(path, []byte(strings.Join([]string{
+		"state: /var/lib/moth",
+		"theme: /srv/moth/theme",
+		"admin-token: from-file",
+		"refresh: 10s",
+		"devel: true",
+		`bind: [":443", "unix:/run/moth/moth.sock,mode=0660"]`,
+		"webhook: https://example.com/hook",
+	}, "\n")), 0644)
+	env := map[string]string{
+		"MOTH_ADMIN_TOKEN": "from-env",
+		"MOTH_WEBHOOK":     "https://a.example/ https://b.example/",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	if err := fs.Parse([]string{"-theme", "/opt/theme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(fs, path, lookupEnv); err != nil {
+		t.Fatal(err)
+	}
+	if *state != "/var/lib/moth" {
+		t.Error("State path not set from file:", *state)
+	}
+	if *theme != "/opt/theme" {
+		t.Error("Config file beat the command line:", *theme)
+	}
+	if *token != "from-env" {
+		t.Error("Config file beat the environment:", *token)
+	}
+	if (*refresh != 10*time.Second) || !*devel {
+		t.Error("Wrong duration or bool:", *refresh, *devel)
+	}
+	if (len(binds) != 2) || (binds[1].Network != "unix") || (binds[1].Mode != 0660) {
+		t.Error("Wrong binds:", binds)
+	}
+	if (len(webhooks) != 2) || (webhooks[1] != "https://b.example/") {
+		t.Error("Wrong webhooks from the environment:", webhooks)
+	}
+
+	for _, bad := range []string{
+		"bogus: 1",
+		"state: [a, b]",
+		"refresh: soon",
+		"bind: 8080",
+		"state:\n  path: /var/lib/moth",
+		"state: a\nstate: b",
+	} {
+		fs := flag.NewFlagSet("mothd", flag.ContinueOnError)
+		fs.String("state", "state", "")
+		fs.Duration("refresh", 2*time.Second, "")
+		var binds bindList
+		fs.Var(&binds, "bind", "")
+		os.WriteFile(path, []byte(bad), 0644)
+		if err := LoadConfig(fs, path, lookupEnv); err == nil {
+			t.Errorf("Accepted %q", bad)
+		}
+	}
+}
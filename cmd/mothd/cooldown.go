@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCoolingDown means a team has given too many wrong answers for a puzzle,
+// and has to wait before it can try again.
+var ErrCoolingDown = errors.New("too many wrong answers: wait before trying again")
+
+// MaxCooldownDoublings is how many times a cooldown can double.
+// After that, every cooldown is the same length.
+const MaxCooldownDoublings = 6
+
+// AnswerLimit is how many more answers a team may submit for a puzzle.
+type AnswerLimit struct {
+	// Remaining is how many more wrong answers may be submitted
+	// before a cooldown starts.
+	Remaining int `json:"remaining"`
+
+	// Cooldown is how many seconds are left before answers will be accepted again.
+	// It's zero if answers are being accepted.
+	Cooldown int `json:"cooldown"`
+}
+
+// AnswerLimit returns how many more wrong answers this team may submit for a puzzle,
+// and how long it has to wait before it may submit anything.
+//
+// It returns false if answers aren't limited.
+//
+// After every Config.WrongAnswers wrong answers,
+// the team has to wait Config.AnswerCooldown before answering again.
+// Each cooldown on a puzzle is twice as long as the one before it,
+// up to MaxCooldownDoublings times.
+func (mh *MothRequestHandler) AnswerLimit(cat string, points int) (AnswerLimit, bool) {
+	limit := mh.Config.WrongAnswers
+	if (limit <= 0) || (mh.Config.AnswerCooldown <= 0) {
+		return AnswerLimit{}, false
+	}
+
+	wrong, err := mh.State.TeamWrongAnswers(mh.teamID)
+	if err != nil {
+		mh.log.Error("reading wrong answers", "error", err)
+		return AnswerLimit{Remaining: limit}, true
+	}
+	times := wrong[cat][points]
+	ret := AnswerLimit{Remaining: limit - len(times)%limit}
+
+	lockouts := len(times) / limit
+	if lockouts == 0 {
+		return ret, true
+	}
+	cooldown := mh.Config.AnswerCooldown << min(lockouts-1, MaxCooldownDoublings)
+	started := times[lockouts*limit-1]
+	if wait := time.Until(started.Add(cooldown)); wait > 0 {
+		ret.Cooldown = int((wait + time.Second - 1) / time.Second)
+	}
+	return ret, true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// corsAllowMethods are the methods cross-origin clients may use.
+const corsAllowMethods = "GET, POST"
+
+// corsAllowHeaders are the request headers cross-origin clients may send.
+const corsAllowHeaders = "Authorization, Content-Type"
+
+// corsExposeHeaders are the response headers cross-origin clients may read.
+var corsExposeHeaders = RequestIDHeader + ", ETag"
+
+// ParseOrigins parses a list of web origins, like "https://dash.example.com".
+// "*" means any origin.
+func ParseOrigins(origins []string) ([]string, error) {
+	ret := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			ret = append(ret, origin)
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http") && (u.Scheme != "https") {
+			return nil, fmt.Errorf("origin %q must start with http:// or https://", origin)
+		}
+		if (u.Host == "") || (strings.TrimRight(u.Path, "/") != "") || (u.RawQuery != "") || (u.User != nil) {
+			return nil, fmt.Errorf("origin %q must be just a scheme and host, like https://dash.example.com", origin)
+		}
+		ret = append(ret, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return ret, nil
+}
+
+// originAllowed returns true if the CORS policy lets origin use the API.
+func (c Configuration) originAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, o := range c.CORSOrigins {
+		if (o == "*") || (o == origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors adds CORS headers to the response, if req comes from an allowed origin.
+// It returns true if req was a preflight request, which it has answered.
+func (h *HTTPServer) cors(w http.ResponseWriter, req *http.Request) bool {
+	config := h.server.config()
+	if len(config.CORSOrigins) == 0 {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	origin := req.Header.Get("Origin")
+	if !config.originAllowed(origin) {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if config.CORSCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	if (req.Method != http.MethodOptions) || (req.Header.Get("Access-Control-Request-Method") == "") {
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	if config.CORSMaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.CORSMaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// allowAnyOrigin lets any web page read a public response,
+// unless the CORS policy has already said who may.
+func allowAnyOrigin(w http.ResponseWriter) {
+	if w.Header().Get("Access-Control-Allow-Origin") == "" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+}
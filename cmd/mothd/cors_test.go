@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOrigins(t *testing.T) {
+	origins, err := ParseOrigins([]string{"https://Dash.Example.com/", "http://localhost:3000", "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(origins, " ") != "https://dash.example.com http://localhost:3000 *" {
+		t.Error("Wrong origins:", origins)
+	}
+	for _, bad := range []string{"dash.example.com", "ftp://dash.example.com", "https://dash.example.com/scores", "https://"} {
+		if _, err := ParseOrigins([]string{bad}); err == nil {
+			t.Error("Bad origin accepted:", bad)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	server := NewTestServer()
+	server.Config.CORSOrigins = []string{"https://dash.example.com"}
+	server.Config.CORSMaxAge = time.Hour
+	hs := NewHTTPServer("/", server.MothServer)
+
+	request := func(method, path, origin string, header http.Header) *httptest.ResponseRecorder {
+		form := url.Values{"id": {TestTeamID}, "name": {"GoTeam"}}
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		hs.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	preflight := http.Header{"Access-Control-Request-Method": {"POST"}}
+	r := request(http.MethodOptions, "/v2/register", "https://dash.example.com", preflight)
+	if r.Code != http.StatusNoContent {
+		t.Error("Preflight refused:", r.Code)
+	}
+	if r.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" {
+		t.Error("Wrong allowed origin:", r.Header())
+	}
+	if r.Header().Get("Access-Control-Max-Age") != "3600" {
+		t.Error("Wrong max age:", r.Header())
+	}
+	if r.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Credentials allowed without -cors-credentials")
+	}
+
+	if r := request(http.MethodOptions, "/v2/register", "https://evil.example.com", preflight); r.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Preflight allowed for the wrong origin:", r.Header())
+	}
+
+	if r := request(http.MethodPost, "/register", "https://dash.example.com", nil); !strings.Contains(r.Body.String(), "success") {
+		t.Error("Mutation from allowed origin refused:", r.Code, r.Body.String())
+	}
+	if r := request(http.MethodPost, "/register", "https://evil.example.com", nil); r.Code != http.StatusForbidden {
+		t.Error("Mutation from other origin allowed:", r.Code, r.Body.String())
+	}
+
+	server.Config.CORSCredentials = true
+	r = request(http.MethodGet, "/state/public", "https://dash.example.com", nil)
+	if (r.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com") || (r.Header().Get("Access-Control-Allow-Credentials") != "true") {
+		t.Error("Wrong CORS headers with credentials:", r.Header())
+	}
+	if r := request(http.MethodGet, "/state/public", "https://evil.example.com", nil); r.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("Public state not readable from anywhere:", r.Header())
+	}
+}
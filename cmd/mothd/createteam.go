@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// CreatedTeamIDLength is how long the team IDs made by open registration are.
+// They're longer than the ones mothd puts in a new teamids.txt,
+// since anybody can ask for one.
+const CreatedTeamIDLength = 12
+
+// ErrRegistrationClosed means a team can't be created because open registration is off.
+var ErrRegistrationClosed = errors.New("teams can't be created here: ask an organizer for a team ID")
+
+// ErrTooManyTeams means a team can't be created because the event is full.
+var ErrTooManyTeams = errors.New("no more teams can be created")
+
+// NewTeamID adds a new, random team ID to teamids.txt, and returns it.
+//
+// If maxTeams is more than zero,
+// and that many teams are already registered,
+// ErrTooManyTeams is returned instead.
+func (s *State) NewTeamID(maxTeams int) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if maxTeams > 0 {
+		teams, err := afero.ReadDir(s, "teams")
+		if err != nil {
+			return "", err
+		}
+		registered := 0
+		for _, fi := range teams {
+			if !fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+				registered++
+			}
+		}
+		if registered >= maxTeams {
+			return "", ErrTooManyTeams
+		}
+	}
+
+	ids, err := afero.ReadFile(s, "teamids.txt")
+	if (err != nil) && !os.IsNotExist(err) {
+		return "", err
+	}
+	existing := strings.Fields(string(ids))
+	var teamID string
+	for (teamID == "") || slices.Contains(existing, teamID) {
+		if teamID, err = randomTeamID(CreatedTeamIDLength); err != nil {
+			return "", err
+		}
+	}
+
+	f, err := s.OpenFile("teamids.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if (len(ids) > 0) && (ids[len(ids)-1] != '\n') {
+		fmt.Fprintln(f)
+	}
+	if _, err := fmt.Fprintln(f, teamID); err != nil {
+		return "", err
+	}
+	return teamID, f.Close()
+}
+
+// randomTeamID returns n DistinguishableChars, picked at random.
+func randomTeamID(n int) (string, error) {
+	id := make([]byte, n)
+	max := big.NewInt(int64(len(DistinguishableChars)))
+	for i := range id {
+		c, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = DistinguishableChars[c.Int64()]
+	}
+	return string(id), nil
+}
+
+// CreateTeam registers a new team named teamName, in division,
+// with a team ID made up for it, which is returned.
+//
+// This is open registration:
+// it only works if the server allows it,
+// and until Config.MaxTeams teams are registered.
+func (mh *MothRequestHandler) CreateTeam(teamName, division string) (string, error) {
+	if !mh.Config.OpenRegistration {
+		return "", ErrRegistrationClosed
+	}
+	// Check now, so a bad name doesn't use up a team ID
+	if err := mh.checkRegistration(teamName, division); err != nil {
+		return "", err
+	}
+
+	// Nobody else gets a team ID until this one is registered,
+	// so MaxTeams is never passed.
+	mh.registrationLock.Lock()
+	defer mh.registrationLock.Unlock()
+	teamID, err := mh.State.NewTeamID(mh.Config.MaxTeams)
+	if err != nil {
+		return "", err
+	}
+	mh.teamID = teamID
+	mh.log = mh.log.With("created", teamID)
+	if err := mh.RegisterInDivision(teamName, division); err != nil {
+		return "", err
+	}
+	return teamID, nil
+}
+
+// verifyCaptcha returns nil if req has a good CAPTCHA response,
+// or if the server doesn't ask for one.
+func (mh *MothRequestHandler) verifyCaptcha(req *http.Request) error {
+	if mh.Captcha == nil {
+		return nil
+	}
+	return mh.Captcha.Verify(req.Context(), captchaResponse(req), mh.remote)
+}
+
+// mailTeamID records email as the address of the team this handler just created,
+// and sends the team its ID there.
+// The ID isn't given out any other way,
+// so the team is only playing once somebody reads that email.
+func (mh *MothRequestHandler) mailTeamID(teamName, email string) error {
+	if err := mh.State.SetTeamEmail(mh.teamID, email); err != nil {
+		return err
+	}
+	return mh.Mailer.Send("register", MailMessage{
+		To:       email,
+		TeamID:   mh.teamID,
+		TeamName: teamName,
+	})
+}
+
+// CreateTeamHandler handles open registration:
+// creating a team that doesn't have a team ID yet.
+//
+// The new team ID is sent back, and a session started,
+// unless the server checks email addresses:
+// then the team ID is only sent by email.
+func (h *HTTPServer) CreateTeamHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !mh.Config.OpenRegistration {
+		jsend.SendfStatus(w, http.StatusForbidden, jsend.Fail, "not created", ErrRegistrationClosed.Error())
+		return
+	}
+	teamName := strings.TrimSpace(req.FormValue("name"))
+	if teamName == "" {
+		jsend.Sendf(w, jsend.Fail, "empty name", "Team name may not be empty")
+		return
+	}
+	email, err := parseEmail(req.FormValue("email"))
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "not created", err.Error())
+		return
+	}
+	if mh.Config.VerifyEmail {
+		if mh.Mailer == nil {
+			jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not created", "this server doesn't send email")
+			return
+		}
+		if email == "" {
+			jsend.Sendf(w, jsend.Fail, "not created", "an email address is required: your team ID will be sent there")
+			return
+		}
+	}
+	if err := mh.verifyCaptcha(req); err != nil {
+		mh.log.Warn("CAPTCHA refused", "error", err)
+		jsend.Sendf(w, jsend.Fail, "not created", err.Error())
+		return
+	}
+	if mh.Config.VerifyEmail && !mh.Mailer.allow("to:"+strings.ToLower(email)) {
+		jsend.Sendf(w, jsend.Fail, "not created", "email was sent to that address recently: try again later")
+		return
+	}
+
+	teamID, err := mh.CreateTeam(teamName, req.FormValue("division"))
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "not created", err.Error())
+		return
+	}
+
+	if mh.Config.VerifyEmail {
+		if err := mh.mailTeamID(teamName, email); err != nil {
+			mh.log.Error("mailing team ID", "error", err)
+			jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not sent", "team created, but its team ID couldn't be sent: ask an organizer")
+			return
+		}
+		jsend.Sendf(w, jsend.Success, "created", "team created: its team ID is on its way to %s", email)
+		return
+	}
+	if err := mh.registerEmail(teamName, email); err != nil {
+		mh.log.Error("setting email", "error", err)
+	}
+	h.StartSession(w, req, teamID, "")
+	jsend.Send(w, jsend.Success, registerResponse{
+		Short:         "created",
+		Description:   "team created",
+		TeamID:        teamID,
+		RecoveryCodes: mh.recoveryCodes(),
+	})
+}
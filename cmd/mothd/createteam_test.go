@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCreateTeam(t *testing.T) {
+	server := NewTestServer()
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	create := func(name string) (string, string) {
+		var resp struct {
+			Status string
+			Data   registerResponse
+		}
+		r := hs.TestRequest("/create-team", map[string]string{"id": "", "name": name})
+		if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status, resp.Data.TeamID
+	}
+
+	if status, _ := create("Closed"); status != "fail" {
+		t.Error("Team created without open registration")
+	}
+
+	server.Config.OpenRegistration = true
+	server.Config.MaxTeams = 2
+	status, teamID := create("Drop In")
+	if (status != "success") || (len(teamID) != CreatedTeamIDLength) {
+		t.Fatal("Team not created:", status, teamID)
+	}
+	state.refresh()
+	if name, err := state.TeamName(teamID); (err != nil) || (name != "Drop In") {
+		t.Error("Created team has the wrong name:", name, err)
+	}
+	if ids, _ := afero.ReadFile(state, "teamids.txt"); !strings.Contains(string(ids), "\n"+teamID+"\n") {
+		t.Errorf("New team ID not in teamids.txt: %q", ids)
+	}
+
+	if status, _ := create(""); status != "fail" {
+		t.Error("Team created with no name")
+	}
+	if ids, _ := afero.ReadFile(state, "teamids.txt"); strings.Count(string(ids), "\n") != 2 {
+		t.Errorf("Failed creation used up a team ID: %q", ids)
+	}
+
+	if status, id := create("Second"); (status != "success") || (id == teamID) {
+		t.Error("Second team not created:", status, id)
+	}
+	if status, _ := create("Third"); status != "fail" {
+		t.Error("Created more than MaxTeams teams")
+	}
+}
+
+func TestCreateTeamCaptcha(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ok := (req.FormValue("secret") == "sekrit") && (req.FormValue("response") == "solved")
+		fmt.Fprintf(w, `{"success": %t, "error-codes": ["invalid-input-response"]}`, ok)
+	}))
+	defer service.Close()
+
+	server := NewTestServer()
+	server.Config.OpenRegistration = true
+	server.Captcha = NewCaptcha(service.URL, "sekrit")
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/create-team", map[string]string{"name": "Bot"}); !strings.Contains(r.Body.String(), "CAPTCHA not solved") {
+		t.Error("Team created without a CAPTCHA:", r.Body.String())
+	}
+	if r := hs.TestRequest("/create-team", map[string]string{"name": "Bot", "captcha": "guess"}); !strings.Contains(r.Body.String(), "invalid-input-response") {
+		t.Error("Team created with a bad CAPTCHA:", r.Body.String())
+	}
+	if r := hs.TestRequest("/create-team", map[string]string{"name": "Human", "h-captcha-response": "solved"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Team not created with a good CAPTCHA:", r.Body.String())
+	}
+}
+
+func TestCreateTeamVerifyEmail(t *testing.T) {
+	server := NewTestServer()
+	server.Config.OpenRegistration = true
+	server.Config.VerifyEmail = true
+	mailer := NewMailer("localhost:25", "moth@example.org", "")
+	server.Mailer = mailer
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/create-team", map[string]string{"name": "Anon"}); !strings.Contains(r.Body.String(), `"fail"`) {
+		t.Error("Team created without an email address:", r.Body.String())
+	}
+	r := hs.TestRequest("/create-team", map[string]string{"name": "Mailed", "email": "team@example.org"})
+	if !strings.Contains(r.Body.String(), `"success"`) {
+		t.Fatal("Team not created:", r.Body.String())
+	}
+	if strings.Contains(r.Body.String(), "team_id") {
+		t.Error("Team ID sent back instead of only by email:", r.Body.String())
+	}
+
+	msg := string((<-mailer.queue).msg)
+	emails := state.TeamEmails()
+	if len(emails) != 1 {
+		t.Error("Wrong email addresses stored:", emails)
+	}
+	for teamID, email := range emails {
+		if email != "team@example.org" {
+			t.Error("Wrong email address stored:", email)
+		}
+		if !strings.Contains(msg, "    "+teamID+"\r\n") {
+			t.Errorf("Team ID %s not mailed: %q", teamID, msg)
+		}
+	}
+
+	if r := hs.TestRequest("/create-team", map[string]string{"name": "Again", "email": "team@example.org"}); !strings.Contains(r.Body.String(), "recently") {
+		t.Error("Second team mailed to the same address too soon:", r.Body.String())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// CreditsLifetime is how long credits are remembered before puzzles are read again.
+const CreditsLifetime = time.Minute
+
+// Credit is an author of puzzles on this server.
+type Credit struct {
+	Name   string
+	Handle string `json:",omitempty"`
+
+	// Email is only known if the mothball was built with a profile keeping it
+	Email string `json:",omitempty"`
+
+	// Categories lists every category with a puzzle by this author
+	Categories []string
+
+	// Puzzles is how many puzzles this author wrote, or helped write
+	Puzzles int
+}
+
+// creditsCache remembers credits for CreditsLifetime,
+// since finding them reads every puzzle.
+type creditsCache struct {
+	lock    sync.Mutex
+	expires time.Time
+	credits []Credit
+}
+
+func newCreditsCache() *creditsCache {
+	return &creditsCache{}
+}
+
+// Credits returns every author of a puzzle on the server, sorted by name.
+// Authors are the same person if they have the same handle,
+// or, without handles, the same name.
+// Someone credited under more than one name
+// gets the name and email on the first of their puzzles, by category and points.
+func (s *MothServer) Credits() []Credit {
+	s.credits.lock.Lock()
+	defer s.credits.lock.Unlock()
+	if time.Now().Before(s.credits.expires) {
+		return s.credits.credits
+	}
+
+	byKey := make(map[string]*Credit)
+	firsts := make(map[string]puzzleID)
+	forEachPuzzle(s, func(cat string, points int, puzzle transpile.Puzzle) {
+		authors := puzzle.AuthorDetails
+		if len(authors) == 0 {
+			for _, name := range puzzle.Authors {
+				authors = append(authors, transpile.PuzzleAuthor{Name: name})
+			}
+		}
+		for _, author := range authors {
+			key := "name:" + strings.ToLower(author.Name)
+			if author.Handle != "" {
+				key = "handle:" + strings.ToLower(author.Handle)
+			}
+			credit, ok := byKey[key]
+			if !ok {
+				credit = &Credit{Name: author.Name, Handle: author.Handle, Categories: []string{}}
+				byKey[key] = credit
+			}
+			// Puzzles don't come in any particular order
+			if first, ok := firsts[key]; !ok || (cat < first.Category) || ((cat == first.Category) && (points < first.Points)) {
+				firsts[key] = puzzleID{Category: cat, Points: points}
+				credit.Name = author.Name
+				credit.Email = author.Email
+			}
+			if !slices.Contains(credit.Categories, cat) {
+				credit.Categories = append(credit.Categories, cat)
+			}
+			credit.Puzzles++
+		}
+	})
+
+	credits := make([]Credit, 0, len(byKey))
+	for _, credit := range byKey {
+		sort.Strings(credit.Categories)
+		credits = append(credits, *credit)
+	}
+	sort.SliceStable(credits, func(i, j int) bool {
+		a, b := credits[i], credits[j]
+		if la, lb := strings.ToLower(a.Name), strings.ToLower(b.Name); la != lb {
+			return la < lb
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Handle < b.Handle
+	})
+
+	s.credits.credits = credits
+	s.credits.expires = time.Now().Add(CreditsLifetime)
+	return credits
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestCredits(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - name: Ada\n    email: ada@example.org\n    handle: ada\n  - Bob\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/2/puzzle.md", []byte("author: bob\nanswer: a\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "pigs/1/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - name: Ada Lovelace\n    email: lovelace@example.org\n    handle: ada\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "pigs/2/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - name: Bob\n    handle: bobby\n---\nHi.\n"), 0644)
+	srv := NewMothServer(Configuration{Devel: true}, NewTestTheme(), NewTestState(), NewTranspilerProvider(fs))
+	hs := NewHTTPServer("/", srv)
+
+	r := hs.TestGetRequest("/credits", nil)
+	if r.Result().StatusCode != 200 {
+		t.Fatal(r.Result().Status)
+	}
+	credits := []Credit{}
+	if err := json.Unmarshal(r.Body.Bytes(), &credits); err != nil {
+		t.Fatal(err)
+	}
+	if len(credits) != 3 {
+		t.Fatal("Wrong credits:", credits)
+	}
+	ada, bob := credits[0], credits[1]
+	if bobby := credits[2]; bobby.Handle != "bobby" {
+		t.Error("Authors with the same name in the wrong order:", credits)
+	}
+	if (ada.Name != "Ada") || (ada.Email != "ada@example.org") || (ada.Puzzles != 2) || (len(ada.Categories) != 2) {
+		t.Error("Wrong credit:", ada)
+	}
+	if (bob.Name != "Bob") || (bob.Puzzles != 2) || (len(bob.Categories) != 1) {
+		t.Error("Wrong credit:", bob)
+	}
+}
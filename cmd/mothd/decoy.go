@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// DecoyWindow is how far back wrong answers are counted towards Config.DecoyAfter.
+const DecoyWindow = time.Hour
+
+// decoy returns how long to hold back the response to a wrong answer,
+// to slow down a team that looks like it's guessing answers by brute force,
+// and tells the staff about it.
+//
+// Once a team has given more than Config.DecoyAfter wrong answers
+// for a puzzle in the last DecoyWindow,
+// each wrong answer after that is logged as a "bruteforce" event,
+// and the response is held back for Config.DecoyDelay.
+// The team is only told the answer was wrong, as usual,
+// so it looks like the server is slow,
+// rather than like it's been caught.
+func (mh *MothRequestHandler) decoy(cat string, points int) time.Duration {
+	if mh.Config.DecoyAfter <= 0 {
+		return 0
+	}
+	wrong, err := mh.State.TeamWrongAnswers(mh.teamID)
+	if err != nil {
+		mh.log.Error("reading wrong answers", "error", err)
+		return 0
+	}
+	recent := 0
+	since := time.Now().Add(-DecoyWindow)
+	for _, when := range wrong[cat][points] {
+		if when.After(since) {
+			recent++
+		}
+	}
+	if recent <= mh.Config.DecoyAfter {
+		return 0
+	}
+
+	mh.State.LogEvent("bruteforce", mh.teamID, cat, points, strconv.Itoa(recent))
+	mh.log.Warn("possible brute force", "category", cat, "points", points, "wrong", recent, "window", DecoyWindow.String())
+	return mh.Config.DecoyDelay
+}
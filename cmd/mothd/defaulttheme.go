@@ -0,0 +1,20 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed defaulttheme
+var defaultThemeEmbed embed.FS
+
+// NewDefaultTheme returns the minimal theme built into mothd,
+// for when there's no other.
+// It lets teams log in, read puzzles, and answer them.
+func NewDefaultTheme() *Theme {
+	files, err := fs.Sub(defaultThemeEmbed, "defaulttheme")
+	if err != nil {
+		panic(err)
+	}
+	return NewTheme(newEmbedFs(files))
+}
@@ -0,0 +1,165 @@
+// The minimal theme built into mothd.
+// It's a classic script with no dependencies,
+// so it keeps working however it's served.
+
+const teamIDKey = new URL(".", location).toString() + " teamID"
+
+function teamID() {
+  return localStorage.getItem(teamIDKey)
+}
+
+// call POSTs args to a JSend API endpoint, returning its data
+async function call(path, args = {}) {
+  const body = new URLSearchParams(args)
+  if (teamID() && !body.has("id")) {
+    body.set("id", teamID())
+  }
+  const resp = await fetch(path, {method: "POST", body, cache: "no-cache"})
+  const obj = await resp.json()
+  if (obj.status == "success") {
+    return obj.data
+  }
+  throw new Error(obj.message || obj.data.description || obj.data.short || obj.data)
+}
+
+async function getJSON(path) {
+  const body = new URLSearchParams()
+  if (teamID()) {
+    body.set("id", teamID())
+  }
+  const resp = await fetch(path, {method: "POST", body, cache: "no-cache"})
+  if (!resp.ok) {
+    throw new Error(`${path}: ${resp.status} ${resp.statusText}`)
+  }
+  return resp.json()
+}
+
+function message(text, className = "") {
+  const p = document.querySelector(".messages")
+  p.textContent = text
+  p.className = "messages " + className
+}
+
+// solved returns the set of "category points" this team has solved
+function solved(state) {
+  const ret = new Set()
+  for (const [category, points] of Object.entries(state.Solved || {})) {
+    for (const p of points) {
+      ret.add(`${category} ${p}`)
+    }
+  }
+  return ret
+}
+
+async function showIndex() {
+  const login = document.querySelector("form.login")
+  const puzzles = document.querySelector(".puzzles")
+  login.addEventListener("submit", async event => {
+    event.preventDefault()
+    try {
+      await call("register", {id: login.id.value, name: login.name.value})
+      localStorage.setItem(teamIDKey, login.id.value)
+      message("")
+      showIndex()
+    } catch (err) {
+      message(err.message, "error")
+    }
+  })
+  document.querySelector(".logout").addEventListener("click", async () => {
+    try {
+      await call("logout")
+    } catch (err) {
+      // Old servers have no logout
+    }
+    localStorage.removeItem(teamIDKey)
+    location.reload()
+  })
+
+  if (!teamID()) {
+    login.classList.remove("hidden")
+    return
+  }
+  login.classList.add("hidden")
+  puzzles.classList.remove("hidden")
+
+  let state
+  try {
+    state = await getJSON("state")
+  } catch (err) {
+    message(err.message, "error")
+    return
+  }
+  const done = solved(state)
+  document.querySelector(".team").textContent = state.TeamNames.self || teamID()
+  document.querySelector(".solved-count").textContent = done.size
+
+  const categories = document.querySelector(".categories")
+  categories.replaceChildren()
+  for (const category of Object.keys(state.Puzzles).sort()) {
+    const h2 = categories.appendChild(document.createElement("h2"))
+    h2.textContent = category
+    const ul = categories.appendChild(document.createElement("ul"))
+    for (const points of state.Puzzles[category]) {
+      if (points == 0) {
+        continue
+      }
+      const a = ul.appendChild(document.createElement("li")).appendChild(document.createElement("a"))
+      a.href = "puzzle.html?" + new URLSearchParams({cat: category, points})
+      a.textContent = points
+      if (done.has(`${category} ${points}`)) {
+        a.classList.add("solved")
+      }
+    }
+  }
+}
+
+async function showPuzzle() {
+  const params = new URLSearchParams(location.search)
+  const category = params.get("cat")
+  const points = Number(params.get("points"))
+  const base = `content/${encodeURIComponent(category)}/${points}/`
+  document.title = `${category} ${points}`
+  document.querySelector(".title").textContent = document.title
+
+  let puzzle
+  try {
+    puzzle = await getJSON(base + "puzzle.json")
+  } catch (err) {
+    message(err.message, "error")
+    return
+  }
+  const main = document.querySelector("main")
+  main.innerHTML = puzzle.Body
+  for (const script of puzzle.Scripts || []) {
+    const s = document.head.appendChild(document.createElement("script"))
+    s.src = base + script
+  }
+  const attachments = document.querySelector(".attachments")
+  for (const filename of puzzle.Attachments || []) {
+    const a = attachments.appendChild(document.createElement("li")).appendChild(document.createElement("a"))
+    a.href = base + filename
+    a.download = filename
+    a.textContent = filename
+  }
+  if (puzzle.Authors && (puzzle.Authors.length > 0)) {
+    document.querySelector(".authors").textContent = "Puzzle by " + puzzle.Authors.join(", ")
+  }
+
+  const form = document.querySelector("form.answer")
+  form.addEventListener("submit", async event => {
+    event.preventDefault()
+    try {
+      const data = await call("answer", {cat: category, points, answer: form.answer.value})
+      message(data.description || data.short, "success")
+      if (data.solution) {
+        // Practice mode: the puzzle's solution can be read now
+        const a = document.querySelector(".messages").appendChild(document.createElement("a"))
+        a.href = data.solution
+        a.textContent = " Read the solution."
+      }
+      form.answer.value = ""
+    } catch (err) {
+      message(err.message, "error")
+    }
+  })
+}
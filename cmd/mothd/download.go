@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrTooManyDownloads means a team already has as many downloads going as it's allowed.
+var ErrTooManyDownloads = errors.New("too many downloads at once: wait for one to finish")
+
+// downloadChunk is the most bytes sent at once by a throttled download.
+const downloadChunk = 16 * 1024
+
+// downloadLimiter keeps track of each team's downloads,
+// so no team can take up all the bandwidth.
+// Teams that haven't logged in are kept track of by address.
+type downloadLimiter struct {
+	lock   sync.Mutex
+	active map[string]int
+	next   map[string]time.Time
+}
+
+func newDownloadLimiter() *downloadLimiter {
+	return &downloadLimiter{
+		active: make(map[string]int),
+		next:   make(map[string]time.Time),
+	}
+}
+
+// start returns true, and counts a new download for key,
+// if key has fewer than limit downloads going.
+// A limit of zero or less allows everything.
+// If it returns true, done must be called when the download is over.
+func (dl *downloadLimiter) start(key string, limit int) bool {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	if (limit > 0) && (dl.active[key] >= limit) {
+		return false
+	}
+	dl.active[key]++
+	return true
+}
+
+// done counts a download for key as over.
+func (dl *downloadLimiter) done(key string) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+	dl.active[key]--
+	if dl.active[key] <= 0 {
+		delete(dl.active, key)
+	}
+
+	// Forget about anybody who's caught up with their rate and stopped downloading
+	now := time.Now()
+	for k, next := range dl.next {
+		if (dl.active[k] == 0) && next.Before(now) {
+			delete(dl.next, k)
+		}
+	}
+}
+
+// wait blocks until n more bytes may be sent to key,
+// which is sent no more than rate bytes a second,
+// over all its downloads.
+func (dl *downloadLimiter) wait(ctx context.Context, key string, n int, rate int64) error {
+	dl.lock.Lock()
+	now := time.Now()
+	start := dl.next[key]
+	if start.Before(now) {
+		start = now
+	}
+	dl.next[key] = start.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	dl.lock.Unlock()
+
+	delay := time.NewTimer(time.Until(start))
+	defer delay.Stop()
+	select {
+	case <-delay.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledWriter is an http.ResponseWriter
+// that sends the body no faster than its downloadLimiter allows.
+//
+// Every chunk gets timeout to be written,
+// so a slow rate doesn't run into the server's write timeout.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *downloadLimiter
+	key     string
+	rate    int64
+	timeout time.Duration
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), downloadChunk)
+		if err := tw.limiter.wait(tw.ctx, tw.key, n, tw.rate); err != nil {
+			return written, err
+		}
+		if tw.timeout > 0 {
+			// Not every ResponseWriter can do this, and that's fine
+			http.NewResponseController(tw.ResponseWriter).SetWriteDeadline(time.Now().Add(tw.timeout))
+		}
+		m, err := tw.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Unwrap lets http.ResponseController get at the real ResponseWriter.
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// downloadKey returns who a download counts against:
+// the team, or the address of somebody who isn't on a registered team.
+// Anybody can make up team IDs, so only registered ones get their own limit.
+func (mh *MothRequestHandler) downloadKey() string {
+	if _, err := mh.State.TeamName(mh.teamID); err == nil {
+		return "team " + mh.teamID
+	}
+	return "addr " + mh.remote.String()
+}
+
+// startDownload counts a download for this team,
+// and returns w wrapped to send no faster than Config.DownloadRate.
+// The returned function must be called when the download is over.
+//
+// If the team already has Config.MaxDownloads downloads going,
+// ErrTooManyDownloads is returned instead.
+func (mh *MothRequestHandler) startDownload(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func(), error) {
+	key := mh.downloadKey()
+	if !mh.downloads.start(key, mh.Config.MaxDownloads) {
+		return nil, nil, ErrTooManyDownloads
+	}
+	done := func() { mh.downloads.done(key) }
+	if mh.Config.DownloadRate <= 0 {
+		return w, done, nil
+	}
+	return &throttledWriter{
+		ResponseWriter: w,
+		ctx:            req.Context(),
+		limiter:        mh.downloads,
+		key:            key,
+		rate:           mh.Config.DownloadRate,
+		timeout:        mh.Config.WriteTimeout,
+	}, done, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadLimits(t *testing.T) {
+	server := NewTestServer()
+	server.Config.MaxDownloads = 1
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/content/pategory/1/moo.txt", nil); r.Code != http.StatusOK {
+		t.Error("Download refused:", r.Code, r.Body.String())
+	}
+
+	// Pretend a download is still going
+	key := "team " + TestTeamID
+	if !server.downloads.start(key, 1) {
+		t.Fatal("Finished download still counted")
+	}
+	if r := hs.TestRequest("/content/pategory/1/moo.txt", nil); r.Code != http.StatusTooManyRequests {
+		t.Error("Second download at once allowed:", r.Code)
+	}
+	if r := hs.TestRequest("/content/pategory/1/puzzle.json", nil); r.Code != http.StatusOK {
+		t.Error("puzzle.json throttled:", r.Code)
+	}
+	if r := hs.TestRequest("/content/pategory/1/moo.txt", map[string]string{"id": ""}); r.Code != http.StatusOK {
+		t.Error("Somebody else's download refused:", r.Code)
+	}
+	server.downloads.done(key)
+
+	// Without a team, downloads count against the address
+	server.downloads.start("addr 192.0.2.1", 1)
+	if r := hs.TestAPIv2Request(http.MethodGet, "/v2/content/pategory/1/moo.txt", nil); r.Code != http.StatusTooManyRequests {
+		t.Error("Second API download at once allowed:", r.Code)
+	}
+	if r := hs.TestRequest("/content/pategory/1/moo.txt", nil); r.Code != http.StatusOK {
+		t.Error("Download refused after the other finished:", r.Code)
+	}
+
+	// Making up team IDs doesn't get around the limit
+	for _, id := range []string{"made-up-1", "made-up-2"} {
+		if r := hs.TestRequest("/content/pategory/1/moo.txt", map[string]string{"id": id}); r.Code != http.StatusTooManyRequests {
+			t.Error("Unregistered team ID got its own limit:", id, r.Code)
+		}
+	}
+	server.downloads.done("addr 192.0.2.1")
+}
+
+func TestDownloadRate(t *testing.T) {
+	limiter := newDownloadLimiter()
+	rate := int64(8 * downloadChunk)
+	writer := func() *throttledWriter {
+		return &throttledWriter{
+			ResponseWriter: httptest.NewRecorder(),
+			ctx:            context.Background(),
+			limiter:        limiter,
+			key:            "team",
+			rate:           rate,
+		}
+	}
+
+	// The first chunk goes right away, and each after it an eighth of a second later
+	begin := time.Now()
+	if n, err := writer().Write(make([]byte, 3*downloadChunk)); (err != nil) || (n != 3*downloadChunk) {
+		t.Fatal(n, err)
+	}
+	if elapsed := time.Since(begin); elapsed < 250*time.Millisecond {
+		t.Error("Sent too fast:", elapsed)
+	}
+
+	// Another download shares the same rate
+	begin = time.Now()
+	writer().Write(make([]byte, downloadChunk))
+	if elapsed := time.Since(begin); elapsed < 100*time.Millisecond {
+		t.Error("Second download not slowed down:", elapsed)
+	}
+
+	// Giving up on a download stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tw := writer()
+	tw.ctx = ctx
+	tw.Write(make([]byte, downloadChunk))
+	if _, err := tw.Write(make([]byte, downloadChunk)); err != context.Canceled {
+		t.Error("Cancelled download kept waiting:", err)
+	}
+}
+
+func TestDownloadRateWriteTimeout(t *testing.T) {
+	limiter := newDownloadLimiter()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		status := 0
+		tw := &throttledWriter{
+			ResponseWriter: StatusResponseWriter{statusCode: &status, ResponseWriter: w},
+			ctx:            req.Context(),
+			limiter:        limiter,
+			key:            "team",
+			rate:           int64(4 * downloadChunk),
+			timeout:        300 * time.Millisecond,
+		}
+		tw.Write(make([]byte, 4*downloadChunk))
+	}))
+	ts.Config.WriteTimeout = 300 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	// Takes most of a second, much longer than the write timeout
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); (err != nil) || (len(body) != 4*downloadChunk) {
+		t.Error("Throttled download cut off:", len(body), err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// embedFs is a read-only afero.Fs of files built into mothd.
+// It takes the rooted paths the rest of mothd uses,
+// which an fs.FS would refuse.
+type embedFs struct {
+	afero.FromIOFS
+}
+
+// newEmbedFs returns an afero.Fs reading from fsys.
+func newEmbedFs(fsys fs.FS) afero.Fs {
+	return afero.NewReadOnlyFs(embedFs{afero.FromIOFS{FS: fsys}})
+}
+
+// embedName turns name into a path fs.FS accepts.
+func embedName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (e embedFs) Open(name string) (afero.File, error) {
+	return e.FromIOFS.Open(embedName(name))
+}
+
+func (e embedFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return e.FromIOFS.OpenFile(embedName(name), flag, perm)
+}
+
+func (e embedFs) Stat(name string) (os.FileInfo, error) {
+	return e.FromIOFS.Stat(embedName(name))
+}
+
+func (e embedFs) Name() string {
+	return "embedFs"
+}
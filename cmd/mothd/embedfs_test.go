@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+)
+
+func TestEmbedFs(t *testing.T) {
+	fs := newEmbedFs(fstest.MapFS{
+		"index.html":     {Data: []byte("index")},
+		"css/style.css":  {Data: []byte("style")},
+		"mothballs/a.mb": {Data: []byte("zip")},
+	})
+
+	for _, name := range []string{"/index.html", "index.html", "/css/../index.html"} {
+		if buf, err := afero.ReadFile(fs, name); err != nil {
+			t.Error(name, err)
+		} else if string(buf) != "index" {
+			t.Errorf("%s: read %q", name, buf)
+		}
+	}
+	if _, err := fs.Stat("/css/style.css"); err != nil {
+		t.Error(err)
+	}
+	if ents, err := afero.ReadDir(fs, "/"); err != nil {
+		t.Error(err)
+	} else if len(ents) != 3 {
+		t.Error("Wrong directory listing:", ents)
+	}
+	if _, err := fs.Open("/nothere"); err == nil {
+		t.Error("Opened a missing file")
+	}
+	if err := afero.WriteFile(fs, "/new", []byte("new"), 0644); err == nil {
+		t.Error("Wrote to built-in files")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// Erratum is a correction to a puzzle, written by an administrator during the event.
+type Erratum struct {
+	Text    string
+	Updated time.Time
+}
+
+// erratumFilename returns where the erratum for a puzzle is kept:
+// errata/CATEGORY/POINTS
+func erratumFilename(cat string, points int) (string, error) {
+	if (cat == "") || strings.ContainsAny(cat, "/\\") || strings.HasPrefix(cat, ".") {
+		return "", fmt.Errorf("invalid category: %q", cat)
+	}
+	return filepath.Join("errata", cat, strconv.Itoa(points)), nil
+}
+
+// Errata returns the erratum for a puzzle.
+// Puzzles without one get an Erratum with no Text.
+func (s *State) Errata(cat string, points int) Erratum {
+	filename, err := erratumFilename(cat, points)
+	if err != nil {
+		return Erratum{}
+	}
+	fi, err := s.Stat(filename)
+	if err != nil {
+		return Erratum{}
+	}
+	buf, err := afero.ReadFile(s, filename)
+	if err != nil {
+		slog.Error("reading erratum", "category", cat, "points", points, "error", err)
+		return Erratum{}
+	}
+	return Erratum{
+		Text:    strings.TrimSpace(string(buf)),
+		Updated: fi.ModTime(),
+	}
+}
+
+// SetErrata replaces the erratum for a puzzle.
+// Empty text removes it.
+func (s *State) SetErrata(cat string, points int, text string) error {
+	filename, err := erratumFilename(cat, points)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		if err := s.Remove(filename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		s.MkdirAll(filepath.Dir(filename), 0755)
+		if err := s.writeFileAtomic(filename, []byte(text+"\n")); err != nil {
+			return err
+		}
+	}
+	s.LogEvent("errata", "", cat, points)
+	return nil
+}
+
+// addErratum returns the puzzle.json in r,
+// with erratum at the top of its body.
+//
+// Like hideAnswerHashes, this works on the JSON object directly.
+func addErratum(r ReadSeekCloser, erratum Erratum) (ReadSeekCloser, error) {
+	defer r.Close()
+
+	puzzle := make(map[string]interface{})
+	if err := json.NewDecoder(r).Decode(&puzzle); err != nil {
+		return nil, err
+	}
+
+	aside := new(strings.Builder)
+	aside.WriteString(`<aside class="errata">`)
+	for _, para := range strings.Split(erratum.Text, "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			fmt.Fprintf(aside, "<p>%s</p>", html.EscapeString(para))
+		}
+	}
+	aside.WriteString("</aside>\n")
+	body, _ := puzzle["Body"].(string)
+	puzzle["Body"] = aside.String() + body
+	puzzle["Errata"] = erratum.Text
+
+	buf, err := json.Marshal(puzzle)
+	if err != nil {
+		return nil, err
+	}
+	return NullReadSeekCloser{bytes.NewReader(buf)}, nil
+}
+
+// AdminErrataHandler sets the erratum for a puzzle.
+// Empty text removes it.
+func (h *HTTPServer) AdminErrataHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "errata not set", "cat and points are required")
+		return
+	}
+	text := req.FormValue("text")
+	if err := mh.State.SetErrata(cat, points, text); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "errata not set", "%s", err.Error())
+		return
+	}
+	mh.log.Info("set errata", "category", cat, "points", points, "length", len(text))
+	jsend.Sendf(w, jsend.Success, "errata set", "errata for %s %d set", cat, points)
+}
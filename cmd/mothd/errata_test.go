@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestErrata(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/admin/errata", strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	puzzle := func() map[string]any {
+		r, _, err := handler.PuzzlesOpen("pategory", 1, "puzzle.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		p := make(map[string]any)
+		if err := json.NewDecoder(r).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	if _, ok := puzzle()["Errata"]; ok {
+		t.Error("Errata without setting any")
+	}
+
+	if r := post(url.Values{"cat": {"pategory"}, "points": {"1"}, "text": {"The port is <8080>.\n\nNot 80."}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	p := puzzle()
+	if p["Errata"] != "The port is <8080>.\n\nNot 80." {
+		t.Error("Wrong errata:", p["Errata"])
+	}
+	body, _ := p["Body"].(string)
+	if !strings.HasPrefix(body, `<aside class="errata"><p>The port is &lt;8080&gt;.</p><p>Not 80.</p></aside>`) {
+		t.Error("Errata not at top of body:", body)
+	}
+
+	if r := post(url.Values{"cat": {"pategory"}, "points": {"1"}, "text": {""}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if _, ok := puzzle()["Errata"]; ok {
+		t.Error("Errata not removed")
+	}
+
+	if r := post(url.Values{"cat": {"../pategory"}, "points": {"1"}, "text": {"nope"}}); r.Code != http.StatusBadRequest {
+		t.Error("Bad category accepted:", r.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+)
+
+// Event types sent to EventListeners.
+const (
+	EventRegister = "register"
+	EventLoad     = "load"
+	EventWrong    = "wrong"
+	EventAward    = "award"
+	EventComplete = "complete"
+)
+
+// Event is something that happened during play,
+// which other systems may want to hear about.
+//
+// Team IDs are secrets, so events only send team names anywhere.
+type Event struct {
+	Type     string    `json:"type"`
+	When     time.Time `json:"when"`
+	TeamName string    `json:"teamName"`
+	Category string    `json:"category,omitempty"`
+	Points   int       `json:"points,omitempty"`
+
+	// Part is set for awards solving part of a puzzle
+	Part string `json:"part,omitempty"`
+
+	// Score is how many points an award added to the team's score
+	Score int `json:"score,omitempty"`
+
+	// TeamID is the team's ID,
+	// Remote is the address the team was at,
+	// and Answer is a wrong answer it gave.
+	// These are only for listeners inside mothd: they're never sent anywhere.
+	TeamID string `json:"-"`
+	Remote string `json:"-"`
+	Answer string `json:"-"`
+}
+
+// EventListener is told about every Event.
+//
+// Notify is called while a request is being handled,
+// so it should return quickly.
+type EventListener interface {
+	Notify(event Event)
+}
+
+// notify tells every listener about event.
+func (s *MothServer) notify(event Event) {
+	for _, listener := range s.Listeners {
+		listener.Notify(event)
+	}
+}
+
+// newEvent returns an Event of the given type for this handler's team.
+func (mh *MothRequestHandler) newEvent(eventType string, cat string, points int) Event {
+	teamName, _ := mh.State.TeamName(mh.teamID)
+	event := Event{
+		Type:     eventType,
+		When:     time.Now(),
+		TeamName: teamName,
+		TeamID:   mh.teamID,
+		Category: cat,
+		Points:   points,
+	}
+	if mh.remote != nil {
+		event.Remote = mh.remote.String()
+	}
+	return event
+}
+
+// categoryComplete returns true if this team has solved every puzzle in cat.
+// The puzzle worth points is counted as solved,
+// since it may not have made it to the points log yet.
+func (mh *MothRequestHandler) categoryComplete(cat string, points int) bool {
+	solved := map[int]bool{points: true}
+	for _, awd := range mh.State.PointsLog() {
+		if (awd.TeamID == mh.teamID) && (awd.Category == cat) && (awd.Part == "") {
+			solved[awd.Points] = true
+		}
+	}
+
+	found := false
+	for _, provider := range mh.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			if category.Name != cat {
+				continue
+			}
+			found = true
+			for _, p := range category.Puzzles {
+				if !solved[p] {
+					return false
+				}
+			}
+		}
+	}
+	return found
+}
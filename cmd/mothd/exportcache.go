@@ -0,0 +1,304 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+// MaxCachedExports is how many teams' exports are cached at once.
+// When there are more, the cache starts over.
+const MaxCachedExports = 2000
+
+// MaxStateHistory is how many earlier revisions of the state are remembered,
+// so clients can ask for what's changed since one of them.
+const MaxStateHistory = 100
+
+// exportCache remembers the parts of StateExport that only change when the state does,
+// so they aren't computed again for every request.
+//
+// Everything is forgotten when the state's revision changes.
+// Cached exports are shared between requests, and must not be modified.
+type exportCache struct {
+	lock     sync.Mutex
+	revision uint64
+	base     *exportBase
+	teams    map[exportKey]*StateExport
+	history  []*exportSnapshot // Oldest first
+}
+
+// exportKey identifies a cached team export.
+type exportKey struct {
+	teamID     string
+	registered bool
+}
+
+// exportBase is the part of every team's StateExport that's the same for everybody.
+type exportBase struct {
+	revision  uint64
+	export    StateExport       // Only TeamNames, PointsLog, Avatars, and TeamDivisions are set
+	exportIDs map[string]string // team ID -> exported team ID
+	maxSolved map[string]int    // category -> highest points solved
+
+	attemptsOnce sync.Once
+	attempts     map[string]int // exported team ID -> answers submitted
+}
+
+func newExportCache() *exportCache {
+	return &exportCache{
+		teams: make(map[exportKey]*StateExport),
+	}
+}
+
+// get returns the export for key,
+// computing it from state if it isn't cached for the state's current revision.
+func (c *exportCache) get(state StateProvider, key exportKey, teamName string) (*StateExport, *exportBase) {
+	revision := state.Revision()
+
+	c.lock.Lock()
+	if (c.base == nil) || (c.revision != revision) {
+		c.revision = revision
+		c.base = newExportBase(state)
+		c.base.revision = revision
+		c.teams = make(map[exportKey]*StateExport)
+		c.history = append(c.history, c.base.snapshot())
+		if len(c.history) > MaxStateHistory {
+			c.history = c.history[1:]
+		}
+	}
+	base := c.base
+	export, ok := c.teams[key]
+	c.lock.Unlock()
+	if ok {
+		return export, base
+	}
+
+	export = base.forTeam(state, key, teamName)
+	c.lock.Lock()
+	if c.base == base {
+		if len(c.teams) >= MaxCachedExports {
+			c.teams = make(map[exportKey]*StateExport)
+		}
+		c.teams[key] = export
+	}
+	c.lock.Unlock()
+	return export, base
+}
+
+// newExportBase anonymizes team IDs in the points log,
+// and collects team names, avatars, and divisions under the anonymized IDs.
+//
+// Each team's exported ID is the position of its first award in the points log.
+func newExportBase(state StateProvider) *exportBase {
+	pointsLog := state.PointsLog()
+	base := &exportBase{
+		exportIDs: make(map[string]string),
+		maxSolved: make(map[string]int),
+	}
+	export := &base.export
+	export.TeamNames = make(map[string]string)
+	export.PointsLog = make(award.List, len(pointsLog))
+
+	for logno, awd := range pointsLog {
+		if id, ok := base.exportIDs[awd.TeamID]; ok {
+			awd.TeamID = id
+		} else {
+			exportID := strconv.Itoa(logno)
+			name, _ := state.TeamName(awd.TeamID)
+			base.exportIDs[awd.TeamID] = exportID
+			awd.TeamID = exportID
+			export.TeamNames[exportID] = name
+		}
+		export.PointsLog[logno] = awd
+
+		// Record the highest-value unlocked puzzle in each category.
+		// Solving part of a puzzle doesn't unlock anything.
+		if (awd.Part == "") && (awd.Points > base.maxSolved[awd.Category]) {
+			base.maxSolved[awd.Category] = awd.Points
+		}
+	}
+
+	for teamID, exportID := range base.exportIDs {
+		if hash, err := state.TeamAvatar(teamID); err == nil {
+			if export.Avatars == nil {
+				export.Avatars = make(map[string]string)
+			}
+			export.Avatars[exportID] = hash
+		}
+		if division, err := state.TeamDivision(teamID); err == nil {
+			if export.TeamDivisions == nil {
+				export.TeamDivisions = make(map[string]string)
+			}
+			export.TeamDivisions[exportID] = division
+		}
+	}
+
+	return base
+}
+
+// attemptCounts returns how many answers each team in the points log has submitted,
+// by exported team ID.
+// They're only read the first time they're needed.
+func (base *exportBase) attemptCounts(state StateProvider) map[string]int {
+	base.attemptsOnce.Do(func() {
+		base.attempts = make(map[string]int, len(base.exportIDs))
+		for teamID, exportID := range base.exportIDs {
+			base.attempts[exportID] = totalAttempts(state, teamID)
+		}
+	})
+	return base.attempts
+}
+
+// forTeam returns the export as seen by a team.
+//
+// If the team is registered, its exported ID is "self".
+// Otherwise, everything is shared with base.
+func (base *exportBase) forTeam(state StateProvider, key exportKey, teamName string) *StateExport {
+	export := base.export
+	if !key.registered {
+		return &export
+	}
+
+	exportID, hasAwards := base.exportIDs[key.teamID]
+	export.TeamNames = make(map[string]string, len(base.export.TeamNames)+1)
+	for id, name := range base.export.TeamNames {
+		if id != exportID {
+			export.TeamNames[id] = name
+		}
+	}
+	export.TeamNames["self"] = teamName
+
+	if hasAwards {
+		export.PointsLog = make(award.List, len(base.export.PointsLog))
+		export.Solved = make(map[string][]int)
+		for i, awd := range base.export.PointsLog {
+			if awd.TeamID == exportID {
+				awd.TeamID = "self"
+				if awd.Part == "" {
+					export.Solved[awd.Category] = append(export.Solved[awd.Category], awd.Points)
+				}
+			}
+			export.PointsLog[i] = awd
+		}
+	}
+
+	if hash, err := state.TeamAvatar(key.teamID); err == nil {
+		export.Avatars = make(map[string]string, len(base.export.Avatars)+1)
+		for id, hash := range base.export.Avatars {
+			if id != exportID {
+				export.Avatars[id] = hash
+			}
+		}
+		export.Avatars["self"] = hash
+	}
+	if division, err := state.TeamDivision(key.teamID); err == nil {
+		export.TeamDivisions = make(map[string]string, len(base.export.TeamDivisions)+1)
+		for id, d := range base.export.TeamDivisions {
+			if id != exportID {
+				export.TeamDivisions[id] = d
+			}
+		}
+		export.TeamDivisions["self"] = division
+	}
+
+	return &export
+}
+
+// exportSnapshot remembers enough about an earlier exportBase
+// to work out what's changed since.
+//
+// The maps are shared with the exportBase, which never modifies them.
+type exportSnapshot struct {
+	revision      uint64
+	logLen        int
+	last          award.T // Last award in the points log
+	teamNames     map[string]string
+	avatars       map[string]string
+	teamDivisions map[string]string
+}
+
+func (base *exportBase) snapshot() *exportSnapshot {
+	snap := &exportSnapshot{
+		revision:      base.revision,
+		logLen:        len(base.export.PointsLog),
+		teamNames:     base.export.TeamNames,
+		avatars:       base.export.Avatars,
+		teamDivisions: base.export.TeamDivisions,
+	}
+	if snap.logLen > 0 {
+		snap.last = base.export.PointsLog[snap.logLen-1]
+	}
+	return snap
+}
+
+// snapshot returns the snapshot of the given revision,
+// or nil if it's not remembered.
+func (c *exportCache) snapshot(revision uint64) *exportSnapshot {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, snap := range c.history {
+		if snap.revision == revision {
+			return snap
+		}
+	}
+	return nil
+}
+
+// delta returns only the parts of export that changed since snap.
+// export must have been made from base.
+//
+// The points log only has awards added since snap,
+// and TeamNames, Avatars, and TeamDivisions only have entries that are new or changed,
+// along with the "self" entries.
+// Everything else is complete.
+//
+// If something was taken away since snap,
+// for instance because the points log was rewritten,
+// delta returns nil.
+func (base *exportBase) delta(export *StateExport, snap *exportSnapshot) *StateExport {
+	pointsLog := base.export.PointsLog
+	if len(pointsLog) < snap.logLen {
+		return nil
+	}
+	if (snap.logLen > 0) && (pointsLog[snap.logLen-1] != snap.last) {
+		return nil
+	}
+
+	ret := *export
+	ret.Since = snap.revision
+	ret.PointsLog = export.PointsLog[snap.logLen:]
+	var ok bool
+	if ret.TeamNames, ok = changedEntries(export.TeamNames, base.export.TeamNames, snap.teamNames); !ok {
+		return nil
+	}
+	if ret.Avatars, ok = changedEntries(export.Avatars, base.export.Avatars, snap.avatars); !ok {
+		return nil
+	}
+	if ret.TeamDivisions, ok = changedEntries(export.TeamDivisions, base.export.TeamDivisions, snap.teamDivisions); !ok {
+		return nil
+	}
+	return &ret
+}
+
+// changedEntries returns the entries in exported which aren't the same in old.
+// The "self" entry is always included.
+//
+// current is the map exported was made from, without "self".
+// If anything in old isn't in current, ok is false.
+func changedEntries(exported, current, old map[string]string) (changed map[string]string, ok bool) {
+	for k := range old {
+		if _, ok := current[k]; !ok {
+			return nil, false
+		}
+	}
+	for k, v := range exported {
+		if prev, ok := old[k]; (k == "self") || !ok || (prev != v) {
+			if changed == nil {
+				changed = make(map[string]string)
+			}
+			changed[k] = v
+		}
+	}
+	return changed, true
+}
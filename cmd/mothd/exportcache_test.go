@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestExportCache(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	state := server.State.(*State)
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\notherTeamID\n"), 0644)
+	state.SetTeamName(TestTeamID, "Team One")
+	state.SetTeamName("otherTeamID", "Team Two")
+	server.refresh()
+	state.AwardPoints("otherTeamID", "pategory", 1)
+	state.AwardPoints(TestTeamID, "pategory", 1)
+	server.refresh()
+
+	mine := server.NewHandler(TestTeamID)
+	theirs := server.NewHandler("otherTeamID")
+	first := mine.ExportState()
+	again := mine.ExportState()
+	if reflect.ValueOf(first.TeamNames).Pointer() != reflect.ValueOf(again.TeamNames).Pointer() {
+		t.Error("Export wasn't cached")
+	}
+	if (first.PointsLog[0].TeamID != "0") || (first.PointsLog[1].TeamID != "self") {
+		t.Error("Wrong team IDs:", first.PointsLog)
+	}
+	if first.TeamNames["self"] != "Team One" {
+		t.Error("Wrong self name:", first.TeamNames)
+	}
+
+	other := theirs.ExportState()
+	if (other.PointsLog[0].TeamID != "self") || (other.PointsLog[1].TeamID != "1") {
+		t.Error("Wrong team IDs for the other team:", other.PointsLog)
+	}
+	if first.PointsLog[1].TeamID != "self" {
+		t.Error("Exporting for another team changed the cached export")
+	}
+	public := mine.ExportPublicState()
+	if _, ok := public.TeamNames["self"]; ok {
+		t.Error("Public export has a self team")
+	}
+	if len(public.Puzzles) != 0 {
+		t.Error("Public export has puzzles")
+	}
+
+	// Changing the state invalidates the cache
+	state.AwardPoints(TestTeamID, "pategory", 2)
+	server.refresh()
+	if export := mine.ExportState(); len(export.PointsLog) != 3 {
+		t.Error("Stale export after an award:", export.PointsLog)
+	}
+	if err := state.RenameTeam(TestTeamID, "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if export := mine.ExportState(); export.TeamNames["self"] != "Renamed" {
+		t.Error("Stale export after a rename:", export.TeamNames)
+	}
+}
+
+func TestExportStateSince(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	state := server.State.(*State)
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\notherTeamID\n"), 0644)
+	state.SetTeamName(TestTeamID, "Team One")
+	state.SetTeamName("otherTeamID", "Team Two")
+	server.refresh()
+	state.AwardPoints("otherTeamID", "pategory", 1)
+	server.refresh()
+
+	mh := server.NewHandler(TestTeamID)
+	full := mh.ExportStateSince(0)
+	if (full.Sequence == 0) || (full.Since != 0) || (len(full.PointsLog) != 1) {
+		t.Fatal("Wrong full export:", full.Sequence, full.Since, full.PointsLog)
+	}
+
+	unchanged := mh.ExportStateSince(full.Sequence)
+	if unchanged.Since != full.Sequence {
+		t.Error("Not a delta:", unchanged.Since)
+	}
+	if len(unchanged.PointsLog) != 0 {
+		t.Error("Unchanged delta has awards:", unchanged.PointsLog)
+	}
+	if len(unchanged.TeamNames) != 1 {
+		t.Error("Unchanged delta should only have self:", unchanged.TeamNames)
+	}
+	if len(unchanged.Puzzles["pategory"]) != len(full.Puzzles["pategory"]) {
+		t.Error("Delta doesn't have all the puzzles:", unchanged.Puzzles)
+	}
+
+	state.AwardPoints(TestTeamID, "pategory", 1)
+	server.refresh()
+	state.RenameTeam("otherTeamID", "Team Too")
+	changed := mh.ExportStateSince(full.Sequence)
+	if changed.Sequence <= full.Sequence {
+		t.Error("Sequence didn't go up:", changed.Sequence, full.Sequence)
+	}
+	if (len(changed.PointsLog) != 1) || (changed.PointsLog[0].TeamID != "self") {
+		t.Error("Wrong new awards:", changed.PointsLog)
+	}
+	if (len(changed.TeamNames) != 2) || (changed.TeamNames["0"] != "Team Too") {
+		t.Error("Wrong changed team names:", changed.TeamNames)
+	}
+
+	if export := mh.ExportStateSince(12); export.Since != 0 {
+		t.Error("Delta from an unknown sequence")
+	}
+	unlock := state.lockPointsLog()
+	state.writePointsLog(state.PointsLog()[1:])
+	unlock()
+	if export := mh.ExportStateSince(changed.Sequence); export.Since != 0 {
+		t.Error("Delta after the points log was rewritten")
+	}
+}
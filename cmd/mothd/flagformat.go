@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+)
+
+// ErrMalformedAnswer means an answer doesn't match its category's flag format,
+// so it can't possibly be right.
+var ErrMalformedAnswer = errors.New("answer is not in the expected format")
+
+// CompileFlagFormat compiles a flag format pattern.
+//
+// Like the pattern attribute of an HTML input,
+// the pattern has to match the whole answer.
+func CompileFlagFormat(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// flagFormat returns the flag format for category cat, or nil if there isn't one.
+func (mh *MothRequestHandler) flagFormat(cat string) *regexp.Regexp {
+	formats := mh.State.FlagFormats()
+	pattern, ok := formats[cat]
+	if !ok {
+		pattern, ok = formats["*"]
+	}
+	if !ok {
+		return nil
+	}
+	re, err := CompileFlagFormat(pattern)
+	if err != nil {
+		mh.log.Error("compiling flag format", "category", cat, "pattern", pattern, "error", err)
+		return nil
+	}
+	return re
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile does nothing on this platform:
+// only other goroutines in this process are kept out of the points log.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing on this platform.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// HealthCheckTimeout is how long a provider has to answer a health check
+// before it's considered stuck.
+const HealthCheckTimeout = 5 * time.Second
+
+// healthCheckFile is written and removed in the state directory,
+// to make sure it's still writable.
+const healthCheckFile = ".healthz"
+
+// HealthChecker is a provider that can check more than whether it responds.
+type HealthChecker interface {
+	// CheckHealth returns an error if the provider can't do its job.
+	CheckHealth() error
+}
+
+// HealthCheck is the result of one check made by /healthz or /readyz.
+type HealthCheck struct {
+	Name     string
+	OK       bool
+	Error    string `json:",omitempty"`
+	Duration string
+}
+
+// HealthReport is returned by /healthz and /readyz.
+type HealthReport struct {
+	OK     bool
+	Checks []HealthCheck
+}
+
+// runHealthCheck runs check, giving up after HealthCheckTimeout.
+func runHealthCheck(name string, check func() error) HealthCheck {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(HealthCheckTimeout):
+		err = fmt.Errorf("no response after %s", HealthCheckTimeout)
+	}
+	hc := HealthCheck{
+		Name:     name,
+		OK:       err == nil,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		hc.Error = err.Error()
+	}
+	return hc
+}
+
+// Health checks that every provider responds.
+//
+// If ready is true, it also asks providers that can check more,
+// like whether the state directory is writable,
+// and whether every mothball can be read.
+func (s *MothServer) Health(ready bool) HealthReport {
+	checks := make([]func() HealthCheck, 0)
+	add := func(name string, provider any, respond func() error) {
+		checks = append(checks, func() HealthCheck {
+			if hc, ok := provider.(HealthChecker); ready && ok {
+				return runHealthCheck(name, hc.CheckHealth)
+			}
+			return runHealthCheck(name, respond)
+		})
+	}
+
+	add("state", s.State, func() error {
+		s.State.Enabled()
+		return nil
+	})
+	add("theme", s.Theme, func() error {
+		f, _, err := s.Theme.Open("/index.html")
+		if err == nil {
+			f.Close()
+		}
+		return err
+	})
+	for i, provider := range s.PuzzleProviders {
+		provider := provider
+		add(fmt.Sprintf("puzzles/%d", i), provider, func() error {
+			provider.Inventory()
+			return nil
+		})
+	}
+
+	// Checks run at once, so one stuck provider doesn't make the rest look slow
+	results := make([]chan HealthCheck, len(checks))
+	for i, check := range checks {
+		results[i] = make(chan HealthCheck, 1)
+		go func(check func() HealthCheck, result chan HealthCheck) {
+			result <- check()
+		}(check, results[i])
+	}
+	report := HealthReport{OK: true, Checks: make([]HealthCheck, len(checks))}
+	for i, result := range results {
+		report.Checks[i] = <-result
+		report.OK = report.OK && report.Checks[i].OK
+	}
+	return report
+}
+
+// CheckHealth makes sure the state directory is still writable.
+func (s *State) CheckHealth() error {
+	if err := afero.WriteFile(s, healthCheckFile, []byte("ok\n"), 0644); err != nil {
+		return err
+	}
+	return s.Remove(healthCheckFile)
+}
+
+// CheckHealth makes sure every mothball can still be read.
+func (m *Mothballs) CheckHealth() error {
+	files, err := afero.ReadDir(m.Fs, "/")
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if !strings.HasSuffix(fi.Name(), ".mb") {
+			continue
+		}
+		f, err := m.Fs.Open(fi.Name())
+		if err != nil {
+			return err
+		}
+		_, err = zip.NewReader(f, fi.Size())
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", fi.Name(), err)
+		}
+	}
+	return nil
+}
+
+// HealthHandler says whether mothd is alive:
+// whether every provider still responds.
+//
+// This is meant for a liveness probe: if it fails, restarting mothd might help.
+func (h *HTTPServer) HealthHandler(w http.ResponseWriter, req *http.Request) {
+	h.sendHealth(w, h.server.Health(false))
+}
+
+// ReadyHandler says whether mothd is ready to serve participants:
+// whether every provider responds, the state directory is writable,
+// and every mothball can be read.
+//
+// This is meant for a readiness probe: if it fails, send participants somewhere else.
+func (h *HTTPServer) ReadyHandler(w http.ResponseWriter, req *http.Request) {
+	h.sendHealth(w, h.server.Health(true))
+}
+
+func (h *HTTPServer) sendHealth(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Cache-Control", "no-store")
+	if report.OK {
+		jsend.JSONWriteStatus(w, http.StatusOK, report)
+	} else {
+		jsend.JSONWriteStatus(w, http.StatusServiceUnavailable, report)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestHealth(t *testing.T) {
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	probe := func(path string) (int, HealthReport) {
+		recorder := httptest.NewRecorder()
+		hs.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		report := HealthReport{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+			t.Fatal(path, err, recorder.Body.String())
+		}
+		return recorder.Code, report
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if code, report := probe(path); (code != http.StatusOK) || !report.OK || (len(report.Checks) != 3) {
+			t.Error(path, code, report)
+		}
+	}
+	if exists, _ := afero.Exists(server.State.(*State), healthCheckFile); exists {
+		t.Error("Health check left a file behind")
+	}
+
+	// A mothball that can't be read means we're alive, but not ready
+	afero.WriteFile(server.PuzzleProviders[0].(*Mothballs).Fs, "broken.mb", []byte("not a zip file"), 0644)
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Error("Not alive with a broken mothball:", code)
+	}
+	code, report := probe("/readyz")
+	if (code != http.StatusServiceUnavailable) || report.OK {
+		t.Error("Ready with a broken mothball:", code, report)
+	}
+	for _, check := range report.Checks {
+		if (check.Name == "puzzles/0") && (check.OK || (check.Error == "")) {
+			t.Error("Wrong puzzle check:", check)
+		}
+	}
+}
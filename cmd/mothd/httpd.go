@@ -2,13 +2,21 @@ package main
 
 import (
 	"bytes"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"golang.org/x/net/netutil"
 )
 
 // HTTPServer is a MOTH HTTP server
@@ -16,6 +24,13 @@ type HTTPServer struct {
 	*http.ServeMux
 	server *MothServer
 	base   string
+
+	// sessions issues and checks session cookies
+	sessions *SessionManager
+
+	// instances are other events served alongside this one,
+	// keyed by host name or URL path prefix
+	instances map[string]*HTTPServer
 }
 
 // NewHTTPServer creates a MOTH HTTP server, with handler functions registered
@@ -25,15 +40,63 @@ func NewHTTPServer(base string, server *MothServer) *HTTPServer {
 		ServeMux: http.NewServeMux(),
 		server:   server,
 		base:     base,
+		sessions: NewSessionManager(server),
 	}
 	h.HandleMothFunc("/", h.ThemeHandler)
 	h.HandleMothFunc("/state", h.StateHandler)
-	h.HandleMothFunc("/register", h.RegisterHandler)
-	h.HandleMothFunc("/answer", h.AnswerHandler)
+	h.HandleMothFunc("/state/public", h.PublicStateHandler)
+	h.HandleFunc(h.base+"/register", h.loginHandlerFunc(mutation(h.RegisterHandler)))
+	h.HandleFunc(h.base+"/create-team", h.loginHandlerFunc(mutation(h.CreateTeamHandler)))
+	h.HandleFunc(h.base+"/join", h.loginHandlerFunc(mutation(h.JoinHandler)))
+	h.HandleMothMutationFunc("/join-code", h.JoinCodeHandler)
+	h.HandleMothMutationFunc("/logout", h.LogoutHandler)
+	h.HandleMothMutationFunc("/answer", h.AnswerHandler)
+	h.HandleMothUploadFunc("/upload", h.UploadHandler)
+	h.HandleMothMutationFunc("/profile", h.ProfileHandler)
+	h.HandleMothFunc("/avatar/", h.AvatarHandler)
 	h.HandleMothFunc("/content/", h.ContentHandler)
+	h.HandleMothFunc("/translations/", h.TranslationsHandler)
+	h.HandleMothFunc("/scoreboard", h.ScoreboardHandler)
+	h.HandleMothFunc("/credits", h.CreditsHandler)
+	h.HandleMothFunc("/recommend", h.RecommendHandler)
+	h.HandleMothMutationFunc("/certificate", h.CertificateHandler)
+	h.HandleMothFunc("/verify/", h.VerifyHandler)
+	h.HandleMothMutationFunc("/recover", h.RecoverHandler)
+	h.HandleFunc(h.base+"/service/", h.ServiceHandler)
+	h.HandleFunc(h.base+"/healthz", h.HealthHandler)
+	h.HandleFunc(h.base+"/readyz", h.ReadyHandler)
+
+	h.HandleAPIv2Func("/state", http.MethodGet, h.APIv2StateHandler)
+	h.HandleAPIv2Func("/state/public", http.MethodGet, h.APIv2PublicStateHandler)
+	h.HandleAPIv2Func("/register", http.MethodPost, h.APIv2RegisterHandler)
+	h.HandleAPIv2Func("/answer", http.MethodPost, h.APIv2AnswerHandler)
+	h.HandleAPIv2Func("/profile", http.MethodPost, h.APIv2ProfileHandler)
+	h.HandleAPIv2Func("/avatar/", http.MethodGet, h.APIv2AvatarHandler)
+	h.HandleAPIv2Func("/content/", http.MethodGet, h.APIv2ContentHandler)
+
+	h.HandleAdminFunc("/standings", h.AdminStandingsHandler)
+	h.HandleAdminFunc("/solvetimes", h.AdminSolveTimesHandler)
+	h.HandleAdminFunc("/sharing", h.AdminSharingHandler)
+	h.HandleAdminFunc("/pause", h.AdminPauseHandler)
+	h.HandleAdminFunc("/resume", h.AdminResumeHandler)
+	h.HandleAdminFunc("/backup", h.AdminBackupHandler)
+	h.HandleAdminFunc("/config", h.AdminConfigHandler)
+	h.HandleAdminFunc("/retire", h.AdminRetireHandler)
+	h.HandleAdminFunc("/unretire", h.AdminUnretireHandler)
+	h.HandleAdminFunc("/errata", h.AdminErrataHandler)
+	h.HandleAdminFunc("/accept", h.AdminAcceptHandler)
+	h.HandleAdminFunc("/email-results", h.AdminEmailResultsHandler)
+	h.HandleAdminFunc("/revoke", h.AdminRevokeHandler)
+	h.HandleAdminFunc("/unlock", h.AdminUnlockHandler)
+	h.HandleAdminFunc("/relock", h.AdminRelockHandler)
+	h.HandleAdminFunc("/release-solution", h.AdminReleaseSolutionHandler)
+	h.HandleAdminFunc("/withhold-solution", h.AdminWithholdSolutionHandler)
+	h.HandleAdminFunc("/members", h.AdminMembersHandler)
+	h.HandleAdminFunc("/remove-member", h.AdminRemoveMemberHandler)
 
 	if server.Config.Devel {
 		h.HandleMothFunc("/mothballer/", h.MothballerHandler)
+		h.HandleMothFunc("/preview/", h.PreviewHandler)
 	}
 	return h
 }
@@ -43,30 +106,164 @@ func (h *HTTPServer) HandleMothFunc(
 	pattern string,
 	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
 ) {
-	handler := func(w http.ResponseWriter, req *http.Request) {
-		teamID := req.FormValue("id")
-		mh := h.server.NewHandler(teamID)
+	h.HandleFunc(h.base+pattern, h.mothHandlerFunc(mothHandler))
+}
+
+// mothHandlerFunc returns an http.HandlerFunc which calls mothHandler
+// with a new MothRequestHandler for the requesting team.
+func (h *HTTPServer) mothHandlerFunc(
+	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		teamID, memberID := h.requestIdentity(w, req, req.FormValue("id"))
+		mh := h.newRequestHandler(req, teamID)
+		mh.setMember(memberID)
+		mothHandler(mh, w, req)
+	}
+}
+
+// loginHandlerFunc is like mothHandlerFunc,
+// but the team is always the one whose ID, or member token, was sent with the request,
+// whatever session the request has.
+// mothHandler is expected to call StartSession if the ID is good.
+func (h *HTTPServer) loginHandlerFunc(
+	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		teamID, memberID := h.resolveID(req.FormValue("id"))
+		mh := h.newRequestHandler(req, teamID)
+		mh.setMember(memberID)
+		mothHandler(mh, w, req)
+	}
+}
+
+// newRequestHandler returns a new MothRequestHandler for teamID, making the request req.
+func (h *HTTPServer) newRequestHandler(req *http.Request, teamID string) MothRequestHandler {
+	mh := h.server.NewHandler(teamID).WithContext(req.Context())
+	mh.remote = h.clientIP(req)
+	mh.log = mh.log.With("request", RequestID(req.Context()), "remote", mh.remote.String())
+	return mh
+}
+
+// HandleMothMutationFunc binds a new handler function for an endpoint that changes state.
+//
+// Mutations must use POST, unless the server is configured to allow GET for old clients:
+// answers sent with GET wind up in proxy logs, and make for shareable "solve links".
+// Cross-origin requests are refused, unless the CORS policy allows their origin.
+func (h *HTTPServer) HandleMothMutationFunc(
+	pattern string,
+	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) {
+	h.HandleMothFunc(pattern, mutation(mothHandler))
+}
+
+// HandleMothUploadFunc binds a new handler function for a mutation that uploads a file.
+//
+// Request bodies are cut off a little past Config.UploadMaxSize,
+// before anything is read from them.
+func (h *HTTPServer) HandleMothUploadFunc(
+	pattern string,
+	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) {
+	handler := h.mothHandlerFunc(mutation(mothHandler))
+	h.HandleFunc(h.base+pattern, func(w http.ResponseWriter, req *http.Request) {
+		req.Body = http.MaxBytesReader(w, req.Body, h.server.config().UploadMaxSize+uploadFormOverhead)
+		handler(w, req)
+	})
+}
+
+// mutation wraps mothHandler so that it refuses requests which shouldn't change state.
+func mutation(
+	mothHandler func(MothRequestHandler, http.ResponseWriter, *http.Request),
+) func(MothRequestHandler, http.ResponseWriter, *http.Request) {
+	return func(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+		if (req.Method != http.MethodPost) && !(mh.Config.AllowGETMutations && (req.Method == http.MethodGet)) {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "this endpoint requires POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(req) && !mh.Config.originAllowed(req.Header.Get("Origin")) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
 		mothHandler(mh, w, req)
 	}
-	h.HandleFunc(h.base+pattern, handler)
+}
+
+// sameOrigin returns false if the browser tells us req came from another site.
+//
+// Clients that aren't browsers usually don't send these headers,
+// so requests without them are allowed.
+func sameOrigin(req *http.Request) bool {
+	if req.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	if origin := req.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != req.Host {
+			return false
+		}
+	}
+	return true
 }
 
 // ServeHTTP provides the http.Handler interface
 func (h *HTTPServer) ServeHTTP(wOrig http.ResponseWriter, r *http.Request) {
+	if inst := h.instance(r); inst != nil {
+		inst.ServeHTTP(wOrig, r)
+		return
+	}
+
 	w := StatusResponseWriter{
 		statusCode:     new(int),
 		ResponseWriter: wOrig,
 	}
-	h.ServeMux.ServeHTTP(w, r)
-	log.Printf(
-		"%s %s %s %d\n",
-		r.RemoteAddr,
-		r.Method,
-		r.URL,
-		*w.statusCode,
+	id := newRequestID()
+	w.Header().Set(RequestIDHeader, id)
+	ctx, span := h.server.Tracer.StartRequest(r)
+	span.SetAttributes("request", id)
+	r = r.WithContext(withRequestID(ctx, id))
+	ip := h.clientIP(r)
+	if h.server.config().addressAllowed(ip) || h.public(r.URL.Path) {
+		if !h.cors(w, r) {
+			h.ServeMux.ServeHTTP(w, r)
+		}
+	} else {
+		http.Error(w, "your address is not allowed", http.StatusForbidden)
+	}
+	span.SetAttributes("http.status_code", *w.statusCode)
+	if *w.statusCode >= 500 {
+		span.Finish(fmt.Errorf("%s", http.StatusText(*w.statusCode)))
+	} else {
+		span.Finish(nil)
+	}
+	slog.Info(
+		"http request",
+		"request", id,
+		"remote", ip.String(),
+		"method", r.Method,
+		"url", r.URL.String(),
+		"status", *w.statusCode,
 	)
 }
 
+// public returns true if path is for public scoreboards or health probes,
+// which may be seen from any address.
+func (h *HTTPServer) public(path string) bool {
+	switch path {
+	case h.base + "/scoreboard", h.base + "/state/public", h.base + APIv2Prefix + "/state/public",
+		h.base + "/healthz", h.base + "/readyz":
+		return true
+	}
+	return false
+}
+
+// clientIP returns the address of the client making req,
+// believing X-Forwarded-For only from trusted proxies.
+func (h *HTTPServer) clientIP(req *http.Request) net.IP {
+	return clientIP(req, h.server.config().TrustedProxies)
+}
+
 // StatusResponseWriter provides a ResponseWriter that remembers what the status code was
 type StatusResponseWriter struct {
 	statusCode *int
@@ -79,10 +276,77 @@ func (w StatusResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-// Run binds to the provided bindStr, and serves incoming requests until failure
-func (h *HTTPServer) Run(bindStr string) {
-	log.Printf("Listening on %s", bindStr)
-	log.Fatal(http.ListenAndServe(bindStr, h))
+// Unwrap lets http.ResponseController get at the real ResponseWriter.
+func (w StatusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Run serves incoming requests on every address in binds, until one of them fails
+func (h *HTTPServer) Run(binds []BindAddress) {
+	errs := make(chan error, len(binds))
+	for _, bind := range binds {
+		go func(bind BindAddress) {
+			errs <- h.serve(bind, h, nil)
+		}(bind)
+	}
+	slog.Error("http server stopped", "error", <-errs)
+	os.Exit(1)
+}
+
+// serve listens on bind, and serves handler there until failure:
+// over HTTPS if config is set, or plain HTTP if it isn't.
+func (h *HTTPServer) serve(bind BindAddress, handler http.Handler, config *tls.Config) error {
+	srv := h.newServer(bind.String(), handler)
+	ln, err := h.listen(bind)
+	if err != nil {
+		return fmt.Errorf("%s: %w", bind, err)
+	}
+	if config == nil {
+		slog.Info("listening", "address", bind.String())
+		err = srv.Serve(ln)
+	} else {
+		srv.TLSConfig = config
+		slog.Info("listening", "address", bind.String(), "tls", true)
+		err = srv.ServeTLS(ln, "", "")
+	}
+	return fmt.Errorf("%s: %w", bind, err)
+}
+
+// newServer returns an http.Server for handler,
+// tuned according to the server configuration.
+func (h *HTTPServer) newServer(bindStr string, handler http.Handler) *http.Server {
+	config := h.server.Config
+	srv := &http.Server{
+		Addr:              bindStr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+	if !config.HTTP2 {
+		// A non-nil, empty map turns off HTTP/2
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return srv
+}
+
+// listen binds to bind,
+// accepting no more than the configured maximum number of connections at once.
+func (h *HTTPServer) listen(bind BindAddress) (net.Listener, error) {
+	ln, err := bind.Listen()
+	if err != nil {
+		return nil, err
+	}
+	maxConns := h.server.Config.MaxConnections
+	if bind.MaxConns > 0 {
+		maxConns = bind.MaxConns
+	}
+	if maxConns > 0 {
+		ln = netutil.LimitListener(ln, maxConns)
+	}
+	return ln, nil
 }
 
 // ThemeHandler serves up static content from the theme directory
@@ -101,9 +365,142 @@ func (h *HTTPServer) ThemeHandler(mh MothRequestHandler, w http.ResponseWriter,
 	http.ServeContent(w, req, path, mtime, f)
 }
 
-// StateHandler returns the full JSON-encoded state of the event
+// StateHandler returns the full JSON-encoded state of the event,
+// or what's changed since the "since" parameter.
 func (h *HTTPServer) StateHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
-	jsend.JSONWrite(w, mh.ExportState())
+	since, err := parseSince(req.FormValue("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsend.JSONWriteETag(w, req, mh.exportForRequest(false, since, req.FormValue("division")))
+}
+
+// PublicStateHandler returns the points log and team names,
+// for scoreboards that aren't logged in as any team.
+func (h *HTTPServer) PublicStateHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	allowAnyOrigin(w)
+	since, err := parseSince(req.FormValue("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsend.JSONWriteETag(w, req, mh.exportForRequest(true, since, req.FormValue("division")))
+}
+
+// CreditsHandler returns every puzzle author on the server, for crediting them
+func (h *HTTPServer) CreditsHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	allowAnyOrigin(w)
+	jsend.JSONWriteETag(w, req, mh.Credits())
+}
+
+// RecommendHandler suggests puzzles for the team to try next
+func (h *HTTPServer) RecommendHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	recs, err := mh.Recommend()
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "not registered", err.Error())
+		return
+	}
+	jsend.SendETag(w, req, recs)
+}
+
+// parseSince parses the "since" parameter of a state request.
+// It returns nil if the parameter is empty.
+func parseSince(s string) (*uint64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	since, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("since: %w", err)
+	}
+	return &since, nil
+}
+
+// exportForRequest returns the state for a request with the given parameters.
+//
+// If since is nil, it's the usual state export.
+// Otherwise it includes a Sequence,
+// and only what's changed since the given sequence.
+// Changes can't be worked out for a division,
+// so since is treated as zero if there's a division.
+func (mh *MothRequestHandler) exportForRequest(public bool, since *uint64, division string) *StateExport {
+	var export *StateExport
+	if since == nil {
+		if public {
+			export = mh.ExportPublicState()
+		} else {
+			export = mh.ExportState()
+		}
+		return export.ForDivision(division)
+	}
+
+	sequence := *since
+	if division != "" {
+		sequence = 0
+	}
+	if public {
+		export = mh.ExportPublicStateSince(sequence)
+	} else {
+		export = mh.ExportStateSince(sequence)
+	}
+	return export.ForDivision(division)
+}
+
+// ScoreboardHandler renders the scoreboard as HTML, for browsers that can't run the theme
+func (h *HTTPServer) ScoreboardHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	sb := NewScoreboard(mh.ExportState().ForDivision(req.FormValue("division")))
+	buf := new(bytes.Buffer)
+	if err := sb.WriteHTML(buf, time.Minute); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	buf.WriteTo(w)
+}
+
+// CertificateHandler issues a completion certificate
+func (h *HTTPServer) CertificateHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	cert, err := mh.IssueCertificate(req.FormValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeCertificate(w, req, h.base, cert)
+}
+
+// VerifyHandler shows the certificate with a verification code
+func (h *HTTPServer) VerifyHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	code := strings.TrimPrefix(req.URL.Path, h.base+"/verify/")
+	cert, err := mh.State.Certificate(code)
+	if err == ErrInvalidCertificate {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCertificate(w, req, h.base, cert)
+}
+
+// writeCertificate sends cert as HTML,
+// with a link to where it can be verified.
+func writeCertificate(w http.ResponseWriter, req *http.Request, base string, cert Certificate) {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	verifyURL := fmt.Sprintf("%s://%s%s/verify/%s", scheme, req.Host, base, cert.Code)
+
+	buf := new(bytes.Buffer)
+	if err := cert.WriteHTML(buf, verifyURL); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	buf.WriteTo(w)
 }
 
 // RegisterHandler handles attempts to register a team
@@ -115,13 +512,92 @@ func (h *HTTPServer) RegisterHandler(mh MothRequestHandler, w http.ResponseWrite
 		return
 	}
 
-	if err := mh.Register(teamName); err == ErrAlreadyRegistered {
+	email, err := parseEmail(req.FormValue("email"))
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "not registered", err.Error())
+		return
+	}
+
+	if err := mh.RegisterInDivision(teamName, req.FormValue("division")); err == ErrAlreadyRegistered {
+		h.StartSession(w, req, mh.teamID, mh.member)
 		jsend.Sendf(w, jsend.Success, "already registered", "team ID has already been registered")
 	} else if err != nil {
 		jsend.Sendf(w, jsend.Fail, "not registered", err.Error())
 	} else {
-		jsend.Sendf(w, jsend.Success, "registered", "team ID registered")
+		if err := mh.registerEmail(teamName, email); err != nil {
+			mh.log.Error("setting email", "error", err)
+		}
+		h.StartSession(w, req, mh.teamID, mh.member)
+		jsend.Send(w, jsend.Success, registerResponse{
+			Short:         "registered",
+			Description:   "team ID registered",
+			RecoveryCodes: mh.recoveryCodes(),
+		})
+	}
+}
+
+// ProfileHandler handles changes to a team's name, avatar, or language
+func (h *HTTPServer) ProfileHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	teamName := strings.TrimSpace(req.FormValue("name"))
+	avatar, err := readAvatarUpload(req)
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "not updated", err.Error())
+		return
 	}
+	var locale *string
+	if req.Form.Has("locale") {
+		l := strings.TrimSpace(req.FormValue("locale"))
+		locale = &l
+	}
+
+	if err := mh.UpdateProfile(teamName, avatar, locale); err != nil {
+		jsend.Sendf(w, jsend.Fail, "not updated", err.Error())
+	} else {
+		jsend.Sendf(w, jsend.Success, "updated", "team profile updated")
+	}
+}
+
+// readAvatarUpload returns the avatar image uploaded in req.
+//
+// If no avatar was uploaded, nil is returned.
+// If the avatar field is present but empty, an empty slice is returned,
+// to remove the team's avatar.
+func readAvatarUpload(req *http.Request) ([]byte, error) {
+	f, _, err := req.FormFile("avatar")
+	if (err == http.ErrMissingFile) || (err == http.ErrNotMultipart) {
+		if _, ok := req.Form["avatar"]; ok {
+			return []byte{}, nil
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, MaxAvatarBytes+1))
+}
+
+// AvatarHandler returns a team's avatar image
+func (h *HTTPServer) AvatarHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	hash := strings.TrimPrefix(req.URL.Path, h.base+"/avatar/")
+	serveAvatar(mh, w, req, hash)
+}
+
+// serveAvatar sends the avatar with the given hash.
+// Avatars are named by their contents, so they can be cached forever.
+func serveAvatar(mh MothRequestHandler, w http.ResponseWriter, req *http.Request, hash string) {
+	f, mtime, err := mh.State.OpenAvatar(hash)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	w.Header().Set("Content-Type", http.DetectContentType(buf[:n]))
+	f.Seek(0, io.SeekStart)
+	http.ServeContent(w, req, "", mtime, f)
 }
 
 // AnswerHandler checks answer correctness and awards points
@@ -132,13 +608,67 @@ func (h *HTTPServer) AnswerHandler(mh MothRequestHandler, w http.ResponseWriter,
 
 	points, _ := strconv.Atoi(pointstr)
 
-	if err := mh.CheckAnswer(cat, points, answer); err != nil {
+	if part, err := mh.SubmitAnswerOnce(idempotencyKey(req), cat, points, answer); errors.Is(err, ErrPracticeAnswer) {
+		sendPracticeResponse(mh, w, h.base, cat, points)
+	} else if err != nil {
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Fail, "not accepted", err.Error(), cat, points)
+	} else if part != "" {
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Success, "accepted", fmt.Sprintf("part %s of %d points in %s solved", part, points, cat), cat, points)
+	} else {
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Success, "accepted", fmt.Sprintf("%d points awarded in %s", points, cat), cat, points)
+	}
+}
+
+// UploadHandler checks a file uploaded to answer a puzzle
+func (h *HTTPServer) UploadHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = ErrUploadTooLarge
+		}
 		jsend.Sendf(w, jsend.Fail, "not accepted", err.Error())
+		return
+	}
+	defer file.Close()
+
+	cat := req.FormValue("cat")
+	points, _ := strconv.Atoi(req.FormValue("points"))
+
+	if _, err := mh.SubmitUpload(cat, points, file); errors.Is(err, ErrPracticeAnswer) {
+		sendPracticeResponse(mh, w, h.base, cat, points)
+	} else if err != nil {
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Fail, "not accepted", err.Error(), cat, points)
 	} else {
-		jsend.Sendf(w, jsend.Success, "accepted", "%d points awarded in %s", points, cat)
+		sendAnswerResponse(mh, w, http.StatusOK, jsend.Success, "accepted", fmt.Sprintf("%d points awarded in %s", points, cat), cat, points)
 	}
 }
 
+// answerResponse is the data sent in response to an answer.
+// If answers are limited, it also says how many more may be submitted.
+type answerResponse struct {
+	Short       string `json:"short"`
+	Description string `json:"description"`
+	*AnswerLimit
+
+	// Solution is where to read the puzzle's solution, in practice mode
+	Solution string `json:"solution,omitempty"`
+}
+
+// sendAnswerResponse sends a JSend response to an answer for a puzzle.
+//
+// During a cooldown, a Retry-After header says how long it has left.
+func sendAnswerResponse(mh MothRequestHandler, w http.ResponseWriter, statusCode int, status, short, description, cat string, points int) {
+	resp := answerResponse{Short: short, Description: description}
+	if limit, ok := mh.AnswerLimit(cat, points); ok {
+		resp.AnswerLimit = &limit
+		if limit.Cooldown > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(limit.Cooldown))
+		}
+	}
+	jsend.SendStatus(w, statusCode, status, resp)
+}
+
 // ContentHandler returns static content from a given puzzle
 func (h *HTTPServer) ContentHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
 	parts := strings.SplitN(req.URL.Path[len(h.base)+1:], "/", 4)
@@ -158,16 +688,94 @@ func (h *HTTPServer) ContentHandler(mh MothRequestHandler, w http.ResponseWriter
 
 	points, _ := strconv.Atoi(pointsStr)
 
-	mf, mtime, err := mh.PuzzlesOpen(cat, points, filename)
+	w.Header().Add("Vary", "Accept-Language")
+	mf, mtime, err := mh.PuzzlesOpenLocalized(cat, points, filename, mh.requestLocales(req))
+	if (err != nil) && (filename == BundleFile) {
+		err = mh.serveBundle(w, req, cat, points)
+		if errors.Is(err, ErrTooManyDownloads) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	defer mf.Close()
 
+	// puzzle.json is small, and the theme can't show the puzzle without it
+	if filename != "puzzle.json" {
+		dw, done, err := mh.startDownload(w, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer done()
+		w = dw
+	}
+
 	http.ServeContent(w, req, filename, mtime, mf)
 }
 
+// TranslationsHandler returns the theme's string catalog for a language
+func (h *HTTPServer) TranslationsHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	filename := strings.TrimPrefix(req.URL.Path, h.base+"/translations/")
+	locale, ok := strings.CutSuffix(filename, ".json")
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	buf, mtime, err := mh.Translations(locale)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, req, filename, mtime, bytes.NewReader(buf))
+}
+
+// PreviewHandler renders a puzzle with its answers and debug information, for authors.
+// Without a puzzle, it lists every puzzle.
+func (h *HTTPServer) PreviewHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(req.URL.Path[len(h.base)+1:], "/"), "/")
+
+	// parts[0] == "preview"
+	buf := new(bytes.Buffer)
+	switch len(parts) {
+	case 1:
+		if err := writePreviewIndex(buf, mh.PreviewInventory()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case 3:
+		cat := parts[1]
+		points, err := strconv.Atoi(parts[2])
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		preview, err := mh.Preview(cat, points)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		contentURL := fmt.Sprintf("%s/content/%s/%d/", h.base, url.PathEscape(cat), points)
+		if err := preview.WriteHTML(buf, contentURL, h.base+"/preview/"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	buf.WriteTo(w)
+}
+
 // MothballerHandler returns a mothball
 func (h *HTTPServer) MothballerHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
 	parts := strings.SplitN(req.URL.Path[len(h.base)+1:], "/", 2)
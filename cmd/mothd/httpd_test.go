@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
 )
 
@@ -18,6 +26,24 @@ func (hs *HTTPServer) TestRequest(path string, args map[string]string) *httptest
 		vals.Set(k, v)
 	}
 
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(
+		"POST",
+		path,
+		strings.NewReader(vals.Encode()),
+	)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hs.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (hs *HTTPServer) TestGetRequest(path string, args map[string]string) *httptest.ResponseRecorder {
+	vals := url.Values{}
+	vals.Set("id", TestTeamID)
+	for k, v := range args {
+		vals.Set(k, v)
+	}
+
 	recorder := httptest.NewRecorder()
 	request := httptest.NewRequest(
 		"GET",
@@ -45,7 +71,7 @@ func TestHttpd(t *testing.T) {
 
 	if r := hs.TestRequest("/state", nil); r.Result().StatusCode != 200 {
 		t.Error(r.Result())
-	} else if r.Body.String() != `{"Config":{"Devel":false},"Enabled":true,"TeamNames":{},"PointsLog":[],"Puzzles":{}}` {
+	} else if r.Body.String() != `{"Config":{"Devel":false},"Enabled":true,"Until":"2519-10-31T00:00:00Z","TeamNames":{},"PointsLog":[],"Puzzles":{}}` {
 		t.Error("Unexpected state", r.Body.String())
 	}
 
@@ -71,7 +97,7 @@ func TestHttpd(t *testing.T) {
 
 	if r := hs.TestRequest("/state", nil); r.Result().StatusCode != 200 {
 		t.Error(r.Result())
-	} else if r.Body.String() != `{"Config":{"Devel":false},"Enabled":true,"TeamNames":{"self":"GoTeam"},"PointsLog":[],"Puzzles":{"pategory":[1]}}` {
+	} else if r.Body.String() != `{"Config":{"Devel":false},"Enabled":true,"Until":"2519-10-31T00:00:00Z","TeamNames":{"self":"GoTeam"},"PointsLog":[],"Puzzles":{"pategory":[1]},"MaxPoints":{"pategory":6}}` {
 		t.Error("Unexpected state", r.Body.String())
 	}
 
@@ -126,6 +152,12 @@ func TestHttpd(t *testing.T) {
 		t.Error("Didn't unlock next puzzle")
 	}
 
+	if r := hs.TestRequest("/scoreboard", nil); r.Result().StatusCode != 200 {
+		t.Error(r.Result())
+	} else if !strings.Contains(r.Body.String(), "<td>GoTeam</td>") {
+		t.Error("Scoreboard doesn't list team", r.Body.String())
+	}
+
 	if r := hs.TestRequest("/answer", map[string]string{"cat": "pategory", "points": "1", "answer": "answer123"}); r.Result().StatusCode != 200 {
 		t.Error(r.Result())
 	} else if r.Body.String() != `{"status":"fail","data":{"short":"not accepted","description":"points already awarded to this team in this category"}}` {
@@ -133,6 +165,61 @@ func TestHttpd(t *testing.T) {
 	}
 }
 
+func TestHttpdMutations(t *testing.T) {
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestGetRequest("/state", nil); r.Result().StatusCode != 200 {
+		t.Error("GET /state should work", r.Result())
+	}
+	if r := hs.TestGetRequest("/register", map[string]string{"name": "GoTeam"}); r.Result().StatusCode != 405 {
+		t.Error("GET /register should be refused", r.Result())
+	} else if r.Header().Get("Allow") != "POST" {
+		t.Error("Missing Allow header", r.Header())
+	}
+	if r := hs.TestGetRequest("/answer", map[string]string{"cat": "pategory", "points": "1", "answer": "answer123"}); r.Result().StatusCode != 405 {
+		t.Error("GET /answer should be refused", r.Result())
+	}
+
+	{
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "/register", strings.NewReader("id=teamID&name=GoTeam"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Origin", "https://evil.example.com")
+		hs.ServeHTTP(recorder, request)
+		if recorder.Code != 403 {
+			t.Error("Cross-origin request should be refused", recorder.Result())
+		}
+	}
+
+	{
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "/register", strings.NewReader("id=teamID&name=GoTeam"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Sec-Fetch-Site", "cross-site")
+		hs.ServeHTTP(recorder, request)
+		if recorder.Code != 403 {
+			t.Error("Cross-site request should be refused", recorder.Result())
+		}
+	}
+
+	{
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", "http://moth.example.com/register", strings.NewReader("id=teamID&name=GoTeam"))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Origin", "http://moth.example.com")
+		hs.ServeHTTP(recorder, request)
+		if recorder.Code != 200 {
+			t.Error("Same-origin request should be allowed", recorder.Result())
+		}
+	}
+
+	server.Config.AllowGETMutations = true
+	if r := hs.TestGetRequest("/answer", map[string]string{"cat": "pategory", "points": "1", "answer": "moo"}); r.Result().StatusCode != 200 {
+		t.Error("GET /answer should work in compatibility mode", r.Result())
+	}
+}
+
 func TestDevelMemHttpd(t *testing.T) {
 	srv := NewTestServer()
 
@@ -168,3 +255,472 @@ func TestDevelFsHttps(t *testing.T) {
 		t.Error("Didn't get a Mothball")
 	}
 }
+
+func TestServerTuning(t *testing.T) {
+	server := NewTestServer()
+	server.Config.ReadHeaderTimeout = 3 * time.Second
+	server.Config.MaxHeaderBytes = 4096
+	server.Config.MaxConnections = 1
+	hs := NewHTTPServer("/", server.MothServer)
+
+	srv := hs.newServer(":8080", hs)
+	if (srv.ReadHeaderTimeout != 3*time.Second) || (srv.MaxHeaderBytes != 4096) {
+		t.Error("Server not tuned:", srv)
+	}
+	if (srv.TLSNextProto == nil) || (len(srv.TLSNextProto) != 0) {
+		t.Error("HTTP/2 not disabled")
+	}
+	server.Config.HTTP2 = true
+	if srv := hs.newServer(":8080", hs); srv.TLSNextProto != nil {
+		t.Error("HTTP/2 disabled")
+	}
+
+	ln, err := hs.listen(BindAddress{Network: "tcp", Address: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Error("Accepted a connection over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Error("Connection not accepted after another closed")
+	}
+}
+
+func testAvatar(width, height int) []byte {
+	buf := new(bytes.Buffer)
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+func (hs *HTTPServer) TestAvatarUpload(name string, avatar []byte) *httptest.ResponseRecorder {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("id", TestTeamID)
+	mw.WriteField("name", name)
+	if avatar != nil {
+		fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+		fw.Write(avatar)
+	}
+	mw.Close()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/profile", buf)
+	request.Header.Set("Content-Type", mw.FormDataContentType())
+	hs.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestProfile(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestAvatarUpload("Sneaky", nil); !strings.Contains(r.Body.String(), `"fail"`) {
+		t.Error("Unregistered team updated profile:", r.Body.String())
+	}
+
+	hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	server.refresh()
+
+	avatar := testAvatar(32, 32)
+	if r := hs.TestAvatarUpload("Go Team Go", avatar); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Profile not updated:", r.Body.String())
+	}
+	server.refresh()
+	handler := server.NewHandler(TestTeamID)
+	export := handler.ExportState()
+	if export.TeamNames["self"] != "Go Team Go" {
+		t.Error("Team not renamed:", export.TeamNames)
+	}
+	hash := export.Avatars["self"]
+	if hash == "" {
+		t.Fatal("Avatar not exported:", export.Avatars)
+	}
+
+	if r := hs.TestGetRequest("/avatar/"+hash, nil); r.Code != 200 {
+		t.Error("Avatar not served:", r.Code)
+	} else if r.Header().Get("Content-Type") != "image/png" {
+		t.Error("Wrong avatar content type:", r.Header().Get("Content-Type"))
+	} else if !bytes.Equal(r.Body.Bytes(), avatar) {
+		t.Error("Wrong avatar served")
+	}
+	if r := hs.TestGetRequest("/avatar/nope", nil); r.Code != 404 {
+		t.Error("Nonexistent avatar served:", r.Code)
+	}
+
+	for _, bad := range [][]byte{[]byte("<svg></svg>"), testAvatar(1024, 16)} {
+		if r := hs.TestAvatarUpload("", bad); !strings.Contains(r.Body.String(), ErrInvalidAvatar.Error()) {
+			t.Error("Bad avatar accepted:", r.Body.String())
+		}
+	}
+
+	if r := hs.TestAPIv2Request("POST", "/v2/profile", map[string]string{"id": TestTeamID, "name": strings.Repeat("long", 20)}); r.Code != 400 {
+		t.Error("Long name accepted:", r.Code, r.Body.String())
+	}
+	if r := hs.TestAPIv2Request("POST", "/v2/profile", map[string]string{"id": TestTeamID, "avatar": ""}); r.Code != 200 {
+		t.Error("Avatar not removed:", r.Code, r.Body.String())
+	}
+	server.refresh()
+	if export := handler.ExportState(); len(export.Avatars) != 0 {
+		t.Error("Avatar still exported:", export.Avatars)
+	}
+}
+
+func TestDivisions(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	state := server.State.(*State)
+	afero.WriteFile(state, "divisions.txt", []byte("# brackets\ncollege\npro\n"), 0644)
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\nother\n"), 0644)
+	server.refresh()
+
+	if r := hs.TestRequest("/register", map[string]string{"name": "GoTeam", "division": "kindergarten"}); !strings.Contains(r.Body.String(), `"fail"`) {
+		t.Error("Registered in an unknown division:", r.Body.String())
+	}
+	if r := hs.TestRequest("/register", map[string]string{"name": "GoTeam", "division": "college"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Not registered:", r.Body.String())
+	}
+	server.refresh()
+	if division, err := server.State.TeamDivision(TestTeamID); (err != nil) || (division != "college") {
+		t.Error("Wrong division:", division, err)
+	}
+
+	server.State.SetTeamName("other", "Other Team")
+	server.State.SetTeamDivision("other", "pro")
+	server.refresh()
+	server.State.AwardPoints(TestTeamID, "pategory", 1)
+	server.State.AwardPoints("other", "pategory", 1)
+	server.refresh()
+
+	handler := server.NewHandler(TestTeamID)
+	export := handler.ExportState()
+	if len(export.Divisions) != 2 {
+		t.Error("Wrong divisions:", export.Divisions)
+	}
+	if len(export.TeamDivisions) != 2 {
+		t.Error("Wrong team divisions:", export.TeamDivisions)
+	}
+	pro := export.ForDivision("pro")
+	if (len(pro.PointsLog) != 1) || (pro.PointsLog[0].TeamID == "self") {
+		t.Error("Wrong points log for division:", pro.PointsLog)
+	}
+	if _, ok := pro.TeamNames["self"]; ok {
+		t.Error("Team from another division exported:", pro.TeamNames)
+	}
+	if len(pro.Puzzles["pategory"]) != len(export.Puzzles["pategory"]) {
+		t.Error("Division changed puzzles:", pro.Puzzles)
+	}
+
+	if r := hs.TestGetRequest("/state", map[string]string{"division": "college"}); strings.Contains(r.Body.String(), "Other Team") {
+		t.Error("State included another division:", r.Body.String())
+	}
+	if r := hs.TestGetRequest("/scoreboard", map[string]string{"division": "pro"}); strings.Contains(r.Body.String(), "GoTeam") {
+		t.Error("Scoreboard included another division:", r.Body.String())
+	}
+}
+
+func TestPublicState(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	server.refresh()
+	server.State.AwardPoints(TestTeamID, "pategory", 1)
+	server.refresh()
+
+	r := hs.TestGetRequest("/state/public", nil)
+	if r.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Error("Public state refuses cross-origin requests")
+	}
+	var export StateExport
+	if err := json.Unmarshal(r.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := export.TeamNames["self"]; ok {
+		t.Error("Public state has a self team:", export.TeamNames)
+	}
+	if len(export.TeamNames) != 1 {
+		t.Error("Wrong team names:", export.TeamNames)
+	}
+	if len(export.PointsLog) != 1 {
+		t.Error("Wrong points log:", export.PointsLog)
+	}
+	if len(export.Puzzles) != 0 {
+		t.Error("Public state lists puzzles:", export.Puzzles)
+	}
+
+	server.Config.Devel = true
+	if r := hs.TestGetRequest("/state/public", nil); !strings.Contains(r.Body.String(), `"Puzzles":{}`) {
+		t.Error("Development server public state lists puzzles:", r.Body.String())
+	}
+}
+
+func TestStateETag(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+	hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	server.refresh()
+
+	stateRequest := func(path, etag string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("POST", path, strings.NewReader("id="+TestTeamID))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if strings.HasPrefix(path, "/v2/") {
+			request = httptest.NewRequest("GET", path+"?id="+TestTeamID, nil)
+		}
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, path := range []string{"/state", "/state/public", "/v2/state", "/v2/state/public"} {
+		r := stateRequest(path, "")
+		etag := r.Header().Get("ETag")
+		if (r.Code != 200) || (etag == "") {
+			t.Error(path, "sent no ETag:", r.Code)
+			continue
+		}
+		if r := stateRequest(path, etag); r.Code != 304 {
+			t.Error(path, "sent unchanged state again:", r.Code)
+		}
+	}
+
+	etag := stateRequest("/state", "").Header().Get("ETag")
+	server.State.AwardPoints(TestTeamID, "pategory", 1)
+	server.refresh()
+	if r := stateRequest("/state", etag); r.Code != 200 {
+		t.Error("Changed state not sent:", r.Code)
+	}
+}
+
+func TestStateSince(t *testing.T) {
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/state", nil); strings.Contains(r.Body.String(), "Sequence") {
+		t.Error("Sequence sent without asking")
+	}
+	var export StateExport
+	r := hs.TestRequest("/state", map[string]string{"since": "0"})
+	if err := json.Unmarshal(r.Body.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Sequence == 0 {
+		t.Fatal("No sequence:", r.Body.String())
+	}
+	since := fmt.Sprint(export.Sequence)
+	if r := hs.TestRequest("/state", map[string]string{"since": since}); !strings.Contains(r.Body.String(), `"Since":`+since) {
+		t.Error("No delta:", r.Body.String())
+	}
+	if r := hs.TestGetRequest("/v2/state", map[string]string{"since": since}); !strings.Contains(r.Body.String(), `"Since":`+since) {
+		t.Error("No v2 delta:", r.Body.String())
+	}
+	if r := hs.TestRequest("/state", map[string]string{"since": "soon"}); r.Code != 400 {
+		t.Error("Bad since accepted:", r.Code)
+	}
+}
+
+func TestTeamLocale(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"lingogory",
+		[]testFileContents{
+			{"1/puzzle.json", `{"Body": "Moo?", "Locales": ["es"]}`},
+			{"1/puzzle.es.json", `{"Body": "¿Mu?", "Locales": ["es"]}`},
+		},
+	)
+	theme := server.Theme.(*Theme)
+	afero.WriteFile(theme.Fs, "/translations/en.json", []byte(`{"solve": "Solve", "points": "points", "team": "Team"}`), 0644)
+	afero.WriteFile(theme.Fs, "/translations/es.json", []byte(`{"solve": "Resolver", "points": "puntos"}`), 0644)
+	afero.WriteFile(theme.Fs, "/translations/es-mx.json", []byte(`{"points": "puntitos"}`), 0644)
+	server.Config.Locale = "en"
+	hs := NewHTTPServer("/", server.MothServer)
+
+	hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	server.refresh()
+
+	if r := hs.TestRequest("/profile", map[string]string{"locale": "../../etc"}); !strings.Contains(r.Body.String(), ErrInvalidLocale.Error()) {
+		t.Error("Bad locale accepted:", r.Body.String())
+	}
+	if r := hs.TestRequest("/profile", map[string]string{"locale": "es"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Locale not set:", r.Body.String())
+	}
+	handler := server.NewHandler(TestTeamID)
+	if export := handler.ExportState(); export.Locale != "es" {
+		t.Error("Locale not exported:", export.Locale)
+	}
+
+	if r := hs.TestGetRequest("/content/lingogory/1/puzzle.json", nil); !strings.Contains(r.Body.String(), "¿Mu?") {
+		t.Error("Puzzle not in team's language:", r.Body.String())
+	}
+
+	strs := make(map[string]string)
+	if r := hs.TestGetRequest("/translations/es-MX.json", nil); r.Code != 200 {
+		t.Error("Translations not served:", r.Code)
+	} else if err := json.Unmarshal(r.Body.Bytes(), &strs); err != nil {
+		t.Error(err)
+	} else if (strs["solve"] != "Resolver") || (strs["points"] != "puntitos") || (strs["team"] != "Team") {
+		t.Error("Wrong translations:", strs)
+	}
+	if r := hs.TestGetRequest("/translations/fr.json", nil); !strings.Contains(r.Body.String(), `"Solve"`) {
+		t.Error("Missing language didn't fall back to default:", r.Body.String())
+	}
+	if r := hs.TestGetRequest("/translations/es_MX.json", nil); r.Code != 404 {
+		t.Error("Invalid language served:", r.Code)
+	}
+
+	if r := hs.TestAPIv2Request("POST", "/v2/profile", map[string]string{"id": TestTeamID, "locale": ""}); r.Code != 200 {
+		t.Error("Locale not removed:", r.Code, r.Body.String())
+	}
+	if export := handler.ExportState(); export.Locale != "" {
+		t.Error("Locale still exported:", export.Locale)
+	}
+}
+
+func (hs *HTTPServer) TestFileUpload(cat string, points int, contents string) *httptest.ResponseRecorder {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	mw.WriteField("id", TestTeamID)
+	mw.WriteField("cat", cat)
+	mw.WriteField("points", strconv.Itoa(points))
+	fw, _ := mw.CreateFormFile("file", "upload.bin")
+	fw.Write([]byte(contents))
+	mw.Close()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/upload", buf)
+	request.Header.Set("Content-Type", mw.FormDataContentType())
+	hs.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestUploadPuzzle(t *testing.T) {
+	transpile.RegisterAnswerChecker(transpile.UploadChecker, transpile.UploadCommandChecker{Enabled: true, Timeout: 2 * time.Second})
+	defer transpile.RegisterAnswerChecker(transpile.UploadChecker, transpile.UploadCommandChecker{Timeout: 2 * time.Second})
+
+	server := NewTestServer()
+	server.Config.UploadMaxSize = 1024
+	server.Config.UploadsPerHour = 3
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"uploadegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n"},
+			{"answers.txt", "1 check.sh\n"},
+			{"checkers.txt", "1 upload\n"},
+			{"1/check.sh", "#!/bin/sh\ngrep -q patched \"$1\"\n"},
+			{"1/puzzle.json", `{"Checker": "upload", "UploadMaxSize": 16}`},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestFileUpload("uploadegory", 1, "patched"); !strings.Contains(r.Body.String(), ErrInvalidTeamID.Error()) {
+		t.Error("Unregistered team's upload checked:", r.Body.String())
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	if err := handler.CheckAnswer("uploadegory", 1, "check.sh"); err != ErrUploadRequired {
+		t.Error("Text answer to upload puzzle:", err)
+	}
+	if r := hs.TestFileUpload("pategory", 1, "answer123"); !strings.Contains(r.Body.String(), ErrNotUploadPuzzle.Error()) {
+		t.Error("Upload to text puzzle:", r.Body.String())
+	}
+	if r := hs.TestFileUpload("uploadegory", 1, "patched, but much too large"); !strings.Contains(r.Body.String(), ErrUploadTooLarge.Error()) {
+		t.Error("Upload larger than puzzle allows:", r.Body.String())
+	}
+	if r := hs.TestFileUpload("uploadegory", 1, strings.Repeat("x", 128*1024)); !strings.Contains(r.Body.String(), ErrUploadTooLarge.Error()) {
+		t.Error("Upload larger than server allows:", r.Body.String())
+	}
+	if r := hs.TestFileUpload("uploadegory", 1, "original"); !strings.Contains(r.Body.String(), ErrIncorrectAnswer.Error()) {
+		t.Error("Wrong upload accepted:", r.Body.String())
+	}
+	if r := hs.TestFileUpload("uploadegory", 1, "patched"); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Right upload refused:", r.Body.String())
+	}
+	server.refresh()
+	if len(server.State.PointsLog()) != 1 {
+		t.Error("Points not awarded for upload")
+	}
+
+	if r := hs.TestFileUpload("uploadegory", 1, "patched"); !strings.Contains(r.Body.String(), ErrAlreadyAwarded.Error()) {
+		t.Error("Third upload:", r.Body.String())
+	}
+	if r := hs.TestFileUpload("uploadegory", 1, "patched"); !strings.Contains(r.Body.String(), ErrTooManyUploads.Error()) {
+		t.Error("Upload past the hourly limit:", r.Body.String())
+	}
+}
+
+func TestPreview(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers: [moo]\nattachments: [cow.txt]\ndebug:\n  summary: Cows\n  hints: [Say it]\n---\nWhat do <b>cows</b> say?\n"), 0644)
+	afero.WriteFile(fs, "cat/1/cow.txt", []byte("moo"), 0644)
+	srv := NewMothServer(Configuration{Devel: true}, NewTestTheme(), NewTestState(), NewTranspilerProvider(fs))
+	hs := NewHTTPServer("/moth/", srv)
+
+	r := hs.TestGetRequest("/moth/preview/cat/1", nil)
+	if r.Result().StatusCode != 200 {
+		t.Fatal(r.Result().Status, r.Body.String())
+	}
+	body := r.Body.String()
+	for _, want := range []string{
+		`<base href="/moth/content/cat/1/">`,
+		`<h1>cat 1: Cows</h1>`,
+		`<b>cows</b>`,
+		`<code>moo</code>`,
+		`<li>Say it</li>`,
+		`<a href="cow.txt" download>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Preview is missing %s", want)
+		}
+	}
+
+	if r := hs.TestGetRequest("/moth/preview/", nil); !strings.Contains(r.Body.String(), `<a href="cat/1">1</a>`) {
+		t.Error("Wrong index:", r.Body.String())
+	}
+	if r := hs.TestGetRequest("/moth/preview/cat/2", nil); r.Result().StatusCode != 404 {
+		t.Error("Previewed a missing puzzle:", r.Result().Status)
+	}
+
+	prod := NewHTTPServer("/moth/", NewTestServer().MothServer)
+	if r := prod.TestGetRequest("/moth/preview/", nil); r.Result().StatusCode == 200 {
+		t.Error("Preview outside development mode")
+	}
+}
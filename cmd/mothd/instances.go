@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// NewInstance returns a MothServer for an event kept in dir.
+//
+// dir is laid out like a standalone server,
+// with theme, state, and mothballs directories.
+// If there's no theme directory, theme is used instead.
+func NewInstance(fs afero.Fs, dir string, config Configuration, theme ThemeProvider) (*MothServer, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := fs.Stat(filepath.Join(dir, "theme")); (err == nil) && fi.IsDir() {
+		theme = NewTheme(afero.NewBasePathFs(fs, filepath.Join(dir, "theme")))
+	}
+	state := NewState(afero.NewBasePathFs(fs, filepath.Join(dir, "state")))
+	provider := NewMothballs(afero.NewBasePathFs(fs, filepath.Join(dir, "mothballs")))
+
+	config.Devel = false
+	return NewMothServer(config, theme, state, provider), nil
+}
+
+// AddInstance serves another event from this server.
+//
+// If route begins with a slash, it's a URL path prefix:
+// requests below it go to server.
+// Otherwise it's a host name,
+// and requests for that host go to server.
+func (h *HTTPServer) AddInstance(route string, server *MothServer) error {
+	if h.instances == nil {
+		h.instances = make(map[string]*HTTPServer)
+	}
+
+	route = strings.TrimRight(route, "/")
+	key := route
+	if strings.HasPrefix(route, "/") {
+		route = h.base + route
+		key = route
+	} else if route == "" {
+		return fmt.Errorf("empty instance route")
+	} else {
+		key = strings.ToLower(route)
+		route = h.base
+	}
+	if _, ok := h.instances[key]; ok {
+		return fmt.Errorf("duplicate instance route: %s", key)
+	}
+	h.instances[key] = NewHTTPServer(route, server)
+	return nil
+}
+
+// instance returns the server for another event that should handle req,
+// or nil if this server should handle it.
+func (h *HTTPServer) instance(req *http.Request) *HTTPServer {
+	if len(h.instances) == 0 {
+		return nil
+	}
+
+	host := req.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if inst, ok := h.instances[strings.ToLower(host)]; ok {
+		return inst
+	}
+
+	// Longest matching prefix wins
+	var found *HTTPServer
+	longest := 0
+	for prefix, inst := range h.instances {
+		if !strings.HasPrefix(prefix, "/") || (len(prefix) <= longest) {
+			continue
+		}
+		if (req.URL.Path == prefix) || strings.HasPrefix(req.URL.Path, prefix+"/") {
+			found = inst
+			longest = len(prefix)
+		}
+	}
+	return found
+}
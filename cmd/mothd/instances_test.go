@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestInstances(t *testing.T) {
+	server := NewTestServer()
+	other := NewTestServer()
+	hosted := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+	if err := hs.AddInstance("/other/", other.MothServer); err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.AddInstance("Hosted.Example.COM", hosted.MothServer); err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.AddInstance("/other", hosted.MothServer); err == nil {
+		t.Error("Added a duplicate instance route")
+	}
+
+	if r := hs.TestRequest("/other/register", map[string]string{"name": "Other Team"}); r.Result().StatusCode != 200 {
+		t.Error(r.Result())
+	}
+	other.refresh()
+	if name, _ := other.State.TeamName(TestTeamID); name != "Other Team" {
+		t.Error("Instance team not registered:", name)
+	}
+	if _, err := server.State.TeamName(TestTeamID); err == nil {
+		t.Error("Instance registration leaked into main server")
+	}
+
+	hosted.State.SetTeamName(TestTeamID, "Hosted Team")
+	hosted.refresh()
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/state?id="+TestTeamID, nil)
+	request.Host = "hosted.example.com:8080"
+	hs.ServeHTTP(recorder, request)
+	if !strings.Contains(recorder.Body.String(), "Hosted Team") {
+		t.Error("Hosted instance didn't serve state:", recorder.Body.String())
+	}
+
+	if hs.instance(httptest.NewRequest("GET", "/otherwise/state", nil)) != nil {
+		t.Error("Prefix matched too much")
+	}
+}
+
+func TestNewInstance(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	fs.MkdirAll("/events/one/state", 0755)
+	fs.MkdirAll("/events/two/theme", 0755)
+	theme := NewTestTheme()
+
+	one, err := NewInstance(fs, "/events/one", Configuration{Devel: true}, theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.Theme != ThemeProvider(theme) {
+		t.Error("Instance without a theme didn't use the main theme")
+	}
+	if one.Config.Devel {
+		t.Error("Instance is in development mode")
+	}
+
+	two, err := NewInstance(fs, "/events/two", Configuration{}, theme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if two.Theme == ThemeProvider(theme) {
+		t.Error("Instance with a theme used the main theme")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseCIDRs parses a list of CIDR networks.
+// Bare IP addresses are treated as networks containing only that address.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip == nil {
+				// Fall through to let ParseCIDR produce an error
+			} else if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// containsIP returns true if ip is in any of nets.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client making req.
+//
+// X-Forwarded-For is only believed if the request came from a trusted proxy.
+// Addresses in it are read from right to left,
+// skipping trusted proxies,
+// so clients can't spoof their address by sending their own X-Forwarded-For.
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if (ip == nil) || !containsIP(trustedProxies, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// addressAllowed returns true if the configured allow and deny lists permit ip.
+//
+// Denied networks are checked first.
+// If there are any allowed networks, ip must be in one of them.
+func (c Configuration) addressAllowed(ip net.IP) bool {
+	if ip == nil {
+		return len(c.AllowNets) == 0
+	}
+	if containsIP(c.DenyNets, ip) {
+		return false
+	}
+	if len(c.AllowNets) > 0 {
+		return containsIP(c.AllowNets, ip)
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nets
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets := mustParseCIDRs(t, "10.0.0.0/8", "192.0.2.7", "2001:db8::1")
+	if len(nets) != 3 {
+		t.Fatal("Wrong number of networks", nets)
+	}
+	if nets[1].String() != "192.0.2.7/32" {
+		t.Error("Bare IPv4 address parsed wrong:", nets[1])
+	}
+	if nets[2].String() != "2001:db8::1/128" {
+		t.Error("Bare IPv6 address parsed wrong:", nets[2])
+	}
+	if _, err := ParseCIDRs([]string{"moo"}); err == nil {
+		t.Error("Garbage accepted as a network")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := mustParseCIDRs(t, "10.0.0.0/8")
+	cases := []struct {
+		remote    string
+		forwarded string
+		client    string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.1.1.1:1234", "", "10.1.1.1"},
+		{"10.1.1.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.1.1.1:1234", "6.6.6.6, 198.51.100.1, 10.2.2.2", "198.51.100.1"},
+		{"10.1.1.1:1234", "10.3.3.3, 10.2.2.2", "10.3.3.3"},
+		{"10.1.1.1:1234", "garbage", "10.1.1.1"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if ip := clientIP(req, trusted); ip.String() != c.client {
+			t.Errorf("%s forwarding %q: got %s, wanted %s", c.remote, c.forwarded, ip, c.client)
+		}
+	}
+}
+
+func TestAddressFilter(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AllowNets = mustParseCIDRs(t, "192.0.2.0/24")
+	server.Config.DenyNets = mustParseCIDRs(t, "192.0.2.66")
+	hs := NewHTTPServer("/", server.MothServer)
+
+	for remote, status := range map[string]int{
+		"192.0.2.1:1234":    http.StatusOK,
+		"192.0.2.66:1234":   http.StatusForbidden,
+		"198.51.100.1:1234": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/state", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		hs.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("%s: got status %d, wanted %d", remote, w.Code, status)
+		}
+	}
+
+	for _, path := range []string{"/scoreboard", "/state/public", "/v2/state/public"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		w := httptest.NewRecorder()
+		hs.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Error(path, "refused:", w.Code)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// kioskFiles is everything built into a kiosk mothd:
+// the theme in theme/, and mothballs in mothballs/.
+// It's nil in an ordinary mothd.
+var kioskFiles fs.FS
+
+// KioskTeamID is the team ID a kiosk mothd's state starts out accepting.
+const KioskTeamID = "kiosk"
+
+// KioskBind is where a kiosk mothd serves, unless told otherwise.
+const KioskBind = "localhost:8080"
+
+// kioskFs returns directory dir of kioskFiles.
+func kioskFs(dir string) (afero.Fs, error) {
+	sub, err := fs.Sub(kioskFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	return newEmbedFs(sub), nil
+}
+
+// kioskStatePath returns where a kiosk mothd keeps its state:
+// a directory named after the program, in the user's configuration directory.
+// Kiosks built for different classes keep their state apart this way.
+func kioskStatePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "state"
+	}
+	name := filepath.Base(os.Args[0])
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(dir, "moth", name)
+}
+
+// prepareKioskState makes the state directory p in fs,
+// and lets in KioskTeamID, unless the directory already has team IDs.
+func prepareKioskState(fs afero.Fs, p string) error {
+	if err := fs.MkdirAll(p, 0755); err != nil {
+		return err
+	}
+	f, err := fs.OpenFile(filepath.Join(p, "teamids.txt"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(KioskTeamID + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// browserURL returns the URL a browser on this machine can reach bind at.
+// It returns false for binds a browser can't reach, like Unix sockets.
+func browserURL(bind BindAddress, tls bool, base string) (string, bool) {
+	if !strings.HasPrefix(bind.Network, "tcp") {
+		return "", false
+	}
+	host, port, err := net.SplitHostPort(bind.Address)
+	if err != nil {
+		return "", false
+	}
+	if ip := net.ParseIP(host); (host == "") || ((ip != nil) && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "http"
+	if tls && !bind.NoTLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port) + base, true
+}
+
+// openBrowser waits for address to take connections,
+// then opens url in the desktop's web browser.
+func openBrowser(url string, address string) {
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Run(); err != nil {
+		slog.Warn("opening web browser", "url", url, "error", err)
+	}
+}
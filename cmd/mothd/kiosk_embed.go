@@ -0,0 +1,21 @@
+//go:build kiosk
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// kioskEmbed is filled in from the kiosk directory by "go build -tags kiosk".
+//
+//go:embed kiosk
+var kioskEmbed embed.FS
+
+func init() {
+	files, err := fs.Sub(kioskEmbed, "kiosk")
+	if err != nil {
+		panic(err)
+	}
+	kioskFiles = files
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPrepareKioskState(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := prepareKioskState(fs, "/state"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := afero.ReadFile(fs, "/state/teamids.txt"); err != nil {
+		t.Error(err)
+	} else if string(buf) != KioskTeamID+"\n" {
+		t.Errorf("Wrong team IDs: %q", buf)
+	}
+
+	afero.WriteFile(fs, "/state/teamids.txt", []byte("mine\n"), 0644)
+	if err := prepareKioskState(fs, "/state"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := afero.ReadFile(fs, "/state/teamids.txt"); string(buf) != "mine\n" {
+		t.Errorf("Team IDs replaced: %q", buf)
+	}
+}
+
+func TestBrowserURL(t *testing.T) {
+	for _, tc := range []struct {
+		bind string
+		tls  bool
+		url  string
+	}{
+		{":8080", false, "http://localhost:8080/moth/"},
+		{"0.0.0.0:80", false, "http://localhost:80/moth/"},
+		{"localhost:8080", true, "https://localhost:8080/moth/"},
+		{"[::1]:8080,notls", true, "http://[::1]:8080/moth/"},
+		{"unix:/run/moth.sock", false, ""},
+	} {
+		bind, err := ParseBindAddress(tc.bind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		url, ok := browserURL(bind, tc.tls, "/moth/")
+		if ok != (tc.url != "") || (url != tc.url) {
+			t.Errorf("%s: got %q, %v", tc.bind, url, ok)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+)
+
+// Lab statuses. Orchestrators may report others, which are passed along as they are.
+const (
+	LabPending = "pending"
+	LabReady   = "ready"
+	LabFailed  = "failed"
+)
+
+// Lab is one team's instance of a puzzle's lab.
+type Lab struct {
+	// ID is the orchestrator's name for the lab
+	ID string
+
+	Category string
+	Points   int
+	Template string
+
+	// Status is LabPending, LabReady, LabFailed,
+	// or anything else the orchestrator says
+	Status string
+
+	// Address is where the team can reach the lab, once it's ready
+	Address string `json:",omitempty"`
+
+	// Message is anything else the orchestrator wants the team to know
+	Message string `json:",omitempty"`
+
+	Created time.Time
+}
+
+// labRequest is sent to the orchestrator.
+type labRequest struct {
+	Action   string `json:"action"`
+	ID       string `json:"id,omitempty"`
+	TeamName string `json:"teamName,omitempty"`
+	Category string `json:"category,omitempty"`
+	Points   int    `json:"points,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+// labResponse is what the orchestrator sends back.
+type labResponse struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Address string `json:"address"`
+	Message string `json:"message"`
+}
+
+// LabManager is an EventListener which asks an orchestrator for each team's labs,
+// keeps track of them,
+// and tears them all down when the event ends.
+//
+// Requests to the orchestrator are JSON objects POSTed to URL,
+// signed like webhooks if Secret is set.
+// Each has an "action": "provision", "status", or "teardown".
+type LabManager struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+
+	server *MothServer
+	fs     afero.Fs
+	path   string
+
+	lock     sync.RWMutex
+	labs     map[string][]Lab // team ID -> labs
+	triggers chan Event
+}
+
+// NewLabManager returns a new LabManager for the puzzles on server,
+// which asks the orchestrator at url for labs.
+//
+// Labs are remembered in path on fs,
+// so they can be torn down even if mothd restarts.
+func NewLabManager(server *MothServer, url string, secret string, fs afero.Fs, path string) *LabManager {
+	lm := &LabManager{
+		URL:      url,
+		Secret:   []byte(secret),
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		server:   server,
+		fs:       fs,
+		path:     path,
+		labs:     make(map[string][]Lab),
+		triggers: make(chan Event, WebhookQueueLength),
+	}
+	if b, err := afero.ReadFile(fs, path); err == nil {
+		if err := json.Unmarshal(b, &lm.labs); err != nil {
+			slog.Error("reading labs", "path", path, "error", err)
+		}
+	}
+	return lm
+}
+
+// Notify queues a provisioning request,
+// if event is a team first loading or solving a puzzle.
+// Whether the puzzle has a lab is worked out later.
+func (lm *LabManager) Notify(event Event) {
+	if (event.TeamID == "") || !((event.Type == EventLoad) || ((event.Type == EventAward) && (event.Part == ""))) {
+		return
+	}
+	if _, ok := lm.Lab(event.TeamID, event.Category, event.Points); ok {
+		return
+	}
+	select {
+	case lm.triggers <- event:
+	default:
+		slog.Warn("lab queue full, dropping event", "event", event.Type, "category", event.Category, "points", event.Points)
+	}
+}
+
+// Lab returns a team's lab for a puzzle.
+// Failed labs aren't returned, so that they're provisioned again.
+func (lm *LabManager) Lab(teamID string, cat string, points int) (Lab, bool) {
+	lm.lock.RLock()
+	defer lm.lock.RUnlock()
+	for _, lab := range lm.labs[teamID] {
+		if (lab.Category == cat) && (lab.Points == points) && (lab.Status != LabFailed) {
+			return lab, true
+		}
+	}
+	return Lab{}, false
+}
+
+// TeamLabs returns a team's labs, by category, then point value.
+func (lm *LabManager) TeamLabs(teamID string) map[string]map[int]Lab {
+	lm.lock.RLock()
+	defer lm.lock.RUnlock()
+	ret := make(map[string]map[int]Lab)
+	for _, lab := range lm.labs[teamID] {
+		if ret[lab.Category] == nil {
+			ret[lab.Category] = make(map[int]Lab)
+		}
+		ret[lab.Category][lab.Points] = lab
+	}
+	return ret
+}
+
+// call sends one request to the orchestrator.
+func (lm *LabManager) call(request labRequest) (labResponse, error) {
+	response := labResponse{}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	req, err := http.NewRequest(http.MethodPost, lm.URL, bytes.NewReader(body))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(lm.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, WebhookSignature(lm.Secret, body))
+	}
+
+	resp, err := lm.Client.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return response, fmt.Errorf("%s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+// provision asks for a lab, if event's puzzle has one that event triggers.
+func (lm *LabManager) provision(event Event) {
+	if !lm.server.State.Enabled() {
+		return
+	}
+	if _, ok := lm.Lab(event.TeamID, event.Category, event.Points); ok {
+		return
+	}
+	mh := lm.server.NewHandler(event.TeamID)
+	puzzle, err := mh.puzzle(event.Category, event.Points)
+	if (err != nil) || (puzzle.Lab == nil) {
+		return
+	}
+	trigger := puzzle.Lab.Trigger
+	if trigger == "" {
+		trigger = transpile.LabOnOpen
+	}
+	if (trigger == transpile.LabOnOpen) != (event.Type == EventLoad) {
+		return
+	}
+
+	// A failed lab is replaced, but the orchestrator may still have something to clean up
+	for _, old := range lm.TeamLabs(event.TeamID)[event.Category] {
+		if (old.Points == event.Points) && (old.ID != "") {
+			if _, err := lm.call(labRequest{Action: "teardown", ID: old.ID}); err != nil {
+				slog.Warn("tearing down lab", "id", old.ID, "error", err)
+			}
+		}
+	}
+
+	lab := Lab{
+		Category: event.Category,
+		Points:   event.Points,
+		Template: puzzle.Lab.Template,
+		Created:  time.Now(),
+	}
+	resp, err := lm.call(labRequest{
+		Action:   "provision",
+		TeamName: event.TeamName,
+		Category: event.Category,
+		Points:   event.Points,
+		Template: puzzle.Lab.Template,
+	})
+	if err != nil {
+		slog.Warn("provisioning lab", "team", event.TeamName, "category", event.Category, "points", event.Points, "error", err)
+		lab.Status = LabFailed
+		lab.Message = "the lab could not be provisioned"
+	} else {
+		lab.ID = resp.ID
+		lab.Status = resp.Status
+		lab.Address = resp.Address
+		lab.Message = resp.Message
+		if lab.Status == "" {
+			lab.Status = LabPending
+		}
+	}
+	slog.Info("provisioned lab", "team", event.TeamName, "category", event.Category, "points", event.Points, "id", lab.ID, "status", lab.Status)
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	labs := make([]Lab, 0, len(lm.labs[event.TeamID])+1)
+	for _, l := range lm.labs[event.TeamID] {
+		if (l.Category != lab.Category) || (l.Points != lab.Points) {
+			labs = append(labs, l)
+		}
+	}
+	lm.labs[event.TeamID] = append(labs, lab)
+	lm.save()
+}
+
+// poll asks the orchestrator about every pending lab.
+func (lm *LabManager) poll() {
+	type pending struct {
+		teamID string
+		id     string
+	}
+	lm.lock.RLock()
+	todo := make([]pending, 0)
+	for teamID, labs := range lm.labs {
+		for _, lab := range labs {
+			if (lab.Status == LabPending) && (lab.ID != "") {
+				todo = append(todo, pending{teamID, lab.ID})
+			}
+		}
+	}
+	lm.lock.RUnlock()
+
+	for _, p := range todo {
+		resp, err := lm.call(labRequest{Action: "status", ID: p.id})
+		if err != nil {
+			slog.Warn("checking lab", "id", p.id, "error", err)
+			continue
+		}
+		lm.lock.Lock()
+		for i, lab := range lm.labs[p.teamID] {
+			if lab.ID == p.id {
+				if resp.Status != "" {
+					lab.Status = resp.Status
+				}
+				lab.Address = resp.Address
+				lab.Message = resp.Message
+				lm.labs[p.teamID][i] = lab
+			}
+		}
+		lm.save()
+		lm.lock.Unlock()
+	}
+}
+
+// TeardownAll asks the orchestrator to tear down every lab,
+// and forgets the ones it tore down.
+func (lm *LabManager) TeardownAll() {
+	lm.lock.RLock()
+	ids := make([]string, 0)
+	for _, labs := range lm.labs {
+		for _, lab := range labs {
+			if lab.ID != "" {
+				ids = append(ids, lab.ID)
+			}
+		}
+	}
+	lm.lock.RUnlock()
+
+	gone := make(map[string]bool)
+	for _, id := range ids {
+		if _, err := lm.call(labRequest{Action: "teardown", ID: id}); err != nil {
+			slog.Warn("tearing down lab", "id", id, "error", err)
+			continue
+		}
+		slog.Info("tore down lab", "id", id)
+		gone[id] = true
+	}
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	for teamID, labs := range lm.labs {
+		kept := make([]Lab, 0)
+		for _, lab := range labs {
+			if (lab.ID != "") && !gone[lab.ID] {
+				kept = append(kept, lab)
+			}
+		}
+		if len(kept) > 0 {
+			lm.labs[teamID] = kept
+		} else {
+			delete(lm.labs, teamID)
+		}
+	}
+	lm.save()
+}
+
+// save writes every lab to lm.path.
+// The caller must hold lm.lock.
+func (lm *LabManager) save() {
+	b, err := json.Marshal(lm.labs)
+	if err == nil {
+		err = afero.WriteFile(lm.fs, lm.path, b, 0600)
+	}
+	if err != nil {
+		slog.Error("saving labs", "path", lm.path, "error", err)
+	}
+}
+
+// Maintain provisions labs as they're asked for,
+// checks on pending labs every updateInterval,
+// and tears everything down when the event is no longer running.
+func (lm *LabManager) Maintain(updateInterval time.Duration) {
+	ticker := time.NewTicker(updateInterval)
+	for {
+		select {
+		case event := <-lm.triggers:
+			lm.provision(event)
+		case <-ticker.C:
+			if !lm.server.State.Enabled() {
+				lm.lock.RLock()
+				running := len(lm.labs) > 0
+				lm.lock.RUnlock()
+				if running {
+					lm.TeardownAll()
+				}
+				continue
+			}
+			lm.poll()
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLabs(t *testing.T) {
+	var lock sync.Mutex
+	requests := make([]labRequest, 0)
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := labRequest{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Header.Get(WebhookSignatureHeader) == "" {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		lock.Lock()
+		requests = append(requests, body)
+		n := len(requests)
+		lock.Unlock()
+
+		switch body.Action {
+		case "provision":
+			json.NewEncoder(w).Encode(labResponse{ID: fmt.Sprintf("lab-%d", n), Status: LabPending})
+		case "status":
+			json.NewEncoder(w).Encode(labResponse{ID: body.ID, Status: LabReady, Address: "10.0.0.1"})
+		case "teardown":
+			json.NewEncoder(w).Encode(labResponse{ID: body.ID})
+		}
+	}))
+	defer orchestrator.Close()
+
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"labegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n2\n3\n"},
+			{"answers.txt", "1 one\n2 two\n3 three\n"},
+			{"1/puzzle.json", `{"Lab": {"Template": "webserver"}}`},
+			{"2/puzzle.json", `{"Lab": {"Template": "router", "Trigger": "solve"}}`},
+			{"3/puzzle.json", `{}`},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+
+	fs := afero.NewMemMapFs()
+	lm := NewLabManager(server.MothServer, orchestrator.URL, "sekrit", fs, "labs.json")
+	server.Labs = lm
+	server.Listeners = append(server.Listeners, lm)
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	// drain provisions everything that's been asked for so far
+	drain := func() {
+		for {
+			select {
+			case event := <-lm.triggers:
+				lm.provision(event)
+			default:
+				return
+			}
+		}
+	}
+
+	open := func(points int) {
+		if f, _, err := handler.PuzzlesOpen("labegory", points, "puzzle.json"); err != nil {
+			t.Fatal(err)
+		} else {
+			f.Close()
+		}
+	}
+
+	open(1)
+	if _, err := handler.SubmitAnswer("labegory", 1, "one"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	open(2)
+	drain()
+	lab, ok := lm.Lab(TestTeamID, "labegory", 1)
+	if !ok || (lab.ID != "lab-1") || (lab.Status != LabPending) || (lab.Template != "webserver") {
+		t.Error("Wrong lab after opening:", lab, ok)
+	}
+	if _, ok := lm.Lab(TestTeamID, "labegory", 2); ok {
+		t.Error("Solve-triggered lab provisioned on open")
+	}
+	if requests[0].TeamName != "team" {
+		t.Error("Wrong team name sent:", requests[0])
+	}
+
+	// Opening it again shouldn't provision another
+	open(1)
+	drain()
+	if len(requests) != 1 {
+		t.Error("Lab provisioned more than once:", requests)
+	}
+
+	if _, err := handler.SubmitAnswer("labegory", 2, "two"); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+	if lab, ok := lm.Lab(TestTeamID, "labegory", 2); !ok || (lab.Template != "router") {
+		t.Error("Lab not provisioned on solve:", lab, ok)
+	}
+
+	lm.poll()
+	if lab, _ := lm.Lab(TestTeamID, "labegory", 1); (lab.Status != LabReady) || (lab.Address != "10.0.0.1") {
+		t.Error("Lab not updated:", lab)
+	}
+
+	export := handler.ExportState()
+	if export.Labs["labegory"][1].Address != "10.0.0.1" {
+		t.Error("Lab not exported:", export.Labs)
+	}
+	anonymous := server.NewHandler("")
+	if len(anonymous.ExportState().Labs) > 0 {
+		t.Error("Labs exported to an unregistered team")
+	}
+
+	// Labs are remembered across restarts
+	if again := NewLabManager(server.MothServer, orchestrator.URL, "sekrit", fs, "labs.json"); len(again.TeamLabs(TestTeamID)["labegory"]) != 2 {
+		t.Error("Labs not reloaded:", again.TeamLabs(TestTeamID))
+	}
+
+	lm.TeardownAll()
+	torndown := 0
+	for _, req := range requests {
+		if req.Action == "teardown" {
+			torndown++
+		}
+	}
+	if torndown != 2 {
+		t.Error("Wrong number of teardowns:", requests)
+	}
+	if len(lm.TeamLabs(TestTeamID)) != 0 {
+		t.Error("Labs remembered after teardown:", lm.TeamLabs(TestTeamID))
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// ListenerUpdateInterval is how often listeners are started and stopped
+// as puzzles come and go.
+// Finding them means reading every puzzle,
+// so it's not as often as other maintenance.
+const ListenerUpdateInterval = 30 * time.Second
+
+// ParsePortRange parses a range of ports, like "31000-31099".
+func ParsePortRange(s string) (low, high int, err error) {
+	lowstr, highstr, ok := strings.Cut(s, "-")
+	if !ok {
+		highstr = lowstr
+	}
+	if low, err = strconv.Atoi(strings.TrimSpace(lowstr)); err != nil {
+		return 0, 0, fmt.Errorf("port range: %w", err)
+	}
+	if high, err = strconv.Atoi(strings.TrimSpace(highstr)); err != nil {
+		return 0, 0, fmt.Errorf("port range: %w", err)
+	}
+	if (low < 1) || (high > 65535) || (low > high) {
+		return 0, 0, fmt.Errorf("port range: %s is not a range of ports", s)
+	}
+	return low, high, nil
+}
+
+// TCPListenerManager runs the TCP listeners puzzles ask for.
+//
+// Each puzzle's listener gets a port in a range,
+// and runs the puzzle's command for every connection to it,
+// with the connection as its standard input and output.
+type TCPListenerManager struct {
+	server *MothServer
+
+	// Bind is the address listeners bind to. Empty means every address.
+	Bind string
+
+	// LowPort and HighPort are the range of ports listeners may use
+	LowPort, HighPort int
+
+	// Timeout is how long a command may run for one connection
+	Timeout time.Duration
+
+	// MaxConns is how many connections each listener handles at once.
+	// Connections past that are closed right away.
+	MaxConns int
+
+	// Sandbox, if set, is a command and its arguments
+	// which listener commands are run under
+	Sandbox []string
+
+	lock      sync.RWMutex
+	listeners map[puzzleID]*runningListener
+}
+
+type runningListener struct {
+	spec     transpile.TCPListener
+	port     int
+	listener net.Listener
+	conns    chan struct{}
+}
+
+// NewTCPListenerManager returns a new TCPListenerManager for the puzzles on server,
+// using ports low through high.
+func NewTCPListenerManager(server *MothServer, low, high int) *TCPListenerManager {
+	return &TCPListenerManager{
+		server:    server,
+		LowPort:   low,
+		HighPort:  high,
+		Timeout:   5 * time.Minute,
+		MaxConns:  16,
+		listeners: make(map[puzzleID]*runningListener),
+	}
+}
+
+// Maintain starts and stops listeners as puzzles come and go, every updateInterval.
+func (lm *TCPListenerManager) Maintain(updateInterval time.Duration) {
+	lm.Update()
+	for range time.NewTicker(updateInterval).C {
+		lm.Update()
+	}
+}
+
+// Update starts listeners for puzzles that want one,
+// and stops listeners for puzzles that are gone or have changed.
+func (lm *TCPListenerManager) Update() {
+	wanted := make(map[puzzleID]transpile.TCPListener)
+	forEachPuzzle(lm.server, func(cat string, points int, puzzle transpile.Puzzle) {
+		if puzzle.Listener != nil {
+			wanted[puzzleID{cat, points}] = *puzzle.Listener
+		}
+	})
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	for key, rl := range lm.listeners {
+		if spec, ok := wanted[key]; !ok || (spec != rl.spec) {
+			rl.listener.Close()
+			delete(lm.listeners, key)
+		}
+	}
+
+	// Puzzles asking for a port get it before ports are picked for the others,
+	// and ports are picked in the same order every time.
+	keys := make([]puzzleID, 0, len(wanted))
+	reserved := make(map[int]bool)
+	for key, spec := range wanted {
+		keys = append(keys, key)
+		if spec.Port != 0 {
+			reserved[spec.Port] = true
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (wanted[a].Port == 0) != (wanted[b].Port == 0) {
+			return wanted[a].Port != 0
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Points < b.Points
+	})
+
+	for _, key := range keys {
+		spec := wanted[key]
+		if _, ok := lm.listeners[key]; ok {
+			continue
+		}
+		rl, err := lm.listen(spec, reserved)
+		if err != nil {
+			slog.Error("starting listener", "category", key.Category, "points", key.Points, "error", err)
+			continue
+		}
+		lm.listeners[key] = rl
+		slog.Info("listening", "category", key.Category, "points", key.Points, "port", rl.port)
+		go lm.serve(key, rl)
+	}
+}
+
+// listen starts listening on the port spec asks for,
+// or the first free port in range that isn't reserved, if it doesn't ask for one.
+// The caller must hold lm.lock.
+func (lm *TCPListenerManager) listen(spec transpile.TCPListener, reserved map[int]bool) (*runningListener, error) {
+	ports := make([]int, 0)
+	if spec.Port != 0 {
+		if (spec.Port < lm.LowPort) || (spec.Port > lm.HighPort) {
+			return nil, fmt.Errorf("port %d is outside %d-%d", spec.Port, lm.LowPort, lm.HighPort)
+		}
+		ports = append(ports, spec.Port)
+	} else {
+		used := make(map[int]bool)
+		for port := range reserved {
+			used[port] = true
+		}
+		for _, rl := range lm.listeners {
+			used[rl.port] = true
+		}
+		for port := lm.LowPort; port <= lm.HighPort; port++ {
+			if !used[port] {
+				ports = append(ports, port)
+			}
+		}
+	}
+
+	err := fmt.Errorf("no free ports in %d-%d", lm.LowPort, lm.HighPort)
+	for _, port := range ports {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", net.JoinHostPort(lm.Bind, strconv.Itoa(port)))
+		if err == nil {
+			return &runningListener{
+				spec:     spec,
+				port:     port,
+				listener: ln,
+				conns:    make(chan struct{}, max(lm.MaxConns, 1)),
+			}, nil
+		}
+	}
+	return nil, err
+}
+
+// serve accepts connections until rl is closed.
+func (lm *TCPListenerManager) serve(key puzzleID, rl *runningListener) {
+	for {
+		conn, err := rl.listener.Accept()
+		if err != nil {
+			return
+		}
+		select {
+		case rl.conns <- struct{}{}:
+			go func() {
+				defer func() { <-rl.conns }()
+				lm.handle(key, rl.spec, conn)
+			}()
+		default:
+			slog.Warn("listener busy", "category", key.Category, "points", key.Points, "remote", conn.RemoteAddr().String())
+			conn.Close()
+		}
+	}
+}
+
+// handle runs a listener's command for one connection.
+//
+// The command runs in a new temporary directory,
+// with next to nothing in its environment,
+// and is killed after lm.Timeout.
+func (lm *TCPListenerManager) handle(key puzzleID, spec transpile.TCPListener, conn net.Conn) {
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+	log := slog.Default().With("category", key.Category, "points", key.Points, "remote", remote)
+
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		log.Error("listener connection isn't TCP")
+		return
+	}
+	f, err := tcpConn.File()
+	if err != nil {
+		log.Error("listener connection", "error", err)
+		return
+	}
+	defer f.Close()
+
+	dir, err := os.MkdirTemp("", "moth-listener-")
+	if err != nil {
+		log.Error("listener directory", "error", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), lm.Timeout)
+	defer cancel()
+
+	args := append(append([]string{}, lm.Sandbox...), spec.Command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"REMOTE_ADDR=" + remote,
+	}
+	cmd.Stdin = f
+	cmd.Stdout = f
+
+	log.Info("listener connection")
+	if err := cmd.Run(); err != nil {
+		log.Info("listener command", "error", err)
+	}
+}
+
+// Ports returns the port of every listener for a puzzle in puzzles.
+func (lm *TCPListenerManager) Ports(puzzles map[string][]int) map[string]map[int]int {
+	lm.lock.RLock()
+	defer lm.lock.RUnlock()
+	ret := make(map[string]map[int]int)
+	for cat, pointsList := range puzzles {
+		for _, points := range pointsList {
+			if rl, ok := lm.listeners[puzzleID{cat, points}]; ok {
+				if ret[cat] == nil {
+					ret[cat] = make(map[int]int)
+				}
+				ret[cat][points] = rl.port
+			}
+		}
+	}
+	return ret
+}
+
+// Close stops every listener.
+func (lm *TCPListenerManager) Close() {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+	for key, rl := range lm.listeners {
+		rl.listener.Close()
+		delete(lm.listeners, key)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePortRange(t *testing.T) {
+	cases := []struct {
+		s         string
+		low, high int
+		ok        bool
+	}{
+		{"31000-31099", 31000, 31099, true},
+		{"31337", 31337, 31337, true},
+		{" 1 - 2 ", 1, 2, true},
+		{"31099-31000", 0, 0, false},
+		{"0-10", 0, 0, false},
+		{"1-65536", 0, 0, false},
+		{"lots", 0, 0, false},
+	}
+	for _, c := range cases {
+		low, high, err := ParsePortRange(c.s)
+		if (err == nil) != c.ok || (low != c.low) || (high != c.high) {
+			t.Errorf("%q: got %d, %d, %v", c.s, low, high, err)
+		}
+	}
+}
+
+// freePorts returns the start of a range of n ports that were free a moment ago.
+func freePorts(t *testing.T, n int) int {
+	for start := 32000; start < 60000; start += 100 {
+		free := true
+		for port := start; port < start+n; port++ {
+			ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err != nil {
+				free = false
+				break
+			}
+			ln.Close()
+		}
+		if free {
+			return start
+		}
+	}
+	t.Skip("no free ports")
+	return 0
+}
+
+func TestTCPListeners(t *testing.T) {
+	command := filepath.Join(t.TempDir(), "greet")
+	script := "#!/bin/sh\nread name\necho \"hello $name from $REMOTE_ADDR\"\n"
+	if err := os.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	low := freePorts(t, 3)
+
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"listenegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n2\n3\n"},
+			{"answers.txt", "1 one\n2 two\n3 three\n"},
+			{"1/puzzle.json", fmt.Sprintf(`{"Listener": {"Command": "%s"}}`, command)},
+			{"2/puzzle.json", fmt.Sprintf(`{"Listener": {"Command": "%s", "Port": %d}}`, command, low)},
+			{"3/puzzle.json", `{}`},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+
+	lm := NewTCPListenerManager(server.MothServer, low, low+2)
+	lm.Bind = "127.0.0.1"
+	lm.Timeout = 5 * time.Second
+	server.TCPListeners = lm
+	lm.Update()
+	defer lm.Close()
+
+	all := map[string][]int{"listenegory": {1, 2, 3}}
+	ports := lm.Ports(all)["listenegory"]
+	if (len(ports) != 2) || (ports[2] != low) || (ports[1] != low+1) {
+		t.Fatal("Wrong ports:", ports)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", ports[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(conn, "moth")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "hello moth from 127.0.0.1:") {
+		t.Error("Wrong response:", line)
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+	if export := handler.ExportState(); (len(export.ListenerPorts["listenegory"]) != 1) || (export.ListenerPorts["listenegory"][1] != low+1) {
+		t.Error("Wrong listener ports exported:", export.ListenerPorts)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// loadTestUsage describes the loadtest command.
+const loadTestUsage = `Usage: mothd loadtest [FLAGS] URL
+
+Simulates teams playing on the mothd at URL, and reports how long it took to answer.
+Each team registers, then polls the state, opens puzzles, and submits wrong answers.
+Team IDs must be in the server's teamids.txt, or the server must be in development mode.
+Don't point this at an event in progress: every wrong answer goes in its event log.
+
+Flags:`
+
+// LoadTest simulates teams using a mothd server.
+type LoadTest struct {
+	// URL is where the server is
+	URL string
+
+	// TeamIDs are the teams to play as, one goroutine each
+	TeamIDs []string
+
+	// Duration is how long to keep playing
+	Duration time.Duration
+
+	// Poll is how often each team gets the state, give or take half
+	Poll time.Duration
+
+	// AnswerRate is the chance of submitting an answer after each poll
+	AnswerRate float64
+
+	// ContentRate is the chance of opening a puzzle after each poll
+	ContentRate float64
+
+	Client *http.Client
+
+	lock    sync.Mutex
+	results map[string]*loadTestResult
+}
+
+// loadTestResult is what happened to one kind of request.
+type loadTestResult struct {
+	Latencies []time.Duration
+	Errors    int
+	LastError string
+}
+
+// RunLoadTest runs "mothd loadtest" with args, writing the report to w.
+func RunLoadTest(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), loadTestUsage)
+		fs.PrintDefaults()
+	}
+	teams := fs.Int("teams", 50, "Number of teams to simulate")
+	prefix := fs.String("team-prefix", "loadtest-", "Team IDs are this, followed by a number")
+	teamIDs := fs.String("teamids", "", "File of team IDs to use instead, one per line")
+	duration := fs.Duration("duration", time.Minute, "How long to run")
+	poll := fs.Duration("poll", 5*time.Second, "How often each team gets the state")
+	answerRate := fs.Float64("answer-rate", 0.2, "Chance of submitting an answer after each poll")
+	contentRate := fs.Float64("content-rate", 0.5, "Chance of opening a puzzle after each poll")
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("loadtest needs a URL")
+	}
+
+	lt := NewLoadTest(fs.Arg(0))
+	lt.Duration = *duration
+	lt.Poll = *poll
+	lt.AnswerRate = *answerRate
+	lt.ContentRate = *contentRate
+	if *teamIDs != "" {
+		buf, err := os.ReadFile(*teamIDs)
+		if err != nil {
+			return err
+		}
+		lt.TeamIDs = strings.Fields(string(buf))
+		if len(lt.TeamIDs) > *teams {
+			lt.TeamIDs = lt.TeamIDs[:*teams]
+		}
+	} else {
+		for i := 0; i < *teams; i++ {
+			lt.TeamIDs = append(lt.TeamIDs, fmt.Sprintf("%s%d", *prefix, i))
+		}
+	}
+	if len(lt.TeamIDs) == 0 {
+		return fmt.Errorf("no teams to simulate")
+	}
+
+	fmt.Fprintf(w, "Simulating %d teams against %s for %s\n\n", len(lt.TeamIDs), lt.URL, lt.Duration)
+	lt.Run()
+	lt.Report(w)
+	return nil
+}
+
+// NewLoadTest returns a LoadTest against the server at url, with default settings.
+func NewLoadTest(url string) *LoadTest {
+	return &LoadTest{
+		URL:         strings.TrimRight(url, "/"),
+		Duration:    time.Minute,
+		Poll:        5 * time.Second,
+		AnswerRate:  0.2,
+		ContentRate: 0.5,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		results:     make(map[string]*loadTestResult),
+	}
+}
+
+// Run plays every team at once, until Duration has passed.
+func (lt *LoadTest) Run() {
+	deadline := time.Now().Add(lt.Duration)
+	var wg sync.WaitGroup
+	for _, teamID := range lt.TeamIDs {
+		wg.Add(1)
+		go func(teamID string) {
+			defer wg.Done()
+			lt.play(teamID, deadline)
+		}(teamID)
+	}
+	wg.Wait()
+}
+
+// play is one team playing until deadline.
+func (lt *LoadTest) play(teamID string, deadline time.Time) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// Don't have every team show up at the same instant
+	time.Sleep(time.Duration(rng.Int63n(int64(lt.Poll) + 1)))
+
+	var reg struct {
+		Status string `json:"status"`
+	}
+	form := url.Values{"id": {teamID}, "name": {"Load Test " + teamID}}
+	if err := lt.request("register", http.MethodPost, "/register", form, &reg); err == nil && (reg.Status != "success") {
+		lt.record("register", 0, fmt.Errorf("not registered: %s", reg.Status))
+	}
+
+	for time.Now().Before(deadline) {
+		var state struct {
+			Puzzles map[string][]int
+		}
+		lt.request("state", http.MethodGet, "/state?id="+url.QueryEscape(teamID), nil, &state)
+
+		puzzles := make([][2]string, 0)
+		for cat, pointsList := range state.Puzzles {
+			for _, points := range pointsList {
+				if points > 0 {
+					puzzles = append(puzzles, [2]string{cat, fmt.Sprint(points)})
+				}
+			}
+		}
+		if len(puzzles) > 0 {
+			p := puzzles[rng.Intn(len(puzzles))]
+			if rng.Float64() < lt.ContentRate {
+				path := fmt.Sprintf("/content/%s/%s/puzzle.json?id=%s", url.PathEscape(p[0]), p[1], url.QueryEscape(teamID))
+				lt.request("content", http.MethodGet, path, nil, nil)
+			}
+			if rng.Float64() < lt.AnswerRate {
+				form := url.Values{"id": {teamID}, "cat": {p[0]}, "points": {p[1]}, "answer": {"mothd loadtest"}}
+				lt.request("answer", http.MethodPost, "/answer", form, nil)
+			}
+		}
+
+		// Half to one and a half times Poll, so teams drift apart
+		time.Sleep(lt.Poll/2 + time.Duration(rng.Int63n(int64(lt.Poll)+1)))
+	}
+}
+
+// request makes a request, timing it, and decodes a JSON response into v, if it's not nil.
+func (lt *LoadTest) request(kind, method, path string, form url.Values, v any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, lt.URL+path, body)
+	if err != nil {
+		lt.record(kind, 0, err)
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	start := time.Now()
+	resp, err := lt.Client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("%s", resp.Status)
+		} else if v != nil {
+			err = json.NewDecoder(resp.Body).Decode(v)
+		} else {
+			_, err = io.Copy(io.Discard, resp.Body)
+		}
+	}
+	lt.record(kind, time.Since(start), err)
+	return err
+}
+
+// record remembers how long a request took, or that it failed.
+func (lt *LoadTest) record(kind string, latency time.Duration, err error) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+	r, ok := lt.results[kind]
+	if !ok {
+		r = new(loadTestResult)
+		lt.results[kind] = r
+	}
+	if err != nil {
+		r.Errors++
+		r.LastError = err.Error()
+	} else {
+		r.Latencies = append(r.Latencies, latency)
+	}
+}
+
+// percentile returns the latency p percent of requests were faster than.
+// latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencies)-1) * p / 100)
+	return latencies[i]
+}
+
+// Report writes a table of latencies for each kind of request.
+func (lt *LoadTest) Report(w io.Writer) {
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+
+	kinds := make([]string, 0, len(lt.results))
+	for kind := range lt.results {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "request\tok\terrors\tp50\tp90\tp99\tmax\t")
+	for _, kind := range kinds {
+		r := lt.results[kind]
+		sort.Slice(r.Latencies, func(i, j int) bool { return r.Latencies[i] < r.Latencies[j] })
+		fmt.Fprintf(
+			tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t\n",
+			kind, len(r.Latencies), r.Errors,
+			percentile(r.Latencies, 50).Round(time.Microsecond),
+			percentile(r.Latencies, 90).Round(time.Microsecond),
+			percentile(r.Latencies, 99).Round(time.Microsecond),
+			percentile(r.Latencies, 100).Round(time.Microsecond),
+		)
+	}
+	tw.Flush()
+	for _, kind := range kinds {
+		if r := lt.results[kind]; r.Errors > 0 {
+			fmt.Fprintf(w, "last %s error: %s\n", kind, r.LastError)
+		}
+	}
+}
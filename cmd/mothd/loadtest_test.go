@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTest(t *testing.T) {
+	server := NewTestServer()
+	go slurp(server.State.(*State).refreshNow)
+	server.State.SetTeamName(TestTeamID, "Already Here")
+	server.refresh()
+	ts := httptest.NewServer(NewHTTPServer("/", server.MothServer))
+	defer ts.Close()
+
+	lt := NewLoadTest(ts.URL + "/")
+	lt.TeamIDs = []string{TestTeamID, "nobody"}
+	lt.Duration = 200 * time.Millisecond
+	lt.Poll = 20 * time.Millisecond
+	lt.AnswerRate = 1
+	lt.ContentRate = 1
+	lt.Run()
+
+	for _, kind := range []string{"state", "content", "answer"} {
+		if r := lt.results[kind]; (r == nil) || (len(r.Latencies) == 0) || (r.Errors > 0) {
+			t.Errorf("Wrong %s results: %#v", kind, r)
+		}
+	}
+	if r := lt.results["register"]; (r == nil) || (r.Errors != 1) {
+		t.Errorf("Unknown team registered: %#v", r)
+	}
+
+	buf := new(bytes.Buffer)
+	lt.Report(buf)
+	if !strings.Contains(buf.String(), "p99") || !strings.Contains(buf.String(), "last register error") {
+		t.Error("Wrong report:", buf.String())
+	}
+}
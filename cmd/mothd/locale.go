@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// acceptLanguages returns the languages in an Accept-Language header,
+// most preferred first.
+// A language with a region, like "pt-BR",
+// is followed by the language alone, like "pt", unless that's listed too.
+func acceptLanguages(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+
+	tags := []weighted{}
+	listed := make(map[string]bool)
+	for _, field := range strings.Split(header, ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(field), ";")
+		locale = strings.ToLower(strings.TrimSpace(locale))
+		if !transpile.ValidLocale(locale) {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{locale, q})
+		listed[locale] = true
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	ret := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		ret = append(ret, tag.locale)
+		if lang, _, ok := strings.Cut(tag.locale, "-"); ok && !listed[lang] {
+			ret = append(ret, lang)
+			listed[lang] = true
+		}
+	}
+	return ret
+}
+
+// translationLocale returns the locale of a translated puzzle.json,
+// like "es" for "puzzle.es.json".
+func translationLocale(filename string) (string, bool) {
+	locale, ok := strings.CutPrefix(filename, "puzzle.")
+	if !ok {
+		return "", false
+	}
+	locale, ok = strings.CutSuffix(locale, ".json")
+	if !ok || !transpile.ValidLocale(locale) {
+		return "", false
+	}
+	return locale, true
+}
+
+// requestLocales returns the languages a request would like things in,
+// most preferred first:
+// the team's language, if it has picked one,
+// then the languages in the Accept-Language header.
+func (mh *MothRequestHandler) requestLocales(req *http.Request) []string {
+	locales := acceptLanguages(req.Header.Get("Accept-Language"))
+	if _, err := mh.State.TeamName(mh.teamID); err != nil {
+		return locales
+	}
+	if locale, err := mh.State.TeamLocale(mh.teamID); err == nil {
+		return append([]string{locale}, locales...)
+	}
+	return locales
+}
+
+// translationChain returns the languages to look for strings in,
+// least preferred first:
+// the default locale, then locale without its region, then locale.
+func translationChain(def, locale string) []string {
+	chain := []string{}
+	seen := make(map[string]bool)
+	add := func(l string) {
+		if (l != "") && !seen[l] {
+			chain = append(chain, l)
+			seen[l] = true
+		}
+	}
+	locale = strings.ToLower(locale)
+	add(strings.ToLower(def))
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		add(lang)
+	}
+	add(locale)
+	return chain
+}
+
+// Translations returns the theme's string catalog for locale, as a JSON object.
+//
+// The theme has a catalog for each language in translations/LOCALE.json.
+// Strings missing from the catalog for locale
+// come from the catalog for the language without its region,
+// then the catalog for the server's default locale.
+func (mh *MothRequestHandler) Translations(locale string) ([]byte, time.Time, error) {
+	if !transpile.ValidLocale(locale) {
+		return nil, time.Time{}, ErrInvalidLocale
+	}
+
+	strs := make(map[string]json.RawMessage)
+	found := false
+	var mtime time.Time
+	for _, l := range translationChain(mh.Config.Locale, locale) {
+		f, ts, err := mh.ThemeOpen("/translations/" + l + ".json")
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(f).Decode(&strs)
+		f.Close()
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("translations/%s.json: %w", l, err)
+		}
+		found = true
+		if ts.After(mtime) {
+			mtime = ts
+		}
+	}
+	if !found {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+
+	buf, err := json.Marshal(strs)
+	return buf, mtime, err
+}
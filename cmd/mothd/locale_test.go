@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAcceptLanguages(t *testing.T) {
+	cases := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"es", []string{"es"}},
+		{"pt-BR, en;q=0.8", []string{"pt-br", "pt", "en"}},
+		{"en;q=0.5, fr-CA, fr;q=0.9, *;q=0.1", []string{"fr-ca", "fr", "en"}},
+		{"de;q=0, it, ../../etc;q=1", []string{"it"}},
+	}
+	for _, c := range cases {
+		if got := acceptLanguages(c.header); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("acceptLanguages(%q) = %q, want %q", c.header, got, c.want)
+		}
+	}
+}
+
+func TestTranslationLocale(t *testing.T) {
+	if locale, ok := translationLocale("puzzle.pt-br.json"); !ok || (locale != "pt-br") {
+		t.Error("Wrong locale", locale, ok)
+	}
+	for _, filename := range []string{"puzzle.json", "moo.txt", "puzzle.../x.json"} {
+		if _, ok := translationLocale(filename); ok {
+			t.Error("Not a translation:", filename)
+		}
+	}
+}
+
+func TestTranslationChain(t *testing.T) {
+	if got := translationChain("en", "pt-BR"); !reflect.DeepEqual(got, []string{"en", "pt", "pt-br"}) {
+		t.Error("Wrong chain", got)
+	}
+	if got := translationChain("en", "en"); !reflect.DeepEqual(got, []string{"en"}) {
+		t.Error("Wrong chain", got)
+	}
+}
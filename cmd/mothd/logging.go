@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// RequestIDHeader is the response header holding a request's ID.
+// The same ID appears in every log entry for that request.
+const RequestIDHeader = "X-Request-ID"
+
+// NewLogger returns a structured logger writing to w.
+//
+// format is "text" for key=value pairs, or "json" for one JSON object per line.
+func NewLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format: %s", format)
+}
+
+type requestIDKey struct{}
+
+// newRequestID returns a new random request ID.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// withRequestID returns a copy of ctx carrying request ID id.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or the empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
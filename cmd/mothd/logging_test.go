@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, err := NewLogger(buf, "json", slog.LevelWarn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "team", "alpha")
+
+	entry := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	if (entry["msg"] != "shown") || (entry["team"] != "alpha") {
+		t.Error("Wrong log entry:", entry)
+	}
+
+	if _, err := NewLogger(buf, "xml", slog.LevelInfo); err == nil {
+		t.Error("Unknown format accepted")
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger, _ := NewLogger(buf, "json", slog.LevelInfo)
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	server := NewTestServer()
+	hs := NewHTTPServer("/", server.MothServer)
+	r := hs.TestRequest("/answer", map[string]string{"cat": "pategory", "points": "1", "answer": "moo"})
+	id := r.Result().Header.Get(RequestIDHeader)
+	if id == "" {
+		t.Fatal("No request ID header")
+	}
+
+	found := false
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["msg"] != "wrong answer" {
+			continue
+		}
+		found = true
+		switch {
+		case entry["request"] != id:
+			t.Error("Wrong request ID:", entry)
+		case entry["team"] != TestTeamID:
+			t.Error("Wrong team:", entry)
+		case entry["category"] != "pategory":
+			t.Error("Wrong category:", entry)
+		case entry["points"] != 1.0:
+			t.Error("Wrong points:", entry)
+		}
+	}
+	if !found {
+		t.Error("Wrong answer not logged:", buf.String())
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// MailerQueueLength is how many messages can wait to be sent.
+// Messages arriving when the queue is full are dropped.
+const MailerQueueLength = 100
+
+// MailerAttempts is how many times sending a message is attempted.
+const MailerAttempts = 3
+
+// mailerTemplates are the default message templates.
+// Each can be replaced by defining a template with the same name.
+//
+// A template renders a "Subject:" line, a blank line, and the body.
+const mailerTemplates = `
+{{define "register"}}Subject: Your team ID for {{.TeamName}}
+
+{{.TeamName}} is registered.
+Your team ID is:
+
+    {{.TeamID}}
+
+Keep it somewhere safe:
+you'll need it to play from another browser.
+{{if .URL}}
+{{.URL}}
+{{end}}{{end}}
+
+{{define "recover"}}Subject: Your team IDs
+
+Somebody asked for the team IDs registered with this address.
+{{range .Teams}}
+    {{.Name}}: {{.ID}}
+{{end}}
+If it wasn't you, you can ignore this message.
+{{if .URL}}
+{{.URL}}
+{{end}}{{end}}
+
+{{define "results"}}Subject: Final results for {{.TeamName}}
+
+{{if .Rank}}{{.TeamName}} finished in place {{.Rank}} of {{.TeamCount}}, with a score of {{printf "%.2f" .Score}}.{{else}}{{.TeamName}} didn't score this time.{{end}}
+
+Thanks for playing!
+{{if .URL}}
+{{.URL}}
+{{end}}{{end}}
+`
+
+// MailMessage is the data given to mailer templates.
+type MailMessage struct {
+	To  string
+	URL string
+
+	// TeamID and TeamName are the team the message is about.
+	// They're empty in "recover" messages, which use Teams.
+	TeamID   string
+	TeamName string
+
+	// Teams are the teams registered with To
+	Teams []MailTeam
+
+	// Rank is the team's place on the scoreboard, out of TeamCount.
+	// It's zero if the team didn't score.
+	Rank      int
+	TeamCount int
+	Score     float64
+}
+
+// MailTeam is one team in a "recover" message.
+type MailTeam struct {
+	ID   string
+	Name string
+}
+
+// mailItem is a rendered message waiting to be sent.
+type mailItem struct {
+	to   string
+	name string
+	msg  []byte
+}
+
+// Mailer sends email to teams, through an SMTP server:
+// their team ID when they register, their team IDs when they ask,
+// and their results when an administrator asks.
+type Mailer struct {
+	// Addr is the SMTP server, as host:port
+	Addr string
+	From string
+	Auth smtp.Auth
+
+	// URL of the event, for links in messages
+	URL string
+
+	Templates *template.Template
+
+	// Interval is the shortest time allowed between messages to one address.
+	// Results aren't limited.
+	Interval time.Duration
+
+	// send is smtp.SendMail, except in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+	queue chan mailItem
+
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// NewMailer returns a Mailer sending through the SMTP server at addr, from from.
+//
+// If auth isn't empty, it's username:password,
+// sent only over an encrypted connection, or to localhost.
+func NewMailer(addr, from, auth string) *Mailer {
+	m := &Mailer{
+		Addr:      addr,
+		From:      from,
+		Templates: template.Must(template.New("mailer").Parse(mailerTemplates)),
+		Interval:  5 * time.Minute,
+		send:      smtp.SendMail,
+		queue:     make(chan mailItem, MailerQueueLength),
+		last:      make(map[string]time.Time),
+	}
+	if username, password, ok := strings.Cut(auth, ":"); ok {
+		host, _, _ := net.SplitHostPort(addr)
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// LoadTemplates reads message templates from filename,
+// replacing any default templates with the same name.
+//
+// Templates are "register", "recover", and "results",
+// and are given a MailMessage.
+func (m *Mailer) LoadTemplates(filename string) error {
+	_, err := m.Templates.ParseFiles(filename)
+	return err
+}
+
+// allow returns true, and starts a new Interval, if the last Interval for key is over.
+func (m *Mailer) allow(key string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	for k, when := range m.last {
+		if now.Sub(when) >= m.Interval {
+			delete(m.last, k)
+		}
+	}
+	if _, ok := m.last[key]; ok {
+		return false
+	}
+	m.last[key] = now
+	return true
+}
+
+// render fills in the named template, and adds the rest of the headers.
+func (m *Mailer) render(name string, data MailMessage) ([]byte, error) {
+	data.URL = m.URL
+	buf := new(strings.Builder)
+	if err := m.Templates.ExecuteTemplate(buf, name, data); err != nil {
+		return nil, err
+	}
+	text := strings.TrimLeft(buf.String(), "\n")
+	subject, body, _ := strings.Cut(text, "\n\n")
+	subject, ok := strings.CutPrefix(subject, "Subject:")
+	if !ok {
+		return nil, fmt.Errorf("template %s doesn't start with a Subject: line", name)
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	msg := new(strings.Builder)
+	fmt.Fprintf(msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(msg, "To: %s\r\n", data.To)
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(msg, "Content-Transfer-Encoding: 8bit\r\n")
+	fmt.Fprintf(msg, "\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.TrimRight(body, "\n")+"\n", "\n", "\r\n"))
+	return []byte(msg.String()), nil
+}
+
+// Send renders the named template, and queues it to be sent to data.To.
+func (m *Mailer) Send(name string, data MailMessage) error {
+	msg, err := m.render(name, data)
+	if err != nil {
+		return err
+	}
+	select {
+	case m.queue <- mailItem{to: data.To, name: name, msg: msg}:
+		return nil
+	default:
+		return fmt.Errorf("mail queue full")
+	}
+}
+
+// Maintain sends queued messages, in order.
+// Failed messages are retried after updateInterval.
+func (m *Mailer) Maintain(updateInterval time.Duration) {
+	for item := range m.queue {
+		for attempt := 1; attempt <= MailerAttempts; attempt++ {
+			err := m.send(m.Addr, m.Auth, m.From, []string{item.to}, item.msg)
+			if err == nil {
+				slog.Info("sent mail", "template", item.name, "to", item.to)
+				break
+			}
+			slog.Warn("sending mail", "template", item.name, "to", item.to, "attempt", attempt, "error", err)
+			if attempt < MailerAttempts {
+				time.Sleep(updateInterval)
+			}
+		}
+	}
+}
+
+// parseEmail returns the address in s,
+// or the empty string if s is empty.
+func parseEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid email address: %q", s)
+	}
+	return addr.Address, nil
+}
+
+// TeamEmails returns the email address of every team that gave one,
+// by team ID.
+func (s *State) TeamEmails() map[string]string {
+	ret := make(map[string]string)
+	files, err := afero.ReadDir(s, "emails")
+	if err != nil {
+		return ret
+	}
+	for _, fi := range files {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		buf, err := afero.ReadFile(s, filepath.Join("emails", fi.Name()))
+		if err != nil {
+			slog.Error("reading team email", "team", fi.Name(), "error", err)
+			continue
+		}
+		if email := strings.TrimSpace(string(buf)); email != "" {
+			ret[fi.Name()] = email
+		}
+	}
+	return ret
+}
+
+// SetTeamEmail sets a team's email address.
+// An empty email forgets it.
+func (s *State) SetTeamEmail(teamID, email string) error {
+	emailFilename := filepath.Join("emails", teamID)
+	if email == "" {
+		if err := s.Remove(emailFilename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if strings.ContainsAny(email, "\r\n") {
+		return fmt.Errorf("invalid email address: %q", email)
+	}
+
+	s.Mkdir("emails", 0755)
+	return s.writeFileAtomic(emailFilename, []byte(email+"\n"))
+}
+
+// registerEmail records the email address this team gave when it registered as teamName,
+// and sends the team its ID there, if there's a Mailer.
+func (mh *MothRequestHandler) registerEmail(teamName, email string) error {
+	if err := mh.State.SetTeamEmail(mh.teamID, email); err != nil {
+		return err
+	}
+	if (mh.Mailer == nil) || (email == "") {
+		return nil
+	}
+	if !mh.Mailer.allow("to:" + strings.ToLower(email)) {
+		mh.log.Warn("not sending registration mail: too soon after the last one", "to", email)
+		return nil
+	}
+	return mh.Mailer.Send("register", MailMessage{
+		To:       email,
+		TeamID:   mh.teamID,
+		TeamName: teamName,
+	})
+}
+
+// RecoverByEmail sends the team IDs registered with email to it.
+//
+// Nothing is sent if no teams are registered with it,
+// or if it's been asked for too recently,
+// but that's not an error:
+// the requester shouldn't learn which addresses are registered.
+func (mh *MothRequestHandler) RecoverByEmail(email string) error {
+	if mh.Mailer == nil {
+		return fmt.Errorf("this server doesn't send email")
+	}
+	teams := make([]MailTeam, 0)
+	for teamID, e := range mh.State.TeamEmails() {
+		if !strings.EqualFold(e, email) {
+			continue
+		}
+		if name, err := mh.State.TeamName(teamID); err == nil {
+			teams = append(teams, MailTeam{ID: teamID, Name: name})
+		}
+	}
+	mh.State.LogEvent("recover", "", "", 0, fmt.Sprint(len(teams)))
+	if len(teams) == 0 {
+		return nil
+	}
+	if !mh.Mailer.allow("to:" + strings.ToLower(email)) {
+		mh.log.Warn("not recovering team IDs: too soon after the last mail", "to", email)
+		return nil
+	}
+	return mh.Mailer.Send("recover", MailMessage{To: email, Teams: teams})
+}
+
+// SendResults mails every team that gave an email address its place on the scoreboard.
+// It returns how many messages were queued.
+func (mh *MothRequestHandler) SendResults() (int, error) {
+	if mh.Mailer == nil {
+		return 0, fmt.Errorf("this server doesn't send email")
+	}
+	emails := mh.State.TeamEmails()
+	export := &StateExport{
+		Config:    mh.Config,
+		TeamNames: make(map[string]string),
+		PointsLog: mh.State.PointsLog(),
+		MaxPoints: mh.categoryTotals(),
+	}
+	for teamID := range emails {
+		export.TeamNames[teamID], _ = mh.State.TeamName(teamID)
+	}
+	if mh.Config.TieBreak == TieBreakAttempts {
+		export.attempts = make(map[string]int)
+		for _, awd := range export.PointsLog {
+			if _, ok := export.attempts[awd.TeamID]; !ok {
+				export.attempts[awd.TeamID] = totalAttempts(mh.State, awd.TeamID)
+			}
+		}
+	}
+	sb := NewScoreboard(export)
+	standings := make(map[string]ScoreboardTeam)
+	for _, team := range sb.Teams {
+		standings[team.id] = team
+	}
+
+	sent := 0
+	for teamID, email := range emails {
+		teamName, ok := export.TeamNames[teamID]
+		if !ok || (teamName == "") {
+			continue
+		}
+		team := standings[teamID]
+		err := mh.Mailer.Send("results", MailMessage{
+			To:        email,
+			TeamID:    teamID,
+			TeamName:  teamName,
+			Rank:      team.Rank,
+			TeamCount: len(sb.Teams),
+			Score:     team.Score,
+		})
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// RecoverHandler sends back the team ID a recovery code belongs to,
+// or mails the team IDs registered with an email address to it.
+func (h *HTTPServer) RecoverHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if code := req.FormValue("code"); code != "" {
+		h.recoverByCode(mh, w, code, req.FormValue("rotate"))
+		return
+	}
+	email, err := parseEmail(req.FormValue("email"))
+	if (err != nil) || (email == "") {
+		jsend.Sendf(w, jsend.Fail, "not sent", "a valid email address is required")
+		return
+	}
+	if err := mh.RecoverByEmail(email); err != nil {
+		jsend.Sendf(w, jsend.Fail, "not sent", err.Error())
+		return
+	}
+	jsend.Sendf(w, jsend.Success, "sent", "if any teams are registered with that address, their team IDs are on their way")
+}
+
+// AdminEmailResultsHandler mails every team its results.
+func (h *HTTPServer) AdminEmailResultsHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	sent, err := mh.SendResults()
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not sent", "%s (%d sent)", err.Error(), sent)
+		return
+	}
+	mh.log.Info("mailed results", "messages", sent)
+	jsend.Sendf(w, jsend.Success, "sent", "results sent to %d teams", sent)
+}
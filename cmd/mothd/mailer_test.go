@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailer(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	mailer := NewMailer("localhost:25", "moth@example.org", "")
+	mailer.URL = "https://moth.example.org/"
+	mailer.Interval = 0
+	server.Mailer = mailer
+	hs := NewHTTPServer("/", server.MothServer)
+
+	// next returns the next queued message, or the empty string
+	next := func() string {
+		select {
+		case item := <-mailer.queue:
+			return string(item.msg)
+		default:
+			return ""
+		}
+	}
+
+	if r := hs.TestRequest("/register", map[string]string{"name": "GoTeam", "email": "not an address"}); !strings.Contains(r.Body.String(), `"fail"`) {
+		t.Error("Registered with a bad email address:", r.Body.String())
+	}
+	if r := hs.TestRequest("/register", map[string]string{"name": "GoTeam", "email": "Go Team <team@example.org>"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Fatal("Not registered:", r.Body.String())
+	}
+	msg := next()
+	for _, s := range []string{"To: team@example.org\r\n", "Subject: Your team ID for GoTeam\r\n", "    " + TestTeamID + "\r\n", "https://moth.example.org/"} {
+		if !strings.Contains(msg, s) {
+			t.Errorf("Registration message doesn't have %q: %q", s, msg)
+		}
+	}
+	if e := state.TeamEmails()[TestTeamID]; e != "team@example.org" {
+		t.Error("Wrong email address stored:", e)
+	}
+	state.refresh()
+
+	if r := hs.TestRequest("/recover", map[string]string{"email": "TEAM@example.org"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error(r.Body.String())
+	}
+	if msg := next(); !strings.Contains(msg, "GoTeam: "+TestTeamID) {
+		t.Error("Recovery message doesn't have team ID:", msg)
+	}
+	if r := hs.TestRequest("/recover", map[string]string{"email": "nobody@example.org"}); !strings.Contains(r.Body.String(), `"success"`) {
+		t.Error("Unknown address should look the same:", r.Body.String())
+	}
+	if msg := next(); msg != "" {
+		t.Error("Recovery message sent to unknown address:", msg)
+	}
+
+	mailer.Interval = time.Hour
+	hs.TestRequest("/recover", map[string]string{"email": "team@example.org"})
+	hs.TestRequest("/recover", map[string]string{"email": "team@example.org"})
+	next()
+	if msg := next(); msg != "" {
+		t.Error("Recovery messages not rate limited")
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+	sent, err := handler.SendResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Error("Wrong number of results sent:", sent)
+	}
+	if msg := next(); !strings.Contains(msg, "GoTeam finished in place 1 of 1") {
+		t.Error("Wrong results message:", msg)
+	}
+}
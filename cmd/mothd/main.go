@@ -4,44 +4,445 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"mime"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
 )
 
 func main() {
+	// Kiosk builds serve what's built into them, and keep state out of the way
+	defaultTheme, defaultState, defaultMothballs := "theme", "state", "mothballs"
+	if kioskFiles != nil {
+		defaultTheme, defaultState, defaultMothballs = "", kioskStatePath(), ""
+	}
+
+	configPath := flag.String(
+		"config",
+		"",
+		"Path to a YAML file setting any of these options, overrides $MOTH_CONFIG",
+	)
+	validateConfig := flag.Bool(
+		"validate-config",
+		false,
+		"Check the options and config file for mistakes, then exit",
+	)
 	themePath := flag.String(
 		"theme",
-		"theme",
-		"Path to theme files",
+		defaultTheme,
+		"Path to theme files (empty, or missing, for the built-in theme)",
 	)
 	statePath := flag.String(
 		"state",
-		"state",
+		defaultState,
 		"Path to state files",
 	)
 	mothballPath := flag.String(
 		"mothballs",
-		"mothballs",
-		"Path to mothball files",
+		defaultMothballs,
+		"Path to mothball files, or s3://BUCKET/PREFIX (empty for the built-in mothballs of a kiosk build)",
 	)
 	puzzlePath := flag.String(
 		"puzzles",
 		"",
-		"Path to puzzles tree (enables development mode)",
+		"Path to puzzles tree, or s3://BUCKET/PREFIX (enables development mode)",
+	)
+	manifestPath := flag.String(
+		"manifest",
+		"",
+		"Path to an event manifest listing categories and mothballs (enables development mode)",
+	)
+	var remotePuzzles stringList
+	flag.Var(
+		&remotePuzzles,
+		"remote-puzzles",
+		"URL of a remote puzzle service (may be given more than once)",
+	)
+	remoteToken := flag.String(
+		"remote-token",
+		"",
+		"Token for remote puzzle services, overrides $MOTH_REMOTE_TOKEN",
+	)
+	var pluginPuzzles stringList
+	flag.Var(
+		&pluginPuzzles,
+		"plugin-puzzles",
+		"Command running a puzzle provider plugin (may be given more than once)",
+	)
+	pluginState := flag.String(
+		"plugin-state",
+		"",
+		"Command running a state provider plugin, used instead of -state",
+	)
+	var stateServices stringList
+	flag.Var(
+		&stateServices,
+		"state-service",
+		"Address of a state service, used instead of -state (may be given more than once, for failover)",
+	)
+	serveState := flag.String(
+		"serve-state",
+		"",
+		"Address to serve this mothd's state on, for -state-service frontends",
+	)
+	stateToken := flag.String(
+		"state-token",
+		"",
+		"Token shared by a state service and its frontends",
+	)
+	s3Cache := flag.String(
+		"s3-cache",
+		"s3-cache",
+		"Path to keep local copies of S3 mothballs and puzzles",
+	)
+	s3Endpoint := flag.String(
+		"s3-endpoint",
+		"",
+		"URL of S3-compatible object storage, overrides $AWS_ENDPOINT_URL",
+	)
+	s3Interval := flag.Duration(
+		"s3-interval",
+		1*time.Minute,
+		"Duration between checks for changes in S3",
+	)
+	mkpuzzleCache := flag.Duration(
+		"mkpuzzle-cache",
+		0,
+		"Reuse mkpuzzle and mkcategory output for this long, if nothing has changed (development mode)",
+	)
+	spellcheck := flag.String(
+		"spellcheck",
+		"",
+		"Comma-separated word lists to spellcheck puzzles with (development mode)",
+	)
+	checkLinks := flag.Bool(
+		"check-links",
+		false,
+		"Check links in puzzles to other web sites (development mode)",
+	)
+	var instances stringList
+	flag.Var(
+		&instances,
+		"instance",
+		"Serve another event as /PREFIX=DIR or HOST=DIR (may be given more than once)",
+	)
+	backupPath := flag.String(
+		"backup-dir",
+		"",
+		"Path to write periodic state backups to (no backups if empty)",
+	)
+	backupInterval := flag.Duration(
+		"backup-interval",
+		1*time.Hour,
+		"Duration between state backups",
+	)
+	backupKeep := flag.Int(
+		"backup-keep",
+		24,
+		"Number of state backups to keep (0 keeps them all)",
+	)
+	rotateSize := flag.Int64(
+		"rotate-size",
+		0,
+		"Rotate events.csv when it grows past this many bytes (0 never rotates)",
+	)
+	rotateKeep := flag.Int(
+		"rotate-keep",
+		10,
+		"Number of rotated event logs and old points logs to keep (0 keeps them all)",
 	)
 	refreshInterval := flag.Duration(
 		"refresh",
 		2*time.Second,
 		"Duration between maintenance tasks",
 	)
-	bindStr := flag.String(
+	var binds bindList
+	flag.Var(
+		&binds,
 		"bind",
-		":8080",
-		"Bind [host]:port for HTTP service",
+		"Address to serve on, like :8080, [::1]:8080, unix:/run/moth/moth.sock, or systemd, with options like ,notls (may be given more than once; default :8080)",
+	)
+	var tlsOpts TLSOptions
+	flag.StringVar(
+		&tlsOpts.CertFile,
+		"tls-cert",
+		"",
+		"Path to PEM-encoded TLS certificate (enables HTTPS)",
+	)
+	flag.StringVar(
+		&tlsOpts.KeyFile,
+		"tls-key",
+		"",
+		"Path to PEM-encoded TLS private key",
+	)
+	var autocertHosts stringList
+	flag.Var(
+		&autocertHosts,
+		"autocert",
+		"Host name to get a Let's Encrypt certificate for (enables HTTPS, may be given more than once)",
+	)
+	flag.StringVar(
+		&tlsOpts.AutocertCache,
+		"autocert-cache",
+		"autocert",
+		"Path to store Let's Encrypt certificates and account key",
+	)
+	flag.StringVar(
+		&tlsOpts.AutocertEmail,
+		"autocert-email",
+		"",
+		"Contact email address for Let's Encrypt",
+	)
+	flag.StringVar(
+		&tlsOpts.RedirectBind,
+		"redirect-bind",
+		"",
+		"Address to serve plain HTTP on, redirecting to HTTPS",
+	)
+	flag.DurationVar(
+		&tlsOpts.HSTSMaxAge,
+		"hsts",
+		0,
+		"Ask browsers to only use HTTPS for this long (e.g. 8760h)",
+	)
+	var config Configuration
+	flag.DurationVar(
+		&config.ReadTimeout,
+		"read-timeout",
+		30*time.Second,
+		"Longest time to read an entire request",
+	)
+	flag.DurationVar(
+		&config.ReadHeaderTimeout,
+		"read-header-timeout",
+		10*time.Second,
+		"Longest time to read request headers",
+	)
+	flag.DurationVar(
+		&config.WriteTimeout,
+		"write-timeout",
+		5*time.Minute,
+		"Longest time to write a response",
+	)
+	flag.DurationVar(
+		&config.IdleTimeout,
+		"idle-timeout",
+		2*time.Minute,
+		"Longest time to keep an idle connection open",
+	)
+	flag.IntVar(
+		&config.MaxHeaderBytes,
+		"max-header-bytes",
+		64*1024,
+		"Largest request header size",
+	)
+	flag.IntVar(
+		&config.MaxConnections,
+		"max-connections",
+		0,
+		"Most connections to have open at once (0 for no limit)",
+	)
+	flag.IntVar(
+		&config.WrongAnswers,
+		"wrong-answers",
+		0,
+		"Wrong answers a team may submit for a puzzle before a cooldown (0 for no limit)",
+	)
+	flag.DurationVar(
+		&config.AnswerCooldown,
+		"answer-cooldown",
+		time.Minute,
+		"How long a team waits after too many wrong answers, doubling each time",
+	)
+	flag.IntVar(
+		&config.DecoyAfter,
+		"decoy-after",
+		0,
+		"Wrong answers for a puzzle in an hour before a team looks like it's brute forcing (0 for never)",
+	)
+	flag.DurationVar(
+		&config.DecoyDelay,
+		"decoy-delay",
+		5*time.Second,
+		"How long to hold back wrong answers from a team that looks like it's brute forcing",
+	)
+	flag.Int64Var(
+		&config.UploadMaxSize,
+		"upload-max-size",
+		10*1024*1024,
+		"Largest file, in bytes, a team may upload to answer a puzzle",
+	)
+	flag.IntVar(
+		&config.RecoveryCodes,
+		"recovery-codes",
+		3,
+		"One-time recovery codes to give each team when it registers (0 for none)",
+	)
+	flag.DurationVar(
+		&config.SessionLifetime,
+		"session-lifetime",
+		24*time.Hour,
+		"How long a session cookie lasts (0 to send the team ID with every request instead)",
+	)
+	flag.DurationVar(
+		&config.SessionRotate,
+		"session-rotate",
+		time.Hour,
+		"How old a session cookie gets before it's swapped for a new one (0 for never)",
+	)
+	flag.BoolVar(
+		&config.Practice,
+		"practice",
+		false,
+		"Practice mode, after an event: unlock every puzzle, and check answers without awarding points",
+	)
+	flag.StringVar(
+		&config.Scoring,
+		"scoring",
+		ScoringRelative,
+		"Scoring model: relative, to the category leader, or percentage, of the points in each category",
+	)
+	flag.StringVar(
+		&config.TieBreak,
+		"tie-break",
+		"",
+		"Order teams with the same score by last-solve, attempts, or total-time (default: tied teams share a rank)",
+	)
+	flag.BoolVar(
+		&config.OpenRegistration,
+		"open-registration",
+		false,
+		"Let anybody create a team, and be given a new team ID, with /create-team",
+	)
+	flag.IntVar(
+		&config.MaxTeams,
+		"max-teams",
+		0,
+		"Most teams open registration may create (0 for no limit)",
+	)
+	flag.BoolVar(
+		&config.JoinCodes,
+		"join-codes",
+		false,
+		"Let teams hand out join codes, so members log in with their own member tokens instead of the team ID",
+	)
+	flag.IntVar(
+		&config.MaxTeamSize,
+		"max-team-size",
+		0,
+		"Most people a team may have, counting its owner, when members join with join codes (0 for no limit)",
+	)
+	flag.BoolVar(
+		&config.VerifyEmail,
+		"verify-email",
+		false,
+		"Make teams created by open registration give an email address, and only send their team ID there (needs -smtp)",
+	)
+	captchaURL := flag.String(
+		"captcha",
+		"",
+		"CAPTCHA verification URL teams must pass to create a team, like https://api.hcaptcha.com/siteverify",
+	)
+	captchaSecret := flag.String(
+		"captcha-secret",
+		"",
+		"Secret key for -captcha, overrides $CAPTCHA_SECRET",
+	)
+	flag.StringVar(
+		&config.CaptchaSiteKey,
+		"captcha-site-key",
+		"",
+		"Site key for -captcha, given to the theme to show the CAPTCHA",
+	)
+	flag.BoolVar(
+		&config.SessionOnly,
+		"session-only",
+		false,
+		"Require a session cookie: ignore team IDs sent with requests, except to log in",
+	)
+	flag.IntVar(
+		&config.UploadsPerHour,
+		"uploads-per-hour",
+		20,
+		"Files each team may upload in an hour (0 for no limit)",
+	)
+	flag.IntVar(
+		&config.MaxDownloads,
+		"max-downloads",
+		0,
+		"Files each team may be downloading from /content at once (0 for no limit)",
+	)
+	flag.Int64Var(
+		&config.DownloadRate,
+		"download-rate",
+		0,
+		"Bytes a second each team is sent from /content, over all its downloads (0 for no limit)",
+	)
+	uploadTimeout := flag.Duration(
+		"upload-timeout",
+		10*time.Second,
+		"How long an upload or command checker command may run",
+	)
+	uploadSandbox := flag.String(
+		"upload-sandbox",
+		"",
+		"Command, with arguments, to run upload and command checker commands under (like bwrap or nsjail)",
+	)
+	commandChecker := flag.Bool(
+		"command-checker",
+		false,
+		"Run the checker commands puzzles using the command checker ship with",
+	)
+	uploadChecker := flag.Bool(
+		"upload-checker",
+		false,
+		"Run the checker commands upload puzzles ship with",
+	)
+	flag.BoolVar(
+		&config.HTTP2,
+		"http2",
+		true,
+		"Allow HTTP/2 when serving HTTPS",
+	)
+	var allowNets, denyNets, trustedProxies stringList
+	flag.Var(
+		&allowNets,
+		"allow",
+		"Only allow participants from this CIDR network (may be given more than once)",
+	)
+	flag.Var(
+		&denyNets,
+		"deny",
+		"Refuse participants from this CIDR network (may be given more than once)",
+	)
+	flag.Var(
+		&trustedProxies,
+		"trusted-proxy",
+		"Believe X-Forwarded-For from this CIDR network (may be given more than once)",
+	)
+	var corsOrigins stringList
+	flag.Var(
+		&corsOrigins,
+		"cors-origin",
+		"Let web pages from this origin, like https://dash.example.com, use the API (may be given more than once; * for any)",
+	)
+	flag.BoolVar(
+		&config.CORSCredentials,
+		"cors-credentials",
+		false,
+		"Let pages from -cors-origin send session cookies",
+	)
+	flag.DurationVar(
+		&config.CORSMaxAge,
+		"cors-max-age",
+		10*time.Minute,
+		"How long browsers may cache CORS preflight responses",
 	)
 	base := flag.String(
 		"base",
@@ -53,39 +454,420 @@ func main() {
 		"",
 		"Random seed to use, overrides $SEED",
 	)
+	allowGETMutations := flag.Bool(
+		"allow-get-mutations",
+		false,
+		"Accept /answer and /register over GET, for old clients",
+	)
+	hideAnswerHashes := flag.Bool(
+		"hide-answer-hashes",
+		false,
+		"Send no answer hashes to clients: answers are only checked when submitted",
+	)
+	locale := flag.String(
+		"locale",
+		"en",
+		"Language of the theme's own strings, used when a translation is missing",
+	)
+	adminToken := flag.String(
+		"admin-token",
+		"",
+		"Token for /admin/ endpoints, overrides $MOTH_ADMIN_TOKEN (no /admin/ endpoints if empty)",
+	)
+	webhookSecret := flag.String(
+		"webhook-secret",
+		"",
+		"Secret used to sign webhook requests, overrides $WEBHOOK_SECRET",
+	)
+	var webhooks stringList
+	flag.Var(
+		&webhooks,
+		"webhook",
+		"URL to POST events to (may be given more than once)",
+	)
+	serviceInterval := flag.Duration(
+		"service-check-interval",
+		30*time.Second,
+		"How often to check the network services puzzles declare (0 to never check)",
+	)
+	listenerPorts := flag.String(
+		"listener-ports",
+		"",
+		"Range of TCP ports for puzzle listeners, like 31000-31099 (empty for no listeners)",
+	)
+	listenerBind := flag.String(
+		"listener-bind",
+		"",
+		"Address to bind puzzle listeners to (empty for every address)",
+	)
+	listenerTimeout := flag.Duration(
+		"listener-timeout",
+		5*time.Minute,
+		"How long a puzzle listener's command may run for one connection",
+	)
+	listenerMaxConns := flag.Int(
+		"listener-max-conns",
+		16,
+		"Connections each puzzle listener handles at once",
+	)
+	listenerSandbox := flag.String(
+		"listener-sandbox",
+		"",
+		"Command, with arguments, to run puzzle listener commands under (like bwrap or nsjail)",
+	)
+	labWebhook := flag.String(
+		"lab-webhook",
+		"",
+		"URL of an orchestrator to ask for puzzle labs (empty for no labs)",
+	)
+	labState := flag.String(
+		"lab-state",
+		"",
+		"File to keep track of provisioned labs in (default labs.json in -state)",
+	)
+	labPoll := flag.Duration(
+		"lab-poll",
+		10*time.Second,
+		"How often to ask the orchestrator about labs that aren't ready yet",
+	)
+	detectSharing := flag.Bool(
+		"detect-sharing",
+		false,
+		"Watch for identical wrong answers and shared addresses across teams, for /admin/sharing",
+	)
+	xapiEndpoint := flag.String(
+		"xapi",
+		"",
+		"xAPI learning record store endpoint to send statements to",
+	)
+	xapiAuth := flag.String(
+		"xapi-auth",
+		"",
+		"Learning record store credentials, as username:password, overrides $XAPI_AUTH",
+	)
+	xapiHome := flag.String(
+		"xapi-home",
+		"",
+		"URL of the event, identifying teams and puzzles in xAPI statements",
+	)
+	notifyURL := flag.String(
+		"notify",
+		"",
+		"Slack or Discord webhook URL for announcing first bloods, completions, and leader changes",
+	)
+	notifyTemplates := flag.String(
+		"notify-templates",
+		"",
+		"Path to text/template file overriding notification messages",
+	)
+	smtpAddr := flag.String(
+		"smtp",
+		"",
+		"SMTP server to send email to teams through, as host:port (empty for no email)",
+	)
+	smtpFrom := flag.String(
+		"smtp-from",
+		"",
+		"Address email to teams comes from",
+	)
+	smtpAuth := flag.String(
+		"smtp-auth",
+		"",
+		"SMTP credentials, as username:password, overrides $SMTP_AUTH",
+	)
+	smtpURL := flag.String(
+		"smtp-url",
+		"",
+		"URL of the event, for links in email to teams",
+	)
+	smtpTemplates := flag.String(
+		"smtp-templates",
+		"",
+		"Path to text/template file overriding email messages",
+	)
+	smtpInterval := flag.Duration(
+		"smtp-interval",
+		5*time.Minute,
+		"Shortest time between registration or recovery email to one address",
+	)
+	otlpEndpoint := flag.String(
+		"otlp-endpoint",
+		"",
+		"OpenTelemetry collector URL for exporting traces (default $OTEL_EXPORTER_OTLP_ENDPOINT)",
+	)
+	openBrowserFlag := flag.Bool(
+		"browser",
+		kioskFiles != nil,
+		"Open the event in a web browser on this computer once it's being served",
+	)
+	logLevel := flag.String(
+		"loglevel",
+		"info",
+		"Least important log messages to show: debug, info, warn, or error",
+	)
+	logFormat := flag.String(
+		"logformat",
+		"text",
+		"Log output format: text or json",
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTIONS] [COMMAND]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Every option can also be set in $%sOPTION_NAME, or in -config.\n", ConfigEnvPrefix)
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output(), adminUsage)
+	}
 	flag.Parse()
 
-	var theme *Theme
+	if *configPath == "" {
+		*configPath = os.Getenv(configEnvName("config"))
+	}
+	if err := LoadConfig(flag.CommandLine, *configPath, os.LookupEnv); err != nil {
+		log.Fatal(err)
+	}
+	if *validateConfig {
+		errs := CheckConfig(flag.CommandLine)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("configuration OK")
+		return
+	}
+
+	// Take sockets from systemd before running anything that could inherit them
+	systemdSockets.load()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal(err)
+	}
+	if logger, err := NewLogger(os.Stderr, *logFormat, level); err != nil {
+		log.Fatal(err)
+	} else {
+		slog.SetDefault(logger)
+	}
+
+	if flag.Arg(0) == "loadtest" {
+		if err := RunLoadTest(flag.Args()[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	osfs := afero.NewOsFs()
-	if p, err := filepath.Abs(*themePath); err != nil {
+	if flag.NArg() > 0 {
+		p, err := filepath.Abs(*statePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		state := NewState(afero.NewBasePathFs(osfs, p))
+		state.RotateKeep = *rotateKeep
+		if err := RunAdminCommand(state, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var theme *Theme
+	if *themePath == "" {
+		theme = NewDefaultTheme()
+		if kioskFiles != nil {
+			if fs, err := kioskFs("theme"); err != nil {
+				log.Fatal(err)
+			} else if _, err := fs.Stat("index.html"); err == nil {
+				theme = NewTheme(fs)
+			}
+		}
+	} else if p, err := filepath.Abs(*themePath); err != nil {
 		log.Fatal(err)
+	} else if _, err := os.Stat(p); os.IsNotExist(err) && (*themePath == defaultTheme) {
+		slog.Info("no theme directory, using the built-in theme", "path", p)
+		theme = NewDefaultTheme()
 	} else {
 		theme = NewTheme(afero.NewBasePathFs(osfs, p))
 	}
 
-	config := Configuration{}
-
-	var provider PuzzleProvider
-	if p, err := filepath.Abs(*mothballPath); err != nil {
+	config.AllowGETMutations = *allowGETMutations
+	if *adminToken == "" {
+		*adminToken = os.Getenv("MOTH_ADMIN_TOKEN")
+	}
+	config.AdminToken = *adminToken
+	config.HideAnswerHashes = *hideAnswerHashes
+	config.Email = (*smtpAddr != "")
+	config.Sessions = (config.SessionLifetime > 0)
+	if !transpile.ValidLocale(*locale) {
+		log.Fatalf("invalid -locale: %q", *locale)
+	}
+	config.Locale = strings.ToLower(*locale)
+	if err := ValidScoring(config.Scoring); err != nil {
+		log.Fatalf("invalid -scoring: %v", err)
+	}
+	if err := ValidTieBreak(config.TieBreak); err != nil {
+		log.Fatalf("invalid -tie-break: %v", err)
+	}
+	if config.VerifyEmail && !config.Email {
+		log.Fatal("-verify-email needs -smtp")
+	}
+	if nets, err := ParseCIDRs(allowNets); err != nil {
+		log.Fatal(err)
+	} else {
+		config.AllowNets = nets
+	}
+	if nets, err := ParseCIDRs(denyNets); err != nil {
+		log.Fatal(err)
+	} else {
+		config.DenyNets = nets
+	}
+	if nets, err := ParseCIDRs(trustedProxies); err != nil {
+		log.Fatal(err)
+	} else {
+		config.TrustedProxies = nets
+	}
+	if origins, err := ParseOrigins(corsOrigins); err != nil {
 		log.Fatal(err)
+	} else if config.CORSCredentials && slices.Contains(origins, "*") {
+		log.Fatal("-cors-credentials can't be used with -cors-origin '*'")
 	} else {
-		provider = NewMothballs(afero.NewBasePathFs(osfs, p))
+		config.CORSOrigins = origins
 	}
-	if *puzzlePath != "" {
-		if p, err := filepath.Abs(*puzzlePath); err != nil {
+
+	// contentFs returns a filesystem for a path, or for a local copy of an S3 location
+	contentFs := func(location string) afero.Fs {
+		if !strings.HasPrefix(location, S3Scheme) {
+			p, err := filepath.Abs(location)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return afero.NewBasePathFs(osfs, p)
+		}
+		p, err := filepath.Abs(filepath.Join(*s3Cache, filepath.FromSlash(strings.TrimPrefix(location, S3Scheme))))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := osfs.MkdirAll(p, 0755); err != nil {
+			log.Fatal(err)
+		}
+		fs := afero.NewBasePathFs(osfs, p)
+		mirror, err := NewS3Mirror(location, *s3Endpoint, fs)
+		if err != nil {
 			log.Fatal(err)
-		} else {
-			provider = NewTranspilerProvider(afero.NewBasePathFs(osfs, p))
+		}
+		go mirror.Maintain(*s3Interval)
+		return fs
+	}
+
+	providers := make([]PuzzleProvider, 0, 1+len(remotePuzzles))
+	var provider PuzzleProvider
+	switch {
+	case *manifestPath != "":
+		provider = NewManifestProvider(afero.NewOsFs(), *manifestPath)
+	case *puzzlePath != "":
+		provider = NewTranspilerProvider(contentFs(*puzzlePath))
+	case (*mothballPath == "") && (kioskFiles != nil):
+		fs, err := kioskFs("mothballs")
+		if err != nil {
+			log.Fatal(err)
+		}
+		provider = NewMothballs(fs)
+	default:
+		provider = NewMothballs(contentFs(*mothballPath))
+	}
+	if (*commandChecker || *uploadChecker) && (*uploadSandbox == "") {
+		slog.Warn("running puzzle checker commands without -upload-sandbox: anybody who can change a puzzle can run anything as this user")
+	}
+	transpile.RegisterAnswerChecker(transpile.UploadChecker, transpile.UploadCommandChecker{
+		Enabled: *uploadChecker,
+		Timeout: *uploadTimeout,
+		Sandbox: strings.Fields(*uploadSandbox),
+	})
+	transpile.RegisterAnswerChecker("command", transpile.CommandChecker{
+		Enabled: *commandChecker,
+		Timeout: *uploadTimeout,
+		Sandbox: strings.Fields(*uploadSandbox),
+	})
+
+	if (*manifestPath != "") || (*puzzlePath != "") {
+		transpile.SetCommandCacheTTL(*mkpuzzleCache)
+		if *spellcheck != "" {
+			dictionary, err := transpile.LoadDictionary(afero.NewOsFs(), strings.Split(*spellcheck, ",")...)
+			if err != nil {
+				log.Fatal(err)
+			}
+			transpile.SetSpellcheck(dictionary)
+		}
+		if *checkLinks {
+			transpile.SetLinkCheck(transpile.NewLinkChecker(10 * time.Second))
 		}
 		config.Devel = true
-		log.Println("-=- You are in development mode, champ! -=-")
+		slog.Warn("-=- You are in development mode, champ! -=-")
+	}
+	providers = append(providers, provider)
+	if *remoteToken == "" {
+		*remoteToken = os.Getenv("MOTH_REMOTE_TOKEN")
+	}
+	for _, url := range remotePuzzles {
+		providers = append(providers, NewRemoteProvider(url, *remoteToken))
+	}
+	for _, command := range pluginPuzzles {
+		plugin, err := NewPluginPuzzleProvider(command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		providers = append(providers, plugin)
 	}
 
 	var state StateProvider
-	if p, err := filepath.Abs(*statePath); err != nil {
+	if len(stateServices) > 0 {
+		if remote, err := NewStateServiceState(stateServices, *stateToken); err != nil {
+			log.Fatal(err)
+		} else {
+			state = remote
+		}
+	} else if *pluginState != "" {
+		if plugin, err := NewPluginState(*pluginState); err != nil {
+			log.Fatal(err)
+		} else {
+			state = plugin
+		}
+	} else if p, err := filepath.Abs(*statePath); err != nil {
 		log.Fatal(err)
 	} else {
-		state = NewState(afero.NewBasePathFs(osfs, p))
+		if kioskFiles != nil {
+			if err := prepareKioskState(osfs, p); err != nil {
+				log.Fatal(err)
+			}
+			slog.Info("kiosk state", "path", p, "teamid", KioskTeamID)
+		}
+		fsState := NewState(afero.NewBasePathFs(osfs, p))
+		fsState.RotateSize = *rotateSize
+		fsState.RotateKeep = *rotateKeep
+		if *backupPath != "" {
+			if p, err := filepath.Abs(*backupPath); err != nil {
+				log.Fatal(err)
+			} else {
+				go fsState.MaintainBackups(afero.NewBasePathFs(osfs, p), *backupInterval, *backupKeep)
+			}
+		}
+		state = fsState
+	}
+	if *serveState != "" {
+		bind, err := ParseBindAddress(*serveState)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if (*stateToken == "") && (bind.Network != "unix") {
+			log.Fatal("-serve-state needs -state-token, unless it's a Unix socket")
+		}
+		ln, err := bind.Listen()
+		if err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("serving state", "address", bind.String())
+		go func() {
+			log.Fatal(NewStateService(state, *stateToken).Serve(ln))
+		}()
 	}
 	if config.Devel {
 		state = NewDevelState(state)
@@ -99,7 +881,7 @@ func main() {
 		*seed = fmt.Sprintf("%d%d", os.Getpid(), time.Now().Unix())
 	}
 	os.Setenv("SEED", *seed)
-	log.Print("SEED=", *seed)
+	slog.Info("random seed", "seed", *seed)
 
 	// Add some MIME extensions
 	// Doing this avoids decompressing a mothball entry twice per request
@@ -108,10 +890,175 @@ func main() {
 
 	go theme.Maintain(*refreshInterval)
 	go state.Maintain(*refreshInterval)
-	go provider.Maintain(*refreshInterval)
+	for _, provider := range providers {
+		go provider.Maintain(*refreshInterval)
+	}
+
+	server := NewMothServer(config, theme, state, providers...)
+
+	if *webhookSecret == "" {
+		*webhookSecret = os.Getenv("WEBHOOK_SECRET")
+	}
+	for _, url := range webhooks {
+		webhook := NewWebhook(url, *webhookSecret)
+		go webhook.Maintain(*refreshInterval)
+		server.Listeners = append(server.Listeners, webhook)
+	}
+
+	if *xapiEndpoint != "" {
+		if *xapiHome == "" {
+			log.Fatal("-xapi needs -xapi-home")
+		}
+		if *xapiAuth == "" {
+			*xapiAuth = os.Getenv("XAPI_AUTH")
+		}
+		xapi := NewXAPI(*xapiEndpoint, *xapiAuth, *xapiHome)
+		go xapi.Maintain(*refreshInterval)
+		server.Listeners = append(server.Listeners, xapi)
+	}
+
+	if *detectSharing {
+		server.Sharing = NewSharingDetector()
+		server.Listeners = append(server.Listeners, server.Sharing)
+	}
+
+	if *serviceInterval > 0 {
+		server.Services = NewServiceMonitor(server)
+		go server.Services.Maintain(*serviceInterval)
+	}
+
+	if *listenerPorts != "" {
+		low, high, err := ParsePortRange(*listenerPorts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lm := NewTCPListenerManager(server, low, high)
+		lm.Bind = *listenerBind
+		lm.Timeout = *listenerTimeout
+		lm.MaxConns = *listenerMaxConns
+		lm.Sandbox = strings.Fields(*listenerSandbox)
+		server.TCPListeners = lm
+		go lm.Maintain(ListenerUpdateInterval)
+	}
+
+	if *labWebhook != "" {
+		if *labState == "" {
+			*labState = filepath.Join(*statePath, "labs.json")
+		}
+		server.Labs = NewLabManager(server, *labWebhook, *webhookSecret, osfs, *labState)
+		server.Listeners = append(server.Listeners, server.Labs)
+		go server.Labs.Maintain(*labPoll)
+	}
+
+	if *notifyURL != "" {
+		notifier := NewNotifier(server, *notifyURL)
+		if *notifyTemplates != "" {
+			if err := notifier.LoadTemplates(*notifyTemplates); err != nil {
+				log.Fatal(err)
+			}
+		}
+		go notifier.Maintain(*refreshInterval)
+	}
+
+	if *smtpAddr != "" {
+		if *smtpFrom == "" {
+			log.Fatal("-smtp needs -smtp-from")
+		}
+		if *smtpAuth == "" {
+			*smtpAuth = os.Getenv("SMTP_AUTH")
+		}
+		mailer := NewMailer(*smtpAddr, *smtpFrom, *smtpAuth)
+		mailer.URL = *smtpURL
+		mailer.Interval = *smtpInterval
+		if *smtpTemplates != "" {
+			if err := mailer.LoadTemplates(*smtpTemplates); err != nil {
+				log.Fatal(err)
+			}
+		}
+		server.Mailer = mailer
+		go mailer.Maintain(*refreshInterval)
+	}
+
+	if *captchaURL != "" {
+		if *captchaSecret == "" {
+			*captchaSecret = os.Getenv("CAPTCHA_SECRET")
+		}
+		server.Captcha = NewCaptcha(*captchaURL, *captchaSecret)
+	}
+
+	if *otlpEndpoint == "" {
+		*otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if *otlpEndpoint != "" {
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = "mothd"
+		}
+		server.Tracer = NewTracer(*otlpEndpoint, serviceName)
+		go server.Tracer.Maintain(*refreshInterval)
+	}
 
-	server := NewMothServer(config, theme, state, provider)
 	httpd := NewHTTPServer(*base, server)
+	for _, spec := range instances {
+		route, dir, ok := strings.Cut(spec, "=")
+		if !ok {
+			log.Fatalf("instance must be /PREFIX=DIR or HOST=DIR: %s", spec)
+		}
+		inst, err := NewInstance(osfs, dir, config, theme)
+		if err != nil {
+			log.Fatal(err)
+		}
+		inst.Tracer = server.Tracer
+		inst.Captcha = server.Captcha
+		if *detectSharing {
+			inst.Sharing = NewSharingDetector()
+			inst.Listeners = append(inst.Listeners, inst.Sharing)
+		}
+		if *serviceInterval > 0 {
+			inst.Services = NewServiceMonitor(inst)
+			go inst.Services.Maintain(*serviceInterval)
+		}
+		if inst.Theme != ThemeProvider(theme) {
+			go inst.Theme.Maintain(*refreshInterval)
+		}
+		go inst.State.Maintain(*refreshInterval)
+		for _, provider := range inst.PuzzleProviders {
+			go provider.Maintain(*refreshInterval)
+		}
+		if err := httpd.AddInstance(route, inst); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("serving instance", "route", route, "path", dir)
+	}
+
+	if len(binds) == 0 {
+		if kioskFiles != nil {
+			binds.Set(KioskBind)
+		} else {
+			binds.Set(":8080")
+		}
+	}
+	tlsOpts.AutocertHosts = autocertHosts
+	if *openBrowserFlag {
+		if url, ok := browserURL(binds[0], tlsOpts.Enabled(), *base); ok {
+			go openBrowser(url, binds[0].Address)
+		}
+	}
+	if tlsOpts.Enabled() {
+		httpd.RunTLS(binds, tlsOpts)
+	} else {
+		httpd.Run(binds)
+	}
+}
+
+// stringList is a flag.Value which may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	httpd.Run(*bindStr)
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
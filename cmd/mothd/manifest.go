@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+)
+
+// ManifestProvider provides the categories listed in an event manifest,
+// from puzzle sources or mothballs, for development.
+type ManifestProvider struct {
+	fs       afero.Fs
+	filename string
+
+	lock       sync.RWMutex
+	categories map[string]transpile.Category
+
+	// mothballs remembers mothballs already read, by path,
+	// so they're only read again if they change.
+	mothballs map[string]manifestMothball
+}
+
+type manifestMothball struct {
+	mtime    time.Time
+	category transpile.Category
+}
+
+// NewManifestProvider returns a new ManifestProvider for the manifest called filename in fs.
+func NewManifestProvider(fs afero.Fs, filename string) *ManifestProvider {
+	p := &ManifestProvider{
+		fs:         fs,
+		filename:   filename,
+		categories: make(map[string]transpile.Category),
+		mothballs:  make(map[string]manifestMothball),
+	}
+	p.refresh()
+	return p
+}
+
+func (p *ManifestProvider) getCat(cat string) (transpile.Category, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	c, ok := p.categories[cat]
+	if !ok {
+		return nil, fmt.Errorf("no such category: %s", cat)
+	}
+	return c, nil
+}
+
+// Inventory returns a Category list for this provider.
+func (p *ManifestProvider) Inventory() []Category {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	ret := make([]Category, 0, len(p.categories))
+	for name, c := range p.categories {
+		points, err := c.Inventory()
+		if err != nil {
+			slog.Error("reading inventory", "category", name, "error", err)
+			continue
+		}
+		sort.Ints(points)
+		ret = append(ret, Category{name, points})
+	}
+	return ret
+}
+
+// Open returns a file associated with the given category and point value.
+func (p *ManifestProvider) Open(cat string, points int, filename string) (ReadSeekCloser, time.Time, error) {
+	c, err := p.getCat(cat)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return openCategoryFile(c, points, filename)
+}
+
+// CheckAnswer checks whether an answer is correct.
+func (p *ManifestProvider) CheckAnswer(cat string, points int, answer string) (bool, error) {
+	c, err := p.getCat(cat)
+	if err != nil {
+		return false, err
+	}
+	return c.Answer(points, answer), nil
+}
+
+// CheckAnswerPart returns the name of the puzzle part solved by answer.
+func (p *ManifestProvider) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	c, err := p.getCat(cat)
+	if err != nil {
+		return "", err
+	}
+	return c.AnswerPart(points, answer), nil
+}
+
+// Mothball packages up a category into a mothball for production.
+func (p *ManifestProvider) Mothball(cat string, w io.Writer) error {
+	c, err := p.getCat(cat)
+	if err != nil {
+		return err
+	}
+	return transpile.Mothball(c, w, transpile.ProductionProfile)
+}
+
+// Maintain reads the manifest again every updateInterval.
+func (p *ManifestProvider) Maintain(updateInterval time.Duration) {
+	for range time.NewTicker(updateInterval).C {
+		p.refresh()
+	}
+}
+
+// refresh reads the manifest again.
+// If anything is wrong with it, the categories already read are kept.
+func (p *ManifestProvider) refresh() {
+	manifest, err := transpile.ReadManifest(p.fs, p.filename)
+	if err != nil {
+		slog.Error("reading manifest", "error", err)
+		return
+	}
+
+	p.lock.RLock()
+	read := p.mothballs
+	p.lock.RUnlock()
+
+	categories := make(map[string]transpile.Category, len(manifest.Categories))
+	mothballs := make(map[string]manifestMothball)
+	for _, mc := range manifest.Categories {
+		info, err := p.fs.Stat(mc.Path)
+		if err != nil {
+			slog.Error("reading manifest", "category", mc.Name, "error", err)
+			continue
+		}
+
+		// Category directories are read every time they're used
+		if info.IsDir() {
+			categories[mc.Name] = mc.Remap(transpile.NewFsCategory(p.fs, mc.Path))
+			continue
+		}
+
+		mb, ok := read[mc.Path]
+		if !ok || !mb.mtime.Equal(info.ModTime()) {
+			c, err := transpile.NewMothballCategory(p.fs, mc.Path)
+			if err != nil {
+				slog.Error("reading manifest", "category", mc.Name, "error", err)
+				continue
+			}
+			mb = manifestMothball{info.ModTime(), c}
+		}
+		categories[mc.Name] = mc.Remap(mb.category)
+		mothballs[mc.Path] = mb
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.categories = categories
+	p.mothballs = mothballs
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+)
+
+func TestManifestProvider(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "library/pategory/1/puzzle.md", []byte("---\nanswers:\n  - moo\n---\nMoo?\n"), 0644)
+	afero.WriteFile(fs, "library/pategory/2/puzzle.md", []byte("---\nanswers:\n  - oink\n---\nOink?\n"), 0644)
+	afero.WriteFile(fs, "built/cows/1/puzzle.md", []byte("---\nanswers:\n  - grass\n---\nEat?\n"), 0644)
+	mb := new(bytes.Buffer)
+	if err := transpile.Mothball(transpile.NewFsCategory(fs, "built/cows"), mb, transpile.ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, "built/cows.mb", mb.Bytes(), 0644)
+	afero.WriteFile(fs, "event/manifest.yaml", []byte("categories:\n  - path: ../library/pategory\n  - path: ../built/cows.mb\n"), 0644)
+
+	p := NewManifestProvider(fs, "event/manifest.yaml")
+	if inv := p.Inventory(); len(inv) != 2 {
+		t.Error("Wrong inventory", inv)
+	}
+	if ok, err := p.CheckAnswer("pategory", 2, "oink"); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Error("Right answer marked wrong")
+	}
+	if ok, err := p.CheckAnswer("cows", 1, "grass"); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Error("Right answer from mothball marked wrong")
+	}
+	if f, _, err := p.Open("cows", 1, "puzzle.json"); err != nil {
+		t.Error(err)
+	} else {
+		f.Close()
+	}
+	if _, err := p.CheckAnswer("pigs", 1, "oink"); err == nil {
+		t.Error("Checked answer in a category that isn't listed")
+	}
+
+	// A broken manifest keeps what was there
+	afero.WriteFile(fs, "event/manifest.yaml", []byte("categories: [\n"), 0644)
+	p.refresh()
+	if inv := p.Inventory(); len(inv) != 2 {
+		t.Error("Broken manifest changed inventory", inv)
+	}
+
+	afero.WriteFile(fs, "event/manifest.yaml", []byte("categories:\n  - path: ../built/cows.mb\n"), 0644)
+	p.refresh()
+	if inv := p.Inventory(); len(inv) != 1 {
+		t.Error("Wrong inventory after manifest changed", inv)
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// JoinCodesFile lists each team's join code, one "teamID code" per line.
+const JoinCodesFile = "joincodes.txt"
+
+// MembersDir has a file for each team with members,
+// one "memberID tokenHash joined name" per line.
+const MembersDir = "members"
+
+// ErrInvalidJoinCode means a join code doesn't belong to any team.
+var ErrInvalidJoinCode = errors.New("invalid join code")
+
+// ErrTeamFull means a team has as many people as it's allowed,
+// so nobody else can join it.
+var ErrTeamFull = errors.New("the team is full")
+
+// ErrUnknownMember means a member isn't on the team, or a member token doesn't work.
+var ErrUnknownMember = errors.New("no such member")
+
+// Member is somebody on a team,
+// who logs in with their own member token instead of the team ID.
+type Member struct {
+	ID     string
+	TeamID string
+	Name   string
+	Joined time.Time
+
+	// Token is what the member logs in with.
+	// Only its hash is kept, so it's only set when the member joins.
+	Token string `json:",omitempty"`
+}
+
+// hashMemberToken returns how a member token is stored.
+func hashMemberToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newMemberToken returns a random member token.
+func newMemberToken() (string, error) {
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return recoveryEncoding.EncodeToString(buf), nil
+}
+
+// joinCodes returns every team's join code, by team ID.
+// The caller must hold s.lock.
+func (s *State) joinCodes() map[string]string {
+	ret := make(map[string]string)
+	f, err := s.Open(JoinCodesFile)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			ret[fields[0]] = fields[1]
+		}
+	}
+	return ret
+}
+
+// JoinCode returns a team's join code,
+// which anybody joining the team as a member needs.
+//
+// The team is given one if it doesn't have one yet,
+// or a new one, replacing the old, if renew is true.
+func (s *State) JoinCode(teamID string, renew bool) (string, error) {
+	if _, err := s.TeamName(teamID); err != nil {
+		return "", ErrInvalidTeamID
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	codes := s.joinCodes()
+	if code, ok := codes[teamID]; ok && !renew {
+		return code, nil
+	}
+	code, err := newRecoveryCode()
+	if err != nil {
+		return "", err
+	}
+	codes[teamID] = code
+	if err := s.writeJoinCodes(codes); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// writeJoinCodes replaces every team's join code.
+// The caller must hold s.lock.
+func (s *State) writeJoinCodes(codes map[string]string) error {
+	teamIDs := make([]string, 0, len(codes))
+	for id := range codes {
+		teamIDs = append(teamIDs, id)
+	}
+	sort.Strings(teamIDs)
+	buf := new(strings.Builder)
+	for _, id := range teamIDs {
+		fmt.Fprintln(buf, id, codes[id])
+	}
+	return s.writeFileAtomic(JoinCodesFile, []byte(buf.String()))
+}
+
+// readMembers returns the members of a team.
+// The caller must hold s.lock, or not mind reading an old list.
+func (s *State) readMembers(teamID string) ([]Member, []string, error) {
+	members := make([]Member, 0)
+	hashes := make([]string, 0)
+	if (teamID == "") || strings.HasPrefix(teamID, ".") || strings.ContainsAny(teamID, "/\\") {
+		return members, hashes, nil
+	}
+	f, err := s.Open(filepath.Join(MembersDir, teamID))
+	if os.IsNotExist(err) {
+		return members, hashes, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		joined, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		members = append(members, Member{
+			ID:     fields[0],
+			TeamID: teamID,
+			Name:   fields[3],
+			Joined: time.Unix(joined, 0),
+		})
+		hashes = append(hashes, fields[1])
+	}
+	return members, hashes, scanner.Err()
+}
+
+// writeMembers replaces the members of a team.
+// The caller must hold s.lock.
+func (s *State) writeMembers(teamID string, members []Member, hashes []string) error {
+	filename := filepath.Join(MembersDir, teamID)
+	if len(members) == 0 {
+		if err := s.Remove(filename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	buf := new(strings.Builder)
+	for i, m := range members {
+		fmt.Fprintln(buf, m.ID, hashes[i], m.Joined.Unix(), m.Name)
+	}
+	s.Mkdir(MembersDir, 0755)
+	return s.writeFileAtomic(filename, []byte(buf.String()))
+}
+
+// JoinTeam adds a member named name to the team whose join code is code.
+// The new member's Token is set:
+// this is the only time it can be seen.
+//
+// If maxSize is more than zero,
+// and the team already has that many people,
+// counting its owner,
+// ErrTeamFull is returned instead.
+func (s *State) JoinTeam(code, name string, maxSize int) (Member, error) {
+	name = strings.TrimSpace(name)
+	if (name == "") || (utf8.RuneCountInString(name) > MaxTeamNameLength) || strings.ContainsAny(name, "\r\n") {
+		return Member{}, fmt.Errorf("invalid member name")
+	}
+	token, err := newMemberToken()
+	if err != nil {
+		return Member{}, err
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Member{}, err
+	}
+
+	s.lock.Lock()
+	teamID := ""
+	for t, c := range s.joinCodes() {
+		if (code != "") && (c == code) {
+			teamID = t
+		}
+	}
+	if teamID == "" {
+		s.lock.Unlock()
+		return Member{}, ErrInvalidJoinCode
+	}
+	member := Member{
+		ID:     hex.EncodeToString(id),
+		TeamID: teamID,
+		Name:   name,
+		Joined: time.Now(),
+	}
+	members, hashes, err := s.readMembers(teamID)
+	if (err == nil) && (maxSize > 0) && (len(members)+1 >= maxSize) {
+		err = ErrTeamFull
+	}
+	if err == nil {
+		err = s.writeMembers(teamID, append(members, member), append(hashes, hashMemberToken(token)))
+	}
+	if err == nil {
+		s.memberTokens[hashMemberToken(token)] = member
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return Member{}, err
+	}
+
+	s.LogEvent("join", teamID, "", 0, member.ID)
+	member.Token = token
+	return member, nil
+}
+
+// TeamMembers returns the members of a team, in the order they joined.
+func (s *State) TeamMembers(teamID string) ([]Member, error) {
+	members, _, err := s.readMembers(teamID)
+	return members, err
+}
+
+// MemberByToken returns the member who logs in with token.
+//
+// Members added or removed by hand are seen after the next refresh.
+func (s *State) MemberByToken(token string) (Member, error) {
+	if token == "" {
+		return Member{}, ErrUnknownMember
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	member, ok := s.memberTokens[hashMemberToken(token)]
+	if !ok {
+		return Member{}, ErrUnknownMember
+	}
+	return member, nil
+}
+
+// RemoveMember takes a member off a team.
+// Their member token, and any session they started with it, stop working.
+func (s *State) RemoveMember(teamID, memberID string) error {
+	s.lock.Lock()
+	members, hashes, err := s.readMembers(teamID)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	i := 0
+	for (i < len(members)) && (members[i].ID != memberID) {
+		i++
+	}
+	if i == len(members) {
+		s.lock.Unlock()
+		return ErrUnknownMember
+	}
+	hash := hashes[i]
+	members = append(members[:i], members[i+1:]...)
+	hashes = append(hashes[:i], hashes[i+1:]...)
+	err = s.writeMembers(teamID, members, hashes)
+	if err == nil {
+		delete(s.memberTokens, hash)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	s.LogEvent("leave", teamID, "", 0, memberID)
+	return nil
+}
+
+// mergeMembers moves fromID's members onto intoID,
+// keeping their member tokens.
+// intoID gets fromID's join code too, if it doesn't have one of its own.
+func (s *State) mergeMembers(fromID, intoID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fromMembers, fromHashes, err := s.readMembers(fromID)
+	if err != nil {
+		return err
+	}
+	if len(fromMembers) > 0 {
+		members, hashes, err := s.readMembers(intoID)
+		if err != nil {
+			return err
+		}
+		for i := range fromMembers {
+			fromMembers[i].TeamID = intoID
+		}
+		members = append(members, fromMembers...)
+		hashes = append(hashes, fromHashes...)
+		// Still in the order they joined
+		order := make([]int, len(members))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return members[order[i]].Joined.Before(members[order[j]].Joined)
+		})
+		sortedMembers := make([]Member, len(members))
+		sortedHashes := make([]string, len(hashes))
+		for i, n := range order {
+			sortedMembers[i] = members[n]
+			sortedHashes[i] = hashes[n]
+		}
+		if err := s.writeMembers(intoID, sortedMembers, sortedHashes); err != nil {
+			return err
+		}
+		if err := s.writeMembers(fromID, nil, nil); err != nil {
+			return err
+		}
+		for i, hash := range fromHashes {
+			s.memberTokens[hash] = fromMembers[i]
+		}
+	}
+
+	codes := s.joinCodes()
+	if code, ok := codes[fromID]; ok {
+		delete(codes, fromID)
+		if _, ok := codes[intoID]; !ok {
+			codes[intoID] = code
+		}
+		return s.writeJoinCodes(codes)
+	}
+	return nil
+}
+
+// memberActive returns true if memberID is still on teamID.
+func (s *MothServer) memberActive(teamID, memberID string) bool {
+	members, err := s.State.TeamMembers(teamID)
+	if err != nil {
+		return false
+	}
+	for _, m := range members {
+		if m.ID == memberID {
+			return true
+		}
+	}
+	return false
+}
+
+// joinCodeResponse is the data sent back from /join-code.
+type joinCodeResponse struct {
+	Short       string `json:"short"`
+	Description string `json:"description"`
+	JoinCode    string `json:"join_code"`
+}
+
+// joinResponse is the data sent back from /join.
+type joinResponse struct {
+	Short       string `json:"short"`
+	Description string `json:"description"`
+	MemberID    string `json:"member_id"`
+
+	// MemberToken is only sent once, when the member joins
+	MemberToken string `json:"member_token"`
+}
+
+// JoinCodeHandler sends a team its join code, making a new one if asked to.
+// Only the team's owner, who logs in with the team ID, may have it:
+// members can't hand out more memberships.
+func (h *HTTPServer) JoinCodeHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !mh.Config.JoinCodes {
+		jsend.SendfStatus(w, http.StatusForbidden, jsend.Fail, "no join code", "this server doesn't use join codes")
+		return
+	}
+	if mh.member != "" {
+		jsend.SendfStatus(w, http.StatusForbidden, jsend.Fail, "no join code", "only the team's owner can hand out join codes")
+		return
+	}
+	renew := false
+	if r := req.FormValue("renew"); r != "" {
+		var err error
+		if renew, err = strconv.ParseBool(r); err != nil {
+			jsend.Sendf(w, jsend.Fail, "no join code", "renew: %s", err.Error())
+			return
+		}
+	}
+	code, err := mh.State.JoinCode(mh.teamID, renew)
+	if err != nil {
+		jsend.Sendf(w, jsend.Fail, "no join code", err.Error())
+		return
+	}
+	description := "give this to anybody joining the team"
+	if renew {
+		mh.log.Info("renewed join code")
+		description = "new join code: the old one no longer works"
+	}
+	jsend.Send(w, jsend.Success, joinCodeResponse{Short: "join code", Description: description, JoinCode: code})
+}
+
+// JoinHandler adds a member to the team a join code belongs to,
+// and sends back the member token they log in with.
+func (h *HTTPServer) JoinHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !mh.Config.JoinCodes {
+		jsend.SendfStatus(w, http.StatusForbidden, jsend.Fail, "not joined", "this server doesn't use join codes")
+		return
+	}
+	member, err := mh.State.JoinTeam(strings.TrimSpace(req.FormValue("code")), req.FormValue("name"), mh.Config.MaxTeamSize)
+	if err != nil {
+		mh.log.Warn("join refused", "error", err)
+		jsend.Sendf(w, jsend.Fail, "not joined", err.Error())
+		return
+	}
+	mh.log.Info("joined", "team", member.TeamID, "member", member.ID, "name", member.Name)
+	h.StartSession(w, req, member.TeamID, member.ID)
+	jsend.Send(w, jsend.Success, joinResponse{
+		Short:       "joined",
+		Description: "joined the team: log in with your member token from now on",
+		MemberID:    member.ID,
+		MemberToken: member.Token,
+	})
+}
+
+// AdminMembersHandler lists a team's members.
+func (h *HTTPServer) AdminMembersHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	teamID := req.FormValue("team")
+	if teamID == "" {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "no members", "team is required")
+		return
+	}
+	members, err := mh.State.TeamMembers(teamID)
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "no members", "%s", err.Error())
+		return
+	}
+	jsend.Send(w, jsend.Success, members)
+}
+
+// AdminRemoveMemberHandler takes a member off a team.
+func (h *HTTPServer) AdminRemoveMemberHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	teamID, memberID := req.FormValue("team"), req.FormValue("member")
+	if (teamID == "") || (memberID == "") {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not removed", "team and member are required")
+		return
+	}
+	if err := mh.State.RemoveMember(teamID, memberID); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not removed", "%s", err.Error())
+		return
+	}
+	mh.log.Info("removed member", "team", teamID, "member", memberID)
+	jsend.Sendf(w, jsend.Success, "removed", "member %s removed from %s", memberID, teamID)
+}
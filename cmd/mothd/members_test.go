@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMembers(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	server.Config.JoinCodes = true
+	server.Config.SessionLifetime = time.Hour
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	post := func(path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "Bearer sekrit")
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	sessionCookie := func(r *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range r.Result().Cookies() {
+			if cookie.Name == SessionCookie {
+				return cookie
+			}
+		}
+		return nil
+	}
+	identity := func(cookie *http.Cookie, id string) (string, string) {
+		request := httptest.NewRequest(http.MethodGet, "/state", nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		return hs.requestIdentity(httptest.NewRecorder(), request, id)
+	}
+
+	if r := post("/join-code", url.Values{"id": {TestTeamID}}, nil); !strings.Contains(r.Body.String(), `"fail"`) {
+		t.Error("Unregistered team got a join code:", r.Body.String())
+	}
+	post("/register", url.Values{"id": {TestTeamID}, "name": {"GoTeam"}}, nil)
+	state.refresh()
+
+	var codeResp struct {
+		Data joinCodeResponse
+	}
+	r := post("/join-code", url.Values{"id": {TestTeamID}}, nil)
+	if err := json.Unmarshal(r.Body.Bytes(), &codeResp); (err != nil) || (codeResp.Data.JoinCode == "") {
+		t.Fatal("No join code:", r.Body.String())
+	}
+	code := codeResp.Data.JoinCode
+	if again, _ := state.JoinCode(TestTeamID, false); again != code {
+		t.Error("Join code changed without renewing it:", again)
+	}
+
+	if r := post("/join", url.Values{"code": {"nope"}, "name": {"Ada"}}, nil); !strings.Contains(r.Body.String(), ErrInvalidJoinCode.Error()) {
+		t.Error("Joined with a bad join code:", r.Body.String())
+	}
+	var joinResp struct {
+		Data joinResponse
+	}
+	r = post("/join", url.Values{"code": {code}, "name": {"Ada"}}, nil)
+	if err := json.Unmarshal(r.Body.Bytes(), &joinResp); (err != nil) || (joinResp.Data.MemberToken == "") {
+		t.Fatal("Not joined:", r.Body.String())
+	}
+	token, memberID := joinResp.Data.MemberToken, joinResp.Data.MemberID
+	cookie := sessionCookie(r)
+	if teamID, m := identity(cookie, ""); (teamID != TestTeamID) || (m != memberID) {
+		t.Error("Wrong session after joining:", teamID, m)
+	}
+	if teamID, m := identity(nil, token); (teamID != TestTeamID) || (m != memberID) {
+		t.Error("Member token doesn't log in:", teamID, m)
+	}
+
+	// Logging in with a member token works like logging in with the team ID
+	r = post("/register", url.Values{"id": {token}, "name": {"GoTeam"}}, nil)
+	if !strings.Contains(r.Body.String(), "already registered") {
+		t.Error("Member couldn't log in:", r.Body.String())
+	}
+	if teamID, m := identity(sessionCookie(r), ""); (teamID != TestTeamID) || (m != memberID) {
+		t.Error("Wrong session logging in as a member:", teamID, m)
+	}
+
+	if r := post("/join-code", url.Values{}, cookie); !strings.Contains(r.Body.String(), "only the team's owner") {
+		t.Error("Member got a join code:", r.Body.String())
+	}
+	if r := post("/answer", url.Values{"cat": {"pategory"}, "points": {"1"}, "answer": {"answer123"}}, cookie); !strings.Contains(r.Body.String(), "success") {
+		t.Error("Member couldn't answer for the team:", r.Body.String())
+	}
+
+	var members struct {
+		Data []Member
+	}
+	r = post("/admin/members", url.Values{"team": {TestTeamID}}, nil)
+	if err := json.Unmarshal(r.Body.Bytes(), &members); (err != nil) || (len(members.Data) != 1) {
+		t.Fatal("Wrong members:", r.Body.String())
+	}
+	if m := members.Data[0]; (m.ID != memberID) || (m.Name != "Ada") || (m.Token != "") {
+		t.Error("Wrong member:", m)
+	}
+
+	if r := post("/admin/remove-member", url.Values{"team": {TestTeamID}, "member": {memberID}}, nil); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if teamID, _ := identity(cookie, ""); teamID != "" {
+		t.Error("Removed member's session still works:", teamID)
+	}
+	if teamID, _ := identity(nil, token); teamID == TestTeamID {
+		t.Error("Removed member's token still works")
+	}
+	if r := post("/admin/remove-member", url.Values{"team": {TestTeamID}, "member": {memberID}}, nil); r.Code != http.StatusBadRequest {
+		t.Error("Removed a member twice:", r.Body.String())
+	}
+
+	// Renewing the join code stops the old one working
+	if renewed, err := state.JoinCode(TestTeamID, true); (err != nil) || (renewed == code) {
+		t.Error("Join code not renewed:", renewed, err)
+	}
+	if _, err := state.JoinTeam(code, "Grace", 0); err != ErrInvalidJoinCode {
+		t.Error("Old join code still works:", err)
+	}
+
+	// A team of two is its owner and one member
+	renewed, _ := state.JoinCode(TestTeamID, false)
+	server.Config.MaxTeamSize = 2
+	r = post("/join", url.Values{"code": {renewed}, "name": {"Grace"}}, nil)
+	if err := json.Unmarshal(r.Body.Bytes(), &joinResp); (err != nil) || (joinResp.Data.MemberToken == "") {
+		t.Error("Couldn't join a team with room:", r.Body.String())
+	}
+	if r := post("/join", url.Values{"code": {renewed}, "name": {"Hedy"}}, nil); !strings.Contains(r.Body.String(), ErrTeamFull.Error()) {
+		t.Error("Joined a full team:", r.Body.String())
+	}
+	if members, _ := state.TeamMembers(TestTeamID); len(members) != 1 {
+		t.Error("Wrong number of members:", members)
+	}
+
+	// Member tokens still work after a restart
+	restarted := NewState(state.Fs)
+	restarted.refresh()
+	if m, err := restarted.MemberByToken(joinResp.Data.MemberToken); (err != nil) || (m.Name != "Grace") {
+		t.Error("Member token lost in a restart:", m, err)
+	}
+
+	// Taking somebody off a team by hand takes effect at the next refresh
+	state.Remove(filepath.Join(MembersDir, TestTeamID))
+	state.refresh()
+	if _, err := state.MemberByToken(joinResp.Data.MemberToken); err != ErrUnknownMember {
+		t.Error("Member removed by hand still logs in:", err)
+	}
+}
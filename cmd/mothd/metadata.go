@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// MetadataLifetime is how long puzzle metadata is remembered before puzzles are read again.
+const MetadataLifetime = time.Minute
+
+// metadataCache remembers the tags, difficulty, and solutions of every puzzle for MetadataLifetime,
+// since finding them reads every puzzle.
+type metadataCache struct {
+	lock         sync.Mutex
+	expires      time.Time
+	tags         map[string]map[int][]string
+	difficulties map[string]map[int]int
+	solutions    map[string]map[int]bool
+}
+
+func newMetadataCache() *metadataCache {
+	return &metadataCache{}
+}
+
+// refresh reads every puzzle on s again, if it's been MetadataLifetime since the last time.
+// The caller must hold the lock.
+func (mc *metadataCache) refresh(s *MothServer) {
+	if time.Now().Before(mc.expires) {
+		return
+	}
+
+	tags := make(map[string]map[int][]string)
+	difficulties := make(map[string]map[int]int)
+	solutions := make(map[string]map[int]bool)
+	forEachPuzzle(s, func(cat string, points int, puzzle transpile.Puzzle) {
+		if len(puzzle.Tags) > 0 {
+			if tags[cat] == nil {
+				tags[cat] = make(map[int][]string)
+			}
+			tags[cat][points] = puzzle.Tags
+		}
+		if puzzle.Difficulty > 0 {
+			if difficulties[cat] == nil {
+				difficulties[cat] = make(map[int]int)
+			}
+			difficulties[cat][points] = puzzle.Difficulty
+		}
+		if puzzle.HasSolution() {
+			if solutions[cat] == nil {
+				solutions[cat] = make(map[int]bool)
+			}
+			solutions[cat][points] = true
+		}
+	})
+
+	mc.tags = tags
+	mc.difficulties = difficulties
+	mc.solutions = solutions
+	mc.expires = time.Now().Add(MetadataLifetime)
+}
+
+// PuzzleTags returns the tags of every puzzle on the server that has any,
+// by category, then point value.
+func (s *MothServer) PuzzleTags() map[string]map[int][]string {
+	s.metadata.lock.Lock()
+	defer s.metadata.lock.Unlock()
+	s.metadata.refresh(s)
+	return s.metadata.tags
+}
+
+// PuzzleDifficulties returns the difficulty of every puzzle on the server that has one,
+// by category, then point value.
+func (s *MothServer) PuzzleDifficulties() map[string]map[int]int {
+	s.metadata.lock.Lock()
+	defer s.metadata.lock.Unlock()
+	s.metadata.refresh(s)
+	return s.metadata.difficulties
+}
+
+// PuzzleSolutions returns every puzzle on the server that comes with a solution,
+// by category, then point value.
+func (s *MothServer) PuzzleSolutions() map[string]map[int]bool {
+	s.metadata.lock.Lock()
+	defer s.metadata.lock.Unlock()
+	s.metadata.refresh(s)
+	return s.metadata.solutions
+}
+
+// unlockedOnly returns the entries of all for every puzzle in puzzles.
+func unlockedOnly[V any](all map[string]map[int]V, puzzles map[string][]int) map[string]map[int]V {
+	ret := make(map[string]map[int]V)
+	for cat, pointsList := range puzzles {
+		for _, points := range pointsList {
+			if v, ok := all[cat][points]; ok {
+				if ret[cat] == nil {
+					ret[cat] = make(map[int]V)
+				}
+				ret[cat][points] = v
+			}
+		}
+	}
+	return ret
+}
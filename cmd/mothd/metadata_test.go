@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestMetadata(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers: [a]\ntags: [Web, crypto]\ndifficulty: 2\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/2/puzzle.md", []byte("answer: a\ntag: web\ndifficulty: 3\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/3/puzzle.md", []byte("answer: a\n\nHi.\n"), 0644)
+	state := NewTestState()
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teamids.txt", []byte(TestTeamID+"\n"), 0644)
+	state.SetTeamName(TestTeamID, "Team One")
+	state.refresh()
+	srv := NewMothServer(Configuration{}, NewTestTheme(), state, NewTranspilerProvider(fs))
+
+	tags := srv.PuzzleTags()
+	if !reflect.DeepEqual(tags["cows"][1], []string{"web", "crypto"}) || !reflect.DeepEqual(tags["cows"][2], []string{"web"}) {
+		t.Error("Wrong tags:", tags)
+	}
+	if _, ok := tags["cows"][3]; ok {
+		t.Error("Untagged puzzle has tags:", tags)
+	}
+
+	if difficulties := srv.PuzzleDifficulties(); !reflect.DeepEqual(difficulties, map[string]map[int]int{"cows": {1: 2, 2: 3}}) {
+		t.Error("Wrong difficulties:", difficulties)
+	}
+
+	// Only cows 1 is unlocked
+	handler := srv.NewHandler(TestTeamID)
+	export := handler.ExportState()
+	if !reflect.DeepEqual(export.Tags, map[string]map[int][]string{"cows": {1: {"web", "crypto"}}}) {
+		t.Error("Wrong exported tags:", export.Tags)
+	}
+	if !reflect.DeepEqual(export.Difficulties, map[string]map[int]int{"cows": {1: 2}}) {
+		t.Error("Wrong exported difficulties:", export.Difficulties)
+	}
+}
@@ -1,24 +1,20 @@
 package main
 
 import (
-	"archive/zip"
-	"bufio"
 	"fmt"
 	"io"
-	"log"
-	"sort"
-	"strconv"
+	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/dirtbags/moth/v4/pkg/mothball"
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
-	"github.com/spf13/afero/zipfs"
 )
 
 type zipCategory struct {
-	afero.Fs
-	io.Closer
+	*mothball.Reader
 	mtime time.Time
 }
 
@@ -52,7 +48,7 @@ func (m *Mothballs) Open(cat string, points int, filename string) (ReadSeekClose
 		return nil, time.Time{}, fmt.Errorf("no such category: %s", cat)
 	}
 
-	f, err := zc.Open(fmt.Sprintf("%d/%s", points, filename))
+	f, err := zc.Open(points, filename)
 	if err != nil {
 		return nil, time.Time{}, err
 	}
@@ -66,23 +62,13 @@ func (m *Mothballs) Inventory() []Category {
 	m.categoryLock.RLock()
 	defer m.categoryLock.RUnlock()
 	categories := make([]Category, 0, 20)
-	for cat, zfs := range m.categories {
-		pointsList := make([]int, 0, 20)
-		pf, err := zfs.Open("puzzles.txt")
+	for cat, zc := range m.categories {
+		pointsList, err := zc.Inventory()
 		if err != nil {
 			// No puzzles = no category
+			slog.Warn("reading points", "category", cat, "error", err)
 			continue
 		}
-		scanner := bufio.NewScanner(pf)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if pointval, err := strconv.Atoi(line); err != nil {
-				log.Printf("Reading points for %s: %s", cat, err.Error())
-			} else {
-				pointsList = append(pointsList, pointval)
-			}
-		}
-		sort.Ints(pointsList)
 		categories = append(categories, Category{cat, pointsList})
 	}
 	return categories
@@ -90,26 +76,43 @@ func (m *Mothballs) Inventory() []Category {
 
 // CheckAnswer returns an error if the provided answer is in any way incorrect for the given category and points
 func (m *Mothballs) CheckAnswer(cat string, points int, answer string) (bool, error) {
-	zfs, ok := m.getCat(cat)
+	zc, ok := m.getCat(cat)
 	if !ok {
 		return false, fmt.Errorf("no such category: %s", cat)
 	}
 
-	af, err := zfs.Open("answers.txt")
+	answers, err := zc.Answers(points)
 	if err != nil {
 		return false, fmt.Errorf("no answers.txt file")
 	}
-	defer af.Close()
+	return transpile.CheckAnswerFiles(zc.Checker(points), zc.files(points), answers, answer)
+}
 
-	needle := fmt.Sprintf("%d %s", points, answer)
-	scanner := bufio.NewScanner(af)
-	for scanner.Scan() {
-		if scanner.Text() == needle {
-			return true, nil
-		}
+// files returns a transpile.PuzzleFiles opening the files of the puzzle worth points.
+func (zc zipCategory) files(points int) transpile.PuzzleFiles {
+	return func(filename string) (io.ReadCloser, error) {
+		return zc.Open(points, filename)
+	}
+}
+
+// CheckAnswerPart returns the name of the part or tier of a puzzle solved by answer.
+// If answer doesn't solve any part or tier, the empty string is returned.
+func (m *Mothballs) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	zc, ok := m.getCat(cat)
+	if !ok {
+		return "", fmt.Errorf("no such category: %s", cat)
 	}
 
-	return false, nil
+	// Mothballs from before multi-part answers don't have parts.txt
+	puzzle := transpile.Puzzle{Checker: zc.Checker(points)}
+	for _, part := range zc.Parts(points) {
+		puzzle.Parts = append(puzzle.Parts, transpile.PuzzlePart{Name: part.Name, Answers: part.Answers})
+	}
+	if len(puzzle.Parts) == 0 {
+		return "", nil
+	}
+
+	return puzzle.AnswerPartFiles(zc.files(points), answer)
 }
 
 // refresh refreshes internal state.
@@ -121,7 +124,7 @@ func (m *Mothballs) refresh() {
 	// Any new categories?
 	files, err := afero.ReadDir(m.Fs, "/")
 	if err != nil {
-		log.Println("Error listing mothballs:", err)
+		slog.Error("listing mothballs", "error", err)
 		return
 	}
 	found := make(map[string]bool)
@@ -137,7 +140,7 @@ func (m *Mothballs) refresh() {
 		if existingMothball, ok := m.categories[categoryName]; !ok {
 			reopen = true
 		} else if si, err := m.Fs.Stat(filename); err != nil {
-			log.Println(err)
+			slog.Error("checking mothball", "file", filename, "error", err)
 		} else if si.ModTime().After(existingMothball.mtime) {
 			existingMothball.Close()
 			delete(m.categories, categoryName)
@@ -145,33 +148,23 @@ func (m *Mothballs) refresh() {
 		}
 
 		if reopen {
-			f, err := m.Fs.Open(filename)
+			mb, err := mothball.Open(m.Fs, filename)
 			if err != nil {
-				log.Println(err)
+				slog.Error("reading mothball", "file", filename, "error", err)
 				continue
 			}
 
-			fi, err := f.Stat()
-			if err != nil {
-				f.Close()
-				log.Println(err)
-				continue
+			m.categories[categoryName] = zipCategory{
+				Reader: mb,
+				mtime:  f.ModTime(),
 			}
 
-			zrc, err := zip.NewReader(f, fi.Size())
-			if err != nil {
-				f.Close()
-				log.Println(err)
-				continue
-			}
+			slog.Info("adding category", "category", categoryName)
 
-			m.categories[categoryName] = zipCategory{
-				Fs:     zipfs.New(zrc),
-				Closer: f,
-				mtime:  fi.ModTime(),
+			// Mothballs from before build profiles don't have profile.txt
+			if profile := mb.Profile(); (profile != "") && (profile != transpile.ProductionProfile.Name) {
+				slog.Warn("mothball has spoilers", "category", categoryName, "profile", profile)
 			}
-
-			log.Println("Adding category:", categoryName)
 		}
 	}
 
@@ -180,7 +173,7 @@ func (m *Mothballs) refresh() {
 		if !found[categoryName] {
 			zc.Close()
 			delete(m.categories, categoryName)
-			log.Println("Removing category:", categoryName)
+			slog.Info("removing category", "category", categoryName)
 		}
 	}
 }
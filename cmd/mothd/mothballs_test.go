@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"testing"
+	"time"
 
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
 )
 
@@ -30,11 +32,13 @@ func (m *Mothballs) createMothballWithFiles(cat string, contents []testFileConte
 	w := zip.NewWriter(f)
 	defer w.Close()
 
-	for _, file := range testFiles {
-		of, _ := w.Create(file.Name)
-		of.Write([]byte(file.Body))
-	}
-	for _, file := range contents {
+	// Files in contents replace any test file with the same name
+	written := make(map[string]bool)
+	for _, file := range append(contents, testFiles...) {
+		if written[file.Name] {
+			continue
+		}
+		written[file.Name] = true
 		of, _ := w.Create(file.Name)
 		of.Write([]byte(file.Body))
 	}
@@ -111,6 +115,37 @@ func TestMothballs(t *testing.T) {
 		t.Error("Wrong error message")
 	}
 
+	m.createMothballWithFiles(
+		"checkategory",
+		[]testFileContents{
+			{"checkers.txt", "2 anagram\n3 command\n"},
+			{"answers.txt", "1 answer123\n2 wat\n3 check.sh\n"},
+			{"3/check.sh", "#!/bin/sh\ntest \"$1\" = moo\n"},
+		},
+	)
+	m.refresh()
+	if _, err := m.CheckAnswer("checkategory", 3, "moo"); err != transpile.ErrCommandCheckerDisabled {
+		t.Error("Checker command run without being enabled:", err)
+	}
+	transpile.RegisterAnswerChecker("command", transpile.CommandChecker{Enabled: true, Timeout: 2 * time.Second})
+	defer transpile.RegisterAnswerChecker("command", transpile.CommandChecker{Timeout: 2 * time.Second})
+	if ok, err := m.CheckAnswer("checkategory", 3, "moo"); (err != nil) || !ok {
+		t.Error("Checker command from the mothball not run:", ok, err)
+	}
+	if ok, _ := m.CheckAnswer("checkategory", 3, "oink"); ok {
+		t.Error("Checker command accepted a wrong answer")
+	}
+	if ok, err := m.CheckAnswer("checkategory", 2, "taw"); err != nil {
+		t.Error(err)
+	} else if !ok {
+		t.Error("Anagram checker from checkers.txt not used")
+	}
+	if ok, _ := m.CheckAnswer("checkategory", 1, "answer123"); !ok {
+		t.Error("Puzzle without a checker isn't using the default")
+	}
+	m.Fs.Remove("checkategory.mb")
+	m.refresh()
+
 	goofyText := "bozonics"
 	//time.Sleep(1 * time.Second) // I don't love this, but we need the mtime to increase, and it's only accurate to 1s
 	m.createMothballWithFiles(
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+// NotifierQueueLength is how many messages can wait to be posted.
+// Messages arriving when the queue is full are dropped.
+const NotifierQueueLength = 50
+
+// notifierTemplates are the default message templates.
+// Each can be replaced by defining a template with the same name.
+const notifierTemplates = `
+{{define "firstblood"}}🩸 First blood: {{.TeamName}} solved {{.Category}} {{.Points}}{{end}}
+{{define "complete"}}🏁 {{.TeamName}} completed {{.Category}}{{end}}
+{{define "leader"}}👑 {{.TeamName}} takes the lead{{end}}
+`
+
+// NotifierMessage is the data given to notifier templates.
+type NotifierMessage struct {
+	TeamName string
+	Category string
+	Points   int
+}
+
+// Notifier announces first bloods, completed categories, and changes in the lead
+// to a Slack or Discord channel, through an incoming webhook URL.
+//
+// Announcements are made by watching the points log,
+// so nothing is announced twice if the server restarts.
+type Notifier struct {
+	URL       string
+	Templates *template.Template
+	Client    *http.Client
+
+	// MinInterval is the shortest time allowed between messages.
+	// Chat services throttle webhooks that post too quickly.
+	MinInterval time.Duration
+
+	server   *MothServer
+	messages chan string
+
+	seen      int                                // How much of the points log has been looked at
+	last      award.T                            // Last award looked at, to notice when the log is rewritten
+	maxSeq    uint64                             // Highest sequence number looked at: nothing up to it is announced again
+	solved    map[string]bool                    // "category points" solved by anyone
+	teamSolve map[string]map[string]map[int]bool // teamID -> category -> points solved
+	completed map[string]bool                    // "teamID category" completed
+	leader    string
+}
+
+// NewNotifier returns a Notifier posting to url, watching server.
+func NewNotifier(server *MothServer, url string) *Notifier {
+	return &Notifier{
+		URL:         url,
+		Templates:   template.Must(template.New("notifier").Parse(notifierTemplates)),
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MinInterval: 1 * time.Second,
+		server:      server,
+		messages:    make(chan string, NotifierQueueLength),
+		solved:      make(map[string]bool),
+		teamSolve:   make(map[string]map[string]map[int]bool),
+		completed:   make(map[string]bool),
+	}
+}
+
+// LoadTemplates reads message templates from filename,
+// replacing any default templates with the same name.
+//
+// Templates are "firstblood", "complete", and "leader",
+// and are given a NotifierMessage.
+func (n *Notifier) LoadTemplates(filename string) error {
+	_, err := n.Templates.ParseFiles(filename)
+	return err
+}
+
+// discord returns true if URL is a Discord webhook.
+// Anything else is assumed to be Slack-compatible.
+func (n *Notifier) discord() bool {
+	return strings.Contains(n.URL, "discord")
+}
+
+// post sends one message.
+func (n *Notifier) post(text string) error {
+	payload := map[string]string{"text": text}
+	if n.discord() {
+		payload = map[string]string{"content": text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// announce renders the named template, and queues the result to be posted.
+func (n *Notifier) announce(name string, msg NotifierMessage) {
+	buf := new(strings.Builder)
+	if err := n.Templates.ExecuteTemplate(buf, name, msg); err != nil {
+		slog.Error("notifier template", "template", name, "error", err)
+		return
+	}
+	select {
+	case n.messages <- buf.String():
+	default:
+		slog.Warn("notifier queue full, dropping message", "template", name)
+	}
+}
+
+// check looks for new awards in the points log, and announces anything interesting.
+// If quiet is true, nothing is announced:
+// this is used at startup to catch up with what's already happened.
+//
+// If the points log was rewritten,
+// for instance by a refund or a merge,
+// everything is worked out again,
+// announcing only awards that haven't been looked at before.
+func (n *Notifier) check(quiet bool) {
+	mh := n.server.NewHandler("")
+	export := mh.ExportState()
+	pointsLog := export.PointsLog
+	if (len(pointsLog) < n.seen) || ((n.seen > 0) && (pointsLog[n.seen-1] != n.last)) {
+		n.seen = 0
+		n.solved = make(map[string]bool)
+		n.teamSolve = make(map[string]map[string]map[int]bool)
+		n.completed = make(map[string]bool)
+	} else if len(pointsLog) == n.seen {
+		return
+	}
+
+	inventory := make(map[string][]int)
+	for _, provider := range n.server.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			inventory[category.Name] = category.Puzzles
+		}
+	}
+
+	for _, awd := range pointsLog[n.seen:] {
+		quiet := quiet || (awd.Seq <= n.maxSeq)
+		n.maxSeq = max(n.maxSeq, awd.Seq)
+		if awd.Part != "" {
+			continue
+		}
+		msg := NotifierMessage{
+			TeamName: export.TeamNames[awd.TeamID],
+			Category: awd.Category,
+			Points:   awd.Points,
+		}
+
+		puzzle := fmt.Sprintf("%s %d", awd.Category, awd.Points)
+		if !n.solved[puzzle] {
+			n.solved[puzzle] = true
+			if !quiet {
+				n.announce("firstblood", msg)
+			}
+		}
+
+		if n.teamSolve[awd.TeamID] == nil {
+			n.teamSolve[awd.TeamID] = make(map[string]map[int]bool)
+		}
+		if n.teamSolve[awd.TeamID][awd.Category] == nil {
+			n.teamSolve[awd.TeamID][awd.Category] = make(map[int]bool)
+		}
+		n.teamSolve[awd.TeamID][awd.Category][awd.Points] = true
+
+		completion := awd.TeamID + " " + awd.Category
+		if !n.completed[completion] && n.complete(inventory[awd.Category], n.teamSolve[awd.TeamID][awd.Category]) {
+			n.completed[completion] = true
+			if !quiet {
+				n.announce("complete", msg)
+			}
+		}
+	}
+	n.seen = len(pointsLog)
+	if n.seen > 0 {
+		n.last = pointsLog[n.seen-1]
+	}
+
+	sb := NewScoreboard(export)
+	leader := ""
+	if (len(sb.Teams) == 1) || ((len(sb.Teams) > 1) && (sb.Teams[1].Score < sb.Teams[0].Score)) {
+		leader = sb.Teams[0].Name
+	}
+	if (leader != "") && (leader != n.leader) {
+		if !quiet {
+			n.announce("leader", NotifierMessage{TeamName: leader})
+		}
+		n.leader = leader
+	}
+}
+
+// complete returns true if every puzzle in inventory has been solved.
+func (n *Notifier) complete(inventory []int, solved map[int]bool) bool {
+	if len(inventory) == 0 {
+		return false
+	}
+	for _, points := range inventory {
+		if !solved[points] {
+			return false
+		}
+	}
+	return true
+}
+
+// send posts queued messages, no more often than MinInterval.
+func (n *Notifier) send() {
+	for text := range n.messages {
+		if err := n.post(text); err != nil {
+			slog.Warn("notifier posting message", "error", err)
+		}
+		time.Sleep(n.MinInterval)
+	}
+}
+
+// Maintain watches the points log for things to announce.
+func (n *Notifier) Maintain(updateInterval time.Duration) {
+	n.check(true)
+	go n.send()
+	for range time.NewTicker(updateInterval).C {
+		n.check(false)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestNotifier(t *testing.T) {
+	var posted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload := make(map[string]string)
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		posted = append(posted, payload["text"])
+	}))
+	defer ts.Close()
+
+	server := NewTestServer()
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teams/alpha", []byte("Alpha"), 0644)
+	afero.WriteFile(state, "teams/bravo", []byte("Bravo"), 0644)
+	state.awardPointsAtTime(10, "alpha", "pategory", 1)
+	server.refresh()
+
+	n := NewNotifier(server.MothServer, ts.URL)
+	n.check(true)
+	if len(n.messages) != 0 {
+		t.Error("Messages queued while catching up")
+	}
+
+	state.awardPointsAtTime(20, "bravo", "pategory", 1)
+	state.awardPointsAtTime(30, "bravo", "pategory", 2)
+	state.awardPointsAtTime(40, "bravo", "pategory", 3)
+	server.refresh()
+	n.check(false)
+	close(n.messages)
+	for text := range n.messages {
+		if err := n.post(text); err != nil {
+			t.Error(err)
+		}
+	}
+
+	expected := []string{
+		"🩸 First blood: Bravo solved pategory 2",
+		"🩸 First blood: Bravo solved pategory 3",
+		"🏁 Bravo completed pategory",
+		"👑 Bravo takes the lead",
+	}
+	if len(posted) != len(expected) {
+		t.Fatal("Wrong messages posted:", posted)
+	}
+	for i := range expected {
+		if posted[i] != expected[i] {
+			t.Errorf("Wrong message: got %q, wanted %q", posted[i], expected[i])
+		}
+	}
+}
+
+func TestNotifierTemplates(t *testing.T) {
+	server := NewTestServer()
+	n := NewNotifier(server.MothServer, "https://discord.com/api/webhooks/1/2")
+	if !n.discord() {
+		t.Error("Didn't recognize Discord webhook URL")
+	}
+
+	filename := filepath.Join(t.TempDir(), "templates.txt")
+	os.WriteFile(filename, []byte(`{{define "leader"}}{{.TeamName}} is winning{{end}}`), 0644)
+	if err := n.LoadTemplates(filename); err != nil {
+		t.Fatal(err)
+	}
+	n.announce("leader", NotifierMessage{TeamName: "Alpha"})
+	if msg := <-n.messages; msg != "Alpha is winning" {
+		t.Error("Template not replaced:", msg)
+	}
+	n.announce("complete", NotifierMessage{TeamName: "Alpha", Category: "cat"})
+	if msg := <-n.messages; msg != "🏁 Alpha completed cat" {
+		t.Error("Default template lost:", msg)
+	}
+}
+
+func TestNotifierRewrittenLog(t *testing.T) {
+	server := NewTestServer()
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teams/alpha", []byte("Alpha"), 0644)
+	afero.WriteFile(state, "teams/bravo", []byte("Bravo"), 0644)
+	state.awardPointsAtTime(10, "alpha", "pategory", 1)
+	state.awardPointsAtTime(20, "alpha", "pategory", 2)
+	server.refresh()
+
+	n := NewNotifier(server.MothServer, "http://localhost/")
+	n.check(true)
+
+	// Refunding makes the points log shorter
+	if err := state.RetirePuzzle("pategory", 1, true); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	n.check(false)
+	if len(n.messages) != 0 {
+		t.Error("Messages queued for a shorter log:", len(n.messages))
+	}
+
+	state.awardPointsAtTime(30, "bravo", "pategory", 3)
+	server.refresh()
+	n.check(false)
+	close(n.messages)
+	var messages []string
+	for msg := range n.messages {
+		messages = append(messages, msg)
+	}
+	if (len(messages) != 2) || (messages[0] != "🩸 First blood: Bravo solved pategory 3") || (messages[1] != "👑 Bravo takes the lead") {
+		t.Error("Wrong messages after the log was rewritten:", messages)
+	}
+}
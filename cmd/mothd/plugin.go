@@ -0,0 +1,766 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+// Plugin is a provider running as a separate program,
+// which may be written in any language.
+//
+// mothd starts the program,
+// and sends it JSON-RPC 1.0 requests on its standard input,
+// reading responses from its standard output.
+// Anything it writes to standard error is passed along to mothd's.
+// Each request has one parameter, a PluginArgs object,
+// and methods are named for the PuzzleProvider or StateProvider method they implement,
+// like "Puzzles.CheckAnswer" or "State.TeamName".
+// If the program exits, it's started again for the next request.
+type Plugin struct {
+	Path string
+	Args []string
+
+	// dial starts the plugin, returning a connection to it
+	dial func() (io.ReadWriteCloser, error)
+
+	lock   sync.Mutex
+	client *rpc.Client
+}
+
+// PluginArgs is the parameter to every plugin method.
+// Each method only sets the fields it needs.
+type PluginArgs struct {
+	TeamID   string   `json:",omitempty"`
+	TeamName string   `json:",omitempty"`
+	Category string   `json:",omitempty"`
+	Points   int      `json:",omitempty"`
+	Path     string   `json:",omitempty"`
+	Answer   string   `json:",omitempty"`
+	Part     string   `json:",omitempty"`
+	Score    int      `json:",omitempty"`
+	Avatar   []byte   `json:",omitempty"` // Base64-encoded
+	Hash     string   `json:",omitempty"`
+	Division string   `json:",omitempty"`
+	Locale   string   `json:",omitempty"`
+	Event    string   `json:",omitempty"`
+	Extra    []string `json:",omitempty"`
+
+	Certificate *Certificate `json:",omitempty"`
+	Code        string       `json:",omitempty"`
+	Schedule    string       `json:",omitempty"`
+	Refund      bool         `json:",omitempty"`
+	Text        string       `json:",omitempty"`
+	Email       string       `json:",omitempty"`
+	Count       int          `json:",omitempty"`
+	Rotate      bool         `json:",omitempty"`
+	Unlocked    bool         `json:",omitempty"`
+	Released    bool         `json:",omitempty"`
+	Renew       bool         `json:",omitempty"`
+	Member      string       `json:",omitempty"`
+	Name        string       `json:",omitempty"`
+
+	Session *EndedSession `json:",omitempty"`
+}
+
+// PluginFile is the result of opening a file.
+type PluginFile struct {
+	Data    []byte // Base64-encoded
+	ModTime time.Time
+}
+
+// PluginAnswer is the result of checking an answer.
+type PluginAnswer struct {
+	Correct bool
+	Part    string
+}
+
+// pipeConn joins a program's standard output and standard input into a connection.
+type pipeConn struct {
+	io.ReadCloser
+	w io.WriteCloser
+}
+
+func (c pipeConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c pipeConn) Close() error {
+	c.w.Close()
+	return c.ReadCloser.Close()
+}
+
+// NewPlugin returns a new Plugin running command,
+// which is split into words at spaces.
+// The program isn't started until it's needed.
+func NewPlugin(command string) (*Plugin, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty plugin command")
+	}
+	p := &Plugin{
+		Path: args[0],
+		Args: args[1:],
+	}
+	p.dial = p.start
+	return p, nil
+}
+
+// start runs the plugin program.
+func (p *Plugin) start() (io.ReadWriteCloser, error) {
+	cmd := exec.Command(p.Path, p.Args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	slog.Info("started plugin", "path", p.Path, "pid", cmd.Process.Pid)
+	go func() {
+		err := cmd.Wait()
+		slog.Warn("plugin exited", "path", p.Path, "error", err)
+	}()
+	return pipeConn{stdout, stdin}, nil
+}
+
+// connect returns a client connected to the plugin,
+// starting it if it's not running.
+// If stale is the current client, it's thrown away and a new one made.
+func (p *Plugin) connect(stale *rpc.Client) (*rpc.Client, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if (p.client != nil) && (p.client == stale) {
+		p.client.Close()
+		p.client = nil
+	}
+	if p.client == nil {
+		conn, err := p.dial()
+		if err != nil {
+			return nil, err
+		}
+		p.client = jsonrpc.NewClient(conn)
+	}
+	return p.client, nil
+}
+
+// call calls a plugin method.
+// If the connection to the plugin was lost,
+// the plugin is started again, and the call tried once more.
+func (p *Plugin) call(method string, args PluginArgs, reply interface{}) error {
+	client, err := p.connect(nil)
+	if err != nil {
+		return err
+	}
+	err = client.Call(method, args, reply)
+
+	// Anything but an error from the plugin means the connection is broken
+	var serverError rpc.ServerError
+	if (err != nil) && !errors.As(err, &serverError) {
+		slog.Warn("lost connection to plugin", "path", p.Path, "error", err)
+		if client, err = p.connect(client); err != nil {
+			return err
+		}
+		err = client.Call(method, args, reply)
+	}
+
+	if errors.As(err, &serverError) {
+		return pluginError(string(serverError))
+	}
+	return err
+}
+
+// pluginErrors are errors that mean something to mothd.
+// Plugins return them by using the same message.
+var pluginErrors = []error{
+	ErrAlreadyAwarded,
+	ErrAlreadyRegistered,
+	ErrIncorrectAnswer,
+	ErrInvalidAvatar,
+	ErrInvalidCertificate,
+	ErrInvalidJoinCode,
+	ErrInvalidLocale,
+	ErrInvalidSession,
+	ErrInvalidTeamID,
+	ErrInvalidTeamName,
+	ErrPaused,
+	ErrPuzzleLocked,
+	ErrRegistrationClosed,
+	ErrTeamFull,
+	ErrTooManyTeams,
+	ErrUnknownDivision,
+	ErrUnknownMember,
+	ErrUnknownTeamID,
+}
+
+// pluginError returns the error with message msg.
+func pluginError(msg string) error {
+	for _, err := range pluginErrors {
+		if err.Error() == msg {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+// PluginPuzzleProvider is a PuzzleProvider in a plugin.
+type PluginPuzzleProvider struct {
+	*Plugin
+
+	inventoryLock sync.RWMutex
+	inventory     []Category
+}
+
+// NewPluginPuzzleProvider returns a PuzzleProvider running command.
+func NewPluginPuzzleProvider(command string) (*PluginPuzzleProvider, error) {
+	plugin, err := NewPlugin(command)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginPuzzleProvider{Plugin: plugin}, nil
+}
+
+// Open calls Puzzles.Open, with Category, Points, and Path.
+func (pp *PluginPuzzleProvider) Open(cat string, points int, path string) (ReadSeekCloser, time.Time, error) {
+	var f PluginFile
+	err := pp.call("Puzzles.Open", PluginArgs{Category: cat, Points: points, Path: path}, &f)
+	return NullReadSeekCloser{bytes.NewReader(f.Data)}, f.ModTime, err
+}
+
+// Inventory returns what Puzzles.Inventory returned when the provider was last refreshed.
+func (pp *PluginPuzzleProvider) Inventory() []Category {
+	pp.inventoryLock.RLock()
+	defer pp.inventoryLock.RUnlock()
+	return pp.inventory
+}
+
+// CheckAnswer calls Puzzles.CheckAnswer, with Category, Points, and Answer.
+func (pp *PluginPuzzleProvider) CheckAnswer(cat string, points int, answer string) (bool, error) {
+	var ans PluginAnswer
+	err := pp.call("Puzzles.CheckAnswer", PluginArgs{Category: cat, Points: points, Answer: answer}, &ans)
+	return ans.Correct, err
+}
+
+// CheckAnswerPart calls Puzzles.CheckAnswer, with Category, Points, and Answer,
+// and returns the part it says was solved.
+func (pp *PluginPuzzleProvider) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	var ans PluginAnswer
+	err := pp.call("Puzzles.CheckAnswer", PluginArgs{Category: cat, Points: points, Answer: answer}, &ans)
+	return ans.Part, err
+}
+
+// Mothball calls Puzzles.Mothball, with Category, and writes the returned mothball to w.
+func (pp *PluginPuzzleProvider) Mothball(cat string, w io.Writer) error {
+	var mb []byte
+	if err := pp.call("Puzzles.Mothball", PluginArgs{Category: cat}, &mb); err != nil {
+		return err
+	}
+	_, err := w.Write(mb)
+	return err
+}
+
+// refresh calls Puzzles.Inventory.
+func (pp *PluginPuzzleProvider) refresh() {
+	var inv []Category
+	if err := pp.call("Puzzles.Inventory", PluginArgs{}, &inv); err != nil {
+		slog.Error("refreshing plugin inventory", "path", pp.Path, "error", err)
+		return
+	}
+	pp.inventoryLock.Lock()
+	pp.inventory = inv
+	pp.inventoryLock.Unlock()
+}
+
+// Maintain refreshes the inventory when called, and every updateInterval after that.
+func (pp *PluginPuzzleProvider) Maintain(updateInterval time.Duration) {
+	pp.refresh()
+	for range time.NewTicker(updateInterval).C {
+		pp.refresh()
+	}
+}
+
+// PluginState is a StateProvider in a plugin.
+//
+// The plugin does its own housekeeping:
+// Maintain does nothing.
+type PluginState struct {
+	*Plugin
+}
+
+// NewPluginState returns a StateProvider running command.
+func NewPluginState(command string) (*PluginState, error) {
+	plugin, err := NewPlugin(command)
+	if err != nil {
+		return nil, err
+	}
+	return &PluginState{plugin}, nil
+}
+
+// boolCall calls a method returning a bool.
+// If it fails, def is returned.
+func (ps *PluginState) boolCall(method string, def bool) bool {
+	ret := def
+	if err := ps.call(method, PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", method, "error", err)
+		return def
+	}
+	return ret
+}
+
+// Enabled calls State.Enabled.
+// If the plugin can't be reached, scoring is disabled.
+func (ps *PluginState) Enabled() bool {
+	return ps.boolCall("State.Enabled", false)
+}
+
+// Paused calls State.Paused.
+func (ps *PluginState) Paused() bool {
+	return ps.boolCall("State.Paused", false)
+}
+
+// Pause calls State.Pause.
+func (ps *PluginState) Pause() error {
+	return ps.call("State.Pause", PluginArgs{}, new(bool))
+}
+
+// Resume calls State.Resume.
+func (ps *PluginState) Resume() error {
+	return ps.call("State.Resume", PluginArgs{}, new(bool))
+}
+
+// Until calls State.Until.
+func (ps *PluginState) Until() time.Time {
+	var ret time.Time
+	if err := ps.call("State.Until", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Until", "error", err)
+	}
+	return ret
+}
+
+// Pauses calls State.Pauses.
+func (ps *PluginState) Pauses() ([]Pause, error) {
+	var ret []Pause
+	err := ps.call("State.Pauses", PluginArgs{}, &ret)
+	return ret, err
+}
+
+// Schedule calls State.Schedule.
+func (ps *PluginState) Schedule() (string, error) {
+	var ret string
+	err := ps.call("State.Schedule", PluginArgs{}, &ret)
+	return ret, err
+}
+
+// SetSchedule calls State.SetSchedule, with Schedule.
+func (ps *PluginState) SetSchedule(schedule string) error {
+	return ps.call("State.SetSchedule", PluginArgs{Schedule: schedule}, new(bool))
+}
+
+// awardsCall calls a method returning a list of awards,
+// each in the same form as a line of the points log.
+func (ps *PluginState) awardsCall(method string) award.List {
+	var lines []string
+	if err := ps.call(method, PluginArgs{}, &lines); err != nil {
+		slog.Error("calling plugin", "method", method, "error", err)
+		return award.List{}
+	}
+	ret := make(award.List, 0, len(lines))
+	for _, line := range lines {
+		if awd, err := award.Parse(line); err != nil {
+			slog.Warn("skipping malformed award from plugin", "method", method, "line", line, "error", err)
+		} else {
+			ret = append(ret, awd)
+		}
+	}
+	return ret
+}
+
+// PointsLog calls State.PointsLog.
+func (ps *PluginState) PointsLog() award.List {
+	return ps.awardsCall("State.PointsLog")
+}
+
+// PendingAwards calls State.PendingAwards.
+func (ps *PluginState) PendingAwards() award.List {
+	return ps.awardsCall("State.PendingAwards")
+}
+
+// Revision calls State.Revision.
+func (ps *PluginState) Revision() uint64 {
+	var ret uint64
+	if err := ps.call("State.Revision", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Revision", "error", err)
+	}
+	return ret
+}
+
+// TeamName calls State.TeamName, with TeamID.
+func (ps *PluginState) TeamName(teamID string) (string, error) {
+	var ret string
+	err := ps.call("State.TeamName", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// SetTeamName calls State.SetTeamName, with TeamID and TeamName.
+func (ps *PluginState) SetTeamName(teamID, teamName string) error {
+	return ps.call("State.SetTeamName", PluginArgs{TeamID: teamID, TeamName: teamName}, new(bool))
+}
+
+// AwardPoints calls State.AwardPoints, with TeamID, Category, and Points.
+func (ps *PluginState) AwardPoints(teamID string, cat string, points int) error {
+	return ps.call("State.AwardPoints", PluginArgs{TeamID: teamID, Category: cat, Points: points}, new(bool))
+}
+
+// AwardCredit calls State.AwardCredit, with TeamID, Category, Points, Part, and Score.
+func (ps *PluginState) AwardCredit(teamID string, cat string, points int, part string, score int) error {
+	args := PluginArgs{TeamID: teamID, Category: cat, Points: points, Part: part, Score: score}
+	return ps.call("State.AwardCredit", args, new(bool))
+}
+
+// Multipliers calls State.Multipliers.
+func (ps *PluginState) Multipliers() []Multiplier {
+	var ret []Multiplier
+	if err := ps.call("State.Multipliers", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Multipliers", "error", err)
+	}
+	return ret
+}
+
+// CheckTeamName calls State.CheckTeamName, with TeamName.
+func (ps *PluginState) CheckTeamName(teamName string) error {
+	return ps.call("State.CheckTeamName", PluginArgs{TeamName: teamName}, new(bool))
+}
+
+// RenameTeam calls State.RenameTeam, with TeamID and TeamName.
+func (ps *PluginState) RenameTeam(teamID, teamName string) error {
+	return ps.call("State.RenameTeam", PluginArgs{TeamID: teamID, TeamName: teamName}, new(bool))
+}
+
+// TeamAvatar calls State.TeamAvatar, with TeamID.
+func (ps *PluginState) TeamAvatar(teamID string) (string, error) {
+	var ret string
+	err := ps.call("State.TeamAvatar", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// SetTeamAvatar calls State.SetTeamAvatar, with TeamID and Avatar.
+func (ps *PluginState) SetTeamAvatar(teamID string, avatar []byte) error {
+	return ps.call("State.SetTeamAvatar", PluginArgs{TeamID: teamID, Avatar: avatar}, new(bool))
+}
+
+// OpenAvatar calls State.OpenAvatar, with Hash.
+func (ps *PluginState) OpenAvatar(hash string) (ReadSeekCloser, time.Time, error) {
+	var f PluginFile
+	err := ps.call("State.OpenAvatar", PluginArgs{Hash: hash}, &f)
+	return NullReadSeekCloser{bytes.NewReader(f.Data)}, f.ModTime, err
+}
+
+// Divisions calls State.Divisions.
+func (ps *PluginState) Divisions() []string {
+	var ret []string
+	if err := ps.call("State.Divisions", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Divisions", "error", err)
+	}
+	return ret
+}
+
+// FlagFormats calls State.FlagFormats.
+func (ps *PluginState) FlagFormats() map[string]string {
+	ret := make(map[string]string)
+	if err := ps.call("State.FlagFormats", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.FlagFormats", "error", err)
+	}
+	return ret
+}
+
+// Retired calls State.Retired.
+func (ps *PluginState) Retired() map[string][]int {
+	ret := make(map[string][]int)
+	if err := ps.call("State.Retired", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Retired", "error", err)
+	}
+	return ret
+}
+
+// RetirePuzzle calls State.RetirePuzzle, with Category, Points, and Refund.
+func (ps *PluginState) RetirePuzzle(cat string, points int, refund bool) error {
+	return ps.call("State.RetirePuzzle", PluginArgs{Category: cat, Points: points, Refund: refund}, new(bool))
+}
+
+// RestorePuzzle calls State.RestorePuzzle, with Category and Points.
+func (ps *PluginState) RestorePuzzle(cat string, points int) error {
+	return ps.call("State.RestorePuzzle", PluginArgs{Category: cat, Points: points}, new(bool))
+}
+
+// ReleasedSolutions calls State.ReleasedSolutions.
+func (ps *PluginState) ReleasedSolutions() map[string][]int {
+	ret := make(map[string][]int)
+	if err := ps.call("State.ReleasedSolutions", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.ReleasedSolutions", "error", err)
+	}
+	return ret
+}
+
+// ReleaseSolution calls State.ReleaseSolution, with Category, Points, and Released.
+func (ps *PluginState) ReleaseSolution(cat string, points int, released bool) error {
+	return ps.call("State.ReleaseSolution", PluginArgs{Category: cat, Points: points, Released: released}, new(bool))
+}
+
+// Errata calls State.Errata, with Category and Points.
+func (ps *PluginState) Errata(cat string, points int) Erratum {
+	var ret Erratum
+	if err := ps.call("State.Errata", PluginArgs{Category: cat, Points: points}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.Errata", "error", err)
+	}
+	return ret
+}
+
+// SetErrata calls State.SetErrata, with Category, Points, and Text.
+func (ps *PluginState) SetErrata(cat string, points int, text string) error {
+	return ps.call("State.SetErrata", PluginArgs{Category: cat, Points: points, Text: text}, new(bool))
+}
+
+// ExtraAnswers calls State.ExtraAnswers, with Category and Points.
+func (ps *PluginState) ExtraAnswers(cat string, points int) []string {
+	ret := make([]string, 0)
+	if err := ps.call("State.ExtraAnswers", PluginArgs{Category: cat, Points: points}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.ExtraAnswers", "error", err)
+	}
+	return ret
+}
+
+// AcceptAnswer calls State.AcceptAnswer, with Category, Points, and Answer.
+func (ps *PluginState) AcceptAnswer(cat string, points int, answer string) error {
+	return ps.call("State.AcceptAnswer", PluginArgs{Category: cat, Points: points, Answer: answer}, new(bool))
+}
+
+// TeamEmails calls State.TeamEmails.
+func (ps *PluginState) TeamEmails() map[string]string {
+	ret := make(map[string]string)
+	if err := ps.call("State.TeamEmails", PluginArgs{}, &ret); err != nil {
+		slog.Error("calling plugin", "method", "State.TeamEmails", "error", err)
+	}
+	return ret
+}
+
+// SetTeamEmail calls State.SetTeamEmail, with TeamID and Email.
+func (ps *PluginState) SetTeamEmail(teamID, email string) error {
+	return ps.call("State.SetTeamEmail", PluginArgs{TeamID: teamID, Email: email}, new(bool))
+}
+
+// NewRecoveryCodes calls State.NewRecoveryCodes, with TeamID and Count.
+func (ps *PluginState) NewRecoveryCodes(teamID string, n int) ([]string, error) {
+	var ret []string
+	err := ps.call("State.NewRecoveryCodes", PluginArgs{TeamID: teamID, Count: n}, &ret)
+	return ret, err
+}
+
+// NewTeamID calls State.NewTeamID, with Count.
+func (ps *PluginState) NewTeamID(maxTeams int) (string, error) {
+	var ret string
+	err := ps.call("State.NewTeamID", PluginArgs{Count: maxTeams}, &ret)
+	return ret, err
+}
+
+// JoinCode calls State.JoinCode, with TeamID and Renew.
+func (ps *PluginState) JoinCode(teamID string, renew bool) (string, error) {
+	var ret string
+	err := ps.call("State.JoinCode", PluginArgs{TeamID: teamID, Renew: renew}, &ret)
+	return ret, err
+}
+
+// JoinTeam calls State.JoinTeam, with Code, Name, and Count.
+func (ps *PluginState) JoinTeam(code, name string, maxSize int) (Member, error) {
+	var ret Member
+	err := ps.call("State.JoinTeam", PluginArgs{Code: code, Name: name, Count: maxSize}, &ret)
+	return ret, err
+}
+
+// TeamMembers calls State.TeamMembers, with TeamID.
+func (ps *PluginState) TeamMembers(teamID string) ([]Member, error) {
+	var ret []Member
+	err := ps.call("State.TeamMembers", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// MemberByToken calls State.MemberByToken, with Code.
+func (ps *PluginState) MemberByToken(token string) (Member, error) {
+	var ret Member
+	err := ps.call("State.MemberByToken", PluginArgs{Code: token}, &ret)
+	return ret, err
+}
+
+// RemoveMember calls State.RemoveMember, with TeamID and Member.
+func (ps *PluginState) RemoveMember(teamID, memberID string) error {
+	return ps.call("State.RemoveMember", PluginArgs{TeamID: teamID, Member: memberID}, new(bool))
+}
+
+// RecoverTeam calls State.RecoverTeam, with Code and Rotate.
+func (ps *PluginState) RecoverTeam(code string, rotate bool) (string, error) {
+	var ret string
+	err := ps.call("State.RecoverTeam", PluginArgs{Code: code, Rotate: rotate}, &ret)
+	return ret, err
+}
+
+// SessionKey calls State.SessionKey.
+func (ps *PluginState) SessionKey() ([]byte, error) {
+	var ret []byte
+	err := ps.call("State.SessionKey", PluginArgs{}, &ret)
+	return ret, err
+}
+
+// RevokedSessions calls State.RevokedSessions.
+func (ps *PluginState) RevokedSessions() map[string]time.Time {
+	ret := make(map[string]time.Time)
+	if err := ps.call("State.RevokedSessions", PluginArgs{}, &ret); err != nil {
+		slog.Error("plugin state", "method", "RevokedSessions", "error", err)
+	}
+	return ret
+}
+
+// RevokeSessions calls State.RevokeSessions, with TeamID.
+func (ps *PluginState) RevokeSessions(teamID string) error {
+	return ps.call("State.RevokeSessions", PluginArgs{TeamID: teamID}, new(bool))
+}
+
+// EndedSessions calls State.EndedSessions.
+func (ps *PluginState) EndedSessions() map[string]EndedSession {
+	ret := make(map[string]EndedSession)
+	if err := ps.call("State.EndedSessions", PluginArgs{}, &ret); err != nil {
+		slog.Error("plugin state", "method", "EndedSessions", "error", err)
+	}
+	return ret
+}
+
+// EndSession calls State.EndSession, with Session.
+func (ps *PluginState) EndSession(e EndedSession) error {
+	return ps.call("State.EndSession", PluginArgs{Session: &e}, new(bool))
+}
+
+// TeamDivision calls State.TeamDivision, with TeamID.
+func (ps *PluginState) TeamDivision(teamID string) (string, error) {
+	var ret string
+	err := ps.call("State.TeamDivision", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// SetTeamDivision calls State.SetTeamDivision, with TeamID and Division.
+func (ps *PluginState) SetTeamDivision(teamID, division string) error {
+	return ps.call("State.SetTeamDivision", PluginArgs{TeamID: teamID, Division: division}, new(bool))
+}
+
+// TeamLocale calls State.TeamLocale, with TeamID.
+func (ps *PluginState) TeamLocale(teamID string) (string, error) {
+	var ret string
+	err := ps.call("State.TeamLocale", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// SetTeamLocale calls State.SetTeamLocale, with TeamID and Locale.
+func (ps *PluginState) SetTeamLocale(teamID, locale string) error {
+	return ps.call("State.SetTeamLocale", PluginArgs{TeamID: teamID, Locale: locale}, new(bool))
+}
+
+// AddAttempt calls State.AddAttempt, with TeamID, Category, and Points.
+func (ps *PluginState) AddAttempt(teamID, cat string, points int) error {
+	return ps.call("State.AddAttempt", PluginArgs{TeamID: teamID, Category: cat, Points: points}, new(bool))
+}
+
+// IssueCertificate calls State.IssueCertificate, with Certificate.
+// The plugin signs it, and fills in its Code and Signature.
+func (ps *PluginState) IssueCertificate(cert Certificate) (Certificate, error) {
+	var ret Certificate
+	err := ps.call("State.IssueCertificate", PluginArgs{Certificate: &cert}, &ret)
+	return ret, err
+}
+
+// Certificate calls State.Certificate, with Code.
+func (ps *PluginState) Certificate(code string) (Certificate, error) {
+	var ret Certificate
+	err := ps.call("State.Certificate", PluginArgs{Code: code}, &ret)
+	return ret, err
+}
+
+// OpenPuzzle calls State.OpenPuzzle, with TeamID, Category, and Points.
+func (ps *PluginState) OpenPuzzle(teamID, cat string, points int) error {
+	return ps.call("State.OpenPuzzle", PluginArgs{TeamID: teamID, Category: cat, Points: points}, new(bool))
+}
+
+// TeamOpened calls State.TeamOpened, with TeamID.
+func (ps *PluginState) TeamOpened(teamID string) (map[string]map[int]time.Time, error) {
+	ret := make(map[string]map[int]time.Time)
+	err := ps.call("State.TeamOpened", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// AddWrongAnswer calls State.AddWrongAnswer, with TeamID, Category, and Points.
+func (ps *PluginState) AddWrongAnswer(teamID, cat string, points int) error {
+	return ps.call("State.AddWrongAnswer", PluginArgs{TeamID: teamID, Category: cat, Points: points}, new(bool))
+}
+
+// TeamWrongAnswers calls State.TeamWrongAnswers, with TeamID.
+func (ps *PluginState) TeamWrongAnswers(teamID string) (map[string]map[int][]time.Time, error) {
+	ret := make(map[string]map[int][]time.Time)
+	err := ps.call("State.TeamWrongAnswers", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// TeamUnlocks calls State.TeamUnlocks, with TeamID.
+func (ps *PluginState) TeamUnlocks(teamID string) (map[string][]int, error) {
+	ret := make(map[string][]int)
+	err := ps.call("State.TeamUnlocks", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// SetTeamUnlock calls State.SetTeamUnlock, with TeamID, Category, Points, and Unlocked.
+func (ps *PluginState) SetTeamUnlock(teamID, cat string, points int, unlocked bool) error {
+	return ps.call("State.SetTeamUnlock", PluginArgs{TeamID: teamID, Category: cat, Points: points, Unlocked: unlocked}, new(bool))
+}
+
+// TeamAttempts calls State.TeamAttempts, with TeamID.
+func (ps *PluginState) TeamAttempts(teamID string) (map[string]map[int]int, error) {
+	ret := make(map[string]map[int]int)
+	err := ps.call("State.TeamAttempts", PluginArgs{TeamID: teamID}, &ret)
+	return ret, err
+}
+
+// LogEvent calls State.LogEvent, with Event, TeamID, Category, Points, and Extra.
+func (ps *PluginState) LogEvent(event, teamID, cat string, points int, extra ...string) {
+	args := PluginArgs{Event: event, TeamID: teamID, Category: cat, Points: points, Extra: extra}
+	if err := ps.call("State.LogEvent", args, new(bool)); err != nil {
+		slog.Error("calling plugin", "method", "State.LogEvent", "error", err)
+	}
+}
+
+// Backup calls State.Backup, and writes the returned backup to w.
+func (ps *PluginState) Backup(w io.Writer) error {
+	var buf []byte
+	if err := ps.call("State.Backup", PluginArgs{}, &buf); err != nil {
+		return err
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Maintain does nothing: the plugin looks after itself.
+func (ps *PluginState) Maintain(updateInterval time.Duration) {
+}
+
+func (ps *PluginState) refresh() {
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"testing"
+)
+
+// testPluginPuzzles serves Puzzles.* methods from a PuzzleProvider.
+type testPluginPuzzles struct {
+	PuzzleProvider
+}
+
+func (p *testPluginPuzzles) Inventory(args PluginArgs, reply *[]Category) error {
+	*reply = p.PuzzleProvider.Inventory()
+	return nil
+}
+
+func (p *testPluginPuzzles) Open(args PluginArgs, reply *PluginFile) error {
+	f, mtime, err := p.PuzzleProvider.Open(args.Category, args.Points, args.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reply.ModTime = mtime
+	reply.Data, err = io.ReadAll(f)
+	return err
+}
+
+func (p *testPluginPuzzles) CheckAnswer(args PluginArgs, reply *PluginAnswer) error {
+	correct, err := p.PuzzleProvider.CheckAnswer(args.Category, args.Points, args.Answer)
+	reply.Correct = correct
+	return err
+}
+
+// testPluginState serves some State.* methods from a StateProvider.
+type testPluginState struct {
+	StateProvider
+}
+
+func (s *testPluginState) TeamName(args PluginArgs, reply *string) error {
+	name, err := s.StateProvider.TeamName(args.TeamID)
+	*reply = name
+	return err
+}
+
+func (s *testPluginState) AwardPoints(args PluginArgs, reply *bool) error {
+	return s.StateProvider.AwardPoints(args.TeamID, args.Category, args.Points)
+}
+
+func (s *testPluginState) PointsLog(args PluginArgs, reply *[]string) error {
+	for _, awd := range s.StateProvider.PointsLog() {
+		*reply = append(*reply, awd.String())
+	}
+	return nil
+}
+
+// newTestPlugin returns a Plugin connected to an RPC server in this process,
+// and a function to disconnect it.
+func newTestPlugin(puzzles PuzzleProvider, state StateProvider) (*Plugin, func()) {
+	server := rpc.NewServer()
+	server.RegisterName("Puzzles", &testPluginPuzzles{puzzles})
+	server.RegisterName("State", &testPluginState{state})
+
+	var serverConn net.Conn
+	plugin := &Plugin{Path: "test"}
+	plugin.dial = func() (io.ReadWriteCloser, error) {
+		var clientConn net.Conn
+		serverConn, clientConn = net.Pipe()
+		go server.ServeCodec(jsonrpc.NewServerCodec(serverConn))
+		return clientConn, nil
+	}
+	return plugin, func() { serverConn.Close() }
+}
+
+func TestPluginPuzzleProvider(t *testing.T) {
+	mothballs := NewTestMothballs()
+	mothballs.refresh()
+	plugin, _ := newTestPlugin(mothballs, nil)
+	pp := &PluginPuzzleProvider{Plugin: plugin}
+
+	pp.refresh()
+	if inv := pp.Inventory(); (len(inv) != 1) || (inv[0].Name != "pategory") {
+		t.Error("Wrong inventory:", inv)
+	}
+	if f, _, err := pp.Open("pategory", 1, "puzzle.json"); err != nil {
+		t.Error(err)
+	} else if buf, _ := io.ReadAll(f); len(buf) == 0 {
+		t.Error("Empty puzzle")
+	}
+	if _, _, err := pp.Open("nonegory", 1, "puzzle.json"); (err == nil) || (err.Error() != "no such category: nonegory") {
+		t.Error("Wrong error opening a missing category:", err)
+	}
+	if ok, err := pp.CheckAnswer("pategory", 1, "answer123"); !ok || (err != nil) {
+		t.Error("Right answer marked wrong", err)
+	}
+	if ok, _ := pp.CheckAnswer("pategory", 1, "nope"); ok {
+		t.Error("Wrong answer marked right")
+	}
+}
+
+func TestPluginState(t *testing.T) {
+	state := NewTestState()
+	state.refresh()
+	plugin, disconnect := newTestPlugin(nil, state)
+	ps := &PluginState{plugin}
+
+	if _, err := ps.TeamName("nobody"); err == nil {
+		t.Error("Unregistered team has a name")
+	}
+	if err := ps.AwardPoints("team", "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+	if err := ps.AwardPoints("team", "pategory", 1); err != ErrAlreadyAwarded {
+		t.Error("Wrong error for a duplicate award:", err)
+	}
+
+	// The plugin goes away, and comes back
+	disconnect()
+	pl := ps.PointsLog()
+	if (len(pl) != 1) || (pl[0].TeamID != "team") || (pl[0].Points != 1) {
+		t.Error("Wrong points log:", pl)
+	}
+	if err := ps.Pause(); err == nil {
+		t.Error("Calling a method the plugin doesn't have worked")
+	}
+}
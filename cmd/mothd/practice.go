@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// ErrPracticeAnswer means an answer was correct,
+// but no points were awarded, because the server is in practice mode.
+var ErrPracticeAnswer = errors.New("correct, but no points are awarded in practice mode")
+
+// sendPracticeResponse tells a team its answer was correct, in practice mode,
+// with where to find the puzzle's solution, if it has one.
+func sendPracticeResponse(mh MothRequestHandler, w http.ResponseWriter, base string, cat string, points int) {
+	resp := answerResponse{
+		Short:       "practice",
+		Description: ErrPracticeAnswer.Error(),
+	}
+	if mh.hasSolution(cat, points) {
+		resp.Solution = fmt.Sprintf("%s/content/%s/%d/%s", base, url.PathEscape(cat), points, transpile.SolutionFile)
+	}
+	jsend.Send(w, jsend.Success, resp)
+}
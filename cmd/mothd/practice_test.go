@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+)
+
+func TestPractice(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers: [moo]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/2/puzzle.md", []byte("---\nanswers: [moo]\nattachments: [solution.html]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/2/solution.html", []byte("<p>Say moo.</p>"), 0644)
+	afero.WriteFile(fs, "cows/3/puzzle.md", []byte("---\nanswers: [moo]\n---\nHi.\n"), 0644)
+	state := NewTestState()
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teamids.txt", []byte(TestTeamID+"\n"), 0644)
+	state.SetTeamName(TestTeamID, "Team One")
+	state.refresh()
+	srv := NewMothServer(Configuration{}, NewTestTheme(), state, NewTranspilerProvider(fs))
+	hs := NewHTTPServer("/", srv)
+
+	handler := srv.NewHandler(TestTeamID)
+	if _, _, err := handler.PuzzlesOpen("cows", 2, transpile.SolutionFile); err != ErrPuzzleLocked {
+		t.Error("Solution of a locked puzzle opened:", err)
+	}
+
+	srv.Config.Practice = true
+	handler = srv.NewHandler(TestTeamID)
+	if p := handler.ExportState().Puzzles["cows"]; !reflect.DeepEqual(p, []int{1, 2, 3, 0}) {
+		t.Error("Not every puzzle unlocked in practice mode:", p)
+	}
+	if err := handler.CheckAnswer("cows", 2, "moo"); err != ErrPracticeAnswer {
+		t.Error("Wrong outcome of a correct answer:", err)
+	}
+	if err := handler.CheckAnswer("cows", 2, "oink"); err != ErrIncorrectAnswer {
+		t.Error("Wrong outcome of a wrong answer:", err)
+	}
+	state.refresh()
+	if pl := state.PointsLog(); len(pl) != 0 {
+		t.Error("Points awarded in practice mode:", pl)
+	}
+	if r, _, err := handler.PuzzlesOpen("cows", 2, transpile.SolutionFile); err != nil {
+		t.Error("Solution withheld in practice mode:", err)
+	} else {
+		r.Close()
+	}
+
+	for points, solution := range map[string]string{"2": "/content/cows/2/solution.html", "3": ""} {
+		resp := struct {
+			Status string
+			Data   answerResponse
+		}{}
+		r := hs.TestRequest("/answer", map[string]string{"cat": "cows", "points": points, "answer": "moo"})
+		if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if (resp.Status != "success") || (resp.Data.Short != "practice") || (resp.Data.Solution != solution) {
+			t.Error(points, "wrong response:", r.Body.String())
+		}
+	}
+}
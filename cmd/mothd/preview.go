@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// PuzzlePreview is everything about a puzzle an author checks before an event:
+// the puzzle as teams see it, with its debug information and answers.
+type PuzzlePreview struct {
+	Category string
+	Points   int
+	Puzzle   transpile.Puzzle
+}
+
+// Preview returns a PuzzlePreview of a puzzle.
+// Puzzles from mothballs have no answers or debug information to show.
+func (mh *MothRequestHandler) Preview(cat string, points int) (*PuzzlePreview, error) {
+	r, _, err := mh.openProvided(cat, points, "puzzle.json")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	preview := PuzzlePreview{
+		Category: cat,
+		Points:   points,
+	}
+	if err := json.NewDecoder(r).Decode(&preview.Puzzle); err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// PreviewInventory returns every category, with its puzzles sorted,
+// from every puzzle provider.
+func (mh *MothRequestHandler) PreviewInventory() []Category {
+	inventory := []Category{}
+	for _, provider := range mh.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			puzzles := append([]int{}, category.Puzzles...)
+			sort.Ints(puzzles)
+			inventory = append(inventory, Category{Name: category.Name, Puzzles: puzzles})
+		}
+	}
+	sort.Slice(inventory, func(i, j int) bool { return inventory[i].Name < inventory[j].Name })
+	return inventory
+}
+
+// WriteHTML renders the preview as a web page.
+// The page's base URL is the puzzle's content directory, contentURL,
+// so the body can use its attachments the way it does in the theme.
+func (p *PuzzlePreview) WriteHTML(w io.Writer, contentURL string, indexURL string) error {
+	return previewTemplate.Execute(w, struct {
+		*PuzzlePreview
+		Body       template.HTML
+		ContentURL string
+		IndexURL   string
+	}{
+		PuzzlePreview: p,
+		Body:          template.HTML(p.Puzzle.Body),
+		ContentURL:    contentURL,
+		IndexURL:      indexURL,
+	})
+}
+
+// writePreviewIndex renders a list of puzzles to preview.
+func writePreviewIndex(w io.Writer, inventory []Category) error {
+	return previewIndexTemplate.Execute(w, inventory)
+}
+
+// previewStyle is the style sheet of the preview pages.
+const previewStyle = `
+      body { font-family: sans-serif; max-width: 60em; margin: auto; padding: 1em; background: #222; color: #eee; }
+      a { color: #b9cbd8; }
+      main { border: 1px solid #666; padding: 0 1em; }
+      main img { max-width: 100%; }
+      .debug { background: #332; padding: 0.5em 1em; margin: 1em 0; }
+      .errors { color: #f88; }
+      code { color: #fc8; }
+      th { text-align: left; vertical-align: top; padding-right: 1em; }
+`
+
+var previewIndexTemplate = template.Must(template.New("previewIndex").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>Puzzle previews</title>
+    <meta charset="utf-8">
+    <style>` + previewStyle + `    </style>
+  </head>
+  <body>
+    <h1>Puzzle previews</h1>
+    {{- range .}}
+    <h2>{{.Name}}</h2>
+    <p>
+      {{- $category := .Name}}
+      {{- range .Puzzles}}
+      <a href="{{$category}}/{{.}}">{{.}}</a>
+      {{- end}}
+    </p>
+    {{- else}}
+    <p>No puzzles.</p>
+    {{- end}}
+  </body>
+</html>
+`))
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>{{.Category}} {{.Points}}</title>
+    <meta charset="utf-8">
+    <base href="{{.ContentURL}}">
+    <style>` + previewStyle + `    </style>
+    {{- range .Puzzle.Scripts}}
+    <script src="{{.}}"></script>
+    {{- end}}
+  </head>
+  <body>
+    <p><a href="{{.IndexURL}}">All puzzles</a></p>
+    <h1>{{.Category}} {{.Points}}{{with .Puzzle.Debug.Summary}}: {{.}}{{end}}</h1>
+    {{- with .Puzzle.Debug.Errors}}
+    <div class="debug errors">
+      <h2>Errors</h2>
+      <ul>
+        {{- range .}}
+        <li>{{.}}</li>
+        {{- end}}
+      </ul>
+    </div>
+    {{- end}}
+    <main>
+{{.Body}}
+    </main>
+    {{- with .Puzzle.Attachments}}
+    <h2>Attachments</h2>
+    <ul>
+      {{- range .}}
+      <li><a href="{{.}}" download>{{.}}</a></li>
+      {{- end}}
+    </ul>
+    {{- end}}
+    {{- if .Puzzle.Solution}}
+    <p><a href="solution.html">Solution</a></p>
+    {{- end}}
+    <div class="debug">
+      <h2>Answers</h2>
+      <table>
+        <tr><th>Checker</th><td>{{or .Puzzle.Checker "exact"}}</td></tr>
+        {{- if .Puzzle.Answers}}
+        <tr><th>Answers</th><td>{{range .Puzzle.Answers}}<code>{{.}}</code><br>{{end}}</td></tr>
+        {{- end}}
+        {{- range .Puzzle.Parts}}
+        <tr><th>Part {{.Name}}</th><td>{{range .Answers}}<code>{{.}}</code><br>{{end}}</td></tr>
+        {{- end}}
+        {{- range .Puzzle.Tiers}}
+        <tr><th>Tier {{.Name}} ({{.Value}})</th><td>{{range .Answers}}<code>{{.}}</code><br>{{end}}</td></tr>
+        {{- end}}
+      </table>
+      {{- if not (or .Puzzle.Answers .Puzzle.Parts .Puzzle.Tiers)}}
+      <p>No answers to show: this puzzle may come from a mothball.</p>
+      {{- end}}
+    </div>
+    {{- with .Puzzle.Debug.Hints}}
+    <div class="debug">
+      <h2>Hints</h2>
+      <ul>
+        {{- range .}}
+        <li>{{.}}</li>
+        {{- end}}
+      </ul>
+    </div>
+    {{- end}}
+    {{- with .Puzzle.Debug.Notes}}
+    <div class="debug">
+      <h2>Notes</h2>
+      <p>{{.}}</p>
+    </div>
+    {{- end}}
+    {{- with .Puzzle.Debug.Accessibility}}
+    <div class="debug">
+      <h2>Accessibility</h2>
+      <ul>
+        {{- range .}}
+        <li>{{.}}</li>
+        {{- end}}
+      </ul>
+    </div>
+    {{- end}}
+    {{- with .Puzzle.Debug.Log}}
+    <div class="debug">
+      <h2>Log</h2>
+      <ul>
+        {{- range .}}
+        <li>{{.}}</li>
+        {{- end}}
+      </ul>
+    </div>
+    {{- end}}
+    {{- with .Puzzle.Authors}}
+    <p>Puzzle by {{range $i, $a := .}}{{if $i}}, {{end}}{{$a}}{{end}}</p>
+    {{- end}}
+  </body>
+</html>
+`))
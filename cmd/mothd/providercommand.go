@@ -7,7 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"sort"
@@ -35,7 +35,7 @@ func (pc ProviderCommand) Inventory() (inv []Category) {
 
 	stdout, err := cmd.Output()
 	if err != nil {
-		log.Print(err)
+		slog.Error("running puzzle provider command", "path", pc.Path, "error", err)
 		return
 	}
 
@@ -46,7 +46,7 @@ func (pc ProviderCommand) Inventory() (inv []Category) {
 		}
 		parts := strings.Split(line, " ")
 		if len(parts) < 2 {
-			log.Println("Skipping misformatted line:", line)
+			slog.Warn("skipping misformatted line", "path", pc.Path, "line", line)
 			continue
 		}
 		name := parts[0]
@@ -54,7 +54,7 @@ func (pc ProviderCommand) Inventory() (inv []Category) {
 		for _, pointsString := range parts[1:] {
 			points, err := strconv.Atoi(pointsString)
 			if err != nil {
-				log.Println(err)
+				slog.Warn("reading points", "path", pc.Path, "error", err)
 				continue
 			}
 			puzzles = append(puzzles, points)
@@ -109,7 +109,7 @@ func (pc ProviderCommand) CheckAnswer(cat string, points int, answer string) (bo
 
 	stdout, err := cmd.Output()
 	if ee, ok := err.(*exec.ExitError); ok {
-		log.Printf("WARNING: %s: %s", pc.Path, string(ee.Stderr))
+		slog.Warn("puzzle provider command failed", "path", pc.Path, "stderr", string(ee.Stderr))
 		return false, err
 	} else if err != nil {
 		return false, err
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// RecommendCount is the most puzzles Recommend suggests at once.
+const RecommendCount = 3
+
+// RecommendStreak is how many puzzles at a difficulty a team solves
+// before harder ones are recommended.
+const RecommendStreak = 2
+
+// Recommendation is a puzzle suggested for a team to try next.
+type Recommendation struct {
+	Category   string
+	Points     int
+	Difficulty int `json:",omitempty"`
+}
+
+// Recommend suggests up to RecommendCount unlocked puzzles for the team to try next,
+// best first.
+//
+// The team's level is the difficulty of the hardest puzzle it's solved,
+// or 1 if it hasn't solved any with a difficulty.
+// Once it's solved RecommendStreak puzzles at that level,
+// puzzles a level harder are recommended.
+// Puzzles closest to that difficulty come first, easier ones before harder,
+// then puzzles with no difficulty, each in order of point value.
+func (mh *MothRequestHandler) Recommend() ([]Recommendation, error) {
+	teamName, err := mh.State.TeamName(mh.teamID)
+	if err != nil {
+		return nil, ErrInvalidTeamID
+	}
+	export := mh.exportState(true, teamName)
+	difficulties := mh.PuzzleDifficulties()
+
+	solved := make(map[string]map[int]bool)
+	solvedAt := make(map[int]int)
+	level := 1
+	for cat, pointsList := range export.Solved {
+		solved[cat] = make(map[int]bool)
+		for _, points := range pointsList {
+			solved[cat][points] = true
+			if d := difficulties[cat][points]; d > 0 {
+				solvedAt[d]++
+				level = max(level, d)
+			}
+		}
+	}
+	if (solvedAt[level] >= RecommendStreak) && (level < transpile.MaxDifficulty) {
+		level++
+	}
+
+	recs := []Recommendation{}
+	for cat, pointsList := range export.Puzzles {
+		for _, points := range pointsList {
+			if (points == 0) || solved[cat][points] {
+				continue
+			}
+			recs = append(recs, Recommendation{
+				Category:   cat,
+				Points:     points,
+				Difficulty: difficulties[cat][points],
+			})
+		}
+	}
+
+	// distance ranks a difficulty: easier puzzles are a half step closer than harder ones,
+	// and puzzles with no difficulty come last.
+	distance := func(d int) int {
+		switch {
+		case d == 0:
+			return 4 * transpile.MaxDifficulty
+		case d < level:
+			return 2*(level-d) - 1
+		default:
+			return 2 * (d - level)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		a, b := recs[i], recs[j]
+		if da, db := distance(a.Difficulty), distance(b.Difficulty); da != db {
+			return da < db
+		}
+		if a.Points != b.Points {
+			return a.Points < b.Points
+		}
+		return a.Category < b.Category
+	})
+	if len(recs) > RecommendCount {
+		recs = recs[:RecommendCount]
+	}
+	return recs, nil
+}
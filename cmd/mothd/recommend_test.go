@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRecommend(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for name, difficulty := range map[string]string{"a/1": "1", "a/2": "1", "a/3": "2", "a/4": "3", "a/5": "", "b/1": "2"} {
+		header := "answer: a\n"
+		if difficulty != "" {
+			header += "difficulty: " + difficulty + "\n"
+		}
+		afero.WriteFile(fs, name+"/puzzle.md", []byte(header+"\nHi.\n"), 0644)
+	}
+	state := NewTestState()
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teamids.txt", []byte(TestTeamID+"\n"), 0644)
+	srv := NewMothServer(Configuration{Devel: true}, NewTestTheme(), state, NewTranspilerProvider(fs))
+	hs := NewHTTPServer("/", srv)
+
+	if r := hs.TestGetRequest("/recommend", nil); !strings.Contains(r.Body.String(), "fail") {
+		t.Error("Unregistered team got recommendations:", r.Body.String())
+	}
+	state.SetTeamName(TestTeamID, "Team One")
+	state.refresh()
+
+	recommended := func() []Recommendation {
+		handler := srv.NewHandler(TestTeamID)
+		recs, err := handler.Recommend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recs
+	}
+
+	if recs := recommended(); !reflect.DeepEqual(recs, []Recommendation{{"a", 1, 1}, {"a", 2, 1}, {"b", 1, 2}}) {
+		t.Error("Wrong first recommendations:", recs)
+	}
+
+	state.AwardPoints(TestTeamID, "a", 1)
+	state.AwardPoints(TestTeamID, "a", 2)
+	state.refresh()
+	if recs := recommended(); !reflect.DeepEqual(recs, []Recommendation{{"b", 1, 2}, {"a", 3, 2}, {"a", 4, 3}}) {
+		t.Error("Wrong recommendations after two easy puzzles:", recs)
+	}
+
+	state.AwardPoints(TestTeamID, "a", 4)
+	state.refresh()
+	if recs := recommended(); !reflect.DeepEqual(recs, []Recommendation{{"b", 1, 2}, {"a", 3, 2}, {"a", 5, 0}}) {
+		t.Error("Wrong recommendations after a hard puzzle:", recs)
+	}
+
+	if r := hs.TestGetRequest("/recommend", nil); !strings.Contains(r.Body.String(), `"Category":"b"`) {
+		t.Error("Wrong response:", r.Body.String())
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// ErrInvalidRecoveryCode means a recovery code doesn't belong to any team,
+// or has already been used.
+var ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+
+// recoveryEncoding spells recovery codes in lowercase letters and digits.
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// newRecoveryCode returns a random recovery code, like "k2xq-7fma-pz4d-w9nb".
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := recoveryEncoding.EncodeToString(buf)
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// hashRecoveryCode returns how a recovery code is stored.
+// Case, spaces, and dashes don't matter.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRecoveryCodes gives a team n new recovery codes,
+// replacing any it had.
+//
+// Only their hashes are kept, so this is the only time they can be seen.
+func (s *State) NewRecoveryCodes(teamID string, n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	hashes := new(strings.Builder)
+	for i := 0; i < n; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		fmt.Fprintln(hashes, hashRecoveryCode(code))
+	}
+
+	s.Mkdir("recovery", 0755)
+	if err := s.writeFileAtomic(filepath.Join("recovery", teamID), []byte(hashes.String())); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RecoverTeam returns the ID of the team a recovery code belongs to.
+// The code can't be used again.
+//
+// If rotate is true, the team is given a new ID, which is returned,
+// and the old one stops working.
+func (s *State) RecoverTeam(code string, rotate bool) (string, error) {
+	s.lock.Lock()
+	teamID, err := s.useRecoveryCode(hashRecoveryCode(code))
+	s.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	newID := teamID
+	if rotate {
+		if newID, err = s.rotateTeamID(teamID); err != nil {
+			return "", err
+		}
+	}
+	s.LogEvent("recovered", teamID, "", 0, newID)
+	return newID, nil
+}
+
+// useRecoveryCode finds the team a recovery code's hash belongs to,
+// and removes it.
+// The caller must hold s.lock.
+func (s *State) useRecoveryCode(hash string) (string, error) {
+	files, err := afero.ReadDir(s, "recovery")
+	if err != nil {
+		return "", ErrInvalidRecoveryCode
+	}
+	for _, fi := range files {
+		filename := filepath.Join("recovery", fi.Name())
+		f, err := s.Open(filename)
+		if err != nil {
+			continue
+		}
+		found := false
+		kept := new(strings.Builder)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line == hash {
+				found = true
+			} else if line != "" {
+				fmt.Fprintln(kept, line)
+			}
+		}
+		f.Close()
+		if found {
+			return fi.Name(), s.writeFileAtomic(filename, []byte(kept.String()))
+		}
+	}
+	return "", ErrInvalidRecoveryCode
+}
+
+// rotateTeamID gives a team a new, random ID, replacing its old one in teamids.txt,
+// and moves everything the team has over to it.
+func (s *State) rotateTeamID(teamID string) (string, error) {
+	teamName, err := s.TeamName(teamID)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	newID := hex.EncodeToString(buf)
+
+	s.lock.Lock()
+	ids, err := afero.ReadFile(s, "teamids.txt")
+	if err == nil {
+		lines := strings.Split(string(ids), "\n")
+		for i, line := range lines {
+			if line == teamID {
+				lines[i] = newID
+			}
+		}
+		err = s.writeFileAtomic("teamids.txt", []byte(strings.Join(lines, "\n")))
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	teamFile, err := s.Fs.OpenFile(filepath.Join("teams", newID), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintln(teamFile, teamName)
+	teamFile.Close()
+	s.lock.Lock()
+	s.teamNames[newID] = teamName
+	s.revision++
+	s.lock.Unlock()
+
+	// MergeTeams forgets these, rather than moving them
+	if division, err := s.TeamDivision(teamID); err == nil {
+		s.SetTeamDivision(newID, division)
+	}
+	if locale, err := s.TeamLocale(teamID); err == nil {
+		s.SetTeamLocale(newID, locale)
+	}
+	for _, dir := range []string{"emails", "recovery"} {
+		s.Rename(filepath.Join(dir, teamID), filepath.Join(dir, newID))
+	}
+
+	if err := s.MergeTeams(teamID, newID); err != nil {
+		return "", err
+	}
+	slog.Info("rotated team ID", "team", teamID, "new", newID)
+	return newID, nil
+}
+
+// registerResponse is the data sent back from registration.
+type registerResponse struct {
+	Short       string `json:"short"`
+	Description string `json:"description"`
+
+	// TeamID is the team ID made up for a team created by open registration
+	TeamID string `json:"team_id,omitempty"`
+
+	// RecoveryCodes are only sent once, when a team registers
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// recoveryCodes gives this team new recovery codes, if the server hands them out.
+// Failing to is logged, but doesn't stop registration.
+func (mh *MothRequestHandler) recoveryCodes() []string {
+	if mh.Config.RecoveryCodes <= 0 {
+		return nil
+	}
+	codes, err := mh.State.NewRecoveryCodes(mh.teamID, mh.Config.RecoveryCodes)
+	if err != nil {
+		mh.log.Error("making recovery codes", "error", err)
+		return nil
+	}
+	return codes
+}
+
+// recoverResponse is the data sent back from recovery with a code.
+type recoverResponse struct {
+	Short       string `json:"short"`
+	Description string `json:"description"`
+	TeamID      string `json:"team_id"`
+}
+
+// recoverByCode sends back the team ID a recovery code belongs to,
+// giving the team a new one first if rotate is "true".
+func (h *HTTPServer) recoverByCode(mh MothRequestHandler, w http.ResponseWriter, code string, rotate string) {
+	rot := false
+	if rotate != "" {
+		var err error
+		if rot, err = strconv.ParseBool(rotate); err != nil {
+			jsend.Sendf(w, jsend.Fail, "not recovered", "rotate: %s", err.Error())
+			return
+		}
+	}
+	teamID, err := mh.State.RecoverTeam(code, rot)
+	if err != nil {
+		mh.log.Warn("recovery code refused", "error", err)
+		jsend.Sendf(w, jsend.Fail, "not recovered", err.Error())
+		return
+	}
+	mh.log.Info("team recovered", "team", teamID, "rotate", rot)
+	description := "team ID recovered"
+	if rot {
+		description = "team has a new ID: the old one no longer works"
+	}
+	jsend.Send(w, jsend.Success, recoverResponse{Short: "recovered", Description: description, TeamID: teamID})
+}
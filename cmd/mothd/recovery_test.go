@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	server := NewTestServer()
+	server.Config.RecoveryCodes = 3
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	var reg struct {
+		Data registerResponse
+	}
+	r := hs.TestRequest("/register", map[string]string{"name": "GoTeam"})
+	if err := json.Unmarshal(r.Body.Bytes(), &reg); err != nil {
+		t.Fatal(err)
+	}
+	codes := reg.Data.RecoveryCodes
+	if len(codes) != 3 {
+		t.Fatal("Wrong recovery codes:", r.Body.String())
+	}
+	if r := hs.TestRequest("/register", map[string]string{"name": "GoTeam"}); strings.Contains(r.Body.String(), "recovery_codes") {
+		t.Error("Recovery codes sent twice:", r.Body.String())
+	}
+	if buf, _ := afero.ReadFile(state, "recovery/"+TestTeamID); strings.Contains(string(buf), codes[0]) {
+		t.Error("Recovery code stored in the clear")
+	}
+	state.refresh()
+
+	recoverTeam := func(code string, rotate string) (string, bool) {
+		var resp struct {
+			Status string
+			Data   recoverResponse
+		}
+		r := hs.TestRequest("/recover", map[string]string{"id": "", "code": code, "rotate": rotate})
+		if err := json.Unmarshal(r.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.TeamID, resp.Status == "success"
+	}
+
+	if teamID, ok := recoverTeam(codes[0], ""); !ok || (teamID != TestTeamID) {
+		t.Error("Wrong team recovered:", teamID, ok)
+	}
+	if _, ok := recoverTeam(codes[0], ""); ok {
+		t.Error("Recovery code worked twice")
+	}
+	if _, ok := recoverTeam("aaaa-bbbb-cccc-dddd", ""); ok {
+		t.Error("Made-up recovery code worked")
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+
+	newID, ok := recoverTeam(strings.ToUpper(codes[1]), "true")
+	if !ok || (newID == TestTeamID) || (newID == "") {
+		t.Fatal("Team ID not rotated:", newID, ok)
+	}
+	state.refresh()
+	if name, err := state.TeamName(newID); (err != nil) || (name != "GoTeam") {
+		t.Error("New team ID not registered:", name, err)
+	}
+	if _, err := state.TeamName(TestTeamID); err == nil {
+		t.Error("Old team ID still registered")
+	}
+	if pl := state.PointsLog(); (len(pl) != 1) || (pl[0].TeamID != newID) {
+		t.Error("Award not moved to new team ID:", pl)
+	}
+	ids, _ := afero.ReadFile(state, "teamids.txt")
+	if strings.Contains(string(ids), TestTeamID) || !strings.Contains(string(ids), newID) {
+		t.Error("teamids.txt not updated:", string(ids))
+	}
+
+	if teamID, ok := recoverTeam(codes[2], ""); !ok || (teamID != newID) {
+		t.Error("Last code doesn't recover new team ID:", teamID, ok)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteProvider provides puzzles from a puzzle service on another host, over HTTP.
+//
+// This keeps categories whose answers have to be checked somewhere isolated,
+// like puzzles that run submitted code,
+// off the server.
+//
+// The service handles these requests, relative to URL:
+//
+//	GET inventory: JSON object mapping category names to lists of point values
+//	GET open?cat=CAT&points=POINTS&path=PATH: the file's contents
+//	POST answer, with cat, points, and answer form fields: JSON {"Correct": bool, "Part": string}
+//
+// If Token is set, every request has an "Authorization: Bearer TOKEN" header.
+type RemoteProvider struct {
+	URL    string
+	Token  string
+	Client *http.Client
+
+	lock      sync.RWMutex
+	inventory []Category
+	last      remoteAnswer // The last answer checked
+}
+
+// remoteAnswer is what the puzzle service said about an answer.
+type remoteAnswer struct {
+	cat     string
+	points  int
+	answer  string
+	checked time.Time
+
+	Correct bool
+	Part    string
+}
+
+// remoteAnswerReuse is how long the result of checking an answer is reused.
+// CheckAnswerPart is called right after CheckAnswer for wrong answers,
+// and this keeps the service from being asked twice.
+const remoteAnswerReuse = 5 * time.Second
+
+// NewRemoteProvider returns a new RemoteProvider for the puzzle service at url.
+func NewRemoteProvider(url string, token string) *RemoteProvider {
+	return &RemoteProvider{
+		URL:    strings.TrimRight(url, "/") + "/",
+		Token:  token,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do makes a request to the puzzle service.
+// The caller must close the response body.
+func (p *RemoteProvider) do(method string, path string, form url.Values) (*http.Response, error) {
+	var req *http.Request
+	var err error
+	if method == http.MethodPost {
+		req, err = http.NewRequest(method, p.URL+path, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		u := p.URL + path
+		if len(form) > 0 {
+			u += "?" + form.Encode()
+		}
+		req, err = http.NewRequest(method, u, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// Inventory returns the categories the service had when it was last asked.
+func (p *RemoteProvider) Inventory() []Category {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.inventory
+}
+
+// refresh asks the service for its inventory.
+func (p *RemoteProvider) refresh() {
+	resp, err := p.do(http.MethodGet, "inventory", nil)
+	if err != nil {
+		slog.Error("refreshing remote puzzles", "url", p.URL, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	inv := make(map[string][]int)
+	if err := json.NewDecoder(resp.Body).Decode(&inv); err != nil {
+		slog.Error("reading remote inventory", "url", p.URL, "error", err)
+		return
+	}
+	categories := make([]Category, 0, len(inv))
+	for name, points := range inv {
+		sort.Ints(points)
+		categories = append(categories, Category{name, points})
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+
+	p.lock.Lock()
+	p.inventory = categories
+	p.lock.Unlock()
+}
+
+// Open fetches a file associated with a puzzle.
+func (p *RemoteProvider) Open(cat string, points int, path string) (ReadSeekCloser, time.Time, error) {
+	form := url.Values{}
+	form.Set("cat", cat)
+	form.Set("points", strconv.Itoa(points))
+	form.Set("path", path)
+	resp, err := p.do(http.MethodGet, "open", form)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	mtime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		mtime = time.Now()
+	}
+	return NullReadSeekCloser{bytes.NewReader(buf)}, mtime, nil
+}
+
+// check asks the service about an answer,
+// or returns what it said last time if it was just asked.
+func (p *RemoteProvider) check(cat string, points int, answer string) (remoteAnswer, error) {
+	p.lock.RLock()
+	last := p.last
+	p.lock.RUnlock()
+	if (last.cat == cat) && (last.points == points) && (last.answer == answer) && (time.Since(last.checked) < remoteAnswerReuse) {
+		return last, nil
+	}
+
+	form := url.Values{}
+	form.Set("cat", cat)
+	form.Set("points", strconv.Itoa(points))
+	form.Set("answer", answer)
+	resp, err := p.do(http.MethodPost, "answer", form)
+	if err != nil {
+		return remoteAnswer{}, err
+	}
+	defer resp.Body.Close()
+
+	ans := remoteAnswer{}
+	if err := json.NewDecoder(resp.Body).Decode(&ans); err != nil {
+		return remoteAnswer{}, fmt.Errorf("reading answer: %w", err)
+	}
+	ans.cat, ans.points, ans.answer, ans.checked = cat, points, answer, time.Now()
+	p.lock.Lock()
+	p.last = ans
+	p.lock.Unlock()
+	return ans, nil
+}
+
+// CheckAnswer asks the service whether answer is correct.
+func (p *RemoteProvider) CheckAnswer(cat string, points int, answer string) (bool, error) {
+	ans, err := p.check(cat, points, answer)
+	return ans.Correct, err
+}
+
+// CheckAnswerPart asks the service which part of a puzzle answer solves.
+func (p *RemoteProvider) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	ans, err := p.check(cat, points, answer)
+	return ans.Part, err
+}
+
+// Mothball just returns an error
+func (p *RemoteProvider) Mothball(cat string, w io.Writer) error {
+	return fmt.Errorf("refusing to package a remote category")
+}
+
+// Maintain fetches the inventory when called, and every updateInterval after that.
+func (p *RemoteProvider) Maintain(updateInterval time.Duration) {
+	p.refresh()
+	for range time.NewTicker(updateInterval).C {
+		p.refresh()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakePuzzleService is a remote puzzle service with one category, "remotegory".
+type fakePuzzleService struct {
+	answers int
+}
+
+func (s *fakePuzzleService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "Bearer sekrit" {
+		http.Error(w, "who are you?", http.StatusUnauthorized)
+		return
+	}
+	switch req.URL.Path {
+	case "/puzzles/inventory":
+		fmt.Fprint(w, `{"remotegory": [2, 1]}`)
+	case "/puzzles/open":
+		if (req.FormValue("cat") != "remotegory") || (req.FormValue("path") != "puzzle.json") {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprintf(w, `{"Pre": {"Body": "Puzzle %s"}}`, req.FormValue("points"))
+	case "/puzzles/answer":
+		s.answers++
+		switch req.PostFormValue("answer") {
+		case "right":
+			fmt.Fprint(w, `{"Correct": true}`)
+		case "half":
+			fmt.Fprint(w, `{"Correct": false, "Part": "first"}`)
+		default:
+			fmt.Fprint(w, `{"Correct": false}`)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestRemoteProvider(t *testing.T) {
+	service := new(fakePuzzleService)
+	srv := httptest.NewServer(service)
+	defer srv.Close()
+
+	p := NewRemoteProvider(srv.URL+"/puzzles", "sekrit")
+	p.refresh()
+	inv := p.Inventory()
+	if (len(inv) != 1) || (inv[0].Name != "remotegory") || (inv[0].Puzzles[0] != 1) {
+		t.Fatal("Wrong inventory:", inv)
+	}
+
+	if f, _, err := p.Open("remotegory", 1, "puzzle.json"); err != nil {
+		t.Error(err)
+	} else if buf, _ := io.ReadAll(f); string(buf) != `{"Pre": {"Body": "Puzzle 1"}}` {
+		t.Error("Wrong puzzle:", string(buf))
+	}
+	if _, _, err := p.Open("remotegory", 1, "nothing.txt"); err == nil {
+		t.Error("Opening a missing file worked")
+	}
+
+	if ok, err := p.CheckAnswer("remotegory", 1, "half"); ok || (err != nil) {
+		t.Error("Wrong answer marked right", err)
+	}
+	if part, err := p.CheckAnswerPart("remotegory", 1, "half"); (part != "first") || (err != nil) {
+		t.Error("Wrong part:", part, err)
+	}
+	if service.answers != 1 {
+		t.Error("Service asked about one answer more than once:", service.answers)
+	}
+
+	p.Token = "wrong"
+	if _, err := p.CheckAnswer("remotegory", 1, "right"); err == nil {
+		t.Error("Request with the wrong token worked")
+	}
+}
+
+func TestRemoteProviderServer(t *testing.T) {
+	srv := httptest.NewServer(new(fakePuzzleService))
+	defer srv.Close()
+
+	server := NewTestServer()
+	server.PuzzleProviders = append(server.PuzzleProviders, NewRemoteProvider(srv.URL+"/puzzles", "sekrit"))
+	server.refresh()
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("Team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	export := handler.ExportState()
+	if len(export.Puzzles["remotegory"]) != 1 {
+		t.Error("Remote category not unlocked:", export.Puzzles)
+	}
+	if _, err := handler.SubmitAnswer("remotegory", 1, "wrong"); err != ErrIncorrectAnswer {
+		t.Error("Wrong answer to remote puzzle:", err)
+	}
+	if _, err := handler.SubmitAnswer("remotegory", 1, "right"); err != nil {
+		t.Error("Right answer to remote puzzle:", err)
+	}
+	if _, err := handler.SubmitAnswer("pategory", 1, "answer123"); err != nil {
+		t.Error("Right answer to local puzzle:", err)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// RetiredFile lists retired puzzles, one "category points" per line.
+const RetiredFile = "retired.txt"
+
+// readRetired reads the retired puzzles from RetiredFile.
+func (s *State) readRetired() map[string][]int {
+	return s.readPuzzleList(RetiredFile)
+}
+
+// readPuzzleList reads a list of puzzles, one "category points" per line.
+// Lines that don't make sense are skipped.
+func (s *State) readPuzzleList(filename string) map[string][]int {
+	ret := make(map[string][]int)
+	f, err := s.Open(filename)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			slog.Warn("ignoring puzzle", "file", filename, "line", line)
+			continue
+		}
+		points, err := strconv.Atoi(fields[1])
+		if err != nil {
+			slog.Warn("ignoring puzzle", "file", filename, "line", line, "error", err)
+			continue
+		}
+		ret[fields[0]] = append(ret[fields[0]], points)
+	}
+	return ret
+}
+
+// writePuzzleList replaces filename with puzzles, one "category points" per line.
+// The caller must hold s.lock.
+func (s *State) writePuzzleList(filename string, puzzles map[string][]int) error {
+	cats := make([]string, 0, len(puzzles))
+	for cat := range puzzles {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	buf := new(strings.Builder)
+	fmt.Fprintln(buf, "# category points")
+	for _, cat := range cats {
+		sort.Ints(puzzles[cat])
+		for _, points := range puzzles[cat] {
+			fmt.Fprintln(buf, cat, points)
+		}
+	}
+	return s.writeFileAtomic(filename, []byte(buf.String()))
+}
+
+// writeRetired replaces RetiredFile with retired.
+// The caller must hold s.lock.
+func (s *State) writeRetired(retired map[string][]int) error {
+	if err := s.writePuzzleList(RetiredFile, retired); err != nil {
+		return err
+	}
+	s.retired = retired
+	s.revision++
+	return nil
+}
+
+// Retired returns the retired puzzles, from retired.txt,
+// as a list of point values for each category.
+func (s *State) Retired() map[string][]int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make(map[string][]int, len(s.retired))
+	for cat, points := range s.retired {
+		ret[cat] = append([]int{}, points...)
+	}
+	return ret
+}
+
+// RetirePuzzle takes a puzzle out of the event.
+//
+// If refund is true, every award for it is taken out of the points log.
+func (s *State) RetirePuzzle(cat string, points int, refund bool) error {
+	if strings.ContainsAny(cat, " \t\n") {
+		return fmt.Errorf("invalid category: %q", cat)
+	}
+
+	s.lock.Lock()
+	retired := s.readRetired()
+	found := false
+	for _, p := range retired[cat] {
+		found = found || (p == points)
+	}
+	var err error
+	if !found {
+		retired[cat] = append(retired[cat], points)
+		err = s.writeRetired(retired)
+	}
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	refunded := 0
+	if refund {
+		unlock := s.lockPointsLog()
+		pointsLog := s.reloadPointsLog()
+		kept := make(award.List, 0, len(pointsLog))
+		for _, awd := range pointsLog {
+			if (awd.Category == cat) && (awd.Points == points) {
+				slog.Info("refunding award", awardAttrs(awd)...)
+				refunded++
+			} else {
+				kept = append(kept, awd)
+			}
+		}
+		if refunded > 0 {
+			err = s.writePointsLog(kept)
+		}
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.LogEvent("retire", "", cat, points, strconv.Itoa(refunded))
+	return nil
+}
+
+// RestorePuzzle puts a retired puzzle back into the event.
+// Awards refunded when it was retired stay refunded.
+func (s *State) RestorePuzzle(cat string, points int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	retired := s.readRetired()
+	kept := make([]int, 0, len(retired[cat]))
+	for _, p := range retired[cat] {
+		if p != points {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == len(retired[cat]) {
+		return fmt.Errorf("%s %d isn't retired", cat, points)
+	}
+	if len(kept) == 0 {
+		delete(retired, cat)
+	} else {
+		retired[cat] = kept
+	}
+	if err := s.writeRetired(retired); err != nil {
+		return err
+	}
+	s.LogEvent("unretire", "", cat, points)
+	return nil
+}
+
+// retired returns true if a puzzle has been retired.
+func (mh *MothRequestHandler) retired(cat string, points int) bool {
+	for _, p := range mh.State.Retired()[cat] {
+		if p == points {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRetireHandler retires a puzzle,
+// refunding its awards if refund is true.
+func (h *HTTPServer) AdminRetireHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not retired", "cat and points are required")
+		return
+	}
+	refund := false
+	if s := req.FormValue("refund"); s != "" {
+		if refund, err = strconv.ParseBool(s); err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not retired", "%s", err.Error())
+			return
+		}
+	}
+	if err := mh.State.RetirePuzzle(cat, points, refund); err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "not retired", "%s", err.Error())
+		return
+	}
+	mh.log.Info("retired puzzle", "category", cat, "points", points, "refund", refund)
+	jsend.Sendf(w, jsend.Success, "retired", "%s %d retired", cat, points)
+}
+
+// AdminUnretireHandler puts a retired puzzle back.
+func (h *HTTPServer) AdminUnretireHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not restored", "cat and points are required")
+		return
+	}
+	if err := mh.State.RestorePuzzle(cat, points); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not restored", "%s", err.Error())
+		return
+	}
+	mh.log.Info("restored puzzle", "category", cat, "points", points)
+	jsend.Sendf(w, jsend.Success, "restored", "%s %d restored", cat, points)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRetirePuzzle(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	puzzles := func() []int {
+		handler := server.NewHandler(TestTeamID)
+		return handler.ExportState().Puzzles["pategory"]
+	}
+
+	if r := post("/admin/retire", url.Values{"cat": {"pategory"}, "points": {"2"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if p := puzzles(); !reflect.DeepEqual(p, []int{1, 3}) {
+		t.Error("Retired puzzle still unlocked:", p)
+	}
+	if err := handler.CheckAnswer("pategory", 2, "answer2"); err != ErrPuzzleLocked {
+		t.Error("Answer to retired puzzle:", err)
+	}
+	if len(state.PointsLog()) != 1 {
+		t.Error("Award taken away without a refund")
+	}
+
+	if r := post("/admin/retire", url.Values{"cat": {"pategory"}, "points": {"1"}, "refund": {"true"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if pl := state.PointsLog(); len(pl) != 0 {
+		t.Error("Award not refunded:", pl)
+	}
+	if p := puzzles(); !reflect.DeepEqual(p, []int{3}) {
+		t.Error("Wrong puzzles with two retired:", p)
+	}
+	if buf, _ := afero.ReadFile(state, RetiredFile); !strings.Contains(string(buf), "pategory 1\npategory 2\n") {
+		t.Error("Wrong retired.txt:", string(buf))
+	}
+
+	// Put back, it can be solved again
+	if r := post("/admin/unretire", url.Values{"cat": {"pategory"}, "points": {"1"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if p := puzzles(); !reflect.DeepEqual(p, []int{1}) {
+		t.Error("Wrong puzzles after restoring:", p)
+	}
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Error("Restored puzzle can't be solved:", err)
+	}
+
+	for _, form := range []url.Values{
+		{"cat": {"pategory"}, "points": {"1"}},
+		{"cat": {"pategory"}},
+	} {
+		if r := post("/admin/unretire", form); r.Code != http.StatusBadRequest {
+			t.Error("Restored", form, r.Code)
+		}
+	}
+	if r := post("/admin/retire", url.Values{"cat": {"pategory"}, "points": {"3"}, "refund": {"maybe"}}); r.Code != http.StatusBadRequest {
+		t.Error("Retired with a bad refund:", r.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+	"github.com/spf13/afero"
+)
+
+// rotatedTimeFormat is the time format used in the names of rotated logs.
+const rotatedTimeFormat = "20060102T150405Z"
+
+// rotateEventLog moves events.csv aside once it's bigger than s.RotateSize,
+// and starts a new one.
+// Only the newest s.RotateKeep rotated logs are kept.
+//
+// This must be called from the goroutine that writes to the event log.
+func (s *State) rotateEventLog(now time.Time) {
+	if s.RotateSize <= 0 {
+		return
+	}
+	s.eventWriter.Flush()
+	fi, err := s.Stat("events.csv")
+	if (err != nil) || (fi.Size() <= s.RotateSize) {
+		return
+	}
+
+	rotated := "events-" + now.UTC().Format(rotatedTimeFormat) + ".csv"
+	if err := s.Rename("events.csv", rotated); err != nil {
+		slog.Error("rotating event log", "error", err)
+		return
+	}
+	if err := s.reopenEventLog(); err != nil {
+		slog.Error("reopening event log", "error", err)
+		return
+	}
+	slog.Info("rotated event log", "file", rotated, "size", fi.Size())
+
+	if err := pruneFiles(s, "events-", ".csv", s.RotateKeep); err != nil {
+		slog.Error("removing old event logs", "error", err)
+	}
+}
+
+// CompactPointsLog rewrites the points log in time order,
+// without duplicate awards or malformed lines.
+// The old points log is kept alongside,
+// along with up to s.RotateKeep older ones.
+//
+// The points log is rewritten,
+// so this should only be done while scoring is suspended.
+func (s *State) CompactPointsLog(now time.Time) error {
+	unlock := s.lockPointsLog()
+	defer unlock()
+
+	pointsLog := s.reloadPointsLog()
+	sort.Stable(pointsLog)
+	compacted := make(award.List, 0, len(pointsLog))
+	for _, awd := range pointsLog {
+		duplicate := false
+		for _, e := range compacted {
+			if awd.Equal(e) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			slog.Info("dropping duplicate award", awardAttrs(awd)...)
+		} else {
+			compacted = append(compacted, awd)
+		}
+	}
+
+	old, err := afero.ReadFile(s, "points.log")
+	if err != nil {
+		return err
+	}
+	archived := "points-" + now.UTC().Format(rotatedTimeFormat) + ".log"
+	if err := s.writeFileAtomic(archived, old); err != nil {
+		return err
+	}
+	if err := s.writePointsLog(compacted); err != nil {
+		return err
+	}
+	slog.Info("compacted points log", "awards", len(compacted), "dropped", len(pointsLog)-len(compacted), "archived", archived)
+	s.LogEvent("compact", "", "", 0, fmt.Sprint(len(compacted)))
+
+	return pruneFiles(s, "points-", ".log", s.RotateKeep)
+}
+
+// pruneFiles removes all but the newest keep files in fs
+// whose names begin with prefix and end with suffix.
+// Names must sort in the order the files were made.
+// If keep is zero, nothing is removed.
+func pruneFiles(fs afero.Fs, prefix, suffix string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	dirents, err := afero.ReadDir(fs, ".")
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(dirents))
+	for _, dirent := range dirents {
+		name := dirent.Name()
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) && !dirent.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := fs.Remove(names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestPointsLogIndex(t *testing.T) {
+	s := NewState(afero.NewBasePathFs(afero.NewOsFs(), t.TempDir()))
+	go slurp(s.refreshNow)
+	s.refresh()
+	if err := s.AwardPoints("team", "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	fi, _ := s.Stat("points.log")
+	if s.pointsLogIndex.offset != fi.Size() {
+		t.Error("Index didn't reach the end of the points log:", s.pointsLogIndex.offset, fi.Size())
+	}
+
+	// Something else appends to the log
+	f, _ := s.OpenFile("points.log", os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("1000 team pategory 2\n1001 team pategory 3")
+	f.Close()
+	s.refresh()
+	if len(s.PointsLog()) != 3 {
+		t.Error("Appended awards not read:", s.PointsLog())
+	}
+	s.refresh()
+	if len(s.PointsLog()) != 3 {
+		t.Error("Unterminated line read twice:", s.PointsLog())
+	}
+
+	// Something else replaces the log
+	afero.WriteFile(s, "points.new.log", []byte("1000 team pategory 2\n"), 0644)
+	s.Rename("points.new.log", "points.log")
+	s.refresh()
+	if len(s.PointsLog()) != 1 {
+		t.Error("Replaced points log not re-read:", s.PointsLog())
+	}
+}
+
+func TestRotateEventLog(t *testing.T) {
+	s := NewTestState()
+	s.RotateSize = 10
+	s.RotateKeep = 2
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		s.eventWriter.Write([]string{"an", "event", "longer", "than", "ten", "bytes"})
+		s.rotateEventLog(when.Add(time.Duration(i) * time.Hour))
+	}
+	s.rotateEventLog(when.Add(4 * time.Hour)) // Too small to rotate
+
+	if _, err := s.Stat("events-20240501T120000Z.csv"); err == nil {
+		t.Error("Oldest event log wasn't removed")
+	}
+	for _, name := range []string{"events-20240501T130000Z.csv", "events-20240501T140000Z.csv"} {
+		if buf, err := afero.ReadFile(s, name); err != nil {
+			t.Error(err)
+		} else if !strings.Contains(string(buf), "longer") {
+			t.Error("Rotated event log is missing events:", name)
+		}
+	}
+	if fi, err := s.Stat("events.csv"); (err != nil) || (fi.Size() != 0) {
+		t.Error("New event log isn't empty", err)
+	}
+}
+
+func TestCompactPointsLog(t *testing.T) {
+	s := NewTestState()
+	original := strings.Join([]string{
+		"2000 team pategory 2",
+		"1000 team pategory 1",
+		"garbage",
+		"3000 team pategory 1",
+		"",
+	}, "\n")
+	afero.WriteFile(s, "points.log", []byte(original), 0644)
+	s.refresh()
+
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.CompactPointsLog(when); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := afero.ReadFile(s, "points.log"); string(buf) != "1000 team pategory 1 #2\n2000 team pategory 2 #3\n" {
+		t.Errorf("Wrong compacted log: %q", buf)
+	}
+	if buf, _ := afero.ReadFile(s, "points-20240501T120000Z.log"); string(buf) != original {
+		t.Errorf("Old points log not kept: %q", buf)
+	}
+	if len(s.PointsLog()) != 2 {
+		t.Error("Cache doesn't match compacted log:", s.PointsLog())
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// S3Scheme begins the location of a bucket, as in "s3://bucket/prefix".
+const S3Scheme = "s3://"
+
+// emptyPayloadHash is the SHA-256 hash of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Mirror keeps a local copy of everything under a prefix in an S3-compatible bucket.
+//
+// Puzzle providers read the local copy,
+// so updating an object in the bucket updates every server mirroring it.
+// Objects are only downloaded when their size or modification time changes,
+// and local files are removed when their objects are.
+type S3Mirror struct {
+	Endpoint     string // Base URL of the object storage service
+	Bucket       string
+	Prefix       string // Only objects beginning with this are mirrored
+	Region       string
+	AccessKey    string // Requests aren't signed if this is empty
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+
+	fs afero.Fs
+}
+
+// NewS3Mirror returns a new S3Mirror of location, which looks like "s3://bucket/prefix",
+// keeping its copy in fs.
+//
+// Credentials and region come from the usual AWS environment variables.
+// If endpoint is empty, $AWS_ENDPOINT_URL is used,
+// and if that's empty too, the AWS endpoint for the region.
+func NewS3Mirror(location string, endpoint string, fs afero.Fs) (*S3Mirror, error) {
+	if !strings.HasPrefix(location, S3Scheme) {
+		return nil, fmt.Errorf("not an S3 location: %s", location)
+	}
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, S3Scheme), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("no bucket in S3 location: %s", location)
+	}
+	if (prefix != "") && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	return &S3Mirror{
+		Endpoint:     strings.TrimRight(endpoint, "/"),
+		Bucket:       bucket,
+		Prefix:       prefix,
+		Region:       region,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Client:       &http.Client{Timeout: 5 * time.Minute},
+		fs:           fs,
+	}, nil
+}
+
+// s3Object is one object in a bucket listing.
+type s3Object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+// s3ListResult is the response to a ListObjectsV2 request.
+type s3ListResult struct {
+	Contents              []s3Object
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns every object under m.Prefix.
+func (m *S3Mirror) list() ([]s3Object, error) {
+	objects := make([]s3Object, 0)
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", m.Prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := m.get("", query)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %w", m.Bucket, err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || (result.NextContinuationToken == "") {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// get makes a signed GET request for key in the bucket.
+// The caller must close the response body.
+func (m *S3Mirror) get(key string, query url.Values) (*http.Response, error) {
+	u := m.Endpoint + "/" + s3Escape(m.Bucket, false) + "/" + s3Escape(key, true)
+	if len(query) > 0 {
+		u += "?" + s3Query(query)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.AccessKey != "" {
+		req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+		if m.SessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", m.SessionToken)
+		}
+		SignV4(req, m.AccessKey, m.SecretKey, m.Region, "s3", time.Now())
+	}
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// Sync brings the local copy up to date with the bucket.
+func (m *S3Mirror) Sync() error {
+	objects, err := m.list()
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+	for _, obj := range objects {
+		name := strings.TrimPrefix(obj.Key, m.Prefix)
+		if (name == "") || strings.HasSuffix(name, "/") {
+			continue // Directory placeholder
+		}
+		filename := filepath.FromSlash(path.Clean(name))
+		if !filepath.IsLocal(filename) {
+			slog.Warn("skipping unsafe S3 object name", "key", obj.Key)
+			continue
+		}
+		found[filename] = true
+
+		if fi, err := m.fs.Stat(filename); (err == nil) && (fi.Size() == obj.Size) && fi.ModTime().Equal(obj.LastModified) {
+			continue
+		}
+		if err := m.download(obj, filename); err != nil {
+			return err
+		}
+		slog.Info("downloaded S3 object", "key", obj.Key, "size", obj.Size)
+	}
+
+	var remove []string
+	err = afero.Walk(m.fs, ".", func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !found[filename] {
+			remove = append(remove, filename)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, filename := range remove {
+		if err := m.fs.Remove(filename); err != nil {
+			return err
+		}
+		slog.Info("removed S3 object", "file", filename)
+	}
+	return nil
+}
+
+// download copies obj to filename.
+// The file's modification time is set to the object's,
+// so Sync can tell when the object changes.
+func (m *S3Mirror) download(obj s3Object, filename string) error {
+	resp, err := m.get(obj.Key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dir, base := filepath.Split(filename)
+	if dir != "" {
+		if err := m.fs.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// The dot keeps providers from picking it up before it's complete
+	tmpfn := filepath.Join(dir, "."+base+".tmp")
+	f, err := m.fs.Create(tmpfn)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = m.fs.Chtimes(tmpfn, obj.LastModified, obj.LastModified)
+	}
+	if err == nil {
+		err = m.fs.Rename(tmpfn, filename)
+	}
+	if err != nil {
+		m.fs.Remove(tmpfn)
+	}
+	return err
+}
+
+// Maintain syncs the local copy when called, and every interval after that.
+func (m *S3Mirror) Maintain(interval time.Duration) {
+	if err := m.Sync(); err != nil {
+		slog.Error("syncing S3 bucket", "bucket", m.Bucket, "error", err)
+	}
+	for range time.NewTicker(interval).C {
+		if err := m.Sync(); err != nil {
+			slog.Error("syncing S3 bucket", "bucket", m.Bucket, "error", err)
+		}
+	}
+}
+
+// SignV4 signs req using AWS Signature Version 4.
+//
+// The Host header, and every X-Amz- header already set, are signed.
+// The payload hash is taken from X-Amz-Content-Sha256,
+// or is the hash of an empty body if that isn't set.
+func SignV4(req *http.Request, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = emptyPayloadHash
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := new(strings.Builder)
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		s3Query(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(
+		"Authorization",
+		fmt.Sprintf(
+			"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+			accessKey, scope, signedHeaders, signature,
+		),
+	)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// s3Escape escapes s the way Signature Version 4 expects:
+// everything but unreserved characters is percent-encoded.
+// If keepSlash is true, slashes are left alone.
+func s3Escape(s string, keepSlash bool) string {
+	b := new(strings.Builder)
+	for _, c := range []byte(s) {
+		switch {
+		case ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9'):
+			b.WriteByte(c)
+		case (c == '-') || (c == '_') || (c == '.') || (c == '~'):
+			b.WriteByte(c)
+		case (c == '/') && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query returns query in canonical form: sorted, and escaped with s3Escape.
+func s3Query(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// fakeBucket is just enough of S3 to test S3Mirror.
+type fakeBucket struct {
+	lock    sync.Mutex
+	objects map[string]string
+	mtimes  map[string]time.Time
+	gets    int
+}
+
+func (b *fakeBucket) put(key, data string, mtime time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.objects[key] = data
+	b.mtimes[key] = mtime
+}
+
+func (b *fakeBucket) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(req.URL.Path, "/bucket/")
+	if key == "" {
+		prefix := req.URL.Query().Get("prefix")
+		fmt.Fprintln(w, `<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+		for k, v := range b.objects {
+			if strings.HasPrefix(k, prefix) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><LastModified>%s</LastModified><Size>%d</Size></Contents>\n", k, b.mtimes[k].Format(time.RFC3339), len(v))
+			}
+		}
+		fmt.Fprintln(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+		return
+	}
+	if data, ok := b.objects[key]; ok {
+		b.gets++
+		w.Write([]byte(data))
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+func TestS3Mirror(t *testing.T) {
+	bucket := &fakeBucket{
+		objects: make(map[string]string),
+		mtimes:  make(map[string]time.Time),
+	}
+	then := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bucket.put("mothballs/pategory.mb", "zipped", then)
+	bucket.put("mothballs/sub dir/cat.mb", "meow", then)
+	bucket.put("mothballs/", "", then)
+	bucket.put("other/thing.mb", "nope", then)
+	srv := httptest.NewServer(bucket)
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	fs := afero.NewMemMapFs()
+	m, err := NewS3Mirror("s3://bucket/mothballs", srv.URL, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, "stale.mb", []byte("old"), 0644)
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := afero.ReadFile(fs, "pategory.mb"); (err != nil) || (string(buf) != "zipped") {
+		t.Error("Wrong mirrored object:", string(buf), err)
+	}
+	if buf, err := afero.ReadFile(fs, "sub dir/cat.mb"); (err != nil) || (string(buf) != "meow") {
+		t.Error("Wrong mirrored object in a directory:", string(buf), err)
+	}
+	if _, err := fs.Stat("thing.mb"); err == nil {
+		t.Error("Mirrored an object outside the prefix")
+	}
+	if _, err := fs.Stat("stale.mb"); err == nil {
+		t.Error("File not in the bucket wasn't removed")
+	}
+
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if bucket.gets != 2 {
+		t.Error("Unchanged objects downloaded again:", bucket.gets)
+	}
+
+	bucket.put("mothballs/pategory.mb", "rezipped", then.Add(time.Hour))
+	if err := m.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := afero.ReadFile(fs, "pategory.mb"); string(buf) != "rezipped" {
+		t.Error("Changed object wasn't downloaded:", string(buf))
+	}
+	if fi, _ := fs.Stat("pategory.mb"); !fi.ModTime().Equal(then.Add(time.Hour)) {
+		t.Error("Wrong modification time:", fi.ModTime())
+	}
+
+	m.AccessKey = ""
+	if err := m.Sync(); err == nil {
+		t.Error("Unsigned request worked")
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	when := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	SignV4(req, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", when)
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Error("Wrong signature:", auth)
+	}
+}
+
+func TestS3Escape(t *testing.T) {
+	if s := s3Escape("sub dir/a+b~c.mb", true); s != "sub%20dir/a%2Bb~c.mb" {
+		t.Error("Wrong escaping:", s)
+	}
+	if s := s3Escape("a/b", false); s != "a%2Fb" {
+		t.Error("Wrong escaping:", s)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// ScoreboardRecentSolves is how many recent solves are shown on the scoreboard.
+const ScoreboardRecentSolves = 10
+
+// ScoreboardTeam is one team's standing on the scoreboard.
+type ScoreboardTeam struct {
+	Rank  int
+	Name  string
+	Score float64
+
+	// Avatar is the hash of the team's avatar, if it has one
+	Avatar string
+
+	// Points maps category names to points scored in that category
+	Points map[string]int
+
+	// TieBreak is what orders the team among teams with the same score,
+	// under the scoreboard's TieBreak rule, lowest first:
+	// the Unix time it last finished a puzzle for last-solve,
+	// how many answers it has submitted for attempts,
+	// or the seconds its awards add up to for total-time.
+	// It's absent without a rule, or when it's zero.
+	TieBreak int64 `json:",omitempty"`
+
+	// id is the team's ID in the export the scoreboard was computed from
+	id string
+}
+
+// ScoreboardCategory is the progress made in one category.
+type ScoreboardCategory struct {
+	Name string
+
+	// MaxPoints is the highest score any team has in this category
+	MaxPoints int
+
+	// Leader is the name of the first team to reach MaxPoints
+	Leader string
+}
+
+// ScoreboardSolve is one entry in the list of recent solves.
+type ScoreboardSolve struct {
+	When     time.Time
+	TeamName string
+	Category string
+	Points   int
+}
+
+// Scoreboard is a server-side computation of event standings.
+//
+// Scores are computed the same way as the scoreboard in the default theme,
+// with the scoring model in the export's configuration:
+// for each category, a team's points are divided by the highest points
+// any team has in that category,
+// or, with percentage scoring, by the export's MaxPoints for it,
+// and these fractions are summed.
+//
+// Teams with the same score share a rank,
+// unless the export's configuration has a tie-break rule that sets them apart.
+type Scoreboard struct {
+	Generated  time.Time
+	Enabled    bool
+	TieBreak   string `json:",omitempty"`
+	Teams      []ScoreboardTeam
+	Categories []ScoreboardCategory
+	Recent     []ScoreboardSolve
+}
+
+// NewScoreboard computes a Scoreboard from an exported state.
+func NewScoreboard(export *StateExport) *Scoreboard {
+	sb := Scoreboard{
+		Generated: time.Now(),
+		Enabled:   export.Enabled,
+		TieBreak:  export.Config.TieBreak,
+	}
+
+	points := make(map[string]map[string]int) // teamID -> category -> points
+	categories := make(map[string]*ScoreboardCategory)
+	categoryNames := make([]string, 0)
+	for _, awd := range export.PointsLog {
+		if _, ok := points[awd.TeamID]; !ok {
+			points[awd.TeamID] = make(map[string]int)
+		}
+		points[awd.TeamID][awd.Category] += awd.Score
+
+		cat, ok := categories[awd.Category]
+		if !ok {
+			cat = &ScoreboardCategory{Name: awd.Category}
+			categories[awd.Category] = cat
+			categoryNames = append(categoryNames, awd.Category)
+		}
+		if teamPoints := points[awd.TeamID][awd.Category]; teamPoints > cat.MaxPoints {
+			cat.MaxPoints = teamPoints
+			cat.Leader = export.TeamNames[awd.TeamID]
+		}
+	}
+
+	sort.Strings(categoryNames)
+	for _, name := range categoryNames {
+		sb.Categories = append(sb.Categories, *categories[name])
+	}
+
+	model := scoringModel(export.Config.Scoring)
+	tieBreaks := tieBreakValues(export)
+	for teamID, teamPoints := range points {
+		team := ScoreboardTeam{
+			id:       teamID,
+			Name:     export.TeamNames[teamID],
+			Avatar:   export.Avatars[teamID],
+			Points:   teamPoints,
+			TieBreak: tieBreaks[teamID],
+		}
+		// In the same order for every team, so equal scores come out exactly equal
+		for _, cat := range categoryNames {
+			if p, ok := teamPoints[cat]; ok {
+				team.Score += model(p, categories[cat].MaxPoints, export.MaxPoints[cat])
+			}
+		}
+		sb.Teams = append(sb.Teams, team)
+	}
+	sort.SliceStable(sb.Teams, func(i, j int) bool {
+		a, b := sb.Teams[i], sb.Teams[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.TieBreak != b.TieBreak:
+			return a.TieBreak < b.TieBreak
+		}
+		return a.Name < b.Name
+	})
+	for i := range sb.Teams {
+		sb.Teams[i].Rank = i + 1
+		if (i > 0) && (sb.Teams[i].Score == sb.Teams[i-1].Score) && (sb.Teams[i].TieBreak == sb.Teams[i-1].TieBreak) {
+			sb.Teams[i].Rank = sb.Teams[i-1].Rank
+		}
+	}
+
+	for i := len(export.PointsLog) - 1; i >= 0; i-- {
+		if len(sb.Recent) == ScoreboardRecentSolves {
+			break
+		}
+		awd := export.PointsLog[i]
+		if awd.Part != "" {
+			continue
+		}
+		sb.Recent = append(sb.Recent, ScoreboardSolve{
+			When:     time.Unix(awd.When, 0),
+			TeamName: export.TeamNames[awd.TeamID],
+			Category: awd.Category,
+			Points:   awd.Points,
+		})
+	}
+
+	return &sb
+}
+
+// tieBreakValues returns what orders each team in the export among teams with the same score,
+// under the export's tie-break rule, by team ID.
+// Without a rule, it's nil, and tied teams stay tied.
+func tieBreakValues(export *StateExport) map[string]int64 {
+	values := make(map[string]int64)
+	switch export.Config.TieBreak {
+	case TieBreakLastSolve:
+		// Only awards that finish a puzzle, and add to the team's score, count
+		for _, awd := range export.PointsLog {
+			if (awd.Part == "") && (awd.Score > 0) {
+				values[awd.TeamID] = max(values[awd.TeamID], awd.When)
+			}
+		}
+	case TieBreakAttempts:
+		for _, awd := range export.PointsLog {
+			values[awd.TeamID] = int64(export.attempts[awd.TeamID])
+		}
+	case TieBreakTotalTime:
+		if len(export.PointsLog) == 0 {
+			break
+		}
+		start := export.PointsLog[0].When
+		for _, awd := range export.PointsLog {
+			start = min(start, awd.When)
+		}
+		for _, awd := range export.PointsLog {
+			values[awd.TeamID] += awd.When - start
+		}
+	default:
+		return nil
+	}
+	return values
+}
+
+// WriteHTML renders the scoreboard as a standalone HTML document.
+//
+// The document has no scripts,
+// so it works on projectors and kiosk browsers that can't run the theme.
+func (sb *Scoreboard) WriteHTML(w io.Writer, refresh time.Duration) error {
+	return scoreboardTemplate.Execute(w, struct {
+		*Scoreboard
+		Refresh int
+	}{
+		Scoreboard: sb,
+		Refresh:    int(refresh.Seconds()),
+	})
+}
+
+var scoreboardTemplate = template.Must(template.New("scoreboard").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>Scoreboard</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width">
+    {{- if .Refresh}}
+    <meta http-equiv="refresh" content="{{.Refresh}}">
+    {{- end}}
+    <style>
+      body { font-family: sans-serif; background: #222; color: #eee; }
+      table { border-collapse: collapse; margin-bottom: 1em; }
+      th, td { padding: 0.2em 0.6em; text-align: left; }
+      td.number { text-align: right; }
+      tr:nth-child(even) { background: #333; }
+      img.avatar { height: 1.5em; width: 1.5em; object-fit: cover; vertical-align: middle; }
+    </style>
+  </head>
+  <body>
+    <h1>Scoreboard</h1>
+    {{- if not .Enabled}}
+    <p>Scoring is currently suspended.</p>
+    {{- end}}
+
+    <h2>Standings</h2>
+    {{- if .Teams}}
+    <table class="standings">
+      <tr><th>Rank</th><th>Team</th><th>Score</th>{{range .Categories}}<th>{{.Name}}</th>{{end}}</tr>
+      {{- range $team := .Teams}}
+      <tr>
+        <td class="number">{{$team.Rank}}</td>
+        <td>{{if $team.Avatar}}<img class="avatar" src="avatar/{{$team.Avatar}}" alt=""> {{end}}{{$team.Name}}</td>
+        <td class="number">{{printf "%.2f" $team.Score}}</td>
+        {{- range $.Categories}}
+        <td class="number">{{index $team.Points .Name}}</td>
+        {{- end}}
+      </tr>
+      {{- end}}
+    </table>
+    {{- else}}
+    <p>No scores yet.</p>
+    {{- end}}
+
+    <h2>Categories</h2>
+    <table class="categories">
+      <tr><th>Category</th><th>Top score</th><th>Leader</th></tr>
+      {{- range .Categories}}
+      <tr><td>{{.Name}}</td><td class="number">{{.MaxPoints}}</td><td>{{.Leader}}</td></tr>
+      {{- end}}
+    </table>
+
+    <h2>Recent solves</h2>
+    <table class="recent">
+      <tr><th>Time</th><th>Team</th><th>Category</th><th>Points</th></tr>
+      {{- range .Recent}}
+      <tr><td>{{.When.UTC.Format "15:04:05"}}</td><td>{{.TeamName}}</td><td>{{.Category}}</td><td class="number">{{.Points}}</td></tr>
+      {{- end}}
+    </table>
+
+    <footer>Generated {{.Generated.UTC.Format "2006-01-02 15:04:05Z"}}</footer>
+  </body>
+</html>
+`))
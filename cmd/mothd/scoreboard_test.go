@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+func TestScoreboard(t *testing.T) {
+	export := StateExport{
+		Enabled: true,
+		TeamNames: map[string]string{
+			"0": "Alpha",
+			"1": "Bravo",
+			"2": "Charlie",
+		},
+		PointsLog: award.List{
+			{When: 10, TeamID: "0", Category: "cat", Points: 1, Score: 1},
+			{When: 20, TeamID: "1", Category: "cat", Points: 1, Score: 1},
+			{When: 30, TeamID: "1", Category: "cat", Points: 2, Score: 2},
+			{When: 40, TeamID: "0", Category: "dog", Points: 5, Score: 5},
+			{When: 50, TeamID: "2", Category: "dog", Points: 5, Score: 5},
+		},
+	}
+
+	sb := NewScoreboard(&export)
+	if len(sb.Teams) != 3 {
+		t.Fatal("Wrong number of teams:", sb.Teams)
+	}
+	if sb.Teams[0].Name != "Alpha" {
+		t.Error("Wrong leader:", sb.Teams[0])
+	}
+	if sb.Teams[0].Score != 1+1.0/3 {
+		t.Error("Wrong score for leader:", sb.Teams[0].Score)
+	}
+	if (sb.Teams[1].Rank != 2) || (sb.Teams[2].Rank != 2) {
+		t.Error("Tied teams should share a rank:", sb.Teams)
+	}
+	if len(sb.Categories) != 2 {
+		t.Error("Wrong categories:", sb.Categories)
+	} else if (sb.Categories[0].Name != "cat") || (sb.Categories[0].Leader != "Bravo") {
+		t.Error("Wrong category leader:", sb.Categories[0])
+	} else if sb.Categories[1].Leader != "Alpha" {
+		t.Error("First team to reach the top score should lead:", sb.Categories[1])
+	}
+	if len(sb.Recent) != 5 {
+		t.Error("Wrong number of recent solves:", sb.Recent)
+	} else if sb.Recent[0].TeamName != "Charlie" {
+		t.Error("Recent solves should be newest first:", sb.Recent)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := sb.WriteHTML(buf, 0); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buf.String(), "<td>Bravo</td>") {
+		t.Error("Rendered scoreboard is missing a team")
+	}
+	if strings.Contains(buf.String(), "http-equiv") {
+		t.Error("Rendered a refresh header when none was asked for")
+	}
+}
+
+func TestScoreboardEmpty(t *testing.T) {
+	sb := NewScoreboard(&StateExport{})
+	buf := new(bytes.Buffer)
+	if err := sb.WriteHTML(buf, 0); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(buf.String(), "No scores yet") {
+		t.Error("Empty scoreboard doesn't say so")
+	}
+	if !strings.Contains(buf.String(), "suspended") {
+		t.Error("Disabled scoreboard doesn't say so")
+	}
+}
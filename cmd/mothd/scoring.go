@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Scoring models, for how points in each category add up to a team's score.
+// Either way, every category counts the same, however many points it has.
+const (
+	// ScoringRelative divides a team's points in each category
+	// by the most points any team has there.
+	// This is the default, and what the default theme has always done.
+	ScoringRelative = "relative"
+
+	// ScoringPercentage divides a team's points in each category
+	// by the points there are to be had there,
+	// so a team's score in a category doesn't change when another team scores.
+	ScoringPercentage = "percentage"
+)
+
+// ScoringModel returns how much a category adds to a team's score,
+// from the team's points there, the most points any team has there,
+// and the points there are to be had there.
+type ScoringModel func(points, leaderPoints, maxPoints int) float64
+
+// ScoringModels are the scoring models mothd knows, by name.
+var ScoringModels = map[string]ScoringModel{
+	ScoringRelative: func(points, leaderPoints, maxPoints int) float64 {
+		if leaderPoints <= 0 {
+			return 0
+		}
+		return float64(points) / float64(leaderPoints)
+	},
+	ScoringPercentage: func(points, leaderPoints, maxPoints int) float64 {
+		if maxPoints <= 0 {
+			return 0
+		}
+		// Multipliers can push a team past the points there are to be had
+		return min(float64(points)/float64(maxPoints), 1)
+	},
+}
+
+// ValidScoring returns an error if name isn't a scoring model mothd knows.
+// An empty name means ScoringRelative.
+func ValidScoring(name string) error {
+	if _, ok := ScoringModels[name]; (name != "") && !ok {
+		names := make([]string, 0, len(ScoringModels))
+		for n := range ScoringModels {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown scoring model %q: use one of %s", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Tie-break rules, for ordering teams with the same score.
+// Without one, tied teams share a rank.
+const (
+	// TieBreakLastSolve puts the team that reached its score first ahead.
+	TieBreakLastSolve = "last-solve"
+
+	// TieBreakAttempts puts the team that submitted fewer answers ahead.
+	TieBreakAttempts = "attempts"
+
+	// TieBreakTotalTime puts the team whose awards add up to less time ahead,
+	// counting each award from the first award anybody got.
+	TieBreakTotalTime = "total-time"
+)
+
+// TieBreaks are the tie-break rules mothd knows.
+var TieBreaks = []string{TieBreakLastSolve, TieBreakAttempts, TieBreakTotalTime}
+
+// ValidTieBreak returns an error if name isn't a tie-break rule mothd knows.
+// An empty name means no tie-break rule.
+func ValidTieBreak(name string) error {
+	if (name != "") && !slices.Contains(TieBreaks, name) {
+		return fmt.Errorf("unknown tie-break rule %q: use one of %s", name, strings.Join(TieBreaks, ", "))
+	}
+	return nil
+}
+
+// scoringModel returns the scoring model named name,
+// or ScoringRelative if there isn't one.
+func scoringModel(name string) ScoringModel {
+	if model, ok := ScoringModels[name]; ok {
+		return model
+	}
+	return ScoringModels[ScoringRelative]
+}
+
+// categoryTotals returns how many points there are to be had in each category,
+// if every puzzle in it is solved.
+// Retired puzzles don't count.
+func (mh *MothRequestHandler) categoryTotals() map[string]int {
+	retired := mh.State.Retired()
+	totals := make(map[string]int)
+	for _, provider := range mh.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			total := 0
+			for _, points := range withoutRetired(category.Puzzles, retired[category.Name]) {
+				total += points
+			}
+			totals[category.Name] = total
+		}
+	}
+	return totals
+}
+
+// totalAttempts returns how many answers a team has submitted, for every puzzle.
+func totalAttempts(state StateProvider, teamID string) int {
+	attempts, err := state.TeamAttempts(teamID)
+	if err != nil {
+		return 0
+	}
+	total := 0
+	for _, byPoints := range attempts {
+		for _, n := range byPoints {
+			total += n
+		}
+	}
+	return total
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+	"github.com/spf13/afero"
+)
+
+func TestScoringPercentage(t *testing.T) {
+	export := StateExport{
+		Config: Configuration{Scoring: ScoringPercentage},
+		TeamNames: map[string]string{
+			"0": "Alpha",
+			"1": "Bravo",
+		},
+		PointsLog: award.List{
+			{When: 10, TeamID: "0", Category: "cat", Points: 1, Score: 1},
+			{When: 20, TeamID: "1", Category: "dog", Points: 100, Score: 100},
+			{When: 30, TeamID: "1", Category: "dog", Points: 200, Score: 300},
+		},
+		MaxPoints: map[string]int{"cat": 4, "dog": 300},
+	}
+
+	sb := NewScoreboard(&export)
+	if len(sb.Teams) != 2 {
+		t.Fatal("Wrong number of teams:", sb.Teams)
+	}
+	// Multipliers don't get Bravo past all of dog
+	if (sb.Teams[0].Name != "Bravo") || (sb.Teams[0].Score != 1) {
+		t.Error("Wrong leader:", sb.Teams[0])
+	}
+	if sb.Teams[1].Score != 0.25 {
+		t.Error("Wrong score:", sb.Teams[1])
+	}
+
+	// The same export, scored relative to each category's leader
+	export.Config.Scoring = ""
+	sb = NewScoreboard(&export)
+	if (sb.Teams[0].Score != 1) || (sb.Teams[1].Score != 1) {
+		t.Error("Wrong relative scores:", sb.Teams)
+	}
+}
+
+func TestValidScoring(t *testing.T) {
+	for _, name := range []string{"", ScoringRelative, ScoringPercentage} {
+		if err := ValidScoring(name); err != nil {
+			t.Error(name, err)
+		}
+	}
+	if err := ValidScoring("golf"); err == nil {
+		t.Error("Unknown scoring model accepted")
+	}
+}
+
+func TestScoringPercentageExport(t *testing.T) {
+	server := NewTestServer()
+	handler := server.NewHandler("")
+	if export := handler.ExportPublicState(); len(export.MaxPoints) != 0 {
+		t.Error("Category totals given out with relative scoring:", export.MaxPoints)
+	}
+
+	server.Config.Scoring = ScoringPercentage
+	handler = server.NewHandler("")
+	export := handler.ExportPublicState()
+	if export.MaxPoints["pategory"] != 6 {
+		t.Error("Wrong category totals:", export.MaxPoints)
+	}
+	if len(export.Puzzles["pategory"]) != 0 {
+		t.Error("Puzzles given out to the public:", export.Puzzles)
+	}
+}
+
+func TestTieBreak(t *testing.T) {
+	export := StateExport{
+		TeamNames: map[string]string{
+			"0": "Alpha",
+			"1": "Bravo",
+		},
+		PointsLog: award.List{
+			{When: 10, TeamID: "1", Category: "cat", Points: 1, Score: 1},
+			{When: 20, TeamID: "0", Category: "cat", Points: 1, Score: 1},
+			{When: 30, TeamID: "0", Category: "dog", Points: 1, Score: 1},
+			{When: 50, TeamID: "1", Category: "dog", Points: 1, Score: 1},
+			{When: 60, TeamID: "0", Category: "pig", Points: 2, Part: "a", Score: 0},
+		},
+		attempts: map[string]int{"0": 5, "1": 2},
+	}
+
+	for tieBreak, leader := range map[string]string{
+		TieBreakLastSolve: "Alpha", // 30 beats 50: parts don't count
+		TieBreakAttempts:  "Bravo", // 2 beats 5
+		TieBreakTotalTime: "Bravo", // 0+40 beats 10+20+50
+	} {
+		export.Config.TieBreak = tieBreak
+		sb := NewScoreboard(&export)
+		if sb.Teams[0].Name != leader {
+			t.Error(tieBreak, "wrong leader:", sb.Teams)
+		}
+		if (sb.Teams[0].Rank != 1) || (sb.Teams[1].Rank != 2) {
+			t.Error(tieBreak, "tie wasn't broken:", sb.Teams)
+		}
+	}
+
+	export.Config.TieBreak = ""
+	sb := NewScoreboard(&export)
+	if (sb.Teams[0].Rank != 1) || (sb.Teams[1].Rank != 1) {
+		t.Error("Tied teams should share a rank without a tie-break rule:", sb.Teams)
+	}
+
+	if err := ValidTieBreak("coin-toss"); err == nil {
+		t.Error("Unknown tie-break rule accepted")
+	}
+}
+
+func TestTieBreakAttemptsExport(t *testing.T) {
+	server := NewTestServer()
+	server.Config.TieBreak = TieBreakAttempts
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teamids.txt", []byte("team0\nteam1\n"), 0644)
+	state.refresh()
+
+	for _, teamID := range []string{"team0", "team1"} {
+		state.SetTeamName(teamID, teamID)
+		state.AwardPoints(teamID, "pategory", 1)
+	}
+	state.AddAttempt("team0", "pategory", 1)
+	state.AddAttempt("team0", "pategory", 1)
+	state.AddAttempt("team1", "pategory", 1)
+	server.refresh()
+
+	handler := server.NewHandler("team0")
+	export := handler.ExportState()
+	sb := NewScoreboard(export)
+	// team0 is "self" in its own export
+	if (len(sb.Teams) != 2) || (sb.Teams[0].Name != "team1") || (sb.Teams[1].Name != "team0") || (sb.Teams[0].TieBreak != 1) || (sb.Teams[1].TieBreak != 2) {
+		t.Error("Wrong standings:", sb.Teams)
+	}
+	if export.TieBreaks["self"] != 2 {
+		t.Error("Tie-break values not exported:", export.TieBreaks)
+	}
+
+	// More attempts are seen without anything else changing
+	state.AddAttempt("team1", "pategory", 1)
+	state.AddAttempt("team1", "pategory", 1)
+	if export := handler.ExportState(); export.TieBreaks["self"] != 2 || len(export.TieBreaks) != 2 {
+		t.Error("Wrong tie-break values:", export.TieBreaks)
+	} else if sb := NewScoreboard(export); sb.Teams[0].Name != "team0" {
+		t.Error("Attempts not updated:", sb.Teams)
+	}
+}
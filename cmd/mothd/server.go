@@ -1,14 +1,46 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder for avatars
+	_ "image/jpeg" // Register JPEG decoder for avatars
+	_ "image/png"  // Register PNG decoder for avatars
 	"io"
-	"strconv"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/dirtbags/moth/v4/pkg/award"
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 )
 
+// ErrIncorrectAnswer means a submitted answer was not correct.
+var ErrIncorrectAnswer = errors.New("incorrect answer")
+
+// ErrInvalidAvatar means an avatar image was refused.
+var ErrInvalidAvatar = errors.New("invalid avatar")
+
+// MaxAvatarBytes is the largest avatar image allowed, in bytes.
+const MaxAvatarBytes = 64 * 1024
+
+// MaxAvatarPixels is the widest or highest avatar image allowed, in pixels.
+const MaxAvatarPixels = 256
+
+// ErrInvalidTeamID means a request was made with a team ID that isn't registered.
+var ErrInvalidTeamID = errors.New("invalid team ID")
+
+// ErrPuzzleLocked means a puzzle doesn't exist, or hasn't been unlocked yet.
+var ErrPuzzleLocked = errors.New("puzzle does not exist or is locked")
+
 // Category represents a puzzle category.
 type Category struct {
 	Name    string
@@ -25,15 +57,293 @@ type ReadSeekCloser interface {
 // Configuration stores information about server configuration.
 type Configuration struct {
 	Devel bool
+
+	// Locale is the language of the theme's own strings,
+	// the last resort for every translation
+	Locale string `json:",omitempty"`
+
+	// Email is true if teams may give an email address when they register,
+	// to be sent their team ID
+	Email bool `json:",omitempty"`
+
+	// Practice is true after an event:
+	// every puzzle is unlocked, and answers are checked, but no points are awarded
+	Practice bool `json:",omitempty"`
+
+	// Scoring is the name of the scoring model in ScoringModels
+	// the scoreboard uses; empty means ScoringRelative
+	Scoring string `json:",omitempty"`
+
+	// TieBreak is the rule in TieBreaks for ordering teams with the same score;
+	// empty means tied teams share a rank
+	TieBreak string `json:",omitempty"`
+
+	// OpenRegistration lets anybody create a team with /create-team,
+	// and be given a new team ID, instead of needing one from teamids.txt.
+	// MaxTeams is the most teams that may be registered before it stops;
+	// zero means no limit.
+	OpenRegistration bool `json:",omitempty"`
+	MaxTeams         int  `json:"-"`
+
+	// VerifyEmail means teams made by open registration must give an email address,
+	// and are only sent their team ID there
+	VerifyEmail bool `json:",omitempty"`
+
+	// JoinCodes lets a team's owner hand out a join code,
+	// so members can join and log in with their own member tokens,
+	// instead of everybody sharing the team ID.
+	// MaxTeamSize is the most people a team may have, counting its owner;
+	// zero means no limit.
+	JoinCodes   bool `json:",omitempty"`
+	MaxTeamSize int  `json:",omitempty"`
+
+	// CaptchaSiteKey is the public key a theme's CAPTCHA widget needs,
+	// if creating a team means solving a CAPTCHA
+	CaptchaSiteKey string `json:",omitempty"`
+
+	// Sessions is true if teams are given session cookies when they log in,
+	// so clients needn't put the team ID in URLs
+	Sessions bool `json:",omitempty"`
+
+	// AllowGETMutations permits /answer and /register over GET, for old clients
+	AllowGETMutations bool `json:"-"`
+
+	// HideAnswerHashes removes answer hashes from every puzzle,
+	// so answers can only be checked by submitting them
+	HideAnswerHashes bool `json:"-"`
+
+	// HTTP server tuning: see net/http.Server for what these do.
+	// Zero means no limit.
+	ReadTimeout       time.Duration `json:"-"`
+	ReadHeaderTimeout time.Duration `json:"-"`
+	WriteTimeout      time.Duration `json:"-"`
+	IdleTimeout       time.Duration `json:"-"`
+	MaxHeaderBytes    int           `json:"-"`
+
+	// MaxConnections limits how many connections are open at once.
+	// Zero means no limit.
+	MaxConnections int `json:"-"`
+
+	// HTTP2 allows clients to use HTTP/2 over TLS
+	HTTP2 bool `json:"-"`
+
+	// AllowNets, if not empty, are the only networks participants may connect from.
+	// DenyNets are networks participants may not connect from.
+	AllowNets []*net.IPNet `json:"-"`
+	DenyNets  []*net.IPNet `json:"-"`
+
+	// TrustedProxies are networks whose X-Forwarded-For headers are believed
+	TrustedProxies []*net.IPNet `json:"-"`
+
+	// CORSOrigins are web origins whose pages may use the API, or "*" for any.
+	// CORSCredentials lets them send cookies.
+	// CORSMaxAge is how long browsers may cache preflight responses.
+	CORSOrigins     []string      `json:"-"`
+	CORSCredentials bool          `json:"-"`
+	CORSMaxAge      time.Duration `json:"-"`
+
+	// AdminToken must be presented to use /admin/ endpoints.
+	// If it's empty, there are no /admin/ endpoints.
+	AdminToken string `json:"-"`
+
+	// WrongAnswers is how many wrong answers a team may submit for a puzzle
+	// before it has to wait AnswerCooldown to try again.
+	// Zero for either means no limit.
+	WrongAnswers   int           `json:"-"`
+	AnswerCooldown time.Duration `json:"-"`
+
+	// DecoyAfter is how many wrong answers a team may submit for a puzzle in an hour
+	// before it looks like brute force,
+	// and every wrong answer is held back DecoyDelay.
+	// Zero means nothing looks like brute force.
+	DecoyAfter int           `json:"-"`
+	DecoyDelay time.Duration `json:"-"`
+
+	// UploadMaxSize is the largest file, in bytes, a team may upload to answer a puzzle.
+	// Puzzles can set a smaller limit.
+	UploadMaxSize int64 `json:"-"`
+
+	// UploadsPerHour is how many files each team may upload in an hour.
+	// Zero means no limit.
+	UploadsPerHour int `json:"-"`
+
+	// MaxDownloads is how many files from /content each team may be downloading at once,
+	// and DownloadRate how many bytes a second they're sent, over all of them.
+	// Somebody who hasn't logged in counts as a team of their own, by address.
+	// Zero means no limit.
+	MaxDownloads int   `json:"-"`
+	DownloadRate int64 `json:"-"`
+
+	// RecoveryCodes is how many one-time recovery codes each team gets when it registers
+	RecoveryCodes int `json:"-"`
+
+	// SessionLifetime is how long a session cookie lasts.
+	// Once one is SessionRotate old, it's swapped for a new one.
+	// Zero lifetime means no sessions: every request sends its team ID.
+	SessionLifetime time.Duration `json:"-"`
+	SessionRotate   time.Duration `json:"-"`
+
+	// SessionOnly ignores team IDs sent with requests, except to log in:
+	// teams need a session cookie.
+	SessionOnly bool `json:"-"`
 }
 
 // StateExport is given to clients requesting the current state.
 type StateExport struct {
 	Config    Configuration
 	Enabled   bool
+	Paused    bool       `json:",omitempty"`
+	Until     *time.Time `json:",omitempty"` // Next scheduled change to Enabled
 	TeamNames map[string]string
 	PointsLog award.List
 	Puzzles   map[string][]int
+
+	// Multipliers are current and upcoming point multipliers
+	Multipliers []Multiplier `json:",omitempty"`
+
+	// Avatars maps exported team IDs to avatar hashes, for teams that have one
+	Avatars map[string]string `json:",omitempty"`
+
+	// Divisions are the divisions teams may be in.
+	// TeamDivisions maps exported team IDs to divisions, for teams in one.
+	Divisions     []string          `json:",omitempty"`
+	TeamDivisions map[string]string `json:",omitempty"`
+
+	// FlagFormats are patterns answers must match, by category.
+	// The pattern for "*" applies to categories without their own.
+	FlagFormats map[string]string `json:",omitempty"`
+
+	// Locale is the language the requesting team would like things in,
+	// if it has said
+	Locale string `json:",omitempty"`
+
+	// Solved lists the puzzles the requesting team has solved, by category.
+	// Attempts counts the answers it has submitted for each puzzle,
+	// by category, then point value.
+	Solved   map[string][]int       `json:",omitempty"`
+	Attempts map[string]map[int]int `json:",omitempty"`
+
+	// Opened is when the requesting team first loaded each puzzle,
+	// in Unix seconds, by category, then point value.
+	Opened map[string]map[int]int64 `json:",omitempty"`
+
+	// Services is the status of the network service of each unlocked puzzle that has one,
+	// by category, then point value.
+	Services map[string]map[int]ServiceStatus `json:",omitempty"`
+
+	// Tags is the tags of each unlocked puzzle that has any,
+	// by category, then point value.
+	Tags map[string]map[int][]string `json:",omitempty"`
+
+	// Difficulties is the difficulty of each unlocked puzzle that has one,
+	// by category, then point value.
+	Difficulties map[string]map[int]int `json:",omitempty"`
+
+	// Solutions lists the unlocked puzzles whose solutions teams may read,
+	// at content/<category>/<points>/solution.html.
+	Solutions map[string][]int `json:",omitempty"`
+
+	// ListenerPorts is the TCP port of each unlocked puzzle's listener,
+	// by category, then point value.
+	ListenerPorts map[string]map[int]int `json:",omitempty"`
+
+	// Labs is the requesting team's labs,
+	// by category, then point value.
+	Labs map[string]map[int]Lab `json:",omitempty"`
+
+	// MaxPoints is the most points there are to be had in each category,
+	// if every puzzle in it is solved.
+	// It's for registered teams, or everybody with percentage scoring.
+	// Completed lists the categories the requesting team has solved every puzzle in.
+	MaxPoints map[string]int `json:",omitempty"`
+	Completed []string       `json:",omitempty"`
+
+	// TieBreaks orders teams with the same score under Config.TieBreak,
+	// by exported team ID: see ScoreboardTeam.TieBreak.
+	// It's only present with a tie-break rule,
+	// and has every team, even in a delta.
+	TieBreaks map[string]int64 `json:",omitempty"`
+
+	// Sequence identifies this revision of the state.
+	// It's only present if it was asked for.
+	Sequence uint64 `json:",omitempty"`
+
+	// attempts is how many answers each team has submitted,
+	// by exported team ID, for breaking ties by attempts.
+	// It's never sent to clients.
+	attempts map[string]int
+
+	// Since is the Sequence of an earlier export.
+	// If it's present, this export only has what's changed since then:
+	// see ExportStateSince.
+	Since uint64 `json:",omitempty"`
+}
+
+// ForDivision returns a copy of export with only the teams in division.
+// If division is empty, export is returned unchanged.
+//
+// Every division shares the same puzzles,
+// so those are left alone.
+func (export *StateExport) ForDivision(division string) *StateExport {
+	if division == "" {
+		return export
+	}
+	ret := *export
+	ret.TeamNames = make(map[string]string)
+	ret.PointsLog = make(award.List, 0, len(export.PointsLog))
+	ret.Avatars = nil
+	ret.TeamDivisions = make(map[string]string)
+
+	for exportID, d := range export.TeamDivisions {
+		if d != division {
+			continue
+		}
+		ret.TeamDivisions[exportID] = d
+		ret.TeamNames[exportID] = export.TeamNames[exportID]
+		if hash, ok := export.Avatars[exportID]; ok {
+			if ret.Avatars == nil {
+				ret.Avatars = make(map[string]string)
+			}
+			ret.Avatars[exportID] = hash
+		}
+	}
+	for _, awd := range export.PointsLog {
+		if _, ok := ret.TeamDivisions[awd.TeamID]; ok {
+			ret.PointsLog = append(ret.PointsLog, awd)
+		}
+	}
+	return &ret
+}
+
+// At returns a copy of export as it was at time when,
+// with only the awards made up to then.
+func (export *StateExport) At(when time.Time) *StateExport {
+	ret := *export
+	ret.PointsLog = make(award.List, 0, len(export.PointsLog))
+	for _, awd := range export.PointsLog {
+		if awd.When <= when.Unix() {
+			ret.PointsLog = append(ret.PointsLog, awd)
+		}
+	}
+	ret.TieBreaks = tieBreakValues(&ret)
+	return &ret
+}
+
+// Multiplier multiplies the score of awards in a category during a window of time.
+type Multiplier struct {
+	// Category is the category this applies to, or "*" for all categories
+	Category   string
+	Multiplier float64
+	Start      time.Time
+	End        time.Time
+}
+
+// Applies returns true if m applies to an award in category at time when.
+func (m Multiplier) Applies(category string, when time.Time) bool {
+	if (m.Category != "*") && (m.Category != category) {
+		return false
+	}
+	return !when.Before(m.Start) && when.Before(m.End)
 }
 
 // PuzzleProvider defines what's required to provide puzzles.
@@ -41,6 +351,7 @@ type PuzzleProvider interface {
 	Open(cat string, points int, path string) (ReadSeekCloser, time.Time, error)
 	Inventory() []Category
 	CheckAnswer(cat string, points int, answer string) (bool, error)
+	CheckAnswerPart(cat string, points int, answer string) (string, error)
 	Mothball(cat string, w io.Writer) error
 	Maintainer
 }
@@ -54,11 +365,68 @@ type ThemeProvider interface {
 // StateProvider defines what's required to provide MOTH state.
 type StateProvider interface {
 	Enabled() bool
+	Paused() bool
+	Pause() error
+	Resume() error
+	Until() time.Time
+	Pauses() ([]Pause, error)
+	Schedule() (string, error)
+	SetSchedule(schedule string) error
 	PointsLog() award.List
+	PendingAwards() award.List
+	Revision() uint64
 	TeamName(teamID string) (string, error)
 	SetTeamName(teamID, teamName string) error
 	AwardPoints(teamID string, cat string, points int) error
+	AwardCredit(teamID string, cat string, points int, part string, score int) error
+	Multipliers() []Multiplier
+	CheckTeamName(teamName string) error
+	RenameTeam(teamID, teamName string) error
+	TeamAvatar(teamID string) (string, error)
+	SetTeamAvatar(teamID string, avatar []byte) error
+	OpenAvatar(hash string) (ReadSeekCloser, time.Time, error)
+	Divisions() []string
+	FlagFormats() map[string]string
+	Retired() map[string][]int
+	RetirePuzzle(cat string, points int, refund bool) error
+	RestorePuzzle(cat string, points int) error
+	ReleasedSolutions() map[string][]int
+	ReleaseSolution(cat string, points int, released bool) error
+	Errata(cat string, points int) Erratum
+	SetErrata(cat string, points int, text string) error
+	ExtraAnswers(cat string, points int) []string
+	AcceptAnswer(cat string, points int, answer string) error
+	TeamEmails() map[string]string
+	SetTeamEmail(teamID, email string) error
+	NewRecoveryCodes(teamID string, n int) ([]string, error)
+	NewTeamID(maxTeams int) (string, error)
+	JoinCode(teamID string, renew bool) (string, error)
+	JoinTeam(code, name string, maxSize int) (Member, error)
+	TeamMembers(teamID string) ([]Member, error)
+	MemberByToken(token string) (Member, error)
+	RemoveMember(teamID, memberID string) error
+	RecoverTeam(code string, rotate bool) (string, error)
+	SessionKey() ([]byte, error)
+	RevokedSessions() map[string]time.Time
+	RevokeSessions(teamID string) error
+	EndedSessions() map[string]EndedSession
+	EndSession(e EndedSession) error
+	TeamDivision(teamID string) (string, error)
+	SetTeamDivision(teamID, division string) error
+	TeamLocale(teamID string) (string, error)
+	SetTeamLocale(teamID, locale string) error
+	AddAttempt(teamID, cat string, points int) error
+	TeamAttempts(teamID string) (map[string]map[int]int, error)
+	OpenPuzzle(teamID, cat string, points int) error
+	TeamOpened(teamID string) (map[string]map[int]time.Time, error)
+	AddWrongAnswer(teamID, cat string, points int) error
+	TeamWrongAnswers(teamID string) (map[string]map[int][]time.Time, error)
+	TeamUnlocks(teamID string) (map[string][]int, error)
+	SetTeamUnlock(teamID, cat string, points int, unlocked bool) error
+	IssueCertificate(cert Certificate) (Certificate, error)
+	Certificate(code string) (Certificate, error)
 	LogEvent(event, teamID, cat string, points int, extra ...string)
+	Backup(w io.Writer) error
 	Maintainer
 }
 
@@ -79,15 +447,68 @@ type MothServer struct {
 	Theme           ThemeProvider
 	State           StateProvider
 	Config          Configuration
+
+	// Listeners are told about registrations, awards, and completed categories
+	Listeners []EventListener
+
+	// Tracer, if set, records spans for requests and provider calls
+	Tracer *Tracer
+
+	// Sharing, if set, watches for signs of teams sharing answers.
+	// It should also be in Listeners.
+	Sharing *SharingDetector
+
+	// Services, if set, keeps an eye on the network services puzzles declare
+	Services *ServiceMonitor
+
+	// TCPListeners, if set, runs the TCP listeners puzzles ask for
+	TCPListeners *TCPListenerManager
+
+	// Labs, if set, provisions each team's labs.
+	// It should also be in Listeners.
+	Labs *LabManager
+
+	// Mailer, if set, sends email to teams that gave an address
+	Mailer *Mailer
+
+	// Captcha, if set, checks the CAPTCHA teams solve to create a team
+	Captcha *Captcha
+
+	answers   *answerQueue
+	exports   *exportCache
+	uploads   *uploadLimiter
+	downloads *downloadLimiter
+	credits   *creditsCache
+	metadata  *metadataCache
+
+	// configLock guards Config, which /admin/config can change.
+	// settingsLock keeps changes from overlapping.
+	// They're pointers, so copies of the server share them.
+	configLock     *sync.RWMutex
+	settingsLock   *sync.Mutex
+	settingChanges *settingsAudit
+
+	// registrationLock lets one team at a time be created by open registration
+	registrationLock *sync.Mutex
 }
 
 // NewMothServer returns a new MothServer.
 func NewMothServer(config Configuration, theme ThemeProvider, state StateProvider, puzzleProviders ...PuzzleProvider) *MothServer {
 	return &MothServer{
-		Config:          config,
-		PuzzleProviders: puzzleProviders,
-		Theme:           theme,
-		State:           state,
+		Config:           config,
+		PuzzleProviders:  puzzleProviders,
+		Theme:            theme,
+		State:            state,
+		answers:          newAnswerQueue(),
+		exports:          newExportCache(),
+		uploads:          newUploadLimiter(),
+		downloads:        newDownloadLimiter(),
+		credits:          newCreditsCache(),
+		metadata:         newMetadataCache(),
+		configLock:       new(sync.RWMutex),
+		settingsLock:     new(sync.Mutex),
+		settingChanges:   newSettingsAudit(),
+		registrationLock: new(sync.Mutex),
 	}
 }
 
@@ -95,73 +516,490 @@ func NewMothServer(config Configuration, theme ThemeProvider, state StateProvide
 func (s *MothServer) NewHandler(teamID string) MothRequestHandler {
 	return MothRequestHandler{
 		MothServer: s,
+		Config:     s.config(),
 		teamID:     teamID,
+		log:        slog.Default().With("team", teamID),
 	}
 }
 
 // MothRequestHandler provides http.RequestHandler for a MothServer.
 type MothRequestHandler struct {
 	*MothServer
+
+	// Config is the server's configuration when the handler was made
+	Config Configuration
+
 	teamID string
+	remote net.IP
+	log    *slog.Logger
+	ctx    context.Context // nil if there's no request: see WithContext
+
+	// member is the ID of the team's member making the request,
+	// or empty if the team's owner is, with the team ID
+	member string
+}
+
+// setMember records that memberID, a member of the team, is making the request.
+func (mh *MothRequestHandler) setMember(memberID string) {
+	if memberID != "" {
+		mh.member = memberID
+		mh.log = mh.log.With("member", memberID)
+	}
 }
 
 // PuzzlesOpen opens a file associated with a puzzle.
+func (mh *MothRequestHandler) PuzzlesOpen(cat string, points int, path string) (ReadSeekCloser, time.Time, error) {
+	return mh.PuzzlesOpenLocalized(cat, points, path, nil)
+}
+
+// PuzzlesOpenLocalized opens a file associated with a puzzle.
+// puzzle.json is in the first of locales the puzzle has been translated into,
+// or the puzzle's own language if none of them.
 // BUG(neale): Multiple providers with the same category name are not detected or handled well.
-func (mh *MothRequestHandler) PuzzlesOpen(cat string, points int, path string) (r ReadSeekCloser, ts time.Time, err error) {
+func (mh *MothRequestHandler) PuzzlesOpenLocalized(cat string, points int, path string, locales []string) (r ReadSeekCloser, ts time.Time, err error) {
+	if !mh.unlocked(cat, points) {
+		return nil, time.Time{}, ErrPuzzleLocked
+	}
+	if (path == transpile.SolutionFile) && !mh.solutionReleased(cat, points) {
+		return nil, time.Time{}, ErrPuzzleLocked
+	}
+
+	if path == "puzzle.json" {
+		localized := false
+		for _, locale := range locales {
+			if r, ts, err = mh.openProvided(cat, points, "puzzle."+locale+".json"); err == nil {
+				localized = true
+				break
+			} else if r != nil {
+				r.Close()
+			}
+		}
+		if !localized {
+			r, ts, err = mh.openProvided(cat, points, path)
+		}
+		if err != nil {
+			return r, ts, err
+		}
+
+		// Log puzzle.json loads
+		mh.State.LogEvent("load", mh.teamID, cat, points)
+		mh.log.Debug("puzzle loaded", "category", cat, "points", points)
+		if _, err := mh.State.TeamName(mh.teamID); err == nil {
+			if err := mh.State.OpenPuzzle(mh.teamID, cat, points); err != nil {
+				mh.log.Error("recording puzzle load", "category", cat, "points", points, "error", err)
+			}
+			mh.notify(mh.newEvent(EventLoad, cat, points))
+		}
+
+		if mh.Config.HideAnswerHashes && (err == nil) {
+			r, err = hideAnswerHashes(r)
+		}
+		if err == nil {
+			if erratum := mh.State.Errata(cat, points); erratum.Text != "" {
+				r, err = addErratum(r, erratum)
+				if erratum.Updated.After(ts) {
+					ts = erratum.Updated
+				}
+			}
+		}
+		return
+	}
+
+	return mh.openProvided(cat, points, path)
+}
+
+// unlocked returns true if this team may open a puzzle.
+func (mh *MothRequestHandler) unlocked(cat string, points int) bool {
 	export := mh.exportStateIfRegistered(true)
-	found := false
 	for _, p := range export.Puzzles[cat] {
 		if p == points {
-			found = true
+			return true
 		}
 	}
-	if !found {
-		return nil, time.Time{}, fmt.Errorf("puzzle does not exist or is locked")
-	}
+	return false
+}
 
+// openProvided opens a file associated with a puzzle, from the providers of cat.
+func (mh *MothRequestHandler) openProvided(cat string, points int, path string) (r ReadSeekCloser, ts time.Time, err error) {
 	// Try every provider until someone doesn't return an error
-	for _, provider := range mh.PuzzleProviders {
+	for _, provider := range mh.providersFor(cat) {
 		r, ts, err = provider.Open(cat, points, path)
 		if err != nil {
 			return r, ts, err
 		}
 	}
+	return
+}
 
-	// Log puzzle.json loads
-	if path == "puzzle.json" {
-		mh.State.LogEvent("load", mh.teamID, cat, points)
+// hideAnswerHashes returns the puzzle.json in r, without any answer hashes.
+//
+// This works on the JSON object directly,
+// so fields not known to this version of the server are preserved.
+func hideAnswerHashes(r ReadSeekCloser) (ReadSeekCloser, error) {
+	defer r.Close()
+
+	puzzle := make(map[string]interface{})
+	if err := json.NewDecoder(r).Decode(&puzzle); err != nil {
+		return nil, err
 	}
 
-	return
+	delete(puzzle, "AnswerHashes")
+	delete(puzzle, "AnswerSalt")
+	delete(puzzle, "AnswerHashIterations")
+	for _, key := range []string{"Parts", "Tiers"} {
+		list, _ := puzzle[key].([]interface{})
+		for _, item := range list {
+			if obj, ok := item.(map[string]interface{}); ok {
+				delete(obj, "AnswerHashes")
+			}
+		}
+	}
+	puzzle["HideAnswerHashes"] = true
+
+	buf, err := json.Marshal(puzzle)
+	if err != nil {
+		return nil, err
+	}
+	return NullReadSeekCloser{bytes.NewReader(buf)}, nil
 }
 
 // CheckAnswer returns an error if answer is not a correct answer for puzzle points in category cat
 func (mh *MothRequestHandler) CheckAnswer(cat string, points int, answer string) error {
-	correct := false
-	for _, provider := range mh.PuzzleProviders {
+	_, err := mh.SubmitAnswer(cat, points, answer)
+	return err
+}
+
+// SubmitAnswer checks answer, and awards points if it's correct.
+//
+// For multi-part puzzles, answer may solve just one part of the puzzle.
+// For tiered puzzles, answer may solve a tier worth less than the full points.
+// If either happens, the name of the part or tier is returned.
+func (mh *MothRequestHandler) SubmitAnswer(cat string, points int, answer string) (string, error) {
+	return mh.SubmitAnswerOnce("", cat, points, answer)
+}
+
+// SubmitAnswerOnce is SubmitAnswer, with an idempotency key.
+//
+// Each team's submissions are handled one at a time.
+// If this team already submitted the same answer to the same puzzle with the same key,
+// the answer isn't checked again:
+// the outcome of the earlier submission is returned.
+// An empty key is never the same as any other.
+func (mh *MothRequestHandler) SubmitAnswerOnce(key string, cat string, points int, answer string) (string, error) {
+	if mh.isUploadPuzzle(cat, points) {
+		// The upload checker would take answer to be the name of a file on this server
+		return "", ErrUploadRequired
+	}
+	if key != "" {
+		// Reusing a key for something else mustn't get the other thing's outcome
+		key = fmt.Sprintf("%s\x00%d\x00%s\x00%s", cat, points, answer, key)
+	}
+	return mh.queueAnswer(key, cat, points, answer, false)
+}
+
+// queueAnswer calls submitAnswer once the team's earlier submissions are done.
+// See answerQueue.do for what key does.
+//
+// A wrong answer from a team that looks like it's guessing is held back here,
+// once it's out of the queue,
+// so the team's other submissions don't wait behind it.
+// The delay ends early if the request is cancelled.
+func (mh *MothRequestHandler) queueAnswer(key string, cat string, points int, answer string, upload bool) (string, error) {
+	var delay time.Duration
+	submit := func() (string, error) {
+		part, err := mh.submitAnswer(cat, points, answer, upload)
+		if err == ErrIncorrectAnswer {
+			delay = mh.decoy(cat, points)
+		}
+		return part, err
+	}
+
+	var part string
+	var err error
+	if mh.answers == nil {
+		part, err = submit()
+	} else {
+		part, err = mh.answers.do(mh.teamID, key, submit)
+	}
+
+	if delay > 0 {
+		ctx := mh.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return part, err
+}
+
+// submitAnswer checks answer, and awards points if it's correct.
+// If upload is true, answer is the path of an uploaded file.
+func (mh *MothRequestHandler) submitAnswer(cat string, points int, answer string, upload bool) (string, error) {
+	if mh.retired(cat, points) {
+		return "", ErrPuzzleLocked
+	}
+	if mh.State.Paused() {
+		// Don't even say whether it was right
+		mh.State.LogEvent("paused", mh.teamID, cat, points)
+		return "", ErrPaused
+	}
+	if limit, ok := mh.AnswerLimit(cat, points); ok && (limit.Cooldown > 0) {
+		// Don't even say whether it was right
+		mh.State.LogEvent("cooldown", mh.teamID, cat, points)
+		return "", ErrCoolingDown
+	}
+	// Answers accepted by an administrator skip the flag format,
+	// since they're often the ones nobody anticipated
+	extra := !upload && mh.extraAnswer(cat, points, answer)
+	if re := mh.flagFormat(cat); !upload && !extra && (re != nil) && !re.MatchString(answer) {
+		// Not counted as a wrong answer
+		mh.State.LogEvent("malformed", mh.teamID, cat, points)
+		return "", ErrMalformedAnswer
+	}
+
+	providers := mh.providersFor(cat)
+	correct := extra
+	for _, provider := range providers {
 		if ok, err := provider.CheckAnswer(cat, points, answer); err != nil {
-			return err
+			return "", err
 		} else if ok {
 			correct = true
 		}
 	}
+
+	part := ""
 	if !correct {
+		for _, provider := range providers {
+			if p, err := provider.CheckAnswerPart(cat, points, answer); err != nil {
+				return "", err
+			} else if p != "" {
+				part = p
+			}
+		}
+	}
+
+	// Only registered teams' attempts are counted
+	_, err := mh.State.TeamName(mh.teamID)
+	registered := (err == nil)
+	if registered {
+		if err := mh.State.AddAttempt(mh.teamID, cat, points); err != nil {
+			mh.log.Error("recording attempt", "category", cat, "points", points, "error", err)
+		}
+	}
+
+	if !correct && (part == "") {
 		mh.State.LogEvent("wrong", mh.teamID, cat, points)
-		return fmt.Errorf("incorrect answer")
+		mh.log.Info("wrong answer", "category", cat, "points", points)
+		if registered {
+			if err := mh.State.AddWrongAnswer(mh.teamID, cat, points); err != nil {
+				mh.log.Error("recording wrong answer", "category", cat, "points", points, "error", err)
+			}
+			event := mh.newEvent(EventWrong, cat, points)
+			if !upload {
+				event.Answer = answer
+			}
+			mh.notify(event)
+		}
+		return "", ErrIncorrectAnswer
 	}
 
-	mh.State.LogEvent("correct", mh.teamID, cat, points)
+	if part == "" {
+		mh.State.LogEvent("correct", mh.teamID, cat, points)
+	} else {
+		mh.State.LogEvent("correct", mh.teamID, cat, points, part)
+	}
+	mh.log.Info("correct answer", "category", cat, "points", points, "part", part)
 
-	if _, err := mh.State.TeamName(mh.teamID); err != nil {
-		return fmt.Errorf("invalid team ID")
+	if !registered {
+		return "", ErrInvalidTeamID
+	}
+	if mh.Config.Practice {
+		mh.State.LogEvent("practice", mh.teamID, cat, points)
+		return "", ErrPracticeAnswer
+	}
+
+	solved := mh.solvedParts(cat, points)
+	if solved[""] || solved[part] {
+		return "", ErrAlreadyAwarded
 	}
-	if err := mh.State.AwardPoints(mh.teamID, cat, points); err != nil {
+
+	// Work out what's left to award before multipliers and time limits,
+	// since the scores already awarded have them baked in
+	credit := 0
+	var puzzle transpile.Puzzle
+	if (part != "") || (len(solved) > 0) {
+		var err error
+		if puzzle, err = mh.puzzle(cat, points); err != nil {
+			return "", err
+		}
+		credit = partsCredit(puzzle, points, solved)
+	}
+	if part == "" {
+		return "", mh.award(cat, points, "", points-credit)
+	}
+	solved[part] = true
+
+	if _, ok := puzzle.Tier(part); ok {
+		score := partsCredit(puzzle, points, map[string]bool{part: true})
+		if score >= points {
+			return "", mh.award(cat, points, "", points-credit)
+		}
+		if score <= credit {
+			// They've already got a tier worth at least this much
+			return "", ErrAlreadyAwarded
+		}
+		return part, mh.award(cat, points, part, score-credit)
+	}
+
+	if len(solved) < len(puzzle.Parts) {
+		return part, mh.award(cat, points, part, partsCredit(puzzle, points, solved)-credit)
+	}
+
+	// That was the last part: award the whole puzzle
+	return "", mh.award(cat, points, "", points-credit)
+}
+
+// award gives this team credit for a puzzle, and tells listeners about it.
+// score is before multipliers and time limits, which only apply to it,
+// and not to anything already awarded.
+func (mh *MothRequestHandler) award(cat string, points int, part string, score int) error {
+	score = mh.timedScore(cat, points, max(score, 0))
+	if err := mh.State.AwardCredit(mh.teamID, cat, points, part, score); err != nil {
 		return err
 	}
+	mh.log.Debug("awarding credit", "category", cat, "points", points, "part", part, "score", score)
 
+	event := mh.newEvent(EventAward, cat, points)
+	event.Part = part
+	event.Score = score
+	mh.notify(event)
+
+	if (part == "") && mh.categoryComplete(cat, points) {
+		mh.State.LogEvent("complete", mh.teamID, cat, 0)
+		mh.notify(mh.newEvent(EventComplete, cat, 0))
+	}
 	return nil
 }
 
+// timedScore adjusts score for how long this team took to solve a puzzle with a time limit,
+// counting from when it first loaded the puzzle.
+//
+// A team that never loaded the puzzle is counted as late.
+func (mh *MothRequestHandler) timedScore(cat string, points int, score int) int {
+	if score <= 0 {
+		return score
+	}
+	puzzle, err := mh.puzzle(cat, points)
+	if (err != nil) || (puzzle.TimeLimit == 0) {
+		return score
+	}
+	elapsed := time.Duration(math.MaxInt64)
+	if opened, err := mh.State.TeamOpened(mh.teamID); err != nil {
+		mh.log.Error("reading puzzle loads", "error", err)
+	} else if when, ok := opened[cat][points]; ok {
+		elapsed = time.Since(when)
+		// The clock stops while the event is paused
+		if pauses, err := mh.State.Pauses(); err != nil {
+			mh.log.Error("reading pauses", "error", err)
+		} else {
+			elapsed -= pausedSince(pauses, when)
+		}
+	}
+	return int(math.Round(float64(score) * puzzle.TimeFactor(elapsed)))
+}
+
+// pausedSince returns how long the event has been paused since when.
+func pausedSince(pauses []Pause, when time.Time) time.Duration {
+	var paused time.Duration
+	for _, pause := range pauses {
+		start := pause.Start
+		if start.Before(when) {
+			start = when
+		}
+		if pause.End.After(start) {
+			paused += pause.End.Sub(start)
+		}
+	}
+	return paused
+}
+
+// solvedParts returns which parts, or tiers, of a puzzle this team has solved.
+// If the whole puzzle has been solved, the empty string is set.
+func (mh *MothRequestHandler) solvedParts(cat string, points int) map[string]bool {
+	solved := make(map[string]bool)
+	for _, awd := range append(mh.State.PointsLog(), mh.State.PendingAwards()...) {
+		if (awd.TeamID == mh.teamID) && (awd.Category == cat) && (awd.Points == points) {
+			solved[awd.Part] = true
+		}
+	}
+	return solved
+}
+
+// partsCredit returns how many of a puzzle's points
+// the parts, or tiers, in solved are worth together,
+// before multipliers and time limits.
+func partsCredit(puzzle transpile.Puzzle, points int, solved map[string]bool) int {
+	credit := 0
+	for name := range solved {
+		if tier, ok := puzzle.Tier(name); ok {
+			credit = max(credit, min(int(math.Round(tier.Value*float64(points))), points))
+		}
+	}
+	if puzzle.PartialCredit && (len(puzzle.Parts) > 0) {
+		n := 0
+		for _, part := range puzzle.Parts {
+			if solved[part.Name] {
+				n++
+			}
+		}
+		// Shares are rounded so that they always add up to points
+		credit = max(credit, points*n/len(puzzle.Parts))
+	}
+	return credit
+}
+
+// puzzle returns the puzzle.json for a puzzle, from the first provider that has it.
+// This does not check whether the puzzle has been unlocked.
+func (mh *MothRequestHandler) puzzle(cat string, points int) (transpile.Puzzle, error) {
+	puzzle := transpile.Puzzle{}
+	err := ErrPuzzleLocked
+	for _, provider := range mh.providersFor(cat) {
+		var f ReadSeekCloser
+		f, _, err = provider.Open(cat, points, "puzzle.json")
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(f).Decode(&puzzle)
+		f.Close()
+		if err == nil {
+			break
+		}
+	}
+	return puzzle, err
+}
+
+// providersFor returns the first puzzle provider with category cat.
+// If no provider has it, every provider is returned,
+// so their errors can say what's wrong.
+func (mh *MothRequestHandler) providersFor(cat string) []PuzzleProvider {
+	if len(mh.PuzzleProviders) < 2 {
+		return mh.PuzzleProviders
+	}
+	for _, provider := range mh.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			if category.Name == cat {
+				return []PuzzleProvider{provider}
+			}
+		}
+	}
+	return mh.PuzzleProviders
+}
+
 // ThemeOpen opens a file from a theme.
 func (mh *MothRequestHandler) ThemeOpen(path string) (ReadSeekCloser, time.Time, error) {
 	return mh.Theme.Open(path)
@@ -169,87 +1007,362 @@ func (mh *MothRequestHandler) ThemeOpen(path string) (ReadSeekCloser, time.Time,
 
 // Register associates a team name with a team ID.
 func (mh *MothRequestHandler) Register(teamName string) error {
+	return mh.RegisterInDivision(teamName, "")
+}
+
+// RegisterInDivision associates a team name with a team ID,
+// and puts the team in a division.
+// An empty division leaves the team out of every division.
+func (mh *MothRequestHandler) RegisterInDivision(teamName, division string) error {
+	if err := mh.checkRegistration(teamName, division); err != nil {
+		return err
+	}
+	mh.State.LogEvent("register", mh.teamID, "", 0)
+	if err := mh.State.SetTeamName(mh.teamID, teamName); err != nil {
+		return err
+	}
+	if division != "" {
+		if err := mh.State.SetTeamDivision(mh.teamID, division); err != nil {
+			return err
+		}
+	}
+	mh.log.Info("registered", "name", teamName, "division", division)
+	event := mh.newEvent(EventRegister, "", 0)
+	event.TeamName = teamName
+	mh.notify(event)
+	return nil
+}
+
+// checkRegistration returns an error if a team can't register as teamName, in division.
+func (mh *MothRequestHandler) checkRegistration(teamName, division string) error {
 	if teamName == "" {
 		return fmt.Errorf("empty team name")
 	}
-	mh.State.LogEvent("register", mh.teamID, "", 0)
-	return mh.State.SetTeamName(mh.teamID, teamName)
+	if err := mh.State.CheckTeamName(teamName); err != nil {
+		return err
+	}
+	if division != "" {
+		found := false
+		for _, d := range mh.State.Divisions() {
+			if d == division {
+				found = true
+			}
+		}
+		if !found {
+			return ErrUnknownDivision
+		}
+	}
+	return nil
+}
+
+// UpdateProfile changes a registered team's name, avatar, or language.
+//
+// An empty teamName leaves the name alone,
+// as does a nil avatar, or a nil locale.
+// An avatar which is not nil, but empty, removes the team's avatar,
+// and an empty locale removes the team's language preference.
+func (mh *MothRequestHandler) UpdateProfile(teamName string, avatar []byte, locale *string) error {
+	if _, err := mh.State.TeamName(mh.teamID); err != nil {
+		return ErrInvalidTeamID
+	}
+
+	if teamName != "" {
+		if err := mh.State.CheckTeamName(teamName); err != nil {
+			return err
+		}
+	}
+	if len(avatar) > 0 {
+		if err := CheckAvatar(avatar); err != nil {
+			return err
+		}
+	}
+	if (locale != nil) && (*locale != "") && !transpile.ValidLocale(*locale) {
+		return ErrInvalidLocale
+	}
+
+	if teamName != "" {
+		if err := mh.State.RenameTeam(mh.teamID, teamName); err != nil {
+			return err
+		}
+		mh.State.LogEvent("rename", mh.teamID, "", 0)
+		mh.log.Info("renamed", "name", teamName)
+	}
+	if avatar != nil {
+		if err := mh.State.SetTeamAvatar(mh.teamID, avatar); err != nil {
+			return err
+		}
+		mh.State.LogEvent("avatar", mh.teamID, "", 0)
+		mh.log.Info("changed avatar", "bytes", len(avatar))
+	}
+	if locale != nil {
+		if err := mh.State.SetTeamLocale(mh.teamID, *locale); err != nil {
+			return err
+		}
+		mh.log.Info("changed language", "locale", *locale)
+	}
+	return nil
+}
+
+// CheckAvatar returns an error if avatar isn't an acceptable avatar image.
+//
+// Avatars must be PNG, JPEG, or GIF images,
+// no larger than MaxAvatarBytes,
+// and no more than MaxAvatarPixels wide or high.
+func CheckAvatar(avatar []byte) error {
+	if len(avatar) > MaxAvatarBytes {
+		return fmt.Errorf("%w: larger than %d bytes", ErrInvalidAvatar, MaxAvatarBytes)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(avatar))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAvatar, err)
+	}
+	switch format {
+	case "png", "jpeg", "gif":
+	default:
+		return fmt.Errorf("%w: unsupported format %s", ErrInvalidAvatar, format)
+	}
+	if (config.Width > MaxAvatarPixels) || (config.Height > MaxAvatarPixels) {
+		return fmt.Errorf("%w: larger than %dx%d", ErrInvalidAvatar, MaxAvatarPixels, MaxAvatarPixels)
+	}
+	return nil
 }
 
 // ExportState anonymizes team IDs and returns StateExport.
 // If a teamID has been specified for this MothRequestHandler,
 // the anonymized team name for this teamID has the special value "self".
 // If not, the puzzles list is empty.
+//
+// The export shares maps and slices with other requests:
+// it must not be modified.
 func (mh *MothRequestHandler) ExportState() *StateExport {
 	return mh.exportStateIfRegistered(false)
 }
 
+// ExportPublicState returns StateExport without anything specific to a team.
+// There is no "self" team,
+// and no puzzles are listed, even on development servers.
+func (mh *MothRequestHandler) ExportPublicState() *StateExport {
+	public := mh.MothServer.NewHandler("")
+	return public.exportState(false, "")
+}
+
+// ExportStateSince returns what's changed in ExportState since sequence,
+// the Sequence of an earlier export.
+// Since is set to sequence.
+//
+// New awards are appended to the points log,
+// and new or changed entries are merged into TeamNames, Avatars, and TeamDivisions.
+// Everything else is complete.
+//
+// If the changes since sequence aren't known,
+// for instance because the server restarted or the points log was rewritten,
+// the whole state is returned, without Since.
+func (mh *MothRequestHandler) ExportStateSince(sequence uint64) *StateExport {
+	teamName, err := mh.State.TeamName(mh.teamID)
+	registered := mh.Config.Devel || (err == nil)
+	return mh.exportStateSince(registered, teamName, sequence)
+}
+
+// ExportPublicStateSince is like ExportStateSince, for ExportPublicState.
+func (mh *MothRequestHandler) ExportPublicStateSince(sequence uint64) *StateExport {
+	public := mh.MothServer.NewHandler("")
+	return public.exportStateSince(false, "", sequence)
+}
+
+func (mh *MothRequestHandler) exportStateSince(registered bool, teamName string, sequence uint64) *StateExport {
+	export, base := mh.exportStateBase(registered, teamName)
+	export.Sequence = base.revision
+	if (sequence == 0) || (mh.exports == nil) {
+		return export
+	}
+	if snap := mh.exports.snapshot(sequence); snap != nil {
+		if delta := base.delta(export, snap); delta != nil {
+			return delta
+		}
+	}
+	return export
+}
+
 // Export state, replacing the team ID with "self" if the team is registered.
 //
 // If forceRegistered is true, go ahead and export it anyway
 func (mh *MothRequestHandler) exportStateIfRegistered(forceRegistered bool) *StateExport {
-	export := StateExport{}
-	export.Config = mh.Config
-
 	teamName, err := mh.State.TeamName(mh.teamID)
 	registered := forceRegistered || mh.Config.Devel || (err == nil)
+	return mh.exportState(registered, teamName)
+}
 
-	export.Enabled = mh.State.Enabled()
-	export.TeamNames = make(map[string]string)
+// exportState returns StateExport,
+// with this team's ID replaced by "self" if registered is true.
+func (mh *MothRequestHandler) exportState(registered bool, teamName string) *StateExport {
+	export, _ := mh.exportStateBase(registered, teamName)
+	return export
+}
 
-	// Anonymize team IDs in points log, and write out team names
-	pointsLog := mh.State.PointsLog()
-	exportIDs := make(map[string]string)
-	maxSolved := make(map[string]int)
-	export.PointsLog = make(award.List, len(pointsLog))
+// exportStateBase returns StateExport,
+// and the exportBase it was made from.
+//
+// Only the parts that change over time, or with the puzzles available,
+// are computed here:
+// the rest comes from the export cache.
+func (mh *MothRequestHandler) exportStateBase(registered bool, teamName string) (*StateExport, *exportBase) {
+	key := exportKey{teamID: mh.teamID, registered: registered}
+	var cached *StateExport
+	var base *exportBase
+	if mh.exports == nil {
+		base = newExportBase(mh.State)
+		base.revision = mh.State.Revision()
+		cached = base.forTeam(mh.State, key, teamName)
+	} else {
+		cached, base = mh.exports.get(mh.State, key, teamName)
+	}
 
-	if registered {
-		export.TeamNames["self"] = teamName
-		exportIDs[mh.teamID] = "self"
+	export := *cached
+	export.Config = mh.Config
+	if mh.Config.TieBreak == TieBreakAttempts {
+		export.attempts = base.attemptCounts(mh.State)
+		if exportID, ok := base.exportIDs[mh.teamID]; ok && registered {
+			// This team is "self" in its own export
+			attempts := maps.Clone(export.attempts)
+			attempts["self"] = attempts[exportID]
+			delete(attempts, exportID)
+			export.attempts = attempts
+		}
 	}
-	for logno, awd := range pointsLog {
-		if id, ok := exportIDs[awd.TeamID]; ok {
-			awd.TeamID = id
-		} else {
-			exportID := strconv.Itoa(logno)
-			name, _ := mh.State.TeamName(awd.TeamID)
-			exportIDs[awd.TeamID] = exportID
-			awd.TeamID = exportID
-			export.TeamNames[exportID] = name
+	export.TieBreaks = tieBreakValues(&export)
+	export.Enabled = mh.State.Enabled()
+	export.Paused = mh.State.Paused()
+	if until := mh.State.Until(); !until.IsZero() {
+		export.Until = &until
+	}
+	export.Multipliers = mh.State.Multipliers()
+	export.Divisions = mh.State.Divisions()
+	if formats := mh.State.FlagFormats(); len(formats) > 0 {
+		export.FlagFormats = formats
+	}
+	if registered && (teamName != "") {
+		if locale, err := mh.State.TeamLocale(mh.teamID); err == nil {
+			export.Locale = locale
 		}
-		export.PointsLog[logno] = awd
-
-		// Record the highest-value unlocked puzzle in each category
-		if awd.Points > maxSolved[awd.Category] {
-			maxSolved[awd.Category] = awd.Points
+		if attempts, err := mh.State.TeamAttempts(mh.teamID); err != nil {
+			mh.log.Error("reading attempts", "error", err)
+		} else if len(attempts) > 0 {
+			export.Attempts = attempts
+		}
+		if opened, err := mh.State.TeamOpened(mh.teamID); err != nil {
+			mh.log.Error("reading puzzle loads", "error", err)
+		} else if len(opened) > 0 {
+			export.Opened = make(map[string]map[int]int64)
+			for cat, byPoints := range opened {
+				export.Opened[cat] = make(map[int]int64)
+				for points, when := range byPoints {
+					export.Opened[cat][points] = when.Unix()
+				}
+			}
 		}
 	}
 
 	export.Puzzles = make(map[string][]int)
+	export.MaxPoints = make(map[string]int)
 	if registered {
+		retired := mh.State.Retired()
+		unlocks := make(map[string][]int)
+		if mh.teamID != "" {
+			var err error
+			if unlocks, err = mh.State.TeamUnlocks(mh.teamID); err != nil {
+				mh.log.Error("reading unlocks", "error", err)
+			}
+		}
+
 		// We used to hand this out to everyone,
 		// but then we got a bad reputation on some secretive blacklist,
 		// and now the Navy can't register for events.
 		for _, provider := range mh.PuzzleProviders {
 			for _, category := range provider.Inventory() {
+				// Retired puzzles are left out, as if they'd never been there
+				category.Puzzles = withoutRetired(category.Puzzles, retired[category.Name])
+
 				// Append sentry (end of puzzles)
 				allPuzzles := append(category.Puzzles, 0)
 
-				max := maxSolved[category.Name]
+				max := base.maxSolved[category.Name]
 
 				puzzles := make([]int, 0, len(allPuzzles))
 				for i, val := range allPuzzles {
 					puzzles = allPuzzles[:i+1]
-					if !mh.Config.Devel && (val > max) {
+					if !mh.Config.Devel && !mh.Config.Practice && (val > max) {
 						break
 					}
 				}
-				export.Puzzles[category.Name] = puzzles
+				// Puzzles an admin unlocked for this team are in, even if it hasn't reached them
+				export.Puzzles[category.Name] = withUnlocks(puzzles, category.Puzzles, unlocks[category.Name])
+
+				solved := make(map[int]bool)
+				for _, points := range export.Solved[category.Name] {
+					solved[points] = true
+				}
+				total := 0
+				complete := len(category.Puzzles) > 0
+				for _, points := range category.Puzzles {
+					total += points
+					complete = complete && solved[points]
+				}
+				export.MaxPoints[category.Name] = total
+				if complete {
+					export.Completed = append(export.Completed, category.Name)
+				}
 			}
 		}
+		sort.Strings(export.Completed)
+
+		if mh.Services != nil {
+			if statuses := mh.Services.serviceStatuses(export.Puzzles); len(statuses) > 0 {
+				export.Services = statuses
+			}
+		}
+		if tags := unlockedOnly(mh.PuzzleTags(), export.Puzzles); len(tags) > 0 {
+			export.Tags = tags
+		}
+		if difficulties := unlockedOnly(mh.PuzzleDifficulties(), export.Puzzles); len(difficulties) > 0 {
+			export.Difficulties = difficulties
+		}
+		if solutions := mh.releasedSolutions(export.Puzzles); len(solutions) > 0 {
+			export.Solutions = solutions
+		}
+		if mh.TCPListeners != nil {
+			if ports := mh.TCPListeners.Ports(export.Puzzles); len(ports) > 0 {
+				export.ListenerPorts = ports
+			}
+		}
+		if mh.Labs != nil {
+			if labs := mh.Labs.TeamLabs(mh.teamID); len(labs) > 0 {
+				export.Labs = labs
+			}
+		}
+	} else if mh.Config.Scoring == ScoringPercentage {
+		// Scoreboards need these to work out everybody's score
+		export.MaxPoints = mh.categoryTotals()
 	}
 
-	return &export
+	return &export, base
+}
+
+// withoutRetired returns puzzles, without any of the point values in retired.
+func withoutRetired(puzzles []int, retired []int) []int {
+	if len(retired) == 0 {
+		return puzzles
+	}
+	ret := make([]int, 0, len(puzzles))
+	for _, points := range puzzles {
+		keep := true
+		for _, r := range retired {
+			keep = keep && (points != r)
+		}
+		if keep {
+			ret = append(ret, points)
+		}
+	}
+	return ret
 }
 
 // Mothball generates a mothball for the given category.
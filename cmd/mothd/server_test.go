@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
 )
 
@@ -33,7 +40,7 @@ func NewTestServer() TestServer {
 func (ts TestServer) refresh() {
 	ts.State.(*State).refresh()
 	for _, pp := range ts.PuzzleProviders {
-		pp.(*Mothballs).refresh()
+		pp.refresh()
 	}
 	ts.Theme.(*Theme).refresh()
 }
@@ -192,3 +199,549 @@ func TestProdServer(t *testing.T) {
 
 	// BUG(neale): We aren't currently testing the various ways to disable the server
 }
+
+func TestMultiPartAnswers(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"partegory",
+		[]testFileContents{
+			{"2/puzzle.json", `{"Parts": [{"Name": "x"}, {"Name": "y"}]}`},
+			{"3/puzzle.json", `{"Parts": [{"Name": "a"}, {"Name": "b"}, {"Name": "c"}], "PartialCredit": true}`},
+			{"parts.txt", "2 x xray\n2 y yankee\n3 a alpha\n3 b bravo\n3 c charlie\n"},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	score := func() (total int) {
+		for _, awd := range handler.State.PointsLog() {
+			total += awd.Score
+		}
+		return
+	}
+
+	if part, err := handler.SubmitAnswer("partegory", 3, "alpha"); err != nil {
+		t.Error(err)
+	} else if part != "a" {
+		t.Error("Wrong part solved:", part)
+	}
+	server.refresh()
+	if score() != 1 {
+		t.Error("Partial credit not awarded:", handler.State.PointsLog())
+	}
+	if es := handler.ExportState(); len(es.Puzzles["partegory"]) != 1 {
+		t.Error("Solving a part unlocked a puzzle:", es.Puzzles)
+	}
+	if _, err := handler.SubmitAnswer("partegory", 3, "alpha"); err != ErrAlreadyAwarded {
+		t.Error("Solving a part twice:", err)
+	}
+	if _, err := handler.SubmitAnswer("partegory", 3, "xray"); err != ErrIncorrectAnswer {
+		t.Error("Part from another puzzle accepted:", err)
+	}
+
+	handler.SubmitAnswer("partegory", 3, "charlie")
+	server.refresh()
+	if part, err := handler.SubmitAnswer("partegory", 3, "bravo"); err != nil {
+		t.Error(err)
+	} else if part != "" {
+		t.Error("Last part should solve the puzzle, got part", part)
+	}
+	server.refresh()
+	if score() != 3 {
+		t.Error("Wrong score after solving all parts:", handler.State.PointsLog())
+	}
+	if es := handler.ExportState(); len(es.Puzzles["partegory"]) == 1 {
+		t.Error("Solving all parts didn't unlock the next puzzle:", es.Puzzles)
+	}
+
+	if part, err := handler.SubmitAnswer("partegory", 2, "yankee"); err != nil {
+		t.Error(err)
+	} else if part != "y" {
+		t.Error("Wrong part solved:", part)
+	}
+	server.refresh()
+	if score() != 3 {
+		t.Error("Points awarded for part of an all-or-nothing puzzle")
+	}
+	handler.SubmitAnswer("partegory", 2, "xray")
+	server.refresh()
+	if score() != 5 {
+		t.Error("Points not awarded for all-or-nothing puzzle")
+	}
+
+	es := handler.ExportState()
+	if solved := es.Solved["partegory"]; (len(solved) != 2) || (solved[0] != 3) || (solved[1] != 2) {
+		t.Error("Wrong puzzles solved:", es.Solved)
+	}
+	if attempts := es.Attempts["partegory"]; (attempts[3] != 5) || (attempts[2] != 2) {
+		t.Error("Wrong attempt counts:", es.Attempts)
+	}
+	if es.MaxPoints["partegory"] != 6 {
+		t.Error("Wrong maximum points:", es.MaxPoints)
+	}
+	if len(es.Completed) != 0 {
+		t.Error("Category completed with a puzzle unsolved:", es.Completed)
+	}
+	handler.SubmitAnswer("partegory", 1, "answer123")
+	server.refresh()
+	if es := handler.ExportState(); (len(es.Completed) != 1) || (es.Completed[0] != "partegory") {
+		t.Error("Wrong categories completed:", es.Completed)
+	}
+	other := server.NewHandler("otherTeam")
+	if es := other.ExportState(); (es.Solved != nil) || (es.Attempts != nil) {
+		t.Error("Unregistered team got solved puzzles or attempts:", es.Solved, es.Attempts)
+	}
+}
+
+func TestTieredAnswers(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"tiergory",
+		[]testFileContents{
+			{"3/puzzle.json", `{"Tiers": [{"Name": "acceptable", "Value": 0.34}, {"Name": "mastery", "Value": 1}]}`},
+			{"parts.txt", "3 acceptable good\n3 mastery great\n"},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	score := func() (total int) {
+		for _, awd := range handler.State.PointsLog() {
+			total += awd.Score
+		}
+		return
+	}
+
+	if part, err := handler.SubmitAnswer("tiergory", 3, "good"); err != nil {
+		t.Error(err)
+	} else if part != "acceptable" {
+		t.Error("Wrong tier:", part)
+	}
+	server.refresh()
+	if score() != 1 {
+		t.Error("Wrong score for acceptable tier:", handler.State.PointsLog())
+	}
+
+	if part, err := handler.SubmitAnswer("tiergory", 3, "great"); err != nil {
+		t.Error(err)
+	} else if part != "" {
+		t.Error("Mastery tier should solve the puzzle, got", part)
+	}
+	server.refresh()
+	if score() != 3 {
+		t.Error("Wrong score after upgrading:", handler.State.PointsLog())
+	}
+
+	if _, err := handler.SubmitAnswer("tiergory", 3, "good"); err != ErrAlreadyAwarded {
+		t.Error("Downgrading should be refused:", err)
+	}
+}
+
+func TestMultipliedParts(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"web",
+		[]testFileContents{
+			{"puzzles.txt", "10\n20\n"},
+			{"10/puzzle.json", `{"Parts": [{"Name": "a"}, {"Name": "b"}], "PartialCredit": true}`},
+			{"20/puzzle.json", `{"Tiers": [{"Name": "ok", "Value": 0.5}, {"Name": "good", "Value": 0.75}]}`},
+			{"parts.txt", "10 a alpha\n10 b bravo\n20 ok fine\n20 good better\n"},
+		},
+	)
+	state := server.State.(*State)
+	now := time.Now()
+	afero.WriteFile(state, "multipliers.txt", []byte(fmt.Sprintf("web 3 %s %s\n", now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))), 0644)
+	server.refresh()
+	go slurp(state.refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	if err := handler.Register("team"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	for _, answer := range []string{"alpha", "bravo", "fine", "better"} {
+		if _, err := handler.SubmitAnswer("web", answer2points(answer), answer); err != nil {
+			t.Error(answer, err)
+		}
+		server.refresh()
+	}
+	scores := make(map[int]int)
+	for _, awd := range server.State.PointsLog() {
+		if awd.Score < 0 {
+			t.Error("Negative score:", awd)
+		}
+		scores[awd.Points] += awd.Score
+	}
+	if scores[10] != 30 {
+		t.Error("Wrong score for every part under a multiplier:", server.State.PointsLog())
+	}
+	if scores[20] != 45 {
+		t.Error("Wrong score for an upgraded tier under a multiplier:", server.State.PointsLog())
+	}
+}
+
+// answer2points says which puzzle TestMultipliedParts answers are for.
+func answer2points(answer string) int {
+	if (answer == "alpha") || (answer == "bravo") {
+		return 10
+	}
+	return 20
+}
+
+func TestHideAnswerHashes(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"hashegory",
+		[]testFileContents{
+			{"1/puzzle.json", `{"AnswerHashes": ["abcd"], "AnswerSalt": "salt", "Parts": [{"Name": "a", "AnswerHashes": ["1234"]}], "Moo": "cow"}`},
+		},
+	)
+	server.Config.HideAnswerHashes = true
+	server.refresh()
+
+	handler := server.NewHandler(TestTeamID)
+	r, _, err := handler.PuzzlesOpen("hashegory", 1, "puzzle.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	buf, _ := ioutil.ReadAll(r)
+	if string(buf) != `{"HideAnswerHashes":true,"Moo":"cow","Parts":[{"Name":"a"}]}` {
+		t.Error("Answer hashes not hidden:", string(buf))
+	}
+}
+
+func TestLocalizedPuzzles(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"lingogory",
+		[]testFileContents{
+			{"1/puzzle.json", `{"Body": "Moo?", "Locales": ["es", "pt-br"]}`},
+			{"1/puzzle.es.json", `{"Body": "¿Mu?", "Locales": ["es", "pt-br"]}`},
+			{"1/puzzle.pt-br.json", `{"Body": "Mu?", "Locales": ["es", "pt-br"]}`},
+		},
+	)
+	server.refresh()
+	handler := server.NewHandler(TestTeamID)
+
+	cases := []struct {
+		locales []string
+		body    string
+	}{
+		{nil, "Moo?"},
+		{[]string{"es"}, "¿Mu?"},
+		{[]string{"fr", "pt-br", "pt", "es"}, "Mu?"},
+		{[]string{"fr"}, "Moo?"},
+	}
+	for _, c := range cases {
+		r, _, err := handler.PuzzlesOpenLocalized("lingogory", 1, "puzzle.json", c.locales)
+		if err != nil {
+			t.Fatal(err)
+		}
+		puzzle := transpile.Puzzle{}
+		err = json.NewDecoder(r).Decode(&puzzle)
+		r.Close()
+		if err != nil {
+			t.Error(err)
+		} else if puzzle.Body != c.body {
+			t.Error("Wrong body for", c.locales, puzzle.Body)
+		}
+	}
+}
+
+func TestTimedPuzzle(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"timegory",
+		[]testFileContents{
+			{"puzzles.txt", "10\n"},
+			{"answers.txt", "10 ten\n"},
+			{"10/puzzle.json", `{"TimeLimit": 600, "SpeedBonus": 0.5, "LatePenalty": 0.5}`},
+		},
+	)
+	afero.WriteFile(server.State.(*State), "teamids.txt", []byte("teamID\nlateTeam\n"), 0644)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	late := server.NewHandler("lateTeam")
+	handler.Register("fast")
+	late.Register("slow")
+	server.refresh()
+
+	if r, _, err := handler.PuzzlesOpen("timegory", 10, "puzzle.json"); err != nil {
+		t.Fatal(err)
+	} else {
+		r.Close()
+	}
+	if opened, _ := server.State.TeamOpened(TestTeamID); opened["timegory"][10].IsZero() {
+		t.Error("Puzzle load not recorded:", opened)
+	}
+
+	if err := handler.CheckAnswer("timegory", 10, "ten"); err != nil {
+		t.Fatal(err)
+	}
+	// This team never loaded the puzzle, so it's late
+	if err := late.CheckAnswer("timegory", 10, "ten"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+
+	scores := make(map[string]int)
+	for _, awd := range server.State.PointsLog() {
+		scores[awd.TeamID] = awd.Score
+	}
+	if scores[TestTeamID] != 15 {
+		t.Error("Wrong score with speed bonus:", scores[TestTeamID])
+	}
+	if scores["lateTeam"] != 5 {
+		t.Error("Wrong score with late penalty:", scores["lateTeam"])
+	}
+}
+
+func TestTimedParts(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"timegory",
+		[]testFileContents{
+			{"puzzles.txt", "20\n"},
+			{"parts.txt", "20 a alpha\n20 b bravo\n"},
+			{"20/puzzle.json", `{"Parts": [{"Name": "a"}, {"Name": "b"}], "PartialCredit": true, "TimeLimit": 600, "SpeedBonus": 1, "LatePenalty": 0.5}`},
+		},
+	)
+	state := server.State.(*State)
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\nlateTeam\n"), 0644)
+	server.refresh()
+	go slurp(state.refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	late := server.NewHandler("lateTeam")
+	handler.Register("fast")
+	late.Register("slow")
+	server.refresh()
+
+	// Loaded 20 minutes ago, but the event was paused for 15 of them
+	now := time.Now()
+	state.Mkdir("opened", 0755)
+	afero.WriteFile(state, "opened/teamID", []byte(fmt.Sprintf("%d 20 timegory\n", now.Add(-20*time.Minute).Unix())), 0644)
+	afero.WriteFile(state, "pauses.txt", []byte(fmt.Sprintf("%s %s\n", now.Add(-16*time.Minute).Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339))), 0644)
+
+	for _, answer := range []string{"alpha", "bravo"} {
+		if err := handler.CheckAnswer("timegory", 20, answer); err != nil {
+			t.Fatal(err)
+		}
+		if err := late.CheckAnswer("timegory", 20, answer); err != nil {
+			t.Fatal(err)
+		}
+		server.refresh()
+	}
+
+	scores := make(map[string]int)
+	for _, awd := range server.State.PointsLog() {
+		if awd.Score < 0 {
+			t.Error("Negative score:", awd)
+		}
+		scores[awd.TeamID] += awd.Score
+	}
+	if scores[TestTeamID] != 40 {
+		t.Error("Wrong score with speed bonus:", server.State.PointsLog())
+	}
+	if scores["lateTeam"] != 10 {
+		t.Error("Wrong score with late penalty:", server.State.PointsLog())
+	}
+}
+
+func TestAnswerCooldown(t *testing.T) {
+	server := NewTestServer()
+	server.Config.WrongAnswers = 2
+	server.Config.AnswerCooldown = time.Hour
+	go slurp(server.State.(*State).refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	if limit, ok := handler.AnswerLimit("pategory", 1); !ok || (limit != AnswerLimit{Remaining: 2}) {
+		t.Error("Wrong limit before answering:", limit, ok)
+	}
+	for i := 0; i < 2; i++ {
+		if err := handler.CheckAnswer("pategory", 1, "wrong"); err != ErrIncorrectAnswer {
+			t.Fatal(err)
+		}
+	}
+	if limit, _ := handler.AnswerLimit("pategory", 1); (limit.Remaining != 2) || (limit.Cooldown != 3600) {
+		t.Error("Wrong limit after first lockout:", limit)
+	}
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != ErrCoolingDown {
+		t.Error("Answer accepted during cooldown:", err)
+	}
+	if limit, _ := handler.AnswerLimit("pategory", 2); limit.Cooldown != 0 {
+		t.Error("Cooldown applies to other puzzles:", limit)
+	}
+
+	answer := map[string]interface{}{"id": TestTeamID, "cat": "pategory", "points": 1, "answer": "answer123"}
+	if r := hs.TestAPIv2Request(http.MethodPost, "/v2/answer", answer); r.Code != http.StatusTooManyRequests {
+		t.Error("Wrong status during cooldown:", r.Code, r.Body.String())
+	} else if r.Header().Get("Retry-After") != "3600" {
+		t.Error("Wrong Retry-After:", r.Header().Get("Retry-After"))
+	} else if !strings.Contains(r.Body.String(), `"remaining":2,"cooldown":3600`) {
+		t.Error("Limit not in response:", r.Body.String())
+	}
+
+	// Two hours later, the cooldown is over, and the next one is twice as long
+	past := time.Now().Add(-2 * time.Hour).Unix()
+	afero.WriteFile(server.State.(*State), "wrong/"+TestTeamID, []byte(fmt.Sprintf("%d 1 pategory\n%d 1 pategory\n", past, past)), 0644)
+	if limit, _ := handler.AnswerLimit("pategory", 1); (limit.Remaining != 2) || (limit.Cooldown != 0) {
+		t.Error("Cooldown didn't end:", limit)
+	}
+	handler.CheckAnswer("pategory", 1, "wrong")
+	if limit, _ := handler.AnswerLimit("pategory", 1); limit.Remaining != 1 {
+		t.Error("Wrong remaining answers:", limit)
+	}
+	handler.CheckAnswer("pategory", 1, "wrong")
+	if limit, _ := handler.AnswerLimit("pategory", 1); limit.Cooldown != 7200 {
+		t.Error("Second cooldown didn't double:", limit)
+	}
+
+	// Handlers see the configuration as it was when they were made
+	server.Config.WrongAnswers = 0
+	handler = server.NewHandler(TestTeamID)
+	if _, ok := handler.AnswerLimit("pategory", 1); ok {
+		t.Error("Answers limited with no limit set")
+	}
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Error("Answer refused with no limit set:", err)
+	}
+}
+
+func TestDecoy(t *testing.T) {
+	server := NewTestServer()
+	server.Config.DecoyAfter = 2
+	server.Config.DecoyDelay = 100 * time.Millisecond
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	// Old wrong answers don't count
+	past := time.Now().Add(-2 * time.Hour).Unix()
+	afero.WriteFile(state, "wrong/"+TestTeamID, []byte(fmt.Sprintf("%d 1 pategory\n%d 1 pategory\n%d 1 pategory\n", past, past, past)), 0644)
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if err := handler.CheckAnswer("pategory", 1, "wrong"); err != ErrIncorrectAnswer {
+			t.Fatal(err)
+		}
+		delayed := time.Since(start) >= server.Config.DecoyDelay
+		if delayed != (i == 2) {
+			t.Errorf("Wrong answer %d delayed: %v", i+1, delayed)
+		}
+	}
+
+	bruteforce := 0
+	for len(state.eventStream) > 0 {
+		if event := <-state.eventStream; event[1] == "bruteforce" {
+			bruteforce++
+			if (event[2] != TestTeamID) || (event[len(event)-1] != "3") {
+				t.Error("Wrong event:", event)
+			}
+		}
+	}
+	if bruteforce != 1 {
+		t.Error("Wrong number of bruteforce events:", bruteforce)
+	}
+
+	// Giving up on the request stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	cancelled := handler.WithContext(ctx)
+	cancelled.CheckAnswer("pategory", 1, "wrong")
+	if time.Since(start) >= server.Config.DecoyDelay {
+		t.Error("Delayed answer to a cancelled request")
+	}
+
+	// Other puzzles aren't affected
+	start = time.Now()
+	handler.CheckAnswer("pategory", 2, "wrong")
+	if time.Since(start) >= server.Config.DecoyDelay {
+		t.Error("Delayed answer to another puzzle")
+	}
+}
+
+func TestFlagFormat(t *testing.T) {
+	server := NewTestServer()
+	state := server.State.(*State)
+	afero.WriteFile(state, "flagformats.txt", []byte("# comment\n* moth\\{.*\\}\npategory [a-z]+[0-9]+\nbroken (\n"), 0644)
+	go slurp(state.refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	if formats := server.State.FlagFormats(); len(formats) != 2 {
+		t.Error("Wrong flag formats:", formats)
+	}
+	if export := handler.ExportState(); export.FlagFormats["pategory"] != "[a-z]+[0-9]+" {
+		t.Error("Flag formats not exported:", export.FlagFormats)
+	}
+	if re := handler.flagFormat("other"); (re == nil) || !re.MatchString("moth{x}") || re.MatchString("moth{x} ") {
+		t.Error("Wrong default flag format:", re)
+	}
+
+	if err := handler.CheckAnswer("pategory", 1, "moth{answer123}"); err != ErrMalformedAnswer {
+		t.Error("Malformed answer not refused:", err)
+	}
+	if wrong, _ := server.State.TeamWrongAnswers(TestTeamID); len(wrong) != 0 {
+		t.Error("Malformed answer counted as wrong:", wrong)
+	}
+	if err := handler.CheckAnswer("pategory", 1, "wrong1"); err != ErrIncorrectAnswer {
+		t.Error("Well-formed wrong answer:", err)
+	}
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Error("Well-formed right answer:", err)
+	}
+}
+
+func TestQuizPuzzle(t *testing.T) {
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"quizegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n"},
+			{"answers.txt", "1 [\"80\"]\n1 [\"Domain Name System\",\"DNS\"]\n"},
+			{"checkers.txt", "1 quiz\n"},
+			{"1/puzzle.json", `{"Questions": [{"Text": "Port?", "Choices": ["80", "443"]}, {"Text": "DNS?"}]}`},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	if err := handler.CheckAnswer("quizegory", 1, `["443", "DNS"]`); err != ErrIncorrectAnswer {
+		t.Error("Wrong quiz answers accepted:", err)
+	}
+	if err := handler.CheckAnswer("quizegory", 1, `80`); err != ErrIncorrectAnswer {
+		t.Error("Unstructured quiz answer accepted:", err)
+	}
+	if err := handler.CheckAnswer("quizegory", 1, `["80", "dns"]`); err != nil {
+		t.Error("Right quiz answers refused:", err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// ServiceCheckTimeout is how long a service has to answer a health check.
+const ServiceCheckTimeout = 5 * time.Second
+
+// serviceCookie remembers which team is using a proxied service,
+// since links within the service's pages don't carry the team ID.
+const serviceCookie = "moth-service-id"
+
+// ServiceStatus is what the last health check of a puzzle's service found.
+type ServiceStatus struct {
+	Up bool
+
+	// Checked is when the service was checked, in Unix seconds
+	Checked int64
+
+	// Error says why the service is down
+	Error string `json:",omitempty"`
+}
+
+// ServiceMonitor keeps an eye on the network services puzzles declare.
+type ServiceMonitor struct {
+	server *MothServer
+	client *http.Client
+
+	lock     sync.RWMutex
+	services map[string]map[int]transpile.PuzzleService
+	statuses map[string]map[int]ServiceStatus
+}
+
+// NewServiceMonitor returns a new ServiceMonitor for the puzzles on server.
+func NewServiceMonitor(server *MothServer) *ServiceMonitor {
+	return &ServiceMonitor{
+		server: server,
+		client: &http.Client{
+			Timeout: ServiceCheckTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		services: make(map[string]map[int]transpile.PuzzleService),
+		statuses: make(map[string]map[int]ServiceStatus),
+	}
+}
+
+// Maintain checks every service every updateInterval.
+func (sm *ServiceMonitor) Maintain(updateInterval time.Duration) {
+	sm.Check()
+	for range time.NewTicker(updateInterval).C {
+		sm.Check()
+	}
+}
+
+// Check finds every puzzle's service, and checks them all.
+func (sm *ServiceMonitor) Check() {
+	services := sm.findServices()
+
+	statuses := make(map[string]map[int]ServiceStatus)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for cat, byPoints := range services {
+		statuses[cat] = make(map[int]ServiceStatus)
+		for points, service := range byPoints {
+			wg.Add(1)
+			go func(cat string, points int, service transpile.PuzzleService) {
+				defer wg.Done()
+				status := sm.check(service)
+				if !status.Up {
+					slog.Warn("service down", "category", cat, "points", points, "address", service.Address(), "error", status.Error)
+				}
+				lock.Lock()
+				statuses[cat][points] = status
+				lock.Unlock()
+			}(cat, points, service)
+		}
+	}
+	wg.Wait()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.services = services
+	sm.statuses = statuses
+}
+
+// findServices returns the service of every puzzle that has one.
+func (sm *ServiceMonitor) findServices() map[string]map[int]transpile.PuzzleService {
+	services := make(map[string]map[int]transpile.PuzzleService)
+	forEachPuzzle(sm.server, func(cat string, points int, puzzle transpile.Puzzle) {
+		if puzzle.Service == nil {
+			return
+		}
+		if services[cat] == nil {
+			services[cat] = make(map[int]transpile.PuzzleService)
+		}
+		services[cat][points] = *puzzle.Service
+	})
+	return services
+}
+
+// forEachPuzzle calls fn with every puzzle on server, locked or not.
+// If more than one provider has a puzzle, only the first one's is used.
+func forEachPuzzle(server *MothServer, fn func(cat string, points int, puzzle transpile.Puzzle)) {
+	seen := make(map[string]map[int]bool)
+	for _, provider := range server.PuzzleProviders {
+		for _, category := range provider.Inventory() {
+			if seen[category.Name] == nil {
+				seen[category.Name] = make(map[int]bool)
+			}
+			for _, points := range category.Puzzles {
+				if seen[category.Name][points] {
+					continue
+				}
+				f, _, err := provider.Open(category.Name, points, "puzzle.json")
+				if err != nil {
+					continue
+				}
+				puzzle := transpile.Puzzle{}
+				err = json.NewDecoder(f).Decode(&puzzle)
+				f.Close()
+				if err != nil {
+					continue
+				}
+				seen[category.Name][points] = true
+				fn(category.Name, points, puzzle)
+			}
+		}
+	}
+}
+
+// check checks whether service is up.
+func (sm *ServiceMonitor) check(service transpile.PuzzleService) ServiceStatus {
+	status := ServiceStatus{Checked: time.Now().Unix()}
+	if service.HealthCheck == "" {
+		conn, err := net.DialTimeout("tcp", service.Address(), ServiceCheckTimeout)
+		if err != nil {
+			status.Error = err.Error()
+			return status
+		}
+		conn.Close()
+		status.Up = true
+		return status
+	}
+
+	resp, err := sm.client.Get("http://" + service.Address() + service.HealthCheck)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		status.Error = resp.Status
+		return status
+	}
+	status.Up = true
+	return status
+}
+
+// Status returns what the last check of a puzzle's service found.
+// It returns false if the puzzle doesn't have a service, or it hasn't been checked yet.
+func (sm *ServiceMonitor) Status(cat string, points int) (ServiceStatus, bool) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	status, ok := sm.statuses[cat][points]
+	return status, ok
+}
+
+// Service returns a puzzle's service.
+func (sm *ServiceMonitor) Service(cat string, points int) (transpile.PuzzleService, bool) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	service, ok := sm.services[cat][points]
+	return service, ok
+}
+
+// serviceStatuses returns the status of the service of every puzzle in puzzles that has one.
+func (sm *ServiceMonitor) serviceStatuses(puzzles map[string][]int) map[string]map[int]ServiceStatus {
+	ret := make(map[string]map[int]ServiceStatus)
+	for cat, pointsList := range puzzles {
+		for _, points := range pointsList {
+			if status, ok := sm.Status(cat, points); ok {
+				if ret[cat] == nil {
+					ret[cat] = make(map[int]ServiceStatus)
+				}
+				ret[cat][points] = status
+			}
+		}
+	}
+	return ret
+}
+
+// ServiceHandler passes requests through to a puzzle's service,
+// if the puzzle asks for that, and the team has unlocked it.
+//
+// The path is /service/{category}/{points}/{path on the service}.
+// The team ID comes from the session cookie, or the query string,
+// or a cookie set the first time,
+// so that the request body is passed through untouched.
+func (h *HTTPServer) ServiceHandler(w http.ResponseWriter, req *http.Request) {
+	parts := strings.SplitN(req.URL.Path[len(h.base)+1:], "/", 4)
+	if len(parts) < 3 {
+		http.NotFound(w, req)
+		return
+	}
+	// parts[0] == "service"
+	cat := parts[1]
+	points, _ := strconv.Atoi(parts[2])
+	rest := "/"
+	if len(parts) == 4 {
+		rest += parts[3]
+	}
+	prefix := fmt.Sprintf("%s/service/%s/%d/", h.base, cat, points)
+
+	if h.server.Services == nil {
+		http.NotFound(w, req)
+		return
+	}
+	service, ok := h.server.Services.Service(cat, points)
+	if !ok || !service.Proxy {
+		http.NotFound(w, req)
+		return
+	}
+
+	teamID := h.requestTeamID(w, req, req.URL.Query().Get("id"))
+	fromCookie := false
+	if teamID == "" {
+		if cookie, err := req.Cookie(serviceCookie); err == nil {
+			teamID = cookie.Value
+			fromCookie = true
+		}
+	}
+	mh := h.newRequestHandler(req, teamID)
+	if _, err := mh.State.TeamName(mh.teamID); err != nil {
+		http.Error(w, ErrInvalidTeamID.Error(), http.StatusForbidden)
+		return
+	}
+	if !mh.unlocked(cat, points) {
+		http.Error(w, ErrPuzzleLocked.Error(), http.StatusForbidden)
+		return
+	}
+	if !fromCookie {
+		http.SetCookie(w, &http.Cookie{
+			Name:     serviceCookie,
+			Value:    mh.teamID,
+			Path:     prefix,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	target := &url.URL{Scheme: "http", Host: service.Address()}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+			r.Out.URL.Path = rest
+			r.Out.URL.RawPath = ""
+
+			// The service doesn't need to know the team ID
+			query := r.Out.URL.Query()
+			query.Del("id")
+			r.Out.URL.RawQuery = query.Encode()
+			r.Out.Header.Del("Cookie")
+			for _, cookie := range r.In.Cookies() {
+				if (cookie.Name != serviceCookie) && (cookie.Name != SessionCookie) {
+					r.Out.AddCookie(cookie)
+				}
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			mh.log.Warn("proxying to service", "category", cat, "points", points, "error", err)
+			http.Error(w, "service unavailable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, req)
+}
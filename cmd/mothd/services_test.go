@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServices(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/health":
+			fmt.Fprint(w, "ok")
+		default:
+			fmt.Fprintf(w, "path=%s query=%s cookies=%d", req.URL.Path, req.URL.RawQuery, len(req.Cookies()))
+		}
+	}))
+	defer service.Close()
+	host, port, _ := net.SplitHostPort(service.Listener.Addr().String())
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	server := NewTestServer()
+	server.PuzzleProviders[0].(*Mothballs).createMothballWithFiles(
+		"servegory",
+		[]testFileContents{
+			{"puzzles.txt", "1\n2\n"},
+			{"answers.txt", "1 one\n2 two\n"},
+			{"1/puzzle.json", fmt.Sprintf(`{"Service": {"Host": "%s", "Port": %s, "HealthCheck": "/health", "Proxy": true}}`, host, port)},
+			{"2/puzzle.json", fmt.Sprintf(`{"Service": {"Host": "127.0.0.1", "Port": %d}}`, closedPort)},
+		},
+	)
+	server.refresh()
+	go slurp(server.State.(*State).refreshNow)
+	server.Services = NewServiceMonitor(server.MothServer)
+	server.Services.Check()
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if status, ok := server.Services.Status("servegory", 1); !ok || !status.Up {
+		t.Error("Service should be up:", status, ok)
+	}
+	if status, ok := server.Services.Status("servegory", 2); !ok || status.Up || (status.Error == "") {
+		t.Error("Service should be down:", status, ok)
+	}
+	if _, ok := server.Services.Status("pategory", 1); ok {
+		t.Error("Puzzle without a service has a status")
+	}
+
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if r := get("/service/servegory/1/hello?id=" + TestTeamID); r.Code != http.StatusForbidden {
+		t.Error("Unregistered team used service:", r.Code, r.Body.String())
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	export := handler.ExportState()
+	if len(export.Services["servegory"]) != 1 || !export.Services["servegory"][1].Up {
+		t.Error("Wrong services exported:", export.Services)
+	}
+
+	r := get("/service/servegory/1/hello?id=" + TestTeamID + "&x=1")
+	if body := r.Body.String(); body != "path=/hello query=x=1 cookies=0" {
+		t.Error("Wrong proxied response:", r.Code, body)
+	}
+	cookies := r.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("Team cookie not set:", cookies)
+	}
+	if r := get("/service/servegory/1/again", cookies[0], &http.Cookie{Name: "session", Value: "s"}); r.Body.String() != "path=/again query= cookies=1" {
+		t.Error("Wrong proxied response with cookies:", r.Body.String())
+	}
+	if r := get("/service/servegory/2/?id=" + TestTeamID); r.Code != http.StatusNotFound {
+		t.Error("Service that isn't proxied:", r.Code)
+	}
+	if r := get("/service/servegory/1/hello"); !strings.Contains(r.Body.String(), ErrInvalidTeamID.Error()) {
+		t.Error("Service used without a team:", r.Code, r.Body.String())
+	}
+}
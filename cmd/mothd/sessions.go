@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/spf13/afero"
+)
+
+// SessionCookie carries a team's signed session token.
+const SessionCookie = "moth-session"
+
+// SessionKeyFile holds the key session tokens are signed with.
+const SessionKeyFile = "session.key"
+
+// RevokedSessionsFile lists teams whose sessions were revoked,
+// one "teamID time" per line.
+// Sessions started before that time don't work.
+const RevokedSessionsFile = "revoked-sessions.txt"
+
+// EndedSessionsFile lists sessions ended by logging out, or by rotation,
+// one "nonce after expires" per line.
+// Sessions are forgotten once they'd have stopped working anyway.
+const EndedSessionsFile = "ended-sessions.txt"
+
+// SessionGrace is how long a session token keeps working after it's been rotated,
+// so requests already on their way with it aren't refused.
+const SessionGrace = time.Minute
+
+// SessionRevokedRefresh is how often the lists of revoked and ended sessions are read again,
+// to pick up revocations and logouts made by other frontends.
+const SessionRevokedRefresh = 10 * time.Second
+
+// ErrInvalidSession means a session can't be ended, because it has no nonce.
+var ErrInvalidSession = errors.New("invalid session")
+
+// SessionKey returns the key session tokens are signed with,
+// making one if there isn't one yet.
+func (s *State) SessionKey() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if buf, err := afero.ReadFile(s, SessionKeyFile); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(buf)))
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := s.writeFileAtomic(SessionKeyFile, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RevokedSessions returns when each team's sessions were last revoked.
+func (s *State) RevokedSessions() map[string]time.Time {
+	ret := make(map[string]time.Time)
+	f, err := s.Open(RevokedSessionsFile)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		when, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		ret[fields[0]] = time.Unix(when, 0)
+	}
+	return ret
+}
+
+// RevokeSessions ends every session a team has started so far.
+func (s *State) RevokeSessions(teamID string) error {
+	if (teamID == "") || strings.ContainsAny(teamID, " \t\n") {
+		return ErrInvalidTeamID
+	}
+	s.lock.Lock()
+	revoked := s.RevokedSessions()
+	revoked[teamID] = time.Now()
+	teamIDs := make([]string, 0, len(revoked))
+	for id := range revoked {
+		teamIDs = append(teamIDs, id)
+	}
+	sort.Strings(teamIDs)
+	buf := new(strings.Builder)
+	for _, id := range teamIDs {
+		fmt.Fprintln(buf, id, revoked[id].Unix())
+	}
+	err := s.writeFileAtomic(RevokedSessionsFile, []byte(buf.String()))
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	s.LogEvent("revoke", teamID, "", 0)
+	return nil
+}
+
+// EndedSessions returns the sessions that have been ended,
+// by nonce.
+func (s *State) EndedSessions() map[string]EndedSession {
+	ret := make(map[string]EndedSession)
+	f, err := s.Open(EndedSessionsFile)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		after, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		expires, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		ret[fields[0]] = EndedSession{
+			Nonce:   fields[0],
+			After:   time.Unix(after, 0),
+			Expires: time.Unix(expires, 0),
+		}
+	}
+	return ret
+}
+
+// EndSession records that a session stops working after e.After.
+func (s *State) EndSession(e EndedSession) error {
+	if (e.Nonce == "") || strings.ContainsAny(e.Nonce, " \t\n") {
+		return ErrInvalidSession
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ended := s.EndedSessions()
+	ended[e.Nonce] = e
+	now := time.Now()
+	nonces := make([]string, 0, len(ended))
+	for nonce, e := range ended {
+		if now.Before(e.Expires) {
+			nonces = append(nonces, nonce)
+		}
+	}
+	sort.Strings(nonces)
+	buf := new(strings.Builder)
+	for _, nonce := range nonces {
+		fmt.Fprintln(buf, nonce, ended[nonce].After.Unix(), ended[nonce].Expires.Unix())
+	}
+	return s.writeFileAtomic(EndedSessionsFile, []byte(buf.String()))
+}
+
+// session is what a session token says.
+type session struct {
+	TeamID string
+	Issued time.Time
+	Nonce  string
+
+	// MemberID is the member of the team who logged in,
+	// or empty if the team's owner did, with the team ID
+	MemberID string
+}
+
+// EndedSession is a session ended by logging out, or by rotation.
+type EndedSession struct {
+	Nonce   string
+	After   time.Time // the session stops working after this
+	Expires time.Time // the session would have stopped working anyway
+}
+
+// SessionManager issues and checks signed session cookies,
+// so the team ID doesn't have to be sent with every request.
+//
+// A session lasts Config.SessionLifetime.
+// Once it's Config.SessionRotate old, it's swapped for a new one.
+type SessionManager struct {
+	server *MothServer
+
+	lock        sync.Mutex
+	key         []byte
+	revoked     map[string]time.Time
+	ended       map[string]EndedSession
+	revokedRead time.Time // when revoked and ended were last read
+}
+
+// NewSessionManager returns a SessionManager for server.
+func NewSessionManager(server *MothServer) *SessionManager {
+	return &SessionManager{
+		server: server,
+		ended:  make(map[string]EndedSession),
+	}
+}
+
+// signingKey returns the key tokens are signed with.
+// The caller must hold sm.lock.
+func (sm *SessionManager) signingKey() ([]byte, error) {
+	if sm.key == nil {
+		key, err := sm.server.State.SessionKey()
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf("empty session key")
+		}
+		sm.key = key
+	}
+	return sm.key, nil
+}
+
+// sign returns the signature of payload.
+func sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// token returns a new signed token for a session.
+func (sm *SessionManager) token(sess session) (string, error) {
+	sm.lock.Lock()
+	key, err := sm.signingKey()
+	sm.lock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	text := fmt.Sprintf("%s\n%d\n%s", sess.TeamID, sess.Issued.Unix(), sess.Nonce)
+	if sess.MemberID != "" {
+		text += "\n" + sess.MemberID
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(text))
+	return payload + "." + sign(key, payload), nil
+}
+
+// parse returns the session in token, if it's signed, and hasn't ended.
+func (sm *SessionManager) parse(token string, now time.Time) (session, bool) {
+	var sess session
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return sess, false
+	}
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	key, err := sm.signingKey()
+	if err != nil {
+		slog.Error("reading session key", "error", err)
+		return sess, false
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(key, payload))) {
+		return sess, false
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return sess, false
+	}
+	fields := strings.Split(string(buf), "\n")
+	if (len(fields) != 3) && (len(fields) != 4) {
+		return sess, false
+	}
+	issued, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return sess, false
+	}
+	sess = session{TeamID: fields[0], Issued: time.Unix(issued, 0), Nonce: fields[2]}
+	if len(fields) == 4 {
+		sess.MemberID = fields[3]
+	}
+
+	if now.Sub(sess.Issued) > sm.server.config().SessionLifetime {
+		return sess, false
+	}
+	if now.Sub(sm.revokedRead) > SessionRevokedRefresh {
+		sm.revoked = sm.server.State.RevokedSessions()
+		sm.ended = sm.server.State.EndedSessions()
+		sm.revokedRead = now
+	}
+	if e, ok := sm.ended[sess.Nonce]; ok && now.After(e.After) {
+		return sess, false
+	}
+	if when, ok := sm.revoked[sess.TeamID]; ok && !sess.Issued.After(when) {
+		return sess, false
+	}
+	return sess, true
+}
+
+// end stops a session working after a while,
+// on this frontend straight away, and on others once they next read the state.
+func (sm *SessionManager) end(sess session, after time.Time) {
+	e := EndedSession{
+		Nonce:   sess.Nonce,
+		After:   after,
+		Expires: sess.Issued.Add(sm.server.config().SessionLifetime),
+	}
+	if err := sm.server.State.EndSession(e); err != nil {
+		slog.Error("ending session", "error", err)
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.ended[sess.Nonce] = e
+}
+
+// revoke ends every session teamID has started so far.
+func (sm *SessionManager) revoke(teamID string) error {
+	if err := sm.server.State.RevokeSessions(teamID); err != nil {
+		return err
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	sm.revokedRead = time.Time{}
+	return nil
+}
+
+// cookiePath is the path session cookies are sent to.
+func (h *HTTPServer) cookiePath() string {
+	return h.base + "/"
+}
+
+// setSessionCookie sends a new session token for teamID,
+// logged in by memberID, if a member did.
+func (h *HTTPServer) setSessionCookie(w http.ResponseWriter, req *http.Request, teamID, memberID string) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		slog.Error("starting session", "error", err)
+		return
+	}
+	token, err := h.sessions.token(session{
+		TeamID:   teamID,
+		Issued:   time.Now(),
+		Nonce:    hex.EncodeToString(nonce),
+		MemberID: memberID,
+	})
+	if err != nil {
+		slog.Error("starting session", "error", err)
+		return
+	}
+	config := h.server.config()
+	sameSite, secure := http.SameSiteLaxMode, (req.TLS != nil)
+	if config.CORSCredentials {
+		// Browsers only send these cookies to other sites over HTTPS
+		sameSite, secure = http.SameSiteNoneMode, true
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     h.cookiePath(),
+		MaxAge:   int(config.SessionLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
+// clearSessionCookie tells the browser to forget its session token.
+func (h *HTTPServer) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    "",
+		Path:     h.cookiePath(),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// StartSession sends a session cookie for teamID, if sessions are on.
+// Call it once a team has shown it knows its team ID, by logging in,
+// or a member has shown their member token, with memberID.
+func (h *HTTPServer) StartSession(w http.ResponseWriter, req *http.Request, teamID, memberID string) {
+	if h.server.config().SessionLifetime > 0 {
+		h.setSessionCookie(w, req, teamID, memberID)
+	}
+}
+
+// resolveID returns the team id belongs to,
+// and the member, if id is a member token.
+// Anything else is taken to be a team ID.
+func (h *HTTPServer) resolveID(id string) (string, string) {
+	if id == "" {
+		return "", ""
+	}
+	if _, err := h.server.State.TeamName(id); err == nil {
+		return id, ""
+	}
+	if member, err := h.server.State.MemberByToken(id); err == nil {
+		return member.TeamID, member.ID
+	}
+	return id, ""
+}
+
+// requestTeamID returns the team making req,
+// like requestIdentity.
+func (h *HTTPServer) requestTeamID(w http.ResponseWriter, req *http.Request, id string) string {
+	teamID, _ := h.requestIdentity(w, req, id)
+	return teamID
+}
+
+// requestIdentity returns the team making req,
+// and the member of it, if a member is:
+// the ones in its session cookie, if it has a good one,
+// or else the ones id, sent with the request, belongs to.
+//
+// A session that's due for rotation gets a new cookie.
+// A team sending a registered id without a session is given one,
+// unless sessions are required, in which case id is ignored.
+// A member's session stops working once they're removed from the team.
+func (h *HTTPServer) requestIdentity(w http.ResponseWriter, req *http.Request, id string) (string, string) {
+	config := h.server.config()
+	if config.SessionLifetime <= 0 {
+		return h.resolveID(id)
+	}
+
+	if cookie, err := req.Cookie(SessionCookie); err == nil {
+		now := time.Now()
+		sess, ok := h.sessions.parse(cookie.Value, now)
+		if ok && (sess.MemberID != "") && !h.server.memberActive(sess.TeamID, sess.MemberID) {
+			ok = false
+		}
+		if ok {
+			if (config.SessionRotate > 0) && (now.Sub(sess.Issued) > config.SessionRotate) {
+				h.setSessionCookie(w, req, sess.TeamID, sess.MemberID)
+				h.sessions.end(sess, now.Add(SessionGrace))
+			}
+			return sess.TeamID, sess.MemberID
+		}
+		h.clearSessionCookie(w)
+	}
+
+	if config.SessionOnly {
+		return "", ""
+	}
+	teamID, memberID := h.resolveID(id)
+	if teamID != "" {
+		if _, err := h.server.State.TeamName(teamID); err == nil {
+			h.setSessionCookie(w, req, teamID, memberID)
+		}
+	}
+	return teamID, memberID
+}
+
+// LogoutHandler ends the session in the request's cookie.
+func (h *HTTPServer) LogoutHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if cookie, err := req.Cookie(SessionCookie); err == nil {
+		if sess, ok := h.sessions.parse(cookie.Value, time.Now()); ok {
+			h.sessions.end(sess, time.Now())
+		}
+	}
+	h.clearSessionCookie(w)
+	jsend.Sendf(w, jsend.Success, "logged out", "session ended")
+}
+
+// AdminRevokeHandler ends every session a team has started.
+func (h *HTTPServer) AdminRevokeHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if !requirePOST(w, req) {
+		return
+	}
+	teamID := req.FormValue("team")
+	if teamID == "" {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not revoked", "team is required")
+		return
+	}
+	if err := h.sessions.revoke(teamID); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not revoked", "%s", err.Error())
+		return
+	}
+	mh.log.Info("revoked sessions", "team", teamID)
+	jsend.Sendf(w, jsend.Success, "revoked", "sessions for %s revoked", teamID)
+}
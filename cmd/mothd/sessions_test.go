@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	server.Config.SessionLifetime = time.Hour
+	server.Config.SessionOnly = true
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	post := func(path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "Bearer sekrit")
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	sessionCookie := func(r *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range r.Result().Cookies() {
+			if cookie.Name == SessionCookie {
+				return cookie
+			}
+		}
+		return nil
+	}
+	// teamOf returns the team a request with cookie is made as
+	teamOf := func(cookie *http.Cookie, id string) string {
+		request := httptest.NewRequest(http.MethodGet, "/state", nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		return hs.requestTeamID(httptest.NewRecorder(), request, id)
+	}
+
+	r := post("/register", url.Values{"id": {TestTeamID}, "name": {"GoTeam"}}, nil)
+	cookie := sessionCookie(r)
+	if (cookie == nil) || !cookie.HttpOnly || (cookie.Path != "/") {
+		t.Fatal("No session cookie:", r.Result().Header)
+	}
+	state.refresh()
+
+	if r := post("/answer", url.Values{"cat": {"pategory"}, "points": {"1"}, "answer": {"answer123"}}, cookie); !strings.Contains(r.Body.String(), "success") {
+		t.Error("Session didn't work:", r.Body.String())
+	}
+	if teamID := teamOf(nil, TestTeamID); teamID != "" {
+		t.Error("Team ID accepted without a session:", teamID)
+	}
+
+	forged := *cookie
+	payload, sig, _ := strings.Cut(cookie.Value, ".")
+	forged.Value = strings.ToUpper(payload) + "." + sig
+	if teamID := teamOf(&forged, ""); teamID != "" {
+		t.Error("Forged session worked:", teamID)
+	}
+
+	post("/logout", url.Values{}, cookie)
+	if teamID := teamOf(cookie, ""); teamID != "" {
+		t.Error("Session worked after logging out")
+	}
+
+	// Other frontends, and this one after a restart, know about the logout too
+	other := NewHTTPServer("/", server.MothServer)
+	request := httptest.NewRequest(http.MethodGet, "/state", nil)
+	request.AddCookie(cookie)
+	if teamID := other.requestTeamID(httptest.NewRecorder(), request, ""); teamID != "" {
+		t.Error("Session worked on another frontend after logging out")
+	}
+
+	// Logging in again starts a new session
+	r = post("/register", url.Values{"id": {TestTeamID}, "name": {"GoTeam"}}, nil)
+	cookie = sessionCookie(r)
+	if teamID := teamOf(cookie, ""); teamID != TestTeamID {
+		t.Fatal("Wrong team for new session:", teamID)
+	}
+
+	// Rotation hands out a new cookie, and the old one lasts a little longer
+	server.Config.SessionRotate = time.Nanosecond
+	recorder := httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/state", nil)
+	request.AddCookie(cookie)
+	if teamID := hs.requestTeamID(recorder, request, ""); teamID != TestTeamID {
+		t.Error("Wrong team rotating session:", teamID)
+	}
+	rotated := sessionCookie(recorder)
+	if (rotated == nil) || (rotated.Value == cookie.Value) {
+		t.Fatal("Session not rotated")
+	}
+	if teamID := teamOf(cookie, ""); teamID != TestTeamID {
+		t.Error("Rotated session stopped working before its grace period")
+	}
+	server.Config.SessionRotate = 0
+
+	if r := post("/admin/revoke", url.Values{"team": {TestTeamID}}, nil); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if teamID := teamOf(rotated, ""); teamID != "" {
+		t.Error("Session worked after being revoked")
+	}
+	if !state.RevokedSessions()[TestTeamID].After(time.Now().Add(-time.Minute)) {
+		t.Error("Revocation not saved:", state.RevokedSessions())
+	}
+}
+
+func TestSessionsMigrate(t *testing.T) {
+	server := NewTestServer()
+	server.Config.SessionLifetime = time.Hour
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	if r := hs.TestRequest("/state", nil); len(r.Result().Cookies()) > 0 {
+		t.Error("Unregistered team given a session:", r.Result().Cookies())
+	}
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	state.refresh()
+	if r := hs.TestRequest("/state", nil); len(r.Result().Cookies()) != 1 {
+		t.Error("Registered team not given a session")
+	}
+}
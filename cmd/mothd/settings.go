@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// MaxSettingChanges is how many changes to settings are remembered for /admin/config.
+// Every change is also in the event log.
+const MaxSettingChanges = 100
+
+// runtimeSetting is part of the configuration that may be changed while mothd is running.
+type runtimeSetting struct {
+	get func(c Configuration) string
+	set func(c *Configuration, value string) error
+}
+
+// runtimeSettings are the configuration settings /admin/config may change,
+// by the name of their command-line option.
+var runtimeSettings = map[string]runtimeSetting{
+	"devel": {
+		func(c Configuration) string { return strconv.FormatBool(c.Devel) },
+		func(c *Configuration, value string) (err error) {
+			c.Devel, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	"practice": {
+		func(c Configuration) string { return strconv.FormatBool(c.Practice) },
+		func(c *Configuration, value string) (err error) {
+			c.Practice, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	"scoring": {
+		func(c Configuration) string { return c.Scoring },
+		func(c *Configuration, value string) error {
+			c.Scoring = value
+			return ValidScoring(value)
+		},
+	},
+	"tie-break": {
+		func(c Configuration) string { return c.TieBreak },
+		func(c *Configuration, value string) error {
+			c.TieBreak = value
+			return ValidTieBreak(value)
+		},
+	},
+	"open-registration": {
+		func(c Configuration) string { return strconv.FormatBool(c.OpenRegistration) },
+		func(c *Configuration, value string) (err error) {
+			c.OpenRegistration, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	"max-teams": {
+		func(c Configuration) string { return strconv.Itoa(c.MaxTeams) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.MaxTeams = n
+			return err
+		},
+	},
+	"max-team-size": {
+		func(c Configuration) string { return strconv.Itoa(c.MaxTeamSize) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.MaxTeamSize = n
+			return err
+		},
+	},
+	"hide-answer-hashes": {
+		func(c Configuration) string { return strconv.FormatBool(c.HideAnswerHashes) },
+		func(c *Configuration, value string) (err error) {
+			c.HideAnswerHashes, err = strconv.ParseBool(value)
+			return err
+		},
+	},
+	"wrong-answers": {
+		func(c Configuration) string { return strconv.Itoa(c.WrongAnswers) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.WrongAnswers = n
+			return err
+		},
+	},
+	"answer-cooldown": {
+		func(c Configuration) string { return c.AnswerCooldown.String() },
+		func(c *Configuration, value string) error {
+			d, err := time.ParseDuration(value)
+			if (err == nil) && (d < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.AnswerCooldown = d
+			return err
+		},
+	},
+	"decoy-after": {
+		func(c Configuration) string { return strconv.Itoa(c.DecoyAfter) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.DecoyAfter = n
+			return err
+		},
+	},
+	"decoy-delay": {
+		func(c Configuration) string { return c.DecoyDelay.String() },
+		func(c *Configuration, value string) error {
+			d, err := time.ParseDuration(value)
+			if (err == nil) && (d < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.DecoyDelay = d
+			return err
+		},
+	},
+	"upload-max-size": {
+		func(c Configuration) string { return strconv.FormatInt(c.UploadMaxSize, 10) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.UploadMaxSize = n
+			return err
+		},
+	},
+	"uploads-per-hour": {
+		func(c Configuration) string { return strconv.Itoa(c.UploadsPerHour) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.UploadsPerHour = n
+			return err
+		},
+	},
+	"max-downloads": {
+		func(c Configuration) string { return strconv.Itoa(c.MaxDownloads) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.Atoi(value)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.MaxDownloads = n
+			return err
+		},
+	},
+	"download-rate": {
+		func(c Configuration) string { return strconv.FormatInt(c.DownloadRate, 10) },
+		func(c *Configuration, value string) error {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if (err == nil) && (n < 0) {
+				err = fmt.Errorf("can't be negative")
+			}
+			c.DownloadRate = n
+			return err
+		},
+	},
+}
+
+// SettingChange records a change made through /admin/config.
+type SettingChange struct {
+	When    time.Time
+	Setting string
+	Old     string
+	New     string
+
+	// Remote is the address the change came from
+	Remote string
+
+	// Request is the ID of the HTTP request that made the change
+	Request string
+}
+
+// settingsAudit remembers the latest changes to settings.
+type settingsAudit struct {
+	lock    sync.RWMutex
+	changes []SettingChange // Oldest first
+}
+
+func newSettingsAudit() *settingsAudit {
+	return &settingsAudit{
+		changes: make([]SettingChange, 0),
+	}
+}
+
+func (sa *settingsAudit) add(change SettingChange) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.changes = append(sa.changes, change)
+	if len(sa.changes) > MaxSettingChanges {
+		sa.changes = sa.changes[len(sa.changes)-MaxSettingChanges:]
+	}
+}
+
+func (sa *settingsAudit) list() []SettingChange {
+	sa.lock.RLock()
+	defer sa.lock.RUnlock()
+	return append([]SettingChange{}, sa.changes...)
+}
+
+// config returns the server's configuration.
+//
+// Handlers get a copy when they're made,
+// so they see the same configuration from start to finish.
+func (s *MothServer) config() Configuration {
+	s.configLock.RLock()
+	defer s.configLock.RUnlock()
+	return s.Config
+}
+
+// Settings returns the value of every setting /admin/config may change.
+func (s *MothServer) Settings() (map[string]string, error) {
+	config := s.config()
+	ret := make(map[string]string, len(runtimeSettings)+2)
+	for name, setting := range runtimeSettings {
+		ret[name] = setting.get(config)
+	}
+	ret["paused"] = strconv.FormatBool(s.State.Paused())
+	schedule, err := s.State.Schedule()
+	ret["schedule"] = schedule
+	return ret, err
+}
+
+// ChangeSettings changes settings, by the name of their command-line option,
+// and returns what changed.
+//
+// "paused" pauses or resumes the event, like /admin/pause and /admin/resume,
+// and "schedule" replaces hours.txt.
+// Nothing is changed unless every new value makes sense.
+// Changes are recorded in the event log, and remembered for /admin/config.
+func (s *MothServer) ChangeSettings(values map[string]string, remote, request string) ([]SettingChange, error) {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+
+	old, err := s.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check everything before changing anything
+	config := s.config()
+	for name, value := range values {
+		if setting, ok := runtimeSettings[name]; ok {
+			if err := setting.set(&config, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		switch name {
+		case "paused":
+			if _, err := strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		case "schedule":
+			if err := CheckSchedule(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s can't be changed while mothd is running", name)
+		}
+	}
+
+	s.configLock.Lock()
+	s.Config = config
+	s.configLock.Unlock()
+	if value, ok := values["paused"]; ok {
+		paused, _ := strconv.ParseBool(value)
+		if paused && !s.State.Paused() {
+			err = s.State.Pause()
+		} else if !paused && s.State.Paused() {
+			err = s.State.Resume()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := values["schedule"]; ok && (value != old["schedule"]) {
+		if err := s.State.SetSchedule(value); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := s.Settings()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changes := make([]SettingChange, 0)
+	for _, name := range names {
+		if current[name] == old[name] {
+			continue
+		}
+		change := SettingChange{
+			When:    time.Now(),
+			Setting: name,
+			Old:     old[name],
+			New:     current[name],
+			Remote:  remote,
+			Request: request,
+		}
+		changes = append(changes, change)
+		s.settingChanges.add(change)
+		s.State.LogEvent("setting", "", "", 0, name, change.Old, change.New)
+		slog.Info("changed setting", "setting", name, "old", change.Old, "new", change.New, "remote", remote, "request", request)
+	}
+	return changes, nil
+}
+
+// AdminConfigHandler shows the settings that may be changed while mothd is running,
+// and the latest changes to them.
+//
+// POST changes them: each form field is a setting,
+// named like its command-line option.
+func (h *HTTPServer) AdminConfigHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "bad request", "%s", err.Error())
+			return
+		}
+		values := make(map[string]string, len(req.PostForm))
+		for name := range req.PostForm {
+			values[name] = req.PostForm.Get(name)
+		}
+		// Changed on the server itself, not the copy a traced handler has
+		if _, err := h.server.ChangeSettings(values, h.clientIP(req).String(), RequestID(req.Context())); err != nil {
+			jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, "not changed", "%s", err.Error())
+			return
+		}
+	}
+
+	settings, err := h.server.Settings()
+	if err != nil {
+		jsend.SendfStatus(w, http.StatusInternalServerError, jsend.Error, "error", "%s", err.Error())
+		return
+	}
+	jsend.Send(w, jsend.Success, struct {
+		Settings map[string]string
+		Changes  []SettingChange
+	}{settings, h.server.settingChanges.list()})
+}
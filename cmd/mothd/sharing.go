@@ -0,0 +1,208 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+// DefaultCloseSolveWindow is how close together two teams' solves of a puzzle
+// have to be for the sharing report to list them, unless asked otherwise.
+const DefaultCloseSolveWindow = 10 * time.Second
+
+// SharingDetector is an EventListener which watches for signs
+// that teams are sharing answers:
+// the same wrong answer to a puzzle from more than one team,
+// and more than one team playing from the same address.
+//
+// It only remembers what it's seen since the server started.
+type SharingDetector struct {
+	lock      sync.Mutex
+	wrong     map[puzzleID]map[string]map[string]bool // puzzle -> answer -> team names
+	addresses map[string]map[string]bool              // address -> team names
+}
+
+type puzzleID struct {
+	Category string
+	Points   int
+}
+
+// NewSharingDetector returns a new SharingDetector.
+func NewSharingDetector() *SharingDetector {
+	return &SharingDetector{
+		wrong:     make(map[puzzleID]map[string]map[string]bool),
+		addresses: make(map[string]map[string]bool),
+	}
+}
+
+// Notify records the address event came from,
+// and the answer, if it's a wrong answer.
+func (sd *SharingDetector) Notify(event Event) {
+	if event.TeamName == "" {
+		return
+	}
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+
+	if event.Remote != "" {
+		addSharingTeam(sd.addresses, event.Remote, event.TeamName)
+	}
+	if (event.Type == EventWrong) && (event.Answer != "") {
+		key := puzzleID{event.Category, event.Points}
+		if sd.wrong[key] == nil {
+			sd.wrong[key] = make(map[string]map[string]bool)
+		}
+		addSharingTeam(sd.wrong[key], event.Answer, event.TeamName)
+	}
+}
+
+func addSharingTeam(m map[string]map[string]bool, key string, teamName string) {
+	if m[key] == nil {
+		m[key] = make(map[string]bool)
+	}
+	m[key][teamName] = true
+}
+
+// SharedWrongAnswer is a wrong answer more than one team gave for a puzzle.
+type SharedWrongAnswer struct {
+	Category string
+	Points   int
+	Answer   string
+	Teams    []string
+}
+
+// CloseSolve is two teams solving a puzzle within a few seconds of each other.
+type CloseSolve struct {
+	Category string
+	Points   int
+	Teams    [2]string
+	Seconds  int64
+}
+
+// SharedAddress is an address more than one team played from.
+type SharedAddress struct {
+	Address string
+	Teams   []string
+}
+
+// SharingReport lists things that might mean teams are sharing answers.
+// None of them prove anything:
+// they're for organizers to look into.
+type SharingReport struct {
+	Generated          time.Time
+	SharedWrongAnswers []SharedWrongAnswer
+	CloseSolves        []CloseSolve
+	SharedAddresses    []SharedAddress
+}
+
+// NewSharingReport returns a report on possible answer sharing.
+//
+// Close solves, within window of each other, come from the points log in state.
+// Shared wrong answers and addresses come from sd,
+// and are left empty if sd is nil.
+func NewSharingReport(state StateProvider, sd *SharingDetector, window time.Duration) *SharingReport {
+	report := &SharingReport{
+		Generated:          time.Now(),
+		SharedWrongAnswers: []SharedWrongAnswer{},
+		CloseSolves:        closeSolves(state, window),
+		SharedAddresses:    []SharedAddress{},
+	}
+	if sd == nil {
+		return report
+	}
+
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	for key, answers := range sd.wrong {
+		for answer, teams := range answers {
+			if len(teams) > 1 {
+				report.SharedWrongAnswers = append(report.SharedWrongAnswers, SharedWrongAnswer{
+					Category: key.Category,
+					Points:   key.Points,
+					Answer:   answer,
+					Teams:    sortedTeams(teams),
+				})
+			}
+		}
+	}
+	sort.Slice(report.SharedWrongAnswers, func(i, j int) bool {
+		a, b := report.SharedWrongAnswers[i], report.SharedWrongAnswers[j]
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		if a.Points != b.Points {
+			return a.Points < b.Points
+		}
+		return a.Answer < b.Answer
+	})
+
+	for address, teams := range sd.addresses {
+		if len(teams) > 1 {
+			report.SharedAddresses = append(report.SharedAddresses, SharedAddress{
+				Address: address,
+				Teams:   sortedTeams(teams),
+			})
+		}
+	}
+	sort.Slice(report.SharedAddresses, func(i, j int) bool {
+		return report.SharedAddresses[i].Address < report.SharedAddresses[j].Address
+	})
+	return report
+}
+
+func sortedTeams(teams map[string]bool) []string {
+	ret := make([]string, 0, len(teams))
+	for teamName := range teams {
+		ret = append(ret, teamName)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// closeSolves returns pairs of teams that solved the same puzzle within window of each other.
+func closeSolves(state StateProvider, window time.Duration) []CloseSolve {
+	solves := make(map[puzzleID][]award.T)
+	for _, awd := range state.PointsLog() {
+		if awd.Part != "" {
+			continue
+		}
+		key := puzzleID{awd.Category, awd.Points}
+		solves[key] = append(solves[key], awd)
+	}
+
+	ret := make([]CloseSolve, 0)
+	for key, list := range solves {
+		sort.Slice(list, func(i, j int) bool { return list[i].When < list[j].When })
+		for i, a := range list {
+			for _, b := range list[i+1:] {
+				seconds := b.When - a.When
+				if seconds > int64(window/time.Second) {
+					break
+				}
+				if a.TeamID == b.TeamID {
+					continue
+				}
+				nameA, _ := state.TeamName(a.TeamID)
+				nameB, _ := state.TeamName(b.TeamID)
+				ret = append(ret, CloseSolve{
+					Category: key.Category,
+					Points:   key.Points,
+					Teams:    [2]string{nameA, nameB},
+					Seconds:  seconds,
+				})
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Category != ret[j].Category {
+			return ret[i].Category < ret[j].Category
+		}
+		if ret[i].Points != ret[j].Points {
+			return ret[i].Points < ret[j].Points
+		}
+		return ret[i].Seconds < ret[j].Seconds
+	})
+	return ret
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// closeOnExec does nothing on this platform,
+// which doesn't have systemd to pass us sockets.
+func closeOnExec(fd uintptr) {
+}
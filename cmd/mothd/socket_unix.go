@@ -0,0 +1,10 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// closeOnExec keeps commands we run from inheriting fd.
+func closeOnExec(fd uintptr) {
+	syscall.CloseOnExec(int(fd))
+}
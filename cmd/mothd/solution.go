@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// SolutionsFile lists puzzles whose solutions have been released,
+// one "category points" per line.
+const SolutionsFile = "solutions.txt"
+
+// ReleasedSolutions returns the puzzles whose solutions have been released,
+// from solutions.txt, as a list of point values for each category.
+func (s *State) ReleasedSolutions() map[string][]int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make(map[string][]int, len(s.solutions))
+	for cat, points := range s.solutions {
+		ret[cat] = append([]int{}, points...)
+	}
+	return ret
+}
+
+// ReleaseSolution lets every team read a puzzle's solution,
+// or, if released is false, withholds it again.
+func (s *State) ReleaseSolution(cat string, points int, released bool) error {
+	if strings.ContainsAny(cat, " \t\n") {
+		return fmt.Errorf("invalid category: %q", cat)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	solutions := s.readPuzzleList(SolutionsFile)
+	kept := make([]int, 0, len(solutions[cat])+1)
+	for _, p := range solutions[cat] {
+		if p != points {
+			kept = append(kept, p)
+		}
+	}
+	found := len(kept) < len(solutions[cat])
+	if found == released {
+		return nil
+	}
+	if released {
+		kept = append(kept, points)
+	}
+	if len(kept) == 0 {
+		delete(solutions, cat)
+	} else {
+		solutions[cat] = kept
+	}
+	if err := s.writePuzzleList(SolutionsFile, solutions); err != nil {
+		return err
+	}
+	s.solutions = solutions
+	s.revision++
+
+	event := "withhold"
+	if released {
+		event = "release"
+	}
+	s.LogEvent(event, "", cat, points)
+	return nil
+}
+
+// solutionReleased returns true if teams may read a puzzle's solution:
+// in development and practice mode, every solution is released.
+func (mh *MothRequestHandler) solutionReleased(cat string, points int) bool {
+	if mh.Config.Devel || mh.Config.Practice {
+		return true
+	}
+	return slices.Contains(mh.State.ReleasedSolutions()[cat], points)
+}
+
+// releasedSolutions returns the puzzles in puzzles
+// that come with a solution teams may read.
+func (mh *MothRequestHandler) releasedSolutions(puzzles map[string][]int) map[string][]int {
+	released := mh.Config.Devel || mh.Config.Practice
+	releasedSolutions := mh.State.ReleasedSolutions()
+	ret := make(map[string][]int)
+	for cat, solutions := range unlockedOnly(mh.PuzzleSolutions(), puzzles) {
+		for points := range solutions {
+			if released || slices.Contains(releasedSolutions[cat], points) {
+				ret[cat] = append(ret[cat], points)
+			}
+		}
+		slices.Sort(ret[cat])
+	}
+	return ret
+}
+
+// hasSolution returns true if a puzzle comes with a solution.
+func (mh *MothRequestHandler) hasSolution(cat string, points int) bool {
+	r, _, err := mh.openProvided(cat, points, transpile.SolutionFile)
+	if r != nil {
+		r.Close()
+	}
+	return err == nil
+}
+
+// AdminReleaseSolutionHandler lets every team read a puzzle's solution.
+func (h *HTTPServer) AdminReleaseSolutionHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	h.adminReleaseSolution(mh, w, req, true)
+}
+
+// AdminWithholdSolutionHandler withholds a released solution again.
+func (h *HTTPServer) AdminWithholdSolutionHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	h.adminReleaseSolution(mh, w, req, false)
+}
+
+// adminReleaseSolution releases or withholds the solution to the puzzle in the request.
+func (h *HTTPServer) adminReleaseSolution(mh MothRequestHandler, w http.ResponseWriter, req *http.Request, released bool) {
+	if !requirePOST(w, req) {
+		return
+	}
+	short, done := "not withheld", "withheld"
+	if released {
+		short, done = "not released", "released"
+	}
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, short, "cat and points are required")
+		return
+	}
+	if err := mh.State.ReleaseSolution(cat, points, released); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, short, "%s", err.Error())
+		return
+	}
+	mh.log.Info(done+" solution", "category", cat, "points", points)
+	jsend.Sendf(w, jsend.Success, done, "solution to %s %d %s", cat, points, done)
+}
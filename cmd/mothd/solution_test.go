@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+)
+
+func TestReleaseSolution(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers: [moo]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cows/1/solution.md", []byte("Say *moo*.\n"), 0644)
+	afero.WriteFile(fs, "cows/2/puzzle.md", []byte("---\nanswers: [moo]\n---\nHi.\n"), 0644)
+	state := NewTestState()
+	go slurp(state.refreshNow)
+	afero.WriteFile(state, "teamids.txt", []byte(TestTeamID+"\n"), 0644)
+	state.SetTeamName(TestTeamID, "Team One")
+	state.refresh()
+	srv := NewMothServer(Configuration{AdminToken: "sekrit"}, NewTestTheme(), state, NewTranspilerProvider(fs))
+	hs := NewHTTPServer("/", srv)
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	handler := srv.NewHandler(TestTeamID)
+	if _, _, err := handler.PuzzlesOpen("cows", 1, transpile.SolutionFile); err != ErrPuzzleLocked {
+		t.Error("Solution opened before it was released:", err)
+	}
+	if export := handler.ExportState(); export.Solutions != nil {
+		t.Error("Solutions listed before they were released:", export.Solutions)
+	}
+
+	if r := post("/admin/release-solution", url.Values{"cat": {"cows"}, "points": {"1"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if r, _, err := handler.PuzzlesOpen("cows", 1, transpile.SolutionFile); err != nil {
+		t.Error("Released solution can't be opened:", err)
+	} else {
+		r.Close()
+	}
+	if export := handler.ExportState(); !reflect.DeepEqual(export.Solutions, map[string][]int{"cows": {1}}) {
+		t.Error("Wrong solutions:", export.Solutions)
+	}
+	if solutions := state.ReleasedSolutions(); !reflect.DeepEqual(solutions, map[string][]int{"cows": {1}}) {
+		t.Error("Wrong released solutions:", solutions)
+	}
+
+	if r := post("/admin/withhold-solution", url.Values{"cat": {"cows"}, "points": {"1"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if _, _, err := handler.PuzzlesOpen("cows", 1, transpile.SolutionFile); err != ErrPuzzleLocked {
+		t.Error("Withheld solution opened:", err)
+	}
+	if solutions := state.ReleasedSolutions(); len(solutions) != 0 {
+		t.Error("Solutions still released:", solutions)
+	}
+
+	if r := post("/admin/release-solution", url.Values{"cat": {"cows"}}); r.Code != http.StatusBadRequest {
+		t.Error("Release without points:", r.Code, r.Body.String())
+	}
+}
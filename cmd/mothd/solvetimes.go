@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// SolveTime is how long a team took to solve a puzzle, after first loading it.
+type SolveTime struct {
+	TeamName string
+	Opened   time.Time
+	Solved   time.Time
+	Seconds  int64
+}
+
+// PuzzleSolveTimes is how long teams took to solve a puzzle.
+type PuzzleSolveTimes struct {
+	Category string
+	Points   int
+
+	// Opened is how many teams loaded the puzzle,
+	// and Solved is how many solved it.
+	Opened int
+	Solved int
+
+	// Fastest, Median, and Mean are in seconds,
+	// over the teams in Teams.
+	Fastest int64
+	Median  int64
+	Mean    int64
+
+	// Teams lists the teams that loaded and then solved the puzzle, fastest first.
+	// Teams that solved it without loading it aren't listed.
+	Teams []SolveTime
+}
+
+// solveTimes works out how long teams took to solve each puzzle,
+// from when they first loaded it.
+//
+// Only teams in the points log are counted,
+// so teams that haven't scored anything yet don't show up.
+func solveTimes(state StateProvider) []PuzzleSolveTimes {
+	type puzzleKey struct {
+		cat    string
+		points int
+	}
+	type teamKey struct {
+		teamID string
+		puzzleKey
+	}
+
+	solved := make(map[teamKey]time.Time)
+	seen := make(map[string]bool)
+	teamIDs := make([]string, 0)
+	for _, awd := range state.PointsLog() {
+		if awd.Part != "" {
+			continue
+		}
+		key := teamKey{awd.TeamID, puzzleKey{awd.Category, awd.Points}}
+		if _, ok := solved[key]; ok {
+			continue
+		}
+		if !seen[awd.TeamID] {
+			seen[awd.TeamID] = true
+			teamIDs = append(teamIDs, awd.TeamID)
+		}
+		solved[key] = time.Unix(awd.When, 0)
+	}
+
+	puzzles := make(map[puzzleKey]*PuzzleSolveTimes)
+	get := func(key puzzleKey) *PuzzleSolveTimes {
+		if pst, ok := puzzles[key]; ok {
+			return pst
+		}
+		pst := &PuzzleSolveTimes{Category: key.cat, Points: key.points, Teams: []SolveTime{}}
+		puzzles[key] = pst
+		return pst
+	}
+
+	for key := range solved {
+		get(key.puzzleKey).Solved++
+	}
+	for _, teamID := range teamIDs {
+		opened, err := state.TeamOpened(teamID)
+		if err != nil {
+			slog.Error("reading puzzle loads", "team", teamID, "error", err)
+			continue
+		}
+		teamName, _ := state.TeamName(teamID)
+		for cat, byPoints := range opened {
+			for points, when := range byPoints {
+				key := puzzleKey{cat, points}
+				pst := get(key)
+				pst.Opened++
+				if at, ok := solved[teamKey{teamID, key}]; ok {
+					pst.Teams = append(pst.Teams, SolveTime{
+						TeamName: teamName,
+						Opened:   when,
+						Solved:   at,
+						Seconds:  int64(at.Sub(when).Seconds()),
+					})
+				}
+			}
+		}
+	}
+
+	ret := make([]PuzzleSolveTimes, 0, len(puzzles))
+	for _, pst := range puzzles {
+		sort.Slice(pst.Teams, func(i, j int) bool {
+			return pst.Teams[i].Seconds < pst.Teams[j].Seconds
+		})
+		if n := len(pst.Teams); n > 0 {
+			pst.Fastest = pst.Teams[0].Seconds
+			pst.Median = pst.Teams[n/2].Seconds
+			if n%2 == 0 {
+				pst.Median = (pst.Teams[n/2-1].Seconds + pst.Teams[n/2].Seconds) / 2
+			}
+			var total int64
+			for _, st := range pst.Teams {
+				total += st.Seconds
+			}
+			pst.Mean = total / int64(n)
+		}
+		ret = append(ret, *pst)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Category == ret[j].Category {
+			return ret[i].Points < ret[j].Points
+		}
+		return ret[i].Category < ret[j].Category
+	})
+	return ret
+}
@@ -2,19 +2,29 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/dirtbags/moth/v4/pkg/award"
+	"github.com/dirtbags/moth/v4/pkg/transpile"
 	"github.com/spf13/afero"
 )
 
@@ -30,16 +40,47 @@ const RFC3339Space = "2006-01-02 15:04:05Z07:00"
 // ErrAlreadyRegistered means a team cannot be registered because it was registered previously.
 var ErrAlreadyRegistered = errors.New("team ID has already been registered")
 
+// ErrUnknownTeamID means a team cannot be registered because its ID isn't in teamids.txt.
+var ErrUnknownTeamID = errors.New("team ID not found in list of valid team IDs")
+
+// ErrAlreadyAwarded means points cannot be awarded because this team already has them.
+var ErrAlreadyAwarded = errors.New("points already awarded to this team in this category")
+
+// ErrInvalidTeamName means a team name is too long, too short, or contains a banned word.
+var ErrInvalidTeamName = errors.New("invalid team name")
+
+// ErrUnknownDivision means a team can't join a division because it isn't in divisions.txt.
+var ErrUnknownDivision = errors.New("division not found in list of divisions")
+
+// ErrInvalidLocale means a team asked for a language that isn't a language tag.
+var ErrInvalidLocale = errors.New("invalid language")
+
+// ErrPaused means answers can't be submitted because the event is paused.
+var ErrPaused = errors.New("the event is paused: answers are not being accepted right now")
+
+// MaxTeamNameLength is the longest team name allowed, in characters.
+const MaxTeamNameLength = 40
+
 // State defines the current state of a MOTH instance.
 // We use the filesystem for synchronization between threads.
 // The only thing State methods need to know is the path to the state directory.
 type State struct {
 	afero.Fs
 
+	// RotateSize is how big events.csv can get before it's rotated.
+	// Zero means it's never rotated.
+	RotateSize int64
+
+	// RotateKeep is how many rotated event logs, and old points logs, to keep.
+	// Zero keeps them all.
+	RotateKeep int
+
 	// Enabled tracks whether the current State system is processing updates
 	enabled bool
 
 	enabledWhy      string
+	nextChange      time.Time // next scheduled change in hours.txt
+	pausedAt        time.Time // zero if not paused
 	refreshNow      chan bool
 	eventStream     chan []string
 	eventWriter     *csv.Writer
@@ -49,7 +90,26 @@ type State struct {
 	teamNamesLastChange time.Time
 	teamNames           map[string]string
 	pointsLog           award.List
+	pointsLogIndex      pointsLogIndex
+	pending             award.List // Awarded, but not yet in pointsLog
+	seqFloor            uint64     // Highest sequence number ever used: see writePointsLog
+	multipliers         []Multiplier
+	bannedWords         map[string]bool
+	flagFormats         map[string]string // category, or "*" for every category -> pattern
+	retired             map[string][]int  // category -> points of retired puzzles
+	solutions           map[string][]int  // category -> points of puzzles with released solutions
+	avatarsLastChange   time.Time
+	avatars             map[string]string // team ID -> avatar hash
+	divisions           []string
+	divisionsLastChange time.Time
+	teamDivisions       map[string]string // team ID -> division
+	membersLastChange   time.Time
+	memberTokens        map[string]Member // member token hash -> member
+	revision            uint64            // Changes whenever a cache does
 	lock                sync.RWMutex
+
+	pointsLock  sync.Mutex // Held while writing the points log: see lockPointsLog
+	pendingLock sync.Mutex // Held from adding an award to pending until it's in points.new
 }
 
 // NewState returns a new State struct backed by the given Fs
@@ -61,6 +121,13 @@ func NewState(fs afero.Fs) *State {
 		eventStream: make(chan []string, 80),
 
 		teamNames: make(map[string]string),
+		avatars:   make(map[string]string),
+
+		teamDivisions: make(map[string]string),
+		memberTokens:  make(map[string]Member),
+
+		// Start from the clock, so revisions keep going up across restarts
+		revision: uint64(time.Now().UnixMilli()),
 	}
 	if err := s.reopenEventLog(); err != nil {
 		log.Fatal(err)
@@ -72,6 +139,7 @@ func NewState(fs afero.Fs) *State {
 func (s *State) updateEnabled() {
 	nextEnabled := true
 	why := "state/hours.txt has no timestamps before now"
+	nextChange := time.Time{}
 
 	if untilFile, err := s.Open("hours.txt"); err == nil {
 		defer untilFile.Close()
@@ -94,7 +162,7 @@ func (s *State) updateEnabled() {
 			case '#':
 				continue
 			default:
-				log.Println("state/hours.txt has bad line:", line)
+				slog.Warn("state/hours.txt has bad line", "line", line)
 			}
 			line, _, _ = strings.Cut(line, "#") // Remove inline comments
 			line = strings.TrimSpace(line)
@@ -106,95 +174,1117 @@ func (s *State) updateEnabled() {
 			} else if until, err = time.Parse(RFC3339Space, line); err == nil {
 				// Great, it was RFC 3339 with a space instead of a 'T'
 			} else {
-				log.Println("state/hours.txt has bad timestamp:", line)
+				slog.Warn("state/hours.txt has bad timestamp", "line", line)
 				continue
 			}
 			if until.Before(time.Now()) {
 				nextEnabled = thisEnabled
 				why = fmt.Sprint("state/hours.txt most recent timestamp:", line)
+			} else if nextChange.IsZero() || until.Before(nextChange) {
+				nextChange = until
 			}
 		}
 	}
 
-	if (nextEnabled != s.enabled) || (why != s.enabledWhy) {
-		s.enabled = nextEnabled
-		s.enabledWhy = why
-		log.Printf("Setting enabled=%v: %s", s.enabled, s.enabledWhy)
-		if s.enabled {
-			s.LogEvent("enabled", "", "", 0, s.enabledWhy)
-		} else {
-			s.LogEvent("disabled", "", "", 0, s.enabledWhy)
+	pausedAt := time.Time{}
+	if buf, err := afero.ReadFile(s, "paused"); err == nil {
+		line := strings.TrimSpace(string(buf))
+		if pausedAt, err = time.Parse(time.RFC3339, line); err != nil {
+			slog.Warn("state/paused has bad timestamp", "line", line)
+			pausedAt = time.Now()
+		}
+	}
+	s.lock.Lock()
+	s.nextChange = nextChange
+	s.pausedAt = pausedAt
+	s.lock.Unlock()
+
+	if (nextEnabled != s.enabled) || (why != s.enabledWhy) {
+		s.enabled = nextEnabled
+		s.enabledWhy = why
+		slog.Info("setting enabled", "enabled", s.enabled, "why", s.enabledWhy)
+		if s.enabled {
+			s.LogEvent("enabled", "", "", 0, s.enabledWhy)
+		} else {
+			s.LogEvent("disabled", "", "", 0, s.enabledWhy)
+		}
+	}
+}
+
+// TeamName returns team name given a team ID.
+func (s *State) TeamName(teamID string) (string, error) {
+	s.lock.RLock()
+	name, ok := s.teamNames[teamID]
+	s.lock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unregistered team ID: %s", teamID)
+	}
+	return name, nil
+}
+
+// CheckTeamName returns an error if teamName isn't an acceptable team name.
+//
+// Names must have between 1 and MaxTeamNameLength characters,
+// no control characters,
+// and no words listed in bannedwords.txt.
+func (s *State) CheckTeamName(teamName string) error {
+	length := utf8.RuneCountInString(teamName)
+	if length == 0 {
+		return fmt.Errorf("%w: empty", ErrInvalidTeamName)
+	}
+	if length > MaxTeamNameLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidTeamName, MaxTeamNameLength)
+	}
+	for _, r := range teamName {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: contains control characters", ErrInvalidTeamName)
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(teamName), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, word := range words {
+		if s.bannedWords[word] {
+			return fmt.Errorf("%w: contains a banned word", ErrInvalidTeamName)
+		}
+	}
+	return nil
+}
+
+// RenameTeam changes the name of a registered team.
+func (s *State) RenameTeam(teamID, teamName string) error {
+	if _, err := s.TeamName(teamID); err != nil {
+		return err
+	}
+
+	teamFilename := filepath.Join("teams", teamID)
+	if err := s.writeFileAtomic(teamFilename, []byte(teamName+"\n")); err != nil {
+		return err
+	}
+	slog.Info("renaming team", "team", teamID, "name", teamName, "file", teamFilename)
+
+	s.lock.Lock()
+	s.teamNames[teamID] = teamName
+	s.revision++
+	s.lock.Unlock()
+	return nil
+}
+
+// TeamAvatar returns the hash of a team's avatar.
+func (s *State) TeamAvatar(teamID string) (string, error) {
+	s.lock.RLock()
+	hash, ok := s.avatars[teamID]
+	s.lock.RUnlock()
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return hash, nil
+}
+
+// SetTeamAvatar stores a team's avatar image.
+// An empty avatar removes it.
+//
+// No checking is done on the image:
+// that's up to the caller.
+func (s *State) SetTeamAvatar(teamID string, avatar []byte) error {
+	avatarFilename := filepath.Join("avatars", teamID)
+	if len(avatar) == 0 {
+		if err := s.Remove(avatarFilename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		s.lock.Lock()
+		delete(s.avatars, teamID)
+		s.revision++
+		s.lock.Unlock()
+		return nil
+	}
+
+	if err := s.writeFileAtomic(avatarFilename, avatar); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.avatars[teamID] = avatarHash(avatar)
+	s.revision++
+	s.lock.Unlock()
+	return nil
+}
+
+// OpenAvatar opens the avatar with the given hash.
+func (s *State) OpenAvatar(hash string) (ReadSeekCloser, time.Time, error) {
+	s.lock.RLock()
+	teamID := ""
+	for id, h := range s.avatars {
+		if h == hash {
+			teamID = id
+			break
+		}
+	}
+	s.lock.RUnlock()
+	if teamID == "" {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+
+	f, err := s.Open(filepath.Join("avatars", teamID))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, fi.ModTime(), nil
+}
+
+// avatarHash returns a string identifying avatar.
+func avatarHash(avatar []byte) string {
+	sum := sha256.Sum256(avatar)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Divisions returns the divisions teams may be in, from divisions.txt.
+func (s *State) Divisions() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make([]string, len(s.divisions))
+	copy(ret, s.divisions)
+	return ret
+}
+
+// FlagFormats returns the patterns answers must match, from flagformats.txt,
+// by category.
+// The pattern for "*" applies to categories without their own.
+func (s *State) FlagFormats() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make(map[string]string, len(s.flagFormats))
+	for cat, pattern := range s.flagFormats {
+		ret[cat] = pattern
+	}
+	return ret
+}
+
+// TeamDivision returns the division a team is in.
+func (s *State) TeamDivision(teamID string) (string, error) {
+	s.lock.RLock()
+	division, ok := s.teamDivisions[teamID]
+	s.lock.RUnlock()
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return division, nil
+}
+
+// SetTeamDivision puts a team in a division listed in divisions.txt.
+// An empty division takes the team out of whatever division it was in.
+func (s *State) SetTeamDivision(teamID, division string) error {
+	divisionFilename := filepath.Join("divisions", teamID)
+	if division == "" {
+		if err := s.Remove(divisionFilename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		s.lock.Lock()
+		delete(s.teamDivisions, teamID)
+		s.revision++
+		s.lock.Unlock()
+		return nil
+	}
+
+	found := false
+	for _, d := range s.Divisions() {
+		if d == division {
+			found = true
+		}
+	}
+	if !found {
+		return ErrUnknownDivision
+	}
+
+	s.Mkdir("divisions", 0755)
+	if err := s.writeFileAtomic(divisionFilename, []byte(division+"\n")); err != nil {
+		return err
+	}
+	slog.Info("setting team division", "team", teamID, "division", division)
+
+	s.lock.Lock()
+	s.teamDivisions[teamID] = division
+	s.revision++
+	s.lock.Unlock()
+	return nil
+}
+
+// TeamLocale returns the language a team would like things in.
+func (s *State) TeamLocale(teamID string) (string, error) {
+	buf, err := afero.ReadFile(s, filepath.Join("locales", teamID))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// SetTeamLocale sets the language a team would like things in.
+// An empty locale forgets the team's preference.
+func (s *State) SetTeamLocale(teamID, locale string) error {
+	localeFilename := filepath.Join("locales", teamID)
+	if locale == "" {
+		if err := s.Remove(localeFilename); (err != nil) && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if !transpile.ValidLocale(locale) {
+		return ErrInvalidLocale
+	}
+
+	s.Mkdir("locales", 0755)
+	return s.writeFileAtomic(localeFilename, []byte(strings.ToLower(locale)+"\n"))
+}
+
+// AddAttempt records that a team submitted an answer for a puzzle.
+//
+// Each team's attempts are appended to its own file,
+// one line per attempt,
+// since the event log can be rotated away.
+func (s *State) AddAttempt(teamID, cat string, points int) error {
+	s.Mkdir("attempts", 0755)
+	f, err := s.OpenFile(filepath.Join("attempts", teamID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%d %s\n", points, cat); err != nil {
+		return err
+	}
+
+	// Attempts can break ties on the scoreboard
+	s.lock.Lock()
+	s.revision++
+	s.lock.Unlock()
+	return nil
+}
+
+// OpenPuzzle records when a team first loaded a puzzle.
+// Loading it again changes nothing.
+func (s *State) OpenPuzzle(teamID, cat string, points int) error {
+	opened, err := s.TeamOpened(teamID)
+	if err != nil {
+		return err
+	}
+	if _, ok := opened[cat][points]; ok {
+		return nil
+	}
+
+	s.Mkdir("opened", 0755)
+	f, err := s.OpenFile(filepath.Join("opened", teamID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d %d %s\n", time.Now().Unix(), points, cat)
+	return err
+}
+
+// TeamOpened returns when a team first loaded each puzzle,
+// by category, then point value.
+func (s *State) TeamOpened(teamID string) (map[string]map[int]time.Time, error) {
+	ret := make(map[string]map[int]time.Time)
+	f, err := s.Open(filepath.Join("opened", teamID))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		when, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		points, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		cat := fields[2]
+		if ret[cat] == nil {
+			ret[cat] = make(map[int]time.Time)
+		}
+		// Two loads at once can both be recorded: keep the first
+		if first, ok := ret[cat][points]; !ok || (when < first.Unix()) {
+			ret[cat][points] = time.Unix(when, 0)
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// AddWrongAnswer records that a team submitted a wrong answer for a puzzle.
+func (s *State) AddWrongAnswer(teamID, cat string, points int) error {
+	s.Mkdir("wrong", 0755)
+	f, err := s.OpenFile(filepath.Join("wrong", teamID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d %d %s\n", time.Now().Unix(), points, cat)
+	return err
+}
+
+// TeamWrongAnswers returns when a team submitted each wrong answer for each puzzle,
+// oldest first, by category, then point value.
+func (s *State) TeamWrongAnswers(teamID string) (map[string]map[int][]time.Time, error) {
+	ret := make(map[string]map[int][]time.Time)
+	f, err := s.Open(filepath.Join("wrong", teamID))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		when, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		points, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		cat := fields[2]
+		if ret[cat] == nil {
+			ret[cat] = make(map[int][]time.Time)
+		}
+		ret[cat][points] = append(ret[cat][points], time.Unix(when, 0))
+	}
+	for _, byPoints := range ret {
+		for _, times := range byPoints {
+			// Merged teams' answers are appended out of order
+			sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+		}
+	}
+	return ret, scanner.Err()
+}
+
+// TeamAttempts returns how many answers a team has submitted for each puzzle,
+// by category, then point value.
+// A team that hasn't submitted anything gets an empty map.
+func (s *State) TeamAttempts(teamID string) (map[string]map[int]int, error) {
+	ret := make(map[string]map[int]int)
+	f, err := s.Open(filepath.Join("attempts", teamID))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pointsStr, cat, ok := strings.Cut(scanner.Text(), " ")
+		points, err := strconv.Atoi(pointsStr)
+		if !ok || (err != nil) {
+			continue
+		}
+		if ret[cat] == nil {
+			ret[cat] = make(map[int]int)
+		}
+		ret[cat][points]++
+	}
+	return ret, scanner.Err()
+}
+
+// appendTeamFile appends fromID's file in dir to intoID's,
+// and removes fromID's.
+func (s *State) appendTeamFile(dir, fromID, intoID string) {
+	fromPath := filepath.Join(dir, fromID)
+	buf, err := afero.ReadFile(s, fromPath)
+	if err != nil {
+		return
+	}
+	if f, err := s.OpenFile(filepath.Join(dir, intoID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		slog.Warn("can't merge team file", "dir", dir, "team", fromID, "into", intoID, "error", err)
+	} else {
+		f.Write(buf)
+		f.Close()
+	}
+	s.Remove(fromPath)
+}
+
+// SetTeamName writes out team name.
+// This can only be done once per team.
+func (s *State) SetTeamName(teamID, teamName string) error {
+	s.lock.RLock()
+	_, ok := s.teamNames[teamID]
+	s.lock.RUnlock()
+	if ok {
+		return ErrAlreadyRegistered
+	}
+
+	idsFile, err := s.Open("teamids.txt")
+	if err != nil {
+		return fmt.Errorf("team IDs file does not exist")
+	}
+	defer idsFile.Close()
+	found := false
+	scanner := bufio.NewScanner(idsFile)
+	for scanner.Scan() {
+		if scanner.Text() == teamID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrUnknownTeamID
+	}
+
+	teamFilename := filepath.Join("teams", teamID)
+	teamFile, err := s.Fs.OpenFile(teamFilename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return ErrAlreadyRegistered
+	} else if err != nil {
+		return err
+	}
+	defer teamFile.Close()
+	slog.Info("setting team name", "team", teamID, "name", teamName, "file", teamFilename)
+	fmt.Fprintln(teamFile, teamName)
+	teamFile.Close()
+
+	s.refreshNow <- true
+
+	return nil
+}
+
+// MergeTeams moves every award from fromID to intoID,
+// then unregisters fromID.
+//
+// If both teams were awarded the same thing, only the earlier award is kept.
+// Awards for a puzzle after it was fully solved are dropped.
+// The points log is rewritten,
+// so this should only be done while scoring is suspended.
+func (s *State) MergeTeams(fromID, intoID string) error {
+	if fromID == intoID {
+		return fmt.Errorf("can't merge a team into itself")
+	}
+	if _, err := s.TeamName(fromID); err != nil {
+		return err
+	}
+	if _, err := s.TeamName(intoID); err != nil {
+		return err
+	}
+
+	unlock := s.lockPointsLog()
+	defer unlock()
+	pointsLog := s.reloadPointsLog()
+	sort.Stable(pointsLog)
+	merged := make(award.List, 0, len(pointsLog))
+	// For each puzzle, the merged team never has more than either team had on its own,
+	// so part of a puzzle from one team and the whole of it from the other
+	// isn't worth more than the whole puzzle.
+	teamTotal := make(map[string]int)   // "teamID category points" -> score before merging
+	mergedTotal := make(map[string]int) // "category points" -> score kept
+	for _, awd := range pointsLog {
+		merging := (awd.TeamID == fromID) || (awd.TeamID == intoID)
+		puzzle := fmt.Sprintf("%s %d", awd.Category, awd.Points)
+		source := awd.TeamID + " " + puzzle
+		if merging {
+			teamTotal[source] += awd.Score
+		}
+		if awd.TeamID == fromID {
+			awd.TeamID = intoID
+		}
+		keep := true
+		for _, e := range merged {
+			solved := (e.Part == "") && (e.TeamID == awd.TeamID) && (e.Category == awd.Category) && (e.Points == awd.Points)
+			if solved || awd.Equal(e) {
+				keep = false
+				break
+			}
+		}
+		if !keep {
+			slog.Info("dropping duplicate award", awardAttrs(awd)...)
+			continue
+		}
+		if merging {
+			awd.Score = max(teamTotal[source]-mergedTotal[puzzle], 0)
+			mergedTotal[puzzle] += awd.Score
+		}
+		merged = append(merged, awd)
+	}
+	if err := s.writePointsLog(merged); err != nil {
+		return err
+	}
+
+	// Keep fromID's avatar only if intoID doesn't have one
+	fromAvatar := filepath.Join("avatars", fromID)
+	if _, err := s.TeamAvatar(intoID); err != nil {
+		s.Rename(fromAvatar, filepath.Join("avatars", intoID))
+	} else {
+		s.Remove(fromAvatar)
+	}
+	s.Remove(filepath.Join("divisions", fromID))
+	s.Remove(filepath.Join("locales", fromID))
+
+	// intoID gets fromID's attempts, puzzle loads, wrong answers, and unlocks too.
+	// The earliest load of each puzzle wins, so fromID's can simply be added.
+	for _, dir := range []string{"attempts", "opened", "wrong", UnlocksDir} {
+		s.appendTeamFile(dir, fromID, intoID)
+	}
+	if err := s.mergeMembers(fromID, intoID); err != nil {
+		return err
+	}
+	if err := s.Remove(filepath.Join("teams", fromID)); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if hash, ok := s.avatars[fromID]; ok {
+		if _, ok := s.avatars[intoID]; !ok {
+			s.avatars[intoID] = hash
+		}
+	}
+	delete(s.avatars, fromID)
+	delete(s.teamDivisions, fromID)
+	delete(s.teamNames, fromID)
+	s.revision++
+	s.lock.Unlock()
+
+	slog.Info("merged teams", "team", fromID, "into", intoID)
+	s.LogEvent("merge", fromID, "", 0, intoID)
+	return nil
+}
+
+// SplitTeam registers a new team, newID, named newName,
+// and moves teamID's awards in any of categories over to it.
+//
+// The points log is rewritten,
+// so this should only be done while scoring is suspended.
+func (s *State) SplitTeam(teamID, newID, newName string, categories []string) error {
+	if _, err := s.TeamName(teamID); err != nil {
+		return err
+	}
+	if _, err := s.TeamName(newID); err == nil {
+		return ErrAlreadyRegistered
+	}
+	if err := s.CheckTeamName(newName); err != nil {
+		return err
+	}
+
+	teamFilename := filepath.Join("teams", newID)
+	teamFile, err := s.Fs.OpenFile(teamFilename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return ErrAlreadyRegistered
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintln(teamFile, newName)
+	teamFile.Close()
+
+	s.lock.Lock()
+	s.teamNames[newID] = newName
+	s.revision++
+	s.lock.Unlock()
+
+	// The new team stays in the same division
+	if division, err := s.TeamDivision(teamID); err == nil {
+		if err := s.SetTeamDivision(newID, division); err != nil {
+			slog.Warn("can't put new team in division", "team", newID, "division", division, "error", err)
+		}
+	}
+	if locale, err := s.TeamLocale(teamID); err == nil {
+		s.SetTeamLocale(newID, locale)
+	}
+
+	move := make(map[string]bool)
+	for _, cat := range categories {
+		move[cat] = true
+	}
+	unlock := s.lockPointsLog()
+	defer unlock()
+	pointsLog := s.reloadPointsLog()
+	for i, awd := range pointsLog {
+		if (awd.TeamID == teamID) && move[awd.Category] {
+			pointsLog[i].TeamID = newID
+		}
+	}
+	if err := s.writePointsLog(pointsLog); err != nil {
+		return err
+	}
+
+	slog.Info("split team", "team", teamID, "new", newID, "name", newName, "categories", categories)
+	s.LogEvent("split", teamID, "", 0, newID)
+	return nil
+}
+
+// writePointsLog replaces the points log with pointsLog.
+// Awards keep their sequence numbers,
+// unless they've been moved out of order.
+// The caller must hold lockPointsLog.
+//
+// If the newest awards are taken out,
+// their sequence numbers are kept in seq.txt,
+// so they're never used again.
+func (s *State) writePointsLog(pointsLog award.List) error {
+	s.lock.RLock()
+	highest := s.seqFloor
+	for _, awd := range s.pointsLog {
+		highest = max(highest, awd.Seq)
+	}
+	s.lock.RUnlock()
+	if last := pointsLog.Sequence(0); last < highest {
+		if err := s.writeFileAtomic("seq.txt", []byte(fmt.Sprintln(highest))); err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.seqFloor = highest
+		s.lock.Unlock()
+	}
+
+	buf := new(strings.Builder)
+	for _, awd := range pointsLog {
+		fmt.Fprintln(buf, awd.String())
+	}
+	if err := s.writeFileAtomic("points.log", []byte(buf.String())); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.pointsLog = pointsLog
+	s.revision++
+	s.pointsLogIndex = pointsLogIndex{}
+	s.lock.Unlock()
+	return nil
+}
+
+// pointsLogIndex records how much of the points log has been read,
+// so a refresh only needs to read awards added since the last one.
+type pointsLogIndex struct {
+	info   os.FileInfo // zero if the points log must be read from the start
+	offset int64
+}
+
+// updatePointsLog reads anything added to the points log since it was last read.
+// If the points log was replaced, or shrank, it's read from the start.
+// Malformed lines are skipped.
+//
+// The caller must hold s.lock.
+func (s *State) updatePointsLog() error {
+	f, err := s.Open("points.log")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	idx := s.pointsLogIndex
+	pointsLog := s.pointsLog
+	if (idx.info == nil) || !os.SameFile(idx.info, fi) || (fi.Size() < idx.offset) {
+		idx = pointsLogIndex{}
+		pointsLog = make(award.List, 0, 200)
+		// The points log may have been rewritten by another mothd
+		if buf, err := afero.ReadFile(s, "seq.txt"); err == nil {
+			if floor, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 64); err == nil {
+				s.seqFloor = floor
+			} else {
+				slog.Warn("state/seq.txt has bad sequence number", "error", err)
+			}
+		}
+	} else if (fi.Size() == idx.offset) && fi.ModTime().Equal(idx.info.ModTime()) {
+		return nil
+	} else if _, err := f.Seek(idx.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	complete := true
+	start := len(pointsLog)
+	for {
+		line, err := reader.ReadString('\n')
+		if (err != nil) && (err != io.EOF) {
+			return err
+		}
+		idx.offset += int64(len(line))
+		if !strings.HasSuffix(line, "\n") && (line != "") {
+			// Somebody didn't end the last line:
+			// use it, but read everything again next time
+			complete = false
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			if cur, err := award.Parse(line); err != nil {
+				slog.Warn("skipping malformed award line", "line", line, "error", err)
+			} else {
+				pointsLog = append(pointsLog, cur)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	// Awards added by hand, or by an older mothd, don't have sequence numbers
+	var last uint64
+	if start > 0 {
+		last = pointsLog[start-1].Seq
+	}
+	pointsLog[start:].Sequence(last)
+
+	idx.info = fi
+	if !complete {
+		idx = pointsLogIndex{}
+	}
+	s.pointsLog = pointsLog
+	s.pointsLogIndex = idx
+	s.revision++
+	return nil
+}
+
+// reloadPointsLog re-reads the points log into the cache, and returns a copy of it.
+//
+// Another process may have written to the points log since the last refresh,
+// so this should be called after lockPointsLog,
+// before deciding what to write.
+func (s *State) reloadPointsLog() award.List {
+	s.lock.Lock()
+	err := s.updatePointsLog()
+	s.lock.Unlock()
+	if (err != nil) && !os.IsNotExist(err) {
+		slog.Error("reading points log", "error", err)
+	}
+	return s.PointsLog()
+}
+
+// Revision returns a number which changes whenever the points log,
+// team names, avatars, or divisions change.
+func (s *State) Revision() uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.revision
+}
+
+// PointsLog retrieves the current points log.
+func (s *State) PointsLog() award.List {
+	s.lock.RLock()
+	ret := make(award.List, len(s.pointsLog))
+	copy(ret, s.pointsLog)
+	s.lock.RUnlock()
+	return ret
+}
+
+// Multipliers returns the point multipliers that haven't ended yet.
+func (s *State) Multipliers() []Multiplier {
+	now := time.Now()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := make([]Multiplier, 0, len(s.multipliers))
+	for _, m := range s.multipliers {
+		if m.End.After(now) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// multiplier returns how much to multiply scores in category by at time when.
+// If several multipliers apply, the largest is used.
+func (s *State) multiplier(category string, when time.Time) float64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	ret := 1.0
+	found := false
+	for _, m := range s.multipliers {
+		if m.Applies(category, when) && (!found || (m.Multiplier > ret)) {
+			ret = m.Multiplier
+			found = true
+		}
+	}
+	return ret
+}
+
+// updateMultipliers reads point multipliers from multipliers.txt.
+//
+// Each line has a category (or "*" for every category),
+// a multiplier,
+// and RFC 3339 start and end times:
+//
+//	web 2 2024-05-01T18:00:00-06:00 2024-05-01T19:00:00-06:00
+func (s *State) updateMultipliers() {
+	multipliers := make([]Multiplier, 0)
+	if f, err := s.Open("multipliers.txt"); err == nil {
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#") // Remove comments
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			m, err := parseMultiplier(fields)
+			if err != nil {
+				slog.Warn("state/multipliers.txt has bad line", "line", line, "error", err)
+				continue
+			}
+			multipliers = append(multipliers, m)
+		}
+	}
+
+	s.lock.Lock()
+	s.multipliers = multipliers
+	s.lock.Unlock()
+}
+
+func parseMultiplier(fields []string) (Multiplier, error) {
+	m := Multiplier{}
+	if len(fields) != 4 {
+		return m, fmt.Errorf("wanted 4 fields, got %d", len(fields))
+	}
+	m.Category = fields[0]
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return m, err
+	}
+	if value < 0 {
+		return m, fmt.Errorf("negative multiplier")
+	}
+	m.Multiplier = value
+	if m.Start, err = time.Parse(time.RFC3339, fields[2]); err != nil {
+		return m, err
+	}
+	if m.End, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Enabled returns true if the server is in "enabled" state
+func (s *State) Enabled() bool {
+	return s.enabled
+}
+
+// Schedule returns the contents of hours.txt,
+// or the empty string if there isn't one.
+func (s *State) Schedule() (string, error) {
+	buf, err := afero.ReadFile(s, "hours.txt")
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(buf), err
+}
+
+// SetSchedule replaces hours.txt, if every line of schedule makes sense.
+func (s *State) SetSchedule(schedule string) error {
+	if err := CheckSchedule(schedule); err != nil {
+		return err
+	}
+	if (schedule != "") && !strings.HasSuffix(schedule, "\n") {
+		schedule += "\n"
+	}
+	if err := s.writeFileAtomic("hours.txt", []byte(schedule)); err != nil {
+		return err
+	}
+	s.updateEnabled()
+	return nil
+}
+
+// CheckSchedule returns an error if any line of an hours.txt isn't a comment,
+// or a '+' or '-' followed by nothing or a timestamp.
+func CheckSchedule(schedule string) error {
+	for i, line := range strings.Split(schedule, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if (line[0] != '+') && (line[0] != '-') {
+			return fmt.Errorf("schedule line %d: must start with + or -", i+1)
+		}
+		ts, _, _ := strings.Cut(line[1:], "#")
+		ts = strings.TrimSpace(ts)
+		if ts == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, ts); err == nil {
+			continue
+		}
+		if _, err := time.Parse(RFC3339Space, ts); err != nil {
+			return fmt.Errorf("schedule line %d: bad timestamp %q", i+1, ts)
 		}
 	}
+	return nil
 }
 
-// TeamName returns team name given a team ID.
-func (s *State) TeamName(teamID string) (string, error) {
+// Until returns when hours.txt next enables or disables the event,
+// or the zero time if it never will.
+//
+// While the event is paused, the time paused so far is added,
+// so that countdowns to it stand still.
+func (s *State) Until() time.Time {
 	s.lock.RLock()
-	name, ok := s.teamNames[teamID]
-	s.lock.RUnlock()
-	if !ok {
-		return "", fmt.Errorf("unregistered team ID: %s", teamID)
+	defer s.lock.RUnlock()
+	if s.nextChange.IsZero() || s.pausedAt.IsZero() {
+		return s.nextChange
 	}
-	return name, nil
+	return s.nextChange.Add(time.Since(s.pausedAt))
 }
 
-// SetTeamName writes out team name.
-// This can only be done once per team.
-func (s *State) SetTeamName(teamID, teamName string) error {
+// Paused returns true if the event is paused.
+func (s *State) Paused() bool {
 	s.lock.RLock()
-	_, ok := s.teamNames[teamID]
-	s.lock.RUnlock()
-	if ok {
-		return ErrAlreadyRegistered
+	defer s.lock.RUnlock()
+	return !s.pausedAt.IsZero()
+}
+
+// Pause stops the clock: no answers are accepted until Resume is called.
+// Pausing an event that's already paused does nothing.
+func (s *State) Pause() error {
+	if s.Paused() {
+		return nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := s.writeFileAtomic("paused", []byte(now.Format(time.RFC3339)+"\n")); err != nil {
+		return err
 	}
+	slog.Info("pausing event")
+	s.LogEvent("pause", "", "", 0)
 
-	idsFile, err := s.Open("teamids.txt")
-	if err != nil {
-		return fmt.Errorf("team IDs file does not exist")
+	s.lock.Lock()
+	s.pausedAt = now
+	s.lock.Unlock()
+	return nil
+}
+
+// Resume restarts the clock after Pause.
+//
+// Every time in hours.txt and multipliers.txt after the pause began
+// is pushed back by however long the event was paused,
+// so nobody loses any time.
+func (s *State) Resume() error {
+	s.lock.RLock()
+	pausedAt := s.pausedAt
+	s.lock.RUnlock()
+	if pausedAt.IsZero() {
+		return nil
 	}
-	defer idsFile.Close()
-	found := false
-	scanner := bufio.NewScanner(idsFile)
-	for scanner.Scan() {
-		if scanner.Text() == teamID {
-			found = true
-			break
+
+	shift := time.Since(pausedAt).Truncate(time.Second)
+	for _, filename := range []string{"hours.txt", "multipliers.txt"} {
+		if err := s.shiftTimes(filename, pausedAt, shift); err != nil {
+			return err
 		}
 	}
-	if !found {
-		return fmt.Errorf("team ID not found in list of valid team IDs")
+	// Time limits are counted from when a team first loaded a puzzle,
+	// which could be before the pause, so keep track of every pause
+	f, err := s.OpenFile("pauses.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
 	}
-
-	teamFilename := filepath.Join("teams", teamID)
-	teamFile, err := s.Fs.OpenFile(teamFilename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
-	if os.IsExist(err) {
-		return ErrAlreadyRegistered
-	} else if err != nil {
+	_, err = fmt.Fprintf(f, "%s %s\n", pausedAt.UTC().Format(time.RFC3339), pausedAt.Add(shift).UTC().Format(time.RFC3339))
+	f.Close()
+	if err != nil {
 		return err
 	}
-	defer teamFile.Close()
-	log.Printf("Setting team name [%s] in file %s", teamName, teamFilename)
-	fmt.Fprintln(teamFile, teamName)
-	teamFile.Close()
-
-	s.refreshNow <- true
+	if err := s.Remove("paused"); err != nil {
+		return err
+	}
+	slog.Info("resuming event", "paused", shift.String())
+	s.LogEvent("resume", "", "", 0, shift.String())
 
+	s.lock.Lock()
+	s.pausedAt = time.Time{}
+	s.lock.Unlock()
+	s.updateEnabled()
+	s.updateMultipliers()
 	return nil
 }
 
-// PointsLog retrieves the current points log.
-func (s *State) PointsLog() award.List {
+// Pause is a time the event was paused.
+type Pause struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Pauses returns every time the event has been paused,
+// oldest first.
+// If the event is paused now,
+// the last one ends now.
+func (s *State) Pauses() ([]Pause, error) {
+	var ret []Pause
+	buf, err := afero.ReadFile(s, "pauses.txt")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			slog.Warn("state/pauses.txt has bad timestamp", "line", line)
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			slog.Warn("state/pauses.txt has bad timestamp", "line", line)
+			continue
+		}
+		ret = append(ret, Pause{Start: start, End: end})
+	}
+
 	s.lock.RLock()
-	ret := make(award.List, len(s.pointsLog))
-	copy(ret, s.pointsLog)
+	pausedAt := s.pausedAt
 	s.lock.RUnlock()
-	return ret
+	if !pausedAt.IsZero() {
+		ret = append(ret, Pause{Start: pausedAt, End: time.Now()})
+	}
+	return ret, nil
 }
 
-// Enabled returns true if the server is in "enabled" state
-func (s *State) Enabled() bool {
-	return s.enabled
+// timestampRegexp matches RFC 3339 timestamps, with either a 'T' or a space.
+var timestampRegexp = regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)`)
+
+// shiftTimes adds shift to every timestamp in filename after since.
+// Comment lines are left alone.
+func (s *State) shiftTimes(filename string, since time.Time, shift time.Duration) error {
+	buf, err := afero.ReadFile(s, filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(buf), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines[i] = timestampRegexp.ReplaceAllStringFunc(line, func(ts string) string {
+			layout := time.RFC3339
+			if ts[10] == ' ' {
+				layout = RFC3339Space
+			}
+			when, err := time.Parse(layout, ts)
+			if (err != nil) || !when.After(since) {
+				return ts
+			}
+			return when.Add(shift).Format(layout)
+		})
+	}
+
+	return s.writeFileAtomic(filename, []byte(strings.Join(lines, "")))
 }
 
 // AwardPoints gives points to teamID in category.
@@ -207,30 +1297,71 @@ func (s *State) AwardPoints(teamID, category string, points int) error {
 	return s.awardPointsAtTime(time.Now().Unix(), teamID, category, points)
 }
 
+// AwardCredit gives teamID score points toward the puzzle worth points in category.
+// part names the part of a multi-part puzzle that was solved,
+// or is empty if the whole puzzle was solved.
+// The same duplicate checks as AwardPoints apply.
+func (s *State) AwardCredit(teamID, category string, points int, part string, score int) error {
+	return s.award(award.T{
+		When:     time.Now().Unix(),
+		TeamID:   teamID,
+		Category: category,
+		Points:   points,
+		Part:     part,
+		Score:    score,
+	})
+}
+
 func (s *State) awardPointsAtTime(when int64, teamID string, category string, points int) error {
-	a := award.T{
+	return s.award(award.T{
 		When:     when,
 		TeamID:   teamID,
 		Category: category,
 		Points:   points,
+		Score:    points,
+	})
+}
+
+// award queues up an award in points.new.
+//
+// The duplicate check includes awards still waiting in points.new,
+// and it's done while holding the lock,
+// so two simultaneous awards can't both succeed.
+func (s *State) award(a award.T) error {
+	if m := s.multiplier(a.Category, time.Unix(a.When, 0)); m != 1 {
+		a.Score = int(math.Round(float64(a.Score) * m))
 	}
 
-	for _, e := range s.PointsLog() {
-		if a.Equal(e) {
-			return fmt.Errorf("points already awarded to this team in this category")
+	// Until the award is in points.new,
+	// collectPoints mustn't think somebody removed it
+	s.pendingLock.Lock()
+	s.lock.Lock()
+	for _, list := range []award.List{s.pointsLog, s.pending} {
+		for _, e := range list {
+			if a.Equal(e) {
+				s.lock.Unlock()
+				s.pendingLock.Unlock()
+				return ErrAlreadyAwarded
+			}
 		}
 	}
+	s.pending = append(s.pending, a)
+	s.lock.Unlock()
 
 	//fn := fmt.Sprintf("%s-%s-%d", a.TeamID, a.Category, a.Points)
 	fn := a.Filename()
 	tmpfn := filepath.Join("points.tmp", fn)
 	newfn := filepath.Join("points.new", fn)
 
-	if err := afero.WriteFile(s, tmpfn, []byte(a.String()), 0644); err != nil {
-		return err
+	err := afero.WriteFile(s, tmpfn, []byte(a.String()), 0644)
+	if err == nil {
+		err = s.Rename(tmpfn, newfn)
 	}
-
-	if err := s.Rename(tmpfn, newfn); err != nil {
+	if err != nil {
+		s.removePending(a)
+	}
+	s.pendingLock.Unlock()
+	if err != nil {
 		return err
 	}
 
@@ -240,24 +1371,56 @@ func (s *State) awardPointsAtTime(when int64, teamID string, category string, po
 	return nil
 }
 
+// PendingAwards returns awards that have been made,
+// but aren't in the points log yet.
+// This happens while scoring is suspended,
+// and briefly between an award and the next maintenance run.
+func (s *State) PendingAwards() award.List {
+	s.lock.RLock()
+	ret := make(award.List, len(s.pending))
+	copy(ret, s.pending)
+	s.lock.RUnlock()
+	return ret
+}
+
+// removePending forgets about a pending award.
+func (s *State) removePending(a award.T) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, e := range s.pending {
+		if a.Equal(e) {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
 // collectPoints gathers up files in points.new/ and appends their contents to points.log,
 // removing each points.new/ file as it goes.
+//
+// The points log is locked while this runs,
+// so two servers sharing a state directory won't both collect the same award.
 func (s *State) collectPoints() {
 	files, err := afero.ReadDir(s, "points.new")
 	if err != nil {
-		log.Print(err)
+		slog.Error("listing new points", "error", err)
 		return
 	}
+	if len(files) > 0 {
+		unlock := s.lockPointsLog()
+		defer unlock()
+		s.reloadPointsLog()
+	}
 	for _, f := range files {
 		filename := filepath.Join("points.new", f.Name())
 		awardstr, err := afero.ReadFile(s, filename)
 		if err != nil {
-			log.Print("Opening new points: ", err)
+			slog.Error("opening new points", "file", filename, "error", err)
 			continue
 		}
 		awd, err := award.Parse(string(awardstr))
 		if err != nil {
-			log.Print("Can't parse award file ", filename, ": ", err)
+			slog.Error("parsing award file", "file", filename, "error", err)
 			continue
 		}
 
@@ -272,28 +1435,68 @@ func (s *State) collectPoints() {
 		s.lock.RUnlock()
 
 		if duplicate {
-			log.Print("Skipping duplicate points: ", awd.String())
+			slog.Info("skipping duplicate points", awardAttrs(awd)...)
 		} else {
-			log.Print("Award: ", awd.String())
+			s.lock.RLock()
+			awd.Seq = s.seqFloor
+			if n := len(s.pointsLog); n > 0 {
+				awd.Seq = max(awd.Seq, s.pointsLog[n-1].Seq)
+			}
+			s.lock.RUnlock()
+			awd.Seq++
+			slog.Info("award", awardAttrs(awd)...)
 
 			logf, err := s.OpenFile("points.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 			if err != nil {
-				log.Print("Can't append to points log: ", err)
+				slog.Error("appending to points log", "error", err)
+				return
+			}
+			// One write, so the line can't be interleaved with anyone else's
+			_, err = logf.Write([]byte(awd.String() + "\n"))
+			if closeErr := logf.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				// Leave the points.new file, to try again next time
+				slog.Error("appending to points log", "error", err)
 				return
 			}
-			fmt.Fprintln(logf, awd.String())
-			logf.Close()
 
 			// Stick this on the cache too
 			s.lock.Lock()
-			s.pointsLog = append(s.pointsLog, awd)
+			if err := s.updatePointsLog(); err != nil {
+				slog.Error("reading points log", "error", err)
+			}
 			s.lock.Unlock()
 		}
 
 		if err := s.Remove(filename); err != nil {
-			log.Print("Unable to remove new points file: ", err)
+			slog.Error("removing new points file", "file", filename, "error", err)
+		}
+		s.removePending(awd)
+	}
+
+	// Forget about anything somebody removed from points.new by hand.
+	// Awards on their way into points.new are left alone.
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+	files, err = afero.ReadDir(s, "points.new")
+	if err != nil {
+		return
+	}
+	waiting := make(map[string]bool)
+	for _, f := range files {
+		waiting[f.Name()] = true
+	}
+	s.lock.Lock()
+	pending := make(award.List, 0, len(s.pending))
+	for _, a := range s.pending {
+		if waiting[a.Filename()] {
+			pending = append(pending, a)
 		}
 	}
+	s.pending = pending
+	s.lock.Unlock()
 }
 
 func (s *State) maybeInitialize() {
@@ -303,17 +1506,35 @@ func (s *State) maybeInitialize() {
 	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
-	log.Print("initialized file missing, re-initializing")
+	slog.Warn("initialized file missing, re-initializing")
+
+	unlock := s.lockPointsLog()
+	defer unlock()
 
 	// Remove any extant control and state files
 	s.Remove("enabled")
 	s.Remove("hours.txt")
+	s.Remove("multipliers.txt")
+	s.Remove("paused")
+	s.Remove("pauses.txt")
 	s.Remove("points.log")
+	s.Remove("seq.txt")
 	s.Remove("events.csv")
 	s.Remove("mothd.log")
 	s.RemoveAll("points.tmp")
 	s.RemoveAll("points.new")
+	s.lock.Lock()
+	s.pending = nil
+	s.seqFloor = 0
+	s.lock.Unlock()
 	s.RemoveAll("teams")
+	s.RemoveAll("avatars")
+	s.RemoveAll("divisions")
+	s.RemoveAll("locales")
+	s.RemoveAll("attempts")
+	s.RemoveAll("opened")
+	s.RemoveAll("wrong")
+	s.RemoveAll(UnlocksDir)
 
 	// Open log file
 	if err := s.reopenEventLog(); err != nil {
@@ -325,6 +1546,8 @@ func (s *State) maybeInitialize() {
 	s.Mkdir("points.tmp", 0755)
 	s.Mkdir("points.new", 0755)
 	s.Mkdir("teams", 0755)
+	s.Mkdir("avatars", 0755)
+	s.Mkdir("divisions", 0755)
 
 	// Preseed available team ids if file doesn't exist
 	if f, err := s.OpenFile("teamids.txt", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err == nil {
@@ -391,7 +1614,7 @@ func (s *State) reopenEventLog() error {
 	if s.eventWriterFile != nil {
 		if err := s.eventWriterFile.Close(); err != nil {
 			// We're going to soldier on if Close returns error
-			log.Print(err)
+			slog.Error("closing event log", "error", err)
 		}
 	}
 	eventWriterFile, err := s.OpenFile("events.csv", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -407,23 +1630,8 @@ func (s *State) updateCaches() {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	if f, err := s.Open("points.log"); err != nil {
-		log.Println(err)
-	} else {
-		defer f.Close()
-
-		pointsLog := make(award.List, 0, 200)
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			line := scanner.Text()
-			cur, err := award.Parse(line)
-			if err != nil {
-				log.Printf("Skipping malformed award line %s: %s", line, err)
-				continue
-			}
-			pointsLog = append(pointsLog, cur)
-		}
-		s.pointsLog = pointsLog
+	if err := s.updatePointsLog(); err != nil {
+		slog.Error("opening points log", "error", err)
 	}
 
 	// Only do this if the teams directory has a newer mtime; directories with
@@ -431,9 +1639,10 @@ func (s *State) updateCaches() {
 	{
 		_, ismmfs := s.Fs.(*afero.MemMapFs) // Tests run so quickly that the time check isn't precise enough
 		if fi, err := s.Fs.Stat("teams"); err != nil {
-			log.Printf("Getting modification time of teams directory: %v", err)
+			slog.Error("getting modification time of teams directory", "error", err)
 		} else if ismmfs || s.teamNamesLastChange.Before(fi.ModTime()) {
 			s.teamNamesLastChange = fi.ModTime()
+			s.revision++
 
 			// The compiler recognizes this as an optimization case
 			for k := range s.teamNames {
@@ -442,12 +1651,12 @@ func (s *State) updateCaches() {
 
 			teamsFs := afero.NewBasePathFs(s.Fs, "teams")
 			if dirents, err := afero.ReadDir(teamsFs, "."); err != nil {
-				log.Printf("Reading team ids: %v", err)
+				slog.Error("reading team IDs", "error", err)
 			} else {
 				for _, dirent := range dirents {
 					teamID := dirent.Name()
 					if teamNameBytes, err := afero.ReadFile(teamsFs, teamID); err != nil {
-						log.Printf("Reading team %s: %v", teamID, err)
+						slog.Error("reading team name", "team", teamID, "error", err)
 					} else {
 						teamName := strings.TrimSpace(string(teamNameBytes))
 						s.teamNames[teamID] = teamName
@@ -456,11 +1665,151 @@ func (s *State) updateCaches() {
 			}
 		}
 	}
+
+	// Same deal for avatars
+	{
+		_, ismmfs := s.Fs.(*afero.MemMapFs)
+		if fi, err := s.Fs.Stat("avatars"); err != nil {
+			// No avatars directory is fine: nobody has uploaded one
+		} else if ismmfs || s.avatarsLastChange.Before(fi.ModTime()) {
+			s.avatarsLastChange = fi.ModTime()
+			s.revision++
+
+			for k := range s.avatars {
+				delete(s.avatars, k)
+			}
+
+			avatarsFs := afero.NewBasePathFs(s.Fs, "avatars")
+			if dirents, err := afero.ReadDir(avatarsFs, "."); err != nil {
+				slog.Error("reading avatars", "error", err)
+			} else {
+				for _, dirent := range dirents {
+					teamID := dirent.Name()
+					if avatar, err := afero.ReadFile(avatarsFs, teamID); err != nil {
+						slog.Error("reading avatar", "team", teamID, "error", err)
+					} else {
+						s.avatars[teamID] = avatarHash(avatar)
+					}
+				}
+			}
+		}
+	}
+
+	// And for divisions
+	{
+		_, ismmfs := s.Fs.(*afero.MemMapFs)
+		if fi, err := s.Fs.Stat("divisions"); err != nil {
+			// No divisions directory is fine: nobody is in a division
+		} else if ismmfs || s.divisionsLastChange.Before(fi.ModTime()) {
+			s.divisionsLastChange = fi.ModTime()
+			s.revision++
+
+			for k := range s.teamDivisions {
+				delete(s.teamDivisions, k)
+			}
+
+			divisionsFs := afero.NewBasePathFs(s.Fs, "divisions")
+			if dirents, err := afero.ReadDir(divisionsFs, "."); err != nil {
+				slog.Error("reading divisions", "error", err)
+			} else {
+				for _, dirent := range dirents {
+					teamID := dirent.Name()
+					if division, err := afero.ReadFile(divisionsFs, teamID); err != nil {
+						slog.Error("reading division", "team", teamID, "error", err)
+					} else {
+						s.teamDivisions[teamID] = strings.TrimSpace(string(division))
+					}
+				}
+			}
+		}
+	}
+
+	// And for members, so member tokens can be looked up without reading every team's
+	{
+		_, ismmfs := s.Fs.(*afero.MemMapFs)
+		if fi, err := s.Fs.Stat(MembersDir); err != nil {
+			// No members directory is fine: nobody has joined a team
+		} else if ismmfs || s.membersLastChange.Before(fi.ModTime()) {
+			s.membersLastChange = fi.ModTime()
+
+			for k := range s.memberTokens {
+				delete(s.memberTokens, k)
+			}
+
+			if dirents, err := afero.ReadDir(s, MembersDir); err != nil {
+				slog.Error("reading members", "error", err)
+			} else {
+				for _, dirent := range dirents {
+					if dirent.IsDir() || strings.HasPrefix(dirent.Name(), ".") {
+						continue
+					}
+					members, hashes, err := s.readMembers(dirent.Name())
+					if err != nil {
+						slog.Error("reading members", "team", dirent.Name(), "error", err)
+						continue
+					}
+					for i, hash := range hashes {
+						s.memberTokens[hash] = members[i]
+					}
+				}
+			}
+		}
+	}
+
+	divisions := make([]string, 0)
+	if f, err := s.Open("divisions.txt"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			division := strings.TrimSpace(scanner.Text())
+			if (division != "") && !strings.HasPrefix(division, "#") {
+				divisions = append(divisions, division)
+			}
+		}
+		f.Close()
+	}
+	s.divisions = divisions
+
+	bannedWords := make(map[string]bool)
+	if f, err := s.Open("bannedwords.txt"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if (word != "") && !strings.HasPrefix(word, "#") {
+				bannedWords[word] = true
+			}
+		}
+		f.Close()
+	}
+	s.bannedWords = bannedWords
+
+	flagFormats := make(map[string]string)
+	if f, err := s.Open("flagformats.txt"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if (line == "") || strings.HasPrefix(line, "#") {
+				continue
+			}
+			cat, pattern, _ := strings.Cut(line, " ")
+			pattern = strings.TrimSpace(pattern)
+			if _, err := CompileFlagFormat(pattern); (pattern == "") || (err != nil) {
+				slog.Warn("ignoring flag format", "category", cat, "pattern", pattern, "error", err)
+				continue
+			}
+			flagFormats[cat] = pattern
+		}
+		f.Close()
+	}
+	s.flagFormats = flagFormats
+
+	s.retired = s.readRetired()
+	s.solutions = s.readPuzzleList(SolutionsFile)
 }
 
 func (s *State) refresh() {
 	s.maybeInitialize()
 	s.updateEnabled()
+	s.updateMultipliers()
 	if s.enabled {
 		s.collectPoints()
 	}
@@ -479,6 +1828,7 @@ func (s *State) Maintain(updateInterval time.Duration) {
 			s.eventWriterFile.Sync()
 		case <-ticker.C:
 			s.refresh()
+			s.rotateEventLog(time.Now())
 		case <-s.refreshNow:
 			s.refresh()
 		}
@@ -526,3 +1876,14 @@ func (ds *DevelState) SetTeamName(teamID, teamName string) error {
 	}
 	return nil
 }
+
+// awardAttrs returns structured logging attributes describing awd.
+func awardAttrs(awd award.T) []any {
+	return []any{
+		"team", awd.TeamID,
+		"category", awd.Category,
+		"points", awd.Points,
+		"part", awd.Part,
+		"score", awd.Score,
+	}
+}
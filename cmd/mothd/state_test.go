@@ -162,6 +162,36 @@ func TestStateOutOfOrderAward(t *testing.T) {
 	}
 }
 
+func TestStateSequenceAfterRefund(t *testing.T) {
+	s := NewTestState()
+	go slurp(s.refreshNow)
+
+	s.AwardPoints("AA", "meow", 1)
+	s.AwardPoints("AA", "meow", 2)
+	s.refresh()
+	if err := s.RetirePuzzle("meow", 2, true); err != nil {
+		t.Fatal(err)
+	}
+	s.AwardPoints("AA", "meow", 3)
+	s.refresh()
+	if pl := s.PointsLog(); (len(pl) != 2) || (pl[1].Seq != 3) {
+		t.Error("Refunded sequence number used again:", pl)
+	}
+
+	// Another server using the same state directory knows too
+	if err := s.RetirePuzzle("meow", 3, true); err != nil {
+		t.Fatal(err)
+	}
+	other := NewState(s.Fs)
+	go slurp(other.refreshNow)
+	other.refresh()
+	other.AwardPoints("AA", "meow", 4)
+	other.refresh()
+	if pl := other.PointsLog(); (len(pl) != 2) || (pl[1].Seq != 4) {
+		t.Error("Refunded sequence number used again by another server:", pl)
+	}
+}
+
 func TestStateEvents(t *testing.T) {
 	s := NewTestState()
 	s.LogEvent("moo", "", "", 0)
@@ -264,6 +294,398 @@ func TestStateDisabled(t *testing.T) {
 	}
 }
 
+func TestStateMultipliers(t *testing.T) {
+	s := NewTestState()
+	defer close(s.refreshNow)
+	go slurp(s.refreshNow)
+
+	now := time.Now()
+	lines := []string{
+		"# category multiplier start end",
+		fmt.Sprintf("web 2 %s %s", now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)),
+		fmt.Sprintf("* 1.5 %s %s  # everything", now.Add(-time.Hour).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339)),
+		fmt.Sprintf("web 3 %s %s", now.Add(-2*time.Hour).Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339)),
+		"web lots sometime",
+	}
+	afero.WriteFile(s, "multipliers.txt", []byte(strings.Join(lines, "\n")), 0644)
+	s.refresh()
+
+	if m := s.Multipliers(); len(m) != 2 {
+		t.Error("Wrong number of current multipliers:", m)
+	}
+
+	s.AwardPoints("team", "web", 3)
+	s.AwardPoints("team", "crypto", 3)
+	s.awardPointsAtTime(now.Add(-90*time.Minute).Unix(), "team", "web", 4)
+	s.awardPointsAtTime(now.Add(-3*time.Hour).Unix(), "team", "web", 5)
+	s.refresh()
+
+	scores := make(map[int]int)
+	for _, awd := range s.PointsLog() {
+		if awd.Category == "web" {
+			scores[awd.Points] = awd.Score
+		}
+	}
+	if scores[3] != 6 {
+		t.Error("Largest multiplier not used:", scores[3])
+	}
+	if scores[4] != 12 {
+		t.Error("Past multiplier not applied to award made during it:", scores[4])
+	}
+	if scores[5] != 5 {
+		t.Error("Multiplier applied outside its window:", scores[5])
+	}
+	for _, awd := range s.PointsLog() {
+		if (awd.Category == "crypto") && (awd.Score != 5) {
+			t.Error("Wildcard multiplier not applied:", awd)
+		}
+	}
+}
+
+func TestStateProfile(t *testing.T) {
+	s := NewTestState()
+	defer close(s.refreshNow)
+	go slurp(s.refreshNow)
+
+	afero.WriteFile(s, "bannedwords.txt", []byte("# comment\nMoo\n"), 0644)
+	s.refresh()
+	for name, ok := range map[string]bool{
+		"Cool Team":             true,
+		"":                      false,
+		strings.Repeat("x", 41): false,
+		"Bell\a":                false,
+		"Team moo!":             false,
+		"Smooth Operators":      true,
+		strings.Repeat("é", 40): true,
+	} {
+		if err := s.CheckTeamName(name); (err == nil) != ok {
+			t.Errorf("CheckTeamName(%q) returned %v", name, err)
+		}
+	}
+
+	if err := s.RenameTeam("nobody", "Nobody"); err == nil {
+		t.Error("Renamed an unregistered team")
+	}
+	afero.WriteFile(s, "teamids.txt", []byte("team\n"), 0644)
+	if err := s.SetTeamName("team", "Old Name"); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if err := s.RenameTeam("team", "New Name"); err != nil {
+		t.Error(err)
+	}
+	s.refresh()
+	if name, _ := s.TeamName("team"); name != "New Name" {
+		t.Error("Team not renamed:", name)
+	}
+
+	if _, err := s.TeamAvatar("team"); err == nil {
+		t.Error("Team has an avatar before setting one")
+	}
+	if err := s.SetTeamAvatar("team", []byte("picture")); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	hash, err := s.TeamAvatar("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _, err := s.OpenAvatar(hash); err != nil {
+		t.Error(err)
+	} else {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(f)
+		f.Close()
+		if buf.String() != "picture" {
+			t.Error("Wrong avatar:", buf.String())
+		}
+	}
+	if _, _, err := s.OpenAvatar("0123"); err == nil {
+		t.Error("Opened a nonexistent avatar")
+	}
+
+	if err := s.SetTeamAvatar("team", nil); err != nil {
+		t.Error(err)
+	}
+	s.refresh()
+	if _, err := s.TeamAvatar("team"); err == nil {
+		t.Error("Avatar not removed")
+	}
+}
+
+func TestStateMergeSplit(t *testing.T) {
+	s := NewTestState()
+	defer close(s.refreshNow)
+	go slurp(s.refreshNow)
+	s.refresh()
+
+	afero.WriteFile(s, "teamids.txt", []byte("one\ntwo\n"), 0644)
+	s.SetTeamName("one", "Team One")
+	s.SetTeamName("two", "Team Two")
+	s.SetTeamAvatar("two", []byte("picture"))
+	s.refresh()
+	s.awardPointsAtTime(10, "one", "cat", 1)
+	s.awardPointsAtTime(20, "two", "cat", 1)
+	s.awardPointsAtTime(30, "two", "cat", 2)
+	s.awardPointsAtTime(40, "one", "dog", 1)
+	s.AwardCredit("two", "dog", 1, "a", 0)
+	s.refresh()
+
+	if err := RunAdminCommand(s, []string{"merge", "two", "one"}); err == nil {
+		t.Error("Ran an admin command with scoring enabled")
+	}
+	if err := s.MergeTeams("one", "one"); err == nil {
+		t.Error("Merged a team into itself")
+	}
+	if err := s.MergeTeams("nobody", "one"); err == nil {
+		t.Error("Merged an unregistered team")
+	}
+	if err := s.MergeTeams("two", "one"); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if _, err := s.TeamName("two"); err == nil {
+		t.Error("Merged team is still registered")
+	}
+	if _, err := s.TeamAvatar("one"); err != nil {
+		t.Error("Merged team's avatar wasn't kept")
+	}
+	pl := s.PointsLog()
+	if len(pl) != 3 {
+		t.Fatal("Wrong number of awards after merge:", pl)
+	}
+	for i, when := range []int64{10, 30, 40} {
+		if (pl[i].TeamID != "one") || (pl[i].When != when) {
+			t.Error("Wrong award after merge:", pl[i])
+		}
+	}
+
+	if err := s.SplitTeam("one", "one", "Again", nil); err != ErrAlreadyRegistered {
+		t.Error("Split into a registered team:", err)
+	}
+	if err := s.SplitTeam("one", "three", "Team Three", []string{"dog"}); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if name, _ := s.TeamName("three"); name != "Team Three" {
+		t.Error("New team not registered:", name)
+	}
+	pl = s.PointsLog()
+	if (pl[1].TeamID != "one") || (pl[2].TeamID != "three") {
+		t.Error("Wrong awards after split:", pl)
+	}
+}
+
+func TestStateMergeParts(t *testing.T) {
+	s := NewTestState()
+	defer close(s.refreshNow)
+	go slurp(s.refreshNow)
+
+	afero.WriteFile(s, "teamids.txt", []byte("one\ntwo\n"), 0644)
+	s.SetTeamName("one", "Team One")
+	s.SetTeamName("two", "Team Two")
+	s.refresh()
+	now := time.Now().Unix()
+	s.AwardCredit("one", "web", 10, "a", 5)
+	s.awardPointsAtTime(now+10, "two", "web", 10)
+	s.AwardCredit("two", "dog", 10, "ok", 5)
+	s.AwardCredit("one", "dog", 10, "good", 8)
+
+	code, err := s.JoinCode("two", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := s.JoinTeam(code, "Ada", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+
+	if err := s.MergeTeams("two", "one"); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	scores := make(map[string]int)
+	for _, awd := range s.PointsLog() {
+		scores[awd.Category] += awd.Score
+	}
+	if scores["web"] != 10 {
+		t.Error("Part and whole of a puzzle both counted:", s.PointsLog())
+	}
+	if scores["dog"] != 8 {
+		t.Error("Two tiers of a puzzle both counted:", s.PointsLog())
+	}
+
+	if m, err := s.MemberByToken(member.Token); (err != nil) || (m.TeamID != "one") {
+		t.Error("Member still on merged team:", m, err)
+	}
+	if members, _ := s.TeamMembers("one"); (len(members) != 1) || (members[0].ID != member.ID) {
+		t.Error("Member not moved:", members)
+	}
+	if _, err := s.Stat("members/two"); !os.IsNotExist(err) {
+		t.Error("Merged team's members left behind:", err)
+	}
+	if again, _ := s.JoinCode("one", false); again != code {
+		t.Error("Join code not moved:", again)
+	}
+}
+
+func TestStatePause(t *testing.T) {
+	s := NewTestState()
+	defer close(s.refreshNow)
+	go slurp(s.refreshNow)
+	s.refresh()
+
+	if s.Paused() {
+		t.Error("New state is paused")
+	}
+	if err := s.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if !s.Paused() {
+		t.Error("Pause didn't stick")
+	}
+	if err := s.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	s.refresh()
+	if s.Paused() {
+		t.Error("Resume didn't stick")
+	}
+
+	// Pretend we paused an hour ago
+	now := time.Now().UTC().Truncate(time.Second)
+	before := now.Add(-2 * time.Hour)
+	after := now.Add(2 * time.Hour)
+	afero.WriteFile(s, "paused", []byte(now.Add(-time.Hour).Format(time.RFC3339)), 0644)
+	afero.WriteFile(
+		s,
+		"hours.txt",
+		[]byte(fmt.Sprintf("# %s\n+ %s\n- %s\n", after.Format(time.RFC3339), before.Format(time.RFC3339), after.Format(RFC3339Space))),
+		0644,
+	)
+	afero.WriteFile(s, "multipliers.txt", []byte(fmt.Sprintf("web 2 %s %s\n", before.Format(time.RFC3339), after.Format(time.RFC3339))), 0644)
+	s.refresh()
+	if until := s.Until(); until.Sub(after) < time.Hour-time.Second {
+		t.Error("Paused time not added to Until:", until, after)
+	}
+
+	if err := s.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	shiftedBy := func(ts string, layout string) time.Duration {
+		when, err := time.Parse(layout, ts)
+		if err != nil {
+			t.Error(err)
+		}
+		return when.Sub(after)
+	}
+	closeToAnHour := func(d time.Duration) bool {
+		return (d >= time.Hour) && (d <= time.Hour+2*time.Second)
+	}
+
+	hours, _ := afero.ReadFile(s, "hours.txt")
+	lines := strings.Split(string(hours), "\n")
+	if lines[0] != "# "+after.Format(time.RFC3339) {
+		t.Error("Comment changed:", lines[0])
+	}
+	if lines[1] != "+ "+before.Format(time.RFC3339) {
+		t.Error("Earlier time changed:", lines[1])
+	}
+	if d := shiftedBy(strings.TrimPrefix(lines[2], "- "), RFC3339Space); !closeToAnHour(d) {
+		t.Error("Later time shifted wrong:", lines[2], d)
+	}
+
+	multipliers, _ := afero.ReadFile(s, "multipliers.txt")
+	fields := strings.Fields(string(multipliers))
+	if fields[2] != before.Format(time.RFC3339) {
+		t.Error("Multiplier start changed:", fields[2])
+	}
+	if d := shiftedBy(fields[3], time.RFC3339); !closeToAnHour(d) {
+		t.Error("Multiplier end shifted wrong:", fields[3], d)
+	}
+	if d := s.Until().Sub(after); !closeToAnHour(d) {
+		t.Error("Wrong Until after resume:", d)
+	}
+
+	pauses, err := s.Pauses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pauses) != 2 {
+		t.Fatal("Wrong number of pauses:", pauses)
+	}
+	if last := pauses[1]; !last.Start.Equal(now.Add(-time.Hour)) || !closeToAnHour(last.End.Sub(last.Start)) {
+		t.Error("Pause recorded wrong:", last)
+	}
+}
+
+func TestStateSharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	a := NewState(afero.NewBasePathFs(afero.NewOsFs(), dir))
+	b := NewState(afero.NewBasePathFs(afero.NewOsFs(), dir))
+	go slurp(a.refreshNow)
+	go slurp(b.refreshNow)
+	a.refresh()
+	b.refresh()
+
+	// Both servers award and collect points at the same time
+	done := make(chan bool)
+	for _, s := range []*State{a, b} {
+		go func(s *State, teamID string) {
+			for points := 1; points <= 20; points++ {
+				if err := s.AwardPoints(teamID, "pategory", points); err != nil {
+					t.Error(err)
+				}
+				s.refresh()
+			}
+			done <- true
+		}(s, fmt.Sprintf("%p", s))
+	}
+	<-done
+	<-done
+	a.refresh()
+	b.refresh()
+	if len(a.PointsLog()) != 40 {
+		t.Error("Wrong number of awards:", len(a.PointsLog()))
+	}
+	for i, awd := range a.PointsLog() {
+		if awd.Seq != uint64(i+1) {
+			t.Error("Wrong sequence number:", i, awd)
+			break
+		}
+	}
+
+	// b hasn't seen this award yet, but mustn't log it twice
+	if err := a.AwardPoints("dup", "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	a.refresh()
+	if err := b.AwardPoints("dup", "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	b.refresh()
+	if len(b.PointsLog()) != 41 {
+		t.Error("Duplicate award logged:", len(b.PointsLog()))
+	}
+
+	afero.WriteFile(a, "teamids.txt", []byte("team\n"), 0644)
+	if err := a.SetTeamName("team", "Team"); err != nil {
+		t.Error(err)
+	}
+	a.refresh()
+	if err := a.RenameTeam("team", "Renamed Team"); err != nil {
+		t.Error(err)
+	}
+	if tmpFiles, _ := afero.ReadDir(a, "points.tmp"); len(tmpFiles) != 0 {
+		t.Error("Temporary files left behind:", len(tmpFiles))
+	}
+	if name, _ := afero.ReadFile(b, "teams/team"); string(name) != "Renamed Team\n" {
+		t.Error("Wrong team name:", string(name))
+	}
+}
+
 func TestStateMaintainer(t *testing.T) {
 	updateInterval := 10 * time.Millisecond
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// PointsLockFile is the file in the state directory which is locked
+// while anything writes to the points log.
+// Other programs that write to the points log can lock it too,
+// with flock(1).
+const PointsLockFile = "points.lock"
+
+// lockPointsLog keeps anything else from writing to the points log
+// until unlock is called.
+//
+// Other goroutines are kept out with a mutex.
+// Other processes are kept out with an advisory lock on PointsLockFile,
+// if the state directory is on a real filesystem.
+func (s *State) lockPointsLog() (unlock func()) {
+	s.pointsLock.Lock()
+
+	f, err := s.OpenFile(PointsLockFile, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		// Don't refuse to run over this: a read-only lock file shouldn't stop the event
+		slog.Warn("opening points lock file", "error", err)
+		return s.pointsLock.Unlock
+	}
+	osf := osFile(f)
+	if osf != nil {
+		if err := lockFile(osf); err != nil {
+			slog.Warn("locking points log", "error", err)
+			osf = nil
+		}
+	}
+
+	return func() {
+		if osf != nil {
+			unlockFile(osf)
+		}
+		f.Close()
+		s.pointsLock.Unlock()
+	}
+}
+
+// osFile returns the operating system file underneath f,
+// or nil if f isn't on a real filesystem.
+func osFile(f afero.File) *os.File {
+	for {
+		switch ff := f.(type) {
+		case *os.File:
+			return ff
+		case *afero.BasePathFile:
+			f = ff.File
+		default:
+			return nil
+		}
+	}
+}
+
+// writeFileAtomic replaces filename with data.
+//
+// The data is written to a temporary file in points.tmp,
+// which is then moved into place,
+// so nothing ever reads a partly-written file.
+func (s *State) writeFileAtomic(filename string, data []byte) error {
+	f, err := afero.TempFile(s, "points.tmp", filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	tmpfn := filepath.Join("points.tmp", filepath.Base(f.Name()))
+	_, err = f.Write(data)
+	if err == nil {
+		// TempFile makes files only we can read
+		err = s.Chmod(tmpfn, 0644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.Rename(tmpfn, filename)
+	}
+	if err != nil {
+		s.Remove(tmpfn)
+	}
+	return err
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateServiceTimeout is how long a frontend waits to connect to a state service,
+// and how long a state service waits for a frontend to send its token.
+const StateServiceTimeout = 10 * time.Second
+
+// StateService serves a StateProvider to other mothd processes,
+// using the same protocol as a state plugin.
+//
+// This lets several frontends serve content and check answers,
+// while one process, with the state directory, decides the order of awards.
+//
+// A frontend starts each connection by sending the token and a newline.
+// After that, the connection carries JSON-RPC 1.0, as it would to a plugin.
+type StateService struct {
+	State StateProvider
+	Token string
+}
+
+// NewStateService returns a StateService serving state,
+// to frontends that know token.
+func NewStateService(state StateProvider, token string) *StateService {
+	return &StateService{
+		State: state,
+		Token: token,
+	}
+}
+
+// Serve accepts frontend connections on ln until it fails.
+func (ss *StateService) Serve(ln net.Listener) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("State", &stateMethods{ss.State}); err != nil {
+		return err
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go ss.serveConn(server, conn)
+	}
+}
+
+// serveConn checks a frontend's token, then answers its calls until it hangs up.
+func (ss *StateService) serveConn(server *rpc.Server, conn net.Conn) {
+	remote := conn.RemoteAddr().String()
+	conn.SetReadDeadline(time.Now().Add(StateServiceTimeout))
+	r := bufio.NewReader(conn)
+	token, err := r.ReadString('\n')
+	if err != nil {
+		slog.Warn("state service connection", "remote", remote, "error", err)
+		conn.Close()
+		return
+	}
+	token = strings.TrimSuffix(token, "\n")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ss.Token)) != 1 {
+		slog.Warn("state service connection with wrong token", "remote", remote)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	slog.Info("state service connection", "remote", remote)
+	server.ServeCodec(jsonrpc.NewServerCodec(bufferedConn{r, conn}))
+	slog.Info("state service connection closed", "remote", remote)
+}
+
+// bufferedConn reads from a buffer that's already read some of a connection.
+type bufferedConn struct {
+	*bufio.Reader
+	net.Conn
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// stateMethods are the methods of a StateProvider,
+// in the form net/rpc wants them.
+type stateMethods struct {
+	state StateProvider
+}
+
+func (m *stateMethods) Enabled(args PluginArgs, reply *bool) error {
+	*reply = m.state.Enabled()
+	return nil
+}
+
+func (m *stateMethods) Paused(args PluginArgs, reply *bool) error {
+	*reply = m.state.Paused()
+	return nil
+}
+
+func (m *stateMethods) Pause(args PluginArgs, reply *bool) error {
+	return m.state.Pause()
+}
+
+func (m *stateMethods) Resume(args PluginArgs, reply *bool) error {
+	return m.state.Resume()
+}
+
+func (m *stateMethods) Until(args PluginArgs, reply *time.Time) error {
+	*reply = m.state.Until()
+	return nil
+}
+
+func (m *stateMethods) Pauses(args PluginArgs, reply *[]Pause) (err error) {
+	*reply, err = m.state.Pauses()
+	return err
+}
+
+func (m *stateMethods) Schedule(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.Schedule()
+	return err
+}
+
+func (m *stateMethods) SetSchedule(args PluginArgs, reply *bool) error {
+	return m.state.SetSchedule(args.Schedule)
+}
+
+func (m *stateMethods) PointsLog(args PluginArgs, reply *[]string) error {
+	for _, awd := range m.state.PointsLog() {
+		*reply = append(*reply, awd.String())
+	}
+	return nil
+}
+
+func (m *stateMethods) PendingAwards(args PluginArgs, reply *[]string) error {
+	for _, awd := range m.state.PendingAwards() {
+		*reply = append(*reply, awd.String())
+	}
+	return nil
+}
+
+func (m *stateMethods) Revision(args PluginArgs, reply *uint64) error {
+	*reply = m.state.Revision()
+	return nil
+}
+
+func (m *stateMethods) TeamName(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.TeamName(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) SetTeamName(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamName(args.TeamID, args.TeamName)
+}
+
+func (m *stateMethods) AwardPoints(args PluginArgs, reply *bool) error {
+	return m.state.AwardPoints(args.TeamID, args.Category, args.Points)
+}
+
+func (m *stateMethods) AwardCredit(args PluginArgs, reply *bool) error {
+	return m.state.AwardCredit(args.TeamID, args.Category, args.Points, args.Part, args.Score)
+}
+
+func (m *stateMethods) Multipliers(args PluginArgs, reply *[]Multiplier) error {
+	*reply = m.state.Multipliers()
+	return nil
+}
+
+func (m *stateMethods) CheckTeamName(args PluginArgs, reply *bool) error {
+	return m.state.CheckTeamName(args.TeamName)
+}
+
+func (m *stateMethods) RenameTeam(args PluginArgs, reply *bool) error {
+	return m.state.RenameTeam(args.TeamID, args.TeamName)
+}
+
+func (m *stateMethods) TeamAvatar(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.TeamAvatar(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) SetTeamAvatar(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamAvatar(args.TeamID, args.Avatar)
+}
+
+func (m *stateMethods) OpenAvatar(args PluginArgs, reply *PluginFile) error {
+	f, mtime, err := m.state.OpenAvatar(args.Hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reply.ModTime = mtime
+	reply.Data, err = io.ReadAll(f)
+	return err
+}
+
+func (m *stateMethods) Divisions(args PluginArgs, reply *[]string) error {
+	*reply = m.state.Divisions()
+	return nil
+}
+
+func (m *stateMethods) FlagFormats(args PluginArgs, reply *map[string]string) error {
+	*reply = m.state.FlagFormats()
+	return nil
+}
+
+func (m *stateMethods) Retired(args PluginArgs, reply *map[string][]int) error {
+	*reply = m.state.Retired()
+	return nil
+}
+
+func (m *stateMethods) RetirePuzzle(args PluginArgs, reply *bool) error {
+	return m.state.RetirePuzzle(args.Category, args.Points, args.Refund)
+}
+
+func (m *stateMethods) RestorePuzzle(args PluginArgs, reply *bool) error {
+	return m.state.RestorePuzzle(args.Category, args.Points)
+}
+
+func (m *stateMethods) ReleasedSolutions(args PluginArgs, reply *map[string][]int) error {
+	*reply = m.state.ReleasedSolutions()
+	return nil
+}
+
+func (m *stateMethods) ReleaseSolution(args PluginArgs, reply *bool) error {
+	return m.state.ReleaseSolution(args.Category, args.Points, args.Released)
+}
+
+func (m *stateMethods) Errata(args PluginArgs, reply *Erratum) error {
+	*reply = m.state.Errata(args.Category, args.Points)
+	return nil
+}
+
+func (m *stateMethods) SetErrata(args PluginArgs, reply *bool) error {
+	return m.state.SetErrata(args.Category, args.Points, args.Text)
+}
+
+func (m *stateMethods) ExtraAnswers(args PluginArgs, reply *[]string) error {
+	*reply = m.state.ExtraAnswers(args.Category, args.Points)
+	return nil
+}
+
+func (m *stateMethods) AcceptAnswer(args PluginArgs, reply *bool) error {
+	return m.state.AcceptAnswer(args.Category, args.Points, args.Answer)
+}
+
+func (m *stateMethods) TeamEmails(args PluginArgs, reply *map[string]string) error {
+	*reply = m.state.TeamEmails()
+	return nil
+}
+
+func (m *stateMethods) SetTeamEmail(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamEmail(args.TeamID, args.Email)
+}
+
+func (m *stateMethods) NewRecoveryCodes(args PluginArgs, reply *[]string) (err error) {
+	*reply, err = m.state.NewRecoveryCodes(args.TeamID, args.Count)
+	return err
+}
+
+func (m *stateMethods) NewTeamID(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.NewTeamID(args.Count)
+	return err
+}
+
+func (m *stateMethods) JoinCode(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.JoinCode(args.TeamID, args.Renew)
+	return err
+}
+
+func (m *stateMethods) JoinTeam(args PluginArgs, reply *Member) (err error) {
+	*reply, err = m.state.JoinTeam(args.Code, args.Name, args.Count)
+	return err
+}
+
+func (m *stateMethods) TeamMembers(args PluginArgs, reply *[]Member) (err error) {
+	*reply, err = m.state.TeamMembers(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) MemberByToken(args PluginArgs, reply *Member) (err error) {
+	*reply, err = m.state.MemberByToken(args.Code)
+	return err
+}
+
+func (m *stateMethods) RemoveMember(args PluginArgs, reply *bool) error {
+	return m.state.RemoveMember(args.TeamID, args.Member)
+}
+
+func (m *stateMethods) RecoverTeam(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.RecoverTeam(args.Code, args.Rotate)
+	return err
+}
+
+func (m *stateMethods) SessionKey(args PluginArgs, reply *[]byte) (err error) {
+	*reply, err = m.state.SessionKey()
+	return err
+}
+
+func (m *stateMethods) RevokedSessions(args PluginArgs, reply *map[string]time.Time) error {
+	*reply = m.state.RevokedSessions()
+	return nil
+}
+
+func (m *stateMethods) RevokeSessions(args PluginArgs, reply *bool) error {
+	return m.state.RevokeSessions(args.TeamID)
+}
+
+func (m *stateMethods) EndedSessions(args PluginArgs, reply *map[string]EndedSession) error {
+	*reply = m.state.EndedSessions()
+	return nil
+}
+
+func (m *stateMethods) EndSession(args PluginArgs, reply *bool) error {
+	if args.Session == nil {
+		return ErrInvalidSession
+	}
+	return m.state.EndSession(*args.Session)
+}
+
+func (m *stateMethods) TeamDivision(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.TeamDivision(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) SetTeamDivision(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamDivision(args.TeamID, args.Division)
+}
+
+func (m *stateMethods) TeamLocale(args PluginArgs, reply *string) (err error) {
+	*reply, err = m.state.TeamLocale(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) SetTeamLocale(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamLocale(args.TeamID, args.Locale)
+}
+
+func (m *stateMethods) AddAttempt(args PluginArgs, reply *bool) error {
+	return m.state.AddAttempt(args.TeamID, args.Category, args.Points)
+}
+
+func (m *stateMethods) TeamAttempts(args PluginArgs, reply *map[string]map[int]int) (err error) {
+	*reply, err = m.state.TeamAttempts(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) OpenPuzzle(args PluginArgs, reply *bool) error {
+	return m.state.OpenPuzzle(args.TeamID, args.Category, args.Points)
+}
+
+func (m *stateMethods) TeamOpened(args PluginArgs, reply *map[string]map[int]time.Time) (err error) {
+	*reply, err = m.state.TeamOpened(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) AddWrongAnswer(args PluginArgs, reply *bool) error {
+	return m.state.AddWrongAnswer(args.TeamID, args.Category, args.Points)
+}
+
+func (m *stateMethods) TeamWrongAnswers(args PluginArgs, reply *map[string]map[int][]time.Time) (err error) {
+	*reply, err = m.state.TeamWrongAnswers(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) TeamUnlocks(args PluginArgs, reply *map[string][]int) (err error) {
+	*reply, err = m.state.TeamUnlocks(args.TeamID)
+	return err
+}
+
+func (m *stateMethods) SetTeamUnlock(args PluginArgs, reply *bool) error {
+	return m.state.SetTeamUnlock(args.TeamID, args.Category, args.Points, args.Unlocked)
+}
+
+func (m *stateMethods) IssueCertificate(args PluginArgs, reply *Certificate) (err error) {
+	if args.Certificate == nil {
+		return ErrInvalidCertificate
+	}
+	*reply, err = m.state.IssueCertificate(*args.Certificate)
+	return err
+}
+
+func (m *stateMethods) Certificate(args PluginArgs, reply *Certificate) (err error) {
+	*reply, err = m.state.Certificate(args.Code)
+	return err
+}
+
+func (m *stateMethods) LogEvent(args PluginArgs, reply *bool) error {
+	m.state.LogEvent(args.Event, args.TeamID, args.Category, args.Points, args.Extra...)
+	return nil
+}
+
+func (m *stateMethods) Backup(args PluginArgs, reply *[]byte) error {
+	buf := new(bytes.Buffer)
+	err := m.state.Backup(buf)
+	*reply = buf.Bytes()
+	return err
+}
+
+// stateServiceDialer connects to the first state service that answers,
+// starting with the one that answered last time.
+type stateServiceDialer struct {
+	addrs []BindAddress
+	token string
+
+	lock    sync.Mutex
+	current int
+}
+
+// NewStateServiceState returns a StateProvider using the state services at addrs,
+// which are tried in turn until one answers.
+//
+// Each address is written like a -bind address:
+// "host:port", or "unix:/run/moth/state.sock".
+func NewStateServiceState(addrs []string, token string) (*PluginState, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no state service addresses")
+	}
+	d := &stateServiceDialer{token: token}
+	for _, addr := range addrs {
+		b, err := ParseBindAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		if b.Network == "systemd" {
+			return nil, fmt.Errorf("state service %s: can't connect to a systemd socket", addr)
+		}
+		d.addrs = append(d.addrs, b)
+	}
+	p := &Plugin{
+		Path: strings.Join(addrs, ","),
+		dial: d.dial,
+	}
+	return &PluginState{p}, nil
+}
+
+// dial connects to a state service,
+// trying each address once.
+func (d *stateServiceDialer) dial() (io.ReadWriteCloser, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var err error
+	for i := range d.addrs {
+		n := (d.current + i) % len(d.addrs)
+		b := d.addrs[n]
+		var conn net.Conn
+		conn, err = net.DialTimeout(b.Network, b.Address, StateServiceTimeout)
+		if err != nil {
+			slog.Warn("connecting to state service", "address", b.String(), "error", err)
+			continue
+		}
+		if _, err = fmt.Fprintf(conn, "%s\n", d.token); err != nil {
+			conn.Close()
+			continue
+		}
+		if n != d.current {
+			slog.Warn("failed over to another state service", "address", b.String())
+		}
+		d.current = n
+		slog.Info("connected to state service", "address", b.String())
+		return conn, nil
+	}
+	return nil, fmt.Errorf("no state service answered: %w", err)
+}
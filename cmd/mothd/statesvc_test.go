@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestStateService(t *testing.T) {
+	state := NewTestState()
+	afero.WriteFile(state, "teamids.txt", []byte("teamID\n"), 0644)
+	state.refresh()
+	go slurp(state.refreshNow)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go NewStateService(state, "sekrit").Serve(ln)
+
+	// Nothing's listening here, so the frontend has to fail over
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead.Close()
+
+	remote, err := NewStateServiceState([]string{dead.Addr().String(), ln.Addr().String()}, "sekrit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !remote.Enabled() {
+		t.Error("Not enabled")
+	}
+	if err := remote.SetTeamName("teamID", "Remote Team"); err != nil {
+		t.Fatal(err)
+	}
+	state.refresh()
+	if name, err := remote.TeamName("teamID"); (err != nil) || (name != "Remote Team") {
+		t.Error("Wrong team name:", name, err)
+	}
+	if _, err := remote.TeamName("nobody"); err == nil {
+		t.Error("Unregistered team has a name")
+	}
+
+	if err := remote.AwardPoints("teamID", "pategory", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.AwardPoints("teamID", "pategory", 1); !errors.Is(err, ErrAlreadyAwarded) {
+		t.Error("Awarded twice:", err)
+	}
+	state.refresh()
+	if pl := remote.PointsLog(); (len(pl) != 1) || (pl[0].TeamID != "teamID") || (pl[0].Points != 1) {
+		t.Error("Wrong points log:", pl)
+	}
+	if remote.Revision() != state.Revision() {
+		t.Error("Wrong revision")
+	}
+
+	// A frontend with the wrong token gets nothing
+	impostor, err := NewStateServiceState([]string{ln.Addr().String()}, "guess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impostor.TeamName("teamID"); err == nil {
+		t.Error("Wrong token accepted")
+	}
+
+	for _, addrs := range [][]string{{}, {"8080"}, {"systemd"}} {
+		if _, err := NewStateServiceState(addrs, "sekrit"); err == nil {
+			t.Error("Accepted addresses", addrs)
+		}
+	}
+}
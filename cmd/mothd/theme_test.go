@@ -42,3 +42,17 @@ func TestTheme(t *testing.T) {
 		t.Error("Opening non-existent file didn't return an error")
 	}
 }
+
+func TestDefaultTheme(t *testing.T) {
+	theme := NewDefaultTheme()
+	for _, filename := range []string{"/index.html", "/puzzle.html", "/moth.js", "/style.css"} {
+		if f, _, err := theme.Open(filename); err != nil {
+			t.Error(err)
+		} else {
+			f.Close()
+		}
+	}
+	if _, err := theme.Fs.Create("/index.html"); err == nil {
+		t.Error("Built-in theme is writable")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions describes how to serve HTTPS.
+type TLSOptions struct {
+	// CertFile and KeyFile hold a PEM-encoded certificate and private key
+	CertFile string
+	KeyFile  string
+
+	// AutocertHosts are host names to get certificates for from Let's Encrypt
+	AutocertHosts []string
+	AutocertCache string
+	AutocertEmail string
+
+	// RedirectBind is where to listen for plain HTTP requests, which are redirected to HTTPS.
+	// When using Let's Encrypt, this also answers HTTP-01 challenges.
+	RedirectBind string
+
+	// HSTSMaxAge is how long browsers should insist on HTTPS, or zero to not ask them to
+	HSTSMaxAge time.Duration
+}
+
+// Enabled returns true if these options call for HTTPS.
+func (o TLSOptions) Enabled() bool {
+	return (o.CertFile != "") || (o.KeyFile != "") || (len(o.AutocertHosts) > 0)
+}
+
+// config returns the TLS configuration,
+// and a function to wrap the plain HTTP handler.
+func (o TLSOptions) config() (*tls.Config, func(http.Handler) http.Handler, error) {
+	switch {
+	case (o.CertFile == "") != (o.KeyFile == ""):
+		return nil, nil, fmt.Errorf("a TLS certificate needs both a certificate file and a key file")
+	case (o.CertFile != "") && (len(o.AutocertHosts) > 0):
+		return nil, nil, fmt.Errorf("can't use both a TLS certificate file and Let's Encrypt")
+	case o.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		config := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		return config, func(h http.Handler) http.Handler { return h }, nil
+	}
+
+	if err := os.MkdirAll(o.AutocertCache, 0700); err != nil {
+		return nil, nil, err
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(o.AutocertHosts...),
+		Cache:      autocert.DirCache(o.AutocertCache),
+		Email:      o.AutocertEmail,
+	}
+	config := m.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+	return config, m.HTTPHandler, nil
+}
+
+// RunTLS binds to bindStr, and serves incoming HTTPS requests until failure.
+func (h *HTTPServer) RunTLS(binds []BindAddress, opts TLSOptions) {
+	config, wrapHTTP, err := opts.config()
+	if err != nil {
+		slog.Error("configuring TLS", "error", err)
+		os.Exit(1)
+	}
+
+	errs := make(chan error, len(binds)+1)
+	if opts.RedirectBind != "" {
+		redirectBind, err := ParseBindAddress(opts.RedirectBind)
+		if err != nil {
+			slog.Error("configuring TLS", "error", err)
+			os.Exit(1)
+		}
+		// Redirect to the port of the first HTTPS address
+		port := ""
+		for _, bind := range binds {
+			if !bind.NoTLS && (bind.Network != "unix") {
+				port = tlsPort(bind.Address)
+				break
+			}
+		}
+		redirect := wrapHTTP(httpsRedirect{port: port})
+		slog.Info("redirecting to HTTPS", "address", redirectBind.String())
+		go func() {
+			errs <- h.serve(redirectBind, redirect, nil)
+		}()
+	}
+
+	if !h.server.Config.HTTP2 {
+		// Don't offer HTTP/2 if we're not going to speak it
+		protos := make([]string, 0, len(config.NextProtos))
+		for _, proto := range config.NextProtos {
+			if proto != "h2" {
+				protos = append(protos, proto)
+			}
+		}
+		config.NextProtos = protos
+	}
+
+	for _, bind := range binds {
+		go func(bind BindAddress) {
+			if bind.NoTLS {
+				errs <- h.serve(bind, h, nil)
+			} else {
+				errs <- h.serve(bind, hsts{h, opts.HSTSMaxAge}, config)
+			}
+		}(bind)
+	}
+	slog.Error("http server stopped", "error", <-errs)
+	os.Exit(1)
+}
+
+// tlsPort returns the port in bindStr, or the empty string if it's the HTTPS default.
+func tlsPort(bindStr string) string {
+	_, port, err := net.SplitHostPort(bindStr)
+	if (err != nil) || (port == "443") {
+		return ""
+	}
+	return port
+}
+
+// httpsRedirect sends every request to the same URL over HTTPS.
+type httpsRedirect struct {
+	port string
+}
+
+func (rd httpsRedirect) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if rd.port != "" {
+		host = net.JoinHostPort(host, rd.port)
+	}
+	u := *req.URL
+	u.Scheme = "https"
+	u.Host = host
+	http.Redirect(w, req, u.String(), http.StatusPermanentRedirect)
+}
+
+// hsts adds a Strict-Transport-Security header to every response.
+type hsts struct {
+	http.Handler
+	maxAge time.Duration
+}
+
+func (h hsts) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.maxAge > 0 {
+		w.Header().Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(h.maxAge.Seconds())))
+	}
+	h.Handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	cases := []struct {
+		bind     string
+		url      string
+		location string
+	}{
+		{":443", "http://moth.example/answer?id=1", "https://moth.example/answer?id=1"},
+		{":8443", "http://moth.example:8080/", "https://moth.example:8443/"},
+		{"[::1]:443", "http://moth.example:80/state", "https://moth.example/state"},
+	}
+	for _, c := range cases {
+		rd := httpsRedirect{port: tlsPort(c.bind)}
+		w := httptest.NewRecorder()
+		rd.ServeHTTP(w, httptest.NewRequest(http.MethodPost, c.url, nil))
+		if w.Code != http.StatusPermanentRedirect {
+			t.Error("Wrong status code", w.Code)
+		}
+		if loc := w.Header().Get("Location"); loc != c.location {
+			t.Errorf("Redirected %s to %s, wanted %s", c.url, loc, c.location)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	w := httptest.NewRecorder()
+	hsts{ok, 24 * time.Hour}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Header().Get("Strict-Transport-Security"); h != "max-age=86400" {
+		t.Error("Wrong HSTS header:", h)
+	}
+
+	w = httptest.NewRecorder()
+	hsts{ok, 0}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Header().Get("Strict-Transport-Security"); h != "" {
+		t.Error("HSTS header sent when disabled:", h)
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	if (TLSOptions{}).Enabled() {
+		t.Error("TLS enabled with no options")
+	}
+	if _, _, err := (TLSOptions{CertFile: "cert.pem"}).config(); err == nil {
+		t.Error("Certificate accepted without a key")
+	}
+	opts := TLSOptions{CertFile: "cert.pem", KeyFile: "key.pem", AutocertHosts: []string{"moth.example"}}
+	if _, _, err := opts.config(); err == nil {
+		t.Error("Certificate files accepted alongside Let's Encrypt")
+	}
+
+	opts = TLSOptions{AutocertHosts: []string{"moth.example"}, AutocertCache: t.TempDir()}
+	config, _, err := opts.config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.GetCertificate == nil {
+		t.Error("Let's Encrypt configuration can't get certificates")
+	}
+}
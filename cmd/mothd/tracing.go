@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/award"
+)
+
+// TraceQueueLength is how many finished spans can wait to be exported.
+// Spans finished while the queue is full are dropped.
+const TraceQueueLength = 1000
+
+// TraceBatchSize is the most spans sent to the collector in one request.
+const TraceBatchSize = 200
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	statusCodeError  = 2
+)
+
+// Span is one timed operation in a trace.
+//
+// All methods are safe to call on a nil *Span,
+// which is what you get when tracing is turned off.
+type Span struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	ParentID   [8]byte
+	Name       string
+	Kind       int
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Error      string
+
+	tracer *Tracer
+}
+
+// SetAttributes adds key/value pairs to the span.
+func (sp *Span) SetAttributes(attrs ...interface{}) {
+	if sp == nil {
+		return
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		sp.Attributes[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+}
+
+// Finish ends the span, marking it as failed if err is not nil.
+func (sp *Span) Finish(err error) {
+	if sp == nil {
+		return
+	}
+	sp.End = time.Now()
+	if err != nil {
+		sp.Error = err.Error()
+	}
+	sp.tracer.record(sp)
+}
+
+type spanKey struct{}
+
+// spanFromContext returns the span carried by ctx, or nil.
+func spanFromContext(ctx context.Context) *Span {
+	sp, _ := ctx.Value(spanKey{}).(*Span)
+	return sp
+}
+
+// Tracer records spans, and exports them to an OpenTelemetry collector
+// using OTLP over HTTP, with JSON encoding.
+type Tracer struct {
+	// Endpoint is the collector's base URL; spans are sent to Endpoint/v1/traces
+	Endpoint    string
+	ServiceName string
+	Client      *http.Client
+
+	spans chan *Span
+}
+
+// NewTracer returns a Tracer exporting to the collector at endpoint.
+func NewTracer(endpoint, serviceName string) *Tracer {
+	return &Tracer{
+		Endpoint:    strings.TrimRight(endpoint, "/"),
+		ServiceName: serviceName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		spans:       make(chan *Span, TraceQueueLength),
+	}
+}
+
+// Start begins a new span named name, as a child of any span in ctx.
+// The returned context carries the new span.
+//
+// If t is nil, ctx and a nil span are returned.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	sp := &Span{
+		Name:       name,
+		Kind:       spanKindInternal,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+	rand.Read(sp.SpanID[:])
+	if parent := spanFromContext(ctx); parent != nil {
+		sp.TraceID = parent.TraceID
+		sp.ParentID = parent.SpanID
+	} else {
+		rand.Read(sp.TraceID[:])
+	}
+	sp.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, sp), sp
+}
+
+// StartRequest begins a server span for an HTTP request.
+//
+// If the request has a W3C traceparent header,
+// the span joins the caller's trace.
+func (t *Tracer) StartRequest(req *http.Request) (context.Context, *Span) {
+	ctx := req.Context()
+	if t == nil {
+		return ctx, nil
+	}
+	if traceID, spanID, ok := parseTraceparent(req.Header.Get("traceparent")); ok {
+		ctx = context.WithValue(ctx, spanKey{}, &Span{TraceID: traceID, SpanID: spanID})
+	}
+	ctx, sp := t.Start(
+		ctx,
+		req.Method+" "+req.URL.Path,
+		"http.method", req.Method,
+		"http.target", req.URL.Path,
+		"net.peer.addr", req.RemoteAddr,
+	)
+	sp.Kind = spanKindServer
+	return ctx, sp
+}
+
+// parseTraceparent decodes a W3C Trace Context traceparent header.
+func parseTraceparent(header string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	fields := strings.Split(header, "-")
+	if (len(fields) != 4) || (fields[0] != "00") {
+		return
+	}
+	if n, err := hex.Decode(traceID[:], []byte(fields[1])); (err != nil) || (n != len(traceID)) {
+		return
+	}
+	if n, err := hex.Decode(spanID[:], []byte(fields[2])); (err != nil) || (n != len(spanID)) {
+		return
+	}
+	return traceID, spanID, true
+}
+
+func (t *Tracer) record(sp *Span) {
+	select {
+	case t.spans <- sp:
+	default:
+		slog.Warn("trace queue full, dropping span", "span", sp.Name)
+	}
+}
+
+// Maintain exports finished spans every updateInterval,
+// or whenever TraceBatchSize spans are waiting.
+func (t *Tracer) Maintain(updateInterval time.Duration) {
+	ticker := time.NewTicker(updateInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, TraceBatchSize)
+	for {
+		select {
+		case sp := <-t.spans:
+			batch = append(batch, sp)
+			if len(batch) < TraceBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := t.export(batch); err != nil {
+			slog.Warn("exporting spans", "endpoint", t.Endpoint, "spans", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+// export sends spans to the collector.
+func (t *Tracer) export(spans []*Span) error {
+	body, err := json.Marshal(t.otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := t.Client.Post(t.Endpoint+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpRequest builds an OTLP ExportTraceServiceRequest, in its JSON encoding.
+func (t *Tracer) otlpRequest(spans []*Span) map[string]interface{} {
+	jspans := make([]interface{}, 0, len(spans))
+	for _, sp := range spans {
+		jspan := map[string]interface{}{
+			"traceId":           hex.EncodeToString(sp.TraceID[:]),
+			"spanId":            hex.EncodeToString(sp.SpanID[:]),
+			"name":              sp.Name,
+			"kind":              sp.Kind,
+			"startTimeUnixNano": strconv.FormatInt(sp.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(sp.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(sp.Attributes),
+		}
+		if sp.ParentID != [8]byte{} {
+			jspan["parentSpanId"] = hex.EncodeToString(sp.ParentID[:])
+		}
+		if sp.Error != "" {
+			jspan["status"] = map[string]interface{}{
+				"code":    statusCodeError,
+				"message": sp.Error,
+			}
+		}
+		jspans = append(jspans, jspan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": t.ServiceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "mothd"},
+						"spans": jspans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes encodes attributes as a list of OTLP KeyValues.
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	ret := make([]interface{}, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		ret = append(ret, map[string]interface{}{"key": k, "value": value})
+	}
+	return ret
+}
+
+// WithContext returns a copy of mh for a request with context ctx.
+// Its puzzle and state providers record spans as children of the span in ctx.
+func (mh MothRequestHandler) WithContext(ctx context.Context) MothRequestHandler {
+	mh.ctx = ctx
+	if mh.Tracer == nil {
+		return mh
+	}
+	server := *mh.MothServer
+	server.State = tracedState{server.State, server.Tracer, ctx}
+	server.PuzzleProviders = make([]PuzzleProvider, len(mh.PuzzleProviders))
+	for i, provider := range mh.PuzzleProviders {
+		server.PuzzleProviders[i] = tracedPuzzleProvider{provider, server.Tracer, ctx}
+	}
+	mh.MothServer = &server
+	return mh
+}
+
+// tracedPuzzleProvider records a span for each call to a PuzzleProvider.
+type tracedPuzzleProvider struct {
+	PuzzleProvider
+	tracer *Tracer
+	ctx    context.Context
+}
+
+func (p tracedPuzzleProvider) Open(cat string, points int, path string) (ReadSeekCloser, time.Time, error) {
+	_, sp := p.tracer.Start(p.ctx, "PuzzleProvider.Open", "category", cat, "points", points, "path", path)
+	r, ts, err := p.PuzzleProvider.Open(cat, points, path)
+	sp.Finish(err)
+	return r, ts, err
+}
+
+func (p tracedPuzzleProvider) Inventory() []Category {
+	_, sp := p.tracer.Start(p.ctx, "PuzzleProvider.Inventory")
+	inv := p.PuzzleProvider.Inventory()
+	sp.Finish(nil)
+	return inv
+}
+
+func (p tracedPuzzleProvider) CheckAnswer(cat string, points int, answer string) (bool, error) {
+	_, sp := p.tracer.Start(p.ctx, "PuzzleProvider.CheckAnswer", "category", cat, "points", points)
+	correct, err := p.PuzzleProvider.CheckAnswer(cat, points, answer)
+	sp.SetAttributes("correct", correct)
+	sp.Finish(err)
+	return correct, err
+}
+
+func (p tracedPuzzleProvider) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	_, sp := p.tracer.Start(p.ctx, "PuzzleProvider.CheckAnswerPart", "category", cat, "points", points)
+	part, err := p.PuzzleProvider.CheckAnswerPart(cat, points, answer)
+	sp.Finish(err)
+	return part, err
+}
+
+// tracedState records a span for each call to a StateProvider.
+type tracedState struct {
+	StateProvider
+	tracer *Tracer
+	ctx    context.Context
+}
+
+func (s tracedState) PointsLog() award.List {
+	_, sp := s.tracer.Start(s.ctx, "State.PointsLog")
+	pl := s.StateProvider.PointsLog()
+	sp.SetAttributes("awards", len(pl))
+	sp.Finish(nil)
+	return pl
+}
+
+func (s tracedState) TeamName(teamID string) (string, error) {
+	_, sp := s.tracer.Start(s.ctx, "State.TeamName")
+	name, err := s.StateProvider.TeamName(teamID)
+	sp.Finish(err)
+	return name, err
+}
+
+func (s tracedState) SetTeamName(teamID, teamName string) error {
+	_, sp := s.tracer.Start(s.ctx, "State.SetTeamName")
+	err := s.StateProvider.SetTeamName(teamID, teamName)
+	sp.Finish(err)
+	return err
+}
+
+func (s tracedState) AwardPoints(teamID string, cat string, points int) error {
+	_, sp := s.tracer.Start(s.ctx, "State.AwardPoints", "category", cat, "points", points)
+	err := s.StateProvider.AwardPoints(teamID, cat, points)
+	sp.Finish(err)
+	return err
+}
+
+func (s tracedState) AwardCredit(teamID string, cat string, points int, part string, score int) error {
+	_, sp := s.tracer.Start(s.ctx, "State.AwardCredit", "category", cat, "points", points, "part", part, "score", score)
+	err := s.StateProvider.AwardCredit(teamID, cat, points, part, score)
+	sp.Finish(err)
+	return err
+}
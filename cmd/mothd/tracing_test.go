@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type otlpSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         int
+}
+
+func TestTracing(t *testing.T) {
+	var received []otlpSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/traces" {
+			t.Error("Wrong collector path:", req.URL.Path)
+		}
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan
+				}
+			}
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				received = append(received, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	server := NewTestServer()
+	server.Tracer = NewTracer(collector.URL+"/", "mothd-test")
+	hs := NewHTTPServer("/", server.MothServer)
+
+	vals := url.Values{}
+	vals.Set("id", TestTeamID)
+	vals.Set("cat", "pategory")
+	vals.Set("points", "1")
+	vals.Set("answer", "answer123")
+	req := httptest.NewRequest(http.MethodPost, "/answer", strings.NewReader(vals.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	hs.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := make([]*Span, 0)
+	for len(server.Tracer.spans) > 0 {
+		spans = append(spans, <-server.Tracer.spans)
+	}
+	if err := server.Tracer.export(spans); err != nil {
+		t.Fatal(err)
+	}
+
+	var root, check *otlpSpan
+	for i, sp := range received {
+		if sp.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Error("Span isn't part of caller's trace:", sp)
+		}
+		switch sp.Name {
+		case "POST /answer":
+			root = &received[i]
+		case "PuzzleProvider.CheckAnswer":
+			check = &received[i]
+		}
+	}
+	if root == nil || check == nil {
+		t.Fatal("Missing spans:", received)
+	}
+	if root.ParentSpanID != "00f067aa0ba902b7" {
+		t.Error("Request span has wrong parent:", root.ParentSpanID)
+	}
+	if root.Kind != spanKindServer {
+		t.Error("Request span has wrong kind:", root.Kind)
+	}
+	if check.ParentSpanID != root.SpanID {
+		t.Error("Provider span isn't a child of the request span")
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	var tracer *Tracer
+	_, sp := tracer.Start(context.Background(), "nothing")
+	sp.SetAttributes("key", "value")
+	sp.Finish(nil)
+
+	server := NewTestServer()
+	mh := server.NewHandler(TestTeamID)
+	if mh.WithContext(context.Background()).MothServer != mh.MothServer {
+		t.Error("Providers wrapped without a tracer")
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/dirtbags/moth/v4/pkg/transpile"
@@ -26,7 +27,7 @@ func (p TranspilerProvider) Inventory() []Category {
 	ret := make([]Category, 0)
 	inv, err := transpile.FsInventory(p.fs)
 	if err != nil {
-		log.Print(err)
+		slog.Error("reading inventory", "error", err)
 		return ret
 	}
 	for name, points := range inv {
@@ -45,7 +46,12 @@ func (c nopCloser) Close() error {
 
 // Open returns a file associated with the given category and point value.
 func (p TranspilerProvider) Open(cat string, points int, filename string) (ReadSeekCloser, time.Time, error) {
-	c := transpile.NewFsCategory(p.fs, cat)
+	return openCategoryFile(transpile.NewFsCategory(p.fs, cat), points, filename)
+}
+
+// openCategoryFile returns a file from c,
+// generating puzzle.json, and each translated puzzle.LOCALE.json, from the puzzle.
+func openCategoryFile(c transpile.Category, points int, filename string) (ReadSeekCloser, time.Time, error) {
 	switch filename {
 	case "", "puzzle.json":
 		p, err := c.Puzzle(points)
@@ -58,6 +64,21 @@ func (p TranspilerProvider) Open(cat string, points int, filename string) (ReadS
 		}
 		return nopCloser{bytes.NewReader(jp)}, time.Now(), nil
 	default:
+		if locale, ok := translationLocale(filename); ok {
+			p, err := c.Puzzle(points)
+			if err != nil {
+				return nopCloser{new(bytes.Reader)}, time.Time{}, err
+			}
+			lp, ok := p.Localized(locale)
+			if !ok {
+				return nopCloser{new(bytes.Reader)}, time.Time{}, fmt.Errorf("not translated into %s", locale)
+			}
+			jp, err := json.Marshal(lp)
+			if err != nil {
+				return nopCloser{new(bytes.Reader)}, time.Time{}, err
+			}
+			return nopCloser{bytes.NewReader(jp)}, time.Now(), nil
+		}
 		r, err := c.Open(points, filename)
 		return r, time.Now(), err
 	}
@@ -69,10 +90,16 @@ func (p TranspilerProvider) CheckAnswer(cat string, points int, answer string) (
 	return c.Answer(points, answer), nil
 }
 
-// Mothball packages up a category into a mothball.
+// CheckAnswerPart returns the name of the puzzle part solved by answer.
+func (p TranspilerProvider) CheckAnswerPart(cat string, points int, answer string) (string, error) {
+	c := transpile.NewFsCategory(p.fs, cat)
+	return c.AnswerPart(points, answer), nil
+}
+
+// Mothball packages up a category into a mothball for production.
 func (p TranspilerProvider) Mothball(cat string, w io.Writer) error {
 	c := transpile.NewFsCategory(p.fs, cat)
-	return transpile.Mothball(c, w)
+	return transpile.Mothball(c, w, transpile.ProductionProfile)
 }
 
 // Maintain performs housekeeping.
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/jsend"
+)
+
+// UnlocksDir has a file for each team an admin has unlocked puzzles for,
+// listing "category points" on each line.
+const UnlocksDir = "unlocks"
+
+// TeamUnlocks returns the puzzles an admin has unlocked for a team,
+// as a list of point values for each category.
+func (s *State) TeamUnlocks(teamID string) (map[string][]int, error) {
+	ret := make(map[string][]int)
+	f, err := s.Open(filepath.Join(UnlocksDir, teamID))
+	if os.IsNotExist(err) {
+		return ret, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		points, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		ret[fields[0]] = append(ret[fields[0]], points)
+	}
+	return ret, scanner.Err()
+}
+
+// SetTeamUnlock unlocks a puzzle for a team, whether or not they've reached it,
+// or, if unlocked is false, takes that back.
+// Puzzles the team reached on their own stay unlocked either way.
+func (s *State) SetTeamUnlock(teamID, cat string, points int, unlocked bool) error {
+	if _, err := s.TeamName(teamID); err != nil {
+		return ErrUnknownTeamID
+	}
+	if (cat == "") || strings.ContainsAny(cat, " \t\n") {
+		return fmt.Errorf("invalid category: %q", cat)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	unlocks, err := s.TeamUnlocks(teamID)
+	if err != nil {
+		return err
+	}
+	kept := make([]int, 0, len(unlocks[cat])+1)
+	for _, p := range unlocks[cat] {
+		if p != points {
+			kept = append(kept, p)
+		}
+	}
+	if unlocked {
+		kept = append(kept, points)
+	} else if len(kept) == len(unlocks[cat]) {
+		return fmt.Errorf("%s %d isn't unlocked for %s", cat, points, teamID)
+	}
+	unlocks[cat] = kept
+
+	cats := make([]string, 0, len(unlocks))
+	for cat := range unlocks {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	buf := new(strings.Builder)
+	for _, cat := range cats {
+		sort.Ints(unlocks[cat])
+		for _, points := range unlocks[cat] {
+			fmt.Fprintln(buf, cat, points)
+		}
+	}
+	s.Mkdir(UnlocksDir, 0755)
+	if err := s.writeFileAtomic(filepath.Join(UnlocksDir, teamID), []byte(buf.String())); err != nil {
+		return err
+	}
+
+	if unlocked {
+		s.LogEvent("unlock", teamID, cat, points)
+	} else {
+		s.LogEvent("relock", teamID, cat, points)
+	}
+	return nil
+}
+
+// withUnlocks returns puzzles, the puzzles a team has reached in a category,
+// with any of inventory in unlocks added, in order.
+// The end-of-category sentinel, 0, stays at the end.
+func withUnlocks(puzzles []int, inventory []int, unlocks []int) []int {
+	if len(unlocks) == 0 {
+		return puzzles
+	}
+	ret := make([]int, 0, len(puzzles)+len(unlocks))
+	end := false
+	for _, points := range puzzles {
+		if points == 0 {
+			end = true
+		} else {
+			ret = append(ret, points)
+		}
+	}
+	for _, points := range inventory {
+		if slices.Contains(unlocks, points) && !slices.Contains(ret, points) {
+			ret = append(ret, points)
+		}
+	}
+	sort.Ints(ret)
+	if end {
+		ret = append(ret, 0)
+	}
+	return ret
+}
+
+// AdminUnlockHandler unlocks a puzzle for one team.
+func (h *HTTPServer) AdminUnlockHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	h.adminSetUnlock(mh, w, req, true)
+}
+
+// AdminRelockHandler takes back a puzzle unlocked with AdminUnlockHandler.
+func (h *HTTPServer) AdminRelockHandler(mh MothRequestHandler, w http.ResponseWriter, req *http.Request) {
+	h.adminSetUnlock(mh, w, req, false)
+}
+
+func (h *HTTPServer) adminSetUnlock(mh MothRequestHandler, w http.ResponseWriter, req *http.Request, unlocked bool) {
+	if !requirePOST(w, req) {
+		return
+	}
+	short, done := "not relocked", "relocked"
+	if unlocked {
+		short, done = "not unlocked", "unlocked"
+	}
+	teamID := req.FormValue("team")
+	cat := req.FormValue("cat")
+	points, err := strconv.Atoi(req.FormValue("points"))
+	if (teamID == "") || (cat == "") || (err != nil) {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, short, "team, cat, and points are required")
+		return
+	}
+	if err := mh.State.SetTeamUnlock(teamID, cat, points, unlocked); err != nil {
+		jsend.SendfStatus(w, http.StatusBadRequest, jsend.Fail, short, "%s", err.Error())
+		return
+	}
+	mh.log.Info(done+" puzzle", "team", teamID, "category", cat, "points", points)
+	jsend.Sendf(w, jsend.Success, done, "%s %d %s for %s", cat, points, done, teamID)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithUnlocks(t *testing.T) {
+	if p := withUnlocks([]int{1}, []int{1, 2, 3}, []int{3, 9}); !reflect.DeepEqual(p, []int{1, 3}) {
+		t.Error("Wrong puzzles:", p)
+	}
+	if p := withUnlocks([]int{1, 2, 0}, []int{1, 2}, []int{2}); !reflect.DeepEqual(p, []int{1, 2, 0}) {
+		t.Error("Wrong puzzles at the end of a category:", p)
+	}
+}
+
+func TestTeamUnlock(t *testing.T) {
+	server := NewTestServer()
+	server.Config.AdminToken = "sekrit"
+	state := server.State.(*State)
+	go slurp(state.refreshNow)
+	hs := NewHTTPServer("/", server.MothServer)
+
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("team")
+	server.refresh()
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Authorization", "Bearer sekrit")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		hs.ServeHTTP(recorder, request)
+		return recorder
+	}
+	puzzles := func() []int {
+		handler := server.NewHandler(TestTeamID)
+		return handler.ExportState().Puzzles["pategory"]
+	}
+
+	if p := puzzles(); !reflect.DeepEqual(p, []int{1}) {
+		t.Fatal("Wrong puzzles to start with:", p)
+	}
+	if r := post("/admin/unlock", url.Values{"team": {TestTeamID}, "cat": {"pategory"}, "points": {"3"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if p := puzzles(); !reflect.DeepEqual(p, []int{1, 3}) {
+		t.Error("Wrong puzzles after unlocking:", p)
+	}
+	if r, _, err := handler.PuzzlesOpen("pategory", 3, "puzzle.json"); err != nil {
+		t.Error("Unlocked puzzle can't be opened:", err)
+	} else {
+		r.Close()
+	}
+	if unlocks, _ := state.TeamUnlocks(TestTeamID); !reflect.DeepEqual(unlocks, map[string][]int{"pategory": {3}}) {
+		t.Error("Wrong unlocks:", unlocks)
+	}
+
+	// Other teams don't get it
+	other := server.NewHandler("otherTeamID")
+	if other.unlocked("pategory", 3) {
+		t.Error("Unlock leaked to another team")
+	}
+
+	if r := post("/admin/relock", url.Values{"team": {TestTeamID}, "cat": {"pategory"}, "points": {"3"}}); r.Code != http.StatusOK {
+		t.Fatal(r.Code, r.Body.String())
+	}
+	if p := puzzles(); !reflect.DeepEqual(p, []int{1}) {
+		t.Error("Wrong puzzles after relocking:", p)
+	}
+	if _, _, err := handler.PuzzlesOpen("pategory", 3, "puzzle.json"); err != ErrPuzzleLocked {
+		t.Error("Relocked puzzle can be opened:", err)
+	}
+
+	for path, form := range map[string]url.Values{
+		"/admin/relock": {"team": {TestTeamID}, "cat": {"pategory"}, "points": {"3"}},
+		"/admin/unlock": {"team": {"nobody"}, "cat": {"pategory"}, "points": {"3"}},
+	} {
+		if r := post(path, form); r.Code != http.StatusBadRequest {
+			t.Error(path, form, r.Code)
+		}
+	}
+	if r := post("/admin/unlock", url.Values{"team": {TestTeamID}, "cat": {"pategory"}}); r.Code != http.StatusBadRequest {
+		t.Error("Unlocked without points:", r.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+)
+
+// ErrUploadRequired means a puzzle is answered by uploading a file, not with text.
+var ErrUploadRequired = errors.New("this puzzle is answered by uploading a file")
+
+// ErrNotUploadPuzzle means a file was uploaded for a puzzle answered with text.
+var ErrNotUploadPuzzle = errors.New("this puzzle is not answered by uploading a file")
+
+// ErrUploadTooLarge means an uploaded file is bigger than the puzzle or server allows.
+var ErrUploadTooLarge = errors.New("uploaded file is too large")
+
+// ErrTooManyUploads means a team has uploaded too many files recently.
+var ErrTooManyUploads = errors.New("too many uploads: wait before trying again")
+
+// uploadFormOverhead is how much bigger than the largest upload a request body may be,
+// to make room for the rest of the form.
+const uploadFormOverhead = 64 * 1024
+
+// uploadLimiter remembers when each team uploaded files in the last hour.
+type uploadLimiter struct {
+	lock    sync.Mutex
+	uploads map[string][]time.Time
+}
+
+func newUploadLimiter() *uploadLimiter {
+	return &uploadLimiter{
+		uploads: make(map[string][]time.Time),
+	}
+}
+
+// allow returns true, and records an upload, if teamID has uploaded fewer than limit files in the last hour.
+// A limit of zero or less allows everything.
+func (ul *uploadLimiter) allow(teamID string, limit int) bool {
+	if (ul == nil) || (limit <= 0) {
+		return true
+	}
+	ul.lock.Lock()
+	defer ul.lock.Unlock()
+
+	now := time.Now()
+	recent := ul.uploads[teamID][:0]
+	for _, when := range ul.uploads[teamID] {
+		if now.Sub(when) < time.Hour {
+			recent = append(recent, when)
+		}
+	}
+	if len(recent) >= limit {
+		ul.uploads[teamID] = recent
+		return false
+	}
+	ul.uploads[teamID] = append(recent, now)
+	return true
+}
+
+// isUploadPuzzle returns true if a puzzle is answered by uploading a file.
+func (mh *MothRequestHandler) isUploadPuzzle(cat string, points int) bool {
+	puzzle, err := mh.puzzle(cat, points)
+	return (err == nil) && (puzzle.Checker == transpile.UploadChecker)
+}
+
+// uploadMaxSize returns the largest file, in bytes, that may be uploaded for a puzzle.
+func (mh *MothRequestHandler) uploadMaxSize(cat string, points int) int64 {
+	max := mh.Config.UploadMaxSize
+	if puzzle, err := mh.puzzle(cat, points); (err == nil) && (puzzle.UploadMaxSize > 0) {
+		max = min(max, puzzle.UploadMaxSize)
+	}
+	return max
+}
+
+// SubmitUpload checks a file uploaded to answer a puzzle, and awards points if it's correct.
+//
+// The file is saved in a new temporary directory,
+// where the puzzle's checker command looks at it.
+// The directory is removed once the file has been checked.
+//
+// Only registered teams may upload files,
+// and no more than Config.UploadsPerHour of them an hour.
+// Uploads count as answers: they're subject to pauses and cooldowns,
+// and wrong ones count toward the next cooldown.
+func (mh *MothRequestHandler) SubmitUpload(cat string, points int, r io.Reader) (string, error) {
+	if !mh.isUploadPuzzle(cat, points) {
+		return "", ErrNotUploadPuzzle
+	}
+	if _, err := mh.State.TeamName(mh.teamID); err != nil {
+		return "", ErrInvalidTeamID
+	}
+
+	dir, err := os.MkdirTemp("", transpile.UploadDirPrefix)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "upload")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	max := mh.uploadMaxSize(cat, points)
+	n, err := io.Copy(f, io.LimitReader(r, max+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > max {
+		return "", ErrUploadTooLarge
+	}
+
+	if !mh.uploads.allow(mh.teamID, mh.Config.UploadsPerHour) {
+		mh.State.LogEvent("uploadlimit", mh.teamID, cat, points)
+		return "", ErrTooManyUploads
+	}
+	mh.log.Info("checking upload", "category", cat, "points", points, "size", n)
+	return mh.queueAnswer("", cat, points, path, true)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// WebhookQueueLength is how many events can wait to be sent to a webhook.
+// Events arriving when the queue is full are dropped.
+const WebhookQueueLength = 100
+
+// WebhookAttempts is how many times delivery of an event is attempted.
+const WebhookAttempts = 3
+
+// WebhookSignatureHeader carries the HMAC-SHA256 signature of the request body.
+const WebhookSignatureHeader = "X-Moth-Signature"
+
+// Webhook is an EventListener which sends each event to a URL,
+// as a JSON object in the body of a POST request.
+//
+// If Secret is set, requests are signed with it:
+// see WebhookSignature.
+type Webhook struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+	events chan Event
+}
+
+// NewWebhook returns a new Webhook.
+func NewWebhook(url string, secret string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Secret: []byte(secret),
+		Client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan Event, WebhookQueueLength),
+	}
+}
+
+// WebhookSignature returns the signature of body, using secret.
+//
+// This is "sha256=" followed by the hex-encoded HMAC-SHA256 of body.
+func WebhookSignature(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify queues event for delivery.
+func (wh *Webhook) Notify(event Event) {
+	select {
+	case wh.events <- event:
+	default:
+		slog.Warn("webhook queue full, dropping event", "url", wh.URL, "event", event.Type)
+	}
+}
+
+// send makes one attempt to deliver event.
+func (wh *Webhook) send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Moth-Event", event.Type)
+	if len(wh.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, WebhookSignature(wh.Secret, body))
+	}
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Maintain delivers queued events, in order.
+// Failed deliveries are retried after updateInterval.
+func (wh *Webhook) Maintain(updateInterval time.Duration) {
+	for event := range wh.events {
+		for attempt := 1; attempt <= WebhookAttempts; attempt++ {
+			err := wh.send(event)
+			if err == nil {
+				break
+			}
+			slog.Warn("webhook sending event", "url", wh.URL, "event", event.Type, "attempt", attempt, "error", err)
+			if attempt < WebhookAttempts {
+				time.Sleep(updateInterval)
+			}
+		}
+	}
+}
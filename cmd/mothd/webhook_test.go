@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Event, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get(WebhookSignatureHeader) != WebhookSignature([]byte("sekrit"), body) {
+			t.Error("Bad signature", req.Header.Get(WebhookSignatureHeader))
+		}
+		if req.Header.Get("X-Moth-Event") == "" {
+			t.Error("No event type header")
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		received <- event
+	}))
+	defer ts.Close()
+
+	wh := NewWebhook(ts.URL, "sekrit")
+	go wh.Maintain(10 * time.Millisecond)
+
+	server := NewTestServer()
+	server.Listeners = append(server.Listeners, wh)
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+
+	if err := handler.Register("GoTeam"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	for _, answer := range []struct {
+		points int
+		answer string
+	}{{1, "answer123"}, {2, "wat"}} {
+		if err := handler.CheckAnswer("pategory", answer.points, answer.answer); err != nil {
+			t.Fatal(err)
+		}
+		server.refresh()
+	}
+
+	expected := []Event{
+		{Type: EventRegister, TeamName: "GoTeam"},
+		{Type: EventAward, TeamName: "GoTeam", Category: "pategory", Points: 1, Score: 1},
+		{Type: EventAward, TeamName: "GoTeam", Category: "pategory", Points: 2, Score: 2},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-received:
+			got.When = time.Time{}
+			if got != want {
+				t.Errorf("Wrong event: got %#v, wanted %#v", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for", want.Type)
+		}
+	}
+}
+
+func TestCategoryComplete(t *testing.T) {
+	server := NewTestServer()
+	events := make(chan Event, 10)
+	server.Listeners = append(server.Listeners, eventRecorder(events))
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+	handler.Register("GoTeam")
+	server.refresh()
+
+	// pategory has three puzzles, and the test mothball has no answer for the 3-pointer,
+	// so pretend it's already been solved.
+	server.State.AwardPoints(TestTeamID, "pategory", 3)
+	handler.CheckAnswer("pategory", 1, "answer123")
+	server.refresh()
+	handler.CheckAnswer("pategory", 2, "wat")
+	close(events)
+
+	complete := 0
+	for event := range events {
+		if event.Type == EventComplete {
+			complete++
+			if event.Category != "pategory" {
+				t.Error("Wrong category completed", event)
+			}
+		}
+	}
+	if complete != 1 {
+		t.Error("Wrong number of completion events:", complete)
+	}
+}
+
+type eventRecorder chan Event
+
+func (r eventRecorder) Notify(event Event) {
+	r <- event
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XAPIQueueLength is how many statements can wait to be sent to a learning record store.
+// Statements arriving when the queue is full are dropped.
+const XAPIQueueLength = 100
+
+// XAPIVersion is the version of the Experience API spoken.
+const XAPIVersion = "1.0.3"
+
+// xAPI verbs, from the ADL vocabulary.
+const (
+	XAPIExperienced = "http://adlnet.gov/expapi/verbs/experienced"
+	XAPIAnswered    = "http://adlnet.gov/expapi/verbs/answered"
+	XAPICompleted   = "http://adlnet.gov/expapi/verbs/completed"
+)
+
+// xAPI activity types, from the ADL vocabulary.
+const (
+	XAPIInteraction = "http://adlnet.gov/expapi/activities/cmi.interaction"
+	XAPIModule      = "http://adlnet.gov/expapi/activities/module"
+)
+
+// XAPIStatement is an Experience API statement.
+// Only the parts MOTH uses are here.
+type XAPIStatement struct {
+	Actor     XAPIActor    `json:"actor"`
+	Verb      XAPIVerb     `json:"verb"`
+	Object    XAPIActivity `json:"object"`
+	Result    *XAPIResult  `json:"result,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// XAPIActor is the team a statement is about.
+// Teams are identified by an account on the event's home page,
+// named by the team name, since team IDs are secrets.
+type XAPIActor struct {
+	ObjectType string      `json:"objectType"`
+	Name       string      `json:"name"`
+	Account    XAPIAccount `json:"account"`
+}
+
+// XAPIAccount is an account on some system.
+type XAPIAccount struct {
+	HomePage string `json:"homePage"`
+	Name     string `json:"name"`
+}
+
+// XAPIVerb is what a team did.
+type XAPIVerb struct {
+	ID      string            `json:"id"`
+	Display map[string]string `json:"display"`
+}
+
+// XAPIActivity is a puzzle or a category.
+type XAPIActivity struct {
+	ObjectType string                 `json:"objectType"`
+	ID         string                 `json:"id"`
+	Definition XAPIActivityDefinition `json:"definition"`
+}
+
+// XAPIActivityDefinition describes an activity.
+type XAPIActivityDefinition struct {
+	Name map[string]string `json:"name"`
+	Type string            `json:"type"`
+}
+
+// XAPIResult is the outcome of answering a puzzle.
+type XAPIResult struct {
+	Success    bool           `json:"success"`
+	Completion bool           `json:"completion"`
+	Score      *XAPIScore     `json:"score,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// XAPIScore is the points an answer earned.
+type XAPIScore struct {
+	Raw int `json:"raw"`
+}
+
+// XAPI is an EventListener which sends Experience API (Tin Can) statements
+// to a learning record store:
+// "experienced" when a team loads a puzzle,
+// "answered" when it submits an answer that doesn't solve the whole puzzle,
+// and "completed" when it solves a puzzle or a category.
+type XAPI struct {
+	// URL is the learning record store's endpoint.
+	// Statements are sent to its statements resource.
+	URL string
+
+	// Auth is sent in the Authorization header, if it's set.
+	Auth string
+
+	// Home is the event's home page.
+	// Team accounts are on it, and puzzle activity IDs begin with it.
+	Home string
+
+	Client     *http.Client
+	statements chan XAPIStatement
+}
+
+// NewXAPI returns a new XAPI.
+//
+// auth may be "username:password", for HTTP Basic authentication,
+// or a whole Authorization header, like "Bearer xyz".
+func NewXAPI(endpoint string, auth string, home string) *XAPI {
+	if (auth != "") && !strings.Contains(auth, " ") {
+		username, password, _ := strings.Cut(auth, ":")
+		req := http.Request{Header: make(http.Header)}
+		req.SetBasicAuth(username, password)
+		auth = req.Header.Get("Authorization")
+	}
+	return &XAPI{
+		URL:        strings.TrimRight(endpoint, "/") + "/statements",
+		Auth:       auth,
+		Home:       strings.TrimRight(home, "/"),
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		statements: make(chan XAPIStatement, XAPIQueueLength),
+	}
+}
+
+// Statement returns the statement for event,
+// or false if there isn't one.
+func (x *XAPI) Statement(event Event) (XAPIStatement, bool) {
+	st := XAPIStatement{
+		Actor: XAPIActor{
+			ObjectType: "Agent",
+			Name:       event.TeamName,
+			Account:    XAPIAccount{HomePage: x.Home, Name: event.TeamName},
+		},
+		Object: XAPIActivity{
+			ObjectType: "Activity",
+			ID:         x.Home + "/" + url.PathEscape(event.Category) + "/" + strconv.Itoa(event.Points),
+			Definition: XAPIActivityDefinition{
+				Name: map[string]string{"en-US": fmt.Sprintf("%s %d", event.Category, event.Points)},
+				Type: XAPIInteraction,
+			},
+		},
+		Timestamp: event.When,
+	}
+
+	switch event.Type {
+	case EventLoad:
+		st.Verb = xapiVerb(XAPIExperienced, "experienced")
+	case EventWrong:
+		st.Verb = xapiVerb(XAPIAnswered, "answered")
+		st.Result = &XAPIResult{}
+	case EventAward:
+		score := &XAPIScore{Raw: event.Score}
+		if event.Part != "" {
+			st.Verb = xapiVerb(XAPIAnswered, "answered")
+			st.Result = &XAPIResult{
+				Success:    true,
+				Score:      score,
+				Extensions: map[string]any{x.Home + "/part": event.Part},
+			}
+		} else {
+			st.Verb = xapiVerb(XAPICompleted, "completed")
+			st.Result = &XAPIResult{Success: true, Completion: true, Score: score}
+		}
+	case EventComplete:
+		st.Verb = xapiVerb(XAPICompleted, "completed")
+		st.Object.ID = x.Home + "/" + url.PathEscape(event.Category)
+		st.Object.Definition = XAPIActivityDefinition{
+			Name: map[string]string{"en-US": event.Category},
+			Type: XAPIModule,
+		}
+		st.Result = &XAPIResult{Success: true, Completion: true}
+	default:
+		return st, false
+	}
+	return st, true
+}
+
+func xapiVerb(id string, display string) XAPIVerb {
+	return XAPIVerb{
+		ID:      id,
+		Display: map[string]string{"en-US": display},
+	}
+}
+
+// Notify queues the statement for event, if there is one.
+func (x *XAPI) Notify(event Event) {
+	st, ok := x.Statement(event)
+	if !ok {
+		return
+	}
+	select {
+	case x.statements <- st:
+	default:
+		slog.Warn("xapi queue full, dropping statement", "url", x.URL, "event", event.Type)
+	}
+}
+
+// send makes one attempt to deliver st.
+func (x *XAPI) send(st XAPIStatement) error {
+	body, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, x.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Experience-API-Version", XAPIVersion)
+	if x.Auth != "" {
+		req.Header.Set("Authorization", x.Auth)
+	}
+
+	resp, err := x.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// Maintain delivers queued statements, in order.
+// Failed deliveries are retried after updateInterval.
+func (x *XAPI) Maintain(updateInterval time.Duration) {
+	for st := range x.statements {
+		for attempt := 1; attempt <= WebhookAttempts; attempt++ {
+			err := x.send(st)
+			if err == nil {
+				break
+			}
+			slog.Warn("xapi sending statement", "url", x.URL, "verb", st.Verb.ID, "attempt", attempt, "error", err)
+			if attempt < WebhookAttempts {
+				time.Sleep(updateInterval)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestXAPI(t *testing.T) {
+	received := make(chan XAPIStatement, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/xapi/statements" {
+			t.Error("Wrong path", req.URL.Path)
+		}
+		if username, password, ok := req.BasicAuth(); !ok || (username != "moth") || (password != "sekrit") {
+			t.Error("Wrong credentials", req.Header.Get("Authorization"))
+		}
+		if req.Header.Get("X-Experience-API-Version") != XAPIVersion {
+			t.Error("No version header")
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var st XAPIStatement
+		if err := json.Unmarshal(body, &st); err != nil {
+			t.Error(err)
+		}
+		received <- st
+	}))
+	defer ts.Close()
+
+	x := NewXAPI(ts.URL+"/xapi/", "moth:sekrit", "https://moth.example.org/")
+	go x.Maintain(10 * time.Millisecond)
+
+	server := NewTestServer()
+	server.Listeners = append(server.Listeners, x)
+	go slurp(server.State.(*State).refreshNow)
+	handler := server.NewHandler(TestTeamID)
+
+	if err := handler.Register("GoTeam"); err != nil {
+		t.Fatal(err)
+	}
+	server.refresh()
+	if r, _, err := handler.PuzzlesOpen("pategory", 1, "puzzle.json"); err != nil {
+		t.Fatal(err)
+	} else {
+		r.Close()
+	}
+	handler.CheckAnswer("pategory", 1, "wrong")
+	if err := handler.CheckAnswer("pategory", 1, "answer123"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		verb    string
+		success bool
+	}{
+		{XAPIExperienced, false},
+		{XAPIAnswered, false},
+		{XAPICompleted, true},
+	}
+	for _, want := range expected {
+		select {
+		case got := <-received:
+			if got.Verb.ID != want.verb {
+				t.Errorf("Wrong verb: got %s, wanted %s", got.Verb.ID, want.verb)
+			}
+			if got.Actor.Account.Name != "GoTeam" || got.Actor.Account.HomePage != "https://moth.example.org" {
+				t.Error("Wrong actor:", got.Actor)
+			}
+			if got.Object.ID != "https://moth.example.org/pategory/1" {
+				t.Error("Wrong activity:", got.Object.ID)
+			}
+			if (got.Result != nil) && (got.Result.Success != want.success) {
+				t.Error("Wrong result:", got.Result)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for", want.verb)
+		}
+	}
+
+	if _, ok := x.Statement(Event{Type: EventRegister}); ok {
+		t.Error("Registration made a statement")
+	}
+	if st, ok := x.Statement(Event{Type: EventComplete, Category: "web"}); !ok {
+		t.Error("Category completion made no statement")
+	} else if (st.Object.ID != "https://moth.example.org/web") || (st.Verb.ID != XAPICompleted) {
+		t.Error("Wrong category completion statement:", st)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/transpile"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/zipfs"
+)
+
+// openExport returns the contents of the export called filename,
+// which is either a directory or a zip file.
+// Zip files are read into memory.
+// Exports zipped with a top directory are looked at inside it.
+func (t *T) openExport(filename string) (afero.Fs, error) {
+	fi, err := t.BaseFs.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return afero.NewBasePathFs(t.BaseFs, filename), nil
+	}
+
+	buf, err := afero.ReadFile(t.BaseFs, filename)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	export := zipfs.New(zr)
+	for _, f := range zr.File {
+		if top, ok := strings.CutSuffix(f.Name, "db/challenges.json"); ok && (top != "") {
+			return afero.NewBasePathFs(export, top), nil
+		}
+	}
+	return export, nil
+}
+
+// ImportCTFd converts a CTFd export to a puzzle tree,
+// or with -mothballs, to a mothball for each category.
+func (t *T) ImportCTFd() error {
+	if len(t.Args) != 2 {
+		return fmt.Errorf("usage: import EXPORT DIRECTORY")
+	}
+	export, err := t.openExport(t.Args[0])
+	if err != nil {
+		return err
+	}
+	outdir := t.Args[1]
+
+	if !t.mothballs {
+		if err := t.BaseFs.MkdirAll(outdir, 0755); err != nil {
+			return err
+		}
+		return transpile.ImportCTFd(export, afero.NewBasePathFs(t.BaseFs, outdir))
+	}
+
+	profile, err := t.buildProfile(transpile.ProductionProfile)
+	if err != nil {
+		return err
+	}
+	puzzles := afero.NewMemMapFs()
+	if err := transpile.ImportCTFd(export, puzzles); err != nil {
+		return err
+	}
+	categories, err := afero.ReadDir(puzzles, "/")
+	if err != nil {
+		return err
+	}
+	if err := t.BaseFs.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	for _, category := range categories {
+		c := transpile.NewFsCategory(puzzles, category.Name())
+		if err := t.writeMothball(c, filepath.Join(outdir, category.Name()+".mb"), profile); err != nil {
+			return fmt.Errorf("%s: %w", category.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Export converts every category to challenges for another platform:
+// ctfcli challenge directories for CTFd,
+// or challenges.json and the attachments it links to, for rCTF.
+func (t *T) Export() error {
+	if len(t.Args) != 1 {
+		return fmt.Errorf("usage: export DIRECTORY")
+	}
+	if (t.format != "ctfd") && (t.format != "rctf") {
+		return fmt.Errorf("unknown export format: %s", t.format)
+	}
+	outdir := t.Args[0]
+	if err := t.BaseFs.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	dst := afero.NewBasePathFs(t.BaseFs, outdir)
+
+	dirEnts, err := afero.ReadDir(t.fs, ".")
+	if err != nil {
+		return err
+	}
+	challenges := []transpile.RCTFChallenge{}
+	for _, ent := range dirEnts {
+		if !ent.IsDir() || strings.HasPrefix(ent.Name(), ".") {
+			continue
+		}
+		c := t.tagged(transpile.NewFsCategory(t.fs, ent.Name()))
+		switch t.format {
+		case "ctfd":
+			err = transpile.ExportCTFd(c, ent.Name(), dst)
+		case "rctf":
+			var cc []transpile.RCTFChallenge
+			cc, err = transpile.ExportRCTF(c, ent.Name(), dst, t.filesURL)
+			challenges = append(challenges, cc...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.format == "rctf" {
+		buf, err := json.MarshalIndent(challenges, "", "  ")
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(dst, "challenges.json", buf, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dirtbags/moth/v4/pkg/mothball"
+)
+
+// DiffMothballs prints what changed between two mothballs:
+// puzzles added and removed,
+// and for every other puzzle, its answers, checker, files, and body.
+func (t *T) DiffMothballs() error {
+	if len(t.Args) != 2 {
+		return fmt.Errorf("usage: diff OLD.mb NEW.mb")
+	}
+	oldmb, err := mothball.Open(t.BaseFs, t.Args[0])
+	if err != nil {
+		return err
+	}
+	defer oldmb.Close()
+	newmb, err := mothball.Open(t.BaseFs, t.Args[1])
+	if err != nil {
+		return err
+	}
+	defer newmb.Close()
+
+	oldInv, err := oldmb.Inventory()
+	if err != nil {
+		return fmt.Errorf("%s: %w", t.Args[0], err)
+	}
+	newInv, err := newmb.Inventory()
+	if err != nil {
+		return fmt.Errorf("%s: %w", t.Args[1], err)
+	}
+
+	inv := append(slices.Clone(oldInv), newInv...)
+	sort.Ints(inv)
+	inv = slices.Compact(inv)
+	for _, points := range inv {
+		inOld := slices.Contains(oldInv, points)
+		inNew := slices.Contains(newInv, points)
+		switch {
+		case !inOld:
+			fmt.Fprintf(t.Stdout, "puzzle %d: added\n", points)
+		case !inNew:
+			fmt.Fprintf(t.Stdout, "puzzle %d: removed\n", points)
+		default:
+			if err := t.diffPuzzle(oldmb, newmb, points); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffPuzzle prints what changed in the puzzle worth points.
+func (t *T) diffPuzzle(oldmb, newmb *mothball.Reader, points int) error {
+	say := func(format string, a ...any) {
+		fmt.Fprintf(t.Stdout, "puzzle %d: %s\n", points, fmt.Sprintf(format, a...))
+	}
+
+	// Answers
+	oldAnswers, _ := oldmb.Answers(points)
+	newAnswers, _ := newmb.Answers(points)
+	diffAnswers(say, "answers", oldAnswers, newAnswers)
+	if o, n := oldmb.Checker(points), newmb.Checker(points); o != n {
+		say("checker: %q -> %q", o, n)
+	}
+	oldParts := partAnswers(oldmb.Parts(points))
+	newParts := partAnswers(newmb.Parts(points))
+	for _, name := range sortedKeys(oldParts, newParts) {
+		diffAnswers(say, "part "+name+" answers", oldParts[name], newParts[name])
+	}
+
+	// puzzle.json
+	oldPuzzle, err := readPuzzleFields(oldmb, points)
+	if err != nil {
+		return err
+	}
+	newPuzzle, err := readPuzzleFields(newmb, points)
+	if err != nil {
+		return err
+	}
+	for _, field := range sortedKeys(oldPuzzle, newPuzzle) {
+		switch field {
+		case "Body":
+			continue
+		case "AnswerSalt", "AnswerHashes":
+			// The salt is new every build, and answers were compared already
+			continue
+		case "Parts", "Tiers":
+			// Each has hashes with the same salt
+			oldPuzzle[field] = withoutHashes(oldPuzzle[field])
+			newPuzzle[field] = withoutHashes(newPuzzle[field])
+		}
+		if !bytes.Equal(oldPuzzle[field], newPuzzle[field]) {
+			say("%s changed", field)
+		}
+	}
+	var oldBody, newBody string
+	json.Unmarshal(oldPuzzle["Body"], &oldBody)
+	json.Unmarshal(newPuzzle["Body"], &newBody)
+	if oldBody != newBody {
+		say("body:")
+		for _, line := range diffLines(strings.Split(oldBody, "\n"), strings.Split(newBody, "\n")) {
+			fmt.Fprintln(t.Stdout, line)
+		}
+	}
+
+	// Attachments, scripts, and translations
+	oldSums, err := fileSums(oldmb, points)
+	if err != nil {
+		return err
+	}
+	newSums, err := fileSums(newmb, points)
+	if err != nil {
+		return err
+	}
+	for _, filename := range sortedKeys(oldSums, newSums) {
+		o, inOld := oldSums[filename]
+		n, inNew := newSums[filename]
+		switch {
+		case !inOld:
+			say("%s: added", filename)
+		case !inNew:
+			say("%s: removed", filename)
+		case o != n:
+			say("%s: changed, sha256 %.12s -> %.12s", filename, o, n)
+		}
+	}
+
+	return nil
+}
+
+// diffAnswers says which answers were removed and added.
+func diffAnswers(say func(string, ...any), what string, oldAnswers, newAnswers []string) {
+	for _, answer := range oldAnswers {
+		if !slices.Contains(newAnswers, answer) {
+			say("%s: removed %q", what, answer)
+		}
+	}
+	for _, answer := range newAnswers {
+		if !slices.Contains(oldAnswers, answer) {
+			say("%s: added %q", what, answer)
+		}
+	}
+}
+
+// partAnswers returns the answers to each part, by name.
+func partAnswers(parts []mothball.Part) map[string][]string {
+	ret := make(map[string][]string)
+	for _, part := range parts {
+		ret[part.Name] = append(ret[part.Name], part.Answers...)
+	}
+	return ret
+}
+
+// withoutHashes returns a list of parts or tiers from puzzle.json,
+// without their answer hashes.
+func withoutHashes(list json.RawMessage) json.RawMessage {
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(list, &items); err != nil {
+		return list
+	}
+	for _, item := range items {
+		delete(item, "AnswerHashes")
+	}
+	buf, err := json.Marshal(items)
+	if err != nil {
+		return list
+	}
+	return buf
+}
+
+// readPuzzleFields returns each field in the puzzle.json of the puzzle worth points.
+func readPuzzleFields(mb *mothball.Reader, points int) (map[string]json.RawMessage, error) {
+	buf, err := mb.ReadFile(points, mothball.PuzzleFile)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return nil, fmt.Errorf("%d/%s: %w", points, mothball.PuzzleFile, err)
+	}
+	return fields, nil
+}
+
+// fileSums returns the hex SHA-256 of every file the puzzle worth points lists,
+// by filename.
+func fileSums(mb *mothball.Reader, points int) (map[string]string, error) {
+	files, err := mb.Files(points)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	for _, filename := range files {
+		f, err := mb.Open(points, filename)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		sums[filename] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// sortedKeys returns every key in a or b, sorted.
+func sortedKeys[V any](a, b map[string]V) []string {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffLines returns the lines removed from a, starting with "-",
+// and added to b, starting with "+",
+// in the order they appear.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ret := []string{}
+	i, j := 0, 0
+	for (i < len(a)) || (j < len(b)) {
+		switch {
+		case (i < len(a)) && (j < len(b)) && (a[i] == b[j]):
+			i++
+			j++
+		case (j == len(b)) || ((i < len(a)) && (lcs[i+1][j] >= lcs[i][j+1])):
+			ret = append(ret, "-"+a[i])
+			i++
+		default:
+			ret = append(ret, "+"+b[j])
+			j++
+		}
+	}
+	return ret
+}
@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/dirtbags/moth/v4/pkg/transpile"
 
@@ -22,6 +26,41 @@ type T struct {
 	Args   []string
 	BaseFs afero.Fs
 	fs     afero.Fs
+
+	// mkpuzzle is the language for "new" to write mkpuzzle in
+	mkpuzzle string
+
+	// profile is the name of the BuildProfile to use,
+	// or empty for the command's default
+	profile string
+
+	// catalog is whether "inventory" describes every category
+	catalog bool
+
+	// manifest is the event manifest for "mothball" to build every category in
+	manifest string
+
+	// strict is whether "mothball" refuses to build a category with lint errors
+	strict bool
+
+	// mothballs is whether "import" builds mothballs instead of a puzzle tree
+	mothballs bool
+
+	// format is the platform for "export" to write challenges for
+	format string
+
+	// filesURL is where "export -format rctf" says attachments are served from
+	filesURL string
+
+	// title is the title of the site "staticsite" writes
+	title string
+
+	// tags, if set, is a comma-separated list of tags,
+	// and "export" and "staticsite" only write puzzles with one of them
+	tags string
+
+	// LogLevel is the least important level of log message to show
+	LogLevel slog.Level
 }
 
 // Command is a function invoked by the user
@@ -34,8 +73,12 @@ func nothing() error {
 func usage(w io.Writer) {
 	fmt.Fprintln(w, " Usage: transpile mothball [FLAGS] [MOTHBALL]")
 	fmt.Fprintln(w, "        Compile a mothball")
+	fmt.Fprintln(w, " Usage: transpile mothball [FLAGS] -manifest MANIFEST DIRECTORY")
+	fmt.Fprintln(w, "        Compile a mothball for every category in MANIFEST into DIRECTORY")
+	fmt.Fprintln(w, " Usage: lint [FLAGS]")
+	fmt.Fprintln(w, "        Check a category for answers shared between puzzles")
 	fmt.Fprintln(w, " Usage: inventory [FLAGS]")
-	fmt.Fprintln(w, "        Show category inventory")
+	fmt.Fprintln(w, "        Show category inventory, or with -catalog, describe every category")
 	fmt.Fprintln(w, " Usage: puzzle [FLAGS]")
 	fmt.Fprintln(w, "        Print puzzle JSON")
 	fmt.Fprintln(w, " Usage: file [FLAGS] FILENAME")
@@ -44,9 +87,46 @@ func usage(w io.Writer) {
 	fmt.Fprintln(w, "        Check correctness of an answer")
 	fmt.Fprintln(w, " Usage: markdown [FLAGS]")
 	fmt.Fprintln(w, "        Format stdin with markdown")
+	fmt.Fprintln(w, " Usage: new [FLAGS] CATEGORY POINTS")
+	fmt.Fprintln(w, "        Create a new puzzle in CATEGORY worth POINTS")
+	fmt.Fprintln(w, " Usage: diff OLD.mb NEW.mb")
+	fmt.Fprintln(w, "        Show puzzles, answers, files, and bodies changed between two mothballs")
+	fmt.Fprintln(w, " Usage: import [FLAGS] EXPORT DIRECTORY")
+	fmt.Fprintln(w, "        Convert a CTFd export, zipped or not, to a category for each CTFd category in DIRECTORY")
+	fmt.Fprintln(w, " Usage: export [FLAGS] DIRECTORY")
+	fmt.Fprintln(w, "        Convert every category to challenges for another platform, in DIRECTORY")
+	fmt.Fprintln(w, " Usage: staticsite [FLAGS] DIRECTORY")
+	fmt.Fprintln(w, "        Write every category, or with -manifest, every category in MANIFEST, as a web site in DIRECTORY")
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "-dir DIRECTORY")
 	fmt.Fprintln(w, "        Use puzzle in DIRECTORY")
+	fmt.Fprintln(w, "-loglevel LEVEL")
+	fmt.Fprintln(w, "        Show log messages at LEVEL or above: debug, info, warn, error")
+	fmt.Fprintln(w, "-spellcheck DICTIONARY[,DICTIONARY...]")
+	fmt.Fprintln(w, "        List words in puzzles that aren't in any DICTIONARY in the debug log")
+	fmt.Fprintln(w, "-check-links")
+	fmt.Fprintln(w, "        List links in puzzles to web sites that don't work as debug errors")
+	fmt.Fprintln(w, "-profile PROFILE")
+	fmt.Fprintln(w, "        With puzzle, mothball, or staticsite, leave in what PROFILE keeps: devel, staging, production")
+	fmt.Fprintln(w, "        (puzzle defaults to devel, mothball and staticsite to production)")
+	fmt.Fprintln(w, "-catalog")
+	fmt.Fprintln(w, "        With inventory, describe every puzzle in every category in DIRECTORY")
+	fmt.Fprintln(w, "-manifest MANIFEST")
+	fmt.Fprintln(w, "        With mothball or staticsite, build every category listed in MANIFEST")
+	fmt.Fprintln(w, "-strict")
+	fmt.Fprintln(w, "        With mothball, fail if lint finds errors")
+	fmt.Fprintln(w, "-mothballs")
+	fmt.Fprintln(w, "        With import, write a mothball for each category instead of its puzzles")
+	fmt.Fprintln(w, "-format FORMAT")
+	fmt.Fprintln(w, "        With export, write challenges for FORMAT: ctfd (the default) or rctf")
+	fmt.Fprintln(w, "-files-url URL")
+	fmt.Fprintln(w, "        With export -format rctf, the URL DIRECTORY will be served from, for attachment links")
+	fmt.Fprintln(w, "-title TITLE")
+	fmt.Fprintln(w, "        With staticsite, the title of the site")
+	fmt.Fprintln(w, "-tag TAG[,TAG...]")
+	fmt.Fprintln(w, "        With export or staticsite, only write puzzles with one of these tags")
+	fmt.Fprintln(w, "-mkpuzzle LANGUAGE")
+	fmt.Fprintln(w, "        With new, write an mkpuzzle in LANGUAGE instead of puzzle.md:", mkpuzzleLanguages())
 }
 
 // ParseArgs parses arguments and runs the appropriate action.
@@ -61,10 +141,25 @@ func (t *T) ParseArgs() (Command, error) {
 	flags := flag.NewFlagSet(t.Args[1], flag.ContinueOnError)
 	flags.SetOutput(t.Stderr)
 	directory := flags.String("dir", "", "Work directory")
+	logLevel := flags.String("loglevel", "info", "Least important log messages to show: debug, info, warn, or error")
+	flags.StringVar(&t.mkpuzzle, "mkpuzzle", "", "Language to write mkpuzzle in, for new")
+	flags.StringVar(&t.profile, "profile", "", "Build profile: devel, staging, or production")
+	flags.BoolVar(&t.catalog, "catalog", false, "Describe every category, for inventory")
+	flags.StringVar(&t.manifest, "manifest", "", "Event manifest listing categories, for mothball")
+	flags.BoolVar(&t.strict, "strict", false, "Don't build a mothball if lint finds errors")
+	flags.BoolVar(&t.mothballs, "mothballs", false, "Write mothballs, for import")
+	flags.StringVar(&t.format, "format", "ctfd", "Platform to export to: ctfd or rctf")
+	flags.StringVar(&t.filesURL, "files-url", "", "URL exported rCTF attachments will be served from")
+	flags.StringVar(&t.title, "title", "MOTH", "Title of the static site")
+	flags.StringVar(&t.tags, "tag", "", "Comma-separated tags of puzzles to export, for export and staticsite")
+	spellcheck := flags.String("spellcheck", "", "Comma-separated word lists to spellcheck puzzles with")
+	checkLinks := flags.Bool("check-links", false, "Check links in puzzles to other web sites")
 
 	switch t.Args[1] {
 	case "mothball":
 		cmd = t.DumpMothball
+	case "lint":
+		cmd = t.LintCategory
 	case "inventory":
 		cmd = t.PrintInventory
 	case "puzzle":
@@ -75,6 +170,16 @@ func (t *T) ParseArgs() (Command, error) {
 		cmd = t.CheckAnswer
 	case "markdown":
 		cmd = t.Markdown
+	case "new":
+		cmd = t.NewPuzzle
+	case "diff":
+		cmd = t.DiffMothballs
+	case "import":
+		cmd = t.ImportCTFd
+	case "export":
+		cmd = t.Export
+	case "staticsite":
+		cmd = t.StaticSite
 	case "help":
 		usage(t.Stderr)
 		return nothing, nil
@@ -93,12 +198,33 @@ func (t *T) ParseArgs() (Command, error) {
 		t.fs = t.BaseFs
 	}
 	t.Args = flags.Args()
+	if err := t.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		return nothing, err
+	}
+
+	var dictionary transpile.Dictionary
+	if *spellcheck != "" {
+		var err error
+		if dictionary, err = transpile.LoadDictionary(t.BaseFs, strings.Split(*spellcheck, ",")...); err != nil {
+			return nothing, err
+		}
+	}
+	transpile.SetSpellcheck(dictionary)
+	var linkChecker *transpile.LinkChecker
+	if *checkLinks {
+		linkChecker = transpile.NewLinkChecker(10 * time.Second)
+	}
+	transpile.SetLinkCheck(linkChecker)
 
 	return cmd, nil
 }
 
 // PrintInventory prints a puzzle inventory to stdout
 func (t *T) PrintInventory() error {
+	if t.catalog {
+		return t.PrintCatalog()
+	}
+
 	c := transpile.NewFsCategory(t.fs, "")
 
 	inv, err := c.Inventory()
@@ -119,14 +245,41 @@ func (t *T) PrintInventory() error {
 	return nil
 }
 
+// buildProfile returns the BuildProfile named by -profile,
+// or def if it wasn't given.
+func (t *T) buildProfile(def transpile.BuildProfile) (transpile.BuildProfile, error) {
+	if t.profile == "" {
+		return def, nil
+	}
+	return transpile.GetBuildProfile(t.profile)
+}
+
+// PrintCatalog prints a catalog of every category to stdout
+func (t *T) PrintCatalog() error {
+	catalog, err := transpile.FsCatalog(t.fs)
+	if err != nil {
+		return err
+	}
+	jcat, err := json.Marshal(catalog)
+	if err != nil {
+		return err
+	}
+
+	t.Stdout.Write(jcat)
+	return nil
+}
+
 // DumpPuzzle writes a puzzle's JSON to the writer.
 func (t *T) DumpPuzzle() error {
-	puzzle := transpile.NewFsPuzzle(t.fs)
-
-	p, err := puzzle.Puzzle()
+	profile, err := t.buildProfile(transpile.DevelProfile)
+	if err != nil {
+		return err
+	}
+	p, err := transpile.ParsePuzzle(t.fs)
 	if err != nil {
 		return err
 	}
+	profile.Strip(&p)
 	jp, err := json.Marshal(p)
 	if err != nil {
 		return err
@@ -156,26 +309,98 @@ func (t *T) DumpFile() error {
 	return nil
 }
 
+// LintCategory prints problems with a category.
+func (t *T) LintCategory() error {
+	c := transpile.NewFsCategory(t.fs, "")
+	problems, err := transpile.Lint(c)
+	if err != nil {
+		return err
+	}
+	return logProblems(problems)
+}
+
+// logProblems logs lint problems,
+// returning an error if any of them are more than warnings.
+func logProblems(problems []transpile.LintProblem) error {
+	errors := 0
+	for _, problem := range problems {
+		if problem.Warning {
+			slog.Warn(problem.Message, "puzzle", problem.Points)
+		} else {
+			slog.Error(problem.Message, "puzzle", problem.Points)
+			errors++
+		}
+	}
+	if errors > 0 {
+		return fmt.Errorf("%d problems found", errors)
+	}
+	return nil
+}
+
 // DumpMothball writes a mothball to the writer, or an output file if specified.
 func (t *T) DumpMothball() error {
-	var w io.Writer
-	c := transpile.NewFsCategory(t.fs, "")
+	profile, err := t.buildProfile(transpile.ProductionProfile)
+	if err != nil {
+		return err
+	}
+	if t.manifest != "" {
+		return t.dumpManifestMothballs(profile)
+	}
 
 	filename := ""
+	if len(t.Args) > 0 {
+		filename = t.Args[0]
+	}
+	return t.writeMothball(transpile.NewFsCategory(t.fs, ""), filename, profile)
+}
+
+// dumpManifestMothballs writes a mothball for every category in the manifest,
+// to the directory named in the first argument.
+func (t *T) dumpManifestMothballs(profile transpile.BuildProfile) error {
 	if len(t.Args) == 0 {
+		return fmt.Errorf("usage: mothball -manifest MANIFEST DIRECTORY")
+	}
+	outdir := t.Args[0]
+
+	manifest, err := transpile.ReadManifest(t.BaseFs, t.manifest)
+	if err != nil {
+		return err
+	}
+	if err := t.BaseFs.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	for _, mc := range manifest.Categories {
+		c, err := mc.Open(t.BaseFs)
+		if err != nil {
+			return err
+		}
+		if err := t.writeMothball(c, filepath.Join(outdir, mc.Name+".mb"), profile); err != nil {
+			return fmt.Errorf("%s: %w", mc.Name, err)
+		}
+	}
+	return nil
+}
+
+// writeMothball writes a mothball of c to filename,
+// or to stdout, if filename is empty.
+func (t *T) writeMothball(c transpile.Category, filename string, profile transpile.BuildProfile) error {
+	var w io.Writer
+
+	if filename == "" {
 		w = t.Stdout
 	} else {
-		filename = t.Args[0]
 		outf, err := t.BaseFs.Create(filename)
 		if err != nil {
 			return err
 		}
 		defer outf.Close()
 		w = outf
-		log.Println("Writing mothball to", filename)
+		slog.Info("writing mothball", "file", filename)
 	}
 
-	if err := transpile.Mothball(c, w); err != nil {
+	problems, err := transpile.BuildMothball(c, w, transpile.BuildOptions{Profile: profile, Strict: t.strict})
+	logProblems(problems)
+	if err != nil {
 		if filename != "" {
 			t.BaseFs.Remove(filename)
 		}
@@ -184,6 +409,56 @@ func (t *T) DumpMothball() error {
 	return nil
 }
 
+// StaticSite writes every category as a web site that needs no server.
+func (t *T) StaticSite() error {
+	if len(t.Args) != 1 {
+		return fmt.Errorf("usage: staticsite DIRECTORY")
+	}
+	profile, err := t.buildProfile(transpile.ProductionProfile)
+	if err != nil {
+		return err
+	}
+
+	categories := make(map[string]transpile.Category)
+	if t.manifest != "" {
+		manifest, err := transpile.ReadManifest(t.BaseFs, t.manifest)
+		if err != nil {
+			return err
+		}
+		for _, mc := range manifest.Categories {
+			c, err := mc.Open(t.BaseFs)
+			if err != nil {
+				return err
+			}
+			categories[mc.Name] = t.tagged(c)
+		}
+	} else {
+		dirEnts, err := afero.ReadDir(t.fs, ".")
+		if err != nil {
+			return err
+		}
+		for _, ent := range dirEnts {
+			if ent.IsDir() && !strings.HasPrefix(ent.Name(), ".") {
+				categories[ent.Name()] = t.tagged(transpile.NewFsCategory(t.fs, ent.Name()))
+			}
+		}
+	}
+
+	outdir := t.Args[0]
+	if err := t.BaseFs.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	return transpile.WriteStaticSite(afero.NewBasePathFs(t.BaseFs, outdir), t.title, categories, profile)
+}
+
+// tagged returns c, or with -tag, only the puzzles in c with one of the tags.
+func (t *T) tagged(c transpile.Category) transpile.Category {
+	if t.tags == "" {
+		return c
+	}
+	return transpile.NewTaggedCategory(c, strings.Split(t.tags, ","))
+}
+
 // CheckAnswer prints whether an answer is correct.
 func (t *T) CheckAnswer() error {
 	answer := ""
@@ -201,6 +476,13 @@ func (t *T) Markdown() error {
 }
 
 func main() {
+	// Building puzzles already runs their own scripts,
+	// so checking their answers may as well run their checker commands
+	transpile.RegisterAnswerChecker("command", transpile.CommandChecker{
+		Enabled: true,
+		Timeout: 2 * time.Second,
+	})
+
 	t := &T{
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
@@ -212,6 +494,7 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(t.Stderr, &slog.HandlerOptions{Level: t.LogLevel})))
 	if err := cmd(); err != nil {
 		log.Fatal(err)
 	}
@@ -233,3 +233,312 @@ func TestCwd(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestNewPuzzle(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: stdout,
+		Stderr: new(bytes.Buffer),
+		BaseFs: afero.NewMemMapFs(),
+	}
+
+	if err := tp.Run("new", "sandwich", "5"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "sandwich/5\n" {
+		t.Error("Wrong directory", stdout.String())
+	}
+	p, err := transpile.NewFsPuzzle(afero.NewBasePathFs(tp.BaseFs, "sandwich/5")).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Answers) != 1) || (len(p.Attachments) != 1) || !strings.Contains(p.Body, "sandwich") {
+		t.Error("Wrong puzzle", p)
+	}
+	if _, err := tp.BaseFs.Stat("sandwich/5/attachment.txt"); err != nil {
+		t.Error(err)
+	}
+	if err := tp.Run("new", "sandwich", "5"); err == nil {
+		t.Error("Overwrote an existing puzzle")
+	}
+
+	if err := tp.Run("new", "-mkpuzzle=sh", "sandwich", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := tp.BaseFs.Stat("sandwich/10/mkpuzzle"); err != nil {
+		t.Error(err)
+	} else if info.Mode()&0100 == 0 {
+		t.Error("mkpuzzle isn't executable")
+	}
+	if err := tp.Run("new", "-mkpuzzle=cobol", "sandwich", "20"); err == nil {
+		t.Error("Wrote mkpuzzle in an unknown language")
+	}
+
+	for _, args := range [][]string{{"sandwich"}, {"sandwich", "0"}, {"../sandwich", "1"}} {
+		if err := tp.Run(append([]string{"new"}, args...)...); err == nil {
+			t.Error("Accepted bad arguments", args)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: new(bytes.Buffer),
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+
+	if err := tp.Run("lint", "-dir=unbroken"); err == nil {
+		t.Error("No problems found with puzzles sharing an answer")
+	}
+	if err := tp.Run("mothball", "-strict", "-dir=unbroken", "unbroken.mb"); err == nil {
+		t.Error("Built a mothball with lint errors")
+	}
+	if _, err := tp.BaseFs.Stat("unbroken.mb"); err == nil {
+		t.Error("Wrote a mothball with lint errors")
+	}
+	if err := tp.Run("mothball", "-dir=unbroken", "unbroken.mb"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: stdout,
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+
+	if err := tp.Run("puzzle", "-dir=cat0/1"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "YAML answer") {
+		t.Error("Answer missing from devel puzzle", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := tp.Run("puzzle", "-profile=production", "-dir=cat0/1"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout.String(), "YAML answer") {
+		t.Error("Answer in production puzzle", stdout.String())
+	}
+
+	if err := tp.Run("puzzle", "-profile=spoilers", "-dir=cat0/1"); err == nil {
+		t.Error("Used a profile that doesn't exist")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: new(bytes.Buffer),
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+
+	if err := tp.Run("mothball", "-dir=unbroken", "built/unbroken.mb"); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(tp.BaseFs, "library/pigs/1/puzzle.md", []byte("---\nanswers:\n  - oink\n---\nOink?\n"), 0644)
+	afero.WriteFile(tp.BaseFs, "event/manifest.yaml", []byte("categories:\n  - path: ../library/pigs\n  - path: ../built/unbroken.mb\n"), 0644)
+	if err := tp.Run("mothball", "-manifest=event/manifest.yaml", "out"); err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"out/pigs.mb", "out/unbroken.mb"} {
+		if _, err := tp.BaseFs.Stat(filename); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err := tp.Run("mothball", "-manifest=event/manifest.yaml"); err == nil {
+		t.Error("Built manifest without an output directory")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: stdout,
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+
+	if err := tp.Run("mothball", "-dir=unbroken", "old.mb"); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(tp.BaseFs, "unbroken/1/puzzle.md", []byte("---\nanswers:\n  - YAML answer\n  - moo\nattachments:\n  - filename: moo.txt\n---\nYAML body\n\nMore body\n"), 0644)
+	afero.WriteFile(tp.BaseFs, "unbroken/1/moo.txt", []byte("Moo!"), 0644)
+	tp.BaseFs.RemoveAll("unbroken/2")
+	afero.WriteFile(tp.BaseFs, "unbroken/3/puzzle.md", []byte("---\nanswers:\n  - three\n---\nThree\n"), 0644)
+	if err := tp.Run("mothball", "-dir=unbroken", "new.mb"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tp.Run("diff", "old.mb", "old.mb"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.Len() > 0 {
+		t.Error("Differences in the same mothball:", stdout.String())
+	}
+
+	if err := tp.Run("diff", "old.mb", "new.mb"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"puzzle 1: answers: added \"moo\"\n",
+		"puzzle 1: body:\n+<p>More body</p>\n",
+		"puzzle 1: moo.txt: changed, sha256 ",
+		"puzzle 2: removed\n",
+		"puzzle 3: added\n",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("Missing %q in diff: %s", line, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), "Answer") {
+		t.Error("Answer hashes in diff:", stdout.String())
+	}
+
+	if err := tp.Run("diff", "old.mb"); err == nil {
+		t.Error("Diffed one mothball")
+	}
+
+	// Every build salts its hashes differently
+	afero.WriteFile(tp.BaseFs, "unbroken/3/puzzle.md", []byte("---\nparts:\n  - name: a\n    answers: [aye]\n  - name: b\n    answers: [bee]\n---\nThree\n"), 0644)
+	afero.WriteFile(tp.BaseFs, "unbroken/1/puzzle.md", []byte("---\nanswers: [one]\ntiers:\n  - name: half\n    value: 0.5\n    answers: [meh]\n---\nOne\n"), 0644)
+	for _, name := range []string{"parts1.mb", "parts2.mb"} {
+		if err := tp.Run("mothball", "-dir=unbroken", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout.Reset()
+	if err := tp.Run("diff", "parts1.mb", "parts2.mb"); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.Len() > 0 {
+		t.Error("Differences between builds of the same puzzles:", stdout.String())
+	}
+}
+
+func TestImport(t *testing.T) {
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: new(bytes.Buffer),
+		Stderr: new(bytes.Buffer),
+		BaseFs: afero.NewMemMapFs(),
+	}
+
+	// CTFd exports are zip files with everything in a top directory
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, contents := range map[string]string{
+		"export/db/challenges.json": `{"results": [{"id": 1, "name": "Warmup", "description": "Hi", "category": "intro", "value": 100}]}`,
+		"export/db/flags.json":      `{"results": [{"id": 1, "challenge_id": 1, "type": "static", "content": "flag{hi}"}]}`,
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(contents))
+	}
+	zw.Close()
+	afero.WriteFile(tp.BaseFs, "export.zip", buf.Bytes(), 0644)
+
+	if err := tp.Run("import", "export.zip", "puzzles"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := afero.ReadFile(tp.BaseFs, "puzzles/intro/100/puzzle.md"); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(buf), "flag{hi}") {
+		t.Error("Wrong puzzle.md:", string(buf))
+	}
+
+	if err := tp.Run("import", "-mothballs", "export.zip", "mothballs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.BaseFs.Stat("mothballs/intro.mb"); err != nil {
+		t.Error(err)
+	}
+
+	if err := tp.Run("import", "export.zip"); err == nil {
+		t.Error("Imported without an output directory")
+	}
+}
+
+func TestExport(t *testing.T) {
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: new(bytes.Buffer),
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+	// cat0 has attachments that aren't there
+	tp.BaseFs.RemoveAll("cat0")
+
+	if err := tp.Run("export", "ctfd"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tp.BaseFs.Stat("ctfd/unbroken/2/challenge.yml"); err != nil {
+		t.Error(err)
+	}
+
+	if err := tp.Run("export", "-format=rctf", "rctf"); err != nil {
+		t.Fatal(err)
+	}
+	challenges := []transpile.RCTFChallenge{}
+	if buf, err := afero.ReadFile(tp.BaseFs, "rctf/challenges.json"); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buf, &challenges); err != nil {
+		t.Fatal(err)
+	}
+	if (len(challenges) != 2) || (challenges[1].ID != "unbroken-2") || (challenges[1].Flag != "YAML answer") {
+		t.Error("Wrong challenges:", challenges)
+	}
+
+	if err := tp.Run("export", "-format=moth", "moth"); err == nil {
+		t.Error("Exported to an unknown format")
+	}
+
+	afero.WriteFile(tp.BaseFs, "unbroken/2/puzzle.md", []byte("---\nanswers: [two]\ntags: [Crypto, web]\n---\nTwo\n"), 0644)
+	if err := tp.Run("export", "-format=rctf", "-tag=crypto", "tagged"); err != nil {
+		t.Fatal(err)
+	}
+	challenges = []transpile.RCTFChallenge{}
+	if buf, err := afero.ReadFile(tp.BaseFs, "tagged/challenges.json"); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buf, &challenges); err != nil {
+		t.Fatal(err)
+	}
+	if (len(challenges) != 1) || (challenges[0].ID != "unbroken-2") {
+		t.Error("Wrong tagged challenges:", challenges)
+	}
+}
+
+func TestStaticSite(t *testing.T) {
+	tp := T{
+		Stdin:  new(bytes.Buffer),
+		Stdout: new(bytes.Buffer),
+		Stderr: new(bytes.Buffer),
+		BaseFs: newTestFs(),
+	}
+	afero.WriteFile(tp.BaseFs, "event/manifest.yaml", []byte("categories:\n  - path: ../unbroken\n    name: intro\n"), 0644)
+
+	if err := tp.Run("staticsite", "-manifest=event/manifest.yaml", "-title=Training", "site"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := afero.ReadFile(tp.BaseFs, "site/index.html"); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(buf), "<title>Training</title>") || !strings.Contains(string(buf), "intro/2/index.html") {
+		t.Error("Wrong index:", string(buf))
+	}
+	if _, err := tp.BaseFs.Stat("site/intro/1/moo.txt"); err != nil {
+		t.Error(err)
+	}
+
+	if err := tp.Run("staticsite"); err == nil {
+		t.Error("Wrote a site without an output directory")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/afero"
+)
+
+// newPuzzleMarkdown is the puzzle.md written by "transpile new".
+var newPuzzleMarkdown = template.Must(template.New("puzzle.md").Parse(`---
+authors:
+  - {{.Author}}
+attachments:
+  - filename: attachment.txt
+answers:
+  - change me
+debug:
+  summary: {{.Category}} {{.Points}}
+  hints:
+    - The answer is in attachment.txt
+---
+This is puzzle {{.Points}} in {{.Category}}.
+
+Have a look at [the attachment](attachment.txt).
+`))
+
+// newAttachment is the example attachment written by "transpile new".
+const newAttachment = "The answer is: change me\n"
+
+// newMkpuzzles are the mkpuzzle stubs "transpile new" can write,
+// by language.
+var newMkpuzzles = map[string]*template.Template{
+	"python": template.Must(template.New("mkpuzzle").Parse(`#!/usr/bin/env python3
+
+"""Puzzle {{.Points}} in {{.Category}}.
+
+See docs/api.md for what mkpuzzle has to do,
+and docs/puzzle.schema.json for what "mkpuzzle puzzle" can output.
+"""
+
+import json
+import os
+import random
+import shutil
+import sys
+
+random.seed(os.getenv("SEED", ""))
+
+answer = random.choice(["apple", "pear", "peach", "tangerine"])
+
+
+def puzzle():
+    json.dump({
+        "Authors": [{{printf "%q" .Author}}],
+        "Body": "<p>Have a look at <a href='attachment.txt'>the attachment</a>.</p>",
+        "Attachments": ["attachment.txt"],
+        "Answers": [answer],
+        "Debug": {
+            "Summary": {{printf "%q" (print .Category " " .Points)}},
+            "Hints": ["The answer is in attachment.txt"],
+        },
+    }, sys.stdout)
+
+
+def open_file(filename):
+    if filename == "attachment.txt":
+        sys.stdout.write("The answer is: %s\n" % answer)
+    else:
+        with open(filename, "rb") as f:
+            shutil.copyfileobj(f, sys.stdout.buffer)
+
+
+def check_answer(check):
+    json.dump({"Correct": check == answer}, sys.stdout)
+
+
+if len(sys.argv) < 2:
+    sys.exit("Usage: mkpuzzle puzzle | file FILENAME | answer ANSWER")
+elif sys.argv[1] == "puzzle":
+    puzzle()
+elif sys.argv[1] == "file":
+    open_file(sys.argv[2])
+elif sys.argv[1] == "answer":
+    check_answer(sys.argv[2])
+else:
+    sys.exit("Unknown command: %s" % sys.argv[1])
+`)),
+	"sh": template.Must(template.New("mkpuzzle").Parse(`#!/bin/sh
+
+# Puzzle {{.Points}} in {{.Category}}.
+#
+# See docs/api.md for what mkpuzzle has to do,
+# and docs/puzzle.schema.json for what "mkpuzzle puzzle" can output.
+
+set -e
+
+answer="change me"
+
+case "$1" in
+puzzle)
+	cat <<EOD
+{
+	"Authors": [{{printf "%q" .Author}}],
+	"Body": "<p>Have a look at <a href='attachment.txt'>the attachment</a>.</p>",
+	"Attachments": ["attachment.txt"],
+	"Answers": ["$answer"],
+	"Debug": {
+		"Summary": {{printf "%q" (print .Category " " .Points)}},
+		"Hints": ["The answer is in attachment.txt"]
+	}
+}
+EOD
+	;;
+file)
+	case "$2" in
+	attachment.txt)
+		echo "The answer is: $answer"
+		;;
+	*)
+		cat "$2"
+		;;
+	esac
+	;;
+answer)
+	if [ "$2" = "$answer" ]; then
+		echo '{"Correct": true}'
+	else
+		echo '{"Correct": false}'
+	fi
+	;;
+*)
+	echo "Usage: $0 puzzle | file FILENAME | answer ANSWER" 1>&2
+	exit 1
+	;;
+esac
+`)),
+}
+
+// mkpuzzleLanguages returns the languages "transpile new" can write mkpuzzle in.
+func mkpuzzleLanguages() string {
+	langs := make([]string, 0, len(newMkpuzzles))
+	for lang := range newMkpuzzles {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return strings.Join(langs, ", ")
+}
+
+// NewPuzzle creates a directory for a new puzzle,
+// with a puzzle.md or mkpuzzle to start from.
+func (t *T) NewPuzzle() error {
+	if len(t.Args) != 2 {
+		return fmt.Errorf("usage: new [FLAGS] CATEGORY POINTS")
+	}
+	category := t.Args[0]
+	if (category == "") || strings.ContainsAny(category, "/\\") || strings.HasPrefix(category, ".") {
+		return fmt.Errorf("invalid category name: %q", category)
+	}
+	points, err := strconv.Atoi(t.Args[1])
+	if err != nil || points <= 0 {
+		return fmt.Errorf("invalid point value: %q", t.Args[1])
+	}
+
+	var mkpuzzle *template.Template
+	if t.mkpuzzle != "" {
+		var ok bool
+		if mkpuzzle, ok = newMkpuzzles[t.mkpuzzle]; !ok {
+			return fmt.Errorf("can't write mkpuzzle in %q: try one of %s", t.mkpuzzle, mkpuzzleLanguages())
+		}
+	}
+
+	dir := path.Join(category, strconv.Itoa(points))
+	if _, err := t.fs.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+	if err := t.fs.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	author := os.Getenv("USER")
+	if author == "" {
+		author = "unknown"
+	}
+	data := struct {
+		Author   string
+		Category string
+		Points   int
+	}{author, category, points}
+
+	if mkpuzzle != nil {
+		if err := t.writeTemplate(path.Join(dir, "mkpuzzle"), 0755, mkpuzzle, data); err != nil {
+			return err
+		}
+	} else {
+		if err := t.writeTemplate(path.Join(dir, "puzzle.md"), 0644, newPuzzleMarkdown, data); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(t.fs, path.Join(dir, "attachment.txt"), []byte(newAttachment), 0644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(t.Stdout, dir)
+	return nil
+}
+
+// writeTemplate writes the output of tmpl to filename.
+func (t *T) writeTemplate(filename string, mode os.FileMode, tmpl *template.Template, data any) error {
+	f, err := t.fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
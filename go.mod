@@ -5,11 +5,13 @@ go 1.21
 require (
 	github.com/spf13/afero v1.8.2
 	github.com/yuin/goldmark v1.4.13
+	golang.org/x/crypto v0.21.0
+	golang.org/x/net v0.21.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/kr/text v0.2.0 // indirect
-	golang.org/x/text v0.3.8 // indirect
+	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
@@ -18,6 +18,21 @@ type T struct {
 	TeamID   string
 	Category string
 	Points   int
+
+	// Part names the part of a multi-part puzzle this award is for.
+	// It is empty for awards solving the entire puzzle.
+	Part string
+
+	// Score is how many points this award adds to the team's score.
+	// This is usually Points,
+	// but can be less for puzzles awarding partial credit.
+	Score int
+
+	// Seq numbers awards in the order they were added to the points log.
+	// It only ever goes up, so it orders awards made in the same second,
+	// and lets a consumer pick up where it left off.
+	// It's zero for awards that aren't in the points log yet.
+	Seq uint64
 }
 
 // List is a collection of award events.
@@ -29,7 +44,11 @@ func (awards List) Len() int {
 }
 
 // Less returns true if i was awarded before j.
+// Awards made in the same second are ordered by Seq.
 func (awards List) Less(i, j int) bool {
+	if awards[i].When == awards[j].When {
+		return awards[i].Seq < awards[j].Seq
+	}
 	return awards[i].When < awards[j].When
 }
 
@@ -40,29 +59,98 @@ func (awards List) Swap(i, j int) {
 	awards[j] = tmp
 }
 
+// Sequence numbers the awards in order, starting after last,
+// so each has a higher Seq than the one before it.
+// Sequence numbers already in order are kept.
+// It returns the highest sequence number.
+func (awards List) Sequence(last uint64) uint64 {
+	for i := range awards {
+		if awards[i].Seq <= last {
+			awards[i].Seq = last + 1
+		}
+		last = awards[i].Seq
+	}
+	return last
+}
+
 // Parse parses a string log entry into an award.T.
+//
+// Log entries have one of these forms:
+//
+//	when teamID category points
+//	when teamID category points score
+//	when teamID category points part score
+//
+// Any of these may end with a sequence number, like "#12".
 func Parse(s string) (T, error) {
 	ret := T{}
 
-	s = strings.TrimSpace(s)
+	fields := strings.Fields(s)
+	if n := len(fields); (n > 4) && strings.HasPrefix(fields[n-1], "#") {
+		seq, err := strconv.ParseUint(fields[n-1][1:], 10, 64)
+		if err != nil {
+			return ret, fmt.Errorf("malformed award sequence number: %w", err)
+		}
+		ret.Seq = seq
+		fields = fields[:n-1]
+	}
+	if (len(fields) < 4) || (len(fields) > 6) {
+		return ret, fmt.Errorf("malformed award string: %d fields", len(fields))
+	}
 
-	n, err := fmt.Sscanf(s, "%d %s %s %d", &ret.When, &ret.TeamID, &ret.Category, &ret.Points)
+	n, err := fmt.Sscanf(strings.Join(fields[:4], " "), "%d %s %s %d", &ret.When, &ret.TeamID, &ret.Category, &ret.Points)
 	if err != nil {
 		return ret, err
 	} else if n != 4 {
 		return ret, fmt.Errorf("malformed award string: only parsed %d fields", n)
 	}
 
+	ret.Score = ret.Points
+	switch len(fields) {
+	case 5:
+		ret.Score, err = strconv.Atoi(fields[4])
+	case 6:
+		ret.Part = fields[4]
+		ret.Score, err = strconv.Atoi(fields[5])
+	}
+	if err != nil {
+		return ret, fmt.Errorf("malformed award score: %w", err)
+	}
+
 	return ret, nil
 }
 
 // String returns a log entry string for an award.T.
+//
+// Awards for an entire puzzle, worth its full point value,
+// use the original four-field format.
+// Awards with a sequence number end with it, like "#12".
 func (a T) String() string {
-	return fmt.Sprintf("%d %s %s %d", a.When, a.TeamID, a.Category, a.Points)
+	s := fmt.Sprintf("%d %s %s %d", a.When, a.TeamID, a.Category, a.Points)
+	switch {
+	case a.Part != "":
+		s += fmt.Sprintf(" %s %d", a.Part, a.Score)
+	case a.Score != a.Points:
+		s += fmt.Sprintf(" %d", a.Score)
+	}
+	if a.Seq != 0 {
+		s += fmt.Sprintf(" #%d", a.Seq)
+	}
+	return s
 }
 
 // Filename returns a string version of an award suitable for a filesystem
 func (a T) Filename() string {
+	if a.Part != "" {
+		return fmt.Sprintf(
+			"%d-%s-%s-%d-%s.award",
+			a.When,
+			url.PathEscape(a.TeamID),
+			url.PathEscape(a.Category),
+			a.Points,
+			url.PathEscape(a.Part),
+		)
+	}
 	return fmt.Sprintf(
 		"%d-%s-%s-%d.award",
 		a.When,
@@ -73,6 +161,11 @@ func (a T) Filename() string {
 }
 
 // MarshalJSON returns the award event, encoded as a list.
+//
+// Awards for an entire puzzle, worth its full point value,
+// are encoded as [When, TeamID, Category, Points].
+// Anything else has two more elements: [..., Part, Score].
+// Awards with a sequence number have all of those, then Seq.
 func (a T) MarshalJSON() ([]byte, error) {
 	ao := []interface{}{
 		a.When,
@@ -80,12 +173,19 @@ func (a T) MarshalJSON() ([]byte, error) {
 		a.Category,
 		a.Points,
 	}
+	if (a.Part != "") || (a.Score != a.Points) || (a.Seq != 0) {
+		ao = append(ao, a.Part, a.Score)
+	}
+	if a.Seq != 0 {
+		ao = append(ao, a.Seq)
+	}
 
 	return json.Marshal(ao)
 }
 
-// UnmarshalJSON decodes the JSON string b.
-func (a T) UnmarshalJSON(b []byte) error {
+// UnmarshalJSON decodes the JSON string b,
+// in any of the forms MarshalJSON makes.
+func (a *T) UnmarshalJSON(b []byte) error {
 	r := bytes.NewReader(b)
 	dec := json.NewDecoder(r)
 	dec.UseNumber() // Don't use floats
@@ -100,14 +200,14 @@ func (a T) UnmarshalJSON(b []byte) error {
 		if token.String() != "[" {
 			return &json.UnmarshalTypeError{
 				Value:  token.String(),
-				Type:   reflect.TypeOf(a),
+				Type:   reflect.TypeOf(*a),
 				Offset: 0,
 			}
 		}
 	default:
 		return &json.UnmarshalTypeError{
 			Value:  fmt.Sprintf("%v", t),
-			Type:   reflect.TypeOf(a),
+			Type:   reflect.TypeOf(*a),
 			Offset: 0,
 		}
 	}
@@ -119,10 +219,10 @@ func (a T) UnmarshalJSON(b []byte) error {
 	if a.When, err = strconv.ParseInt(string(num), 10, 64); err != nil {
 		return err
 	}
-	if err := dec.Decode(&a.Category); err != nil {
+	if err := dec.Decode(&a.TeamID); err != nil {
 		return err
 	}
-	if err := dec.Decode(&a.TeamID); err != nil {
+	if err := dec.Decode(&a.Category); err != nil {
 		return err
 	}
 	if err := dec.Decode(&num); err != nil {
@@ -132,6 +232,29 @@ func (a T) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	a.Part = ""
+	a.Score = a.Points
+	a.Seq = 0
+	if dec.More() {
+		if err := dec.Decode(&a.Part); err != nil {
+			return err
+		}
+		if err := dec.Decode(&num); err != nil {
+			return err
+		}
+		if a.Score, err = strconv.Atoi(string(num)); err != nil {
+			return err
+		}
+	}
+	if dec.More() {
+		if err := dec.Decode(&num); err != nil {
+			return err
+		}
+		if a.Seq, err = strconv.ParseUint(string(num), 10, 64); err != nil {
+			return err
+		}
+	}
+
 	// All this to make sure we get `]`
 	t, err = dec.Token()
 	if err != nil {
@@ -142,14 +265,14 @@ func (a T) UnmarshalJSON(b []byte) error {
 		if token.String() != "]" {
 			return &json.UnmarshalTypeError{
 				Value:  token.String(),
-				Type:   reflect.TypeOf(a),
+				Type:   reflect.TypeOf(*a),
 				Offset: 0,
 			}
 		}
 	default:
 		return &json.UnmarshalTypeError{
 			Value:  fmt.Sprintf("%v", t),
-			Type:   reflect.TypeOf(a),
+			Type:   reflect.TypeOf(*a),
 			Offset: 0,
 		}
 	}
@@ -167,6 +290,8 @@ func (a T) Equal(o T) bool {
 		return false
 	case a.Points != o.Points:
 		return false
+	case a.Part != o.Part:
+		return false
 	}
 	return true
 }
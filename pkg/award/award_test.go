@@ -71,6 +71,68 @@ func TestAward(t *testing.T) {
 
 }
 
+func TestAwardPart(t *testing.T) {
+	full, err := Parse("1536958399 1a2b3c4d counting 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Score != 10 {
+		t.Error("Score of a full award should be its points")
+	}
+
+	for _, entry := range []string{
+		"1536958399 1a2b3c4d counting 10 user 5",
+		"1536958399 1a2b3c4d counting 10 5",
+	} {
+		a, err := Parse(entry)
+		if err != nil {
+			t.Error(entry, err)
+			continue
+		}
+		if a.Score != 5 {
+			t.Error("Score parsed wrong", entry)
+		}
+		if a.String() != entry {
+			t.Error("String conversion wonky", a.String())
+		}
+	}
+
+	part, _ := Parse("1536958399 1a2b3c4d counting 10 user 5")
+	if part.Part != "user" {
+		t.Error("Part parsed wrong")
+	}
+	if part.Equal(full) {
+		t.Error("Part award compares equal to full award")
+	}
+	if ja, err := part.MarshalJSON(); err != nil {
+		t.Error(err)
+	} else if string(ja) != `[1536958399,"1a2b3c4d","counting",10,"user",5]` {
+		t.Error("JSON wrong", string(ja))
+	}
+	for _, a := range []T{full, part, {When: 1536958399, TeamID: "1a2b3c4d", Category: "counting", Points: 10, Score: 5}} {
+		ja, err := a.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b T
+		if err := b.UnmarshalJSON(ja); err != nil {
+			t.Error(string(ja), err)
+		} else if b != a {
+			t.Error("JSON round trip changed award:", string(ja), b)
+		}
+	}
+	if part.Filename() == full.Filename() {
+		t.Error("Part award has the same filename as a full award")
+	}
+
+	if _, err := Parse("1536958399 1a2b3c4d counting 10 user moo"); err == nil {
+		t.Error("Not throwing error on bad score")
+	}
+	if _, err := Parse("1536958399 1a2b3c4d counting 10 user 5 6"); err == nil {
+		t.Error("Not throwing error on too many fields")
+	}
+}
+
 func TestAwardList(t *testing.T) {
 	a, _ := Parse("1536958399 1a2b3c4d counting 1")
 	b, _ := Parse("1536958400 1a2b3c4d counting 1")
@@ -90,3 +152,55 @@ func TestAwardList(t *testing.T) {
 		t.Error("Sorted list thinks it isn't")
 	}
 }
+
+func TestAwardSeq(t *testing.T) {
+	a, err := Parse("1536958399 1a2b3c4d counting 10 #7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (a.Seq != 7) || (a.Score != 10) {
+		t.Error("Sequence number parsed wrong:", a)
+	}
+	if a.String() != "1536958399 1a2b3c4d counting 10 #7" {
+		t.Error("String conversion wonky", a.String())
+	}
+	part, _ := Parse("1536958399 1a2b3c4d counting 10 user 5 #8")
+	if (part.Seq != 8) || (part.Part != "user") || (part.Score != 5) {
+		t.Error("Part award with sequence number parsed wrong:", part)
+	}
+	if _, err := Parse("1536958399 1a2b3c4d counting 10 #moo"); err == nil {
+		t.Error("Not throwing error on bad sequence number")
+	}
+
+	ja, err := part.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	} else if string(ja) != `[1536958399,"1a2b3c4d","counting",10,"user",5,8]` {
+		t.Error("JSON wrong", string(ja))
+	}
+	var b T
+	if err := b.UnmarshalJSON(ja); err != nil {
+		t.Error(err)
+	} else if b != part {
+		t.Error("UnmarshalJSON didn't work", b)
+	}
+
+	// Awards in the same second are ordered by sequence number
+	c, _ := Parse("1536958399 1a2b3c4d counting 1 #3")
+	list := List{a, c}
+	sort.Stable(list)
+	if list[0] != c {
+		t.Error("Sorting didn't use sequence numbers:", list)
+	}
+
+	list = List{{When: 1}, {When: 2, Seq: 5}, {When: 3, Seq: 4}, {When: 4}}
+	if last := list.Sequence(0); last != 7 {
+		t.Error("Wrong last sequence number:", last)
+	}
+	for i, want := range []uint64{1, 5, 6, 7} {
+		if list[i].Seq != want {
+			t.Error("Wrong sequence numbers:", list)
+			break
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package client talks to a MOTH server as a team, using the v2 API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// APIv2Prefix is where the v2 API lives, under the server's base URL.
+const APIv2Prefix = "v2/"
+
+// These are returned, wrapped in an *Error, by requests the server turned down.
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrInvalidTeamID   = errors.New("invalid team ID")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("already done")
+	ErrIncorrectAnswer = errors.New("incorrect answer")
+	ErrPaused          = errors.New("event paused")
+)
+
+// statusErrors maps HTTP status codes to the errors they mean.
+var statusErrors = map[int]error{
+	http.StatusBadRequest:          ErrBadRequest,
+	http.StatusForbidden:           ErrInvalidTeamID,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusUnprocessableEntity: ErrIncorrectAnswer,
+	http.StatusServiceUnavailable:  ErrPaused,
+}
+
+// Error is a JSend "fail" or "error" response from the server.
+//
+// Use errors.Is to compare it to ErrIncorrectAnswer and friends.
+type Error struct {
+	StatusCode  int
+	Status      string
+	Short       string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return e.Description
+	}
+	if e.Short != "" {
+		return e.Short
+	}
+	return http.StatusText(e.StatusCode)
+}
+
+// Is returns true if target is the error for e's status code.
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// State is the event, as a team sees it.
+type State struct {
+	Enabled   bool
+	Paused    bool
+	TeamNames map[string]string
+
+	// Puzzles are the point values of the puzzles a team may open, by category
+	Puzzles map[string][]int
+
+	// Solved are the puzzles the team has solved, by category
+	Solved map[string][]int
+
+	Divisions []string
+
+	// FlagFormats are patterns answers must match, by category.
+	// The pattern for "*" applies to categories without their own.
+	FlagFormats map[string]string
+}
+
+// IsSolved returns true if the team has solved a puzzle.
+func (s *State) IsSolved(cat string, points int) bool {
+	for _, p := range s.Solved[cat] {
+		if p == points {
+			return true
+		}
+	}
+	return false
+}
+
+// Puzzle is what a team sees of a puzzle.
+type Puzzle struct {
+	Authors     []string
+	Attachments []string
+	Scripts     []string
+
+	// Body is HTML
+	Body string
+
+	AnswerPattern string
+
+	// Errata is a correction from the event's organizers
+	Errata string `json:",omitempty"`
+}
+
+// Client makes requests to a MOTH server as one team.
+type Client struct {
+	// URL is the server's base URL, ending in "/"
+	URL *url.URL
+
+	// TeamID is sent with every request
+	TeamID string
+
+	// HTTP makes requests.
+	// New gives it a cookie jar, to keep any session the server starts.
+	HTTP *http.Client
+}
+
+// New returns a Client for the server at baseURL, acting as teamID.
+func New(baseURL, teamID string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http") && (u.Scheme != "https") {
+		return nil, fmt.Errorf("server URL %q must start with http:// or https://", baseURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		URL:    u,
+		TeamID: teamID,
+		HTTP:   &http.Client{Jar: jar},
+	}, nil
+}
+
+// endpoint returns the URL of a v2 endpoint, with path segments escaped.
+func (c *Client) endpoint(segments ...string) *url.URL {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	return c.URL.JoinPath(APIv2Prefix + strings.Join(escaped, "/"))
+}
+
+// do sends req, and returns the response if it was a success.
+// Otherwise, the server's JSend response is returned as an *Error.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Status string
+		Data   struct {
+			Short       string
+			Description string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		apiErr.Status = body.Status
+		apiErr.Short = body.Data.Short
+		apiErr.Description = body.Data.Description
+	}
+	return nil, apiErr
+}
+
+// get sends a GET request for a v2 endpoint.
+func (c *Client) get(ctx context.Context, segments ...string) (*http.Response, error) {
+	u := c.endpoint(segments...)
+	if c.TeamID != "" {
+		u.RawQuery = url.Values{"id": {c.TeamID}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// post sends args to a v2 endpoint as JSON,
+// and returns the description from the server's JSend response.
+func (c *Client) post(ctx context.Context, endpoint string, args map[string]any, header http.Header) (string, error) {
+	args["id"] = c.TeamID
+	buf, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(endpoint).String(), bytes.NewReader(buf))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data struct {
+			Description string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	return body.Data.Description, nil
+}
+
+// State returns the event's state.
+func (c *Client) State(ctx context.Context) (*State, error) {
+	resp, err := c.get(ctx, "state")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data State
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &body.Data, nil
+}
+
+// Register gives the team a name, and optionally a division.
+// Teams that are already registered get an error matching ErrConflict.
+func (c *Client) Register(ctx context.Context, name, division string) error {
+	args := map[string]any{"name": name}
+	if division != "" {
+		args["division"] = division
+	}
+	_, err := c.post(ctx, "register", args, nil)
+	return err
+}
+
+// Puzzle returns a puzzle.
+func (c *Client) Puzzle(ctx context.Context, cat string, points int) (*Puzzle, error) {
+	resp, err := c.Open(ctx, cat, points, "puzzle.json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	puzzle := new(Puzzle)
+	if err := json.NewDecoder(resp).Decode(puzzle); err != nil {
+		return nil, err
+	}
+	return puzzle, nil
+}
+
+// Open returns one of a puzzle's files, like an attachment.
+// The caller must close it.
+func (c *Client) Open(ctx context.Context, cat string, points int, filename string) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, "content", cat, strconv.Itoa(points), filename)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Answer submits an answer for a puzzle,
+// returning the server's description of what happened.
+// Wrong answers get an error matching ErrIncorrectAnswer.
+//
+// Each call sends a new idempotency key,
+// so the server won't count it twice if it's retried on the way.
+func (c *Client) Answer(ctx context.Context, cat string, points int, answer string) (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	args := map[string]any{"cat": cat, "points": points, "answer": answer}
+	header := http.Header{"Idempotency-Key": {hex.EncodeToString(key)}}
+	return c.post(ctx, "answer", args, header)
+}
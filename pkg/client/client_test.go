@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeServer answers like a MOTH server with one puzzle, "sequence 1", whose answer is "6".
+func fakeServer(t *testing.T) *httptest.Server {
+	send := func(w http.ResponseWriter, statusCode int, status string, data any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]any{"status": status, "data": data})
+	}
+	fail := func(w http.ResponseWriter, statusCode int, description string) {
+		send(w, statusCode, "fail", map[string]string{"short": "nope", "description": description})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/event/v2/state", func(w http.ResponseWriter, req *http.Request) {
+		if req.FormValue("id") != "team1" {
+			fail(w, http.StatusForbidden, "invalid team ID")
+			return
+		}
+		send(w, http.StatusOK, "success", map[string]any{
+			"Enabled":   true,
+			"TeamNames": map[string]string{"self": "Team One"},
+			"Puzzles":   map[string][]int{"sequence": {1, 2}},
+			"Solved":    map[string][]int{"sequence": {1}},
+		})
+	})
+	mux.HandleFunc("/event/v2/content/sequence/1/", func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/event/v2/content/sequence/1/puzzle.json":
+			json.NewEncoder(w).Encode(Puzzle{Body: "<p>1 2 3 4 5</p>", Attachments: []string{"hint.txt"}})
+		case "/event/v2/content/sequence/1/hint.txt":
+			io.WriteString(w, "count")
+		default:
+			fail(w, http.StatusNotFound, "not found")
+		}
+	})
+	mux.HandleFunc("/event/v2/answer", func(w http.ResponseWriter, req *http.Request) {
+		var args struct {
+			ID     string
+			Cat    string
+			Points int
+			Answer string
+		}
+		json.NewDecoder(req.Body).Decode(&args)
+		switch {
+		case req.Header.Get("Idempotency-Key") == "":
+			fail(w, http.StatusBadRequest, "no idempotency key")
+		case (args.ID != "team1") || (args.Cat != "sequence") || (args.Points != 1):
+			fail(w, http.StatusBadRequest, "wrong arguments")
+		case args.Answer != "6":
+			fail(w, http.StatusUnprocessableEntity, "incorrect answer")
+		default:
+			send(w, http.StatusOK, "success", map[string]string{"short": "accepted", "description": "1 points awarded in sequence"})
+		}
+	})
+	mux.HandleFunc("/event/v2/register", func(w http.ResponseWriter, req *http.Request) {
+		fail(w, http.StatusConflict, "team ID has already been registered")
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server := fakeServer(t)
+	defer server.Close()
+
+	c, err := New(server.URL+"/event", "team1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := c.State(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.IsSolved("sequence", 1) || state.IsSolved("sequence", 2) {
+		t.Error("Wrong solved puzzles:", state.Solved)
+	}
+
+	puzzle, err := c.Puzzle(ctx, "sequence", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Body != "<p>1 2 3 4 5</p>") || (len(puzzle.Attachments) != 1) {
+		t.Error("Wrong puzzle:", puzzle)
+	}
+	r, err := c.Open(ctx, "sequence", 1, "hint.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf, _ := io.ReadAll(r); string(buf) != "count" {
+		t.Error("Wrong attachment:", string(buf))
+	}
+	r.Close()
+	if _, err := c.Open(ctx, "sequence", 1, "nope.txt"); !errors.Is(err, ErrNotFound) {
+		t.Error("Wrong error for missing file:", err)
+	}
+
+	if _, err := c.Answer(ctx, "sequence", 1, "5"); !errors.Is(err, ErrIncorrectAnswer) {
+		t.Error("Wrong error for wrong answer:", err)
+	} else if err.Error() != "incorrect answer" {
+		t.Error("Wrong error description:", err)
+	}
+	if description, err := c.Answer(ctx, "sequence", 1, "6"); err != nil {
+		t.Error(err)
+	} else if description != "1 points awarded in sequence" {
+		t.Error("Wrong description:", description)
+	}
+
+	if err := c.Register(ctx, "Team One", ""); !errors.Is(err, ErrConflict) {
+		t.Error("Wrong error registering twice:", err)
+	}
+
+	c.TeamID = "team2"
+	if _, err := c.State(ctx); !errors.Is(err, ErrInvalidTeamID) {
+		t.Error("Wrong error for bad team ID:", err)
+	}
+
+	if _, err := New("moth.example.com", "team1"); err == nil {
+		t.Error("URL without a scheme accepted")
+	}
+}
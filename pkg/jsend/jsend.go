@@ -1,9 +1,12 @@
 package jsend
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // This provides a JSend function for MOTH
@@ -22,20 +25,70 @@ const (
 
 // JSONWrite writes out data as JSON, sending headers and content length
 func JSONWrite(w http.ResponseWriter, data interface{}) {
+	JSONWriteStatus(w, http.StatusOK, data) // RFC2616 makes it pretty clear that 4xx codes are for the user-agent
+}
+
+// JSONWriteStatus writes out data as JSON with the provided HTTP status code
+func JSONWriteStatus(w http.ResponseWriter, statusCode int, data interface{}) {
+	respBytes, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
+	w.WriteHeader(statusCode)
+	w.Write(respBytes)
+}
+
+// JSONWriteETag writes out data as JSON, with an ETag computed from its contents.
+//
+// If req has an If-None-Match header listing that ETag,
+// the client already has this data,
+// so only a 304 Not Modified status is sent.
+func JSONWriteETag(w http.ResponseWriter, req *http.Request, data interface{}) {
 	respBytes, err := json.Marshal(data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	sum := sha256.Sum256(respBytes)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatch(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(respBytes)))
-	w.WriteHeader(http.StatusOK) // RFC2616 makes it pretty clear that 4xx codes are for the user-agent
+	w.WriteHeader(http.StatusOK)
 	w.Write(respBytes)
 }
 
+// etagMatch returns true if etag is in ifNoneMatch,
+// the value of an If-None-Match header.
+// Weak and strong ETags are treated the same.
+func etagMatch(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if (candidate == "*") || (candidate == etag) {
+			return true
+		}
+	}
+	return false
+}
+
 // Send sends arbitrary data as a JSend response
 func Send(w http.ResponseWriter, status string, data interface{}) {
+	SendStatus(w, http.StatusOK, status, data)
+}
+
+// SendStatus sends arbitrary data as a JSend response with the provided HTTP status code
+func SendStatus(w http.ResponseWriter, statusCode int, status string, data interface{}) {
 	resp := struct {
 		Status string      `json:"status"`
 		Data   interface{} `json:"data"`
@@ -43,11 +96,29 @@ func Send(w http.ResponseWriter, status string, data interface{}) {
 	resp.Status = status
 	resp.Data = data
 
-	JSONWrite(w, resp)
+	JSONWriteStatus(w, statusCode, resp)
+}
+
+// SendETag sends arbitrary data as a JSend success response, with an ETag.
+// See JSONWriteETag.
+func SendETag(w http.ResponseWriter, req *http.Request, data interface{}) {
+	resp := struct {
+		Status string      `json:"status"`
+		Data   interface{} `json:"data"`
+	}{}
+	resp.Status = Success
+	resp.Data = data
+
+	JSONWriteETag(w, req, resp)
 }
 
 // Sendf sends a Sprintf()-formatted string as a JSend response
 func Sendf(w http.ResponseWriter, status, short string, format string, a ...interface{}) {
+	SendfStatus(w, http.StatusOK, status, short, format, a...)
+}
+
+// SendfStatus sends a Sprintf()-formatted string as a JSend response with the provided HTTP status code
+func SendfStatus(w http.ResponseWriter, statusCode int, status, short string, format string, a ...interface{}) {
 	data := struct {
 		Short       string `json:"short"`
 		Description string `json:"description"`
@@ -55,5 +126,5 @@ func Sendf(w http.ResponseWriter, status, short string, format string, a ...inte
 	data.Short = short
 	data.Description = fmt.Sprintf(format, a...)
 
-	Send(w, status, data)
+	SendStatus(w, statusCode, status, data)
 }
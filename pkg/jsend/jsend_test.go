@@ -1,6 +1,7 @@
 package jsend
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"testing"
 )
@@ -16,3 +17,44 @@ func TestEverything(t *testing.T) {
 		t.Errorf("HTTP Body %s", w.Body.Bytes())
 	}
 }
+
+func TestStatus(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	SendfStatus(w, 404, Fail, "No cows", "There are no cows here")
+	if w.Result().StatusCode != 404 {
+		t.Errorf("HTTP Status code: %d", w.Result().StatusCode)
+	}
+	if w.Body.String() != `{"status":"fail","data":{"short":"No cows","description":"There are no cows here"}}` {
+		t.Errorf("HTTP Body %s", w.Body.Bytes())
+	}
+}
+
+func TestETag(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	SendETag(w, req, "cows")
+	etag := w.Result().Header.Get("ETag")
+	if (w.Result().StatusCode != 200) || (etag == "") {
+		t.Fatalf("HTTP Status code: %d, ETag %q", w.Result().StatusCode, etag)
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"cats", ` + etag, "*"} {
+		w = httptest.NewRecorder()
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		SendETag(w, req, "cows")
+		if w.Result().StatusCode != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: HTTP Status code: %d", ifNoneMatch, w.Result().StatusCode)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: sent a body", ifNoneMatch)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req.Header.Set("If-None-Match", etag)
+	SendETag(w, req, "more cows")
+	if w.Result().StatusCode != 200 {
+		t.Errorf("Changed data: HTTP Status code: %d", w.Result().StatusCode)
+	}
+}
@@ -0,0 +1,344 @@
+// Package mothball reads and writes mothballs,
+// the zip files a category is packaged in for a server to run.
+//
+// A mothball holds, for each puzzle worth N points:
+//
+//	N/puzzle.json         the puzzle, as participants get it
+//	N/puzzle.LOCALE.json  each translation
+//	N/FILENAME            each attachment and script
+//
+// and, for the whole category:
+//
+//	puzzles.txt   the point value of every puzzle, one per line
+//	answers.txt   "N answer" for every answer
+//	checkers.txt  "N checker" for puzzles with a checker other than exact
+//	parts.txt     "N part answer" for every answer to a part or tier
+//	profile.txt   the build profile's name
+//
+// Mothballs from older versions may not have
+// checkers.txt, parts.txt, or profile.txt.
+//
+// This package knows the layout, and nothing about what's in puzzle.json:
+// decode that into a transpile.Puzzle.
+package mothball
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/zipfs"
+)
+
+// Files in the top of a mothball
+const (
+	PuzzlesFile  = "puzzles.txt"
+	AnswersFile  = "answers.txt"
+	CheckersFile = "checkers.txt"
+	PartsFile    = "parts.txt"
+	ProfileFile  = "profile.txt"
+)
+
+// PuzzleFile is the name of every puzzle's puzzle.json
+const PuzzleFile = "puzzle.json"
+
+// Part is the answers to one part or tier of a puzzle.
+type Part struct {
+	Name    string
+	Answers []string
+}
+
+// Reader reads a mothball.
+type Reader struct {
+	zr     *zip.Reader
+	fs     afero.Fs
+	closer io.Closer
+}
+
+// NewReader reads the mothball in r, which is size bytes long.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{zr: zr, fs: zipfs.New(zr)}, nil
+}
+
+// Open opens the mothball called filename in fs.
+// The file stays open until the Reader is closed.
+func Open(fs afero.Fs, filename string) (*Reader, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	r.closer = f
+	return r, nil
+}
+
+// Close closes the file the Reader was opened from, if there is one.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Inventory lists every puzzle in puzzles.txt, in order of point value.
+func (r *Reader) Inventory() ([]int, error) {
+	f, err := r.fs.Open(PuzzlesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	inv := []int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		points, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", PuzzlesFile, err)
+		}
+		inv = append(inv, points)
+	}
+	sort.Ints(inv)
+	return inv, scanner.Err()
+}
+
+// Open returns the file called filename, for the puzzle worth points.
+func (r *Reader) Open(points int, filename string) (afero.File, error) {
+	return r.fs.Open(fmt.Sprintf("%d/%s", points, filename))
+}
+
+// ReadFile returns the contents of the file called filename, for the puzzle worth points.
+func (r *Reader) ReadFile(points int, filename string) ([]byte, error) {
+	return afero.ReadFile(r.fs, fmt.Sprintf("%d/%s", points, filename))
+}
+
+// Files lists the files puzzle.json says the puzzle worth points has:
+// its attachments and scripts,
+// followed by a puzzle.LOCALE.json for each translation.
+func (r *Reader) Files(points int) ([]string, error) {
+	buf, err := r.ReadFile(points, PuzzleFile)
+	if err != nil {
+		return nil, err
+	}
+	var puzzle struct {
+		Attachments []string
+		Scripts     []string
+		Locales     []string
+	}
+	if err := json.Unmarshal(buf, &puzzle); err != nil {
+		return nil, fmt.Errorf("%d/%s: %w", points, PuzzleFile, err)
+	}
+	files := append(puzzle.Attachments, puzzle.Scripts...)
+	for _, locale := range puzzle.Locales {
+		files = append(files, fmt.Sprintf("puzzle.%s.json", locale))
+	}
+	return files, nil
+}
+
+// Answers returns the answers to the puzzle worth points, from answers.txt.
+func (r *Reader) Answers(points int) ([]string, error) {
+	f, err := r.fs.Open(AnswersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return pointsLines(f, points), nil
+}
+
+// Checker returns the name of the answer checker for the puzzle worth points,
+// or "" for the default.
+func (r *Reader) Checker(points int) string {
+	if checkers := r.pointsLines(CheckersFile, points); len(checkers) > 0 {
+		return checkers[0]
+	}
+	return ""
+}
+
+// Parts returns the answers to each part or tier of the puzzle worth points,
+// in the order they were written.
+func (r *Reader) Parts(points int) []Part {
+	parts := []Part{}
+	for _, line := range r.pointsLines(PartsFile, points) {
+		name, answer, _ := strings.Cut(line, " ")
+		if n := len(parts); (n == 0) || (parts[n-1].Name != name) {
+			parts = append(parts, Part{Name: name})
+		}
+		last := &parts[len(parts)-1]
+		last.Answers = append(last.Answers, answer)
+	}
+	return parts
+}
+
+// Profile returns the name of the build profile the mothball was built with,
+// or "" if it doesn't say.
+func (r *Reader) Profile() string {
+	buf, err := afero.ReadFile(r.fs, ProfileFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// Verify checks that the mothball is whole:
+// every file in it reads back with the right checksum,
+// puzzles.txt lists each puzzle once,
+// and each puzzle has a puzzle.json, and every file that puzzle.json lists.
+//
+// Every problem found is returned, joined together.
+func (r *Reader) Verify() error {
+	var errs []error
+	for _, zf := range r.zr.File {
+		f, err := zf.Open()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", zf.Name, err))
+			continue
+		}
+		_, err = io.Copy(io.Discard, f)
+		f.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", zf.Name, err))
+		}
+	}
+
+	inv, err := r.Inventory()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	if _, err := r.fs.Stat(AnswersFile); err != nil {
+		errs = append(errs, err)
+	}
+	for i, points := range inv {
+		if (i > 0) && (inv[i-1] == points) {
+			errs = append(errs, fmt.Errorf("%s: %d listed more than once", PuzzlesFile, points))
+			continue
+		}
+		files, err := r.Files(points)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, filename := range files {
+			if _, err := r.fs.Stat(fmt.Sprintf("%d/%s", points, filename)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pointsLines returns everything after the point value,
+// for each line in filename beginning with points.
+func (r *Reader) pointsLines(filename string, points int) []string {
+	// Older mothballs may not have every file
+	f, err := r.fs.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return pointsLines(f, points)
+}
+
+func pointsLines(r io.Reader, points int) []string {
+	ret := []string{}
+	prefix := strconv.Itoa(points) + " "
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+			ret = append(ret, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return ret
+}
+
+// Writer writes a mothball.
+//
+// Write each puzzle's files with Create,
+// record it with AddPuzzle,
+// and finish with Close.
+type Writer struct {
+	// Profile is the name of the build profile, recorded in profile.txt
+	Profile string
+
+	zw       *zip.Writer
+	puzzles  bytes.Buffer
+	answers  bytes.Buffer
+	checkers bytes.Buffer
+	parts    bytes.Buffer
+}
+
+// NewWriter returns a Writer writing a mothball to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// Create adds the file called filename, for the puzzle worth points.
+// The file must be written before the next call to Create or Close.
+func (w *Writer) Create(points int, filename string) (io.Writer, error) {
+	return w.zw.Create(fmt.Sprintf("%d/%s", points, filename))
+}
+
+// AddPuzzle lists the puzzle worth points in puzzles.txt,
+// and records its answers, checker, and the answers to its parts.
+// checker is "" for the default.
+func (w *Writer) AddPuzzle(points int, answers []string, checker string, parts []Part) {
+	fmt.Fprintln(&w.puzzles, points)
+	for _, answer := range answers {
+		fmt.Fprintln(&w.answers, points, answer)
+	}
+	if checker != "" {
+		fmt.Fprintln(&w.checkers, points, checker)
+	}
+	for _, part := range parts {
+		for _, answer := range part.Answers {
+			fmt.Fprintln(&w.parts, points, part.Name, answer)
+		}
+	}
+}
+
+// Close writes the category's files and finishes the mothball.
+// It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	for _, f := range []struct {
+		name string
+		buf  *bytes.Buffer
+	}{
+		{PuzzlesFile, &w.puzzles},
+		{AnswersFile, &w.answers},
+		{CheckersFile, &w.checkers},
+		{PartsFile, &w.parts},
+		{ProfileFile, bytes.NewBufferString(w.Profile + "\n")},
+	} {
+		fw, err := w.zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.buf.WriteTo(fw); err != nil {
+			return err
+		}
+	}
+	return w.zw.Close()
+}
@@ -0,0 +1,117 @@
+package mothball
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// writeTestMothball writes a mothball with two puzzles, leaving out any file in skip.
+func writeTestMothball(t *testing.T, skip ...string) []byte {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	w.Profile = "production"
+	for _, f := range []struct {
+		points   int
+		filename string
+		contents string
+	}{
+		{1, "puzzle.json", `{"Body": "<p>moo</p>", "Attachments": ["cow.txt"], "Locales": ["fr"]}`},
+		{1, "puzzle.fr.json", `{"Body": "<p>meuh</p>"}`},
+		{1, "cow.txt", "moo"},
+		{2, "puzzle.json", `{"Body": "<p>two</p>"}`},
+	} {
+		if strings.Contains(strings.Join(skip, " "), f.filename) {
+			continue
+		}
+		fw, err := w.Create(f.points, f.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.contents)
+	}
+	w.AddPuzzle(2, []string{"two", "deux"}, "regex", []Part{{"b", []string{"b1"}}, {"c", []string{"c1", "c2"}}})
+	w.AddPuzzle(1, []string{"moo"}, "", nil)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMothball(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat.mb", writeTestMothball(t), 0644)
+
+	r, err := Open(fs, "cat.mb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if inv, err := r.Inventory(); err != nil {
+		t.Error(err)
+	} else if (len(inv) != 2) || (inv[0] != 1) || (inv[1] != 2) {
+		t.Error("Wrong inventory:", inv)
+	}
+	if buf, err := r.ReadFile(1, "cow.txt"); err != nil {
+		t.Error(err)
+	} else if string(buf) != "moo" {
+		t.Error("Wrong attachment:", string(buf))
+	}
+	if files, err := r.Files(1); err != nil {
+		t.Error(err)
+	} else if strings.Join(files, " ") != "cow.txt puzzle.fr.json" {
+		t.Error("Wrong files:", files)
+	}
+	if answers, err := r.Answers(2); err != nil {
+		t.Error(err)
+	} else if strings.Join(answers, ",") != "two,deux" {
+		t.Error("Wrong answers:", answers)
+	}
+	if checker := r.Checker(2); checker != "regex" {
+		t.Error("Wrong checker:", checker)
+	}
+	if checker := r.Checker(1); checker != "" {
+		t.Error("Wrong checker:", checker)
+	}
+	if parts := r.Parts(2); (len(parts) != 2) || (parts[1].Name != "c") || (len(parts[1].Answers) != 2) {
+		t.Error("Wrong parts:", parts)
+	}
+	if profile := r.Profile(); profile != "production" {
+		t.Error("Wrong profile:", profile)
+	}
+	if err := r.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := Open(fs, "nope.mb"); err == nil {
+		t.Error("Opened a mothball that isn't there")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	buf := writeTestMothball(t, "cow.txt", "puzzle.fr.json")
+	r, err := NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err == nil {
+		t.Error("Missing files not found")
+	} else if msg := err.Error(); !strings.Contains(msg, "cow.txt") || !strings.Contains(msg, "puzzle.fr.json") {
+		t.Error("Wrong error:", err)
+	}
+
+	// Damage a file, without fixing its checksum
+	buf = writeTestMothball(t)
+	buf = bytes.Replace(buf, []byte("moo"), []byte("mew"), 1)
+	r, err = NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); err == nil {
+		t.Error("Corrupted file not found")
+	}
+}
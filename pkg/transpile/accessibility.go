@@ -0,0 +1,206 @@
+package transpile
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// MinContrastRatio is the least contrast between text and its background
+// that WCAG 2 level AA allows for normal text.
+const MinContrastRatio = 4.5
+
+// HeadinglessBlocks is how many paragraphs, lists, tables, and the like
+// a puzzle can have before it ought to have headings.
+const HeadinglessBlocks = 6
+
+// namedColors are the CSS color keywords puzzles are likely to use.
+var namedColors = map[string][3]uint8{
+	"black":   {0, 0, 0},
+	"white":   {255, 255, 255},
+	"gray":    {128, 128, 128},
+	"grey":    {128, 128, 128},
+	"silver":  {192, 192, 192},
+	"red":     {255, 0, 0},
+	"maroon":  {128, 0, 0},
+	"orange":  {255, 165, 0},
+	"yellow":  {255, 255, 0},
+	"olive":   {128, 128, 0},
+	"lime":    {0, 255, 0},
+	"green":   {0, 128, 0},
+	"aqua":    {0, 255, 255},
+	"cyan":    {0, 255, 255},
+	"teal":    {0, 128, 128},
+	"blue":    {0, 0, 255},
+	"navy":    {0, 0, 128},
+	"fuchsia": {255, 0, 255},
+	"magenta": {255, 0, 255},
+	"purple":  {128, 0, 128},
+	"pink":    {255, 192, 203},
+}
+
+// accessibilityProblems returns problems in an HTML document
+// that could keep somebody using assistive technology from solving the puzzle:
+// images without alt text,
+// inline styles with too little contrast between text and background,
+// and long documents without headings, or with heading levels skipped.
+func accessibilityProblems(doc string) []string {
+	problems := []string{}
+	headings := 0
+	blocks := 0
+	level := 0
+
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if (tt != html.StartTagToken) && (tt != html.SelfClosingTagToken) {
+			continue
+		}
+
+		name, hasAttr := z.TagName()
+		attrs := make(map[string]string)
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			attrs[string(key)] = string(val)
+		}
+
+		switch tag := string(name); tag {
+		case "img":
+			if _, ok := attrs["alt"]; !ok {
+				problems = append(problems, fmt.Sprintf("Image without alt text: %s", attrs["src"]))
+			}
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			headings++
+			n := int(tag[1] - '0')
+			if (level > 0) && (n > level+1) {
+				problems = append(problems, fmt.Sprintf("Heading level skipped: h%d to h%d", level, n))
+			}
+			level = n
+		case "p", "pre", "ul", "ol", "dl", "table", "blockquote":
+			blocks++
+		}
+
+		if style, ok := attrs["style"]; ok {
+			if problem := styleContrastProblem(style); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if (headings == 0) && (blocks >= HeadinglessBlocks) {
+		problems = append(problems, fmt.Sprintf("No headings in %d paragraphs, lists, or tables", blocks))
+	}
+	return problems
+}
+
+// styleContrastProblem describes the contrast problem in an inline style,
+// or returns the empty string if there isn't one.
+//
+// Only styles that set both the color and the background color can be checked.
+func styleContrastProblem(style string) string {
+	var fg, bg string
+	for _, decl := range strings.Split(style, ";") {
+		prop, val, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		prop = strings.ToLower(strings.TrimSpace(prop))
+		val = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(val), "!important"))
+		switch prop {
+		case "color":
+			fg = val
+		case "background", "background-color":
+			bg = val
+		}
+	}
+	if (fg == "") || (bg == "") {
+		return ""
+	}
+
+	fgRGB, ok := parseColor(fg)
+	if !ok {
+		return ""
+	}
+	bgRGB, ok := parseColor(bg)
+	if !ok {
+		return ""
+	}
+	ratio := contrastRatio(fgRGB, bgRGB)
+	if ratio >= MinContrastRatio {
+		return ""
+	}
+	return fmt.Sprintf("Low contrast (%.1f:1) between color %s and background %s", ratio, fg, bg)
+}
+
+// parseColor returns the red, green, and blue in a CSS color:
+// a name, #rgb, #rrggbb, or rgb(r, g, b).
+func parseColor(s string) ([3]uint8, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if rgb, ok := namedColors[s]; ok {
+		return rgb, true
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return [3]uint8{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return [3]uint8{}, false
+		}
+		return [3]uint8{uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+	}
+
+	if args, ok := strings.CutPrefix(s, "rgb("); ok {
+		fields := strings.Split(strings.TrimSuffix(args, ")"), ",")
+		if len(fields) != 3 {
+			return [3]uint8{}, false
+		}
+		var rgb [3]uint8
+		for i, field := range fields {
+			n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+			if err != nil {
+				return [3]uint8{}, false
+			}
+			rgb[i] = uint8(n)
+		}
+		return rgb, true
+	}
+
+	return [3]uint8{}, false
+}
+
+// contrastRatio returns the WCAG 2 contrast ratio between two colors,
+// from 1 (none) to 21 (black on white).
+func contrastRatio(a, b [3]uint8) float64 {
+	la := relativeLuminance(a)
+	lb := relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// relativeLuminance returns the WCAG 2 relative luminance of a color.
+func relativeLuminance(rgb [3]uint8) float64 {
+	var c [3]float64
+	for i, v := range rgb {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			c[i] = f / 12.92
+		} else {
+			c[i] = math.Pow((f+0.055)/1.055, 2.4)
+		}
+	}
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
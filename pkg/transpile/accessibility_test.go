@@ -0,0 +1,38 @@
+package transpile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccessibilityProblems(t *testing.T) {
+	cases := []struct {
+		doc      string
+		problems []string
+	}{
+		{`<p>Fine.</p><img src="cow.png" alt="A cow"><img src="line.png" alt="">`, nil},
+		{`<p><img src="cow.png"></p>`, []string{"Image without alt text: cow.png"}},
+		{`<p style="color: #777; background-color: #888">Hidden</p>`, []string{"Low contrast (1.3:1) between color #777 and background #888"}},
+		{`<p style="color: white; background: black">Loud</p>`, nil},
+		{`<p style="color: yellow">Unknown background</p>`, nil},
+		{`<span style="color: rgb(255, 255, 0); background-color: white !important">Sunny</span>`, []string{"Low contrast (1.1:1) between color rgb(255, 255, 0) and background white"}},
+		{`<h1>One</h1><h3>Three</h3><h2>Two</h2><h3>Three</h3>`, []string{"Heading level skipped: h1 to h3"}},
+		{strings.Repeat("<p>Blah.</p>", 6), []string{"No headings in 6 paragraphs, lists, or tables"}},
+		{"<h2>Story</h2>" + strings.Repeat("<p>Blah.</p>", 6), nil},
+	}
+	for _, c := range cases {
+		problems := accessibilityProblems(c.doc)
+		if strings.Join(problems, "|") != strings.Join(c.problems, "|") {
+			t.Errorf("accessibilityProblems(%q) = %q, want %q", c.doc, problems, c.problems)
+		}
+	}
+}
+
+func TestContrastRatio(t *testing.T) {
+	if ratio := contrastRatio([3]uint8{0, 0, 0}, [3]uint8{255, 255, 255}); ratio != 21 {
+		t.Error("Wrong contrast between black and white", ratio)
+	}
+	if ratio := contrastRatio([3]uint8{10, 20, 30}, [3]uint8{10, 20, 30}); ratio != 1 {
+		t.Error("Wrong contrast between the same colors", ratio)
+	}
+}
@@ -0,0 +1,61 @@
+package transpile
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// AnswerHashIterations is how many PBKDF2 iterations go into each answer hash.
+const AnswerHashIterations = 10000
+
+// AnswerHashLength is how many hexits of each answer hash are sent to the client.
+//
+// Hashes are deliberately truncated, so that many strings match any given hash.
+// Someone brute-forcing the hash list still has to pick through
+// a lot of potentially correct answers when they're done.
+const AnswerHashLength = 4
+
+// NewAnswerSalt returns a new random salt for answer hashes.
+func NewAnswerSalt() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("reading random salt: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// AnswerHash returns the truncated, hex-encoded
+// PBKDF2-HMAC-SHA256 hash of answer, using salt and iterations.
+//
+// Clients compute the same thing with WebCrypto,
+// using the UTF-8 encoding of both answer and salt.
+func AnswerHash(answer, salt string, iterations int) string {
+	sum := pbkdf2SHA256([]byte(answer), []byte(salt), iterations)
+	return hex.EncodeToString(sum)[:AnswerHashLength]
+}
+
+// pbkdf2SHA256 computes the first block of PBKDF2-HMAC-SHA256 (RFC 8018).
+// One block is all we need for a 32-byte key.
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+
+	prf.Write(salt)
+	binary.Write(prf, binary.BigEndian, uint32(1))
+	u := prf.Sum(nil)
+
+	t := make([]byte, len(u))
+	copy(t, u)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range t {
+			t[j] ^= u[j]
+		}
+	}
+	return t
+}
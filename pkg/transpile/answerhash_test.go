@@ -0,0 +1,31 @@
+package transpile
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Test vector from RFC 7914, section 11
+	sum := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1)
+	if hex.EncodeToString(sum) != "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" {
+		t.Error("Wrong PBKDF2 output", hex.EncodeToString(sum))
+	}
+}
+
+func TestAnswerHash(t *testing.T) {
+	a := AnswerHash("moo", "salt", 10)
+	if len(a) != AnswerHashLength {
+		t.Error("Wrong hash length", a)
+	}
+	if a != AnswerHash("moo", "salt", 10) {
+		t.Error("Hash isn't repeatable")
+	}
+	if a == AnswerHash("moo", "pepper", 10) {
+		t.Error("Salt doesn't change the hash")
+	}
+
+	if NewAnswerSalt() == NewAnswerSalt() {
+		t.Error("Salts aren't random")
+	}
+}
@@ -0,0 +1,92 @@
+package transpile
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// PuzzleAuthor is someone who wrote a puzzle, and how to reach them.
+type PuzzleAuthor struct {
+	// Name is how the author is credited
+	Name string
+
+	// Email is where to contact the author, if anywhere
+	Email string `json:",omitempty"`
+
+	// Handle is what the author goes by online, like on a chat server
+	Handle string `json:",omitempty"`
+}
+
+// UnmarshalYAML allows a PuzzleAuthor to be specified as a single string,
+// either a name, or a name and email address, like "Ada <ada@example.org>".
+func (pa *PuzzleAuthor) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*pa = parseAuthor(s)
+		return nil
+	}
+
+	fields := new(struct {
+		Name   string
+		Email  string
+		Handle string
+	})
+	if err := unmarshal(fields); err != nil {
+		return err
+	}
+	*pa = PuzzleAuthor(*fields)
+	return nil
+}
+
+// parseAuthor returns the author named by s,
+// which may have an email address, like "Ada <ada@example.org>".
+func parseAuthor(s string) PuzzleAuthor {
+	if strings.Contains(s, "<") {
+		if addr, err := mail.ParseAddress(s); err == nil {
+			return PuzzleAuthor{Name: addr.Name, Email: addr.Address}
+		}
+	}
+	return PuzzleAuthor{Name: s}
+}
+
+// setAuthors sets the puzzle's Authors to the names of authors,
+// and AuthorDetails to authors, if any of them have more than a name.
+func (puzzle *Puzzle) setAuthors(authors []PuzzleAuthor) {
+	puzzle.Authors = make([]string, len(authors))
+	detailed := false
+	for i, author := range authors {
+		puzzle.Authors[i] = author.Name
+		if (author.Email != "") || (author.Handle != "") {
+			detailed = true
+		}
+	}
+	if detailed {
+		puzzle.AuthorDetails = authors
+	}
+}
+
+// validateAuthors makes sure every author has a name,
+// a plain email address if any, and a handle with no spaces.
+func (puzzle *Puzzle) validateAuthors() error {
+	for _, author := range puzzle.AuthorDetails {
+		if strings.TrimSpace(author.Name) == "" {
+			return fmt.Errorf("author needs a name")
+		}
+		if author.Email != "" {
+			addr, err := mail.ParseAddress(author.Email)
+			if (err != nil) || (addr.Name != "") || (addr.Address != author.Email) {
+				return fmt.Errorf("author %s: invalid email address %q", author.Name, author.Email)
+			}
+		}
+		if strings.ContainsAny(author.Handle, " \t\r\n") {
+			return fmt.Errorf("author %s: handle %q has spaces", author.Name, author.Handle)
+		}
+	}
+	for _, name := range puzzle.Authors {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("author needs a name")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleAuthors(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - Arthur\n  - name: Ada\n    email: ada@example.org\n    handle: \"@ada\"\n  - Bob <bob@example.org>\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("author: Carol <carol@example.org>\nanswer: a\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("author: Dave\nanswer: a\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - name: Eve\n    email: not an address\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "5/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - email: nobody@example.org\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "6/puzzle.md", []byte("---\nanswers: [a]\nauthors:\n  - name: Fay\n    handle: two words\n---\nHi.\n"), 0644)
+
+	p, err := NewFsPuzzlePoints(fs, 1).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Authors) != 3) || (p.Authors[0] != "Arthur") || (p.Authors[1] != "Ada") || (p.Authors[2] != "Bob") {
+		t.Error("Wrong authors:", p.Authors)
+	}
+	if (len(p.AuthorDetails) != 3) ||
+		(p.AuthorDetails[1] != PuzzleAuthor{Name: "Ada", Email: "ada@example.org", Handle: "@ada"}) ||
+		(p.AuthorDetails[2] != PuzzleAuthor{Name: "Bob", Email: "bob@example.org"}) {
+		t.Error("Wrong author details:", p.AuthorDetails)
+	}
+	ProductionProfile.Strip(&p)
+	if (p.AuthorDetails[1].Email != "") || (p.AuthorDetails[1].Handle != "@ada") {
+		t.Error("Production profile kept the wrong details:", p.AuthorDetails)
+	}
+
+	if p, err := NewFsPuzzlePoints(fs, 2).Puzzle(); err != nil {
+		t.Error(err)
+	} else if (len(p.AuthorDetails) != 1) || (p.AuthorDetails[0].Email != "carol@example.org") {
+		t.Error("Wrong author details:", p.AuthorDetails)
+	}
+	if p, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err != nil {
+		t.Error(err)
+	} else if (len(p.Authors) != 1) || (p.AuthorDetails != nil) {
+		t.Error("Wrong authors:", p.Authors, p.AuthorDetails)
+	}
+	for _, points := range []int{4, 5, 6} {
+		if _, err := NewFsPuzzlePoints(fs, points).Puzzle(); err == nil {
+			t.Errorf("Puzzle %d: bad author accepted", points)
+		}
+	}
+}
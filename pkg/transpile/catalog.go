@@ -0,0 +1,181 @@
+package transpile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"golang.org/x/net/html"
+)
+
+// Catalog describes every puzzle in a puzzle repository,
+// for planning events out of the categories in it.
+type Catalog struct {
+	Categories []CatalogCategory
+
+	// TotalPoints is the sum of every puzzle's point value
+	TotalPoints int
+}
+
+// CatalogCategory describes a category in a Catalog.
+type CatalogCategory struct {
+	Name    string
+	Puzzles []CatalogPuzzle
+
+	// TotalPoints is the sum of the point value of each puzzle in this category
+	TotalPoints int
+
+	// Authors lists every author of any puzzle in this category
+	Authors []string
+
+	// Errors lists the problems reading this category or its puzzles
+	Errors []string `json:",omitempty"`
+}
+
+// CatalogPuzzle describes a puzzle in a Catalog.
+type CatalogPuzzle struct {
+	Points      int
+	Title       string
+	Authors     []string
+	Tags        []string `json:",omitempty"`
+	Difficulty  int      `json:",omitempty"`
+	Objective   string   `json:",omitempty"`
+	KSAs        []string
+	Attachments []CatalogAttachment
+}
+
+// CatalogAttachment is an attachment in a CatalogPuzzle.
+type CatalogAttachment struct {
+	Filename string
+	Size     int64
+}
+
+// FsCatalog returns a Catalog of every category in fs.
+//
+// Problems with a category or puzzle are listed in that category's Errors,
+// so one broken puzzle doesn't hide the rest of the repository.
+func FsCatalog(fs afero.Fs) (Catalog, error) {
+	catalog := Catalog{
+		Categories: []CatalogCategory{},
+	}
+
+	dirEnts, err := afero.ReadDir(fs, ".")
+	if err != nil {
+		return catalog, err
+	}
+	for _, ent := range dirEnts {
+		if !ent.IsDir() || strings.HasPrefix(ent.Name(), ".") {
+			continue
+		}
+		cc := catalogCategory(NewFsCategory(fs, ent.Name()))
+		cc.Name = ent.Name()
+		catalog.Categories = append(catalog.Categories, cc)
+		catalog.TotalPoints += cc.TotalPoints
+	}
+	return catalog, nil
+}
+
+func catalogCategory(c Category) CatalogCategory {
+	cc := CatalogCategory{
+		Puzzles: []CatalogPuzzle{},
+		Authors: []string{},
+	}
+
+	inv, err := c.Inventory()
+	if err != nil {
+		cc.Errors = append(cc.Errors, err.Error())
+		return cc
+	}
+	sort.Ints(inv)
+
+	authors := make(map[string]bool)
+	for _, points := range inv {
+		puzzle, err := c.Puzzle(points)
+		if err != nil {
+			cc.Errors = append(cc.Errors, fmt.Sprintf("Puzzle %d: %s", points, err))
+			continue
+		}
+
+		cp := CatalogPuzzle{
+			Points:      points,
+			Title:       puzzleTitle(puzzle),
+			Authors:     puzzle.Authors,
+			Tags:        puzzle.Tags,
+			Difficulty:  puzzle.Difficulty,
+			Objective:   puzzle.Objective,
+			KSAs:        puzzle.KSAs,
+			Attachments: []CatalogAttachment{},
+		}
+		if cp.Authors == nil {
+			cp.Authors = []string{}
+		}
+		if cp.KSAs == nil {
+			cp.KSAs = []string{}
+		}
+		for _, filename := range puzzle.Attachments {
+			size, err := attachmentSize(c, points, filename)
+			if err != nil {
+				cc.Errors = append(cc.Errors, fmt.Sprintf("Puzzle %d: %s: %s", points, filename, err))
+				continue
+			}
+			cp.Attachments = append(cp.Attachments, CatalogAttachment{filename, size})
+		}
+
+		for _, author := range puzzle.Authors {
+			if !authors[author] {
+				authors[author] = true
+				cc.Authors = append(cc.Authors, author)
+			}
+		}
+		cc.Puzzles = append(cc.Puzzles, cp)
+		cc.TotalPoints += points
+	}
+	sort.Strings(cc.Authors)
+	return cc
+}
+
+// attachmentSize returns the size of an attachment.
+func attachmentSize(c Category, points int, filename string) (int64, error) {
+	f, err := c.Open(points, filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Seek(0, io.SeekEnd)
+}
+
+// puzzleTitle returns a short title for puzzle:
+// its debug summary, or the first heading in its body.
+func puzzleTitle(puzzle Puzzle) string {
+	if puzzle.Debug.Summary != "" {
+		return puzzle.Debug.Summary
+	}
+
+	z := html.NewTokenizer(strings.NewReader(puzzle.Body))
+	inHeading := false
+	title := new(strings.Builder)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			switch name, _ := z.TagName(); string(name) {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				inHeading = true
+			}
+		case html.EndTagToken:
+			if inHeading {
+				switch name, _ := z.TagName(); string(name) {
+				case "h1", "h2", "h3", "h4", "h5", "h6":
+					return strings.Join(strings.Fields(title.String()), " ")
+				}
+			}
+		case html.TextToken:
+			if inHeading {
+				title.Write(z.Text())
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package transpile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestFsCatalog(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers:\n  - moo\nauthors:\n  - Buster\n  - Arthur\nksas:\n  - K0001\nattachments:\n  - moo.txt\n---\n# Mooing\n\nWhat do cows say?\n"), 0644)
+	afero.WriteFile(fs, "cows/1/moo.txt", []byte("Moo."), 0644)
+	afero.WriteFile(fs, "cows/3/puzzle.md", []byte("---\nanswers:\n  - grass\nauthors:\n  - Arthur\ndebug:\n  summary: Eating\n---\nWhat do cows eat?\n"), 0644)
+	afero.WriteFile(fs, "cows/5/puzzle.md", []byte("---\nanswers:\n  - milk\nattachments:\n  - missing.txt\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "pigs/2/puzzle.md", []byte("---\nanswers:\n  - oink\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, ".git/HEAD", []byte("ref: refs/heads/main\n"), 0644)
+
+	catalog, err := FsCatalog(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(catalog.Categories) != 2) || (catalog.TotalPoints != 11) {
+		t.Fatal("Wrong catalog", catalog)
+	}
+
+	cows := catalog.Categories[0]
+	if (cows.Name != "cows") || (cows.TotalPoints != 9) || (len(cows.Puzzles) != 3) {
+		t.Fatal("Wrong category", cows)
+	}
+	if !reflect.DeepEqual(cows.Authors, []string{"Arthur", "Buster"}) {
+		t.Error("Wrong authors", cows.Authors)
+	}
+	if len(cows.Errors) != 1 {
+		t.Error("Wrong errors", cows.Errors)
+	}
+
+	expected := CatalogPuzzle{
+		Points:      1,
+		Title:       "Mooing",
+		Authors:     []string{"Buster", "Arthur"},
+		KSAs:        []string{"K0001"},
+		Attachments: []CatalogAttachment{{"moo.txt", 4}},
+	}
+	if !reflect.DeepEqual(cows.Puzzles[0], expected) {
+		t.Error("Wrong puzzle", cows.Puzzles[0])
+	}
+	if cows.Puzzles[1].Title != "Eating" {
+		t.Error("Summary not used as title", cows.Puzzles[1])
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os/exec"
 	"path"
 	"strconv"
@@ -33,6 +35,10 @@ type Category interface {
 
 	// Answer returns whether the given answer is correct.
 	Answer(points int, answer string) bool
+
+	// AnswerPart returns the name of the part or tier of a puzzle solved by answer,
+	// or the empty string if it doesn't solve any part or tier.
+	AnswerPart(points int, answer string) string
 }
 
 // NopReadCloser provides an io.ReadCloser which does nothing.
@@ -56,7 +62,7 @@ func NewFsCategory(fs afero.Fs, cat string) Category {
 	bfs := NewRecursiveBasePathFs(fs, cat)
 	if info, err := bfs.Stat("mkcategory"); (err == nil) && (info.Mode()&0100 != 0) {
 		if command, err := bfs.RealPath(info.Name()); err != nil {
-			log.Println("Unable to resolve full path to", info.Name())
+			slog.Warn("unable to resolve full path", "category", cat, "file", info.Name())
 		} else {
 			return FsCommandCategory{
 				fs:      bfs,
@@ -86,7 +92,7 @@ func (c FsCategory) Inventory() ([]int, error) {
 			continue
 		}
 		if points, err := strconv.Atoi(ent.Name()); err != nil {
-			log.Println("Skipping non-numeric directory", ent.Name())
+			slog.Warn("skipping non-numeric directory", "directory", ent.Name())
 			continue
 		} else {
 			puzzles = append(puzzles, points)
@@ -112,12 +118,35 @@ func (c FsCategory) Answer(points int, answer string) bool {
 	if err != nil {
 		return false
 	}
-	for _, a := range p.Answers {
-		if a == answer {
-			return true
-		}
+	correct, err := CheckAnswerFiles(p.Checker, categoryFiles(c, points), p.Answers, answer)
+	if err != nil {
+		slog.Error("checking answer", "points", points, "error", err)
+	}
+	return correct
+}
+
+// AnswerPart returns the name of the puzzle part solved by answer.
+func (c FsCategory) AnswerPart(points int, answer string) string {
+	return answerPart(c, points, answer)
+}
+
+func answerPart(c Category, points int, answer string) string {
+	p, err := c.Puzzle(points)
+	if err != nil {
+		return ""
+	}
+	part, err := p.AnswerPartFiles(categoryFiles(c, points), answer)
+	if err != nil {
+		slog.Error("checking answer", "points", points, "error", err)
+	}
+	return part
+}
+
+// categoryFiles returns a PuzzleFiles opening the files of the puzzle in c worth points.
+func categoryFiles(c Category, points int) PuzzleFiles {
+	return func(filename string) (io.ReadCloser, error) {
+		return c.Open(points, filename)
 	}
-	return false
 }
 
 // FsCommandCategory provides a category backed by running an external command.
@@ -142,60 +171,156 @@ func (c FsCommandCategory) run(command string, args ...string) ([]byte, error) {
 	return out, err
 }
 
-// Inventory returns a list of point values for this category.
-func (c FsCommandCategory) Inventory() ([]int, error) {
-	stdout, err := c.run("inventory")
+// cachedRun is run, using earlier output if nothing has changed:
+// see SetCommandCacheTTL.
+func (c FsCommandCategory) cachedRun(command string, args ...string) ([]byte, error) {
+	cmdargs := append([]string{command}, args...)
+	return commands.run(c.fs, c.command, cmdargs, func() ([]byte, error) {
+		return c.run(command, args...)
+	})
+}
+
+// generatedPuzzle is a whole puzzle in the output of "mkcategory inventory".
+type generatedPuzzle struct {
+	Points int
+	Puzzle
+}
+
+// inventory runs "mkcategory inventory".
+//
+// Each entry in Puzzles is either a point value,
+// or a whole puzzle object with its point value in Points.
+// Whole puzzles are returned in the map.
+func (c FsCommandCategory) inventory() ([]int, map[int]Puzzle, error) {
+	stdout, err := c.cachedRun("inventory")
 	if exerr, ok := err.(*exec.ExitError); ok {
-		return nil, fmt.Errorf("inventory: %s: %s", err, string(exerr.Stderr))
+		return nil, nil, fmt.Errorf("inventory: %s: %s", err, string(exerr.Stderr))
 	} else if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	inv := InventoryResponse{}
-	if err := json.Unmarshal(stdout, &inv); err != nil {
-		return nil, err
+	inv := struct {
+		Puzzles []json.RawMessage
+	}{}
+	if err := DecodeStrictJSON(stdout, &inv); err != nil {
+		return nil, nil, fmt.Errorf("inventory: %w", err)
+	}
+
+	points := make([]int, 0, len(inv.Puzzles))
+	puzzles := make(map[int]Puzzle)
+	offset := 0
+	for i, entry := range inv.Puzzles {
+		// Find where this entry is, so errors point to the right place
+		offset += bytes.Index(stdout[offset:], entry)
+		if bytes.HasPrefix(bytes.TrimSpace(entry), []byte("{")) {
+			gp := generatedPuzzle{}
+			if err := DecodeStrictJSON(entry, &gp); err != nil {
+				var jsonErr *JSONError
+				if errors.As(err, &jsonErr) {
+					err = jsonErr.within(stdout, int64(offset), fmt.Sprintf("Puzzles.%d", i))
+				}
+				return nil, nil, fmt.Errorf("inventory: %w", err)
+			}
+			if gp.Points <= 0 {
+				return nil, nil, fmt.Errorf("inventory: puzzle without Points")
+			}
+			points = append(points, gp.Points)
+			puzzles[gp.Points] = gp.Puzzle
+		} else {
+			var p int
+			if err := json.Unmarshal(entry, &p); err != nil {
+				err = newJSONError(stdout, int64(offset), fmt.Sprintf("Puzzles.%d", i), "expected whole number or object, got %s", entry)
+				return nil, nil, fmt.Errorf("inventory: %w", err)
+			}
+			points = append(points, p)
+		}
+		offset += len(entry)
 	}
+	return points, puzzles, nil
+}
 
-	return inv.Puzzles, nil
+// Inventory returns a list of point values for this category.
+func (c FsCommandCategory) Inventory() ([]int, error) {
+	points, _, err := c.inventory()
+	return points, err
 }
 
 // Puzzle returns a Puzzle structure for the given point value.
+//
+// If the inventory had the whole puzzle, that's used.
+// Otherwise, "mkcategory puzzle" is run.
 func (c FsCommandCategory) Puzzle(points int) (Puzzle, error) {
 	var p Puzzle
 
-	stdout, err := c.run("puzzle", strconv.Itoa(points))
-	if err != nil {
+	if _, puzzles, err := c.inventory(); err != nil {
 		return p, err
+	} else if generated, ok := puzzles[points]; ok {
+		p = generated
+	} else {
+		stdout, err := c.cachedRun("puzzle", strconv.Itoa(points))
+		if err != nil {
+			return p, err
+		}
+		if err := DecodeStrictJSON(stdout, &p); err != nil {
+			return p, fmt.Errorf("puzzle: %w", err)
+		}
 	}
 
-	if err := json.Unmarshal(stdout, &p); err != nil {
+	if err := p.validateAuthors(); err != nil {
+		return p, err
+	}
+	if err := p.validateTags(); err != nil {
+		return p, err
+	}
+	if err := p.validateDifficulty(); err != nil {
+		return p, err
+	}
+	if err := p.validateParts(); err != nil {
 		return p, err
 	}
-
 	p.computeAnswerHashes()
+	p.checkContent()
 
 	return p, nil
 }
 
 // Open returns an io.ReadCloser for the given filename.
 func (c FsCommandCategory) Open(points int, filename string) (ReadSeekCloser, error) {
-	stdout, err := c.run("file", strconv.Itoa(points), filename)
+	stdout, err := c.cachedRun("file", strconv.Itoa(points), filename)
 	return nopCloser{bytes.NewReader(stdout)}, err
 }
 
 // Answer checks whether an answer is correct.
+//
+// If the inventory had the whole puzzle, its answers are used.
+// Otherwise, "mkcategory answer" is run.
 func (c FsCommandCategory) Answer(points int, answer string) bool {
+	if _, puzzles, err := c.inventory(); err == nil {
+		if p, ok := puzzles[points]; ok {
+			correct, err := CheckAnswerFiles(p.Checker, categoryFiles(c, points), p.Answers, answer)
+			if err != nil {
+				slog.Error("checking answer", "points", points, "error", err)
+			}
+			return correct
+		}
+	}
+
 	stdout, err := c.run("answer", strconv.Itoa(points), answer)
 	if err != nil {
-		log.Printf("ERROR: Answering %d points: %s", points, err)
+		slog.Error("checking answer", "points", points, "error", err)
 		return false
 	}
 
 	ans := AnswerResponse{}
 	if err := json.Unmarshal(stdout, &ans); err != nil {
-		log.Printf("ERROR: Answering %d points: %s", points, err)
+		slog.Error("checking answer", "points", points, "error", err)
 		return false
 	}
 
 	return ans.Correct
 }
+
+// AnswerPart returns the name of the puzzle part solved by answer.
+func (c FsCommandCategory) AnswerPart(points int, answer string) string {
+	return answerPart(c, points, answer)
+}
@@ -53,6 +53,40 @@ func TestFsCategory(t *testing.T) {
 	}
 }
 
+func TestFsCommandCategoryPuzzles(t *testing.T) {
+	fs := NewRecursiveBasePathFs(afero.NewOsFs(), "testdata")
+	bulk := NewFsCategory(fs, "bulk")
+
+	if inv, err := bulk.Inventory(); err != nil {
+		t.Fatal(err)
+	} else if (len(inv) != 4) || (inv[2] != 3) || (inv[3] != 10) {
+		t.Error("Wrong inventory:", inv)
+	}
+
+	if p, err := bulk.Puzzle(2); err != nil {
+		t.Error(err)
+	} else if p.Body != "What is 2 + 2?" {
+		t.Error("Wrong puzzle from inventory:", p.Body)
+	} else if len(p.AnswerHashes) != 1 {
+		t.Error("No answer hashes:", p.AnswerHashes)
+	}
+	if p, err := bulk.Puzzle(10); err != nil {
+		t.Error(err)
+	} else if p.Body != "The big one" {
+		t.Error("Wrong puzzle from mkcategory puzzle:", p.Body)
+	}
+
+	if !bulk.Answer(3, "6") {
+		t.Error("Right answer to inventory puzzle marked wrong")
+	}
+	if bulk.Answer(3, "7") {
+		t.Error("Wrong answer to inventory puzzle marked right")
+	}
+	if !bulk.Answer(10, "big") {
+		t.Error("Right answer to mkcategory puzzle marked wrong")
+	}
+}
+
 func TestOsFsCategory(t *testing.T) {
 	fs := NewRecursiveBasePathFs(afero.NewOsFs(), "testdata")
 	static := NewFsCategory(fs, "static")
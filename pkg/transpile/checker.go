@@ -0,0 +1,265 @@
+package transpile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DefaultAnswerChecker is the checker used when a puzzle doesn't name one.
+const DefaultAnswerChecker = "exact"
+
+// AnswerChecker decides whether a submitted answer is correct.
+type AnswerChecker interface {
+	// Check returns true if submitted is correct, given the answers listed for a puzzle.
+	Check(answers []string, submitted string) (bool, error)
+}
+
+// PuzzleFiles opens one of a puzzle's files, by the name it's listed under.
+type PuzzleFiles func(filename string) (io.ReadCloser, error)
+
+// FileAnswerChecker is an AnswerChecker that needs the puzzle's own files,
+// like a checker command shipped with the puzzle.
+type FileAnswerChecker interface {
+	AnswerChecker
+
+	// CheckFiles is like Check, with open to get at the puzzle's files.
+	CheckFiles(open PuzzleFiles, answers []string, submitted string) (bool, error)
+}
+
+// AnswerCheckerFunc adapts an ordinary function to an AnswerChecker.
+type AnswerCheckerFunc func(answers []string, submitted string) (bool, error)
+
+// Check calls f(answers, submitted).
+func (f AnswerCheckerFunc) Check(answers []string, submitted string) (bool, error) {
+	return f(answers, submitted)
+}
+
+var answerCheckers = make(map[string]AnswerChecker)
+var answerCheckersLock sync.RWMutex
+
+// RegisterAnswerChecker makes an AnswerChecker available to puzzles under name.
+// Registering a name twice replaces the first checker.
+func RegisterAnswerChecker(name string, checker AnswerChecker) {
+	answerCheckersLock.Lock()
+	defer answerCheckersLock.Unlock()
+	answerCheckers[name] = checker
+}
+
+// GetAnswerChecker returns the AnswerChecker registered under name.
+// The empty string names DefaultAnswerChecker.
+func GetAnswerChecker(name string) (AnswerChecker, error) {
+	if name == "" {
+		name = DefaultAnswerChecker
+	}
+	answerCheckersLock.RLock()
+	defer answerCheckersLock.RUnlock()
+	checker, ok := answerCheckers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown answer checker: %s", name)
+	}
+	return checker, nil
+}
+
+// CheckAnswer uses the checker registered under checkerName to check submitted.
+func CheckAnswer(checkerName string, answers []string, submitted string) (bool, error) {
+	return CheckAnswerFiles(checkerName, nil, answers, submitted)
+}
+
+// CheckAnswerFiles is like CheckAnswer,
+// but a checker that needs the puzzle's files gets them from open.
+func CheckAnswerFiles(checkerName string, open PuzzleFiles, answers []string, submitted string) (bool, error) {
+	checker, err := GetAnswerChecker(checkerName)
+	if err != nil {
+		return false, err
+	}
+	if fc, ok := checker.(FileAnswerChecker); ok && (open != nil) {
+		return fc.CheckFiles(open, answers, submitted)
+	}
+	return checker.Check(answers, submitted)
+}
+
+func init() {
+	RegisterAnswerChecker("exact", AnswerCheckerFunc(exactChecker))
+	RegisterAnswerChecker("regex", AnswerCheckerFunc(regexChecker))
+	RegisterAnswerChecker("numeric", AnswerCheckerFunc(numericChecker))
+	RegisterAnswerChecker("anagram", AnswerCheckerFunc(anagramChecker))
+	RegisterAnswerChecker("set", AnswerCheckerFunc(setChecker))
+	RegisterAnswerChecker(QuizChecker, AnswerCheckerFunc(quizChecker))
+	RegisterAnswerChecker("command", CommandChecker{Timeout: 2 * time.Second})
+	RegisterAnswerChecker(UploadChecker, UploadCommandChecker{Timeout: 10 * time.Second})
+}
+
+// exactChecker accepts a submission identical to any answer.
+func exactChecker(answers []string, submitted string) (bool, error) {
+	for _, answer := range answers {
+		if answer == submitted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// regexChecker treats each answer as a regular expression,
+// which must match the entire submission.
+func regexChecker(answers []string, submitted string) (bool, error) {
+	for _, answer := range answers {
+		re, err := regexp.Compile("^(?:" + answer + ")$")
+		if err != nil {
+			return false, err
+		}
+		if re.MatchString(submitted) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// anagramChecker accepts a submission with the same letters as any answer, in any order.
+// Case and whitespace are ignored.
+func anagramChecker(answers []string, submitted string) (bool, error) {
+	want := anagramKey(submitted)
+	for _, answer := range answers {
+		if anagramKey(answer) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func anagramKey(s string) string {
+	runes := make([]rune, 0, len(s))
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsSpace(r) {
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return string(runes)
+}
+
+// setChecker treats each answer as a comma-separated list of items.
+// A submission is accepted if it lists the same items, in any order.
+func setChecker(answers []string, submitted string) (bool, error) {
+	want := setKey(submitted)
+	for _, answer := range answers {
+		if setKey(answer) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func setKey(s string) string {
+	items := strings.Split(s, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// CheckerDirPrefix starts the name of every directory a checker command is run in.
+const CheckerDirPrefix = "moth-checker-"
+
+// ErrCommandCheckerDisabled means a puzzle uses the command checker,
+// but this server doesn't run checker commands.
+var ErrCommandCheckerDisabled = errors.New("command checker: checker commands aren't run here")
+
+// CommandChecker runs the first answer as a command,
+// with the submission as its only argument.
+// The submission is correct if the command exits successfully.
+//
+// The command is one of the puzzle's own files,
+// copied into a new temporary directory and run there,
+// with almost nothing in its environment.
+type CommandChecker struct {
+	// Enabled must be set for anything to run:
+	// whoever can change a puzzle can run anything they like,
+	// as whoever runs the checker.
+	Enabled bool
+
+	Timeout time.Duration
+
+	// Sandbox, if set, is a command and its arguments
+	// which the checker command is run under,
+	// like bwrap or nsjail.
+	Sandbox []string
+}
+
+// Check always returns an error:
+// the command is in the puzzle's files, so CheckFiles is needed.
+func (c CommandChecker) Check(answers []string, submitted string) (bool, error) {
+	return false, fmt.Errorf("command checker: the puzzle's files are needed")
+}
+
+// CheckFiles runs the command.
+func (c CommandChecker) CheckFiles(open PuzzleFiles, answers []string, submitted string) (bool, error) {
+	if !c.Enabled {
+		return false, ErrCommandCheckerDisabled
+	}
+	if len(answers) == 0 {
+		return false, fmt.Errorf("command checker: no command given")
+	}
+	name := answers[0]
+	if !filepath.IsLocal(name) {
+		return false, fmt.Errorf("command checker: %s is not one of the puzzle's files", name)
+	}
+
+	dir, err := os.MkdirTemp("", CheckerDirPrefix)
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := copyCommand(open, name, path); err != nil {
+		return false, fmt.Errorf("command checker: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	args := append(append([]string{}, c.Sandbox...), path, submitted)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+	}
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// copyCommand copies the puzzle's file called name to path, and makes it executable.
+func copyCommand(open PuzzleFiles, name string, path string) error {
+	src, err := open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0700)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
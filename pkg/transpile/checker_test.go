@@ -0,0 +1,106 @@
+package transpile
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnswerCheckers(t *testing.T) {
+	cases := []struct {
+		checker   string
+		answers   []string
+		submitted string
+		correct   bool
+	}{
+		{"", []string{"moo"}, "moo", true},
+		{"", []string{"moo"}, "Moo", false},
+		{"exact", []string{"moo", "mrr"}, "mrr", true},
+		{"regex", []string{"m[o0]+"}, "m0o0", true},
+		{"regex", []string{"m[o0]+"}, "xmoo", false},
+		{"regex", []string{"moo|mrr"}, "moomrr", false},
+		{"numeric", []string{"42"}, " 42.0 ", true},
+		{"numeric", []string{"42"}, "42.1", false},
+		{"numeric", []string{"3.14 ± 0.01"}, "3.145", true},
+		{"numeric", []string{"3.14 +- 0.01"}, "3.2", false},
+		{"numeric", []string{"42"}, "forty-two", false},
+		{"anagram", []string{"Listen"}, "silent", true},
+		{"anagram", []string{"Listen"}, "si lent", true},
+		{"anagram", []string{"Listen"}, "silence", false},
+		{"set", []string{"a, b, c"}, "c,a,b", true},
+		{"set", []string{"a, b, c"}, "a,b", false},
+	}
+
+	for _, c := range cases {
+		correct, err := CheckAnswer(c.checker, c.answers, c.submitted)
+		if err != nil {
+			t.Errorf("%s %v %#v: %s", c.checker, c.answers, c.submitted, err)
+		} else if correct != c.correct {
+			t.Errorf("%s %v %#v: wanted %v, got %v", c.checker, c.answers, c.submitted, c.correct, correct)
+		}
+	}
+
+	if _, err := CheckAnswer("bogus", []string{"moo"}, "moo"); err == nil {
+		t.Error("Unknown checker didn't return an error")
+	}
+	if _, err := CheckAnswer("regex", []string{"("}, "moo"); err == nil {
+		t.Error("Bad regular expression didn't return an error")
+	}
+	if _, err := CheckAnswer("numeric", []string{"moo"}, "1"); err == nil {
+		t.Error("Bad numeric answer didn't return an error")
+	}
+}
+
+func TestRegisterAnswerChecker(t *testing.T) {
+	RegisterAnswerChecker("always", AnswerCheckerFunc(func(answers []string, submitted string) (bool, error) {
+		return true, nil
+	}))
+	if correct, err := CheckAnswer("always", nil, "moo"); err != nil {
+		t.Error(err)
+	} else if !correct {
+		t.Error("Registered checker wasn't used")
+	}
+}
+
+func TestCommandChecker(t *testing.T) {
+	files := map[string]string{
+		"check.sh": "#!/bin/sh\ntest \"$1\" = moo\n",
+	}
+	open := func(filename string) (io.ReadCloser, error) {
+		body, ok := files[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+
+	disabled := CommandChecker{Timeout: 2 * time.Second}
+	if _, err := disabled.CheckFiles(open, []string{"check.sh"}, "moo"); err != ErrCommandCheckerDisabled {
+		t.Error("Disabled checker ran a command:", err)
+	}
+
+	checker := CommandChecker{Enabled: true, Timeout: 2 * time.Second}
+	for submitted, want := range map[string]bool{"moo": true, "oink": false} {
+		if correct, err := checker.CheckFiles(open, []string{"check.sh"}, submitted); err != nil {
+			t.Error(submitted, err)
+		} else if correct != want {
+			t.Errorf("%s: wanted %v, got %v", submitted, want, correct)
+		}
+	}
+	for _, command := range []string{"true", "/bin/true", "../check.sh"} {
+		if _, err := checker.CheckFiles(open, []string{command}, "moo"); err == nil {
+			t.Error("Ran a command that isn't one of the puzzle's files:", command)
+		}
+	}
+	if _, err := checker.Check([]string{"check.sh"}, "moo"); err == nil {
+		t.Error("Ran a command without the puzzle's files")
+	}
+
+	// The sandbox gets the command and the submission
+	sandboxed := CommandChecker{Enabled: true, Timeout: 2 * time.Second, Sandbox: []string{"/bin/sh", "-c", `test "$(basename "$1")" = check.sh`, "sandbox"}}
+	if correct, err := sandboxed.CheckFiles(open, []string{"check.sh"}, "oink"); (err != nil) || !correct {
+		t.Error("Sandbox not given the command:", correct, err)
+	}
+}
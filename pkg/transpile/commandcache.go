@@ -0,0 +1,118 @@
+package transpile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// MaxCommandCacheEntries is how many command outputs are cached at once.
+// When the cache is full, expired outputs are forgotten,
+// or everything, if nothing has expired.
+const MaxCommandCacheEntries = 1000
+
+// commandCache remembers the output of puzzle generator commands,
+// so they don't have to be run again for the same inputs.
+type commandCache struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	entries map[string]commandCacheEntry
+}
+
+type commandCacheEntry struct {
+	out     []byte
+	expires time.Time
+}
+
+var commands = commandCache{
+	entries: make(map[string]commandCacheEntry),
+}
+
+// SetCommandCacheTTL sets how long the output of mkpuzzle and mkcategory is reused.
+// Answers are always checked by running the command.
+//
+// Output is only reused if it's for the same arguments,
+// nothing in the puzzle or category directory has changed,
+// and $SEED is the same.
+// The default, zero, runs the command every time.
+func SetCommandCacheTTL(ttl time.Duration) {
+	commands.lock.Lock()
+	defer commands.lock.Unlock()
+	commands.ttl = ttl
+	if ttl <= 0 {
+		commands.entries = make(map[string]commandCacheEntry)
+	}
+}
+
+// commandCacheKey returns the cache key for running command with args in fs.
+//
+// Files in fs are identified by name, size, mode, and modification time,
+// so their contents don't have to be read every time.
+func commandCacheKey(fs afero.Fs, command string, args []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q\n", command, args, os.Getenv("SEED"))
+	err := afero.Walk(fs, ".", func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%q %d %v %d\n", filename, info.Size(), info.Mode(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// run returns the output of run,
+// which runs command with args in fs,
+// reusing earlier output if it's still good.
+// Output is only cached if run succeeds.
+func (c *commandCache) run(fs afero.Fs, command string, args []string, run func() ([]byte, error)) ([]byte, error) {
+	c.lock.Lock()
+	ttl := c.ttl
+	c.lock.Unlock()
+	if ttl <= 0 {
+		return run()
+	}
+
+	key, err := commandCacheKey(fs, command, args)
+	if err != nil {
+		return run()
+	}
+	now := time.Now()
+	c.lock.Lock()
+	entry, ok := c.entries[key]
+	c.lock.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.out, nil
+	}
+
+	out, err := run()
+	if err != nil {
+		return out, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.entries) >= MaxCommandCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= MaxCommandCacheEntries {
+		c.entries = make(map[string]commandCacheEntry)
+	}
+	c.entries[key] = commandCacheEntry{
+		out:     out,
+		expires: now.Add(ttl),
+	}
+	return out, nil
+}
@@ -0,0 +1,60 @@
+package transpile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestCommandCache(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+	t.Setenv("COUNTER", counter)
+	t.Setenv("SEED", "1")
+	mkpuzzle := "#!/bin/sh\necho $1 >> $COUNTER\necho '{\"Body\": \"'$SEED'\", \"Answers\": [\"a\"]}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "mkpuzzle"), []byte(mkpuzzle), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fs := afero.NewBasePathFs(afero.NewOsFs(), dir)
+	puzzle := NewFsPuzzle(fs)
+	runs := func() int {
+		buf, _ := os.ReadFile(counter)
+		return strings.Count(string(buf), "\n")
+	}
+
+	puzzle.Puzzle()
+	puzzle.Puzzle()
+	if runs() != 2 {
+		t.Error("Output cached without a TTL:", runs())
+	}
+
+	SetCommandCacheTTL(time.Minute)
+	defer SetCommandCacheTTL(0)
+	puzzle.Puzzle()
+	if p, err := puzzle.Puzzle(); err != nil {
+		t.Fatal(err)
+	} else if p.Body != "1" {
+		t.Error("Wrong cached puzzle:", p.Body)
+	}
+	if runs() != 3 {
+		t.Error("Output not cached:", runs())
+	}
+	puzzle.Open("moo.txt")
+	if runs() != 4 {
+		t.Error("Output cached for different arguments:", runs())
+	}
+
+	t.Setenv("SEED", "2")
+	if p, _ := puzzle.Puzzle(); p.Body != "2" {
+		t.Error("Output cached for a different seed:", p.Body)
+	}
+	afero.WriteFile(fs, "new.txt", []byte("new"), 0644)
+	puzzle.Puzzle()
+	if runs() != 6 {
+		t.Error("Output cached after the directory changed:", runs())
+	}
+}
@@ -0,0 +1,246 @@
+package transpile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/spf13/afero"
+	"golang.org/x/net/html"
+)
+
+// LinkCheckReuse is how long the result of checking a link is reused.
+const LinkCheckReuse = 10 * time.Minute
+
+// Dictionary is a set of correctly-spelled words, in lower case.
+type Dictionary map[string]bool
+
+// Read adds every word in r, one per line, to d.
+// Lines starting with # are ignored.
+func (d Dictionary) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if (word == "") || strings.HasPrefix(word, "#") {
+			continue
+		}
+		d[strings.ToLower(word)] = true
+	}
+	return scanner.Err()
+}
+
+// LoadDictionary returns a Dictionary with every word in filenames.
+func LoadDictionary(fs afero.Fs, filenames ...string) (Dictionary, error) {
+	d := make(Dictionary)
+	for _, filename := range filenames {
+		f, err := fs.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		err = d.Read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return d, nil
+}
+
+// Misspelled returns each word in text that isn't in d, once.
+//
+// Words with digits, or capitals after the first letter,
+// are assumed to be names, acronyms, or code, and aren't checked.
+func (d Dictionary) Misspelled(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && (r != '\'') && (r != '’')
+	})
+
+	seen := make(map[string]bool)
+	misspelled := []string{}
+	for _, word := range words {
+		word = strings.Trim(word, "'’")
+		if (len(word) < 2) || seen[word] || !spellcheckable(word) {
+			continue
+		}
+		seen[word] = true
+		lower := strings.ToLower(word)
+		if d[lower] || d[strings.TrimSuffix(strings.TrimSuffix(lower, "'s"), "’s")] {
+			continue
+		}
+		misspelled = append(misspelled, word)
+	}
+	return misspelled
+}
+
+// spellcheckable returns false for words that are probably names, acronyms, or code.
+func spellcheckable(word string) bool {
+	for i, r := range word {
+		if unicode.IsDigit(r) || ((i > 0) && unicode.IsUpper(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// LinkChecker checks that links to other web sites work.
+type LinkChecker struct {
+	Client *http.Client
+
+	lock    sync.Mutex
+	results map[string]linkCheckResult
+}
+
+type linkCheckResult struct {
+	problem string
+	expires time.Time
+}
+
+// NewLinkChecker returns a LinkChecker which waits up to timeout for each link.
+func NewLinkChecker(timeout time.Duration) *LinkChecker {
+	return &LinkChecker{
+		Client:  &http.Client{Timeout: timeout},
+		results: make(map[string]linkCheckResult),
+	}
+}
+
+// Check returns what's wrong with link, or the empty string if it works.
+// Results are reused for LinkCheckReuse.
+func (lc *LinkChecker) Check(link string) string {
+	now := time.Now()
+	lc.lock.Lock()
+	result, ok := lc.results[link]
+	lc.lock.Unlock()
+	if ok && now.Before(result.expires) {
+		return result.problem
+	}
+
+	problem := lc.check(link)
+	lc.lock.Lock()
+	lc.results[link] = linkCheckResult{problem, now.Add(LinkCheckReuse)}
+	lc.lock.Unlock()
+	return problem
+}
+
+func (lc *LinkChecker) check(link string) string {
+	resp, err := lc.Client.Head(link)
+	if err == nil && ((resp.StatusCode == http.StatusMethodNotAllowed) || (resp.StatusCode == http.StatusNotImplemented)) {
+		// Some servers only do GET
+		resp.Body.Close()
+		resp, err = lc.Client.Get(link)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
+
+var contentChecks struct {
+	lock       sync.RWMutex
+	dictionary Dictionary
+	links      *LinkChecker
+}
+
+// SetSpellcheck checks the spelling of every puzzle body against dictionary,
+// listing unknown words in Debug.Log.
+// A nil dictionary turns spellchecking off, which is the default.
+func SetSpellcheck(dictionary Dictionary) {
+	contentChecks.lock.Lock()
+	defer contentChecks.lock.Unlock()
+	contentChecks.dictionary = dictionary
+}
+
+// SetLinkCheck checks every http and https link in puzzle bodies with checker,
+// listing broken ones in Debug.Errors.
+// A nil checker turns link checking off, which is the default.
+func SetLinkCheck(checker *LinkChecker) {
+	contentChecks.lock.Lock()
+	defer contentChecks.lock.Unlock()
+	contentChecks.links = checker
+}
+
+// checkContent lists accessibility problems in puzzle's body,
+// and spellchecks it and checks its links, if either has been turned on.
+func (puzzle *Puzzle) checkContent() {
+	if problems := accessibilityProblems(puzzle.Body); len(problems) > 0 {
+		puzzle.Debug.Accessibility = append(puzzle.Debug.Accessibility, problems...)
+	}
+
+	contentChecks.lock.RLock()
+	dictionary := contentChecks.dictionary
+	links := contentChecks.links
+	contentChecks.lock.RUnlock()
+	if (dictionary == nil) && (links == nil) {
+		return
+	}
+
+	text, hrefs := htmlTextAndLinks(puzzle.Body)
+	if dictionary != nil {
+		if misspelled := dictionary.Misspelled(text); len(misspelled) > 0 {
+			puzzle.Debug.Log = append(puzzle.Debug.Log, "Possible misspellings: "+strings.Join(misspelled, ", "))
+		}
+	}
+	if links != nil {
+		for _, href := range hrefs {
+			if u, err := url.Parse(href); err != nil || ((u.Scheme != "http") && (u.Scheme != "https")) {
+				continue
+			}
+			if problem := links.Check(href); problem != "" {
+				puzzle.Debug.Errors = append(puzzle.Debug.Errors, fmt.Sprintf("Broken link: %s: %s", href, problem))
+			}
+		}
+	}
+}
+
+// htmlTextAndLinks returns the text in an HTML document,
+// leaving out code and scripts,
+// and every link and image source in it.
+func htmlTextAndLinks(doc string) (string, []string) {
+	text := new(strings.Builder)
+	links := []string{}
+	seen := make(map[string]bool)
+	skip := 0
+
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return text.String(), links
+		case html.TextToken:
+			if skip == 0 {
+				text.Write(z.Text())
+				text.WriteString(" ")
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "code", "pre", "script", "style", "kbd", "samp":
+				if tt == html.StartTagToken {
+					skip++
+				} else if (tt == html.EndTagToken) && (skip > 0) {
+					skip--
+				}
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if k := string(key); (k == "href") || (k == "src") {
+					if link := string(val); !seen[link] {
+						seen[link] = true
+						links = append(links, link)
+					}
+				}
+			}
+		}
+	}
+}
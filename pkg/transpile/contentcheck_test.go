@@ -0,0 +1,70 @@
+package transpile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestDictionary(t *testing.T) {
+	d := make(Dictionary)
+	if err := d.Read(strings.NewReader("# words\nthe\ncow\nSays\nmoo\n")); err != nil {
+		t.Fatal(err)
+	}
+	misspelled := d.Misspelled("The cow's sayz moo, teh cow says MOO in HTTPS, 2nd time: sayz")
+	if !reflect.DeepEqual(misspelled, []string{"sayz", "teh", "in", "time"}) {
+		t.Error("Wrong misspellings", misspelled)
+	}
+}
+
+func TestHTMLTextAndLinks(t *testing.T) {
+	text, links := htmlTextAndLinks(`<p>Read <a href="https://example.com/">this</a>:</p>
+<pre>sudo apt</pre><img src="cow.png"><a href="https://example.com/">again</a>`)
+	if strings.Fields(text)[1] != "this" || strings.Contains(text, "sudo") {
+		t.Errorf("Wrong text: %q", text)
+	}
+	if !reflect.DeepEqual(links, []string{"https://example.com/", "cow.png"}) {
+		t.Error("Wrong links", links)
+	}
+}
+
+func TestCheckContent(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/good" {
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+
+	dictionary := Dictionary{"have": true, "a": true, "look": true, "at": true, "this": true, "and": true}
+	SetSpellcheck(dictionary)
+	SetLinkCheck(NewLinkChecker(time.Second))
+	defer SetSpellcheck(nil)
+	defer SetLinkCheck(nil)
+
+	fs := afero.NewMemMapFs()
+	body := "---\nanswers:\n  - moo\n---\nHave a lok at [this](" + server.URL + "/good) and [tihs](" + server.URL + "/bad).\n"
+	afero.WriteFile(fs, "puzzle.md", []byte(body), 0644)
+	for i := 0; i < 2; i++ {
+		p, err := NewFsPuzzle(fs).Puzzle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.Debug.Log, []string{"Possible misspellings: lok, tihs"}) {
+			t.Error("Wrong debug log", p.Debug.Log)
+		}
+		if (len(p.Debug.Errors) != 1) || !strings.Contains(p.Debug.Errors[0], "/bad: 404 Not Found") {
+			t.Error("Wrong debug errors", p.Debug.Errors)
+		}
+	}
+	if requests != 2 {
+		t.Error("Links weren't checked just once each:", requests)
+	}
+}
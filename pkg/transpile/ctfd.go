@@ -0,0 +1,410 @@
+package transpile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// ctfdChallenge is a row of db/challenges.json in a CTFd export.
+type ctfdChallenge struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	ConnectionInfo string `json:"connection_info"`
+	Category       string `json:"category"`
+	Value          int    `json:"value"`
+	Type           string `json:"type"`
+	State          string `json:"state"`
+}
+
+// ctfdFlag is a row of db/flags.json in a CTFd export.
+type ctfdFlag struct {
+	ChallengeID int    `json:"challenge_id"`
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+	Data        string `json:"data"`
+}
+
+// ctfdFile is a row of db/files.json in a CTFd export.
+// Location is relative to uploads/.
+type ctfdFile struct {
+	ChallengeID int    `json:"challenge_id"`
+	Type        string `json:"type"`
+	Location    string `json:"location"`
+}
+
+// ctfdHint is a row of db/hints.json in a CTFd export.
+type ctfdHint struct {
+	ChallengeID int    `json:"challenge_id"`
+	Content     string `json:"content"`
+	Cost        int    `json:"cost"`
+}
+
+// ctfdTag is a row of db/tags.json in a CTFd export.
+type ctfdTag struct {
+	ChallengeID int    `json:"challenge_id"`
+	Value       string `json:"value"`
+}
+
+// ctfdPuzzleHeader is the YAML header of a puzzle.md written by ImportCTFd.
+type ctfdPuzzleHeader struct {
+	Tags        []string `yaml:",omitempty"`
+	Attachments []string `yaml:",omitempty"`
+	Answers     []string
+	Checker     string `yaml:",omitempty"`
+	Debug       struct {
+		Summary string
+		Hints   []string `yaml:",omitempty"`
+	}
+}
+
+// ctfdUnsafe matches runs of characters that don't belong in a category name
+var ctfdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// readCTFdTable reads the table called name from the db directory of a CTFd export into rows.
+// Newer exports wrap the rows in an object with "results";
+// older ones are just a list.
+func readCTFdTable(export afero.Fs, name string, rows any) error {
+	filename := path.Join("db", name+".json")
+	buf, err := afero.ReadFile(export, filename)
+	if err != nil {
+		return err
+	}
+	var wrapped struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(buf, &wrapped); err == nil && wrapped.Results != nil {
+		buf = wrapped.Results
+	}
+	if err := json.Unmarshal(buf, rows); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// ImportCTFd converts the CTFd export in export,
+// which is the export zip file's contents,
+// to a puzzle tree in dst:
+// one directory per category, and in it, one puzzle.md per challenge.
+//
+// Challenges are numbered by their value.
+// A challenge worth the same as another in its category is moved up a point.
+// Static flags become answers.
+// Case-insensitive and regex flags make the puzzle use the regex checker.
+// Hints become debug hints, and the challenge name the debug summary.
+// Tags are kept, lower case, and split at any commas.
+// Anything that can't be carried over is logged as a warning.
+func ImportCTFd(export afero.Fs, dst afero.Fs) error {
+	var challenges []ctfdChallenge
+	var flags []ctfdFlag
+	var files []ctfdFile
+	var hints []ctfdHint
+	var tags []ctfdTag
+	if err := readCTFdTable(export, "challenges", &challenges); err != nil {
+		return err
+	}
+	if err := readCTFdTable(export, "flags", &flags); err != nil {
+		return err
+	}
+	// Exports without files, hints, or tags leave these out
+	readCTFdTable(export, "files", &files)
+	readCTFdTable(export, "hints", &hints)
+	readCTFdTable(export, "tags", &tags)
+
+	sort.Slice(challenges, func(i, j int) bool { return challenges[i].ID < challenges[j].ID })
+	used := make(map[string]map[int]bool)
+	for _, ch := range challenges {
+		category := strings.Trim(ctfdUnsafe.ReplaceAllString(ch.Category, "-"), "-")
+		if category == "" {
+			category = "uncategorized"
+		}
+		if used[category] == nil {
+			used[category] = make(map[int]bool)
+		}
+		points := max(ch.Value, 1)
+		for used[category][points] {
+			points++
+		}
+		used[category][points] = true
+		if points != ch.Value {
+			slog.Warn("moved challenge to another point value", "challenge", ch.Name, "category", category, "value", ch.Value, "points", points)
+		}
+		if ch.Type == "dynamic" {
+			slog.Warn("dynamic challenge imported with its current value", "challenge", ch.Name, "points", points)
+		}
+		if ch.State == "hidden" {
+			slog.Warn("hidden challenge imported", "challenge", ch.Name)
+		}
+
+		puzzleDir := path.Join(category, strconv.Itoa(points))
+		if err := dst.MkdirAll(puzzleDir, 0755); err != nil {
+			return err
+		}
+
+		header := ctfdPuzzleHeader{}
+		header.Debug.Summary = ch.Name
+
+		// Flags
+		regex := false
+		for _, flag := range flags {
+			if flag.ChallengeID != ch.ID {
+				continue
+			}
+			switch flag.Type {
+			case "static":
+				if flag.Data == "case_insensitive" {
+					regex = true
+				}
+			case "regex":
+				regex = true
+			default:
+				slog.Warn("unknown flag type", "challenge", ch.Name, "type", flag.Type)
+			}
+		}
+		for _, flag := range flags {
+			if flag.ChallengeID != ch.ID {
+				continue
+			}
+			answer := flag.Content
+			if regex && (flag.Type == "static") {
+				answer = regexp.QuoteMeta(answer)
+			}
+			if regex && (flag.Data == "case_insensitive") {
+				answer = "(?i)" + answer
+			}
+			if regex {
+				if _, err := regexp.Compile(answer); err != nil {
+					slog.Warn("flag isn't a Go regular expression", "challenge", ch.Name, "flag", flag.Content, "error", err)
+				}
+			}
+			header.Answers = append(header.Answers, answer)
+		}
+		if regex {
+			header.Checker = "regex"
+		}
+		if len(header.Answers) == 0 {
+			slog.Warn("challenge has no flags", "challenge", ch.Name)
+		}
+
+		// Files
+		for _, file := range files {
+			if file.ChallengeID != ch.ID {
+				continue
+			}
+			filename := path.Base(file.Location)
+			if err := ctfdCopy(export, path.Join("uploads", file.Location), dst, path.Join(puzzleDir, filename)); err != nil {
+				return fmt.Errorf("%s: %w", ch.Name, err)
+			}
+			header.Attachments = append(header.Attachments, filename)
+		}
+
+		// Hints
+		for _, hint := range hints {
+			if hint.ChallengeID != ch.ID {
+				continue
+			}
+			if hint.Cost > 0 {
+				slog.Warn("hint cost dropped", "challenge", ch.Name, "cost", hint.Cost)
+			}
+			header.Debug.Hints = append(header.Debug.Hints, hint.Content)
+		}
+
+		// Tags
+		for _, tag := range tags {
+			if tag.ChallengeID != ch.ID {
+				continue
+			}
+			for _, value := range strings.Split(tag.Value, ",") {
+				if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+					header.Tags = append(header.Tags, value)
+				}
+			}
+		}
+
+		headerBuf, err := yaml.Marshal(header)
+		if err != nil {
+			return err
+		}
+		body := strings.TrimSpace(strings.ReplaceAll(ch.Description, "\r\n", "\n"))
+		if ch.ConnectionInfo != "" {
+			body += "\n\nConnect to: `" + ch.ConnectionInfo + "`"
+		}
+		puzzleMd := "---\n" + string(headerBuf) + "---\n" + body + "\n"
+		if err := afero.WriteFile(dst, path.Join(puzzleDir, "puzzle.md"), []byte(puzzleMd), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ctfdCopy copies the file called src in srcFs to dst in dstFs.
+func ctfdCopy(srcFs afero.Fs, src string, dstFs afero.Fs, dst string) error {
+	in, err := srcFs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileFrom(dstFs, dst, in)
+}
+
+// writeFileFrom writes everything in r to the file called filename in fs.
+func writeFileFrom(fs afero.Fs, filename string, r io.Reader) error {
+	out, err := fs.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ctfdChallengeYAML is a challenge.yml written by ExportCTFd,
+// as ctfcli reads it.
+type ctfdChallengeYAML struct {
+	Name        string         `yaml:"name"`
+	Author      string         `yaml:"author,omitempty"`
+	Category    string         `yaml:"category"`
+	Description string         `yaml:"description"`
+	Value       int            `yaml:"value"`
+	Type        string         `yaml:"type"`
+	Flags       []ctfdFlagYAML `yaml:"flags"`
+	Hints       []string       `yaml:"hints,omitempty"`
+	Tags        []string       `yaml:"tags,omitempty"`
+	Files       []string       `yaml:"files,omitempty"`
+	State       string         `yaml:"state"`
+	Version     string         `yaml:"version"`
+}
+
+// ctfdFlagYAML is a flag in a challenge.yml.
+type ctfdFlagYAML struct {
+	Type    string `yaml:"type"`
+	Content string `yaml:"content"`
+	Data    string `yaml:"data,omitempty"`
+}
+
+// exportName returns the name to give a puzzle on another platform:
+// its debug summary, or if it doesn't have one, its category and points.
+func exportName(p Puzzle, category string, points int) string {
+	if p.Debug.Summary != "" {
+		return p.Debug.Summary
+	}
+	return fmt.Sprintf("%s %d", category, points)
+}
+
+// exportWarn warns about the parts of a puzzle other platforms don't have.
+func exportWarn(p Puzzle, name string) {
+	if len(p.Parts)+len(p.Tiers)+len(p.Questions) > 0 {
+		slog.Warn("parts, tiers, and quiz questions dropped", "puzzle", name)
+	}
+	if len(p.Scripts) > 0 {
+		slog.Warn("scripts dropped", "puzzle", name)
+	}
+	if len(p.Answers) == 0 {
+		slog.Warn("puzzle has no answers", "puzzle", name)
+	}
+}
+
+// ctfdFlags returns a puzzle's answers as CTFd flags.
+// Answers checked by anything but the exact or regex checkers
+// can't be checked the same way by CTFd, and become static flags.
+func ctfdFlags(p Puzzle, name string) []ctfdFlagYAML {
+	flags := []ctfdFlagYAML{}
+	for _, answer := range p.Answers {
+		switch p.Checker {
+		case "", "exact":
+			flags = append(flags, ctfdFlagYAML{Type: "static", Content: answer})
+		case "regex":
+			if pattern, ok := strings.CutPrefix(answer, "(?i)"); ok {
+				flags = append(flags, ctfdFlagYAML{Type: "regex", Content: pattern, Data: "case_insensitive"})
+			} else {
+				flags = append(flags, ctfdFlagYAML{Type: "regex", Content: answer})
+			}
+		default:
+			flags = append(flags, ctfdFlagYAML{Type: "static", Content: answer})
+		}
+	}
+	if (p.Checker != "") && (p.Checker != "exact") && (p.Checker != "regex") {
+		slog.Warn("answers exported as exact matches", "puzzle", name, "checker", p.Checker)
+	}
+	return flags
+}
+
+// ExportCTFd writes every puzzle in c, the category called category,
+// to dst as a challenge ctfcli can install:
+// category/POINTS/challenge.yml, with attachments in category/POINTS/dist.
+//
+// The challenge's description is the puzzle's rendered body,
+// its name is its debug summary,
+// its hints are its debug hints,
+// and its tags are its tags.
+// Anything that can't be carried over is logged as a warning.
+func ExportCTFd(c Category, category string, dst afero.Fs) error {
+	inv, err := c.Inventory()
+	if err != nil {
+		return err
+	}
+	for _, points := range inv {
+		p, err := c.Puzzle(points)
+		if err != nil {
+			return fmt.Errorf("%s %d: %w", category, points, err)
+		}
+		name := exportName(p, category, points)
+		exportWarn(p, name)
+
+		challenge := ctfdChallengeYAML{
+			Name:        name,
+			Author:      strings.Join(p.Authors, ", "),
+			Category:    category,
+			Description: p.Body,
+			Value:       points,
+			Type:        "standard",
+			Flags:       ctfdFlags(p, name),
+			Hints:       p.Debug.Hints,
+			Tags:        p.Tags,
+			State:       "visible",
+			Version:     "0.1",
+		}
+
+		challengeDir := path.Join(category, strconv.Itoa(points))
+		if err := dst.MkdirAll(path.Join(challengeDir, "dist"), 0755); err != nil {
+			return err
+		}
+		for _, filename := range p.Attachments {
+			if err := exportCopy(c, points, filename, dst, path.Join(challengeDir, "dist", filename)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			challenge.Files = append(challenge.Files, path.Join("dist", filename))
+		}
+
+		buf, err := yaml.Marshal(challenge)
+		if err != nil {
+			return err
+		}
+		if err := afero.WriteFile(dst, path.Join(challengeDir, "challenge.yml"), buf, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportCopy copies the file called filename, in the puzzle worth points, to dst in dstFs.
+func exportCopy(c Category, points int, filename string, dstFs afero.Fs, dst string) error {
+	in, err := c.Open(points, filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileFrom(dstFs, dst, in)
+}
@@ -0,0 +1,134 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// newCTFdExport returns a CTFd export with three challenges,
+// two of which are worth the same in the same category.
+func newCTFdExport() afero.Fs {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "db/challenges.json", []byte(`{"count": 3, "results": [
+		{"id": 1, "name": "Warmup", "description": "Find the flag in **flag.txt**.", "category": "Intro Stuff", "value": 100, "type": "standard", "state": "visible"},
+		{"id": 2, "name": "Shout", "description": "What do cows say?", "connection_info": "nc cows 1337", "category": "Intro Stuff", "value": 100, "type": "standard", "state": "visible"},
+		{"id": 3, "name": "Pattern", "description": "Any number", "category": "misc", "value": 50, "type": "dynamic", "state": "hidden"}
+	], "meta": {}}`), 0644)
+	afero.WriteFile(fs, "db/flags.json", []byte(`{"count": 4, "results": [
+		{"id": 1, "challenge_id": 1, "type": "static", "content": "flag{warm}", "data": ""},
+		{"id": 2, "challenge_id": 2, "type": "static", "content": "moo.", "data": "case_insensitive"},
+		{"id": 3, "challenge_id": 2, "type": "regex", "content": "m+o+", "data": ""},
+		{"id": 4, "challenge_id": 3, "type": "regex", "content": "[0-9]+", "data": ""}
+	], "meta": {}}`), 0644)
+	afero.WriteFile(fs, "db/files.json", []byte(`[
+		{"id": 1, "type": "challenge", "location": "0123abcd/flag.txt", "challenge_id": 1}
+	]`), 0644)
+	afero.WriteFile(fs, "db/hints.json", []byte(`{"results": [
+		{"id": 1, "challenge_id": 1, "content": "Open it", "cost": 10}
+	]}`), 0644)
+	afero.WriteFile(fs, "db/tags.json", []byte(`{"results": [
+		{"id": 1, "challenge_id": 1, "value": "Beginner"},
+		{"id": 2, "challenge_id": 1, "value": "files, forensics"}
+	]}`), 0644)
+	afero.WriteFile(fs, "uploads/0123abcd/flag.txt", []byte("flag{warm}"), 0644)
+	return fs
+}
+
+func TestImportCTFd(t *testing.T) {
+	dst := afero.NewMemMapFs()
+	if err := ImportCTFd(newCTFdExport(), dst); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewFsCategory(dst, "Intro-Stuff")
+	if inv, err := c.Inventory(); err != nil {
+		t.Fatal(err)
+	} else if (len(inv) != 2) || (inv[0] != 100) || (inv[1] != 101) {
+		t.Error("Wrong inventory:", inv)
+	}
+
+	p, err := c.Puzzle(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Answers) != 1) || (p.Answers[0] != "flag{warm}") || (p.Checker != "") {
+		t.Error("Wrong answers:", p.Answers, p.Checker)
+	}
+	if (len(p.Attachments) != 1) || (p.Attachments[0] != "flag.txt") {
+		t.Error("Wrong attachments:", p.Attachments)
+	}
+	if (p.Debug.Summary != "Warmup") || (len(p.Debug.Hints) != 1) {
+		t.Error("Wrong debug:", p.Debug)
+	}
+	if (len(p.Tags) != 3) || (p.Tags[0] != "beginner") || (p.Tags[2] != "forensics") {
+		t.Error("Wrong tags:", p.Tags)
+	}
+	if p.Body != "<p>Find the flag in <strong>flag.txt</strong>.</p>\n" {
+		t.Errorf("Wrong body: %q", p.Body)
+	}
+	if buf, err := afero.ReadFile(dst, "Intro-Stuff/100/flag.txt"); err != nil {
+		t.Error(err)
+	} else if string(buf) != "flag{warm}" {
+		t.Error("Wrong attachment:", string(buf))
+	}
+
+	p, err = c.Puzzle(101)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Checker != "regex" {
+		t.Error("Wrong checker:", p.Checker)
+	}
+	for answer, correct := range map[string]bool{"MOO.": true, "moox": false, "mmmooo": true, "MOOO": false} {
+		if ok, _ := CheckAnswer(p.Checker, p.Answers, answer); ok != correct {
+			t.Errorf("%q: correct is %v, want %v", answer, ok, correct)
+		}
+	}
+
+	if _, err := NewFsCategory(dst, "misc").Puzzle(50); err != nil {
+		t.Error(err)
+	}
+
+	if err := ImportCTFd(afero.NewMemMapFs(), dst); err == nil {
+		t.Error("Imported an empty export")
+	}
+}
+
+func TestExportCTFd(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - moo\n  - (?i)m+o+\nchecker: regex\nauthors:\n  - Arthur\nattachments:\n  - cow.txt\ntags: [cows]\ndebug:\n  summary: Cows\n  hints:\n    - Say it\n---\nWhat do *cows* say?\n"), 0644)
+	afero.WriteFile(fs, "cat/1/cow.txt", []byte("moo"), 0644)
+
+	dst := afero.NewMemMapFs()
+	if err := ExportCTFd(NewFsCategory(fs, "cat"), "cat", dst); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := afero.ReadFile(dst, "cat/1/challenge.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := ctfdChallengeYAML{}
+	if err := yaml.UnmarshalStrict(buf, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	if (challenge.Name != "Cows") || (challenge.Author != "Arthur") || (challenge.Value != 1) {
+		t.Error("Wrong challenge:", challenge)
+	}
+	if challenge.Description != "<p>What do <em>cows</em> say?</p>\n" {
+		t.Errorf("Wrong description: %q", challenge.Description)
+	}
+	if (len(challenge.Flags) != 2) || (challenge.Flags[1] != ctfdFlagYAML{Type: "regex", Content: "m+o+", Data: "case_insensitive"}) {
+		t.Error("Wrong flags:", challenge.Flags)
+	}
+	if (len(challenge.Tags) != 1) || (challenge.Tags[0] != "cows") {
+		t.Error("Wrong tags:", challenge.Tags)
+	}
+	if (len(challenge.Files) != 1) || (challenge.Files[0] != "dist/cow.txt") {
+		t.Error("Wrong files:", challenge.Files)
+	}
+	if _, err := dst.Stat("cat/1/dist/cow.txt"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,15 @@
+package transpile
+
+import "fmt"
+
+// MaxDifficulty is the hardest a puzzle can say it is.
+// Difficulty goes from 1, for a first puzzle, to MaxDifficulty, for experts.
+const MaxDifficulty = 5
+
+// validateDifficulty makes sure the difficulty, if any, is between 1 and MaxDifficulty.
+func (puzzle *Puzzle) validateDifficulty() error {
+	if (puzzle.Difficulty < 0) || (puzzle.Difficulty > MaxDifficulty) {
+		return fmt.Errorf("difficulty must be between 1 and %d", MaxDifficulty)
+	}
+	return nil
+}
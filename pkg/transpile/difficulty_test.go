@@ -0,0 +1,30 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleDifficulty(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers: [a]\ndifficulty: 2\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("answer: a\ndifficulty: 5\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/3/puzzle.md", []byte("answer: a\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/4/puzzle.md", []byte("---\nanswers: [a]\ndifficulty: 6\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/5/puzzle.md", []byte("answer: a\ndifficulty: hard\n\nHi.\n"), 0644)
+
+	c := NewFsCategory(fs, "cat")
+	for points, difficulty := range map[int]int{1: 2, 2: 5, 3: 0} {
+		if p, err := c.Puzzle(points); err != nil {
+			t.Error(points, err)
+		} else if p.Difficulty != difficulty {
+			t.Error(points, "wrong difficulty:", p.Difficulty)
+		}
+	}
+	for _, points := range []int{4, 5} {
+		if _, err := c.Puzzle(points); err == nil {
+			t.Error(points, "bad difficulty accepted")
+		}
+	}
+}
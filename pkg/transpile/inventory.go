@@ -1,7 +1,7 @@
 package transpile
 
 import (
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
 
@@ -15,7 +15,7 @@ type Inventory map[string][]int
 func FsInventory(fs afero.Fs) (Inventory, error) {
 	dirEnts, err := afero.ReadDir(fs, "")
 	if err != nil {
-		log.Print(err)
+		slog.Error("reading categories", "error", err)
 		return nil, err
 	}
 
@@ -29,7 +29,7 @@ func FsInventory(fs afero.Fs) (Inventory, error) {
 			c := NewFsCategory(fs, name)
 			puzzles, err := c.Inventory()
 			if err != nil {
-				log.Printf("Inventory: %s: %s", name, err)
+				slog.Warn("reading category inventory", "category", name, "error", err)
 				continue
 			}
 			sort.Ints(puzzles)
@@ -0,0 +1,42 @@
+package transpile
+
+import (
+	"fmt"
+)
+
+// Lab triggers: when a team's lab is provisioned.
+const (
+	LabOnOpen  = "open"
+	LabOnSolve = "solve"
+)
+
+// PuzzleLab asks for a disposable environment for each team,
+// like a container or virtual machine,
+// from an orchestrator outside MOTH.
+type PuzzleLab struct {
+	// Template names what to provision.
+	// It's passed to the orchestrator unchanged.
+	Template string
+
+	// Trigger is when a team's lab is provisioned:
+	// LabOnOpen, when the team first loads the puzzle (the default),
+	// or LabOnSolve, when it solves it.
+	Trigger string `json:",omitempty"`
+}
+
+// validateLab makes sure a puzzle's lab has a template and a known trigger.
+func (puzzle *Puzzle) validateLab() error {
+	l := puzzle.Lab
+	if l == nil {
+		return nil
+	}
+	if l.Template == "" {
+		return fmt.Errorf("lab needs a template")
+	}
+	switch l.Trigger {
+	case "", LabOnOpen, LabOnSolve:
+	default:
+		return fmt.Errorf("lab trigger must be %s or %s", LabOnOpen, LabOnSolve)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleLab(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\nlab:\n  template: webserver\n  trigger: solve\n---\nBreak in.\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("lab: webserver\n\nBreak in.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nlab:\n  trigger: open\n---\nNo template.\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("---\nlab:\n  template: webserver\n  trigger: whenever\n---\nBad trigger.\n"), 0644)
+
+	puzzle, err := NewFsPuzzlePoints(fs, 1).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Lab == nil) || (*puzzle.Lab != PuzzleLab{Template: "webserver", Trigger: LabOnSolve}) {
+		t.Error("Wrong lab:", puzzle.Lab)
+	}
+	puzzle, err = NewFsPuzzlePoints(fs, 2).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Lab == nil) || (puzzle.Lab.Template != "webserver") {
+		t.Error("Wrong lab:", puzzle.Lab)
+	}
+	if _, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err == nil {
+		t.Error("Lab without a template accepted")
+	}
+	if _, err := NewFsPuzzlePoints(fs, 4).Puzzle(); err == nil {
+		t.Error("Lab with a bad trigger accepted")
+	}
+}
@@ -0,0 +1,191 @@
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ShortAnswerLength is the length answers should be, at least.
+// Shorter answers are easy to guess,
+// and aren't looked for in attachments, since they'd turn up everywhere.
+const ShortAnswerLength = 4
+
+// MaxLintAttachmentSize is the most of each attachment searched for answers.
+const MaxLintAttachmentSize = 16 * 1024 * 1024
+
+// LintProblem is a problem Lint found with a category.
+type LintProblem struct {
+	// Points is the point value of the puzzle with the problem
+	Points int
+
+	// Warning is true if the category can still be used as it is
+	Warning bool
+
+	Message string
+}
+
+func (p LintProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("puzzle %d: %s: %s", p.Points, level, p.Message)
+}
+
+// lintAnswer is an answer a participant might submit.
+type lintAnswer struct {
+	points int
+	answer string
+}
+
+// Lint checks a category for problems between its puzzles:
+// answers accepted by more than one puzzle,
+// answers found in another puzzle's attachments,
+// and answers too short to be hard to guess.
+//
+// Answers to puzzles with the command checker are never checked,
+// since that would run the command for every answer in the category.
+func Lint(c Category) ([]LintProblem, error) {
+	inv, err := c.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(inv)
+
+	puzzles := make(map[int]Puzzle, len(inv))
+	literals := []lintAnswer{}
+	for _, points := range inv {
+		puzzle, err := c.Puzzle(points)
+		if err != nil {
+			return nil, fmt.Errorf("Puzzle %d: %s", points, err)
+		}
+		puzzles[points] = puzzle
+
+		// Regular expressions and commands aren't things anyone types in
+		if (puzzle.Checker == "regex") || (puzzle.Checker == "command") || (puzzle.Checker == UploadChecker) {
+			continue
+		}
+		for _, answers := range puzzleAnswers(puzzle) {
+			for _, answer := range answers {
+				literals = append(literals, lintAnswer{points, answer})
+			}
+		}
+	}
+
+	problems := []LintProblem{}
+
+	for _, points := range inv {
+		puzzle := puzzles[points]
+		if (puzzle.Checker == "command") || (puzzle.Checker == UploadChecker) {
+			// The command is one of the puzzle's files, so it has to be shipped with it
+			if command := puzzle.Answers; (len(command) > 0) && !slices.Contains(puzzle.Attachments, command[0]) && !slices.Contains(puzzle.Scripts, command[0]) {
+				problems = append(problems, LintProblem{
+					Points:  points,
+					Message: fmt.Sprintf("checker command %s is not an attachment", command[0]),
+				})
+			}
+			continue
+		}
+		checker, err := GetAnswerChecker(puzzle.Checker)
+		if err != nil {
+			problems = append(problems, LintProblem{Points: points, Message: err.Error()})
+			continue
+		}
+
+		for _, answers := range puzzleAnswers(puzzle) {
+			if ok, _ := checker.Check(answers, ""); ok {
+				problems = append(problems, LintProblem{
+					Points:  points,
+					Message: "accepts an empty answer",
+				})
+			}
+			for _, lit := range literals {
+				if lit.points == points {
+					continue
+				}
+				if ok, _ := checker.Check(answers, lit.answer); ok {
+					problems = append(problems, LintProblem{
+						Points:  points,
+						Message: fmt.Sprintf("accepts %q, an answer to puzzle %d", lit.answer, lit.points),
+					})
+				}
+			}
+		}
+
+		if (puzzle.Checker == "") || (puzzle.Checker == "exact") {
+			for _, answers := range puzzleAnswers(puzzle) {
+				for _, answer := range answers {
+					if len(strings.TrimSpace(answer)) < ShortAnswerLength {
+						problems = append(problems, LintProblem{
+							Points:  points,
+							Warning: true,
+							Message: fmt.Sprintf("answer %q is short enough to guess", answer),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	for _, points := range inv {
+		for _, attachment := range puzzles[points].Attachments {
+			content, err := lintAttachment(c, points, attachment)
+			if err != nil {
+				return nil, fmt.Errorf("Puzzle %d: %s: %s", points, attachment, err)
+			}
+			for _, lit := range literals {
+				if (lit.points == points) || (len(lit.answer) < ShortAnswerLength) {
+					continue
+				}
+				if bytes.Contains(content, []byte(lit.answer)) {
+					problems = append(problems, LintProblem{
+						Points:  lit.points,
+						Warning: true,
+						Message: fmt.Sprintf("answer %q is in %s, attached to puzzle %d", lit.answer, attachment, points),
+					})
+				}
+			}
+		}
+	}
+
+	// The same answer can be listed more than once
+	seen := make(map[LintProblem]bool, len(problems))
+	unique := problems[:0]
+	for _, problem := range problems {
+		if !seen[problem] {
+			seen[problem] = true
+			unique = append(unique, problem)
+		}
+	}
+	return unique, nil
+}
+
+// puzzleAnswers returns each set of answers in puzzle:
+// the answers, and the answers to each part and tier.
+func puzzleAnswers(puzzle Puzzle) [][]string {
+	sets := [][]string{}
+	if len(puzzle.Answers) > 0 {
+		sets = append(sets, puzzle.Answers)
+	}
+	for _, part := range puzzle.Parts {
+		sets = append(sets, part.Answers)
+	}
+	for _, tier := range puzzle.Tiers {
+		sets = append(sets, tier.Answers)
+	}
+	return sets
+}
+
+// lintAttachment returns the start of an attachment.
+func lintAttachment(c Category, points int, filename string) ([]byte, error) {
+	f, err := c.Open(points, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, MaxLintAttachmentSize))
+}
@@ -0,0 +1,50 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLint(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - tangerine\nattachments:\n  - notes.txt\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/1/notes.txt", []byte("Next time, try pomegranate."), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("---\nanswers:\n  - pomegranate\n  - tangerine\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/3/puzzle.md", []byte("---\nanswers:\n  - \"[a-z]+ine\"\nchecker: regex\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/4/puzzle.md", []byte("---\nanswers:\n  - ox\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/5/puzzle.md", []byte("---\nanswers:\n  - \"x*\"\nchecker: regex\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/6/puzzle.md", []byte("---\nanswers:\n  - check.sh\nchecker: command\n---\nbody\n"), 0644)
+
+	problems, err := Lint(NewFsCategory(fs, "cat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LintProblem{
+		{Points: 1, Message: `accepts "tangerine", an answer to puzzle 2`},
+		{Points: 2, Message: `accepts "tangerine", an answer to puzzle 1`},
+		{Points: 3, Message: `accepts "tangerine", an answer to puzzle 1`},
+		{Points: 3, Message: `accepts "tangerine", an answer to puzzle 2`},
+		{Points: 4, Warning: true, Message: `answer "ox" is short enough to guess`},
+		{Points: 5, Message: "accepts an empty answer"},
+		{Points: 6, Message: "checker command check.sh is not an attachment"},
+		{Points: 2, Warning: true, Message: `answer "pomegranate" is in notes.txt, attached to puzzle 1`},
+	}
+	if len(problems) != len(expected) {
+		t.Fatal("Wrong problems", problems)
+	}
+	for i, problem := range problems {
+		if problem != expected[i] {
+			t.Errorf("Problem %d: wanted %v, got %v", i, expected[i], problem)
+		}
+	}
+
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - tangerine\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("---\nanswers:\n  - pomegranate\n---\nbody\n"), 0644)
+	if problems, err := Lint(NewFsCategory(fs, "cat")); err != nil {
+		t.Error(err)
+	} else if len(problems) != 0 {
+		t.Error("Problems with a good category", problems)
+	}
+}
@@ -0,0 +1,33 @@
+package transpile
+
+import (
+	"fmt"
+)
+
+// TCPListener is a command the server runs for every TCP connection to a port,
+// for "connect and solve" puzzles.
+type TCPListener struct {
+	// Command is run for each connection,
+	// with the connection as its standard input and output.
+	// It must be installed on the server.
+	Command string
+
+	// Port asks for a particular port.
+	// Zero lets the server pick one.
+	Port int `json:",omitempty"`
+}
+
+// validateListener makes sure a puzzle's listener has a command and a usable port.
+func (puzzle *Puzzle) validateListener() error {
+	l := puzzle.Listener
+	if l == nil {
+		return nil
+	}
+	if l.Command == "" {
+		return fmt.Errorf("listener needs a command")
+	}
+	if (l.Port < 0) || (l.Port > 65535) {
+		return fmt.Errorf("listener port must be between 1 and 65535")
+	}
+	return nil
+}
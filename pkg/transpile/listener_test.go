@@ -0,0 +1,32 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleListener(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\nlistener:\n  command: /srv/moth/listeners/maze\n  port: 31337\n---\nConnect.\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("listener: /srv/moth/listeners/maze\n\nConnect.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nlistener:\n  port: 31337\n---\nNo command.\n"), 0644)
+
+	puzzle, err := NewFsPuzzlePoints(fs, 1).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Listener == nil) || (*puzzle.Listener != TCPListener{Command: "/srv/moth/listeners/maze", Port: 31337}) {
+		t.Error("Wrong listener:", puzzle.Listener)
+	}
+	puzzle, err = NewFsPuzzlePoints(fs, 2).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Listener == nil) || (puzzle.Listener.Command != "/srv/moth/listeners/maze") {
+		t.Error("Wrong listener:", puzzle.Listener)
+	}
+	if _, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err == nil {
+		t.Error("Listener without a command accepted")
+	}
+}
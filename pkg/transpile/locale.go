@@ -0,0 +1,37 @@
+package transpile
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// localeRe matches language tags like "es" or "pt-BR".
+var localeRe = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// ValidLocale returns whether locale is a language tag,
+// which can be used in a filename like puzzle.LOCALE.json.
+func ValidLocale(locale string) bool {
+	return localeRe.MatchString(locale)
+}
+
+// listLocales sets Locales to every language in Translations.
+func (puzzle *Puzzle) listLocales() {
+	puzzle.Locales = nil
+	for locale := range puzzle.Translations {
+		puzzle.Locales = append(puzzle.Locales, locale)
+	}
+	sort.Strings(puzzle.Locales)
+}
+
+// Localized returns the puzzle with its body in locale,
+// and whether it has been translated into locale.
+func (puzzle Puzzle) Localized(locale string) (Puzzle, bool) {
+	body, ok := puzzle.Translations[strings.ToLower(locale)]
+	if !ok {
+		return puzzle, false
+	}
+	puzzle.Body = body
+	puzzle.Translations = nil
+	return puzzle, true
+}
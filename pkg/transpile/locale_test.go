@@ -0,0 +1,64 @@
+package transpile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestTranslations(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cows/1/puzzle.md", []byte("---\nanswers:\n  - moo\n---\nWhat do cows say?\n"), 0644)
+	afero.WriteFile(fs, "cows/1/puzzle.es.md", []byte("¿Qué dicen las vacas?\n"), 0644)
+	afero.WriteFile(fs, "cows/1/puzzle.pt-BR.md", []byte("O que as vacas dizem?\n"), 0644)
+	afero.WriteFile(fs, "cows/1/puzzle.backup.md~", []byte("Old\n"), 0644)
+
+	c := NewFsCategory(fs, "cows")
+	p, err := c.Puzzle(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Locales, []string{"es", "pt-br"}) {
+		t.Error("Wrong locales", p.Locales)
+	}
+	if lp, ok := p.Localized("PT-br"); !ok {
+		t.Error("Translation missing")
+	} else if !strings.Contains(lp.Body, "vacas dizem") || (lp.AnswerSalt != p.AnswerSalt) {
+		t.Error("Wrong translation", lp)
+	}
+	if _, ok := p.Localized("fr"); ok {
+		t.Error("Translated into a language with no translation")
+	}
+
+	mb := new(bytes.Buffer)
+	if err := Mothball(c, mb, ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, "cows.mb", mb.Bytes(), 0644)
+	mbc, err := NewMothballCategory(fs, "cows.mb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := mbc.Open(1, "puzzle.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(f)
+	f.Close()
+	if strings.Contains(buf.String(), "vacas") {
+		t.Error("Translations in puzzle.json", buf.String())
+	}
+
+	// Built again from the mothball, translations come along
+	mp, err := mbc.Puzzle(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mp.Translations, p.Translations) {
+		t.Error("Translations lost in mothball", mp.Translations)
+	}
+}
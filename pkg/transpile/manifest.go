@@ -0,0 +1,179 @@
+package transpile
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest lists the categories in an event,
+// which can come from any number of puzzle repositories and mothballs.
+type Manifest struct {
+	Categories []ManifestCategory
+}
+
+// ManifestCategory is a category listed in a Manifest.
+type ManifestCategory struct {
+	// Path is a category directory, or a mothball ending in ".mb".
+	// Relative paths are relative to the manifest.
+	Path string
+
+	// Name is the name of the category in the event.
+	// ReadManifest fills this in from Path if it's empty.
+	Name string
+
+	// Scale multiplies the point value of every puzzle.
+	Scale int
+
+	// Points gives new point values for some puzzles,
+	// by their point value in Path.
+	// These aren't multiplied by Scale.
+	Points map[int]int
+}
+
+// ReadManifest reads the manifest called filename in fs.
+func ReadManifest(fs afero.Fs, filename string) (Manifest, error) {
+	manifest := Manifest{}
+	buf, err := afero.ReadFile(fs, filename)
+	if err != nil {
+		return manifest, err
+	}
+	if err := yaml.UnmarshalStrict(buf, &manifest); err != nil {
+		return manifest, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range manifest.Categories {
+		mc := &manifest.Categories[i]
+		if mc.Path == "" {
+			return manifest, fmt.Errorf("%s: category %d has no path", filename, i+1)
+		}
+		if !filepath.IsAbs(mc.Path) {
+			mc.Path = filepath.Join(filepath.Dir(filename), mc.Path)
+		}
+		if mc.Name == "" {
+			mc.Name = strings.TrimSuffix(path.Base(filepath.ToSlash(mc.Path)), ".mb")
+		}
+		if seen[mc.Name] {
+			return manifest, fmt.Errorf("%s: category %s is listed more than once", filename, mc.Name)
+		}
+		seen[mc.Name] = true
+
+		if mc.Scale < 0 {
+			return manifest, fmt.Errorf("%s: %s: scale must be positive", filename, mc.Name)
+		}
+		for from, to := range mc.Points {
+			if (from <= 0) || (to <= 0) {
+				return manifest, fmt.Errorf("%s: %s: point values must be positive", filename, mc.Name)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// Open returns the Category for mc,
+// with its puzzles' point values changed as the manifest says.
+func (mc ManifestCategory) Open(fs afero.Fs) (Category, error) {
+	if strings.HasSuffix(mc.Path, ".mb") {
+		c, err := NewMothballCategory(fs, mc.Path)
+		if err != nil {
+			return nil, err
+		}
+		return mc.Remap(c), nil
+	}
+	if info, err := fs.Stat(mc.Path); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a category directory or mothball", mc.Path)
+	}
+	return mc.Remap(NewFsCategory(fs, mc.Path)), nil
+}
+
+// Remap returns c with its puzzles' point values changed as the manifest says.
+// If the manifest doesn't change any, c is returned as it is.
+func (mc ManifestCategory) Remap(c Category) Category {
+	if ((mc.Scale == 0) || (mc.Scale == 1)) && (len(mc.Points) == 0) {
+		return c
+	}
+	scale := mc.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return RemappedCategory{c, scale, mc.Points}
+}
+
+// RemappedCategory is a Category with new point values for its puzzles.
+type RemappedCategory struct {
+	Category
+	scale  int
+	points map[int]int
+}
+
+// eventPoints returns the new point value for the puzzle worth points.
+func (rc RemappedCategory) eventPoints(points int) int {
+	if to, ok := rc.points[points]; ok {
+		return to
+	}
+	return points * rc.scale
+}
+
+// sourcePoints returns what the puzzle now worth points was worth before.
+func (rc RemappedCategory) sourcePoints(points int) int {
+	for from, to := range rc.points {
+		if to == points {
+			return from
+		}
+	}
+	if points%rc.scale == 0 {
+		if _, ok := rc.points[points/rc.scale]; !ok {
+			return points / rc.scale
+		}
+	}
+	// Nothing is worth this, so the result needs to miss every puzzle.
+	return 0
+}
+
+// Inventory lists the new point value of every puzzle.
+func (rc RemappedCategory) Inventory() ([]int, error) {
+	inv, err := rc.Category.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int, 0, len(inv))
+	seen := make(map[int]int)
+	for _, points := range inv {
+		to := rc.eventPoints(points)
+		if from, ok := seen[to]; ok {
+			return nil, fmt.Errorf("puzzles %d and %d would both be worth %d", from, points, to)
+		}
+		seen[to] = points
+		ret = append(ret, to)
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
+
+// Puzzle returns the puzzle now worth points.
+func (rc RemappedCategory) Puzzle(points int) (Puzzle, error) {
+	return rc.Category.Puzzle(rc.sourcePoints(points))
+}
+
+// Open returns the file called filename, for the puzzle now worth points.
+func (rc RemappedCategory) Open(points int, filename string) (ReadSeekCloser, error) {
+	return rc.Category.Open(rc.sourcePoints(points), filename)
+}
+
+// Answer returns whether answer is correct for the puzzle now worth points.
+func (rc RemappedCategory) Answer(points int, answer string) bool {
+	return rc.Category.Answer(rc.sourcePoints(points), answer)
+}
+
+// AnswerPart returns the name of the part or tier of the puzzle now worth points solved by answer.
+func (rc RemappedCategory) AnswerPart(points int, answer string) string {
+	return rc.Category.AnswerPart(rc.sourcePoints(points), answer)
+}
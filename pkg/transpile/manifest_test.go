@@ -0,0 +1,153 @@
+package transpile
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestReadManifest(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "event/manifest.yaml", []byte("categories:\n  - path: ../library/cat0\n  - path: /built/forensics.mb\n"), 0644)
+	afero.WriteFile(fs, "event/duplicate.yaml", []byte("categories:\n  - path: cat0\n  - path: other/cat0.mb\n"), 0644)
+	afero.WriteFile(fs, "event/typo.yaml", []byte("categories:\n  - pth: cat0\n"), 0644)
+
+	manifest, err := ReadManifest(fs, "event/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Categories) != 2 {
+		t.Fatal("Wrong categories", manifest.Categories)
+	}
+	if mc := manifest.Categories[0]; (mc.Path != "library/cat0") || (mc.Name != "cat0") {
+		t.Error("Wrong category", mc.Path, mc.Name)
+	}
+	if mc := manifest.Categories[1]; (mc.Path != "/built/forensics.mb") || (mc.Name != "forensics") {
+		t.Error("Wrong category", mc.Path, mc.Name)
+	}
+
+	if _, err := ReadManifest(fs, "event/duplicate.yaml"); err == nil {
+		t.Error("Read a manifest listing a category twice")
+	}
+	if _, err := ReadManifest(fs, "event/typo.yaml"); err == nil {
+		t.Error("Read a manifest with an unknown field")
+	}
+}
+
+func TestMothballCategory(t *testing.T) {
+	fs := newTestFs()
+	mb := new(bytes.Buffer)
+	if err := Mothball(NewFsCategory(fs, "unbroken"), mb, ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, "unbroken.mb", mb.Bytes(), 0644)
+
+	c, err := ManifestCategory{Path: "unbroken.mb"}.Open(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := c.Inventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv) != 2 {
+		t.Error("Wrong inventory", inv)
+	}
+
+	p, err := c.Puzzle(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Answers) != 1) || (p.Answers[0] != "YAML answer") {
+		t.Error("Answers not restored", p.Answers)
+	}
+	if !c.Answer(1, "YAML answer") {
+		t.Error("Right answer marked wrong")
+	}
+	if c.Answer(1, "moo") {
+		t.Error("Wrong answer marked right")
+	}
+
+	f, err := c.Open(1, "moo.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(f)
+	if buf.String() != "Moo." {
+		t.Error("Wrong attachment", buf.String())
+	}
+
+	// A mothball can be made from a mothball
+	again := new(bytes.Buffer)
+	if err := Mothball(c, again, ProductionProfile); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRemappedCategory(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "library/cows/10/puzzle.md", []byte("---\nanswers:\n  - moo\n---\nMoo?\n"), 0644)
+	afero.WriteFile(fs, "library/cows/20/puzzle.md", []byte("---\nanswers:\n  - grass\nattachments:\n  - grass.txt\n---\nEat?\n"), 0644)
+	afero.WriteFile(fs, "library/cows/20/grass.txt", []byte("Grass."), 0644)
+	afero.WriteFile(fs, "library/cows/30/puzzle.md", []byte("---\nanswers:\n  - milk\n---\nMake?\n"), 0644)
+	afero.WriteFile(fs, "manifest.yaml", []byte("categories:\n  - path: library/cows\n    name: bovines\n    scale: 10\n    points:\n      30: 500\n"), 0644)
+	afero.WriteFile(fs, "collision.yaml", []byte("categories:\n  - path: library/cows\n    points:\n      10: 20\n"), 0644)
+
+	manifest, err := ReadManifest(fs, "manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := manifest.Categories[0]
+	if mc.Name != "bovines" {
+		t.Error("Category not renamed", mc.Name)
+	}
+	c, err := mc.Open(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := c.Inventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inv, []int{100, 200, 500}) {
+		t.Error("Wrong inventory", inv)
+	}
+	if !c.Answer(100, "moo") || !c.Answer(500, "milk") {
+		t.Error("Right answer marked wrong")
+	}
+	if c.Answer(300, "milk") || c.Answer(10, "moo") {
+		t.Error("Answer accepted at old point value")
+	}
+	if f, err := c.Open(200, "grass.txt"); err != nil {
+		t.Error(err)
+	} else {
+		f.Close()
+	}
+
+	// The mothball is written with the new point values
+	mb := new(bytes.Buffer)
+	if err := Mothball(c, mb, ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+	afero.WriteFile(fs, "bovines.mb", mb.Bytes(), 0644)
+	mbc, err := NewMothballCategory(fs, "bovines.mb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mbc.Answer(200, "grass") {
+		t.Error("Mothball has wrong point values")
+	}
+
+	manifest, err = ReadManifest(fs, "collision.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = manifest.Categories[0].Open(fs)
+	if _, err := c.Inventory(); err == nil {
+		t.Error("Two puzzles given the same point value")
+	}
+}
@@ -1,31 +1,29 @@
 package transpile
 
 import (
-	"archive/zip"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os/exec"
+	"slices"
+
+	"github.com/dirtbags/moth/v4/pkg/mothball"
 )
 
-// Mothball packages a Category up for a production server run.
-func Mothball(c Category, w io.Writer) error {
-	zf := zip.NewWriter(w)
+// Mothball packages a Category up for a server run,
+// leaving in the spoilers profile keeps.
+// The profile's name is recorded in profile.txt.
+func Mothball(c Category, w io.Writer, profile BuildProfile) error {
+	mw := mothball.NewWriter(w)
+	mw.Profile = profile.Name
 
 	inv, err := c.Inventory()
 	if err != nil {
 		return err
 	}
 
-	puzzlesTxt := new(bytes.Buffer)
-	answersTxt := new(bytes.Buffer)
-
 	for _, points := range inv {
-		fmt.Fprintln(puzzlesTxt, points)
-
-		puzzlePath := fmt.Sprintf("%d/puzzle.json", points)
-		pw, err := zf.Create(puzzlePath)
+		pw, err := mw.Create(points, mothball.PuzzleFile)
 		if err != nil {
 			return err
 		}
@@ -34,29 +32,56 @@ func Mothball(c Category, w io.Writer) error {
 			return fmt.Errorf("Puzzle %d: %s", points, err)
 		}
 
-		// Record answers in answers.txt
-		for _, answer := range puzzle.Answers {
-			fmt.Fprintln(answersTxt, points, answer)
+		// Anything other than the default checker must be one we know
+		if puzzle.Checker != "" {
+			if _, err := GetAnswerChecker(puzzle.Checker); err != nil {
+				return fmt.Errorf("Puzzle %d: %s", points, err)
+			}
+		}
+
+		// Record answers in answers.txt, checkers.txt, and parts.txt
+		parts := []mothball.Part{}
+		for _, part := range puzzle.Parts {
+			parts = append(parts, mothball.Part{Name: part.Name, Answers: part.Answers})
 		}
+		for _, tier := range puzzle.Tiers {
+			parts = append(parts, mothball.Part{Name: tier.Name, Answers: tier.Answers})
+		}
+		mw.AddPuzzle(points, puzzle.Answers, puzzle.Checker, parts)
 
-		// Remove answers and debugging from puzzle object
-		puzzle.Answers = []string{}
-		puzzle.Debug.Errors = []string{}
-		puzzle.Debug.Hints = []string{}
-		puzzle.Debug.Log = []string{}
-		puzzle.Debug.Summary = ""
+		// Remove whatever the profile doesn't keep
+		profile.Strip(&puzzle)
 
-		// Write out Puzzle object
+		// Write out Puzzle object, without its translations
+		localized := puzzle
+		puzzle.Translations = nil
 		penc := json.NewEncoder(pw)
 		if err := penc.Encode(puzzle); err != nil {
 			return fmt.Errorf("Puzzle %d: %s", points, err)
 		}
 
-		// Write out all attachments and scripts
+		// Write out each translation
+		for _, locale := range puzzle.Locales {
+			if !ValidLocale(locale) {
+				return fmt.Errorf("Puzzle %d: invalid locale: %q", points, locale)
+			}
+			lp, _ := localized.Localized(locale)
+			lw, err := mw.Create(points, fmt.Sprintf("puzzle.%s.json", locale))
+			if err != nil {
+				return err
+			}
+			if err := json.NewEncoder(lw).Encode(lp); err != nil {
+				return fmt.Errorf("Puzzle %d: %s", points, err)
+			}
+		}
+
+		// Write out all attachments and scripts, and the solution
 		attachments := append(puzzle.Attachments, puzzle.Scripts...)
+		if puzzle.Solution && !slices.Contains(attachments, SolutionFile) {
+			attachments = append(attachments, SolutionFile)
+		}
 		for _, att := range attachments {
-			attPath := fmt.Sprintf("%d/%s", points, att)
-			aw, err := zf.Create(attPath)
+			aw, err := mw.Create(points, att)
 			if err != nil {
 				return err
 			}
@@ -72,19 +97,5 @@ func Mothball(c Category, w io.Writer) error {
 		}
 	}
 
-	pf, err := zf.Create("puzzles.txt")
-	if err != nil {
-		return err
-	}
-	puzzlesTxt.WriteTo(pf)
-
-	af, err := zf.Create("answers.txt")
-	if err != nil {
-		return err
-	}
-	answersTxt.WriteTo(af)
-
-	zf.Close()
-
-	return nil
+	return mw.Close()
 }
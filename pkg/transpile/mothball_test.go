@@ -3,10 +3,12 @@ package transpile
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -16,7 +18,7 @@ import (
 func TestMothballsMemFs(t *testing.T) {
 	static := NewFsCategory(newTestFs(), "cat1")
 	mb := new(bytes.Buffer)
-	if err := Mothball(static, mb); err != nil {
+	if err := Mothball(static, mb, ProductionProfile); err != nil {
 		t.Error(err)
 	}
 }
@@ -28,7 +30,7 @@ func TestMothballsOsFs(t *testing.T) {
 	fs := NewRecursiveBasePathFs(afero.NewOsFs(), "testdata")
 	static := NewFsCategory(fs, "static")
 	mb := new(bytes.Buffer)
-	err := Mothball(static, mb)
+	err := Mothball(static, mb, ProductionProfile)
 	if err != nil {
 		t.Error(err)
 		return
@@ -52,3 +54,56 @@ func TestMothballsOsFs(t *testing.T) {
 		}
 	}
 }
+
+func TestMothballProfiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - moo\ndebug:\n  summary: cows\n  hints:\n    - say moo\n  notes: cows say moo\n---\nbody\n"), 0644)
+
+	for _, profile := range BuildProfiles {
+		mb := new(bytes.Buffer)
+		if err := Mothball(NewFsCategory(fs, "cat"), mb, profile); err != nil {
+			t.Fatal(err)
+		}
+		mbr, err := zip.NewReader(bytes.NewReader(mb.Bytes()), int64(mb.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zfs := zipfs.New(mbr)
+
+		if buf, err := afero.ReadFile(zfs, "profile.txt"); err != nil {
+			t.Error(err)
+		} else if string(buf) != profile.Name+"\n" {
+			t.Errorf("%s: wrong profile.txt: %q", profile.Name, buf)
+		}
+		if buf, err := afero.ReadFile(zfs, "answers.txt"); err != nil {
+			t.Error(err)
+		} else if string(buf) != "1 moo\n" {
+			t.Errorf("%s: wrong answers.txt: %q", profile.Name, buf)
+		}
+
+		buf, err := afero.ReadFile(zfs, "1/puzzle.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Puzzle{}
+		if err := json.Unmarshal(buf, &p); err != nil {
+			t.Fatal(err)
+		}
+		if (len(p.Answers) > 0) != profile.Answers {
+			t.Errorf("%s: wrong answers: %v", profile.Name, p.Answers)
+		}
+		if ((len(p.Debug.Hints) > 0) != profile.Hints) || ((p.Debug.Notes != "") != profile.Hints) {
+			t.Errorf("%s: wrong hints: %v", profile.Name, p.Debug)
+		}
+		if (p.Debug.Summary != "") != profile.Summary {
+			t.Errorf("%s: wrong summary: %v", profile.Name, p.Debug)
+		}
+		if (profile.Name == "production") && strings.Contains(string(buf), "moo") {
+			t.Errorf("production mothball has spoilers: %s", buf)
+		}
+	}
+
+	if _, err := GetBuildProfile("nope"); err == nil {
+		t.Error("Got a profile that doesn't exist")
+	}
+}
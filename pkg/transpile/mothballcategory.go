@@ -0,0 +1,119 @@
+package transpile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dirtbags/moth/v4/pkg/mothball"
+	"github.com/spf13/afero"
+)
+
+// MothballCategory is a Category read from a mothball,
+// so mothballs can be served, or built again, like categories on disk.
+//
+// Puzzles have their answers put back in from answers.txt and parts.txt,
+// and their checker from checkers.txt.
+type MothballCategory struct {
+	mb *mothball.Reader
+}
+
+// NewMothballCategory reads the mothball called filename in fs.
+// The whole mothball is read into memory.
+func NewMothballCategory(fs afero.Fs, filename string) (MothballCategory, error) {
+	buf, err := afero.ReadFile(fs, filename)
+	if err != nil {
+		return MothballCategory{}, err
+	}
+	mb, err := mothball.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		return MothballCategory{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	return MothballCategory{mb}, nil
+}
+
+// Inventory lists every puzzle in puzzles.txt.
+func (mc MothballCategory) Inventory() ([]int, error) {
+	return mc.mb.Inventory()
+}
+
+// Puzzle returns the puzzle worth points, with its answers.
+func (mc MothballCategory) Puzzle(points int) (Puzzle, error) {
+	puzzle := Puzzle{}
+	f, err := mc.Open(points, mothball.PuzzleFile)
+	if err != nil {
+		return puzzle, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&puzzle); err != nil {
+		return puzzle, fmt.Errorf("%d/puzzle.json: %w", points, err)
+	}
+
+	// Translations are each in their own file
+	for _, locale := range puzzle.Locales {
+		lp := Puzzle{}
+		lf, err := mc.Open(points, fmt.Sprintf("puzzle.%s.json", locale))
+		if err != nil {
+			return puzzle, err
+		}
+		err = json.NewDecoder(lf).Decode(&lp)
+		lf.Close()
+		if err != nil {
+			return puzzle, fmt.Errorf("%d/puzzle.%s.json: %w", points, locale, err)
+		}
+		if puzzle.Translations == nil {
+			puzzle.Translations = make(map[string]string)
+		}
+		puzzle.Translations[locale] = lp.Body
+	}
+
+	// Mothballs built for development still have their answers
+	if len(puzzle.Answers) == 0 {
+		puzzle.Answers, _ = mc.mb.Answers(points)
+	}
+	if checker := mc.mb.Checker(points); checker != "" {
+		puzzle.Checker = checker
+	}
+
+	parts := make(map[string][]string)
+	for _, part := range mc.mb.Parts(points) {
+		parts[part.Name] = append(parts[part.Name], part.Answers...)
+	}
+	for i, part := range puzzle.Parts {
+		if len(part.Answers) == 0 {
+			puzzle.Parts[i].Answers = parts[part.Name]
+		}
+	}
+	for i, tier := range puzzle.Tiers {
+		if len(tier.Answers) == 0 {
+			puzzle.Tiers[i].Answers = parts[tier.Name]
+		}
+	}
+
+	return puzzle, nil
+}
+
+// Open returns the file called filename, for the puzzle worth points.
+func (mc MothballCategory) Open(points int, filename string) (ReadSeekCloser, error) {
+	return mc.mb.Open(points, filename)
+}
+
+// Answer returns whether answer is correct for the puzzle worth points.
+func (mc MothballCategory) Answer(points int, answer string) bool {
+	puzzle, err := mc.Puzzle(points)
+	if err != nil {
+		return false
+	}
+	ok, _ := CheckAnswerFiles(puzzle.Checker, categoryFiles(mc, points), puzzle.Answers, answer)
+	return ok
+}
+
+// AnswerPart returns the name of the part or tier of the puzzle worth points solved by answer.
+func (mc MothballCategory) AnswerPart(points int, answer string) string {
+	puzzle, err := mc.Puzzle(points)
+	if err != nil {
+		return ""
+	}
+	part, _ := puzzle.AnswerPartFiles(categoryFiles(mc, points), answer)
+	return part
+}
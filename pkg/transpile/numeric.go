@@ -0,0 +1,177 @@
+package transpile
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// siPrefixes maps SI prefix symbols to their multipliers.
+var siPrefixes = map[string]float64{
+	"Y":  1e24,
+	"Z":  1e21,
+	"E":  1e18,
+	"P":  1e15,
+	"T":  1e12,
+	"G":  1e9,
+	"M":  1e6,
+	"k":  1e3,
+	"K":  1e3, // Not SI, but everyone writes it
+	"h":  1e2,
+	"da": 1e1,
+	"d":  1e-1,
+	"c":  1e-2,
+	"m":  1e-3,
+	"µ":  1e-6,
+	"μ":  1e-6, // Greek mu, which looks the same as the micro sign
+	"u":  1e-6,
+	"n":  1e-9,
+	"p":  1e-12,
+	"f":  1e-15,
+	"a":  1e-18,
+}
+
+// bareSIPrefixes may be written without a unit, as in "2.4G".
+// Other prefixes are ambiguous without a unit: "5 m" means meters, not 0.005.
+var bareSIPrefixes = "kKMGTP"
+
+var quantityRegexp = regexp.MustCompile(`^([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)\s*(.*)$`)
+
+// quantity is one possible interpretation of a written number.
+type quantity struct {
+	// Value is the number, in units of Unit
+	Value float64
+
+	// Scale is how much the number as written was multiplied to get Value
+	Scale float64
+
+	// Unit is what's left after removing any SI prefix
+	Unit string
+}
+
+// parseQuantity returns every possible interpretation of s, a number with optional units.
+//
+// Units are ambiguous: "Pa" could be pascals, or peta-years.
+// Everything reasonable is returned, and it's up to the caller to pick one.
+func parseQuantity(s string) ([]quantity, error) {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, ",", "") // Digit grouping
+	m := quantityRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("not a number: %s", s)
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return nil, err
+	}
+	unit := strings.TrimSpace(m[2])
+
+	ret := []quantity{{value, 1, unit}}
+	for prefix, scale := range siPrefixes {
+		if !strings.HasPrefix(unit, prefix) {
+			continue
+		}
+		baseUnit := unit[len(prefix):]
+		if (baseUnit == "") && !strings.Contains(bareSIPrefixes, prefix) {
+			continue
+		}
+		ret = append(ret, quantity{value * scale, scale, baseUnit})
+	}
+	return ret, nil
+}
+
+// numericAnswer is an answer for the numeric checker.
+type numericAnswer struct {
+	// Values are the possible interpretations of the answer
+	Values []quantity
+
+	// Tolerance is the written tolerance, if any
+	Tolerance string
+}
+
+func parseNumericAnswer(answer string) (numericAnswer, error) {
+	ret := numericAnswer{}
+	answer = strings.Replace(answer, "+-", "±", 1)
+	valueStr, toleranceStr, _ := strings.Cut(answer, "±")
+
+	values, err := parseQuantity(valueStr)
+	if err != nil {
+		return ret, err
+	}
+	ret.Values = values
+	ret.Tolerance = strings.TrimSpace(toleranceStr)
+	return ret, nil
+}
+
+// tolerance returns the allowable difference from q.
+// If the tolerance has units that don't apply to q, ok is false.
+//
+// Tolerances may be written as a percentage ("± 1%"),
+// with units ("± 1 MHz"),
+// or without units, in which case they're in the same units as the answer was written ("2.4 GHz ± 0.1").
+// With no tolerance, there's still a little room for floating point rounding.
+func (a numericAnswer) tolerance(q quantity) (tolerance float64, ok bool, err error) {
+	if a.Tolerance == "" {
+		return math.Abs(q.Value * 1e-9), true, nil
+	}
+	if pct := strings.TrimSuffix(a.Tolerance, "%"); pct != a.Tolerance {
+		v, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil {
+			return 0, false, err
+		}
+		return math.Abs(q.Value * v / 100), true, nil
+	}
+
+	tols, err := parseQuantity(a.Tolerance)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, tol := range tols {
+		if tol.Unit == "" {
+			return tol.Value * q.Scale, true, nil
+		}
+		if tol.Unit == q.Unit {
+			return tol.Value, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// numericChecker treats each answer as a number, with optional units,
+// optionally followed by "±" or "+-" and a tolerance.
+//
+// A submission is accepted if it's within the tolerance of any answer.
+// Submissions may use scientific notation, SI prefixes, or no units at all:
+// "2.4 GHz", "2400 MHz", "2.4e9", and "2400000000" are all equal.
+// If both the submission and the answer have units, they must be the same.
+func numericChecker(answers []string, submitted string) (bool, error) {
+	subs, err := parseQuantity(submitted)
+	if err != nil {
+		return false, nil
+	}
+	for _, answer := range answers {
+		na, err := parseNumericAnswer(answer)
+		if err != nil {
+			return false, err
+		}
+		for _, want := range na.Values {
+			tolerance, ok, err := na.tolerance(want)
+			if err != nil {
+				return false, fmt.Errorf("bad tolerance: %s: %w", answer, err)
+			} else if !ok {
+				continue
+			}
+			for _, sub := range subs {
+				if (sub.Unit != "") && (want.Unit != "") && (sub.Unit != want.Unit) {
+					continue
+				}
+				if math.Abs(sub.Value-want.Value) <= tolerance {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,49 @@
+package transpile
+
+import (
+	"testing"
+)
+
+func TestNumericChecker(t *testing.T) {
+	cases := []struct {
+		answer    string
+		submitted string
+		correct   bool
+	}{
+		{"2400000000", "2.4 GHz", true},
+		{"2.4 GHz", "2400000000", true},
+		{"2.4 GHz", "2400 MHz", true},
+		{"2.4 GHz", "2.4e9", true},
+		{"2.4 GHz", "2.4E9 Hz", true},
+		{"2.4 GHz", "2.4G", true},
+		{"2.4 GHz", "2.5 GHz", false},
+		{"2.4 GHz", "2.4 GB", false},
+		{"2.4 GHz ± 0.1", "2.45 GHz", true},
+		{"2.4 GHz ± 0.1", "2.6 GHz", false},
+		{"2.4 GHz ± 1 MHz", "2400.5 MHz", true},
+		{"2.4 GHz ± 1 MHz", "2402 MHz", false},
+		{"100 ± 5%", "104", true},
+		{"100 ± 5%", "106", false},
+		{"101.3 kPa", "101300 Pa", true},
+		{"5 m", "5m", true},
+		{"5 m", "0.005", false},
+		{"1,000,000", "1e6", true},
+		{"-40", "-40.0", true},
+		{"0.5 µs", "500 ns", true},
+		{"0.5 µs", "500 ns ", true},
+		{"42", "forty-two", false},
+	}
+
+	for _, c := range cases {
+		correct, err := CheckAnswer("numeric", []string{c.answer}, c.submitted)
+		if err != nil {
+			t.Errorf("%#v %#v: %s", c.answer, c.submitted, err)
+		} else if correct != c.correct {
+			t.Errorf("%#v %#v: wanted %v, got %v", c.answer, c.submitted, c.correct, correct)
+		}
+	}
+
+	if _, err := CheckAnswer("numeric", []string{"1 ± moo"}, "1"); err == nil {
+		t.Error("Bad tolerance didn't return an error")
+	}
+}
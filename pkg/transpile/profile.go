@@ -0,0 +1,99 @@
+package transpile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BuildProfile says which spoilers are left in puzzles built into a mothball.
+type BuildProfile struct {
+	// Name identifies this profile, and is recorded in mothballs as profile.txt
+	Name string
+
+	// Answers keeps the answers to puzzles, and to their parts and tiers
+	Answers bool
+
+	// Hints keeps Debug.Hints and Debug.Notes
+	Hints bool
+
+	// Log keeps Debug.Log, Debug.Errors, and Debug.Accessibility
+	Log bool
+
+	// Summary keeps Debug.Summary
+	Summary bool
+
+	// Contacts keeps authors' email addresses
+	Contacts bool
+}
+
+// DevelProfile keeps everything, for the development server.
+var DevelProfile = BuildProfile{
+	Name:     "devel",
+	Answers:  true,
+	Hints:    true,
+	Log:      true,
+	Summary:  true,
+	Contacts: true,
+}
+
+// StagingProfile keeps hints and summaries, but not answers,
+// for play-testing a mothball before an event.
+var StagingProfile = BuildProfile{
+	Name:     "staging",
+	Hints:    true,
+	Summary:  true,
+	Contacts: true,
+}
+
+// ProductionProfile keeps nothing that could give away an answer.
+var ProductionProfile = BuildProfile{
+	Name: "production",
+}
+
+// BuildProfiles lists every BuildProfile, from most to least revealing.
+var BuildProfiles = []BuildProfile{DevelProfile, StagingProfile, ProductionProfile}
+
+// GetBuildProfile returns the BuildProfile called name.
+func GetBuildProfile(name string) (BuildProfile, error) {
+	names := make([]string, len(BuildProfiles))
+	for i, profile := range BuildProfiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+		names[i] = profile.Name
+	}
+	return BuildProfile{}, fmt.Errorf("unknown build profile %q: try one of %s", name, strings.Join(names, ", "))
+}
+
+// Strip removes everything from puzzle that bp doesn't keep.
+func (bp BuildProfile) Strip(puzzle *Puzzle) {
+	if !bp.Answers {
+		puzzle.Answers = []string{}
+		for i := range puzzle.Parts {
+			puzzle.Parts[i].Answers = []string{}
+		}
+		for i := range puzzle.Tiers {
+			puzzle.Tiers[i].Answers = []string{}
+		}
+		for i := range puzzle.Questions {
+			puzzle.Questions[i].Answers = []string{}
+		}
+	}
+	if !bp.Hints {
+		puzzle.Debug.Hints = []string{}
+		puzzle.Debug.Notes = ""
+	}
+	if !bp.Log {
+		puzzle.Debug.Log = []string{}
+		puzzle.Debug.Errors = []string{}
+		puzzle.Debug.Accessibility = nil
+	}
+	if !bp.Summary {
+		puzzle.Debug.Summary = ""
+	}
+	if !bp.Contacts {
+		for i := range puzzle.AuthorDetails {
+			puzzle.AuthorDetails[i].Email = ""
+		}
+	}
+}
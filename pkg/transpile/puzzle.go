@@ -4,12 +4,11 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha1"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/mail"
 	"os"
 	"os/exec"
@@ -17,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v2"
@@ -35,6 +35,10 @@ type PuzzleDebug struct {
 	Hints   []string
 	Notes   string
 	Summary string
+
+	// Accessibility lists problems with the body
+	// for participants using assistive technology
+	Accessibility []string `json:",omitempty"`
 }
 
 // Puzzle contains everything about a puzzle that a client will see.
@@ -45,6 +49,22 @@ type Puzzle struct {
 	// Authors names all authors of this puzzle
 	Authors []string
 
+	// AuthorDetails has each author's email address and handle,
+	// if any author gave one
+	AuthorDetails []PuzzleAuthor `json:",omitempty"`
+
+	// Tags are topics or levels this puzzle is about, like "forensics" or "beginner",
+	// for finding puzzles across categories
+	Tags []string `json:",omitempty"`
+
+	// Difficulty is how hard the author thinks this puzzle is,
+	// from 1 to MaxDifficulty, or 0 if they didn't say
+	Difficulty int `json:",omitempty"`
+
+	// Solution is true if the puzzle has an official solution, in SolutionFile,
+	// which servers withhold until it's released
+	Solution bool `json:",omitempty"`
+
 	// Attachments is a list of filenames used by this puzzle
 	Attachments []string
 
@@ -54,15 +74,86 @@ type Puzzle struct {
 	// Body is the HTML rendering of this puzzle
 	Body string
 
+	// Locales lists the languages this puzzle has been translated into
+	Locales []string `json:",omitempty"`
+
+	// Translations maps each of Locales to the HTML rendering of this puzzle in that language.
+	// Mothballs have each translation in its own puzzle.LOCALE.json instead.
+	Translations map[string]string `json:",omitempty"`
+
 	// AnswerPattern contains the pattern (regular expression?) used to match valid answers
 	AnswerPattern string
 
-	// AnswerHashes contains hashes of all answers for this puzzle
+	// AnswerHashes contains hashes of all answers for this puzzle.
+	// See AnswerHash for how they're computed.
 	AnswerHashes []string
 
+	// AnswerSalt is the salt used to compute every answer hash in this puzzle
+	AnswerSalt string `json:",omitempty"`
+
+	// AnswerHashIterations is the PBKDF2 iteration count used to compute answer hashes
+	AnswerHashIterations int `json:",omitempty"`
+
+	// HideAnswerHashes omits answer hashes,
+	// so answers can only be checked by submitting them to the server.
+	HideAnswerHashes bool `json:",omitempty"`
+
+	// Checker names the AnswerChecker used to check answers.
+	// Empty means DefaultAnswerChecker.
+	Checker string `json:",omitempty"`
+
 	// Answers lists all acceptable answers, omitted in mothballs
 	Answers []string
 
+	// Parts lists the independently-submitted parts of a multi-part answer.
+	// The puzzle is solved when every part has been solved.
+	Parts []PuzzlePart `json:",omitempty"`
+
+	// PartialCredit awards a share of the points for each part solved.
+	// Without it, no points are awarded until every part is solved.
+	PartialCredit bool `json:",omitempty"`
+
+	// Tiers lists alternative answers worth a fraction of the points,
+	// like the Acceptable and Mastery criteria in Success.
+	// Teams can upgrade to a higher tier later, for the difference in points.
+	Tiers []PuzzleTier `json:",omitempty"`
+
+	// Questions lists the questions of a quiz puzzle.
+	// Answers are submitted together, as a JSON list, one for each question,
+	// and checked by QuizChecker.
+	Questions []QuizQuestion `json:",omitempty"`
+
+	// TimeLimit is how many seconds a team has to solve this puzzle,
+	// from when it first loaded it.
+	// Zero means there's no limit.
+	TimeLimit int `json:",omitempty"`
+
+	// SpeedBonus is the fraction of the points added for solving within TimeLimit.
+	SpeedBonus float64 `json:",omitempty"`
+
+	// LatePenalty is the fraction of the points taken away for solving after TimeLimit.
+	LatePenalty float64 `json:",omitempty"`
+
+	// Decay makes the bonus shrink steadily over TimeLimit,
+	// down to the penalty when time runs out,
+	// instead of all at once.
+	Decay bool `json:",omitempty"`
+
+	// UploadMaxSize is the largest file, in bytes, accepted for a puzzle
+	// answered by uploading a file with UploadChecker.
+	// Zero means the server's limit.
+	UploadMaxSize int64 `json:",omitempty"`
+
+	// Service is a network service that goes with this puzzle,
+	// which the server keeps an eye on.
+	Service *PuzzleService `json:",omitempty"`
+
+	// Listener is a command the server runs for each connection to a TCP port
+	Listener *TCPListener `json:",omitempty"`
+
+	// Lab is a disposable environment provisioned for each team
+	Lab *PuzzleLab `json:",omitempty"`
+
 	// Extra is send unchanged to the client.
 	// Eventually, Objective, KSAs, and Success will move into Extra.
 	Extra map[string]any
@@ -83,29 +174,171 @@ type Puzzle struct {
 	}
 }
 
+// PuzzlePart is one part of a multi-part answer.
+type PuzzlePart struct {
+	// Name identifies this part. It may not contain whitespace.
+	Name string
+
+	// AnswerHashes contains hashes of all answers for this part
+	AnswerHashes []string `yaml:"-"`
+
+	// Answers lists all acceptable answers for this part, omitted in mothballs
+	Answers []string
+}
+
+// PuzzleTier is a set of answers worth a fraction of a puzzle's points.
+type PuzzleTier struct {
+	// Name identifies this tier. It may not contain whitespace.
+	Name string
+
+	// Value is the fraction of the puzzle's points this tier is worth.
+	// A Value of 1 or more solves the puzzle.
+	Value float64
+
+	// AnswerHashes contains hashes of all answers for this tier
+	AnswerHashes []string `yaml:"-"`
+
+	// Answers lists all acceptable answers for this tier, omitted in mothballs
+	Answers []string
+}
+
+// Tier returns the tier called name.
+func (puzzle *Puzzle) Tier(name string) (PuzzleTier, bool) {
+	for _, tier := range puzzle.Tiers {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return PuzzleTier{}, false
+}
+
 func (puzzle *Puzzle) computeAnswerHashes() {
-	if len(puzzle.Answers) == 0 {
+	if (puzzle.Checker != "") && (puzzle.Checker != DefaultAnswerChecker) {
+		// Hashes of anything but exact answers would tell the client correct answers are wrong
 		return
 	}
-	puzzle.AnswerHashes = make([]string, len(puzzle.Answers))
-	for i, answer := range puzzle.Answers {
-		sum := sha1.Sum([]byte(answer))
-		hexsum := fmt.Sprintf("%x", sum)
-		puzzle.AnswerHashes[i] = hexsum[:4]
+	if puzzle.HideAnswerHashes {
+		return
 	}
+	if (len(puzzle.Answers) == 0) && (len(puzzle.Parts) == 0) && (len(puzzle.Tiers) == 0) {
+		return
+	}
+	if puzzle.AnswerSalt == "" {
+		puzzle.AnswerSalt = NewAnswerSalt()
+	}
+	if puzzle.AnswerHashIterations == 0 {
+		puzzle.AnswerHashIterations = AnswerHashIterations
+	}
+
+	if len(puzzle.Answers) > 0 {
+		puzzle.AnswerHashes = puzzle.answerHashes(puzzle.Answers)
+	}
+	for i := range puzzle.Parts {
+		puzzle.Parts[i].AnswerHashes = puzzle.answerHashes(puzzle.Parts[i].Answers)
+	}
+	for i := range puzzle.Tiers {
+		puzzle.Tiers[i].AnswerHashes = puzzle.answerHashes(puzzle.Tiers[i].Answers)
+	}
+}
+
+func (puzzle *Puzzle) answerHashes(answers []string) []string {
+	hashes := make([]string, len(answers))
+	for i, answer := range answers {
+		hashes[i] = AnswerHash(answer, puzzle.AnswerSalt, puzzle.AnswerHashIterations)
+	}
+	return hashes
+}
+
+// validateParts makes sure every part and tier has a usable, unique name.
+func (puzzle *Puzzle) validateParts() error {
+	if (len(puzzle.Parts) > 0) && (len(puzzle.Tiers) > 0) {
+		return fmt.Errorf("puzzle can't have both parts and tiers")
+	}
+
+	names := make([]string, 0, len(puzzle.Parts)+len(puzzle.Tiers))
+	for _, part := range puzzle.Parts {
+		names = append(names, part.Name)
+	}
+	for _, tier := range puzzle.Tiers {
+		if tier.Value <= 0 {
+			return fmt.Errorf("tier %s: value must be more than 0", tier.Name)
+		}
+		names = append(names, tier.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("part with no name")
+		}
+		if strings.IndexFunc(name, unicode.IsSpace) != -1 {
+			return fmt.Errorf("part name contains whitespace: %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate part name: %s", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// AnswerPart returns the name of the part or tier solved by answer,
+// or the empty string if answer doesn't solve any part or tier.
+func (puzzle *Puzzle) AnswerPart(answer string) (string, error) {
+	return puzzle.AnswerPartFiles(nil, answer)
+}
+
+// AnswerPartFiles is like AnswerPart,
+// but a checker that needs the puzzle's files gets them from open.
+func (puzzle *Puzzle) AnswerPartFiles(open PuzzleFiles, answer string) (string, error) {
+	for _, part := range puzzle.Parts {
+		correct, err := CheckAnswerFiles(puzzle.Checker, open, part.Answers, answer)
+		if err != nil {
+			return "", err
+		}
+		if correct {
+			return part.Name, nil
+		}
+	}
+	for _, tier := range puzzle.Tiers {
+		correct, err := CheckAnswerFiles(puzzle.Checker, open, tier.Answers, answer)
+		if err != nil {
+			return "", err
+		}
+		if correct {
+			return tier.Name, nil
+		}
+	}
+	return "", nil
 }
 
 // StaticPuzzle contains everything a static puzzle might tell us.
 type StaticPuzzle struct {
-	Authors       []string
-	Attachments   []StaticAttachment
-	Scripts       []StaticAttachment
-	AnswerPattern string
-	Answers       []string
-	Debug         PuzzleDebug
-	Extra         map[string]any
-	Objective     string
-	Success       struct {
+	Authors          []PuzzleAuthor
+	Tags             []string
+	Difficulty       int
+	Attachments      []StaticAttachment
+	Scripts          []StaticAttachment
+	AnswerPattern    string
+	Answers          []string
+	Checker          string
+	Parts            []PuzzlePart
+	PartialCredit    bool
+	Tiers            []PuzzleTier
+	Questions        []QuizQuestion
+	TimeLimit        int
+	SpeedBonus       float64
+	LatePenalty      float64
+	Decay            bool
+	UploadMaxSize    int64
+	Service          *PuzzleService
+	Listener         *TCPListener
+	Lab              *PuzzleLab
+	HideAnswerHashes bool
+	Debug            PuzzleDebug
+	Extra            map[string]any
+	Objective        string
+	Success          struct {
 		Acceptable string
 		Mastery    string
 	}
@@ -165,10 +398,10 @@ func NewFsPuzzle(fs afero.Fs) PuzzleProvider {
 	if info, err := bfs.Stat("mkpuzzle"); !os.IsNotExist(err) {
 		if (info.Mode() & 0100) != 0 {
 			if command, err = bfs.RealPath(info.Name()); err != nil {
-				log.Println("WARN: Unable to resolve full path to", info.Name())
+				slog.Warn("unable to resolve full path", "file", info.Name())
 			}
 		} else {
-			log.Println("WARN: mkpuzzle exists, but isn't executable.")
+			slog.Warn("mkpuzzle exists, but isn't executable")
 		}
 	}
 
@@ -209,13 +442,30 @@ func (fp FsPuzzle) Puzzle() (Puzzle, error) {
 	// Convert to an exportable Puzzle
 	puzzle.Debug = static.Debug
 	puzzle.Answers = static.Answers
-	puzzle.Authors = static.Authors
+	puzzle.setAuthors(static.Authors)
+	puzzle.Tags = static.Tags
+	puzzle.Difficulty = static.Difficulty
+	puzzle.Solution = fp.hasSolution()
 	puzzle.Extra = static.Extra
 	puzzle.Objective = static.Objective
 	puzzle.KSAs = static.KSAs
 	puzzle.Success = static.Success
 	puzzle.Body = string(body)
 	puzzle.AnswerPattern = static.AnswerPattern
+	puzzle.Checker = static.Checker
+	puzzle.Parts = static.Parts
+	puzzle.PartialCredit = static.PartialCredit
+	puzzle.Tiers = static.Tiers
+	puzzle.Questions = static.Questions
+	puzzle.TimeLimit = static.TimeLimit
+	puzzle.SpeedBonus = static.SpeedBonus
+	puzzle.LatePenalty = static.LatePenalty
+	puzzle.Decay = static.Decay
+	puzzle.UploadMaxSize = static.UploadMaxSize
+	puzzle.Service = static.Service
+	puzzle.Listener = static.Listener
+	puzzle.Lab = static.Lab
+	puzzle.HideAnswerHashes = static.HideAnswerHashes
 	puzzle.Attachments = make([]string, len(static.Attachments))
 	for i, attachment := range static.Attachments {
 		puzzle.Attachments[i] = attachment.Filename
@@ -224,14 +474,87 @@ func (fp FsPuzzle) Puzzle() (Puzzle, error) {
 	for i, script := range static.Scripts {
 		puzzle.Scripts[i] = script.Filename
 	}
+	if puzzle.Translations, err = fp.translations(); err != nil {
+		return puzzle, err
+	}
+	puzzle.listLocales()
+	if err := puzzle.validateAuthors(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateTags(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateDifficulty(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateParts(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateTiming(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateUpload(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateService(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateListener(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.validateLab(); err != nil {
+		return puzzle, err
+	}
+	if err := puzzle.compileQuiz(); err != nil {
+		return puzzle, err
+	}
 	puzzle.computeAnswerHashes()
+	puzzle.checkContent()
 
 	return puzzle, nil
 }
 
+// translations returns the HTML rendering of every puzzle.LOCALE.md, by locale.
+func (fp FsPuzzle) translations() (map[string]string, error) {
+	ents, err := afero.ReadDir(fp.fs, ".")
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]string
+	for _, ent := range ents {
+		name := ent.Name()
+		if (name == "puzzle.md") || !strings.HasPrefix(name, "puzzle.") || !strings.HasSuffix(name, ".md") {
+			continue
+		}
+		locale := strings.TrimSuffix(strings.TrimPrefix(name, "puzzle."), ".md")
+		if !ValidLocale(locale) {
+			continue
+		}
+
+		f, err := fp.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		html := new(bytes.Buffer)
+		err = Markdown(f, html)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if ret == nil {
+			ret = make(map[string]string)
+		}
+		ret[strings.ToLower(locale)] = html.String()
+	}
+	return ret, nil
+}
+
 // Open returns a newly-opened file.
 func (fp FsPuzzle) Open(name string) (ReadSeekCloser, error) {
 	empty := nopCloser{new(bytes.Reader)}
+	if (name == SolutionFile) && fp.hasSolution() {
+		return fp.solution()
+	}
 	static, _, err := fp.staticPuzzle()
 	if err != nil {
 		return empty, err
@@ -254,6 +577,13 @@ func (fp FsPuzzle) Open(name string) (ReadSeekCloser, error) {
 	return fp.fs.Open(fsPath)
 }
 
+// files returns a PuzzleFiles opening the puzzle's attachments and scripts.
+func (fp FsPuzzle) files() PuzzleFiles {
+	return func(filename string) (io.ReadCloser, error) {
+		return fp.Open(filename)
+	}
+}
+
 func (fp FsPuzzle) staticPuzzle() (StaticPuzzle, []byte, error) {
 	r, err := fp.fs.Open("puzzle.md")
 	if err != nil {
@@ -306,6 +636,45 @@ func (fp FsPuzzle) staticPuzzle() (StaticPuzzle, []byte, error) {
 	return static, html.Bytes(), err
 }
 
+// addPartAnswer parses txt as "name answer",
+// adding answer to the part called name.
+func (p *StaticPuzzle) addPartAnswer(txt string) {
+	fields := strings.SplitN(txt, " ", 2)
+	name := fields[0]
+	answer := ""
+	if len(fields) > 1 {
+		answer = fields[1]
+	}
+	for i := range p.Parts {
+		if p.Parts[i].Name == name {
+			p.Parts[i].Answers = append(p.Parts[i].Answers, answer)
+			return
+		}
+	}
+	p.Parts = append(p.Parts, PuzzlePart{Name: name, Answers: []string{answer}})
+}
+
+// addTierAnswer parses txt as "name value answer",
+// adding answer to the tier called name.
+func (p *StaticPuzzle) addTierAnswer(txt string) error {
+	fields := strings.SplitN(txt, " ", 3)
+	if len(fields) < 3 {
+		return fmt.Errorf("tier: expected name, value, and answer: %s", txt)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return fmt.Errorf("tier %s: %w", fields[0], err)
+	}
+	for i := range p.Tiers {
+		if p.Tiers[i].Name == fields[0] {
+			p.Tiers[i].Answers = append(p.Tiers[i].Answers, fields[2])
+			return nil
+		}
+	}
+	p.Tiers = append(p.Tiers, PuzzleTier{Name: fields[0], Value: value, Answers: []string{fields[2]}})
+	return nil
+}
+
 func legacyAttachmentParser(val []string) []StaticAttachment {
 	ret := make([]StaticAttachment, len(val))
 	for idx, txt := range val {
@@ -341,7 +710,15 @@ func rfc822HeaderParser(r io.Reader) (StaticPuzzle, error) {
 		key = strings.ToLower(key)
 		switch key {
 		case "author":
-			p.Authors = val
+			for _, author := range val {
+				p.Authors = append(p.Authors, parseAuthor(author))
+			}
+		case "tag":
+			p.Tags = append(p.Tags, val...)
+		case "difficulty":
+			if p.Difficulty, err = strconv.Atoi(val[0]); err != nil {
+				return p, fmt.Errorf("difficulty: %w", err)
+			}
 		case "pattern":
 			p.AnswerPattern = val[0]
 		case "script":
@@ -350,6 +727,48 @@ func rfc822HeaderParser(r io.Reader) (StaticPuzzle, error) {
 			p.Attachments = legacyAttachmentParser(val)
 		case "answer":
 			p.Answers = val
+		case "checker":
+			p.Checker = val[0]
+		case "part":
+			for _, txt := range val {
+				p.addPartAnswer(txt)
+			}
+		case "partialcredit":
+			p.PartialCredit = (strings.ToLower(val[0]) == "true")
+		case "timelimit":
+			if p.TimeLimit, err = strconv.Atoi(val[0]); err != nil {
+				return p, fmt.Errorf("timelimit: %w", err)
+			}
+		case "speedbonus":
+			if p.SpeedBonus, err = strconv.ParseFloat(val[0], 64); err != nil {
+				return p, fmt.Errorf("speedbonus: %w", err)
+			}
+		case "latepenalty":
+			if p.LatePenalty, err = strconv.ParseFloat(val[0], 64); err != nil {
+				return p, fmt.Errorf("latepenalty: %w", err)
+			}
+		case "decay":
+			p.Decay = (strings.ToLower(val[0]) == "true")
+		case "service":
+			if p.Service, err = parseService(val[0]); err != nil {
+				return p, err
+			}
+		case "lab":
+			p.Lab = &PuzzleLab{Template: val[0]}
+		case "listener":
+			p.Listener = &TCPListener{Command: val[0]}
+		case "uploadmaxsize":
+			if p.UploadMaxSize, err = strconv.ParseInt(val[0], 10, 64); err != nil {
+				return p, fmt.Errorf("uploadmaxsize: %w", err)
+			}
+		case "hideanswerhashes":
+			p.HideAnswerHashes = (strings.ToLower(val[0]) == "true")
+		case "tier":
+			for _, txt := range val {
+				if err := p.addTierAnswer(txt); err != nil {
+					return p, err
+				}
+			}
 		case "summary":
 			p.Debug.Summary = val[0]
 		case "hint":
@@ -378,12 +797,19 @@ func (fp FsPuzzle) Answer(answer string) bool {
 	if err != nil {
 		return false
 	}
-	for _, ans := range p.Answers {
-		if ans == answer {
-			return true
+	if len(p.Questions) > 0 {
+		quiz := Puzzle{Questions: p.Questions, Checker: p.Checker}
+		if err := quiz.compileQuiz(); err != nil {
+			slog.Error("checking answer", "error", err)
+			return false
 		}
+		p.Answers, p.Checker = quiz.Answers, quiz.Checker
+	}
+	correct, err := CheckAnswerFiles(p.Checker, fp.files(), p.Answers, answer)
+	if err != nil {
+		slog.Error("checking answer", "error", err)
 	}
-	return false
+	return correct
 }
 
 // FsCommandPuzzle provides an FsPuzzle backed by running a command.
@@ -408,23 +834,59 @@ func (fp FsCommandPuzzle) run(command string, args ...string) ([]byte, error) {
 	return out, err
 }
 
+// cachedRun is run, using earlier output if nothing has changed:
+// see SetCommandCacheTTL.
+func (fp FsCommandPuzzle) cachedRun(command string, args ...string) ([]byte, error) {
+	cmdargs := append([]string{command}, args...)
+	return commands.run(fp.fs, fp.command, cmdargs, func() ([]byte, error) {
+		return fp.run(command, args...)
+	})
+}
+
 // Puzzle returns a Puzzle struct for the current puzzle.
 func (fp FsCommandPuzzle) Puzzle() (Puzzle, error) {
-	stdout, err := fp.run("puzzle")
+	stdout, err := fp.cachedRun("puzzle")
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		return Puzzle{}, errors.New(string(exiterr.Stderr))
 	} else if err != nil {
 		return Puzzle{}, err
 	}
 
-	jsdec := json.NewDecoder(bytes.NewReader(stdout))
-	jsdec.DisallowUnknownFields()
 	puzzle := Puzzle{}
-	if err := jsdec.Decode(&puzzle); err != nil {
-		return Puzzle{}, err
+	if err := DecodeStrictJSON(stdout, &puzzle); err != nil {
+		return Puzzle{}, fmt.Errorf("%s: %w", fp.command, err)
 	}
+	puzzle.listLocales()
 
+	if err := puzzle.validateAuthors(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateTags(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateDifficulty(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateParts(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateUpload(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateService(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateListener(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.validateLab(); err != nil {
+		return Puzzle{}, err
+	}
+	if err := puzzle.compileQuiz(); err != nil {
+		return Puzzle{}, err
+	}
 	puzzle.computeAnswerHashes()
+	puzzle.checkContent()
 
 	return puzzle, nil
 }
@@ -440,7 +902,7 @@ func (c nopCloser) Close() error {
 // Open returns a newly-opened file.
 // BUG(neale): FsCommandPuzzle.Open() reads everything into memory, and will suck for large files.
 func (fp FsCommandPuzzle) Open(filename string) (ReadSeekCloser, error) {
-	stdout, err := fp.run("file", filename)
+	stdout, err := fp.cachedRun("file", filename)
 	buf := nopCloser{bytes.NewReader(stdout)}
 	if err != nil {
 		return buf, err
@@ -453,13 +915,13 @@ func (fp FsCommandPuzzle) Open(filename string) (ReadSeekCloser, error) {
 func (fp FsCommandPuzzle) Answer(answer string) bool {
 	stdout, err := fp.run("answer", answer)
 	if err != nil {
-		log.Printf("ERROR: checking answer: %s", err)
+		slog.Error("checking answer", "error", err)
 		return false
 	}
 
 	ans := AnswerResponse{}
 	if err := json.Unmarshal(stdout, &ans); err != nil {
-		log.Printf("ERROR: checking answer: %s", err)
+		slog.Error("checking answer", "error", err)
 		return false
 	}
 
@@ -29,6 +29,11 @@ func TestPuzzle(t *testing.T) {
 		if len(p.AnswerHashes[0]) != 4 {
 			t.Error("Answer hash is wrong length")
 		}
+		if p.AnswerSalt == "" {
+			t.Error("Answer hashes aren't salted")
+		} else if p.AnswerHashes[0] != AnswerHash("YAML answer", p.AnswerSalt, p.AnswerHashIterations) {
+			t.Error("Answer hash is wrong")
+		}
 		if (len(p.Authors) != 3) || (p.Authors[1] != "Buster") {
 			t.Error("Authors are wrong", p.Authors)
 		}
@@ -93,6 +98,103 @@ func TestPuzzle(t *testing.T) {
 		t.Error("Markdown dictionary extension isn't making tables")
 	}
 
+	{
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, "1/puzzle.md", []byte("---\nanswers:\n  - \"c[ao]t\"\nchecker: regex\n---\nCat?\n"), 0644)
+		pd := NewFsPuzzlePoints(fs, 1)
+		if puzzle, err := pd.Puzzle(); err != nil {
+			t.Error("Regex checker:", err)
+		} else if puzzle.Checker != "regex" {
+			t.Error("Checker not parsed", puzzle.Checker)
+		} else if len(puzzle.AnswerHashes) != 0 {
+			t.Error("Answer hashes computed for a regular expression")
+		}
+		if !pd.Answer("cot") {
+			t.Error("Regex checker marked right answer wrong")
+		}
+		if pd.Answer("c[ao]t") {
+			t.Error("Regex checker compared exact string")
+		}
+	}
+
+	{
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, "1/puzzle.md", []byte("---\nparts:\n  - name: user\n    answers: [flag1]\n  - name: root\n    answers: [flag2, flag3]\npartialcredit: true\n---\nPwn it.\n"), 0644)
+		afero.WriteFile(fs, "2/puzzle.md", []byte("part: user flag1\npart: root flag2\npart: root flag3\n\nPwn it.\n"), 0644)
+		afero.WriteFile(fs, "3/puzzle.md", []byte("---\nparts:\n  - name: two words\n    answers: [flag1]\n---\nPwn it.\n"), 0644)
+		for _, points := range []int{1, 2} {
+			puzzle, err := NewFsPuzzlePoints(fs, points).Puzzle()
+			if err != nil {
+				t.Error("Multi-part puzzle:", err)
+				continue
+			}
+			if len(puzzle.Parts) != 2 {
+				t.Error("Wrong number of parts", puzzle.Parts)
+				continue
+			}
+			if (puzzle.Parts[1].Name != "root") || (len(puzzle.Parts[1].Answers) != 2) {
+				t.Error("Wrong part", puzzle.Parts[1])
+			}
+			if len(puzzle.Parts[1].AnswerHashes) != 2 {
+				t.Error("Part answer hashes not computed")
+			}
+			if part, _ := puzzle.AnswerPart("flag3"); part != "root" {
+				t.Error("Wrong part solved", part)
+			}
+			if part, _ := puzzle.AnswerPart("flag4"); part != "" {
+				t.Error("Wrong answer solved a part", part)
+			}
+		}
+		if puzzle, _ := NewFsPuzzlePoints(fs, 1).Puzzle(); !puzzle.PartialCredit {
+			t.Error("Partial credit not parsed")
+		}
+		if _, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err == nil {
+			t.Error("Whitespace in part name should be an error")
+		}
+	}
+
+	{
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, "1/puzzle.md", []byte("---\ntiers:\n  - name: acceptable\n    value: 0.5\n    answers: [nmap]\n  - name: mastery\n    value: 1\n    answers: [nmap -sS]\n---\nScan it.\n"), 0644)
+		afero.WriteFile(fs, "2/puzzle.md", []byte("tier: acceptable 0.5 nmap\ntier: mastery 1 nmap -sS\n\nScan it.\n"), 0644)
+		afero.WriteFile(fs, "3/puzzle.md", []byte("tier: acceptable half nmap\n\nScan it.\n"), 0644)
+		afero.WriteFile(fs, "4/puzzle.md", []byte("part: user flag1\ntier: acceptable 0.5 nmap\n\nScan it.\n"), 0644)
+		for _, points := range []int{1, 2} {
+			puzzle, err := NewFsPuzzlePoints(fs, points).Puzzle()
+			if err != nil {
+				t.Error("Tiered puzzle:", err)
+				continue
+			}
+			if tier, ok := puzzle.Tier("acceptable"); !ok || (tier.Value != 0.5) {
+				t.Error("Wrong tier", puzzle.Tiers)
+			}
+			if part, _ := puzzle.AnswerPart("nmap -sS"); part != "mastery" {
+				t.Error("Wrong tier solved", part)
+			}
+			if len(puzzle.Tiers[1].AnswerHashes) != 1 {
+				t.Error("Tier answer hashes not computed")
+			}
+		}
+		if _, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err == nil {
+			t.Error("Non-numeric tier value should be an error")
+		}
+		if _, err := NewFsPuzzlePoints(fs, 4).Puzzle(); err == nil {
+			t.Error("Parts and tiers together should be an error")
+		}
+	}
+
+	{
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, "1/puzzle.md", []byte("answer: moo\nhideanswerhashes: true\n\nMoo?\n"), 0644)
+		if puzzle, err := NewFsPuzzlePoints(fs, 1).Puzzle(); err != nil {
+			t.Error(err)
+		} else if !puzzle.HideAnswerHashes {
+			t.Error("hideanswerhashes not parsed")
+		} else if (len(puzzle.AnswerHashes) != 0) || (puzzle.AnswerSalt != "") {
+			t.Error("Answer hashes computed for a puzzle hiding them")
+		}
+	}
+
 	if _, err := NewFsPuzzlePoints(catFs, 99).Puzzle(); err == nil {
 		t.Error("Non-existent puzzle", err)
 	}
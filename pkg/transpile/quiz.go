@@ -0,0 +1,98 @@
+package transpile
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// QuizChecker is the name of the answer checker used by quiz puzzles.
+const QuizChecker = "quiz"
+
+// QuizQuestion is one question in a quiz puzzle.
+type QuizQuestion struct {
+	// Text is the question
+	Text string
+
+	// Choices lists the choices of a multiple-choice question.
+	// Without any, it's a short-answer question.
+	Choices []string `json:",omitempty"`
+
+	// Answers lists all acceptable answers, omitted in mothballs
+	Answers []string
+}
+
+// compileQuiz turns a quiz puzzle's questions into answers for QuizChecker.
+//
+// Each answer is a JSON list of the acceptable answers to one question,
+// in the order the questions were asked.
+func (puzzle *Puzzle) compileQuiz() error {
+	if len(puzzle.Questions) == 0 {
+		return nil
+	}
+	if (len(puzzle.Answers) > 0) || (len(puzzle.Parts) > 0) || (len(puzzle.Tiers) > 0) {
+		return fmt.Errorf("quiz puzzle can't also have answers, parts, or tiers")
+	}
+	if (puzzle.Checker != "") && (puzzle.Checker != QuizChecker) {
+		return fmt.Errorf("quiz puzzle can't use the %s checker", puzzle.Checker)
+	}
+
+	puzzle.Checker = QuizChecker
+	puzzle.Answers = make([]string, 0, len(puzzle.Questions))
+	for i, question := range puzzle.Questions {
+		if question.Text == "" {
+			return fmt.Errorf("question %d has no text", i+1)
+		}
+		if len(question.Answers) == 0 {
+			return fmt.Errorf("question %d has no answers", i+1)
+		}
+		for _, answer := range question.Answers {
+			if (len(question.Choices) > 0) && !quizContains(question.Choices, answer) {
+				return fmt.Errorf("question %d: answer %q isn't one of the choices", i+1, answer)
+			}
+		}
+		buf, err := json.Marshal(question.Answers)
+		if err != nil {
+			return err
+		}
+		puzzle.Answers = append(puzzle.Answers, string(buf))
+	}
+	return nil
+}
+
+// quizChecker accepts a JSON list of answers, one for each question,
+// if every one of them is acceptable.
+//
+// Each of answers is a JSON list of the acceptable answers to a question.
+// Case, and whitespace around answers, are ignored.
+func quizChecker(answers []string, submitted string) (bool, error) {
+	var responses []string
+	if err := json.Unmarshal([]byte(submitted), &responses); err != nil {
+		// Not a structured submission, so it can't be right
+		return false, nil
+	}
+	if len(responses) != len(answers) {
+		return false, nil
+	}
+	for i, answer := range answers {
+		var acceptable []string
+		if err := json.Unmarshal([]byte(answer), &acceptable); err != nil {
+			return false, fmt.Errorf("question %d: %w", i+1, err)
+		}
+		if !quizContains(acceptable, responses[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// quizContains returns true if answer is in list, ignoring case and surrounding whitespace.
+func quizContains(list []string, answer string) bool {
+	answer = strings.TrimSpace(answer)
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), answer) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestQuiz(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte(`---
+questions:
+  - text: What port does HTTP use?
+    choices: ["21", "80", "443"]
+    answers: ["80"]
+  - text: What does DNS stand for?
+    answers: [Domain Name System]
+---
+Knowledge check.
+`), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("---\nquestions:\n  - text: Pick one\n    choices: [a, b]\n    answers: [c]\n---\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nanswers: [moo]\nquestions:\n  - text: Moo?\n    answers: [moo]\n---\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("---\nquestions:\n  - text: Moo?\n---\n"), 0644)
+
+	pd := NewFsPuzzlePoints(fs, 1)
+	puzzle, err := pd.Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puzzle.Checker != QuizChecker {
+		t.Error("Wrong checker:", puzzle.Checker)
+	}
+	if (len(puzzle.Questions) != 2) || (len(puzzle.Questions[0].Choices) != 3) {
+		t.Error("Questions not parsed:", puzzle.Questions)
+	}
+	if len(puzzle.AnswerHashes) != 0 {
+		t.Error("Answer hashes computed for a quiz")
+	}
+
+	for submitted, correct := range map[string]bool{
+		`["80", "Domain Name System"]`:    true,
+		`["80", "  domain name system "]`: true,
+		`["443", "Domain Name System"]`:   false,
+		`["80"]`:                          false,
+		`["80", "DNS", "extra"]`:          false,
+		`80 Domain Name System`:           false,
+	} {
+		if pd.Answer(submitted) != correct {
+			t.Errorf("Answer %s: wanted %v", submitted, correct)
+		}
+	}
+
+	if _, err := NewFsPuzzlePoints(fs, 2).Puzzle(); err == nil {
+		t.Error("Answer that isn't a choice should be an error")
+	}
+	if _, err := NewFsPuzzlePoints(fs, 3).Puzzle(); err == nil {
+		t.Error("Questions and answers together should be an error")
+	}
+	if _, err := NewFsPuzzlePoints(fs, 4).Puzzle(); err == nil {
+		t.Error("Question without answers should be an error")
+	}
+
+	ProductionProfile.Strip(&puzzle)
+	if len(puzzle.Questions[0].Answers) != 0 {
+		t.Error("Question answers not stripped")
+	}
+}
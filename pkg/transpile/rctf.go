@@ -0,0 +1,99 @@
+package transpile
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// RCTFChallenge is a challenge as rCTF's admin API takes it,
+// at PUT /api/v1/admin/challs/ID.
+type RCTFChallenge struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	Description      string     `json:"description"`
+	Category         string     `json:"category"`
+	Author           string     `json:"author"`
+	Files            []RCTFFile `json:"files"`
+	Points           RCTFPoints `json:"points"`
+	Flag             string     `json:"flag"`
+	TiebreakEligible bool       `json:"tiebreakEligible"`
+	SortWeight       int        `json:"sortWeight"`
+}
+
+// RCTFFile is a file attached to an RCTFChallenge.
+type RCTFFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// RCTFPoints is the range an RCTFChallenge's points decay over as it's solved.
+type RCTFPoints struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// ExportRCTF returns every puzzle in c, the category called category, as an rCTF challenge,
+// and writes their attachments to dst, as files/ID/FILENAME.
+// Each file's URL is baseURL followed by that path.
+//
+// rCTF challenges have one flag, checked exactly,
+// so the first answer is used, and the others are dropped.
+// Points don't decay.
+// Anything that can't be carried over is logged as a warning.
+func ExportRCTF(c Category, category string, dst afero.Fs, baseURL string) ([]RCTFChallenge, error) {
+	inv, err := c.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	challenges := []RCTFChallenge{}
+	for _, points := range inv {
+		p, err := c.Puzzle(points)
+		if err != nil {
+			return nil, fmt.Errorf("%s %d: %w", category, points, err)
+		}
+		name := exportName(p, category, points)
+		exportWarn(p, name)
+		if len(p.Answers) > 1 {
+			slog.Warn("answers after the first dropped", "puzzle", name)
+		}
+		if (p.Checker != "") && (p.Checker != "exact") {
+			slog.Warn("answer exported as an exact match", "puzzle", name, "checker", p.Checker)
+		}
+		if len(p.Debug.Hints) > 0 {
+			slog.Warn("hints dropped", "puzzle", name)
+		}
+
+		challenge := RCTFChallenge{
+			ID:               fmt.Sprintf("%s-%d", category, points),
+			Name:             name,
+			Description:      p.Body,
+			Category:         category,
+			Author:           strings.Join(p.Authors, ", "),
+			Files:            []RCTFFile{},
+			Points:           RCTFPoints{Min: points, Max: points},
+			TiebreakEligible: true,
+		}
+		if len(p.Answers) > 0 {
+			challenge.Flag = p.Answers[0]
+		}
+
+		filesDir := path.Join("files", challenge.ID)
+		if err := dst.MkdirAll(filesDir, 0755); err != nil {
+			return nil, err
+		}
+		for _, filename := range p.Attachments {
+			filePath := path.Join(filesDir, filename)
+			if err := exportCopy(c, points, filename, dst, filePath); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			challenge.Files = append(challenge.Files, RCTFFile{Name: filename, URL: baseURL + filePath})
+		}
+
+		challenges = append(challenges, challenge)
+	}
+	return challenges, nil
+}
@@ -0,0 +1,36 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestExportRCTF(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - moo\n  - MOO\nattachments:\n  - cow.txt\n---\nWhat do cows say?\n"), 0644)
+	afero.WriteFile(fs, "cat/1/cow.txt", []byte("moo"), 0644)
+	afero.WriteFile(fs, "cat/5/puzzle.md", []byte("---\nanswers:\n  - five\ndebug:\n  summary: Five\n---\nFive\n"), 0644)
+
+	dst := afero.NewMemMapFs()
+	challenges, err := ExportRCTF(NewFsCategory(fs, "cat"), "cat", dst, "https://files.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(challenges) != 2 {
+		t.Fatal("Wrong number of challenges:", len(challenges))
+	}
+	c := challenges[0]
+	if (c.ID != "cat-1") || (c.Name != "cat 1") || (c.Flag != "moo") || (c.Points != RCTFPoints{1, 1}) {
+		t.Error("Wrong challenge:", c)
+	}
+	if (len(c.Files) != 1) || (c.Files[0].URL != "https://files.example.com/files/cat-1/cow.txt") {
+		t.Error("Wrong files:", c.Files)
+	}
+	if _, err := dst.Stat("files/cat-1/cow.txt"); err != nil {
+		t.Error(err)
+	}
+	if challenges[1].Name != "Five" {
+		t.Error("Wrong name:", challenges[1].Name)
+	}
+}
@@ -0,0 +1,285 @@
+package transpile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// JSONError describes a problem with JSON from a generator, like mkpuzzle,
+// and where it is.
+type JSONError struct {
+	// Field is the dotted path to the problem, like "Parts.0.Name".
+	// It's empty if the problem isn't in any one field.
+	Field string
+
+	// Line and Column are where the problem is, starting at 1.
+	Line   int
+	Column int
+
+	Message string
+
+	// offset is where the problem is, in bytes
+	offset int64
+}
+
+func (e *JSONError) Error() string {
+	where := fmt.Sprintf("line %d, column %d", e.Line, e.Column)
+	if e.Field != "" {
+		where += ": " + e.Field
+	}
+	return where + ": " + e.Message
+}
+
+// newJSONError returns a JSONError for the problem at offset in data.
+func newJSONError(data []byte, offset int64, field string, format string, a ...any) *JSONError {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return &JSONError{
+		Field:   field,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, a...),
+		offset:  offset,
+	}
+}
+
+// within returns a copy of e for JSON which was found at offset in data,
+// at the field called path.
+func (e *JSONError) within(data []byte, offset int64, path string) *JSONError {
+	return newJSONError(data, offset+e.offset, joinField(path, e.Field), "%s", e.Message)
+}
+
+// DecodeStrictJSON decodes data into v, which must be a pointer,
+// returning a *JSONError if anything is wrong.
+//
+// Unlike json.Unmarshal, fields that aren't in v are errors,
+// which suggest the field that was probably meant.
+func DecodeStrictJSON(data []byte, v any) error {
+	// Syntax errors first, since json.Decoder.Token describes them poorly
+	var raw json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return jsonUnmarshalError(data, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := checkFields(dec, data, reflect.TypeOf(v).Elem(), ""); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return jsonUnmarshalError(data, err)
+	}
+	return nil
+}
+
+// jsonUnmarshalError converts an error from json.Unmarshal into a *JSONError,
+// if it knows where the problem is.
+func jsonUnmarshalError(data []byte, err error) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		// Offset is just after the bad character
+		return newJSONError(data, syntaxError.Offset-1, "", "%s", syntaxError.Error())
+	case errors.As(err, &typeError):
+		// Offset is just after the bad value
+		return newJSONError(
+			data, typeError.Offset, typeError.Field,
+			"expected %s, got %s", jsonTypeName(typeError.Type), typeError.Value,
+		)
+	}
+	return err
+}
+
+// checkFields reads the next value from dec,
+// checking that every object field in it is in t.
+func checkFields(dec *json.Decoder, data []byte, t reflect.Type, path string) error {
+	for (t.Kind() == reflect.Pointer) || (t.Kind() == reflect.Interface && t.NumMethod() > 0) {
+		t = t.Elem()
+	}
+
+	offset := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return newJSONError(data, syntaxError.Offset, path, "%s", syntaxError.Error())
+		}
+		return newJSONError(data, offset, path, "%s", err.Error())
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case (delim == '{') && (t.Kind() == reflect.Struct):
+		fields := jsonFields(t)
+		for dec.More() {
+			offset := dec.InputOffset()
+			tok, err := dec.Token()
+			if err != nil {
+				return newJSONError(data, offset, path, "%s", err.Error())
+			}
+			name := tok.(string)
+			field, ok := findField(fields, name)
+			if !ok {
+				msg := fmt.Sprintf("unknown field %q", name)
+				if suggestion := suggestField(fields, name); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				// Point at the name, not the space before it
+				offset += int64(bytes.IndexByte(data[offset:], '"'))
+				return newJSONError(data, offset+1, path, "%s", msg)
+			}
+			if err := checkFields(dec, data, field.Type, joinField(path, field.Name)); err != nil {
+				return err
+			}
+		}
+	case (delim == '[') && ((t.Kind() == reflect.Slice) || (t.Kind() == reflect.Array)):
+		for i := 0; dec.More(); i++ {
+			if err := checkFields(dec, data, t.Elem(), joinField(path, fmt.Sprint(i))); err != nil {
+				return err
+			}
+		}
+	default:
+		// Maps and anything else can hold whatever they like,
+		// and type mismatches are found by json.Unmarshal.
+		depth := 1
+		for depth > 0 {
+			tok, err := dec.Token()
+			if err != nil {
+				return newJSONError(data, dec.InputOffset(), path, "%s", err.Error())
+			}
+			if d, ok := tok.(json.Delim); ok {
+				if (d == '{') || (d == '[') {
+					depth++
+				} else {
+					depth--
+				}
+			}
+		}
+		return nil
+	}
+
+	// The closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return newJSONError(data, dec.InputOffset(), path, "%s", err.Error())
+	}
+	return nil
+}
+
+// jsonFields returns the fields of struct type t,
+// as encoding/json sees them.
+func jsonFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if name, _, _ := strings.Cut(tag, ","); name != "" {
+			field.Name = name
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// findField returns the field called name,
+// ignoring case, like encoding/json does.
+func findField(fields []reflect.StructField, name string) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// suggestField returns the field with the name closest to name,
+// or the empty string if none of them are close.
+func suggestField(fields []reflect.StructField, name string) string {
+	best := ""
+	bestDistance := 3 // Anything further away is probably not a typo
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	sort.Strings(names)
+	for _, candidate := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	if name == "" {
+		return path
+	}
+	return path + "." + name
+}
+
+// jsonTypeName describes t in JSON terms.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list of " + jsonTypeName(t.Elem())
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return t.String()
+}
@@ -0,0 +1,76 @@
+package transpile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStrictJSON(t *testing.T) {
+	cases := []struct {
+		json    string
+		field   string
+		line    int
+		column  int
+		message string
+	}{
+		{"{\"Answers\": [\"a\"],\n \"Anwsers\": []}", "", 2, 3, `unknown field "Anwsers" (did you mean "Answers"?)`},
+		{"{\"Parts\": [{\"Name\": \"a\"}, {\"Nmae\": \"b\"}]}", "Parts.1", 1, 29, `(did you mean "Name"?)`},
+		{"{\"Success\": {\"Mastery\": \"x\", \"Zebra\": 1}}", "Success", 1, 31, `unknown field "Zebra"`},
+		{"{\n  \"Authors\": \"Arthur\"\n}", "Authors", 2, 22, "expected list of string, got string"},
+		{"{\"PartialCredit\": \"yes\"}", "PartialCredit", 1, 24, "expected true or false, got string"},
+		{"{\"Body\": \"x\",\n}", "", 2, 1, "invalid character '}'"},
+		{"{\"Body\": \"x\"} {}", "", 1, 15, "after top-level value"},
+	}
+	for _, c := range cases {
+		var p Puzzle
+		err := DecodeStrictJSON([]byte(c.json), &p)
+		var jsonErr *JSONError
+		if !errors.As(err, &jsonErr) {
+			t.Errorf("%q: wrong error: %v", c.json, err)
+			continue
+		}
+		if (jsonErr.Field != c.field) || (jsonErr.Line != c.line) || (jsonErr.Column != c.column) {
+			t.Errorf("%q: wrong location: %v", c.json, err)
+		}
+		if !strings.Contains(jsonErr.Message, c.message) {
+			t.Errorf("%q: wrong message: %v", c.json, err)
+		}
+	}
+
+	var p Puzzle
+	if err := DecodeStrictJSON([]byte(`{"answers": ["a"], "Extra": {"Anything": [1, {"goes": true}]}}`), &p); err != nil {
+		t.Error(err)
+	} else if (len(p.Answers) != 1) || (p.Extra["Anything"] == nil) {
+		t.Error("Wrong puzzle", p)
+	}
+}
+
+// TestPuzzleSchema makes sure the published schema has every field in Puzzle.
+func TestPuzzleSchema(t *testing.T) {
+	buf, err := os.ReadFile("../../docs/puzzle.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := struct {
+		Properties map[string]json.RawMessage
+	}{}
+	if err := json.Unmarshal(buf, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := jsonFields(reflect.TypeOf(Puzzle{}))
+	for _, field := range fields {
+		if _, ok := schema.Properties[field.Name]; !ok {
+			t.Errorf("%s isn't in the schema", field.Name)
+		}
+	}
+	for name := range schema.Properties {
+		if _, ok := findField(fields, name); !ok {
+			t.Errorf("%s is in the schema, but not in Puzzle", name)
+		}
+	}
+}
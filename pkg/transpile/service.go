@@ -0,0 +1,60 @@
+package transpile
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// PuzzleService is a network service that goes with a puzzle,
+// like a server participants attack.
+type PuzzleService struct {
+	// Host and Port are where the service listens
+	Host string
+	Port int
+
+	// HealthCheck is a path to request over HTTP to see if the service is up.
+	// If it's empty, the service is up if it accepts TCP connections.
+	HealthCheck string `json:",omitempty"`
+
+	// Proxy asks the server to pass HTTP requests through to the service,
+	// for services participants can't reach directly.
+	Proxy bool `json:",omitempty"`
+}
+
+// Address returns the service's address, as host:port.
+func (s PuzzleService) Address() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// parseService parses an RFC822 "service" header: host:port.
+func parseService(txt string) (*PuzzleService, error) {
+	host, portstr, err := net.SplitHostPort(strings.TrimSpace(txt))
+	if err != nil {
+		return nil, fmt.Errorf("service: %w", err)
+	}
+	port, err := strconv.Atoi(portstr)
+	if err != nil {
+		return nil, fmt.Errorf("service: %w", err)
+	}
+	return &PuzzleService{Host: host, Port: port}, nil
+}
+
+// validateService makes sure a puzzle's service has somewhere to connect to.
+func (puzzle *Puzzle) validateService() error {
+	s := puzzle.Service
+	if s == nil {
+		return nil
+	}
+	if s.Host == "" {
+		return fmt.Errorf("service needs a host")
+	}
+	if (s.Port < 1) || (s.Port > 65535) {
+		return fmt.Errorf("service port must be between 1 and 65535")
+	}
+	if (s.HealthCheck != "") && !strings.HasPrefix(s.HealthCheck, "/") {
+		return fmt.Errorf("service health check must be a path starting with /")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleService(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\nservice:\n  host: 10.0.0.5\n  port: 8080\n  healthcheck: /health\n  proxy: true\n---\nAttack.\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("service: [::1]:22\n\nConnect.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nservice:\n  host: 10.0.0.5\n---\nNo port.\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("---\nservice:\n  host: 10.0.0.5\n  port: 80\n  healthcheck: health\n---\nBad path.\n"), 0644)
+	afero.WriteFile(fs, "5/puzzle.md", []byte("service: 10.0.0.5\n\nNo port.\n"), 0644)
+
+	puzzle, err := NewFsPuzzlePoints(fs, 1).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PuzzleService{Host: "10.0.0.5", Port: 8080, HealthCheck: "/health", Proxy: true}
+	if (puzzle.Service == nil) || (*puzzle.Service != want) {
+		t.Error("Wrong service:", puzzle.Service)
+	}
+
+	puzzle, err = NewFsPuzzlePoints(fs, 2).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (puzzle.Service == nil) || (puzzle.Service.Address() != "[::1]:22") {
+		t.Error("Wrong service:", puzzle.Service)
+	}
+
+	for _, points := range []int{3, 4, 5} {
+		if _, err := NewFsPuzzlePoints(fs, points).Puzzle(); err == nil {
+			t.Error("Puzzle", points, "should have been refused")
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package transpile
+
+import (
+	"bytes"
+	"slices"
+)
+
+// SolutionSource is the Markdown file a puzzle's official solution is written in.
+const SolutionSource = "solution.md"
+
+// SolutionFile is the file a puzzle's solution is compiled to.
+// Servers withhold it until the solution is released.
+const SolutionFile = "solution.html"
+
+// HasSolution returns true if the puzzle comes with a solution,
+// either compiled from solution.md, or attached as solution.html.
+func (puzzle *Puzzle) HasSolution() bool {
+	return puzzle.Solution || slices.Contains(puzzle.Attachments, SolutionFile)
+}
+
+// hasSolution returns true if the puzzle directory has a solution.md.
+func (fp FsPuzzle) hasSolution() bool {
+	_, err := fp.fs.Stat(SolutionSource)
+	return err == nil
+}
+
+// solution renders solution.md as HTML.
+func (fp FsPuzzle) solution() (ReadSeekCloser, error) {
+	src, err := fp.fs.Open(SolutionSource)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	html := new(bytes.Buffer)
+	if err := Markdown(src, html); err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(html.Bytes())}, nil
+}
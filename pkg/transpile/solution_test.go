@@ -0,0 +1,59 @@
+package transpile
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/zipfs"
+)
+
+func TestSolution(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers: [a]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/1/solution.md", []byte("Type *a*.\n"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("---\nanswers: [a]\n---\nHi.\n"), 0644)
+
+	c := NewFsCategory(fs, "cat")
+	if p, err := c.Puzzle(1); err != nil {
+		t.Fatal(err)
+	} else if !p.Solution || !p.HasSolution() {
+		t.Error("Solution not found")
+	}
+	if p, err := c.Puzzle(2); err != nil {
+		t.Fatal(err)
+	} else if p.Solution || p.HasSolution() {
+		t.Error("Solution found where there isn't one")
+	}
+
+	if r, err := c.Open(1, SolutionFile); err != nil {
+		t.Error(err)
+	} else {
+		buf, _ := io.ReadAll(r)
+		r.Close()
+		if !strings.Contains(string(buf), "<em>a</em>") {
+			t.Errorf("Wrong solution: %q", buf)
+		}
+	}
+
+	mb := new(bytes.Buffer)
+	if err := Mothball(c, mb, ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+	mbr, err := zip.NewReader(bytes.NewReader(mb.Bytes()), int64(mb.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zfs := zipfs.New(mbr)
+	if buf, err := afero.ReadFile(zfs, "1/solution.html"); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(buf), "<em>a</em>") {
+		t.Errorf("Wrong solution in mothball: %q", buf)
+	}
+	if _, err := afero.ReadFile(zfs, "2/solution.html"); err == nil {
+		t.Error("Solution in mothball where there isn't one")
+	}
+}
@@ -0,0 +1,322 @@
+package transpile
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/afero"
+)
+
+// staticSiteCategory is a category on the index page of a static site.
+type staticSiteCategory struct {
+	Name   string
+	Points []int
+}
+
+// staticSiteCheck is what a static site's puzzle page needs to check answers.
+// Groups are the hashes of the whole puzzle's answers, named "",
+// then those of each part or tier.
+type staticSiteCheck struct {
+	ID         string
+	Salt       string
+	Iterations int
+	Groups     []staticSiteGroup
+	AllParts   bool
+}
+
+// staticSiteGroup is the answer hashes of a puzzle, or of one part or tier of it.
+type staticSiteGroup struct {
+	Name   string
+	Hashes []string
+}
+
+// WriteStaticSite writes every puzzle in categories, by name, to dst
+// as a web site that needs no server:
+// an index.html listing every puzzle,
+// and for each, CATEGORY/POINTS/index.html and its attachments.
+//
+// Puzzles are stripped to what profile keeps.
+// Answers are checked by the browser against the puzzle's answer hashes,
+// and progress is kept in the browser's local storage.
+// Puzzles without answer hashes,
+// like those using a checker other than exact,
+// can be read but not answered.
+func WriteStaticSite(dst afero.Fs, title string, categories map[string]Category, profile BuildProfile) error {
+	index := []staticSiteCategory{}
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := categories[name]
+		inv, err := c.Inventory()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		sort.Ints(inv)
+		index = append(index, staticSiteCategory{Name: name, Points: inv})
+
+		for _, points := range inv {
+			if err := writeStaticSitePuzzle(dst, title, name, c, points, profile); err != nil {
+				return fmt.Errorf("%s %d: %w", name, points, err)
+			}
+		}
+	}
+
+	f, err := dst.Create("index.html")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return staticSiteIndexTemplate.Execute(f, struct {
+		Title      string
+		Categories []staticSiteCategory
+		Script     template.JS
+	}{
+		Title:      title,
+		Categories: index,
+		Script:     staticSiteScript,
+	})
+}
+
+// writeStaticSitePuzzle writes the page and attachments of one puzzle.
+func writeStaticSitePuzzle(dst afero.Fs, title string, category string, c Category, points int, profile BuildProfile) error {
+	p, err := c.Puzzle(points)
+	if err != nil {
+		return err
+	}
+	profile.Strip(&p)
+
+	dir := path.Join(category, strconv.Itoa(points))
+	if err := dst.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, filename := range append(p.Attachments, p.Scripts...) {
+		if err := exportCopy(c, points, filename, dst, path.Join(dir, filename)); err != nil {
+			return err
+		}
+	}
+
+	check := staticSiteCheck{
+		ID:         category + "/" + strconv.Itoa(points),
+		Salt:       p.AnswerSalt,
+		Iterations: p.AnswerHashIterations,
+		Groups:     []staticSiteGroup{},
+		AllParts:   len(p.Parts) > 0,
+	}
+	groups := []staticSiteGroup{{Name: "", Hashes: p.AnswerHashes}}
+	for _, part := range p.Parts {
+		groups = append(groups, staticSiteGroup{Name: part.Name, Hashes: part.AnswerHashes})
+	}
+	for _, tier := range p.Tiers {
+		groups = append(groups, staticSiteGroup{Name: tier.Name, Hashes: tier.AnswerHashes})
+	}
+	for _, group := range groups {
+		if len(group.Hashes) > 0 {
+			check.Groups = append(check.Groups, group)
+		}
+	}
+
+	f, err := dst.Create(path.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return staticSitePuzzleTemplate.Execute(f, struct {
+		Title    string
+		Category string
+		Points   int
+		Puzzle   Puzzle
+		Body     template.HTML
+		Check    staticSiteCheck
+		Script   template.JS
+	}{
+		Title:    title,
+		Category: category,
+		Points:   points,
+		Puzzle:   p,
+		Body:     template.HTML(p.Body),
+		Check:    check,
+		Script:   staticSiteScript,
+	})
+}
+
+// staticSiteStyle is the style sheet of every page in a static site.
+const staticSiteStyle = `
+      body { font-family: sans-serif; max-width: 50em; margin: auto; padding: 1em; background: #222; color: #eee; }
+      a { color: #b9cbd8; }
+      .solved { color: #8f8; }
+      .solved::after { content: " ✓"; }
+      .correct { color: #8f8; }
+      .incorrect { color: #f88; }
+      main img { max-width: 100%; }
+`
+
+// staticSiteScript keeps progress in local storage, and checks answers.
+// It's a classic script, not a module,
+// since browsers won't load modules from file: URLs.
+const staticSiteScript template.JS = `
+const storageKey = "moth-static:" + document.body.dataset.site
+
+function progress() {
+  return JSON.parse(localStorage.getItem(storageKey) || "{}")
+}
+
+function saveProgress(id, parts) {
+  const p = progress()
+  p[id] = parts
+  localStorage.setItem(storageKey, JSON.stringify(p))
+}
+
+function isSolved(check, parts) {
+  if (check.AllParts) {
+    return check.Groups.every(g => parts.includes(g.Name))
+  }
+  return parts.length > 0
+}
+
+// answerHash returns the whole hash of answer: puzzles have the first few hexits
+async function answerHash(answer, salt, iterations) {
+  const encoder = new TextEncoder()
+  const key = await crypto.subtle.importKey("raw", encoder.encode(answer), "PBKDF2", false, ["deriveBits"])
+  const params = {name: "PBKDF2", hash: "SHA-256", salt: encoder.encode(salt), iterations: iterations}
+  const bits = await crypto.subtle.deriveBits(params, key, 256)
+  return Array.from(new Uint8Array(bits)).map(b => b.toString(16).padStart(2, "0")).join("")
+}
+
+function showSolved(check, parts) {
+  const status = document.querySelector("#status")
+  if (isSolved(check, parts)) {
+    status.textContent = "Solved"
+    status.className = "solved"
+  } else if (parts.length > 0) {
+    status.textContent = "Solved: " + parts.join(", ")
+  }
+}
+
+function init() {
+  const p = progress()
+  for (const a of document.querySelectorAll("a[data-id]")) {
+    if (p[a.dataset.id] && (p[a.dataset.id].length > 0)) {
+      a.classList.add("solved")
+    }
+  }
+
+  const form = document.querySelector("form.answer")
+  if (!form) {
+    return
+  }
+  const check = JSON.parse(document.querySelector("#check").textContent)
+  showSolved(check, p[check.ID] || [])
+  form.addEventListener("submit", async event => {
+    event.preventDefault()
+    const result = form.querySelector(".result")
+    const hash = await answerHash(form.answer.value, check.Salt, check.Iterations)
+    const parts = progress()[check.ID] || []
+    let correct = false
+    for (const group of check.Groups) {
+      if (group.Hashes.some(h => hash.startsWith(h))) {
+        correct = true
+        if (!parts.includes(group.Name)) {
+          parts.push(group.Name)
+        }
+      }
+    }
+    if (correct) {
+      saveProgress(check.ID, parts)
+      result.textContent = "Correct!"
+      result.className = "result correct"
+      form.answer.value = ""
+    } else {
+      result.textContent = "Incorrect"
+      result.className = "result incorrect"
+    }
+    showSolved(check, parts)
+  })
+}
+
+init()
+`
+
+var staticSiteIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>{{.Title}}</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width">
+    <style>` + staticSiteStyle + `    </style>
+  </head>
+  <body data-site="{{.Title}}">
+    <h1>{{.Title}}</h1>
+    {{- range .Categories}}
+    <h2>{{.Name}}</h2>
+    <ul>
+      {{- $category := .Name}}
+      {{- range .Points}}
+      <li><a href="{{$category}}/{{.}}/index.html" data-id="{{$category}}/{{.}}">{{$category}} {{.}}</a></li>
+      {{- end}}
+    </ul>
+    {{- end}}
+    <script>{{.Script}}</script>
+  </body>
+</html>
+`))
+
+var staticSitePuzzleTemplate = template.Must(template.New("puzzle").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>{{.Category}} {{.Points}}</title>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width">
+    <style>` + staticSiteStyle + `    </style>
+    {{- range .Puzzle.Scripts}}
+    <script src="{{.}}"></script>
+    {{- end}}
+  </head>
+  <body data-site="{{.Title}}">
+    <p><a href="../../index.html">{{.Title}}</a></p>
+    <h1>{{.Category}} {{.Points}}</h1>
+    <p id="status"></p>
+    <main>
+{{.Body}}
+    </main>
+    {{- if .Puzzle.Attachments}}
+    <h2>Files</h2>
+    <ul>
+      {{- range .Puzzle.Attachments}}
+      <li><a href="{{.}}" download>{{.}}</a></li>
+      {{- end}}
+    </ul>
+    {{- end}}
+    {{- if .Puzzle.Debug.Hints}}
+    <details>
+      <summary>Hints</summary>
+      <ul>
+        {{- range .Puzzle.Debug.Hints}}
+        <li>{{.}}</li>
+        {{- end}}
+      </ul>
+    </details>
+    {{- end}}
+    {{- if .Check.Groups}}
+    <form class="answer">
+      <label>Answer: <input type="text" name="answer" autocomplete="off"></label>
+      <input type="submit" value="Check">
+      <span class="result"></span>
+    </form>
+    <script type="application/json" id="check">{{.Check}}</script>
+    {{- else}}
+    <p>Answers to this puzzle can't be checked here.</p>
+    {{- end}}
+    {{- if .Puzzle.Authors}}
+    <p>Puzzle by {{range $i, $a := .Puzzle.Authors}}{{if $i}}, {{end}}{{$a}}{{end}}</p>
+    {{- end}}
+    <script>{{.Script}}</script>
+  </body>
+</html>
+`))
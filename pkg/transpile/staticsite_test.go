@@ -0,0 +1,67 @@
+package transpile
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestWriteStaticSite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - moo\nattachments:\n  - cow.txt\ndebug:\n  hints:\n    - Cows say it\n---\nWhat do *cows* say?\n"), 0644)
+	afero.WriteFile(fs, "cat/1/cow.txt", []byte("moo"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("---\nanswers:\n  - m+o+\nchecker: regex\n---\nSay it again\n"), 0644)
+
+	dst := afero.NewMemMapFs()
+	categories := map[string]Category{"cat": NewFsCategory(fs, "cat")}
+	if err := WriteStaticSite(dst, "Cows & Moths", categories, ProductionProfile); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := afero.ReadFile(dst, "index.html"); err != nil {
+		t.Error(err)
+	} else if !strings.Contains(string(buf), `<a href="cat/2/index.html" data-id="cat/2">`) || !strings.Contains(string(buf), "Cows &amp; Moths") {
+		t.Error("Wrong index:", string(buf))
+	}
+
+	buf, err := afero.ReadFile(dst, "cat/1/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(buf)
+	for _, want := range []string{
+		"<p>What do <em>cows</em> say?</p>",
+		`<a href="cow.txt" download>cow.txt</a>`,
+		`<form class="answer">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Missing %q in page: %s", want, page)
+		}
+	}
+	_, checkJSON, _ := strings.Cut(page, `<script type="application/json" id="check">`)
+	checkJSON, _, _ = strings.Cut(checkJSON, "</script>")
+	check := staticSiteCheck{}
+	if err := json.Unmarshal([]byte(checkJSON), &check); err != nil {
+		t.Error(err)
+	} else if (len(check.Groups) != 1) || (check.Groups[0].Hashes[0] != AnswerHash("moo", check.Salt, check.Iterations)) {
+		t.Error("Wrong answer check:", check)
+	}
+	if strings.Contains(page, "Cows say it") || strings.Contains(page, "moo<") {
+		t.Error("Spoilers in production page:", page)
+	}
+	if _, err := dst.Stat("cat/1/cow.txt"); err != nil {
+		t.Error(err)
+	}
+
+	if buf, err := afero.ReadFile(dst, "cat/2/index.html"); err != nil {
+		t.Error(err)
+	} else if strings.Contains(string(buf), "<form") {
+		t.Error("Regex puzzle can be answered:", string(buf))
+	}
+
+	if err := WriteStaticSite(afero.NewMemMapFs(), "Cows", categories, StagingProfile); err != nil {
+		t.Fatal(err)
+	}
+}
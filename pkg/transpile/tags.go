@@ -0,0 +1,71 @@
+package transpile
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// validateTags makes every tag lower case, without surrounding spaces,
+// and makes sure none are empty or have commas,
+// so tags can be given as a comma-separated list.
+func (puzzle *Puzzle) validateTags() error {
+	tags := make([]string, 0, len(puzzle.Tags))
+	for _, tag := range puzzle.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return fmt.Errorf("empty tag")
+		}
+		if strings.Contains(tag, ",") {
+			return fmt.Errorf("tag %q has a comma", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 {
+		puzzle.Tags = tags
+	}
+	return nil
+}
+
+// HasTag returns true if the puzzle is tagged with any of tags.
+func (puzzle *Puzzle) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if slices.Contains(puzzle.Tags, strings.ToLower(strings.TrimSpace(tag))) {
+			return true
+		}
+	}
+	return false
+}
+
+// TaggedCategory is a Category with only the puzzles tagged with any of Tags.
+type TaggedCategory struct {
+	Category
+	Tags []string
+}
+
+// NewTaggedCategory returns the puzzles in c tagged with any of tags.
+func NewTaggedCategory(c Category, tags []string) TaggedCategory {
+	return TaggedCategory{
+		Category: c,
+		Tags:     tags,
+	}
+}
+
+// Inventory lists every puzzle in the category with one of the tags.
+// Puzzles that can't be read are left in,
+// so whatever uses them finds out what's wrong.
+func (tc TaggedCategory) Inventory() ([]int, error) {
+	inv, err := tc.Category.Inventory()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]int, 0, len(inv))
+	for _, points := range inv {
+		if p, err := tc.Category.Puzzle(points); (err != nil) || p.HasTag(tc.Tags...) {
+			ret = append(ret, points)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,50 @@
+package transpile
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestPuzzleTags(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers: [a]\ntags: [Forensics, \" beginner \", forensics]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("answer: a\ntag: crypto\ntag: Beginner\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "cat/3/puzzle.md", []byte("answer: a\n\nHi.\n"), 0644)
+	afero.WriteFile(fs, "bad/1/puzzle.md", []byte("---\nanswers: [a]\ntags: [\"a, b\"]\n---\nHi.\n"), 0644)
+	afero.WriteFile(fs, "bad/2/puzzle.md", []byte("---\nanswers: [a]\ntags: [\" \"]\n---\nHi.\n"), 0644)
+
+	c := NewFsCategory(fs, "cat")
+	p, err := c.Puzzle(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Tags) != 2) || (p.Tags[0] != "forensics") || (p.Tags[1] != "beginner") {
+		t.Error("Wrong tags:", p.Tags)
+	}
+	if !p.HasTag("crypto", "Forensics") || p.HasTag("crypto") {
+		t.Error("HasTag is wrong")
+	}
+	if p, err := c.Puzzle(2); err != nil {
+		t.Error(err)
+	} else if (len(p.Tags) != 2) || (p.Tags[1] != "beginner") {
+		t.Error("Wrong tags:", p.Tags)
+	}
+
+	if inv, err := NewTaggedCategory(c, []string{"beginner"}).Inventory(); err != nil {
+		t.Error(err)
+	} else if len(inv) != 2 {
+		t.Error("Wrong inventory:", inv)
+	}
+	if inv, err := NewTaggedCategory(c, []string{"crypto"}).Inventory(); err != nil {
+		t.Error(err)
+	} else if (len(inv) != 1) || (inv[0] != 2) {
+		t.Error("Wrong inventory:", inv)
+	}
+
+	for _, points := range []int{1, 2} {
+		if _, err := NewFsCategory(fs, "bad").Puzzle(points); err == nil {
+			t.Errorf("Bad tag %d accepted", points)
+		}
+	}
+}
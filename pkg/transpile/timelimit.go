@@ -0,0 +1,47 @@
+package transpile
+
+import (
+	"fmt"
+	"time"
+)
+
+// validateTiming makes sure the time limit, bonus, and penalty make sense.
+func (puzzle *Puzzle) validateTiming() error {
+	if puzzle.TimeLimit < 0 {
+		return fmt.Errorf("time limit can't be negative")
+	}
+	if puzzle.SpeedBonus < 0 {
+		return fmt.Errorf("speed bonus can't be negative")
+	}
+	if (puzzle.LatePenalty < 0) || (puzzle.LatePenalty > 1) {
+		return fmt.Errorf("late penalty must be between 0 and 1")
+	}
+	if (puzzle.TimeLimit == 0) && ((puzzle.SpeedBonus != 0) || (puzzle.LatePenalty != 0) || puzzle.Decay) {
+		return fmt.Errorf("speed bonus, late penalty, and decay need a time limit")
+	}
+	return nil
+}
+
+// TimeFactor returns what to multiply the score by,
+// for a puzzle solved elapsed after it was first loaded.
+//
+// Within TimeLimit, this is 1 plus SpeedBonus.
+// After it, this is 1 minus LatePenalty.
+// With Decay, it goes steadily from one to the other over TimeLimit.
+func (puzzle *Puzzle) TimeFactor(elapsed time.Duration) float64 {
+	if puzzle.TimeLimit <= 0 {
+		return 1
+	}
+	limit := time.Duration(puzzle.TimeLimit) * time.Second
+	if elapsed > limit {
+		return 1 - puzzle.LatePenalty
+	}
+	if !puzzle.Decay {
+		return 1 + puzzle.SpeedBonus
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	left := float64(limit-elapsed) / float64(limit)
+	return (1 - puzzle.LatePenalty) + (puzzle.SpeedBonus+puzzle.LatePenalty)*left
+}
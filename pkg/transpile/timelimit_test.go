@@ -0,0 +1,50 @@
+package transpile
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestTimeFactor(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\ntimelimit: 600\nspeedbonus: 0.5\nlatepenalty: 0.25\n---\nHurry.\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("timelimit: 600\nspeedbonus: 0.5\nlatepenalty: 0.25\ndecay: true\n\nHurry.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nspeedbonus: 0.5\n---\nNo limit.\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("---\ntimelimit: 600\nlatepenalty: 2\n---\nToo harsh.\n"), 0644)
+
+	cases := []struct {
+		points  int
+		elapsed time.Duration
+		factor  float64
+	}{
+		{1, 0, 1.5},
+		{1, 10 * time.Minute, 1.5},
+		{1, 11 * time.Minute, 0.75},
+		{2, 0, 1.5},
+		{2, 5 * time.Minute, 1.125},
+		{2, 10 * time.Minute, 0.75},
+		{2, time.Hour, 0.75},
+	}
+	for _, c := range cases {
+		puzzle, err := NewFsPuzzlePoints(fs, c.points).Puzzle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if factor := puzzle.TimeFactor(c.elapsed); math.Abs(factor-c.factor) > 0.0001 {
+			t.Errorf("Puzzle %d after %v: got %v, wanted %v", c.points, c.elapsed, factor, c.factor)
+		}
+	}
+
+	for _, points := range []int{3, 4} {
+		if _, err := NewFsPuzzlePoints(fs, points).Puzzle(); err == nil {
+			t.Errorf("Puzzle %d should be an error", points)
+		}
+	}
+
+	if factor := (&Puzzle{}).TimeFactor(time.Hour); factor != 1 {
+		t.Error("Puzzle with no time limit changed score:", factor)
+	}
+}
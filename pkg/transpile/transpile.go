@@ -0,0 +1,85 @@
+// Package transpile turns puzzle sources into mothballs.
+//
+// ParsePuzzle, RenderBody, and BuildMothball are the stable entry points,
+// for CI systems and other tools that want to check or build puzzles
+// without running the transpile command.
+// The rest of the package is what they're built from,
+// and may change between minor releases.
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ParsePuzzle reads the puzzle in the root of fs:
+// puzzle.md, puzzle.moth, or an mkpuzzle program,
+// and its attachments.
+//
+// The returned Puzzle has every spoiler in it:
+// use a BuildProfile to strip them.
+func ParsePuzzle(fs afero.Fs) (Puzzle, error) {
+	return NewFsPuzzle(fs).Puzzle()
+}
+
+// RenderBody renders Markdown as a puzzle body,
+// the same way puzzle.md bodies are rendered.
+func RenderBody(markdown string) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := Markdown(strings.NewReader(markdown), buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// BuildOptions change how BuildMothball builds a mothball.
+type BuildOptions struct {
+	// Profile says which spoilers to leave in.
+	// The zero value leaves them all out, like ProductionProfile, but is named "".
+	Profile BuildProfile
+
+	// Strict refuses to build a category with lint errors.
+	// Warnings don't count.
+	Strict bool
+}
+
+// LintError is returned by BuildMothball in strict mode,
+// when lint found errors in a category.
+type LintError struct {
+	Problems []LintProblem
+}
+
+func (e *LintError) Error() string {
+	errors := 0
+	for _, p := range e.Problems {
+		if !p.Warning {
+			errors++
+		}
+	}
+	return fmt.Sprintf("%d problems found", errors)
+}
+
+// BuildMothball lints c, then writes it to w as a mothball.
+//
+// Every problem lint found is returned, errors and warnings alike,
+// so the caller can report them.
+// In strict mode, errors stop the build with a *LintError,
+// before anything is written.
+func BuildMothball(c Category, w io.Writer, opts BuildOptions) ([]LintProblem, error) {
+	problems, err := Lint(c)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Strict {
+		for _, p := range problems {
+			if !p.Warning {
+				return problems, &LintError{Problems: problems}
+			}
+		}
+	}
+	return problems, Mothball(c, w, opts.Profile)
+}
@@ -0,0 +1,73 @@
+package transpile
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParsePuzzle(t *testing.T) {
+	fs := afero.NewBasePathFs(newTestFs(), "cat0/1")
+	p, err := ParsePuzzle(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(p.Answers) != 1) || (p.Answers[0] != "YAML answer") {
+		t.Error("Wrong answers:", p.Answers)
+	}
+	if !strings.Contains(p.Body, "YAML body") {
+		t.Error("Wrong body:", p.Body)
+	}
+	if _, err := ParsePuzzle(afero.NewMemMapFs()); err == nil {
+		t.Error("Parsed a puzzle from nothing")
+	}
+}
+
+func TestRenderBody(t *testing.T) {
+	body, err := RenderBody("*moo*\n\none | two\n--- | ---\n1 | 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "<em>moo</em>") || !strings.Contains(body, "<table>") {
+		t.Error("Wrong body:", body)
+	}
+}
+
+func TestBuildMothball(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "cat/1/puzzle.md", []byte("---\nanswers:\n  - tangerine\n---\nbody\n"), 0644)
+	afero.WriteFile(fs, "cat/2/puzzle.md", []byte("---\nanswers:\n  - tangerine\n  - ox\n---\nbody\n"), 0644)
+	c := NewFsCategory(fs, "cat")
+
+	buf := new(bytes.Buffer)
+	problems, err := BuildMothball(c, buf, BuildOptions{Profile: ProductionProfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 3 {
+		t.Error("Wrong problems:", problems)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zr.Open("2/puzzle.json"); err != nil {
+		t.Error("Puzzle missing from mothball:", err)
+	}
+
+	buf.Reset()
+	problems, err = BuildMothball(c, buf, BuildOptions{Profile: ProductionProfile, Strict: true})
+	var lintErr *LintError
+	if !errors.As(err, &lintErr) || (len(lintErr.Problems) != len(problems)) {
+		t.Error("Wrong error building strictly:", err)
+	} else if err.Error() != "2 problems found" {
+		t.Error("Wrong error message:", err)
+	}
+	if buf.Len() > 0 {
+		t.Error("Mothball written despite lint errors")
+	}
+}
@@ -0,0 +1,132 @@
+package transpile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UploadChecker is the name of the answer checker used by puzzles
+// that are answered by uploading a file.
+const UploadChecker = "upload"
+
+// UploadDirPrefix starts the name of every directory an upload is checked in.
+const UploadDirPrefix = "moth-upload-"
+
+// ErrUploadCheckerDisabled means a puzzle is answered by uploading a file,
+// but this server doesn't run upload checker commands.
+var ErrUploadCheckerDisabled = errors.New("upload checker: checker commands aren't run here")
+
+// UploadCommandChecker runs the first answer as a command,
+// to check an uploaded file.
+//
+// The submission is the path of the uploaded file,
+// which is given to the command as its only argument.
+// The file is correct if the command exits successfully.
+//
+// Like CommandChecker, the command is one of the puzzle's own files,
+// copied into a new temporary directory.
+// It runs in the directory holding the upload,
+// with almost nothing in its environment.
+type UploadCommandChecker struct {
+	// Enabled must be set for anything to run:
+	// whoever can change a puzzle can run anything they like,
+	// as whoever runs the checker.
+	Enabled bool
+
+	Timeout time.Duration
+
+	// Sandbox, if set, is a command and its arguments
+	// which the checker command is run under,
+	// like bwrap or nsjail.
+	Sandbox []string
+}
+
+// Check always returns an error:
+// the command is in the puzzle's files, so CheckFiles is needed.
+func (c UploadCommandChecker) Check(answers []string, submitted string) (bool, error) {
+	return false, fmt.Errorf("upload checker: the puzzle's files are needed")
+}
+
+// CheckFiles runs the command.
+func (c UploadCommandChecker) CheckFiles(open PuzzleFiles, answers []string, submitted string) (bool, error) {
+	if !c.Enabled {
+		return false, ErrUploadCheckerDisabled
+	}
+	if len(answers) == 0 {
+		return false, fmt.Errorf("upload checker: no command given")
+	}
+	name := answers[0]
+	if !filepath.IsLocal(name) {
+		return false, fmt.Errorf("upload checker: %s is not one of the puzzle's files", name)
+	}
+
+	// Anything but an upload made by the server could be any file on it
+	dir := filepath.Dir(submitted)
+	if !filepath.IsAbs(submitted) || !strings.HasPrefix(filepath.Base(dir), UploadDirPrefix) {
+		return false, fmt.Errorf("upload checker: %s is not an upload", submitted)
+	}
+	if fi, err := os.Lstat(submitted); err != nil {
+		return false, err
+	} else if !fi.Mode().IsRegular() {
+		return false, fmt.Errorf("upload checker: %s is not a regular file", submitted)
+	}
+
+	commandDir, err := os.MkdirTemp("", CheckerDirPrefix)
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(commandDir)
+	path := filepath.Join(commandDir, filepath.Base(name))
+	if err := copyCommand(open, name, path); err != nil {
+		return false, fmt.Errorf("upload checker: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	args := append(append([]string{}, c.Sandbox...), path, submitted)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+	}
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// validateUpload makes sure an upload puzzle has a checker command,
+// and that only upload puzzles have an upload size.
+func (puzzle *Puzzle) validateUpload() error {
+	if puzzle.UploadMaxSize < 0 {
+		return fmt.Errorf("upload size can't be negative")
+	}
+	if puzzle.Checker != UploadChecker {
+		if puzzle.UploadMaxSize != 0 {
+			return fmt.Errorf("upload size needs the %s checker", UploadChecker)
+		}
+		return nil
+	}
+	if len(puzzle.Answers) == 0 {
+		return fmt.Errorf("upload puzzle needs a checker command in answers")
+	}
+	if !filepath.IsLocal(puzzle.Answers[0]) {
+		return fmt.Errorf("upload checker command %s must be one of the puzzle's files", puzzle.Answers[0])
+	}
+	if (len(puzzle.Parts) > 0) || (len(puzzle.Tiers) > 0) || (len(puzzle.Questions) > 0) {
+		return fmt.Errorf("upload puzzle can't have parts, tiers, or questions")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package transpile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestUploadPuzzle(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "1/puzzle.md", []byte("---\nchecker: upload\nanswers: [check-patch.sh]\nattachments: [check-patch.sh]\nuploadmaxsize: 4096\n---\nPatch it.\n"), 0644)
+	afero.WriteFile(fs, "1/check-patch.sh", []byte("#!/bin/sh\n"), 0644)
+	afero.WriteFile(fs, "2/puzzle.md", []byte("---\nchecker: upload\n---\nNo checker command.\n"), 0644)
+	afero.WriteFile(fs, "3/puzzle.md", []byte("---\nanswers: [flag]\nuploadmaxsize: 4096\n---\nNot an upload puzzle.\n"), 0644)
+	afero.WriteFile(fs, "4/puzzle.md", []byte("checker: upload\nanswer: check-patch.sh\nuploadmaxsize: -1\n\nNegative size.\n"), 0644)
+	afero.WriteFile(fs, "5/puzzle.md", []byte("---\nchecker: upload\nanswers: [/usr/local/bin/check-patch]\n---\nChecker command installed on the server.\n"), 0644)
+
+	puzzle, err := NewFsPuzzlePoints(fs, 1).Puzzle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puzzle.UploadMaxSize != 4096 {
+		t.Error("Wrong upload size:", puzzle.UploadMaxSize)
+	}
+	if len(puzzle.AnswerHashes) != 0 {
+		t.Error("Upload puzzle has answer hashes")
+	}
+	for _, points := range []int{2, 3, 4, 5} {
+		if _, err := NewFsPuzzlePoints(fs, points).Puzzle(); err == nil {
+			t.Error("Puzzle", points, "should have been refused")
+		}
+	}
+}
+
+func TestUploadCommandChecker(t *testing.T) {
+	files := map[string]string{
+		"check.sh": "#!/bin/sh\ngrep -q hello \"$1\"\n",
+	}
+	open := func(filename string) (io.ReadCloser, error) {
+		body, ok := files[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+
+	dir, err := os.MkdirTemp("", UploadDirPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	upload := filepath.Join(dir, "upload")
+	os.WriteFile(upload, []byte("hello"), 0644)
+	wrong := filepath.Join(dir, "wrong")
+	os.WriteFile(wrong, []byte("goodbye"), 0644)
+
+	disabled := UploadCommandChecker{Timeout: 2 * time.Second}
+	if _, err := disabled.CheckFiles(open, []string{"check.sh"}, upload); err != ErrUploadCheckerDisabled {
+		t.Error("Disabled checker ran a command:", err)
+	}
+
+	checker := UploadCommandChecker{Enabled: true, Timeout: 2 * time.Second}
+	if ok, err := checker.CheckFiles(open, []string{"check.sh"}, upload); err != nil || !ok {
+		t.Error("Upload refused:", ok, err)
+	}
+	if ok, err := checker.CheckFiles(open, []string{"check.sh"}, wrong); err != nil || ok {
+		t.Error("Upload accepted:", ok, err)
+	}
+	for _, command := range []string{"true", "/bin/true", "../check.sh"} {
+		if _, err := checker.CheckFiles(open, []string{command}, upload); err == nil {
+			t.Error("Ran a command that isn't one of the puzzle's files:", command)
+		}
+	}
+	if _, err := checker.Check([]string{"check.sh"}, upload); err == nil {
+		t.Error("Ran a command without the puzzle's files")
+	}
+	if ok, err := checker.CheckFiles(open, []string{"check.sh"}, "/etc/passwd"); err == nil || ok {
+		t.Error("File that isn't an upload checked:", ok, err)
+	}
+	if ok, err := checker.CheckFiles(open, []string{"check.sh"}, dir); err == nil || ok {
+		t.Error("Directory checked:", ok, err)
+	}
+
+	checker.Sandbox = []string{"sh", "-c", `test "$HOME" = "$PWD" && test "$(basename "$1")" = check.sh && exec "$@"`, "sandbox"}
+	if ok, err := checker.CheckFiles(open, []string{"check.sh"}, upload); err != nil || !ok {
+		t.Error("Upload refused in sandbox:", ok, err)
+	}
+}
@@ -4,6 +4,7 @@
 const Millisecond = 1
 const Second = Millisecond * 1000
 const Minute = Second * 60
+const Hour = Minute * 60
 
 /** URL to the top of this MOTH server */
 const BaseURL = new URL(".", location)
@@ -82,14 +83,42 @@ async function Config() {
     return obj
 }
 
+/**
+ * Replace the text of elements with translated strings.
+ *
+ * Elements with a data-i18n attribute have their text replaced
+ * with the string it names.
+ * Inputs with a data-i18n-value attribute have their value replaced.
+ * Anything without a translated string is left alone.
+ *
+ * @param {Element|Document} root Element containing everything to translate
+ * @param {Object.<string,string>} strings Translated strings, by name
+ */
+function Localize(root, strings) {
+    for (let e of root.querySelectorAll("[data-i18n]")) {
+        let s = strings[e.dataset.i18n]
+        if (s) {
+            e.textContent = s
+        }
+    }
+    for (let e of root.querySelectorAll("[data-i18n-value]")) {
+        let s = strings[e.dataset.i18nValue]
+        if (s) {
+            e.value = s
+        }
+    }
+}
+
 export {
     Millisecond,
     Second,
     Minute,
+    Hour,
     StateUpdateChannel,
     BaseURL,
     Toast,
     WhenDOMLoaded,
     StringTruthy,
     Config,
+    Localize,
 }
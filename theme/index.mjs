@@ -13,6 +13,12 @@ class App {
         for (let form of document.querySelectorAll("form.login")) {
             form.addEventListener("submit", event => this.handleLoginSubmit(event))
         }
+        for (let form of document.querySelectorAll("form.create-team")) {
+            form.addEventListener("submit", event => this.handleCreateTeamSubmit(event))
+        }
+        for (let form of document.querySelectorAll("form.join")) {
+            form.addEventListener("submit", event => this.handleJoinSubmit(event))
+        }
         for (let e of document.querySelectorAll(".logout")) {
             e.addEventListener("click", () => this.Logout())
         }
@@ -23,6 +29,7 @@ class App {
         })
 
         setInterval(() => this.UpdateState(), common.Minute/3)
+        setInterval(() => this.renderClocks(), common.Second)
         setInterval(() => this.UpdateConfig(), common.Minute* 5)
 
         this.UpdateConfig()
@@ -32,7 +39,7 @@ class App {
     handleLoginSubmit(event) {
         event.preventDefault()
         let f = new FormData(event.target)
-        this.Login(f.get("id"), f.get("name"))
+        this.Login(f.get("id"), f.get("name"), f.get("division"), f.get("email"))
     }
     
     /**
@@ -40,11 +47,16 @@ class App {
      * 
      * @param {string} teamID 
      * @param {string} teamName 
+     * @param {string} division
+     * @param {string} email
      */
-    async Login(teamID, teamName) {
+    async Login(teamID, teamName, division, email) {
         try {
-            await this.server.Login(teamID, teamName)
+            let data = await this.server.Login(teamID, teamName, division, email)
             common.Toast(`Logged in (team id = ${teamID})`)
+            for (let e of document.querySelectorAll(".recovery-codes")) {
+                this.renderRecoveryCodes(e, data.recovery_codes ?? [])
+            }
             this.UpdateState()
         }
         catch (error) {
@@ -52,12 +64,72 @@ class App {
         }
     }
 
+    handleCreateTeamSubmit(event) {
+        event.preventDefault()
+        let f = new FormData(event.target)
+        let captcha = f.get("captcha") || f.get("h-captcha-response") || f.get("g-recaptcha-response") || f.get("cf-turnstile-response")
+        this.CreateTeam(f.get("name"), f.get("division"), f.get("email"), captcha)
+    }
+
     /**
-     * Log out of the server by clearing the saved Team ID.
+     * Create a new team, and log in to it,
+     * unless its team ID was sent by email.
+     *
+     * @param {string} teamName
+     * @param {string} division
+     * @param {string} email
+     * @param {string} captcha
+     */
+    async CreateTeam(teamName, division, email, captcha) {
+        try {
+            let data = await this.server.CreateTeam(teamName, division, email, captcha)
+            if (data.team_id) {
+                common.Toast(`Team created (team id = ${data.team_id})`)
+            } else {
+                common.Toast(data.description)
+            }
+            for (let e of document.querySelectorAll(".recovery-codes")) {
+                this.renderRecoveryCodes(e, data.recovery_codes ?? [])
+            }
+            this.UpdateState()
+        }
+        catch (error) {
+            common.Toast(error)
+        }
+    }
+
+    handleJoinSubmit(event) {
+        event.preventDefault()
+        let f = new FormData(event.target)
+        this.Join(f.get("code"), f.get("name"))
+    }
+
+    /**
+     * Join a team as a member.
+     *
+     * The member token stands in for the team ID,
+     * so it's shown once, to be written down.
+     *
+     * @param {string} code
+     * @param {string} name
+     */
+    async Join(code, name) {
+        try {
+            let data = await this.server.Join(code, name)
+            common.Toast(`Joined (member token = ${data.member_token})`)
+            this.UpdateState()
+        }
+        catch (error) {
+            common.Toast(error)
+        }
+    }
+
+    /**
+     * Log out of the server, ending the session and clearing the saved Team ID.
      */
     async Logout() {
         try {
-            this.server.Reset()
+            await this.server.Logout()
             common.Toast("Logged out")
             this.UpdateState()
         }
@@ -98,9 +170,20 @@ class App {
             e.classList.toggle("hidden", tracking != displayIf)
         }
 
+        this.renderClocks()
+        this.localize()
         for (let e of document.querySelectorAll(".login")) {
             this.renderLogin(e, !this.server.LoggedIn())
         }
+        for (let e of document.querySelectorAll(".create-team")) {
+            this.renderLogin(e, !this.server.LoggedIn() && this.state.Config.OpenRegistration)
+            for (let input of e.querySelectorAll("input[name=email]")) {
+                input.required = this.state.Config.VerifyEmail
+            }
+        }
+        for (let e of document.querySelectorAll(".join")) {
+            e.classList.toggle("hidden", this.server.LoggedIn() || !this.state.Config.JoinCodes)
+        }
         for (let e of document.querySelectorAll(".puzzles")) {
             this.renderPuzzles(e, this.server.LoggedIn())
         }
@@ -113,13 +196,92 @@ class App {
         }
     }
 
+    /**
+     * Translate the page into the team's language,
+     * or if it hasn't picked one, the browser's.
+     */
+    async localize() {
+        let locale = this.state.Locale || navigator.language || this.state.Config.Locale
+        if (locale == this.locale) {
+            return
+        }
+        this.locale = locale
+        let strings = await this.server.GetTranslations(locale)
+        document.documentElement.lang = locale
+        common.Localize(document, strings)
+    }
+
+    /**
+     * Render countdown clocks.
+     *
+     * While the event is paused, the clock stands still.
+     */
+    renderClocks() {
+        if (!this.state) {
+            return
+        }
+        let until = this.state.Until
+        let now = this.state.Paused ? this.state.Fetched : new Date()
+        if (until && (until - now > 7 * 24 * common.Hour)) {
+            // Not worth counting down to: the default hours.txt ends in 2519
+            until = null
+        }
+        for (let e of document.querySelectorAll(".clock")) {
+            e.classList.toggle("hidden", !until && !this.state.Paused)
+            let text = ""
+            if (until && (until > now)) {
+                let secs = Math.floor((until - now) / common.Second)
+                let hms = [Math.floor(secs / 3600), Math.floor(secs / 60) % 60, secs % 60]
+                    .map(n => n.toString().padStart(2, "0"))
+                    .join(":")
+                text = `${this.state.Enabled ? "Time remaining" : "Starting in"}: ${hms}`
+            }
+            if (this.state.Paused) {
+                text = `Paused. ${text}`
+            }
+            e.textContent = text
+        }
+    }
+
     /**
      * Render a login box.
      * 
-     * Just toggles visibility, there's nothing dynamic in a login box.
+     * Toggles visibility, and offers a choice of divisions if there are any.
+     * Asks for an email address if the server can send email.
      */
     renderLogin(element, visible) {
         element.classList.toggle("hidden", !visible)
+        for (let e of element.querySelectorAll(".email")) {
+            e.classList.toggle("hidden", !this.state.Config.Email)
+        }
+        for (let e of element.querySelectorAll(".division")) {
+            e.classList.toggle("hidden", this.state.Divisions.length == 0)
+        }
+        for (let select of element.querySelectorAll("select[name=division]")) {
+            if (select.options.length == this.state.Divisions.length) {
+                continue
+            }
+            while (select.firstChild) select.firstChild.remove()
+            for (let division of this.state.Divisions) {
+                let option = select.appendChild(document.createElement("option"))
+                option.textContent = division
+            }
+        }
+    }
+
+    /**
+     * Render the recovery codes a team was given when it registered.
+     *
+     * These are only ever sent once, so they stay until the page is reloaded.
+     */
+    renderRecoveryCodes(element, codes) {
+        element.classList.toggle("hidden", codes.length == 0)
+        let list = element.querySelector("ul")
+        while (list.firstChild) list.firstChild.remove()
+        for (let code of codes) {
+            let li = list.appendChild(document.createElement("li"))
+            li.textContent = code
+        }
     }
 
     /**
@@ -137,6 +299,14 @@ class App {
             
             let h = pdiv.appendChild(document.createElement("h2"))
             h.textContent = cat
+
+            let multiplier = this.state.Multiplier(cat)
+            if (multiplier) {
+                let span = h.appendChild(document.createElement("span"))
+                span.classList.add("multiplier")
+                span.textContent = `×${multiplier.Multiplier}`
+                span.title = `Points ×${multiplier.Multiplier} until ${multiplier.End.toLocaleTimeString()}`
+            }
             
             // Extras if we're running a devel server
             if (this.state.DevelopmentMode()) {
@@ -161,6 +331,10 @@ class App {
 
                 if (this.config.PuzzleList?.TrackSolved) {
                     a.classList.toggle("solved", this.state.IsSolved(puzzle))
+                    let attempts = this.state.AttemptCount(puzzle)
+                    if (attempts > 0) {
+                        a.title = `${attempts} ${attempts == 1 ? "attempt" : "attempts"}`
+                    }
                 }
                 if (this.config.PuzzleList?.Titles) {
                     this.loadTitle(puzzle, i)
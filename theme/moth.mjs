@@ -64,6 +64,30 @@ class Hash {
         return hexits.slice(0, end)
     }
 
+    /**
+     * PBKDF2-HMAC-SHA256, but only the first 4 hexits (2 octets).
+     *
+     * Used since MOTH v4.7, with a per-puzzle salt.
+     *
+     * @param {string} buf Input
+     * @param {string} salt Salt provided with the puzzle
+     * @param {number} iterations Iteration count provided with the puzzle
+     * @returns {Promise.<string>}
+     */
+    static async pbkdf2_slice(buf, salt, iterations, end=4) {
+        const encoder = new TextEncoder()
+        const key = await crypto.subtle.importKey("raw", encoder.encode(buf), "PBKDF2", false, ["deriveBits"])
+        const params = {
+            name: "PBKDF2",
+            hash: "SHA-256",
+            salt: encoder.encode(salt),
+            iterations: iterations,
+        }
+        const bits = await crypto.subtle.deriveBits(params, key, 256)
+        const hexits = this.hexlify(Array.from(new Uint8Array(bits)))
+        return hexits.slice(0, end)
+    }
+
     /**
      * Hex-encode a byte array
      * 
@@ -93,7 +117,7 @@ class Hash {
  * A point award.
  */
 class Award {
-    constructor(when, teamid, category, points) {
+    constructor(when, teamid, category, points, part="", score=points, seq=0) {
         /** Unix epoch timestamp for this award 
          * @type {number}
         */
@@ -110,6 +134,20 @@ class Award {
          * @type {number}
          */
         this.Points = points
+        /** Part of a multi-part puzzle solved, or "" for the whole puzzle
+         * @type {string}
+         */
+        this.Part = part
+        /** Points this award adds to the team's score
+         * @type {number}
+         */
+        this.Score = score
+        /** Position of this award in the points log: it only ever goes up,
+         * so it orders awards made in the same second.
+         * 0 if the server didn't send one.
+         * @type {number}
+         */
+        this.Seq = seq
     }
 }
 
@@ -184,6 +222,12 @@ class Puzzle {
         this.Debug.Hints ||= []
         this.Debug.Log ||= []
         this.Extra ||= {}
+        this.Parts ||= []
+        this.Tiers ||= []
+        this.Questions ||= []
+        for (let part of [...this.Parts, ...this.Tiers]) {
+            part.AnswerHashes ||= []
+        }
 
         // Be ready to handle a future revision to the Puzzle structure
         this.Objective ||= this.Extra.Objective
@@ -201,6 +245,19 @@ class Puzzle {
         return this.server.GetContent(this.Category, this.Points, filename)
     }
 
+    /**
+     * List answer hashes for the whole puzzle, and every part or tier of it.
+     *
+     * @returns {string[]}
+     */
+    PossibleAnswerHashes() {
+        let hashes = [...this.AnswerHashes]
+        for (let part of [...this.Parts, ...this.Tiers]) {
+            hashes.push(...part.AnswerHashes)
+        }
+        return hashes
+    }
+
     /**
      * Check if a string is possibly correct.
      *
@@ -212,15 +269,22 @@ class Puzzle {
      * string's hash. We do this so that if you run a brute force attack against
      * the list of hashes, you have to write your own brute force program, and
      * you still have to pick through a lot of potentially correct answers when
-     * it's done.
+     * it's done. Hashes are salted and iterated, too, so that brute force
+     * program has to start from scratch for every puzzle, and runs slowly.
      *
      * @param {string} str User-submitted possible answer
      * @returns {Promise.<boolean>}
      */
     async IsPossiblyCorrect(str) {
-        let userAnswerHashes = await Hash.All(str)
+        let userAnswerHashes
+        if (this.AnswerSalt) {
+            userAnswerHashes = [await Hash.pbkdf2_slice(str, this.AnswerSalt, this.AnswerHashIterations)]
+        } else {
+            // Mothballs from before salted hashes
+            userAnswerHashes = await Hash.All(str)
+        }
 
-        for (let pah of this.AnswerHashes) {
+        for (let pah of this.PossibleAnswerHashes()) {
             for (let uah of userAnswerHashes) {
                 if (pah == uah) {
                     return true
@@ -242,13 +306,49 @@ class Puzzle {
     SubmitAnswer(proposed) {
         return this.server.SubmitAnswer(this.Category, this.Points, proposed)
     }
+
+    /**
+     * Is this puzzle answered by uploading a file?
+     *
+     * @returns {boolean}
+     */
+    IsUpload() {
+        return this.Checker == "upload"
+    }
+
+    /**
+     * Upload a file to answer this puzzle.
+     *
+     * @param {File} file File to upload
+     * @returns {Promise.<string>} Success message
+     */
+    SubmitUpload(file) {
+        return this.server.SubmitUpload(this.Category, this.Points, file)
+    }
 }
 
 /**
  * A snapshot of scores.
  */
 class Scores {
-    constructor() {
+    /**
+     * @param {string} scoring Scoring model: "relative" (the default) or "percentage"
+     * @param {Object.<string,number>} categoryPoints Points there are to be had in each category
+     */
+    constructor(scoring="relative", categoryPoints={}) {
+        /**
+         * Scoring model: "relative" divides points by the category leader's,
+         * "percentage" by the points there are to be had in the category
+         * @type {string}
+         */
+        this.Scoring = scoring
+
+        /**
+         * Points there are to be had in each category, for percentage scoring
+         * @type {Object.<string,number>}
+         */
+        this.CategoryPoints = categoryPoints
+
         /** 
          * Timestamp of this score snapshot
          * @type number 
@@ -304,7 +404,7 @@ class Scores {
         this.TeamIDs.add(award.TeamID)
 
         let teamPoints = (this.categoryTeamPoints[award.Category] ??= {})
-        let points = (teamPoints[award.TeamID] || 0) + award.Points
+        let points = (teamPoints[award.TeamID] || 0) + award.Score
         teamPoints[award.TeamID] = points
 
         let max = this.MaxPoints[award.Category] || 0
@@ -330,6 +430,14 @@ class Scores {
      * @param {string} teamID 
      */
     CyFiCategoryScore(category, teamID) {
+        if (this.Scoring == "percentage") {
+            let total = this.CategoryPoints[category]
+            if (!total) {
+                return 0
+            }
+            // Multipliers can push a team past the points there are to be had
+            return Math.min(this.GetPoints(category, teamID) / total, 1)
+        }
         return this.GetPoints(category, teamID) / this.MaxPoints[category]
     }
 
@@ -371,11 +479,63 @@ class State {
              * @type {boolean}
              */
             Devel: obj.Config.Devel,
+
+            /** Can teams give an email address when they register?
+             * @type {boolean}
+             */
+            Email: obj.Config.Email ?? false,
+
+            /** Can anybody create a team, without being given a team ID?
+             * @type {boolean}
+             */
+            OpenRegistration: obj.Config.OpenRegistration ?? false,
+
+            /** Can teams hand out join codes, so members log in with their own tokens?
+             * @type {boolean}
+             */
+            JoinCodes: obj.Config.JoinCodes ?? false,
+
+            /** Is a new team's ID only sent to its email address?
+             * @type {boolean}
+             */
+            VerifyEmail: obj.Config.VerifyEmail ?? false,
+
+            /** Site key for the CAPTCHA solved to create a team, if there is one
+             * @type {string}
+             */
+            CaptchaSiteKey: obj.Config.CaptchaSiteKey || "",
+
+            /** Does the server give out session cookies?
+             * @type {boolean}
+             */
+            Sessions: obj.Config.Sessions ?? false,
+
+            /** Scoring model: "relative" or "percentage"
+             * @type {string}
+             */
+            Scoring: obj.Config.Scoring || "relative",
+
+            /** Rule ordering teams with the same score:
+             * "last-solve", "attempts", "total-time", or "" for none
+             * @type {string}
+             */
+            TieBreak: obj.Config.TieBreak || "",
         }
 
         /** True if the server is in enabled state, or if  we don't know */
         this.Enabled = obj.Enabled ?? true
 
+        /** True if an administrator has paused the event */
+        this.Paused = obj.Paused ?? false
+
+        /** When the event is next enabled or disabled, if it's scheduled
+         * @type {Date|null}
+         */
+        this.Until = obj.Until ? new Date(obj.Until) : null
+
+        /** When this state was fetched */
+        this.Fetched = new Date()
+
         /** Map from Team ID to Team Name
          * @type {Object.<string,string>}
          */
@@ -389,7 +549,93 @@ class State {
         /** Log of points awarded
          * @type {Award[]}
          */
-        this.PointsLog = obj.PointsLog.map(entry => new Award(entry[0], entry[1], entry[2], entry[3]))
+        this.PointsLog = obj.PointsLog.map(entry => new Award(...entry))
+
+        /** Current and upcoming point multipliers
+         * @type {Object[]}
+         */
+        this.Multipliers = (obj.Multipliers ?? []).map(m => ({
+            Category: m.Category,
+            Multiplier: m.Multiplier,
+            Start: new Date(m.Start),
+            End: new Date(m.End),
+        }))
+
+        /** Divisions teams may be in
+         * @type {string[]}
+         */
+        this.Divisions = obj.Divisions ?? []
+
+        /** Map from Team ID to division, for teams in one
+         * @type {Object.<string,string>}
+         */
+        this.TeamDivisions = obj.TeamDivisions ?? {}
+
+        /** Patterns answers must match, by category;
+         * "*" applies to categories without their own
+         * @type {Object.<string,string>}
+         */
+        this.FlagFormats = obj.FlagFormats ?? {}
+
+        /** Language this team would like things in, if it has picked one
+         * @type {string}
+         */
+        this.Locale = obj.Locale ?? ""
+
+        /** Puzzles this team has solved, by category
+         * @type {Object.<string,number[]>}
+         */
+        this.Solved = obj.Solved ?? {}
+
+        /** How many answers this team has submitted for each puzzle,
+         * by category, then point value
+         * @type {Object.<string,Object.<number,number>>}
+         */
+        this.Attempts = obj.Attempts ?? {}
+
+        /** When this team first loaded each puzzle, in Unix seconds,
+         * by category, then point value
+         * @type {Object.<string,Object.<number,number>>}
+         */
+        this.Opened = obj.Opened ?? {}
+
+        /** Status of each unlocked puzzle's network service,
+         * by category, then point value
+         * @type {Object.<string,Object.<number,Object>>}
+         */
+        this.Services = obj.Services ?? {}
+
+        /** TCP port of each unlocked puzzle's listener,
+         * by category, then point value
+         * @type {Object.<string,Object.<number,number>>}
+         */
+        this.ListenerPorts = obj.ListenerPorts ?? {}
+
+        /** This team's labs, by category, then point value
+         * @type {Object.<string,Object.<number,Object>>}
+         */
+        this.Labs = obj.Labs ?? {}
+
+        /** Most points there are to be had in each category
+         * @type {Object.<string,number>}
+         */
+        this.MaxPoints = obj.MaxPoints ?? {}
+
+        /** Categories this team has solved every puzzle in
+         * @type {string[]}
+         */
+        this.Completed = obj.Completed ?? []
+
+        /** Map from Team ID to what orders it among teams with the same score,
+         * under Config.TieBreak: lowest goes first
+         * @type {Object.<string,number>}
+         */
+        this.TieBreaks = obj.TieBreaks ?? {}
+
+        /** Language of the theme's own strings
+         * @type {string}
+         */
+        this.Config.Locale = obj.Config.Locale ?? "en"
     }
 
     /**
@@ -419,6 +665,30 @@ class State {
         return !this.PointsByCategory[category].includes(0)
     }
 
+    /**
+     * Find the point multiplier in effect for a category.
+     *
+     * If several apply, the largest is returned.
+     *
+     * @param {string} category
+     * @param {Date} when Time to check, default now
+     * @returns {Object|undefined} Multiplier, or undefined if none apply
+     */
+    Multiplier(category, when=new Date()) {
+        let ret
+        for (let m of this.Multipliers) {
+            if (
+                ((m.Category == "*") || (m.Category == category))
+                && (m.Start <= when)
+                && (when < m.End)
+                && (!ret || (m.Multiplier > ret.Multiplier))
+            ) {
+                ret = m
+            }
+        }
+        return ret
+    }
+
     /**
      * Is the server in development mode?
      * 
@@ -463,11 +733,15 @@ class State {
      * @returns {boolean}
      */
     IsSolved(puzzle, teamID="self") {
+        if (teamID == "self") {
+            return this.Solved[puzzle.Category]?.includes(puzzle.Points) ?? false
+        }
         for (let award of this.PointsLog) {
             if (
                 (award.Category == puzzle.Category)
                 && (award.Points == puzzle.Points)
                 && (award.TeamID == teamID)
+                && !award.Part
             ) {
                 return true
             }
@@ -475,6 +749,108 @@ class State {
         return false
     }
 
+    /**
+     * Has this team solved every puzzle in a category?
+     *
+     * @param {string} category
+     * @returns {boolean}
+     */
+    IsCompleted(category) {
+        return this.Completed.includes(category)
+    }
+
+    /**
+     * What pattern must answers in a category match?
+     *
+     * Like an input's pattern attribute, it has to match the whole answer.
+     *
+     * @param {string} category
+     * @returns {string?} undefined if any answer will do
+     */
+    FlagFormat(category) {
+        return this.FlagFormats[category] ?? this.FlagFormats["*"]
+    }
+
+    /**
+     * How many answers has this team submitted for this puzzle?
+     *
+     * @param {Puzzle} puzzle
+     * @returns {number}
+     */
+    AttemptCount(puzzle) {
+        return this.Attempts[puzzle.Category]?.[puzzle.Points] ?? 0
+    }
+
+    /**
+     * Is this puzzle's network service up?
+     *
+     * @param {Puzzle} puzzle
+     * @returns {Object?} Status, with Up, Checked, and maybe Error; undefined if there's none
+     */
+    ServiceStatus(puzzle) {
+        return this.Services[puzzle.Category]?.[puzzle.Points]
+    }
+
+    /**
+     * Which TCP port is this puzzle's listener on?
+     *
+     * @param {Puzzle} puzzle
+     * @returns {number?} undefined if it doesn't have one
+     */
+    ListenerPort(puzzle) {
+        return this.ListenerPorts[puzzle.Category]?.[puzzle.Points]
+    }
+
+    /**
+     * What's become of this team's lab for this puzzle?
+     *
+     * @param {Puzzle} puzzle
+     * @returns {Object?} Lab, with Status, and maybe Address and Message; undefined if there's none
+     */
+    Lab(puzzle) {
+        return this.Labs[puzzle.Category]?.[puzzle.Points]
+    }
+
+    /**
+     * When did this team first load this puzzle?
+     *
+     * @param {Puzzle} puzzle
+     * @returns {Date?} undefined if it hasn't
+     */
+    OpenedAt(puzzle) {
+        let when = this.Opened[puzzle.Category]?.[puzzle.Points]
+        if (when === undefined) {
+            return undefined
+        }
+        return new Date(when * 1000)
+    }
+
+    /**
+     * Which parts of a multi-part puzzle, or tiers of a tiered puzzle,
+     * has this team solved?
+     *
+     * The part or tier that finally solves the puzzle isn't listed:
+     * it's recorded as solving the whole puzzle.
+     *
+     * @param {Puzzle} puzzle
+     * @param {string} teamID Team to check, default the logged-in team
+     * @returns {string[]} Names of solved parts
+     */
+    SolvedParts(puzzle, teamID="self") {
+        let parts = []
+        for (let award of this.PointsLog) {
+            if (
+                (award.Category == puzzle.Category)
+                && (award.Points == puzzle.Points)
+                && (award.TeamID == teamID)
+                && award.Part
+            ) {
+                parts.push(award.Part)
+            }
+        }
+        return parts
+    }
+
     /**
      * Replay scores.
      *
@@ -485,7 +861,7 @@ class State {
      * @yields {Scores} Snapshot at a point in time
      */
     * ScoresHistory() {
-        let scores = new Scores()
+        let scores = new Scores(this.Config.Scoring, this.MaxPoints)
         for (let award of this.PointsLog) {
             scores.Add(award)
             yield scores
@@ -529,13 +905,15 @@ class Server {
      * 
      * This always sends teamID.
      * If args is set, POST will be used instead of GET
+     * If args is a FormData, it's sent as multipart/form-data, which can include files.
      * 
      * @param {string} path Path to API endpoint
-     * @param {Object.<string,string>} args Key/Values to send in POST data
+     * @param {Object.<string,string>|FormData} args Key/Values to send in POST data
+     * @param {Object.<string,string>} headers Extra request headers
      * @returns {Promise.<Response>} Response
      */
-    fetch(path, args={}) {
-        let body = new URLSearchParams(args)
+    fetch(path, args={}, headers={}) {
+        let body = (args instanceof FormData) ? args : new URLSearchParams(args)
         if (this.TeamID && !body.has("id")) {
             body.set("id", this.TeamID)
         }
@@ -544,6 +922,7 @@ class Server {
         return fetch(url, {
             method: "POST",
             body,
+            headers,
             cache: "no-cache",
         })
     }
@@ -552,7 +931,7 @@ class Server {
      * Send a request to a JSend API endpoint.
      * 
      * @param {string} path Path to API endpoint
-     * @param {Object.<string,string>} args Key/Values to send in POST
+     * @param {Object.<string,string>|FormData} args Key/Values to send in POST
      * @returns {Promise.<Object>} JSend Data
      */
     async call(path, args={}) {
@@ -561,8 +940,11 @@ class Server {
         switch (obj.status) {
             case "success":
                 return obj.data
-            case "fail":
-                throw new Error(obj.data.description || obj.data.short || obj.data)
+            case "fail": {
+                let err = new Error(obj.data.description || obj.data.short || obj.data)
+                err.data = obj.data
+                throw err
+            }
             case "error":
                 throw new Error(obj.message)
             default:
@@ -601,14 +983,54 @@ class Server {
         this.TeamID = null
     }
 
+    /**
+     * Log out: end the server's session, and forget the Team ID.
+     */
+    async Logout() {
+        try {
+            await this.call("/logout")
+        }
+        finally {
+            this.Reset()
+        }
+    }
+
     /**
      * Fetch current contest state.
      * 
      * @returns {Promise.<State>}
      */
     async GetState() {
-        let resp = await this.fetch("/state")
+        // Only transfer the state if it's changed since last time,
+        // and then only the parts that changed
+        let last = this.lastState
+        if (last && (last.TeamID != this.TeamID)) {
+            last = null
+        }
+        let headers = {}
+        if (last && last.ETag) {
+            headers["If-None-Match"] = last.ETag
+        }
+        let args = {since: last?.obj.Sequence ?? 0}
+        let resp = await this.fetch("/state", args, headers)
+        if (resp.status == 304) {
+            return new State(this, last.obj)
+        }
         let obj = await resp.json()
+        if (last && obj.Since && (obj.Since == last.obj.Sequence)) {
+            obj = {
+                ...obj,
+                PointsLog: [...last.obj.PointsLog, ...obj.PointsLog],
+                TeamNames: {...last.obj.TeamNames, ...obj.TeamNames},
+                Avatars: {...last.obj.Avatars, ...obj.Avatars},
+                TeamDivisions: {...last.obj.TeamDivisions, ...obj.TeamDivisions},
+            }
+        }
+        this.lastState = {
+            TeamID: this.TeamID,
+            ETag: resp.headers.get("ETag"),
+            obj,
+        }
         return new State(this, obj)
     }
 
@@ -620,14 +1042,84 @@ class Server {
      *
      * @param {string} teamID
      * @param {string} teamName 
-     * @returns {Promise.<string>} Success message from server
+     * @param {string} division Division to join, if any
+     * @param {string} email Where to send the team ID, if anywhere
+     * @returns {Promise.<Object>} Data from server, with recovery_codes if this registered the team
      */
-    async Login(teamID, teamName) {
-        let data = await this.call("/register", {id: teamID, name: teamName})
+    async Login(teamID, teamName, division="", email="") {
+        let args = {id: teamID, name: teamName}
+        if (division) {
+            args.division = division
+        }
+        if (email) {
+            args.email = email
+        }
+        let data = await this.call("/register", args)
         this.TeamID = teamID
         this.TeamName = teamName
         localStorage[this.teamIDKey] = teamID
-        return data.description || data.short
+        return data
+    }
+
+    /**
+     * Join a team as a member, with a join code from the team's owner.
+     *
+     * The member token sent back is used in place of the team ID from now on.
+     *
+     * @param {string} code Join code
+     * @param {string} name Member's name
+     * @returns {Promise.<Object>} Data from server, with member_token
+     */
+    async Join(code, name) {
+        let data = await this.call("/join", {code, name})
+        this.TeamID = data.member_token
+        localStorage[this.teamIDKey] = data.member_token
+        return data
+    }
+
+    /**
+     * Get the team's join code, to hand out to members.
+     *
+     * Only the team's owner, logged in with the team ID, may have it.
+     *
+     * @param {boolean} renew Make a new code, so the old one stops working
+     * @returns {Promise.<string>} Join code
+     */
+    async JoinCode(renew=false) {
+        let data = await this.call("/join-code", renew ? {renew} : {})
+        return data.join_code
+    }
+
+    /**
+     * Create a new team, with open registration.
+     *
+     * The server makes up the team ID.
+     * If it only sends the ID by email, this doesn't log in.
+     *
+     * @param {string} teamName
+     * @param {string} division Division to join, if any
+     * @param {string} email Where to send the team ID, if anywhere
+     * @param {string} captcha Response to the CAPTCHA, if there is one
+     * @returns {Promise.<Object>} Data from server, with team_id unless it was mailed
+     */
+    async CreateTeam(teamName, division="", email="", captcha="") {
+        let args = {name: teamName}
+        if (division) {
+            args.division = division
+        }
+        if (email) {
+            args.email = email
+        }
+        if (captcha) {
+            args.captcha = captcha
+        }
+        let data = await this.call("/create-team", args)
+        if (data.team_id) {
+            this.TeamID = data.team_id
+            this.TeamName = teamName
+            localStorage[this.teamIDKey] = data.team_id
+        }
+        return data
     }
 
     /**
@@ -635,6 +1127,9 @@ class Server {
      *
      * The returned promise will fail if anything goes wrong, including the
      * proposed answer being rejected.
+     * If the server limits wrong answers,
+     * the error's data has how many more may be given (remaining),
+     * and how many seconds are left before answers are accepted again (cooldown).
      *
      * @param {string} category Category of puzzle
      * @param {number} points Point value of puzzle
@@ -650,6 +1145,53 @@ class Server {
         return data.description || data.short
     }
 
+    /**
+     * Upload a file to answer a puzzle.
+     *
+     * The returned promise will fail if anything goes wrong, including the
+     * file being rejected.
+     *
+     * @param {string} category
+     * @param {number} points
+     * @param {File} file File to upload
+     * @returns {Promise.<string>} Success message
+     */
+    async SubmitUpload(category, points, file) {
+        let args = new FormData()
+        args.set("cat", category)
+        args.set("points", points)
+        args.set("file", file)
+        let data = await this.call("/upload", args)
+        return data.description || data.short
+    }
+
+    /**
+     * Fetch the theme's strings in a language.
+     *
+     * Strings the theme doesn't have in locale come from the server's default language.
+     *
+     * @param {string} locale Language tag, like "es" or "pt-BR"
+     * @returns {Promise.<Object.<string,string>>}
+     */
+    async GetTranslations(locale) {
+        let resp = await this.fetch(`/translations/${locale}.json`)
+        if (!resp.ok) {
+            return {}
+        }
+        return resp.json()
+    }
+
+    /**
+     * Set the language this team would like things in.
+     *
+     * @param {string} locale Language tag, or "" to forget the team's choice
+     * @returns {Promise.<string>} Success message
+     */
+    async SetLocale(locale) {
+        let data = await this.call("/profile", {locale})
+        return data.description || data.short
+    }
+
     /**
      * Fetch a file associated with a puzzle.
      * 
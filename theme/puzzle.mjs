@@ -27,13 +27,25 @@ async function formSubmitHandler(event) {
     console.groupCollapsed("Submit answer")
     console.info(`Proposed answer: ${proposed}`)
     try {
-        message = await window.app.puzzle.SubmitAnswer(proposed)
+        if (window.app.puzzle.IsUpload()) {
+            message = await window.app.puzzle.SubmitUpload(proposed)
+        } else {
+            message = await window.app.puzzle.SubmitAnswer(proposed)
+        }
         common.Toast(message)
         common.StateUpdateChannel.postMessage({})
         document.dispatchEvent(new CustomEvent("answerCorrect"))
     }
     catch (err) {
-        common.Toast(err)
+        let cooldown = err.data?.cooldown ?? 0
+        let remaining = err.data?.remaining
+        if (cooldown > 0) {
+            common.Toast(`${err.message}: try again in ${Math.ceil(cooldown / 60)} minute(s)`)
+        } else if (remaining !== undefined) {
+            common.Toast(`${err.message} (${remaining} more before a cooldown)`)
+        } else {
+            common.Toast(err)
+        }
     }
     console.groupEnd("Submit answer")
 }
@@ -44,6 +56,16 @@ async function formSubmitHandler(event) {
  * @param {Event} event 
  */
 async function answerInputHandler(event) {
+    if (window.app.puzzle.PossibleAnswerHashes().length == 0) {
+        // Puzzles with an answer checker other than "exact" don't send hashes,
+        // and neither do servers hiding them.
+        // The only way to check these answers is to submit them.
+        for (let ok of event.target.parentElement.querySelectorAll(".answer_ok")) {
+            ok.textContent = ""
+            ok.title = "Checked when submitted"
+        }
+        return
+    }
     let answer = event.target.value
     let correct = await window.app.puzzle.IsPossiblyCorrect(answer)
     for (let ok of event.target.parentElement.querySelectorAll(".answer_ok")) {
@@ -99,6 +121,134 @@ function SetAnswer(s) {
     e.dispatchEvent(new Event("input"))
 }
 
+/**
+ * Show where a puzzle's network service is, and whether it's up.
+ *
+ * Services proxied by the server are linked to.
+ *
+ * @param {moth.Puzzle} puzzle
+ */
+async function renderService(puzzle) {
+    let service = puzzle.Service
+    let state = await server.GetState()
+    let p = puzzleElement(false).appendChild(document.createElement("p"))
+    p.classList.add("service")
+    p.append("Service: ")
+    if (service.Proxy) {
+        let a = p.appendChild(document.createElement("a"))
+        let url = new URL(`service/${puzzle.Category}/${puzzle.Points}/`, common.BaseURL)
+        if (!state.Config.Sessions) {
+            // Without a session cookie, the service needs to be told who we are
+            url.searchParams.set("id", server.TeamID)
+        }
+        a.href = url
+        a.target = "_blank"
+        a.textContent = `${puzzle.Category} ${puzzle.Points}`
+    } else {
+        p.append(`${service.Host}:${service.Port}`)
+    }
+
+    let status = state.ServiceStatus(puzzle)
+    if (status) {
+        let span = p.appendChild(document.createElement("span"))
+        span.classList.add(status.Up ? "up" : "down")
+        span.textContent = status.Up ? " (up)" : " (down)"
+        span.title = `Checked ${new Date(status.Checked * 1000).toLocaleString()}`
+    }
+}
+
+/**
+ * Show how to connect to a puzzle's TCP listener, if it has one.
+ *
+ * @param {moth.Puzzle} puzzle
+ */
+async function renderListener(puzzle) {
+    let state = await server.GetState()
+    let port = state.ListenerPort(puzzle)
+    if (!port) {
+        return
+    }
+    let p = puzzleElement(false).appendChild(document.createElement("p"))
+    p.classList.add("listener")
+    p.append("Connect: ")
+    p.appendChild(document.createElement("code")).textContent = `nc ${location.hostname} ${port}`
+}
+
+/**
+ * Show a team's lab for a puzzle: whether it's ready, and where it is.
+ *
+ * Labs are set up in the background,
+ * so one may not be there until the page is loaded again.
+ *
+ * @param {moth.Puzzle} puzzle
+ */
+async function renderLab(puzzle) {
+    let state = await server.GetState()
+    let lab = state.Lab(puzzle)
+    let p = puzzleElement(false).appendChild(document.createElement("p"))
+    p.classList.add("lab")
+    p.append("Lab: ")
+    if (!lab) {
+        let onSolve = (puzzle.Lab.Trigger == "solve")
+        p.append(onSolve ? "set up once this puzzle is solved" : "being set up; reload to check on it")
+        return
+    }
+    let span = p.appendChild(document.createElement("span"))
+    span.classList.add(lab.Status)
+    span.textContent = lab.Status
+    if (lab.Address) {
+        p.append(" ")
+        p.appendChild(document.createElement("code")).textContent = lab.Address
+    }
+    if (lab.Message) {
+        p.append(` (${lab.Message})`)
+    }
+}
+
+/**
+ * Render a quiz's questions after the puzzle body.
+ *
+ * The answer field is hidden, and kept up to date with a JSON list of responses,
+ * one for each question.
+ *
+ * @param {Object[]} questions
+ */
+function renderQuiz(questions) {
+    let answer = document.querySelector("#answer")
+    answer.type = "hidden"
+    for (let e of document.querySelectorAll("label[for=answer]")) {
+        e.classList.add("hidden")
+    }
+
+    let inputs = []
+    let update = () => SetAnswer(JSON.stringify(inputs.map(get => get())))
+    let quiz = puzzleElement(false).appendChild(document.createElement("ol"))
+    quiz.classList.add("quiz")
+    questions.forEach((question, i) => {
+        let li = quiz.appendChild(document.createElement("li"))
+        let fieldset = li.appendChild(document.createElement("fieldset"))
+        fieldset.appendChild(document.createElement("legend")).textContent = question.Text
+        if (question.Choices?.length > 0) {
+            for (let choice of question.Choices) {
+                let label = fieldset.appendChild(document.createElement("label"))
+                let radio = label.appendChild(document.createElement("input"))
+                radio.type = "radio"
+                radio.name = `question${i}`
+                radio.value = choice
+                radio.addEventListener("change", update)
+                label.append(choice)
+            }
+            inputs.push(() => fieldset.querySelector("input:checked")?.value ?? "")
+        } else {
+            let input = fieldset.appendChild(document.createElement("input"))
+            input.type = "text"
+            input.addEventListener("input", update)
+            inputs.push(() => input.value)
+        }
+    })
+    update()
+}
+
 function writeObject(e, obj) {
     let keys = Object.keys(obj)
     keys.sort()
@@ -172,8 +322,36 @@ async function loadPuzzle(category, points) {
     document.querySelector("#authors").textContent = puzzle.Authors.join(", ")
     if (puzzle.AnswerPattern) {
         document.querySelector("#answer").pattern = puzzle.AnswerPattern
+    } else {
+        let state = await server.GetState()
+        let format = state.FlagFormat(category)
+        if (format) {
+            let answer = document.querySelector("#answer")
+            answer.pattern = format
+            answer.title = `Answers look like ${format}`
+        }
     }
     puzzleElement().innerHTML = puzzle.Body
+    if (puzzle.Questions.length > 0) {
+        renderQuiz(puzzle.Questions)
+    }
+    if (puzzle.Service) {
+        renderService(puzzle)
+    }
+    if (puzzle.Listener) {
+        renderListener(puzzle)
+    }
+    if (puzzle.Lab) {
+        renderLab(puzzle)
+    }
+    if (puzzle.IsUpload()) {
+        // Upload puzzles are answered with a file, checked on the server
+        let answer = document.querySelector("#answer")
+        answer.type = "file"
+        answer.required = true
+        answer.removeAttribute("pattern")
+        answer.title = "Checked when submitted"
+    }
     
     console.info("Adding attached scripts...")
     for (let script of (puzzle.Scripts || [])) {
@@ -194,6 +372,15 @@ async function loadPuzzle(category, points) {
         li.appendChild(a)
         document.getElementById("files").appendChild(li)
     }
+    if ((puzzle.Attachments || []).length > 1) {
+        // One request for everything, for teams on a poor network
+        let li = document.createElement("li")
+        let a = document.createElement("a")
+        a.href = new URL("bundle.zip", contentBase)
+        a.innerText = "All files (zip)"
+        li.appendChild(a)
+        document.getElementById("files").appendChild(li)
+    }
     
     workspacePromise.then(workspace => {
         let codeBlocks = document.querySelectorAll("code[class^=language-]")
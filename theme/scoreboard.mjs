@@ -90,8 +90,10 @@ async function classicRankings(rankingsElement, state, ScoreboardConfig) {
     while (rankingsElement.firstChild) rankingsElement.firstChild.remove()
 
     let sortedTeamIDs = [...scores.TeamIDs]
-    sortedTeamIDs.sort((a, b) => scores.CyFiScore(a) - scores.CyFiScore(b))
-    sortedTeamIDs.reverse()
+    sortedTeamIDs.sort((a, b) => (
+      (scores.CyFiScore(b) - scores.CyFiScore(a))
+      || ((state.TieBreaks[a] ?? 0) - (state.TieBreaks[b] ?? 0))
+    ))
     
     let topScore = scores.CyFiScore(sortedTeamIDs[0])
     for (let teamID of sortedTeamIDs) {